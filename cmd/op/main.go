@@ -1,13 +1,18 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"os"
 
 	"github.com/octopilot/octopilot-pipeline-tools/internal/cmd"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
 )
 
 func main() {
 	if err := cmd.Execute(); err != nil {
-		log.Fatalf("Error: %v", err)
+		log.Printf("Error: %v", err)
+		fmt.Fprint(os.Stderr, util.FormatErrorHints(err))
+		os.Exit(util.ExitCode(err))
 	}
 }
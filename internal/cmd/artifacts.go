@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/config"
+	skaffoldlog "github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/output/log"
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/parser"
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/latest"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// artifactInfo describes one artifact of the Skaffold configuration for
+// `op artifacts list`.
+type artifactInfo struct {
+	Image        string   `json:"image"`
+	Context      string   `json:"context"`
+	Builder      string   `json:"builder"`
+	Dockerfile   string   `json:"dockerfile,omitempty"`
+	BuilderImage string   `json:"builderImage,omitempty"`
+	RunImage     string   `json:"runImage,omitempty"`
+	Platforms    []string `json:"platforms,omitempty"`
+	Requires     []string `json:"requires,omitempty"`
+	Module       string   `json:"module,omitempty"`
+	Config       string   `json:"config"`
+}
+
+// artifactBuilderType names the Skaffold builder of a.
+func artifactBuilderType(a *latest.Artifact) string {
+	switch {
+	case a.BuildpackArtifact != nil:
+		return "buildpacks"
+	case a.DockerArtifact != nil:
+		return "docker"
+	case a.KoArtifact != nil:
+		return "ko"
+	case a.JibArtifact != nil:
+		return "jib"
+	case a.BazelArtifact != nil:
+		return "bazel"
+	case a.KanikoArtifact != nil:
+		return "kaniko"
+	case a.CustomArtifact != nil:
+		return "custom"
+	}
+	// Skaffold builds artifacts without a builder with docker.
+	return "docker"
+}
+
+// relToCwd returns path relative to cwd when it is below it.
+func relToCwd(cwd, path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	if rel, err := filepath.Rel(cwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// listArtifacts parses file with Skaffold, applying profiles and resolving
+// required configs, and describes every artifact. Platforms are the
+// artifact's own, else those of its config's build section.
+func listArtifacts(ctx context.Context, file string, profiles []string) ([]artifactInfo, error) {
+	// Skaffold logs every located config field at info level.
+	skaffoldlog.SetLevel(skaffoldlog.WarnLevel)
+	set, err := parser.GetConfigSet(ctx, config.SkaffoldOptions{ConfigurationFile: file, Profiles: profiles, Command: "build"})
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	cwd, _ := os.Getwd()
+	var out []artifactInfo
+	for _, cfg := range set {
+		for _, a := range cfg.Build.Artifacts {
+			info := artifactInfo{
+				Image:     a.ImageName,
+				Context:   relToCwd(cwd, firstNonEmpty(a.Workspace, filepath.Dir(cfg.SourceFile))),
+				Builder:   artifactBuilderType(a),
+				Platforms: a.Platforms,
+				Module:    cfg.Metadata.Name,
+				Config:    relToCwd(cwd, cfg.SourceFile),
+			}
+			if len(info.Platforms) == 0 {
+				info.Platforms = cfg.Build.Platforms
+			}
+			if a.BuildpackArtifact != nil {
+				info.BuilderImage = a.BuildpackArtifact.Builder
+				info.RunImage = a.BuildpackArtifact.RunImage
+			}
+			if a.DockerArtifact != nil {
+				info.Dockerfile = a.DockerArtifact.DockerfilePath
+			}
+			for _, d := range a.Dependencies {
+				info.Requires = append(info.Requires, d.ImageName)
+			}
+			out = append(out, info)
+		}
+	}
+	return out, nil
+}
+
+// printArtifacts writes artifacts as a table.
+func printArtifacts(w io.Writer, artifacts []artifactInfo) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "IMAGE\tCONTEXT\tBUILDER\tRUN IMAGE\tPLATFORMS")
+	for _, a := range artifacts {
+		platforms := strings.Join(a.Platforms, ",")
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", a.Image, a.Context, a.Builder, firstNonEmpty(a.RunImage, "-"), firstNonEmpty(platforms, "-"))
+	}
+	_ = tw.Flush()
+}
+
+var artifactsCmd = &cobra.Command{
+	Use:   "artifacts",
+	Short: "Explore the artifacts of skaffold.yaml.",
+}
+
+var artifactsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List artifacts with context, builder, run image and platforms.",
+	Long: `Parse skaffold.yaml the way op build does (profiles applied, required
+configs resolved) and list each artifact: image, context, builder type, run
+image (buildpacks) and platforms.
+
+-o json prints a JSON array, e.g. to generate a CI matrix:
+
+  op artifacts list -o json | jq -c '[.[].image]'`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, _ := cmd.Flags().GetString("filename")
+		profiles, _ := cmd.Flags().GetStringSlice("profile")
+		if val := viper.GetString("SKAFFOLD_PROFILE"); len(profiles) == 0 && val != "" {
+			// The profiles op build applies.
+			profiles = strings.Split(val, ",")
+		}
+		output, _ := cmd.Flags().GetString("output")
+		if output != "text" && output != "json" {
+			return fmt.Errorf("unknown output %q (expected text or json)", output)
+		}
+		artifacts, err := listArtifacts(cmd.Context(), file, profiles)
+		if err != nil {
+			return err
+		}
+		if output == "json" {
+			if artifacts == nil {
+				artifacts = []artifactInfo{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(artifacts)
+		}
+		printArtifacts(os.Stdout, artifacts)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(artifactsCmd)
+	artifactsCmd.AddCommand(artifactsListCmd)
+	artifactsListCmd.Flags().StringP("filename", "f", "skaffold.yaml", "Path to skaffold.yaml")
+	artifactsListCmd.Flags().StringSliceP("profile", "p", nil, "Skaffold profile(s) to activate (default: $SKAFFOLD_PROFILE)")
+	artifactsListCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const artifactsRootSkaffold = `apiVersion: skaffold/v4beta11
+kind: Config
+metadata:
+  name: root
+requires:
+  - path: services/worker
+build:
+  platforms: [linux/amd64, linux/arm64]
+  artifacts:
+    - image: api
+      context: api
+      buildpacks:
+        builder: ghcr.io/octopilot/builder-jammy-base:latest
+        runImage: ghcr.io/octopilot/run-jammy-base:latest
+    - image: web
+      context: web
+      docker:
+        dockerfile: Dockerfile
+      platforms: [linux/amd64]
+profiles:
+  - name: ci
+    patches:
+      - op: replace
+        path: /build/artifacts/0/buildpacks/runImage
+        value: ghcr.io/octopilot/run-jammy-base:1.0
+`
+
+const artifactsWorkerSkaffold = `apiVersion: skaffold/v4beta11
+kind: Config
+metadata:
+  name: worker
+build:
+  artifacts:
+    - image: worker
+      requires:
+        - image: api
+`
+
+func writeArtifactsProject(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "services", "worker"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "skaffold.yaml"), []byte(artifactsRootSkaffold), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "services", "worker", "skaffold.yaml"), []byte(artifactsWorkerSkaffold), 0o644))
+	wd, _ := os.Getwd()
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	return dir
+}
+
+func TestListArtifacts(t *testing.T) {
+	writeArtifactsProject(t)
+
+	artifacts, err := listArtifacts(t.Context(), "skaffold.yaml", nil)
+	require.NoError(t, err)
+	byImage := map[string]artifactInfo{}
+	for _, a := range artifacts {
+		byImage[a.Image] = a
+	}
+	require.Len(t, byImage, 3)
+
+	api := byImage["api"]
+	assert.Equal(t, "api", api.Context)
+	assert.Equal(t, "buildpacks", api.Builder)
+	assert.Equal(t, "ghcr.io/octopilot/run-jammy-base:latest", api.RunImage)
+	assert.Equal(t, []string{"linux/amd64", "linux/arm64"}, api.Platforms)
+	assert.Equal(t, "root", api.Module)
+
+	web := byImage["web"]
+	assert.Equal(t, "docker", web.Builder)
+	assert.Equal(t, "Dockerfile", web.Dockerfile)
+	assert.Equal(t, []string{"linux/amd64"}, web.Platforms)
+
+	worker := byImage["worker"]
+	assert.Equal(t, filepath.Join("services", "worker"), worker.Context)
+	assert.Equal(t, "docker", worker.Builder)
+	assert.Equal(t, []string{"api"}, worker.Requires)
+	assert.Equal(t, filepath.Join("services", "worker", "skaffold.yaml"), worker.Config)
+
+	artifacts, err = listArtifacts(t.Context(), "skaffold.yaml", []string{"ci"})
+	require.NoError(t, err)
+	for _, a := range artifacts {
+		if a.Image == "api" {
+			assert.Equal(t, "ghcr.io/octopilot/run-jammy-base:1.0", a.RunImage)
+		}
+	}
+
+	_, err = listArtifacts(t.Context(), "missing.yaml", nil)
+	assert.Error(t, err)
+}
+
+func TestPrintArtifacts(t *testing.T) {
+	var out bytes.Buffer
+	printArtifacts(&out, []artifactInfo{{Image: "api", Context: "api", Builder: "buildpacks", RunImage: "run:1", Platforms: []string{"linux/amd64", "linux/arm64"}}, {Image: "web", Context: ".", Builder: "docker"}})
+	assert.Equal(t, "IMAGE  CONTEXT  BUILDER     RUN IMAGE  PLATFORMS\n"+
+		"api    api      buildpacks  run:1      linux/amd64,linux/arm64\n"+
+		"web    .        docker      -          -\n", out.String())
+}
+
+func TestArtifactsListCmd_RejectsUnknownOutput(t *testing.T) {
+	_ = artifactsListCmd.Flags().Set("output", "yaml")
+	defer func() { _ = artifactsListCmd.Flags().Set("output", "text") }()
+	artifactsListCmd.SetContext(t.Context())
+	assert.ErrorContains(t, artifactsListCmd.RunE(artifactsListCmd, nil), `unknown output "yaml"`)
+}
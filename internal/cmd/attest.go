@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// attestPredicateTypes maps op's shorthands to in-toto predicate type URIs.
+// Other values (cosign shorthands such as slsaprovenance, spdx, cyclonedx,
+// vuln, or any URI) are passed to cosign unchanged.
+var attestPredicateTypes = map[string]string{
+	"test-result": "https://in-toto.io/attestation/test-result/v0.1",
+	"scan":        "https://cosign.sigstore.dev/attestation/vuln/v1",
+}
+
+// attestPredicateType resolves an op shorthand to its predicate type URI.
+func attestPredicateType(t string) string {
+	if uri, ok := attestPredicateTypes[t]; ok {
+		return uri
+	}
+	return t
+}
+
+// attestRefs returns the image refs to attest or verify: args, or the images
+// of build_result.json (only imageName when set).
+func attestRefs(args []string, buildResultDir, imageName string) ([]string, error) {
+	if len(args) > 0 {
+		return args, nil
+	}
+	res, err := util.ReadBuildResult(buildResultDir)
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, b := range res.Builds {
+		if imageName == "" || b.ImageName == imageName {
+			refs = append(refs, b.Tag)
+		}
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("no images (image name %q not in build_result.json?)", imageName)
+	}
+	return refs, nil
+}
+
+// cosignAttestOptions configures `op attest`.
+type cosignAttestOptions struct {
+	Predicate string
+	Type      string
+	// Key is a cosign key (file, KMS URI, ...); empty attests keyless with OIDC.
+	Key       string
+	Referrers bool
+	Insecure  bool
+}
+
+// cosignAttestArgs returns the cosign arguments that attach the predicate to
+// digestRef as a signed in-toto attestation.
+func cosignAttestArgs(digestRef string, o cosignAttestOptions) []string {
+	args := []string{"attest", "--yes", "--predicate", o.Predicate, "--type", attestPredicateType(o.Type)}
+	if o.Key != "" {
+		args = append(args, "--key", o.Key)
+	}
+	if o.Referrers {
+		args = append(args, "--registry-referrers-mode", "oci-1-1")
+	}
+	if o.Insecure {
+		args = append(args, "--allow-insecure-registry")
+	}
+	return append(args, digestRef)
+}
+
+// cosignVerifyAttestationArgs returns the cosign arguments that verify an
+// attestation of predicateType on digestRef.
+func cosignVerifyAttestationArgs(digestRef, predicateType string, o cosignVerifyOptions, referrers bool) []string {
+	args := []string{"verify-attestation", "--type", attestPredicateType(predicateType)}
+	if referrers {
+		args = append(args, "--experimental-oci11")
+	}
+	// Same key, identity and registry flags as op verify; drop its "verify".
+	return append(args, cosignVerifyArgs(digestRef, o)[1:]...)
+}
+
+// enableCosignReferrers opts cosign into its experimental OCI 1.1 referrers
+// support, which the referrers flags require.
+func enableCosignReferrers() {
+	_ = os.Setenv("COSIGN_EXPERIMENTAL", "1")
+}
+
+var attestCmd = &cobra.Command{
+	Use:   "attest [ref...]",
+	Short: "Attach a signed in-toto attestation to image digests.",
+	Long: `Create a signed in-toto attestation from a predicate file (JSON) and attach
+it to the given image refs, or to the images in build_result.json when no
+refs are given. Tags are resolved to digests first. Attestations are stored
+as OCI 1.1 referrers of the digest (--referrers=false for cosign's tag
+scheme).
+
+--type is the predicate type: a URI, a cosign shorthand (slsaprovenance,
+spdx, cyclonedx, vuln, custom) or one of op's shorthands:
+  test-result  https://in-toto.io/attestation/test-result/v0.1
+  scan         https://cosign.sigstore.dev/attestation/vuln/v1
+Use your own URI for other evidence such as review approvals.
+
+Use --key for key-based signing; without it cosign signs keyless via
+Sigstore OIDC. Requires the cosign CLI (override with OP_COSIGN).
+
+  op attest --predicate test-results.json --type test-result
+  op attest verify --type test-result --type scan \
+    --certificate-identity-regexp '^https://github.com/my-org/' \
+    --certificate-oidc-issuer https://token.actions.githubusercontent.com`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		imageName, _ := cmd.Flags().GetString("image-name")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		o := cosignAttestOptions{}
+		o.Predicate, _ = cmd.Flags().GetString("predicate")
+		o.Type, _ = cmd.Flags().GetString("type")
+		o.Key, _ = cmd.Flags().GetString("key")
+		o.Referrers, _ = cmd.Flags().GetBool("referrers")
+		if _, err := os.Stat(o.Predicate); err != nil {
+			return fmt.Errorf("predicate: %w", err)
+		}
+
+		refs, err := attestRefs(args, buildResultDir, imageName)
+		if err != nil {
+			return err
+		}
+		if o.Referrers {
+			enableCosignReferrers()
+		}
+		insecure := insecureRegistries(insecureFlag)
+		for _, r := range refs {
+			ref, err := resolveDigestRef(cmd.Context(), r, insecure)
+			if err != nil {
+				return err
+			}
+			o.Insecure = isInsecureRegistry(ref, insecure)
+			slog.Info("Attesting", util.LogKeyTag, ref, "predicate", attestPredicateType(o.Type))
+			if err := util.RunCommand(cmd.Context(), cosignBinary(), cosignAttestArgs(ref, o)...); err != nil {
+				return util.WithExitCode(util.ExitPush, fmt.Errorf("cosign attest %s: %w", ref, err))
+			}
+		}
+		return nil
+	},
+}
+
+var attestVerifyCmd = &cobra.Command{
+	Use:   "verify [ref...]",
+	Short: "Check that image digests carry attestations of every required predicate type.",
+	Long: `Verify that each image ref (or each image in build_result.json when no refs
+are given) has a valid, signed attestation of every --type. Run it before
+deploying or promoting to gate on test results, scans or approvals. All
+missing or invalid attestations are listed before the command fails.
+
+Verification options match op verify: --key, or keyless with a certificate
+identity and OIDC issuer constraint.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		imageName, _ := cmd.Flags().GetString("image-name")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		types, _ := cmd.Flags().GetStringArray("type")
+		referrers, _ := cmd.Flags().GetBool("referrers")
+		o := cosignVerifyOptions{}
+		o.Key, _ = cmd.Flags().GetString("key")
+		o.Identity, _ = cmd.Flags().GetString("certificate-identity")
+		o.IdentityRegexp, _ = cmd.Flags().GetString("certificate-identity-regexp")
+		o.OIDCIssuer, _ = cmd.Flags().GetString("certificate-oidc-issuer")
+		o.OIDCIssuerRegexp, _ = cmd.Flags().GetString("certificate-oidc-issuer-regexp")
+		if err := o.validate(); err != nil {
+			return err
+		}
+
+		refs, err := attestRefs(args, buildResultDir, imageName)
+		if err != nil {
+			return err
+		}
+		if referrers {
+			enableCosignReferrers()
+		}
+		insecure := insecureRegistries(insecureFlag)
+		var missing []string
+		for _, r := range refs {
+			ref, err := resolveDigestRef(cmd.Context(), r, insecure)
+			if err != nil {
+				return err
+			}
+			o.Insecure = isInsecureRegistry(ref, insecure)
+			for _, t := range types {
+				slog.Info("Verifying attestation", util.LogKeyTag, ref, "predicate", attestPredicateType(t))
+				if err := util.RunCommand(cmd.Context(), cosignBinary(), cosignVerifyAttestationArgs(ref, t, o, referrers)...); err != nil {
+					missing = append(missing, fmt.Sprintf("%s: %s", ref, t))
+				}
+			}
+		}
+		if len(missing) > 0 {
+			return util.WithExitCode(util.ExitVerification, fmt.Errorf("missing or invalid attestations:\n  %s", strings.Join(missing, "\n  ")))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(attestCmd)
+	attestCmd.Flags().String("predicate", "", "Predicate file (JSON) to attest")
+	attestCmd.Flags().String("type", "custom", "Predicate type: URI, cosign shorthand, or test-result, scan")
+	attestCmd.Flags().String("key", "", "Cosign private key (path, KMS or k8s:// URI); keyless when empty")
+	attestCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json, used when no refs are given")
+	attestCmd.Flags().String("image-name", "", "Only attest this artifact (image name from build_result.json)")
+	attestCmd.Flags().Bool("referrers", true, "Store the attestation as an OCI 1.1 referrer (false: cosign's .att tag)")
+	attestCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+	_ = attestCmd.MarkFlagRequired("predicate")
+	_ = attestCmd.RegisterFlagCompletionFunc("image-name", completeBuildResultImages)
+
+	attestCmd.AddCommand(attestVerifyCmd)
+	attestVerifyCmd.Flags().StringArray("type", nil, "Required predicate type (repeatable): URI, cosign shorthand, or test-result, scan")
+	attestVerifyCmd.Flags().String("key", "", "Cosign public key (path, KMS or k8s:// URI)")
+	attestVerifyCmd.Flags().String("certificate-identity", "", "Keyless: expected certificate identity (e.g. workflow URL)")
+	attestVerifyCmd.Flags().String("certificate-identity-regexp", "", "Keyless: regexp the certificate identity must match")
+	attestVerifyCmd.Flags().String("certificate-oidc-issuer", "", "Keyless: expected OIDC issuer")
+	attestVerifyCmd.Flags().String("certificate-oidc-issuer-regexp", "", "Keyless: regexp the OIDC issuer must match")
+	attestVerifyCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json, used when no refs are given")
+	attestVerifyCmd.Flags().String("image-name", "", "Only verify this artifact (image name from build_result.json)")
+	attestVerifyCmd.Flags().Bool("referrers", true, "Look up attestations as OCI 1.1 referrers (false: cosign's .att tag)")
+	attestVerifyCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+	_ = attestVerifyCmd.MarkFlagRequired("type")
+	_ = attestVerifyCmd.RegisterFlagCompletionFunc("image-name", completeBuildResultImages)
+}
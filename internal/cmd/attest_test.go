@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCosignAttestArgs(t *testing.T) {
+	assert.Equal(t, []string{"attest", "--yes", "--predicate", "results.json", "--type", "https://in-toto.io/attestation/test-result/v0.1",
+		"--registry-referrers-mode", "oci-1-1", "img@" + testDigest},
+		cosignAttestArgs("img@"+testDigest, cosignAttestOptions{Predicate: "results.json", Type: "test-result", Referrers: true}))
+	assert.Equal(t, []string{"attest", "--yes", "--predicate", "p.json", "--type", "https://example.com/review/v1",
+		"--key", "cosign.key", "--allow-insecure-registry", "img@" + testDigest},
+		cosignAttestArgs("img@"+testDigest, cosignAttestOptions{Predicate: "p.json", Type: "https://example.com/review/v1", Key: "cosign.key", Insecure: true}))
+}
+
+func TestCosignVerifyAttestationArgs(t *testing.T) {
+	args := cosignVerifyAttestationArgs("img@"+testDigest, "scan", cosignVerifyOptions{Key: "cosign.pub"}, true)
+	assert.Equal(t, []string{"verify-attestation", "--type", "https://cosign.sigstore.dev/attestation/vuln/v1",
+		"--experimental-oci11", "--key", "cosign.pub", "img@" + testDigest}, args)
+}
+
+func TestAttestRefs(t *testing.T) {
+	refs, err := attestRefs([]string{"a", "b"}, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, refs)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.BuildResultFilename), []byte(`{"builds":[{"imageName":"api","tag":"r/api:1@`+testDigest+`"},{"imageName":"web","tag":"r/web:1@`+testDigest+`"}]}`), 0o644))
+	refs, err = attestRefs(nil, dir, "web")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"r/web:1@" + testDigest}, refs)
+	_, err = attestRefs(nil, dir, "db")
+	assert.ErrorContains(t, err, `image name "db"`)
+}
+
+func TestAttestCmd(t *testing.T) {
+	t.Setenv("COSIGN_EXPERIMENTAL", "")
+	dir := t.TempDir()
+	predicate := filepath.Join(dir, "results.json")
+	require.NoError(t, os.WriteFile(predicate, []byte(`{"result":"PASSED"}`), 0o644))
+	var calls [][]string
+	orig := util.RunCommandFn
+	util.RunCommandFn = func(_ context.Context, name string, args ...string) error {
+		calls = append(calls, append([]string{name}, args...))
+		return nil
+	}
+	defer func() { util.RunCommandFn = orig }()
+
+	_ = attestCmd.Flags().Set("predicate", predicate)
+	_ = attestCmd.Flags().Set("type", "test-result")
+	defer func() {
+		_ = attestCmd.Flags().Set("predicate", "")
+		_ = attestCmd.Flags().Set("type", "custom")
+	}()
+	attestCmd.SetContext(t.Context())
+	require.NoError(t, attestCmd.RunE(attestCmd, []string{"ghcr.io/org/app:1@" + testDigest}))
+	require.Len(t, calls, 1)
+	assert.Equal(t, "cosign", calls[0][0])
+	assert.Equal(t, "ghcr.io/org/app@"+testDigest, calls[0][len(calls[0])-1])
+	assert.Equal(t, "1", os.Getenv("COSIGN_EXPERIMENTAL"))
+
+	_ = attestCmd.Flags().Set("predicate", filepath.Join(dir, "missing.json"))
+	assert.ErrorContains(t, attestCmd.RunE(attestCmd, []string{"img@" + testDigest}), "predicate")
+}
+
+func TestAttestVerifyCmd_ReportsAllMissing(t *testing.T) {
+	orig := util.RunCommandFn
+	util.RunCommandFn = func(_ context.Context, name string, args ...string) error {
+		if strings.Contains(strings.Join(args, " "), "vuln") {
+			return errors.New("no matching attestations")
+		}
+		return nil
+	}
+	defer func() { util.RunCommandFn = orig }()
+
+	_ = attestVerifyCmd.Flags().Set("key", "cosign.pub")
+	_ = attestVerifyCmd.Flags().Set("type", "test-result")
+	_ = attestVerifyCmd.Flags().Set("type", "scan")
+	defer func() {
+		_ = attestVerifyCmd.Flags().Set("key", "")
+		_ = attestVerifyCmd.Flags().Lookup("type").Value.(pflag.SliceValue).Replace(nil)
+	}()
+	attestVerifyCmd.SetContext(t.Context())
+	err := attestVerifyCmd.RunE(attestVerifyCmd, []string{"r/api@" + testDigest, "r/web@" + testDigest})
+	require.Error(t, err)
+	assert.Equal(t, "missing or invalid attestations:\n  r/api@"+testDigest+": scan\n  r/web@"+testDigest+": scan", err.Error())
+
+	_ = attestVerifyCmd.Flags().Set("key", "")
+	assert.ErrorContains(t, attestVerifyCmd.RunE(attestVerifyCmd, []string{"r/api@" + testDigest}), "--certificate-identity")
+}
@@ -2,33 +2,34 @@ package cmd
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"log/slog"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/config"
-	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/graph"
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/docker"
+	sklog "github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/output/log"
 	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/parser"
-	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/runner"
 	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/runner/runcontext"
 	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/latest"
-	"github.com/google/go-containerregistry/pkg/authn"
+	skutil "github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/util"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
-	"github.com/google/go-containerregistry/pkg/v1/empty"
-	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/octopilot/octopilot-pipeline-tools/internal/pack"
 	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/octopilot/octopilot-pipeline-tools/pkg/pipeline"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -37,66 +38,67 @@ var (
 	packBuild          = pack.Build
 	getAllConfigs      = parser.GetAllConfigs
 	getRunContext      = runcontext.GetRunContext
-	remoteHead         = remote.Head
+	remoteGet          = cachedRemoteGet
+	remoteHead         = cachedRemoteHead
 	remoteImage        = remote.Image
 	remoteWrite        = remote.Write
+	remoteDelete       = remote.Delete
 	resolveDefaultRepo = util.ResolveDefaultRepo
 )
 
-// Builder defines the interface for building artifacts (subset of runner.Runner)
-// We define this locally to make testing easier (mocking only Build method)
-type Builder interface {
-	Build(ctx context.Context, out io.Writer, artifacts []*latest.Artifact) ([]graph.Artifact, error)
-}
+// Builder is pipeline.Builder; newRunner is a var so tests can mock the runner.
+type Builder = pipeline.Builder
 
-// Wrap runner.NewForConfig to return our Builder interface
-var newRunner func(context.Context, *runcontext.RunContext) (Builder, error) = func(ctx context.Context, rc *runcontext.RunContext) (Builder, error) {
-	return runner.NewForConfig(ctx, rc)
-}
+var newRunner func(context.Context, *runcontext.RunContext) (Builder, error) = pipeline.NewSkaffoldBuilder
 
 var buildCmd = &cobra.Command{
 	Use:   "build",
 	Short: "Build with Skaffold. Use 'op build' for full build.",
 	Long:  `Build with Skaffold. Wraps 'skaffold build' using the Go library.`,
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
 		cwd, err := os.Getwd()
 		if err != nil {
 			return fmt.Errorf("error getting cwd: %w", err)
 		}
 
-		// Clean environment variables that might contain platform suffixes
-		// This ensures that we are targeting the "manifest list" tag (clean) rather than a specific platform tag
-		// which might be passed by CI.
-		cleanEnvVars := []string{"DOCKER_METADATA_OUTPUT_VERSION", "SKAFFOLD_TAG", "VERSION", "TAG", "IMAGE_TAG"}
-		var targetVersion string
-
-		for _, key := range cleanEnvVars {
-			if val := os.Getenv(key); val != "" {
-				// Clean it if it looks like it has a platform suffix
-				// We expect formats like: v0.0.34_linux_arm64, v0.0.34_linux_amd64
-				if strings.Contains(val, "_linux_") {
-					parts := strings.Split(val, "_linux_")
-					if len(parts) > 0 {
-						newVal := parts[0]
-						fmt.Printf("Stripping platform suffix from %s: %s -> %s\n", key, val, newVal)
-						os.Setenv(key, newVal)
-						if targetVersion == "" {
-							targetVersion = newVal
-						}
-					}
-				} else if targetVersion == "" {
-					targetVersion = val
-				}
-			}
+		runCfg, err := util.LoadRunConfig(cwd)
+		if err != nil {
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("reading %s: %w", util.RunConfigFilename, err))
+		}
+
+		// Strip platform suffixes (v0.0.34_linux_arm64) CI matrix jobs put on
+		// the version variables, so that we target the "manifest list" tag
+		// (clean) rather than a platform tag. Variables and patterns come from
+		// build.version_env.
+		targetVersion, versionChanges, err := util.CleanVersionEnv(runCfg.Build.VersionEnv)
+		if err != nil {
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("%s: build.version_env: %w", util.RunConfigFilename, err))
+		}
+		for _, c := range versionChanges {
+			slog.Info("Stripping platform suffix", "env", c.Var, "from", c.From, "to", c.To, "pattern", c.Pattern)
+		}
+
+		if targetVersion == "" {
+			// A tag run without a version variable (Azure Pipelines).
+			targetVersion = util.CIVersion()
 		}
 
-		opts := prepareSkaffoldOptions(cmd, cwd)
+		opts, err := prepareSkaffoldOptions(cmd, cwd)
+		if err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
+		// Pack runs the lifecycle in a Docker container, which reaches
+		// registries on the host through endpoints (see
+		// util.RegistryEndpoints): host.docker.internal on Mac/Windows,
+		// 127.0.0.1 on Linux, unchanged with OP_PACK_NETWORK=host.
+		endpoints := util.ResolveRegistryEndpoints(cwd, opts.InsecureRegistries)
+		opts.InsecureRegistries = endpoints.InsecureRegistries()
 
 		// Force the tag to be the clean version if we found one
 		// This ensures op-base (built by Skaffold) uses the clean tag (multi-arch index)
 		// instead of the platform-suffixed tag.
 		if targetVersion != "" && opts.CustomTag == "" {
-			fmt.Printf("Forcing Skaffold CustomTag to: %s\n", targetVersion)
+			slog.Info("Forcing Skaffold custom tag", util.LogKeyTag, targetVersion)
 			opts.CustomTag = targetVersion
 		}
 
@@ -104,7 +106,9 @@ var buildCmd = &cobra.Command{
 		if v := opts.DefaultRepo.Value(); v != nil {
 			repo = *v
 		}
-
+		if opts.Platforms, err = registryPlatforms(cwd, repo, opts.Platforms); err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
 		ttlUUID, _ := cmd.Flags().GetString("ttl-uuid")
 		ttlTag, _ := cmd.Flags().GetString("ttl-tag")
 		if ttlTag == "" {
@@ -120,36 +124,87 @@ var buildCmd = &cobra.Command{
 			}
 		}
 
-		ctx := context.Background()
+		buildTimeout, _ := cmd.Flags().GetDuration("build-timeout")
+		artifactTimeout, _ := cmd.Flags().GetDuration("artifact-timeout")
+		buildCtx := cmd.Context()
+		if buildTimeout > 0 {
+			var cancel context.CancelFunc
+			buildCtx, cancel = context.WithTimeout(buildCtx, buildTimeout)
+			defer cancel()
+		}
+		defer func() {
+			if err != nil && errors.Is(buildCtx.Err(), context.DeadlineExceeded) {
+				err = util.WithExitCode(util.ExitBuild, fmt.Errorf("build exceeded --build-timeout %s: %w", buildTimeout, err))
+			}
+		}()
+		ctx := buildCtx
+		setSkaffoldLogLevel()
+
+		// Build tool output moves to stderr when stdout carries the build
+		// result or digest for a script.
+		var progress io.Writer = os.Stdout
+		printDigest, _ := cmd.Flags().GetString("print-digest")
+		if resultFile := buildResultFile(cmd); resultFile == "-" || printDigest != "" {
+			if resultFile == "-" && printDigest != "" {
+				return util.WithExitCode(util.ExitConfig, fmt.Errorf("--print-digest and --build-result-file - both write to stdout"))
+			}
+			progress = os.Stderr
+		}
 
 		// 1. Parse Config
 		configs, err := getAllConfigs(ctx, opts)
 		if err != nil {
-			return fmt.Errorf("error parsing skaffold config: %w", err)
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("error parsing skaffold config: %w", err))
 		}
 
 		// 2. Create RunContext
 		runCtx, err := getRunContext(ctx, opts, configs)
 		if err != nil {
-			return fmt.Errorf("error creating run context: %w", err)
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("error creating run context: %w", err))
 		}
 
 		// Optional: filter to a single artifact (for matrix/fan-out integration builds)
 		artifactsToRun := runCtx.Artifacts()
 		if onlyArtifact, _ := cmd.Flags().GetString("artifact"); onlyArtifact != "" {
-			var filtered []*latest.Artifact
-			for _, a := range artifactsToRun {
-				if a.ImageName == onlyArtifact {
-					filtered = append(filtered, a)
-					break
-				}
-			}
-			if len(filtered) == 0 {
-				return fmt.Errorf("--artifact %q not found in skaffold config (available: %v)",
-					onlyArtifact, artifactImageNames(artifactsToRun))
+			filtered, err := pipeline.SelectArtifacts(artifactsToRun, onlyArtifact)
+			if err != nil {
+				return util.WithExitCode(util.ExitConfig, fmt.Errorf("--artifact: %w", err))
 			}
 			artifactsToRun = filtered
-			fmt.Printf("Building single artifact: %s\n", onlyArtifact)
+			slog.Info("Building single artifact", util.LogKeyArtifact, onlyArtifact)
+		}
+		if err := checkBuildpackFlag(cmd, artifactsToRun); err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
+
+		// Buildpack builders and run images named by tag come pinned from
+		// op.lock (see op lock), so rebuilds use the same images.
+		imageLock, err := util.LoadImageLock(cwd)
+		if err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
+		strict, _ := cmd.Flags().GetBool("strict")
+		if err := lockBuildpackImages(artifactsToRun, runCtx.Artifacts(), imageLock, strict); err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
+		// --reproducible builds stamp SOURCE_DATE_EPOCH (default: the commit
+		// time) instead of the build time, so rebuilding a commit gives the
+		// same digests. Pack and BuildKit stamp it as the creation time of the
+		// images, and the created labels and annotations the build adds are
+		// set to it; it is zero otherwise.
+		var reproducibleTime time.Time
+		if reproducible, _ := cmd.Flags().GetBool("reproducible"); reproducible {
+			if reproducibleTime, err = sourceDateEpoch(ctx, cwd); err != nil {
+				return util.WithExitCode(util.ExitConfig, fmt.Errorf("--reproducible: %w", err))
+			}
+			slog.Info("Reproducible build", "source_date_epoch", reproducibleTime.Unix())
+		}
+		// Images are labeled with their git source, commit and version
+		// (org.opencontainers.image.*) unless --oci-labels=false.
+		var ociLabels map[string]string
+		if on, _ := cmd.Flags().GetBool("oci-labels"); on {
+			ociLabels = pipeline.WithCreated(gitOCILabels(ctx, cwd), reproducibleTime)
+			addOCILabels(artifactsToRun, ociLabels)
 		}
 
 		// 3. Create Runner
@@ -168,708 +223,904 @@ var buildCmd = &cobra.Command{
 			useDirectPack = true
 		}
 
-		if useDirectPack {
-			fmt.Printf("Building with direct Pack integration (repo: %s, push: true)....\n", repo)
-
-			var built []util.Build
-			// Track built images for dependency resolution (imageName -> fullTag with digest)
-			builtImages := make(map[string]string)
-
-			// Pack runs the lifecycle in a Docker container. On Mac/Windows the container cannot
-			// reach the host registry at localhost; use host.docker.internal. On Linux 127.0.0.1 works.
-			// When OP_PACK_NETWORK=host the container shares the host network, so localhost works — do not rewrite.
-			hostRegistryForPack := "127.0.0.1:5001"
-			if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
-				hostRegistryForPack = "host.docker.internal:5001"
+		estargz, _ := cmd.Flags().GetBool("estargz")
+		cacheFrom, _ := cmd.Flags().GetStringArray("cache-from")
+		cacheTo, _ := cmd.Flags().GetString("cache-to")
+		if estargz && !useDirectPack {
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("--estargz needs --push"))
+		}
+		cleanupTags, _ := cmd.Flags().GetBool("cleanup-platform-tags")
+		if cleanupTags && !useDirectPack {
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("--cleanup-platform-tags needs --push"))
+		}
+		expiresAfter, _ := cmd.Flags().GetString("expires-after")
+		if expiresAfter != "" {
+			if !useDirectPack {
+				return util.WithExitCode(util.ExitConfig, fmt.Errorf("--expires-after needs --push"))
 			}
-			if os.Getenv("OP_PACK_NETWORK") == "host" {
-				hostRegistryForPack = "" // container sees host's localhost; keep refs as localhost:5001 / 127.0.0.1:5001
+			if err := pipeline.ValidateQuayDuration(expiresAfter); err != nil {
+				return util.WithExitCode(util.ExitConfig, fmt.Errorf("--expires-after: %w", err))
 			}
+		}
+		versionTagPolicy, _ := cmd.Flags().GetString("version-tag-policy")
+		if err := resetVersionTags(versionTagPolicy); err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
+		var metadata *dockerMetadata
+		if metadataFile, _ := cmd.Flags().GetString("metadata-file"); metadataFile != "" {
+			if !useDirectPack {
+				return util.WithExitCode(util.ExitConfig, fmt.Errorf("--metadata-file needs --push"))
+			}
+			if metadata, err = readDockerMetadata(metadataFile); err != nil {
+				return util.WithExitCode(util.ExitConfig, fmt.Errorf("--metadata-file: %w", err))
+			}
+		}
 
-			for _, art := range artifactsToRun {
-				if art.BuildpackArtifact != nil {
-					// It's a buildpack artifact
-					imageName := art.ImageName
-
-					// Construct tag (ttl.sh ephemeral or repo)
-					var fullTag string
-					if ttlUUID != "" {
-						suffix := deriveTTLSuffix(imageName)
-						fullTag = fmt.Sprintf("ttl.sh/%s-%s:%s", ttlUUID, suffix, ttlTag)
-					} else if repo != "" {
-						if strings.HasSuffix(repo, "/") {
-							fullTag = fmt.Sprintf("%s%s:latest", repo, imageName)
-						} else {
-							fullTag = fmt.Sprintf("%s/%s:latest", repo, imageName)
-						}
-					} else {
-						fullTag = fmt.Sprintf("%s:latest", imageName)
-					}
-
-				fmt.Printf("Building artifact %s -> %s\n", imageName, fullTag)
-
-				// Chart artifacts (image name ends with "-chart"): use Publish=false so the
-				// buildpack's helm push is the only push. The buildpack pushes a proper Helm OCI
-				// artifact (application/vnd.cncf.helm.chart.content.v1.tar+gzip) and writes the
-				// ref to BP_HELM_OCI_OUTPUT for us to consume.
-				if strings.HasSuffix(imageName, "-chart") {
-					// Use a dir under cwd so that when op runs in a container (e.g. GitHub Actions),
-					// the dir is on the workspace bind mount. For Pack we must pass the host path
-					// (GITHUB_WORKSPACE) as the volume source so the build container, which runs
-					// on the host via the Docker socket, can write the ref where op can read it.
-					helmOutDir, err := os.MkdirTemp(cwd, ".op-helm-out-")
-					if err != nil {
-						return fmt.Errorf("creating helm output dir: %w", err)
-					}
-					defer os.RemoveAll(helmOutDir)
+		load, _ := cmd.Flags().GetBool("load")
+		if load && useDirectPack {
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("--load cannot be combined with --push"))
+		}
+		if load && len(opts.Platforms) > 1 {
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("--load builds one platform into the local daemon; got %s", strings.Join(opts.Platforms, ",")))
+		}
 
-					volumeSource := helmOutDir
-					if hostWS := os.Getenv("GITHUB_WORKSPACE"); hostWS != "" {
-						volumeSource = filepath.Join(hostWS, filepath.Base(helmOutDir))
-					}
+		// Everything but Helm charts is built in the container daemon.
+		if slices.ContainsFunc(artifactsToRun, func(a *latest.Artifact) bool { return !strings.HasSuffix(a.ImageName, "-chart") }) {
+			if err := ensureContainerDaemon(cmd); err != nil {
+				return util.WithExitCode(util.ExitBuild, err)
+			}
+		}
 
-					// BP_HELM_OCI_REF is the OCI repo (no tag); helm push adds chart version as tag
-					refBase := fullTag
-					if idx := strings.LastIndex(fullTag, ":"); idx > 0 {
-						refBase = fullTag[:idx]
-					}
-					// Rewrite localhost/127.0.0.1 to hostRegistryForPack so the buildpack container can reach the host registry (no-op when OP_PACK_NETWORK=host).
-					rewrite := func(s string) string {
-						if hostRegistryForPack == "" {
-							return s
-						}
-						return strings.ReplaceAll(strings.ReplaceAll(s, "localhost:5001", hostRegistryForPack), "127.0.0.1:5001", hostRegistryForPack)
-					}
-					chartPackImageName := rewrite(fullTag)
-					chartPackRefBase := rewrite(refBase)
-					chartPackRunImage := art.BuildpackArtifact.RunImage
-					if resolved, ok := builtImages[chartPackRunImage]; ok {
-						chartPackRunImage = resolved
-					}
-					chartPackRunImage = rewrite(chartPackRunImage)
-					chartInsecureRegistries := opts.InsecureRegistries
-					if hostRegistryForPack != "" && (strings.Contains(fullTag, "localhost:5001") || strings.Contains(fullTag, "127.0.0.1:5001")) {
-						chartInsecureRegistries = append(chartInsecureRegistries, hostRegistryForPack)
-					}
-					packEnv := map[string]string{
-						"BP_GO_PRIVATE":      "github.com/octopilot/*",
-						"BP_HELM_OCI_REF":    chartPackRefBase,
-						"BP_HELM_OCI_OUTPUT": "/out",
-					}
-					for _, env := range art.BuildpackArtifact.Env {
-						parts := strings.SplitN(env, "=", 2)
-						if len(parts) == 2 {
-							packEnv[parts[0]] = parts[1]
-						}
-					}
+		if useDirectPack {
+			slog.Info("Building with direct Pack integration", "repo", repo, "push", true)
+			if err := ensureHarborProject(ctx, repo, opts.InsecureRegistries); err != nil {
+				return err
+			}
 
-					po := pack.BuildOptions{
-						ImageName: chartPackImageName,
-						Builder:   art.BuildpackArtifact.Builder,
-						Path:      filepath.Join(cwd, art.Workspace),
-						Publish:   false,
-						RunImage:  chartPackRunImage,
-						Target:    "",
-						Env:       packEnv,
-						SBOMDir: func() string {
-							s, _ := cmd.Flags().GetString("sbom-output")
-							return s
-						}(),
-						InsecureRegistries: chartInsecureRegistries,
-						Volumes:            []string{volumeSource + ":/out"},
-					}
-					if err := packBuild(ctx, po, os.Stdout); err != nil {
-						return fmt.Errorf("direct pack build (chart) failed for %s: %w", imageName, err)
-					}
+			var built []util.BuildEntry
+			// Track built images for dependency resolution (imageName -> fullTag with digest)
+			builtImages := make(map[string]string)
 
-					refBytes, err := os.ReadFile(filepath.Join(helmOutDir, "ref"))
-					if err != nil {
-						return fmt.Errorf("reading helm push ref for %s: %w", imageName, err)
+			// A failed or timed out build still records the artifacts that completed.
+			resultWritten := false
+			defer func() {
+				if err != nil && !resultWritten && len(built) > 0 {
+					slog.Warn("Build failed; writing the build result of the completed artifacts", "artifacts", len(built))
+					if wErr := writeBuildResult(cmd, built); wErr != nil {
+						slog.Warn("Could not write the partial build result", "error", wErr)
 					}
-					chartRef := strings.TrimSpace(string(refBytes))
-					built = append(built, util.Build{ImageName: imageName, Tag: chartRef})
-					builtImages[imageName] = chartRef
-					fmt.Printf("Chart artifact %s -> %s\n", imageName, chartRef)
-					continue
 				}
+			}()
+			// With --keep-going a failed artifact is recorded here and the
+			// others, except those depending on it, are still built.
+			keepGoing, _ := cmd.Flags().GetBool("keep-going")
+			var failures []artifactFailure
 
-				// Non-chart buildpack path (including multicontext: runImage may reference a
-				// previously built artifact like base-image). Resolve runImage so pack uses
-				// the actual built tag; do not use chartPack* variables here.
-				runImage := art.BuildpackArtifact.RunImage
-				if resolved, ok := builtImages[runImage]; ok {
-					fmt.Printf("Resolving runImage %s to built artifact %s\n", runImage, resolved)
-					runImage = resolved
+			for _, art := range artifactsToRun {
+				if dep := failedDependency(art, failures); dep != "" {
+					err := fmt.Errorf("not built: it depends on %s, which failed", dep)
+					slog.Error("Skipping artifact", util.LogKeyArtifact, art.ImageName, "error", err)
+					failures = append(failures, artifactFailure{art.ImageName, err})
+					continue
 				}
-
-				// Construct env
-				packEnv := map[string]string{
-						"BP_GO_PRIVATE": "github.com/octopilot/*",
+				artErr := func() (err error) {
+					// Each artifact gets its own --artifact-timeout context.
+					ctx := buildCtx
+					if artifactTimeout > 0 {
+						var cancel context.CancelFunc
+						ctx, cancel = context.WithTimeout(buildCtx, artifactTimeout)
+						defer cancel()
 					}
-					for _, env := range art.BuildpackArtifact.Env {
-						parts := strings.SplitN(env, "=", 2)
-						if len(parts) == 2 {
-							packEnv[parts[0]] = parts[1]
+					defer func() {
+						if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && !errors.Is(buildCtx.Err(), context.DeadlineExceeded) {
+							err = util.WithExitCode(util.ExitBuild, fmt.Errorf("%s exceeded --artifact-timeout %s: %w", art.ImageName, artifactTimeout, err))
+						}
+					}()
+					started := time.Now()
+					artCfg := runCfg.ArtifactBuild(art.ImageName)
+					platforms := opts.Platforms
+					if len(artCfg.Platforms) > 0 && !cmd.Flags().Changed("platform") && ttlUUID == "" {
+						if platforms, err = registryPlatforms(cwd, repo, artCfg.Platforms); err != nil {
+							return util.WithExitCode(util.ExitConfig, fmt.Errorf("%s: %w", art.ImageName, err))
 						}
 					}
-
-					// Prepare platform list
-					targetPlatforms := opts.Platforms
-					if len(targetPlatforms) == 0 {
-						targetPlatforms = []string{""} // Default/Host
-					}
-
-					var platformManifests []string
-
-					// Build for each platform
-					for _, platform := range targetPlatforms {
-						currentTag := fullTag
-						// If explicit multi-platform build, use distinct tags for intermediate images
-						if len(targetPlatforms) > 1 && platform != "" {
-							sanitized := strings.ReplaceAll(platform, "/", "-")
-							currentTag = fmt.Sprintf("%s-%s", fullTag, sanitized)
+					dockerCache := len(cacheFrom) > 0 || cacheTo != "" || artCfg.CacheImage != ""
+					if art.BuildpackArtifact != nil {
+						// It's a buildpack artifact
+						imageName := art.ImageName
+						log := util.ArtifactLogger(imageName)
+
+						// Construct tag (ttl.sh ephemeral or repo)
+						var fullTag string
+						if ttlUUID != "" {
+							suffix := deriveTTLSuffix(imageName)
+							fullTag = fmt.Sprintf("ttl.sh/%s-%s:%s", ttlUUID, suffix, ttlTag)
+						} else if repo != "" {
+							if strings.HasSuffix(repo, "/") {
+								fullTag = fmt.Sprintf("%s%s:latest", repo, imageName)
+							} else {
+								fullTag = fmt.Sprintf("%s/%s:latest", repo, imageName)
+							}
+						} else {
+							fullTag = fmt.Sprintf("%s:latest", imageName)
 						}
 
-						fmt.Printf("  -> Platform: %s, Tag: %s\n", platform, currentTag)
+					log.Info("Building artifact", util.LogKeyTag, fullTag)
+
+					// Chart artifacts (image name ends with "-chart"): use Publish=false so the
+					// buildpack's helm push is the only push. The buildpack pushes a proper Helm OCI
+					// artifact (application/vnd.cncf.helm.chart.content.v1.tar+gzip) and writes the
+					// ref to BP_HELM_OCI_OUTPUT for us to consume.
+					if strings.HasSuffix(imageName, "-chart") {
+						// Use a dir under cwd so that when op runs in a container (e.g. GitHub Actions),
+						// the dir is on the workspace bind mount. For Pack we must pass the host path
+						// (GITHUB_WORKSPACE) as the volume source so the build container, which runs
+						// on the host via the Docker socket, can write the ref where op can read it.
+						chartDeps, err := artifactChartDependencies(cmd, artCfg)
+						if err != nil {
+							return util.WithExitCode(util.ExitConfig, fmt.Errorf("%s: %w", imageName, err))
+						}
+						if err := resolveChartDependencies(ctx, filepath.Join(cwd, art.Workspace), chartDeps); err != nil {
+							return util.WithExitCode(util.ExitBuild, fmt.Errorf("%s: chart dependencies: %w", imageName, err))
+						}
 
-						// Pack runs the lifecycle in a Docker container; hostRegistryForPack is set above (host-aware).
-						packImageName := currentTag
-						packRunImage := runImage
-						packInsecureRegistries := opts.InsecureRegistries
+						helmOutDir, err := os.MkdirTemp(cwd, ".op-helm-out-")
+						if err != nil {
+							return fmt.Errorf("creating helm output dir: %w", err)
+						}
+						defer os.RemoveAll(helmOutDir)
 
-						rewriteForPackContainer := func(s string) (string, bool) {
-							if hostRegistryForPack == "" {
-								return s, false
-							}
-							if strings.Contains(s, "localhost:5001") || strings.Contains(s, "127.0.0.1:5001") {
-								out := strings.ReplaceAll(strings.ReplaceAll(s, "localhost:5001", hostRegistryForPack), "127.0.0.1:5001", hostRegistryForPack)
-								return out, true
-							}
-							return s, false
+						volumeSource := helmOutDir
+						if hostWS := os.Getenv("GITHUB_WORKSPACE"); hostWS != "" {
+							volumeSource = filepath.Join(hostWS, filepath.Base(helmOutDir))
 						}
 
-						var rewritten bool
-						if newTag, ok := rewriteForPackContainer(packImageName); ok {
-							packImageName = newTag
-							rewritten = true
+						// BP_HELM_OCI_REF is the OCI repo (no tag); helm push adds chart version as tag
+						refBase := fullTag
+						if idx := strings.LastIndex(fullTag, ":"); idx > 0 {
+							refBase = fullTag[:idx]
 						}
-						if newRun, ok := rewriteForPackContainer(packRunImage); ok {
-							packRunImage = newRun
-							rewritten = true
+						// Rewrite registry references to the addresses the buildpack container reaches them at.
+						rewrite := func(s string) string {
+							out, _ := endpoints.ContainerRef(s)
+							return out
 						}
-
-						if rewritten {
-							packInsecureRegistries = append(packInsecureRegistries, hostRegistryForPack)
+						chartPackImageName := rewrite(fullTag)
+						chartPackRefBase := rewrite(refBase)
+						chartPackRunImage := art.BuildpackArtifact.RunImage
+						if resolved, ok := builtImages[chartPackRunImage]; ok {
+							chartPackRunImage = resolved
 						}
-
-						packVolumes := []string{}
-						if caPath := os.Getenv("OP_REGISTRY_CA_PATH"); caPath != "" {
-							packVolumes = append(packVolumes, fmt.Sprintf("%s:/etc/ssl/certs/registry-ca.crt:ro", caPath))
-							packEnv["SSL_CERT_FILE"] = "/etc/ssl/certs/registry-ca.crt"
+						chartPackRunImage = rewrite(chartPackRunImage)
+						chartInsecureRegistries := endpoints.ContainerInsecureRegistries(fullTag)
+						packEnv, err := buildpackEnv(ctx, art, artCfg, map[string]string{
+							"BP_GO_PRIVATE":      "github.com/octopilot/*",
+							"BP_HELM_OCI_REF":    chartPackRefBase,
+							"BP_HELM_OCI_OUTPUT": "/out",
+						})
+						if err != nil {
+							return err
 						}
 
 						po := pack.BuildOptions{
-							ImageName: packImageName,
-							Builder:   art.BuildpackArtifact.Builder,
-							Path:      filepath.Join(cwd, art.Workspace),
-							Publish:   true,
-							RunImage:  packRunImage,
-							Target:    platform,
-							SBOMDir: func() string {
-								s, _ := cmd.Flags().GetString("sbom-output")
-								return s
-							}(),
-							InsecureRegistries: packInsecureRegistries,
-							Volumes:            packVolumes,
+							ImageName:          chartPackImageName,
+							Builder:            art.BuildpackArtifact.Builder,
+							Path:               filepath.Join(cwd, art.Workspace),
+							Publish:            false,
+							RunImage:           chartPackRunImage,
+							Target:             "",
+							Env:                packEnv,
+							SBOMDir:            artifactSBOMDir(cmd, artCfg),
+							InsecureRegistries: chartInsecureRegistries,
+							Volumes:            []string{volumeSource + ":/out"},
+							Verbose:            util.Verbose(),
+							Quiet:              util.Quiet(),
+							Buildpacks:         artifactBuildpacks(cmd, art, artCfg),
 						}
-						if err := packBuild(ctx, po, os.Stdout); err != nil {
-							return fmt.Errorf("direct pack build failed for %s (%s): %w", imageName, platform, err)
+						if artCfg.CacheImage != "" || len(artCfg.Annotations) > 0 {
+							log.Warn("cache_image and annotations are not supported for chart artifacts; ignoring them")
+						}
+						if err := packBuild(ctx, po, progress); err != nil {
+							return util.WithExitCode(util.ExitBuild, fmt.Errorf("direct pack build (chart) failed for %s: %w", imageName, err))
 						}
 
-						// Keep track of the pushed tag (original registry host, not 127.0.0.1)
-						platformManifests = append(platformManifests, currentTag)
-					}
-
-					// Prepare remote options for index creation/push
-					remoteOpts := []remote.Option{
-						remote.WithAuthFromKeychain(authn.DefaultKeychain),
-					}
-					for _, reg := range opts.InsecureRegistries {
-						if strings.HasPrefix(fullTag, reg) {
-							t := &http.Transport{
-								TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-							}
-							remoteOpts = append(remoteOpts, remote.WithTransport(t))
-							break
+						refBytes, err := os.ReadFile(filepath.Join(helmOutDir, "ref"))
+						if err != nil {
+							return util.WithExitCode(util.ExitPush, fmt.Errorf("reading helm push ref for %s: %w", imageName, err))
 						}
+						chartRef := strings.TrimSpace(string(refBytes))
+						built = append(built, builtEntry(imageName, chartRef, pipeline.ArtifactKindChart, started))
+						builtImages[imageName] = chartRef
+						log.Info("Pushed chart", util.LogKeyTag, chartRef)
+						return nil
 					}
 
-					finalDigest := ""
+					// Non-chart buildpack path (including multicontext: runImage may reference a
+					// previously built artifact like base-image). Resolve runImage so pack uses
+					// the actual built tag; do not use chartPack* variables here.
+					runImage := art.BuildpackArtifact.RunImage
+					_, runImageBuilt := builtImages[runImage]
+					if runImageBuilt {
+						log.Info("Resolving run image to built artifact", "runImage", runImage, "resolved", builtImages[runImage])
+						runImage = builtImages[runImage]
+					}
 
-					// Create Manifest List (Index) if we built multiple platforms
-					if len(targetPlatforms) > 1 {
-						fmt.Printf("Creating manifest list %s from %v\n", fullTag, platformManifests)
+					// Construct env
+					packEnv, err := buildpackEnv(ctx, art, artCfg, map[string]string{
+						"BP_GO_PRIVATE": "github.com/octopilot/*",
+					})
+					if err != nil {
+						return err
+					}
 
-						var idx mutate.IndexAddendum
-						_ = idx
+						// Prepare platform list
+						targetPlatforms := platforms
+						if len(targetPlatforms) == 0 {
+							targetPlatforms = []string{""} // Default/Host
+						}
 
-						// Start with empty index
-						// We'll default to OCI, but can switch to Docker
-						// GHCR usually works fine with OCI Index
-						var index v1.ImageIndex = empty.Index
-						index = mutate.IndexMediaType(index, types.DockerManifestList)
+						var platformManifests []string
 
-						for _, pTag := range platformManifests {
-							pRef, err := parseReferenceForRemote(pTag, opts.InsecureRegistries)
-							if err != nil {
-								return fmt.Errorf("parsing platform tag %s: %w", pTag, err)
+						// Build for each platform
+						for _, platform := range targetPlatforms {
+							currentTag := fullTag
+							// If explicit multi-platform build, use distinct tags for intermediate images
+							if len(targetPlatforms) > 1 && platform != "" {
+								sanitized := strings.ReplaceAll(platform, "/", "-")
+								currentTag = fmt.Sprintf("%s-%s", fullTag, sanitized)
 							}
 
-							// Get the remote image descriptor and image
-							desc, err := remote.Get(pRef, remoteOpts...)
-							if err != nil {
-								return fmt.Errorf("getting platform image %s: %w", pTag, err)
-							}
+							log.Info("Building platform", util.LogKeyPlatform, platform, util.LogKeyTag, currentTag)
 
-							img, err := desc.Image()
-							if err != nil {
-								return fmt.Errorf("getting image content for %s: %w", pTag, err)
+							// A run image built above may be an index with BuildKit
+							// attestation manifests, which Pack cannot use: hand it
+							// the image of this platform.
+							platformRunImage := runImage
+							if runImageBuilt {
+								p := platform
+								if p == "" {
+									p = "linux/" + runtime.GOARCH
+								}
+								if platformRunImage, err = pipeline.PlatformImageRef(runImage, p, opts.InsecureRegistries, remoteOptionsFor(ctx, runImage, opts.InsecureRegistries)); err != nil {
+									return util.WithExitCode(util.ExitBuild, fmt.Errorf("resolving run image for %s: %w", imageName, err))
+								}
 							}
 
-							index = mutate.AppendManifests(index, mutate.IndexAddendum{
-								Add:        img,
-								Descriptor: desc.Descriptor,
-							})
-						}
+							// Pack runs the lifecycle in a Docker container; see endpoints above.
+							packImageName, _ := endpoints.ContainerRef(currentTag)
+							packRunImage, _ := endpoints.ContainerRef(platformRunImage)
+							packInsecureRegistries := endpoints.ContainerInsecureRegistries(currentTag, platformRunImage)
 
-						// Push the index
-						ref, err := parseReferenceForRemote(fullTag, opts.InsecureRegistries)
-						if err != nil {
-							return fmt.Errorf("parsing full tag %s: %w", fullTag, err)
-						}
-
-						if err := remote.WriteIndex(ref, index, remoteOpts...); err != nil {
-							return fmt.Errorf("writing manifest list %s: %w", fullTag, err)
-						}
+							packVolumes := []string{}
+							if caPath := util.RegistryCAPath(); caPath != "" {
+								packVolumes = append(packVolumes, fmt.Sprintf("%s:/etc/ssl/certs/registry-ca.crt:ro", caPath))
+								packEnv["SSL_CERT_FILE"] = "/etc/ssl/certs/registry-ca.crt"
+							}
 
-						// Get the digest of the index we just pushed
-						// Note: WriteIndex doesn't return digest directly easily without computing it
-						// We can compute it from index.Digest()
-						d, err := index.Digest()
-						if err != nil {
-							return fmt.Errorf("computing index digest: %w", err)
-						}
-						finalDigest = d.String()
-						fmt.Printf("Successfully pushed manifest list %s (digest: %s)\n", fullTag, finalDigest)
+							po := pack.BuildOptions{
+								ImageName:          packImageName,
+								Builder:            art.BuildpackArtifact.Builder,
+								Path:               filepath.Join(cwd, art.Workspace),
+								Publish:            true,
+								RunImage:           packRunImage,
+								Target:             platform,
+								Env:                packEnv,
+								CacheImage:         platformCacheImage(artCfg.CacheImage, platform, len(targetPlatforms)),
+								SBOMDir:            artifactSBOMDir(cmd, artCfg),
+								InsecureRegistries: packInsecureRegistries,
+								Volumes:            packVolumes,
+								Verbose:            util.Verbose(),
+								Quiet:              util.Quiet(),
+								Buildpacks:         artifactBuildpacks(cmd, art, artCfg),
+							}
+							if !reproducibleTime.IsZero() {
+								po.CreationTime = &reproducibleTime
+							}
+							if err := packBuild(ctx, po, progress); err != nil {
+								return util.WithExitCode(util.ExitBuild, fmt.Errorf("direct pack build failed for %s (%s): %w", imageName, platform, err))
+							}
 
-					} else {
-						// Single platform, just get the digest
-						ref, err := parseReferenceForRemote(fullTag, opts.InsecureRegistries)
-						if err != nil {
-							return fmt.Errorf("parsing reference %q: %w", fullTag, err)
-						}
-						img, err := remoteHead(ref, remoteOpts...)
-						if err != nil {
-							return fmt.Errorf("getting image digest for %q: %w", fullTag, err)
+							// Keep track of the pushed tag (original registry host, not 127.0.0.1)
+							platformManifests = append(platformManifests, currentTag)
 						}
-						finalDigest = img.Digest.String()
-					}
-
-					// Append digest to tag so consumers (CI) can extract it
-					fullTagWithDigest := fmt.Sprintf("%s@%s", fullTag, finalDigest)
 
-					built = append(built, util.Build{
-						ImageName: imageName,
-						Tag:       fullTagWithDigest,
-					})
-
-					// Record for dependency resolution
-					builtImages[imageName] = fullTagWithDigest
+						// Prepare remote options for index creation/push
+						remoteOpts := remoteOptionsFor(ctx, fullTag, opts.InsecureRegistries)
 
-					// Tag with version if available
-					if version := os.Getenv("DOCKER_METADATA_OUTPUT_VERSION"); version != "" {
-						// Construct version tag (replace :latest with :version)
-						// fullTag is ...:latest
-						versionTagStr := strings.TrimSuffix(fullTag, "latest") + version
-						fmt.Printf("Tagging %s as %s...\n", fullTag, versionTagStr)
+						finalDigest := ""
+						var mediaType types.MediaType
+						var platformDigests []pipeline.PlatformDigest
 
-						if len(targetPlatforms) > 1 {
-							// Push the same index to the new tag
-							// We can just rely on remote.WriteIndex again or `remote.Tag` if it existed
-							// We can reconstruct the index or just fetch it.
-							// Actually we already have `index` variable above inside the if block.
-							// Logic is split. Better:
+						// Create Manifest List (Index) if we built multiple platforms or
+						// annotate the artifact (annotations live on the index)
+						if len(targetPlatforms) > 1 || len(artCfg.Annotations) > 0 {
+							log.Info("Creating manifest list", util.LogKeyTag, fullTag, "manifests", platformManifests)
 
-							verRef, err := parseReferenceForRemote(versionTagStr, opts.InsecureRegistries)
+							list, err := pushArtifactIndex(fullTag, platformManifests, artCfg.Annotations, reproducibleTime, opts.InsecureRegistries, remoteOpts)
 							if err != nil {
-								return fmt.Errorf("parsing version reference %q: %w", versionTagStr, err)
-							}
-
-							// If we built an index, we should copy it (referencing same manifests)
-							// Or just pull the index we just pushed and push it to new tag.
-							srcRef, _ := parseReferenceForRemote(fullTag, opts.InsecureRegistries)
-							desc, err := remote.Get(srcRef, remoteOpts...)
-							if err != nil {
-								return fmt.Errorf("getting source index %s: %w", fullTag, err)
-							}
-
-							if desc.MediaType.IsIndex() {
-								idx, err := desc.ImageIndex()
-								if err != nil {
-									return fmt.Errorf("getting index content: %w", err)
-								}
-								if err := remote.WriteIndex(verRef, idx, remoteOpts...); err != nil {
-									return fmt.Errorf("tagging version index %q: %w", versionTagStr, err)
-								}
-							} else {
-								img, err := desc.Image()
-								if err != nil {
-									return fmt.Errorf("getting image content: %w", err)
-								}
-								if err := remote.Write(verRef, img, remoteOpts...); err != nil {
-									return fmt.Errorf("tagging version image %q: %w", versionTagStr, err)
-								}
+								return util.WithExitCode(util.ExitPush, err)
 							}
+							finalDigest = list.Digest
+							mediaType = list.MediaType
+							platformDigests = list.Platforms
+							log.Info("Pushed manifest list", util.LogKeyTag, fullTag, "digest", finalDigest)
 
 						} else {
-							// Single image copy
+							// Single platform, just get the digest
 							ref, err := parseReferenceForRemote(fullTag, opts.InsecureRegistries)
 							if err != nil {
 								return fmt.Errorf("parsing reference %q: %w", fullTag, err)
 							}
-							img, err := remoteImage(ref, remoteOpts...)
-							if err != nil {
-								return fmt.Errorf("reading image %q: %w", fullTag, err)
-							}
-							verRef, err := parseReferenceForRemote(versionTagStr, opts.InsecureRegistries)
+							img, err := remoteHead(ctx, ref, remoteOpts...)
 							if err != nil {
-								return fmt.Errorf("parsing version reference %q: %w", versionTagStr, err)
+								return util.WithExitCode(util.ExitPush, fmt.Errorf("getting image digest for %q: %w", fullTag, err))
 							}
-							if err := remoteWrite(verRef, img, remoteOpts...); err != nil {
-								return fmt.Errorf("tagging version %q: %w", versionTagStr, err)
+							finalDigest = img.Digest.String()
+							mediaType = img.MediaType
+							if targetPlatforms[0] != "" {
+								platformDigests = []pipeline.PlatformDigest{{Platform: targetPlatforms[0], Digest: finalDigest}}
 							}
 						}
-						fmt.Printf("Successfully pushed %s\n", versionTagStr)
-					}
 
-					// WAIT FOR IMAGE PROPAGATION
-					// In some registries (GHCR, etc.), a pushed image might not be immediately available
-					// for pulling by a subsequent build step (even if push succeeded).
-					// We poll for it to ensure the next step in the skaffold graph can succeed.
-					timeout, _ := cmd.Flags().GetDuration("propagation-timeout")
-					if err := waitForImage(fullTag, timeout, opts.InsecureRegistries, remoteOpts...); err != nil {
-						fmt.Printf("Warning: failed to wait for image propagation: %v\n", err)
-						// Don't fail the build, hope for the best, but warn.
-					}
+						// Append digest to tag so consumers (CI) can extract it
+						fullTagWithDigest := fmt.Sprintf("%s@%s", fullTag, finalDigest)
 
-			} else if (len(opts.Platforms) > 1 || ttlUUID != "") && art.DockerArtifact != nil {
-				// Multi-arch Docker artifact: build each platform separately and assemble the
-				// manifest list ourselves. The Skaffold fork runner has a bug where BuildKit's
-				// provenance/attestation manifest turns per-platform tags into OCI Indexes; the
-				// fork then calls .Image() on that index and fails with
-				// "no child with platform X in index <arm64-tag>@<digest>".
-				// We mirror the buildpack path: per-platform docker build + go-containerregistry
-				// manifest list assembly, with BUILDX_NO_DEFAULT_ATTESTATIONS=1 to suppress
-				// attestation manifests so each per-platform tag is a clean single-arch image.
-
-				var fullTag string
-				if ttlUUID != "" {
-					suffix := deriveTTLSuffix(art.ImageName)
-					fullTag = fmt.Sprintf("ttl.sh/%s-%s:%s", ttlUUID, suffix, ttlTag)
-				} else if strings.HasSuffix(repo, "/") {
-					fullTag = fmt.Sprintf("%s%s:latest", repo, art.ImageName)
-				} else {
-					fullTag = fmt.Sprintf("%s/%s:latest", repo, art.ImageName)
-				}
-
-				contextDir := filepath.Join(cwd, art.Workspace)
-				dockerfilePath := art.DockerArtifact.DockerfilePath
-				if dockerfilePath == "" {
-					dockerfilePath = "Dockerfile"
-				}
-				if !filepath.IsAbs(dockerfilePath) {
-					dockerfilePath = filepath.Join(contextDir, dockerfilePath)
-				}
-
-				dockerRemoteOpts := []remote.Option{
-					remote.WithAuthFromKeychain(authn.DefaultKeychain),
-				}
-				for _, reg := range opts.InsecureRegistries {
-					if strings.HasPrefix(fullTag, reg) {
-						dockerRemoteOpts = append(dockerRemoteOpts, remote.WithTransport(&http.Transport{
-							TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-						}))
-						break
-					}
-				}
+						entry := builtEntry(imageName, fullTagWithDigest, pipeline.ArtifactKindImage, started)
+						entry.MediaType = string(mediaType)
+						entry.Platforms = platformDigests
+						entry.Builder = pinnedImageRef(ctx, art.BuildpackArtifact.Builder, opts.InsecureRegistries, log)
+						entry.RunImage = pinnedImageRef(ctx, runImage, opts.InsecureRegistries, log)
+						if sbomDir := artifactSBOMDir(cmd, artCfg); sbomDir != "" {
+							entry.SBOM = []string{sbomDir}
+						}
+						built = append(built, entry)
+
+						// Record for dependency resolution
+						builtImages[imageName] = fullTagWithDigest
+
+						// Tag with version if available
+						if version := util.CIVersion(); version != "" {
+							// Construct version tag (replace :latest with :version)
+							// fullTag is ...:latest
+							versionTagStr := strings.TrimSuffix(fullTag, "latest") + version
+							log.Info("Tagging version", util.LogKeyTag, fullTag, "version", versionTagStr)
+
+							if pushed, err := pushCIVersionTag(ctx, fullTag, version, opts.InsecureRegistries, remoteOpts); err != nil {
+								return err
+							} else if pushed {
+								log.Info("Pushed version tag", util.LogKeyTag, versionTagStr)
+							}
+						}
 
-				var platformManifests []string
+						// WAIT FOR IMAGE PROPAGATION
+						// In some registries (GHCR, etc.), a pushed image might not be immediately available
+						// for pulling by a subsequent build step (even if push succeeded).
+						// We poll for it to ensure the next step in the skaffold graph can succeed.
+						if err := waitForImage(ctx, cmd, fullTag, opts.InsecureRegistries, remoteOpts...); err != nil {
+							log.Warn("Failed to wait for image propagation", util.LogKeyTag, fullTag, "error", err)
+							// Don't fail the build, hope for the best, but warn.
+						}
+						if cleanupTags {
+							cleanupPlatformTags(fullTag, platformManifests, opts.InsecureRegistries, remoteOpts)
+						}
 
-				for _, platform := range opts.Platforms {
-					sanitized := strings.ReplaceAll(platform, "/", "-")
-					platformTag := fmt.Sprintf("%s-%s", fullTag, sanitized)
-					if ttlUUID != "" && len(opts.Platforms) == 1 {
-						platformTag = fullTag
+				} else if (len(platforms) > 1 || ttlUUID != "" || dockerCache) && art.DockerArtifact != nil {
+					// Multi-arch Docker artifact: build each platform separately and assemble the
+					// manifest list ourselves. The Skaffold fork runner has a bug where BuildKit's
+					// provenance/attestation manifest turns per-platform tags into OCI Indexes; the
+					// fork then calls .Image() on that index and fails with
+					// "no child with platform X in index <arm64-tag>@<digest>".
+					// We mirror the buildpack path: per-platform docker build + go-containerregistry
+					// manifest list assembly, which takes the platform image out of each
+					// per-platform tag and keeps its attestation manifests (see
+					// pipeline.ManifestListEntries).
+					// A registry cache (--cache-from/--cache-to, cache_image) also takes this path:
+					// Skaffold's docker builder cannot export a cache.
+
+					log := util.ArtifactLogger(art.ImageName)
+					if len(platforms) == 0 {
+						platforms = []string{"linux/" + runtime.GOARCH}
 					}
-
-					fmt.Printf("Building Docker artifact %s for platform %s -> %s\n", art.ImageName, platform, platformTag)
-
-					// BUILDX_NO_DEFAULT_ATTESTATIONS=1 prevents BuildKit from wrapping the
-					// pushed image in an OCI Index that contains an attestation child manifest.
-					// Without this, `docker build --push` via BuildKit produces an Index even
-					// for a single platform, breaking our manifest-list assembly below.
-					buildEnv := append(os.Environ(), "BUILDX_NO_DEFAULT_ATTESTATIONS=1")
-					buildArgs := []string{
-						"build",
-						"--platform", platform,
-						"--push",
-						"--tag", platformTag,
-						"--file", dockerfilePath,
-						contextDir,
+					if dockerCache && util.IsPodman() {
+						log.Warn("podman build does not take buildx cache specs; ignoring --cache-from, --cache-to and cache_image")
 					}
-					buildCmd := exec.CommandContext(ctx, "docker", buildArgs...)
-					buildCmd.Stdout = os.Stdout
-					buildCmd.Stderr = os.Stderr
-					buildCmd.Env = buildEnv
-					if err := buildCmd.Run(); err != nil {
-						return fmt.Errorf("docker build failed for %s (%s): %w", art.ImageName, platform, err)
+					var fullTag string
+					if ttlUUID != "" {
+						suffix := deriveTTLSuffix(art.ImageName)
+						fullTag = fmt.Sprintf("ttl.sh/%s-%s:%s", ttlUUID, suffix, ttlTag)
+					} else if strings.HasSuffix(repo, "/") {
+						fullTag = fmt.Sprintf("%s%s:latest", repo, art.ImageName)
+					} else {
+						fullTag = fmt.Sprintf("%s/%s:latest", repo, art.ImageName)
 					}
 
-					platformManifests = append(platformManifests, platformTag)
-				}
-
-				// Assemble manifest list from per-platform images (same logic as buildpack path)
-				fmt.Printf("Creating manifest list %s from %v\n", fullTag, platformManifests)
-
-				var index v1.ImageIndex = empty.Index
-				index = mutate.IndexMediaType(index, types.DockerManifestList)
-
-				for _, pTag := range platformManifests {
-					pRef, err := parseReferenceForRemote(pTag, opts.InsecureRegistries)
-					if err != nil {
-						return fmt.Errorf("parsing platform tag %s: %w", pTag, err)
+					contextDir := filepath.Join(cwd, art.Workspace)
+					dockerfilePath := art.DockerArtifact.DockerfilePath
+					if dockerfilePath == "" {
+						dockerfilePath = "Dockerfile"
 					}
-					desc, err := remote.Get(pRef, dockerRemoteOpts...)
-					if err != nil {
-						return fmt.Errorf("getting platform image %s: %w", pTag, err)
+					if !filepath.IsAbs(dockerfilePath) {
+						dockerfilePath = filepath.Join(contextDir, dockerfilePath)
 					}
-					img, err := desc.Image()
+
+					artifactArgs, err := dockerArtifactArgs(art.DockerArtifact)
 					if err != nil {
-						return fmt.Errorf("getting image content for %s: %w", pTag, err)
+						return util.WithExitCode(util.ExitConfig, fmt.Errorf("%s: %w", art.ImageName, err))
 					}
-					index = mutate.AppendManifests(index, mutate.IndexAddendum{
-						Add:        img,
-						Descriptor: desc.Descriptor,
-					})
-				}
+					dockerRemoteOpts := remoteOptionsFor(ctx, fullTag, opts.InsecureRegistries)
 
-				ref, err := parseReferenceForRemote(fullTag, opts.InsecureRegistries)
-				if err != nil {
-					return fmt.Errorf("parsing full tag %s: %w", fullTag, err)
-				}
-				if err := remote.WriteIndex(ref, index, dockerRemoteOpts...); err != nil {
-					return fmt.Errorf("writing manifest list %s: %w", fullTag, err)
-				}
+					var platformManifests []string
 
-				d, err := index.Digest()
-				if err != nil {
-					return fmt.Errorf("computing index digest: %w", err)
-				}
-				finalDigest := d.String()
-				fmt.Printf("Successfully pushed manifest list %s (digest: %s)\n", fullTag, finalDigest)
+					for _, platform := range platforms {
+						sanitized := strings.ReplaceAll(platform, "/", "-")
+						platformTag := fmt.Sprintf("%s-%s", fullTag, sanitized)
+						if ttlUUID != "" && len(platforms) == 1 {
+							platformTag = fullTag
+						}
 
-				fullTagWithDigest := fmt.Sprintf("%s@%s", fullTag, finalDigest)
+						log.Info("Building Docker artifact", util.LogKeyPlatform, platform, util.LogKeyTag, platformTag)
 
-				// Version tag (same logic as buildpack path)
-				if version := os.Getenv("DOCKER_METADATA_OUTPUT_VERSION"); version != "" {
-					versionTagStr := strings.TrimSuffix(fullTag, "latest") + version
-					fmt.Printf("Tagging %s as %s...\n", fullTag, versionTagStr)
-					verRef, err := parseReferenceForRemote(versionTagStr, opts.InsecureRegistries)
-					if err != nil {
-						return fmt.Errorf("parsing version reference %q: %w", versionTagStr, err)
-					}
-					srcRef, _ := parseReferenceForRemote(fullTag, opts.InsecureRegistries)
-					desc, err := remote.Get(srcRef, dockerRemoteOpts...)
-					if err != nil {
-						return fmt.Errorf("getting source index %s: %w", fullTag, err)
-					}
-					if desc.MediaType.IsIndex() {
-						idx, err := desc.ImageIndex()
-						if err != nil {
-							return fmt.Errorf("getting index content: %w", err)
-						}
-						if err := remote.WriteIndex(verRef, idx, dockerRemoteOpts...); err != nil {
-							return fmt.Errorf("tagging version index %q: %w", versionTagStr, err)
+						buildArgs := []string{"build", "--platform", platform}
+						if !util.IsPodman() {
+							// podman build has no --push; the image is pushed separately below.
+							buildArgs = append(buildArgs, dockerPushArgs(reproducibleTime)...)
+							buildArgs = append(buildArgs, dockerCacheArgs(cacheFrom, cacheTo, artCfg.CacheImage, fullTag, platform, len(platforms))...)
 						}
-					} else {
-						img, err := desc.Image()
-						if err != nil {
-							return fmt.Errorf("getting image for version tag: %w", err)
+						buildArgs = append(buildArgs, reproducibleDockerArgs(reproducibleTime)...)
+						// skaffold.yaml settings, including the OCI labels added to cliFlags.
+						buildArgs = append(buildArgs, artifactArgs...)
+						buildArgs = append(buildArgs,
+							"--tag", platformTag,
+							"--file", dockerfilePath,
+							contextDir,
+						)
+						buildCmd := exec.CommandContext(ctx, util.ContainerCLI(), buildArgs...)
+						buildCmd.Stdout = util.ProgressWriter(progress)
+						buildCmd.Stderr = os.Stderr
+						if err := buildCmd.Run(); err != nil {
+							return util.WithExitCode(util.ExitBuild, fmt.Errorf("docker build failed for %s (%s): %w", art.ImageName, platform, err))
 						}
-						if err := remote.Write(verRef, img, dockerRemoteOpts...); err != nil {
-							return fmt.Errorf("tagging version image %q: %w", versionTagStr, err)
+						if util.IsPodman() {
+							pushArgs := []string{"push"}
+							if isInsecureRegistry(platformTag, opts.InsecureRegistries) {
+								pushArgs = append(pushArgs, "--tls-verify=false")
+							}
+							pushArgs = append(pushArgs, platformTag)
+							pushCmd := exec.CommandContext(ctx, util.ContainerCLI(), pushArgs...)
+							pushCmd.Stdout = util.ProgressWriter(progress)
+							pushCmd.Stderr = os.Stderr
+							if err := pushCmd.Run(); err != nil {
+								return util.WithExitCode(util.ExitPush, fmt.Errorf("podman push failed for %s (%s): %w", art.ImageName, platform, err))
+							}
 						}
+
+						platformManifests = append(platformManifests, platformTag)
 					}
-					fmt.Printf("Successfully tagged version %s\n", versionTagStr)
-				}
 
-				// Wait for propagation
-				timeout, _ := cmd.Flags().GetDuration("propagation-timeout")
-				if err := waitForImage(fullTag, timeout, opts.InsecureRegistries, dockerRemoteOpts...); err != nil {
-					fmt.Printf("Warning: failed to wait for image propagation: %v\n", err)
-				}
+					// Assemble manifest list from per-platform images (same logic as buildpack path)
+					log.Info("Creating manifest list", util.LogKeyTag, fullTag, "manifests", platformManifests)
+
+					list, err := pushArtifactIndex(fullTag, platformManifests, artCfg.Annotations, reproducibleTime, opts.InsecureRegistries, dockerRemoteOpts)
+					if err != nil {
+						return util.WithExitCode(util.ExitPush, err)
+					}
+					finalDigest := list.Digest
+					log.Info("Pushed manifest list", util.LogKeyTag, fullTag, "digest", finalDigest)
 
-				built = append(built, util.Build{ImageName: art.ImageName, Tag: fullTagWithDigest})
-				builtImages[art.ImageName] = fullTagWithDigest
+					fullTagWithDigest := fmt.Sprintf("%s@%s", fullTag, finalDigest)
 
-			} else {
-				// Single-platform or non-Docker artifact: delegate to Skaffold runner.
-				// The Skaffold runner works correctly for single-platform builds.
-				fmt.Printf("Delegating non-buildpack artifact %s to Skaffold runner...\n", art.ImageName)
-				artifactsToBuild := []*latest.Artifact{art}
+					// Version tag (same logic as buildpack path)
+					if version := util.CIVersion(); version != "" {
+						versionTagStr := strings.TrimSuffix(fullTag, "latest") + version
+						log.Info("Tagging version", util.LogKeyTag, fullTag, "version", versionTagStr)
+						if pushed, err := pushCIVersionTag(ctx, fullTag, version, opts.InsecureRegistries, dockerRemoteOpts); err != nil {
+							return err
+						} else if pushed {
+							log.Info("Pushed version tag", util.LogKeyTag, versionTagStr)
+						}
+					}
 
-				bRes, err := r.Build(ctx, os.Stdout, artifactsToBuild)
-				if err != nil {
-					return fmt.Errorf("skaffold build failed for %s: %w", art.ImageName, err)
-				}
+					// Wait for propagation
+					if err := waitForImage(ctx, cmd, fullTag, opts.InsecureRegistries, dockerRemoteOpts...); err != nil {
+						log.Warn("Failed to wait for image propagation", util.LogKeyTag, fullTag, "error", err)
+					}
+					if cleanupTags {
+						cleanupPlatformTags(fullTag, platformManifests, opts.InsecureRegistries, dockerRemoteOpts)
+					}
 
-				for _, ba := range bRes {
-					built = append(built, util.Build{
-						ImageName: ba.ImageName,
-						Tag:       ba.Tag,
-					})
-					builtImages[ba.ImageName] = ba.Tag
+					entry := builtEntry(art.ImageName, fullTagWithDigest, pipeline.ArtifactKindImage, started)
+					entry.MediaType = string(list.MediaType)
+					entry.Platforms = list.Platforms
+					built = append(built, entry)
+					builtImages[art.ImageName] = fullTagWithDigest
 
-					singleRemoteOpts := []remote.Option{
-						remote.WithAuthFromKeychain(authn.DefaultKeychain),
+				} else {
+					// Single-platform or non-Docker artifact: delegate to Skaffold runner.
+					// The Skaffold runner works correctly for single-platform builds.
+					log := util.ArtifactLogger(art.ImageName)
+					log.Info("Delegating artifact to Skaffold runner")
+					if len(artCfg.Annotations) > 0 {
+						log.Warn("annotations need a multi-platform build; ignoring them")
 					}
-					for _, reg := range opts.InsecureRegistries {
-						if strings.HasPrefix(ba.Tag, reg) {
-							singleRemoteOpts = append(singleRemoteOpts, remote.WithTransport(&http.Transport{
-								TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-							}))
-							break
-						}
+					artifactsToBuild := []*latest.Artifact{art}
+
+					bRes, err := r.Build(ctx, util.ProgressWriter(progress), artifactsToBuild)
+					if err != nil {
+						return util.WithExitCode(util.ExitBuild, fmt.Errorf("skaffold build failed for %s: %w", art.ImageName, err))
 					}
 
-					timeout, _ := cmd.Flags().GetDuration("propagation-timeout")
-					if err := waitForImage(ba.Tag, timeout, opts.InsecureRegistries, singleRemoteOpts...); err != nil {
-						fmt.Printf("Warning: failed to wait for image propagation for %s: %v\n", ba.Tag, err)
+					for _, ba := range bRes {
+						built = append(built, builtEntry(ba.ImageName, ba.Tag, pipeline.ArtifactKindImage, started))
+						builtImages[ba.ImageName] = ba.Tag
+
+						if err := waitForImage(ctx, cmd, ba.Tag, opts.InsecureRegistries, remoteOptionsFor(ctx, ba.Tag, opts.InsecureRegistries)...); err != nil {
+							log.Warn("Failed to wait for image propagation", util.LogKeyTag, ba.Tag, "error", err)
+						}
+					}
+				}
+					return nil
+				}()
+				if artErr != nil {
+					if !keepGoing {
+						return artErr
 					}
+					slog.Error("Artifact failed; building the others (--keep-going)", util.LogKeyArtifact, art.ImageName, "error", artErr)
+					failures = append(failures, artifactFailure{art.ImageName, artErr})
 				}
 			}
+
+			if err := labelImages(ctx, built, expiresAfter, metadata, reproducibleTime, opts.InsecureRegistries); err != nil {
+				return err
+			}
+			if estargz {
+				if err := convertEstargz(ctx, built, opts.InsecureRegistries); err != nil {
+					return err
+				}
 			}
 
+			if err := pushMetadataTags(ctx, built, metadata, opts.InsecureRegistries); err != nil {
+				return err
+			}
+
+			recordBuildMetrics(ctx, built, opts.InsecureRegistries)
+
 			// Write build_result.json
-			if err := writeBuildResult(built); err != nil {
+			resultWritten = true
+			if err := writeBuildResult(cmd, built); err != nil {
 				return err
 			}
-			return nil
+			return keepGoingError(failures, len(artifactsToRun))
 		}
 
-		fmt.Printf("Building with Skaffold library (repo: %s)....\n", repo)
-		buildArtifacts, err := r.Build(ctx, os.Stdout, artifactsToRun)
-		if err != nil {
-			return fmt.Errorf("build failed: %w", err)
+		// With --load, buildpack artifacts are built into the local daemon
+		// with Pack; Skaffold builds the others.
+		var builds []util.BuildEntry
+		if load {
+			var loadArtifacts []*latest.Artifact
+			loadArtifacts, artifactsToRun = splitLoadArtifacts(artifactsToRun)
+			platform := ""
+			if len(opts.Platforms) == 1 {
+				platform = opts.Platforms[0]
+			}
+			if builds, err = loadBuildpackArtifacts(ctx, cmd, cwd, repo, platform, reproducibleTime, loadArtifacts, runCfg, opts.InsecureRegistries, progress); err != nil {
+				return err
+			}
 		}
+		if len(artifactsToRun) > 0 {
+			slog.Info("Building with Skaffold library", "repo", repo)
+			if err := resolveBuildpackEnvSecrets(ctx, artifactsToRun); err != nil {
+				return err
+			}
+			for _, art := range artifactsToRun {
+				if art.BuildpackArtifact != nil {
+					art.BuildpackArtifact.Buildpacks = artifactBuildpacks(cmd, art, runCfg.ArtifactBuild(art.ImageName))
+				}
+			}
+			addReproducibleArgs(artifactsToRun, reproducibleTime)
+			res, err := pipeline.BuildArtifacts(ctx, r, artifactsToRun, util.ProgressWriter(progress))
+			if err != nil {
+				return util.WithExitCode(util.ExitBuild, err)
+			}
+			builds = append(builds, res.Builds...)
+		}
+		recordLocalImageIDs(ctx, builds)
+
+		recordBuildMetrics(ctx, builds, opts.InsecureRegistries)
 
 		// 5. Write build_result.json
-		var built []util.Build
-		for _, ba := range buildArtifacts {
-			built = append(built, util.Build{ImageName: ba.ImageName, Tag: ba.Tag})
-		}
-		if err := writeBuildResult(built); err != nil {
-			return err
-		}
-		return nil
+		return writeBuildResult(cmd, builds)
 	},
 }
 
-// parseReferenceForRemote parses an image reference for use with remote get/write.
-// When the tag's registry is in insecureRegistries, uses name.Insecure so that HTTP
-// (no TLS) is allowed; InsecureSkipVerify in remote options handles self-signed TLS.
-func parseReferenceForRemote(tag string, insecureRegistries []string) (name.Reference, error) {
-	for _, reg := range insecureRegistries {
-		if strings.HasPrefix(tag, reg) {
-			return name.ParseReference(tag, name.Insecure)
+// artifactFailure is an artifact op build --keep-going could not build.
+type artifactFailure struct {
+	imageName string
+	err       error
+}
+
+// failedDependency returns the failed artifact art depends on, as a
+// Skaffold dependency or a buildpack builder or run image ("" when none).
+func failedDependency(art *latest.Artifact, failures []artifactFailure) string {
+	deps := make([]string, 0, len(art.Dependencies)+2)
+	for _, d := range art.Dependencies {
+		deps = append(deps, d.ImageName)
+	}
+	if bp := art.BuildpackArtifact; bp != nil {
+		deps = append(deps, bp.Builder, bp.RunImage)
+	}
+	for _, f := range failures {
+		if slices.Contains(deps, f.imageName) {
+			return f.imageName
 		}
 	}
-	return name.ParseReference(tag)
+	return ""
 }
 
-// waitForImage polls the registry until the image is available or timeout
-func waitForImage(tag string, timeout time.Duration, insecureRegistries []string, opts ...remote.Option) error {
-	fmt.Printf("Waiting for image propagation: %s (timeout: %s)\n", tag, timeout)
+// keepGoingError summarizes the failures of a --keep-going build of total
+// artifacts (nil when none). It exits with the code of the first failure
+// that has one, else ExitBuild.
+func keepGoingError(failures []artifactFailure, total int) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	names := make([]string, len(failures))
+	errs := make([]error, len(failures))
+	for i, f := range failures {
+		names[i] = f.imageName
+		errs[i] = fmt.Errorf("%s: %w", f.imageName, f.err)
+	}
+	return util.WithExitCode(util.ExitBuild, fmt.Errorf("%d of %d artifacts failed (%s): %w",
+		len(failures), total, strings.Join(names, ", "), errors.Join(errs...)))
+}
+
+// builtEntry is the build_result.json entry of an artifact pushed as tag
+// (registry/image:tag@sha256:...) whose build began at started.
+func builtEntry(imageName, tag, kind string, started time.Time) util.BuildEntry {
+	_, _, digest := util.SplitImageRef(tag)
+	return util.BuildEntry{
+		ImageName:  imageName,
+		Tag:        tag,
+		Kind:       kind,
+		Digest:     digest,
+		StartedAt:  started.UTC(),
+		FinishedAt: time.Now().UTC(),
+	}
+}
 
-	ref, err := parseReferenceForRemote(tag, insecureRegistries)
+// pinnedImageRef returns ref pinned to its digest for build_result.json, or
+// "" when ref is empty or cannot be resolved (the build does not fail).
+func pinnedImageRef(ctx context.Context, ref string, insecure []string, log *slog.Logger) string {
+	if ref == "" {
+		return ""
+	}
+	pinned, err := resolveDigestRef(ctx, ref, insecure)
 	if err != nil {
-		return err
+		log.Warn("Could not resolve image digest for build_result.json", "image", ref, "error", err)
+		return ""
 	}
+	return pinned
+}
 
-	start := time.Now()
-	ticker := time.NewTicker(3 * time.Second)
-	defer ticker.Stop()
+// waitForImage polls the registry until the image is available or
+// --propagation-timeout expires, backing off between --propagation-interval
+// and --propagation-max-interval (see pipeline.WaitForImage).
+func waitForImage(ctx context.Context, cmd *cobra.Command, tag string, insecureRegistries []string, opts ...remote.Option) error {
+	timeout, _ := cmd.Flags().GetDuration("propagation-timeout")
+	interval, _ := cmd.Flags().GetDuration("propagation-interval")
+	maxInterval, _ := cmd.Flags().GetDuration("propagation-max-interval")
+	return pipeline.WaitForImage(ctx, tag, pipeline.WaitOptions{
+		Timeout:            timeout,
+		Interval:           interval,
+		MaxInterval:        maxInterval,
+		InsecureRegistries: insecureRegistries,
+		Remote:             opts,
+		Head: func(ref name.Reference, opts ...remote.Option) (*v1.Descriptor, error) {
+			return remoteHead(ctx, ref, opts...)
+		},
+		Get: func(ref name.Reference, opts ...remote.Option) (*remote.Descriptor, error) {
+			return remoteGet(ctx, ref, opts...)
+		},
+	})
+}
 
-	// Initial check
-	if _, err := remoteHead(ref, opts...); err == nil {
-		fmt.Printf("\nImage found: %s\n", tag)
-		return nil
+// imageSizes returns the compressed size (config and layers) of ref per
+// platform; a single image is reported under "". It is a var so tests can
+// replace it.
+var imageSizes = func(ctx context.Context, ref string, insecure []string) (map[string]int64, error) {
+	parsed, err := parseReferenceForRemote(ref, insecure)
+	if err != nil {
+		return nil, err
 	}
-
-	fmt.Print("Waiting")
-	for range ticker.C {
-		fmt.Print(".") // Progress indicator
-		_, err := remoteHead(ref, opts...)
-		if err == nil {
-			fmt.Printf("\nImage found: %s\n", tag)
-			return nil
+	desc, err := remoteGet(ctx, parsed, remoteOptionsFor(ctx, ref, insecure)...)
+	if err != nil {
+		return nil, err
+	}
+	manifestSize := func(img v1.Image) (int64, error) {
+		m, err := img.Manifest()
+		if err != nil {
+			return 0, err
+		}
+		size := m.Config.Size
+		for _, l := range m.Layers {
+			size += l.Size
+		}
+		return size, nil
+	}
+	sizes := map[string]int64{}
+	if !desc.MediaType.IsIndex() {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, err
 		}
-		if time.Since(start) > timeout {
-			fmt.Println() // Newline after progress
-			return fmt.Errorf("timeout waiting for image %s after %s", tag, timeout)
+		sizes[""], err = manifestSize(img)
+		return sizes, err
+	}
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range im.Manifests {
+		if m.Platform == nil || m.Platform.OS == "unknown" {
+			// Attestations and other non-image manifests.
+			continue
+		}
+		img, err := idx.Image(m.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if sizes[m.Platform.String()], err = manifestSize(img); err != nil {
+			return nil, err
 		}
 	}
-	return fmt.Errorf("timeout waiting for image %s", tag)
+	return sizes, nil
 }
 
-func writeBuildResult(builds []util.Build) error {
-	if len(builds) > 0 {
-		buildResult := util.BuildResult{
-			Builds: make([]util.BuildEntry, 0, len(builds)),
+// recordBuildMetrics records the build time and pushed size of each image
+// when metrics are enabled. Size lookups that fail are logged and skipped.
+func recordBuildMetrics(ctx context.Context, builds []util.BuildEntry, insecure []string) {
+	if !util.MetricsEnabled() {
+		return
+	}
+	for _, b := range builds {
+		if !b.StartedAt.IsZero() && !b.FinishedAt.IsZero() {
+			util.RecordArtifactDuration(b.ImageName, b.FinishedAt.Sub(b.StartedAt))
+		}
+		if b.ArtifactKind() != pipeline.ArtifactKindImage || b.ImageDigest() == "" {
+			continue
+		}
+		sizes, err := imageSizes(ctx, b.Tag, insecure)
+		if err != nil {
+			slog.Debug("Could not read image size for metrics", util.LogKeyArtifact, b.ImageName, "error", err)
+			continue
 		}
-		for _, b := range builds {
-			buildResult.Builds = append(buildResult.Builds, util.BuildEntry(b))
+		for platform, size := range sizes {
+			util.RecordImageSize(b.ImageName, platform, size)
 		}
+	}
+}
 
-		f, err := os.Create("build_result.json")
+// writeBuildResult writes builds to buildResultFile ("-" for stdout) and,
+// with --print-digest, prints that artifact's digest. With --print-digest
+// alone no file is written, so scripts need no writable directory.
+func writeBuildResult(cmd *cobra.Command, builds []util.BuildEntry) error {
+	if len(builds) == 0 {
+		return nil
+	}
+	res := util.BuildResult{SchemaVersion: util.BuildResultSchemaVersion, Builds: builds}
+	path := buildResultFile(cmd)
+	printDigest, _ := cmd.Flags().GetString("print-digest")
+	switch {
+	case path == "-":
+		data, err := json.Marshal(res)
 		if err != nil {
-			return fmt.Errorf("error creating build_result.json: %w", err)
+			return err
 		}
-		defer func() {
-			if closeErr := f.Close(); closeErr != nil {
-				fmt.Fprintf(os.Stderr, "Error closing build_result.json: %v\n", closeErr)
+		fmt.Println(string(data))
+	case printDigest == "" || cmd.Flags().Changed("build-result-file"):
+		if dir := filepath.Dir(path); dir != "." {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return err
 			}
-		}()
-		if err := json.NewEncoder(f).Encode(buildResult); err != nil {
-			return fmt.Errorf("error writing build_result.json: %w", err)
 		}
+		if merge, _ := cmd.Flags().GetBool("merge-build-result"); merge {
+			merged, err := util.MergeBuildResult(path, builds)
+			if err != nil {
+				return err
+			}
+			slog.Info("Merged build result", "file", path, "artifacts", len(builds), "total", len(merged.Builds))
+		} else if err := util.WriteBuildResult(path, res); err != nil {
+			return err
+		}
+	}
+	if err := writePipelineResults(cmd, res); err != nil {
+		return err
+	}
+	if printDigest == "" {
+		return nil
+	}
+	for _, b := range res.Builds {
+		if b.ImageName != printDigest {
+			continue
+		}
+		if b.ImageDigest() == "" {
+			return fmt.Errorf("--print-digest: %s has no digest (%s); build with --push", printDigest, b.Tag)
+		}
+		fmt.Println(b.ImageDigest())
+		return nil
+	}
+	_, err := util.GetTagForImage(&res, printDigest)
+	return fmt.Errorf("--print-digest: %w", err)
+}
+
+// Result names op build writes for pipeline engines; Tekton Chains reads
+// IMAGE_URL and IMAGE_DIGEST, or IMAGES, to sign and attest the build.
+const (
+	resultImageURL    = "IMAGE_URL"
+	resultImageDigest = "IMAGE_DIGEST"
+	resultImages      = "IMAGES"
+)
+
+// writePipelineResults writes the pushed images of res as results of the
+// pipeline engine op runs in (--results-dir, or see util.PipelineResultsDir):
+// IMAGE_URL and IMAGE_DIGEST of the --print-digest artifact (default: the
+// last one), and IMAGES, every image as repo:tag@digest, one per line.
+// Without pushed images nothing is written.
+func writePipelineResults(cmd *cobra.Command, res util.BuildResult) error {
+	dir, _ := cmd.Flags().GetString("results-dir")
+	if dir == "" {
+		dir = util.PipelineResultsDir()
 	}
+	if dir == "" {
+		return nil
+	}
+	var images []string
+	for _, b := range res.Builds {
+		if b.ArtifactKind() == pipeline.ArtifactKindImage && b.ImageDigest() != "" {
+			images = append(images, b.Tag)
+		}
+	}
+	if len(images) == 0 {
+		return nil
+	}
+	results := map[string]string{resultImages: strings.Join(images, "\n")}
+	printDigest, _ := cmd.Flags().GetString("print-digest")
+	if ref, err := util.SelectTag(&res, printDigest); err == nil {
+		if url, digest, ok := strings.Cut(ref, "@"); ok {
+			results[resultImageURL], results[resultImageDigest] = url, digest
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("writing results: %w", err)
+	}
+	for name, value := range results {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0o644); err != nil {
+			return fmt.Errorf("writing result %s: %w", name, err)
+		}
+	}
+	slog.Debug("Wrote pipeline results", "dir", dir, "images", len(images))
 	return nil
 }
 
-func prepareSkaffoldOptions(cmd *cobra.Command, cwd string) config.SkaffoldOptions {
+func prepareSkaffoldOptions(cmd *cobra.Command, cwd string) (config.SkaffoldOptions, error) {
 	// Resolve repo (ttl.sh when --ttl-uuid is set)
 	ttlUUID, _ := cmd.Flags().GetString("ttl-uuid")
 	if ttlUUID != "" {
 		repo := "ttl.sh"
 		// opts built below with this repo; actual tag per artifact is set in RunE
-		return prepareSkaffoldOptionsWithRepo(cmd, cwd, repo)
+		return prepareSkaffoldOptionsWithRepo(cmd, cwd, repo), nil
 	}
 	repo, _ := cmd.Flags().GetString("repo")
 	if repo == "" {
-		repo = resolveDefaultRepo(cwd)
+		var err error
+		if repo, err = resolveDefaultRepo(cwd); err != nil {
+			return config.SkaffoldOptions{}, err
+		}
 	}
-	return prepareSkaffoldOptionsWithRepo(cmd, cwd, repo)
+	return prepareSkaffoldOptionsWithRepo(cmd, cwd, repo), nil
 }
 
 func prepareSkaffoldOptionsWithRepo(cmd *cobra.Command, cwd string, repo string) config.SkaffoldOptions {
@@ -900,6 +1151,9 @@ func prepareSkaffoldOptionsWithRepo(cmd *cobra.Command, cwd string, repo string)
 	if val, _ := cmd.Flags().GetString("platform"); val != "" {
 		// Split comma-separated platforms
 		opts.Platforms = strings.Split(val, ",")
+	} else if platforms := viper.GetStringSlice("platforms"); len(platforms) > 0 {
+		// Default from the config (e.g. platforms in ~/.config/octopilot/config.yaml)
+		opts.Platforms = platforms
 	}
 
 	// Handle push flag explicitly
@@ -921,27 +1175,304 @@ func prepareSkaffoldOptionsWithRepo(cmd *cobra.Command, cwd string, repo string)
 	}
 
 	// Handle insecure registries from env and CLI (self-signed TLS or HTTP)
-	if val := os.Getenv("SKAFFOLD_INSECURE_REGISTRY"); val != "" {
-		opts.InsecureRegistries = append(opts.InsecureRegistries, strings.Split(val, ",")...)
+	insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+	opts.InsecureRegistries = append(opts.InsecureRegistries, insecureRegistries(insecureFlag)...)
+	return opts
+}
+
+// registryPlatforms restricts platforms to those .registry allows for repo;
+// they are also the default when none are requested.
+func registryPlatforms(cwd, repo string, platforms []string) ([]string, error) {
+	entry, ok := util.RegistryOptions(cwd, repo)
+	if !ok || len(entry.Platforms) == 0 {
+		return platforms, nil
 	}
-	if val := os.Getenv("SKAFFOLD_INSECURE_REGISTRIES"); val != "" {
-		opts.InsecureRegistries = append(opts.InsecureRegistries, strings.Split(val, ",")...)
+	if len(platforms) == 0 {
+		return entry.Platforms, nil
 	}
-	if cmd.Flags().Changed("insecure-registry") {
-		if val, _ := cmd.Flags().GetString("insecure-registry"); val != "" {
-			opts.InsecureRegistries = append(opts.InsecureRegistries, strings.Split(val, ",")...)
+	var allowed []string
+	for _, p := range platforms {
+		if slices.Contains(entry.Platforms, p) {
+			allowed = append(allowed, p)
+		} else {
+			slog.Warn("Skipping platform not allowed for registry", util.LogKeyPlatform, p, "registry", entry.Registry)
 		}
 	}
-	return opts
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("none of the platforms %s may be pushed to %s (.registry allows %s)",
+			strings.Join(platforms, ","), entry.Registry, strings.Join(entry.Platforms, ","))
+	}
+	return allowed, nil
+}
+
+// artifactSBOMDir returns where Pack writes an artifact's SBOM: --sbom-output,
+// unless the build section of .github/octopilot.yaml turns it off, or sbom/
+// when only the build section turns it on.
+func artifactSBOMDir(cmd *cobra.Command, artCfg util.ArtifactBuildOpts) string {
+	dir, _ := cmd.Flags().GetString("sbom-output")
+	if artCfg.SBOM == nil {
+		return dir
+	}
+	if !*artCfg.SBOM {
+		return ""
+	}
+	return firstNonEmpty(dir, "sbom")
+}
+
+// checkBuildpackFlag refuses --buildpack unless exactly one artifact is
+// built: the flag replaces an artifact's buildpacks, and one list rarely
+// fits the artifacts of several languages.
+func checkBuildpackFlag(cmd *cobra.Command, artifacts []*latest.Artifact) error {
+	if flag, _ := cmd.Flags().GetStringArray("buildpack"); len(flag) == 0 || len(artifacts) == 1 {
+		return nil
+	}
+	return fmt.Errorf("--buildpack applies to one artifact: select it with --artifact (building %s), or set buildpacks per artifact in %s",
+		strings.Join(pipeline.ArtifactImageNames(artifacts), ", "), util.RunConfigFilename)
+}
+
+// artifactBuildpacks returns the buildpacks Pack runs for art instead of the
+// builder's order: --buildpack (one artifact only, see checkBuildpackFlag),
+// else the build section of .github/octopilot.yaml, else
+// buildpacks.buildpacks of skaffold.yaml (none: the builder's order).
+func artifactBuildpacks(cmd *cobra.Command, art *latest.Artifact, artCfg util.ArtifactBuildOpts) []string {
+	if flag, _ := cmd.Flags().GetStringArray("buildpack"); len(flag) > 0 {
+		return flag
+	}
+	if len(artCfg.Buildpacks) > 0 {
+		return artCfg.Buildpacks
+	}
+	return art.BuildpackArtifact.Buildpacks
+}
+
+// platformCacheImage gives each platform of a multi-platform build its own
+// cache image (<image>:<tag>-linux-arm64): cache layers are architecture
+// specific.
+func platformCacheImage(cacheImage, platform string, platforms int) string {
+	if cacheImage == "" || platforms < 2 || platform == "" {
+		return cacheImage
+	}
+	suffix := strings.ReplaceAll(platform, "/", "-")
+	if i := strings.LastIndex(cacheImage, ":"); i > strings.LastIndex(cacheImage, "/") {
+		return cacheImage + "-" + suffix
+	}
+	return cacheImage + ":" + suffix
+}
+
+// dockerCacheArgs returns the --cache-from and --cache-to arguments of the
+// docker build of fullTag for platform. The specs use buildx syntax; a
+// type=registry spec without ref= caches in cache_image or, without one, in
+// the artifact's repository tagged buildcache (one cache per platform, as in
+// platformCacheImage). cache_image alone reads and writes that cache.
+func dockerCacheArgs(cacheFrom []string, cacheTo, cacheImage, fullTag, platform string, platforms int) []string {
+	if len(cacheFrom) == 0 && cacheTo == "" && cacheImage != "" {
+		cacheFrom = []string{"type=registry"}
+		cacheTo = "type=registry,mode=max"
+	}
+	repo, _, _ := util.SplitImageRef(fullTag)
+	ref := platformCacheImage(firstNonEmpty(cacheImage, repo+":buildcache"), platform, platforms)
+	var args []string
+	for _, spec := range cacheFrom {
+		args = append(args, "--cache-from", withCacheRef(spec, ref))
+	}
+	if cacheTo != "" {
+		args = append(args, "--cache-to", withCacheRef(cacheTo, ref))
+	}
+	return args
+}
+
+// dockerArtifactArgs are the docker build arguments of the skaffold.yaml
+// settings of a Dockerfile artifact op builds itself, as Skaffold passes
+// them: buildArgs (with {{.ENV}} templates expanded), addHost, cacheFrom,
+// cliFlags, target, network, noCache, squash, pullParent, secrets and ssh.
+func dockerArtifactArgs(a *latest.DockerArtifact) ([]string, error) {
+	buildArgs, err := skutil.EvaluateEnvTemplateMap(a.BuildArgs)
+	if err != nil {
+		return nil, fmt.Errorf("evaluating buildArgs: %w", err)
+	}
+	return docker.ToCLIBuildArgs(a, buildArgs, nil)
+}
+
+// withCacheRef adds ref to a type=registry cache spec without one.
+func withCacheRef(spec, ref string) string {
+	fields := strings.Split(spec, ",")
+	if !slices.Contains(fields, "type=registry") || slices.ContainsFunc(fields, func(f string) bool { return strings.HasPrefix(f, "ref=") }) {
+		return spec
+	}
+	return spec + ",ref=" + ref
+}
+
+// pushArtifactIndex pushes the manifest list of an artifact built as refs.
+// With annotations it is an OCI index carrying them, as Docker manifest
+// lists cannot. created is the time of a reproducible build (else zero).
+func pushArtifactIndex(indexTag string, refs []string, annotations map[string]string, created time.Time, insecure []string, opts []remote.Option) (*pipeline.ManifestList, error) {
+	o := pipeline.ManifestListOptions{MediaType: types.DockerManifestList, InsecureRegistries: insecure, Remote: opts, Created: created}
+	if len(annotations) == 0 {
+		return pushIndex(indexTag, refs, o)
+	}
+	o.MediaType = types.OCIImageIndex
+	list, err := pushIndex(indexTag, refs, o)
+	if err != nil {
+		return nil, err
+	}
+	annotations = pipeline.WithCreated(annotations, created)
+	if list.Digest, err = annotateRemoteIndex(indexTag, manifestAnnotation{Annotations: annotations}, insecure, opts); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// pushVersionTag pushes the image or index at fullTag again as versionTag
+// (the tag with the CI version, see util.CIVersion, instead of latest).
+func pushVersionTag(ctx context.Context, fullTag, versionTag string, insecure []string, opts []remote.Option) error {
+	srcRef, err := parseReferenceForRemote(fullTag, insecure)
+	if err != nil {
+		return fmt.Errorf("parsing reference %q: %w", fullTag, err)
+	}
+	verRef, err := parseReferenceForRemote(versionTag, insecure)
+	if err != nil {
+		return fmt.Errorf("parsing version reference %q: %w", versionTag, err)
+	}
+	desc, err := remoteGet(ctx, srcRef, opts...)
+	if err != nil {
+		return util.WithExitCode(util.ExitPush, fmt.Errorf("getting source %s: %w", fullTag, err))
+	}
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return util.WithExitCode(util.ExitPush, fmt.Errorf("getting index content: %w", err))
+		}
+		if err := remote.WriteIndex(verRef, idx, opts...); err != nil {
+			return util.WithExitCode(util.ExitPush, fmt.Errorf("tagging version index %q: %w", versionTag, err))
+		}
+		return nil
+	}
+	img, err := desc.Image()
+	if err != nil {
+		return util.WithExitCode(util.ExitPush, fmt.Errorf("getting image content: %w", err))
+	}
+	if err := remoteWrite(verRef, img, opts...); err != nil {
+		return util.WithExitCode(util.ExitPush, fmt.Errorf("tagging version %q: %w", versionTag, err))
+	}
+	return nil
+}
+
+// convertEstargz converts the pushed images in built to eStargz (--estargz),
+// pushing them again to their tag and the version tag, and records the new
+// digests in built.
+func convertEstargz(ctx context.Context, built []util.BuildEntry, insecure []string) error {
+	for i, b := range built {
+		if b.ArtifactKind() != pipeline.ArtifactKindImage || b.ImageDigest() == "" {
+			continue
+		}
+		fullTag, _, _ := strings.Cut(b.Tag, "@")
+		log := util.ArtifactLogger(b.ImageName)
+		opts := remoteOptionsFor(ctx, fullTag, insecure)
+		list, err := pipeline.PushEstargz(b.Tag, fullTag, pipeline.EstargzOptions{InsecureRegistries: insecure, Remote: opts})
+		if err != nil {
+			return util.WithExitCode(util.ExitPush, fmt.Errorf("converting %s to eStargz: %w", b.ImageName, err))
+		}
+		log.Info("Converted image to eStargz", util.LogKeyTag, fullTag, "digest", list.Digest)
+		built[i].Tag = fullTag + "@" + list.Digest
+		built[i].Digest = list.Digest
+		built[i].MediaType = string(list.MediaType)
+		if len(list.Platforms) > 0 {
+			built[i].Platforms = list.Platforms
+		} else if len(b.Platforms) == 1 {
+			// A single-platform image is its own platform digest.
+			built[i].Platforms = []pipeline.PlatformDigest{{Platform: b.Platforms[0].Platform, Digest: list.Digest}}
+		}
+		if version := util.CIVersion(); version != "" && strings.HasSuffix(fullTag, ":latest") {
+			if _, err := pushCIVersionTag(ctx, fullTag, version, insecure, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// defaultQuayExpiresAfter is how long pull-request images pushed to quay.io
+// are kept when quay_expires_after is not set.
+const defaultQuayExpiresAfter = "1w"
+
+// quayExpiresAfter returns the expiration to label an image pushed as tag
+// with (see pipeline.QuayExpiresAfterLabel): expiresAfter (--expires-after)
+// when set, otherwise, for a pull-request build pushed to quay.io,
+// quay_expires_after (default 1w). "" leaves the image unlabeled.
+func quayExpiresAfter(tag, expiresAfter string) (string, error) {
+	if expiresAfter != "" {
+		return expiresAfter, nil
+	}
+	if strings.Split(tag, "/")[0] != "quay.io" || !util.CIPullRequest() {
+		return "", nil
+	}
+	d := viper.GetString("quay_expires_after")
+	if d == "" {
+		return defaultQuayExpiresAfter, nil
+	}
+	if err := pipeline.ValidateQuayDuration(d); err != nil {
+		return "", util.WithExitCode(util.ExitConfig, fmt.Errorf("quay_expires_after: %w", err))
+	}
+	return d, nil
+}
+
+// labelImages adds the labels of md (--metadata-file) and the Quay
+// expiration (see quayExpiresAfter) to the pushed images in built, pushing
+// them again to their tag and the version tag, and records the new digests
+// in built. The created label is set to created when not zero.
+func labelImages(ctx context.Context, built []util.BuildEntry, expiresAfter string, md *dockerMetadata, created time.Time, insecure []string) error {
+	for i, b := range built {
+		if b.ArtifactKind() != pipeline.ArtifactKindImage || b.ImageDigest() == "" {
+			continue
+		}
+		fullTag, _, _ := strings.Cut(b.Tag, "@")
+		d, err := quayExpiresAfter(fullTag, expiresAfter)
+		if err != nil {
+			return err
+		}
+		labels := map[string]string{}
+		if md != nil {
+			maps.Copy(labels, md.Labels)
+		}
+		if d != "" {
+			labels[pipeline.QuayExpiresAfterLabel] = d
+		}
+		labels = pipeline.WithCreated(labels, created)
+		if len(labels) == 0 {
+			continue
+		}
+		log := util.ArtifactLogger(b.ImageName)
+		opts := remoteOptionsFor(ctx, fullTag, insecure)
+		list, err := pipeline.PushLabels(b.Tag, fullTag, labels, pipeline.LabelOptions{InsecureRegistries: insecure, Remote: opts})
+		if err != nil {
+			return util.WithExitCode(util.ExitPush, fmt.Errorf("labeling %s: %w", b.ImageName, err))
+		}
+		log.Info("Labeled image", util.LogKeyTag, fullTag, "labels", len(labels), "expires_after", d, "digest", list.Digest)
+		built[i].Tag = fullTag + "@" + list.Digest
+		built[i].Digest = list.Digest
+		built[i].MediaType = string(list.MediaType)
+		if len(list.Platforms) > 0 {
+			built[i].Platforms = list.Platforms
+		} else if len(b.Platforms) == 1 {
+			built[i].Platforms = []pipeline.PlatformDigest{{Platform: b.Platforms[0].Platform, Digest: list.Digest}}
+		}
+		if version := util.CIVersion(); version != "" && strings.HasSuffix(fullTag, ":latest") {
+			if _, err := pushCIVersionTag(ctx, fullTag, version, insecure, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
-// artifactImageNames returns image names from artifacts for error messages.
-func artifactImageNames(artifacts []*latest.Artifact) []string {
-	names := make([]string, 0, len(artifacts))
-	for _, a := range artifacts {
-		names = append(names, a.ImageName)
+// setSkaffoldLogLevel maps --verbose and --quiet to the Skaffold runner's log
+// level (warning by default).
+func setSkaffoldLogLevel() {
+	switch {
+	case util.Verbose():
+		sklog.SetLevel(sklog.DebugLevel)
+	case util.Quiet():
+		sklog.SetLevel(sklog.ErrorLevel)
 	}
-	return names
 }
 
 // deriveTTLSuffix returns the last segment of the image name (e.g. cronjob-log-monitor-chart -> chart).
@@ -969,10 +1500,33 @@ func init() {
 	buildCmd.Flags().String("ttl-uuid", "", "When set, push to ttl.sh/<ttl-uuid>-<suffix>:<ttl-tag> for ephemeral integration builds (overrides repo)")
 	buildCmd.Flags().String("ttl-tag", "1h", "Tag for ttl.sh pushes when --ttl-uuid is set (default 1h)")
 	buildCmd.Flags().String("artifact", "", "Build only this artifact (exact image name from skaffold, e.g. ghcr.io/org/myimage)")
+	_ = buildCmd.RegisterFlagCompletionFunc("artifact", completeSkaffoldImages)
 	buildCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated (e.g. localhost:5001,myreg:5000). Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
 	buildCmd.Flags().String("platform", "", "Target platforms (e.g. linux/amd64,linux/arm64)")
 	buildCmd.Flags().Bool("push", false, "Push the built images to the registry")
+	buildCmd.Flags().Bool("load", false, "Without --push: build buildpack artifacts into the local daemon with Pack (one platform) and record their image IDs in build_result.json")
+	buildCmd.Flags().StringArray("cache-from", nil, "Docker artifacts: buildx cache source, e.g. type=registry (ref defaults to cache_image or <image>:buildcache); repeatable")
+	buildCmd.Flags().String("cache-to", "", "Docker artifacts: buildx cache export, e.g. type=registry,mode=max (ref defaults as for --cache-from)")
+	buildCmd.Flags().String("chart-dependencies", "", "Chart artifacts: fetch subcharts before packaging: update (helm dependency update) or locked (helm dependency build of an up-to-date Chart.lock); overrides chart_dependencies")
+	buildCmd.Flags().Bool("cleanup-platform-tags", false, "Delete the intermediate per-platform tags (<tag>-linux-amd64, ...) once the index is pushed (needs --push)")
+	buildCmd.Flags().Bool("estargz", false, "Convert the pushed images to eStargz for lazy-pulling snapshotters (needs --push)")
+	buildCmd.Flags().String("expires-after", "", "Label the pushed images quay.expires-after=<duration> (e.g. 12h, 2w) so Quay deletes them (default: quay_expires_after, or 1w, for pull-request builds pushed to quay.io)")
+	buildCmd.Flags().String("metadata-file", "", "docker/metadata-action JSON output (steps.<id>.outputs.json) whose tags and labels are applied to the pushed images")
 	buildCmd.Flags().StringP("filename", "f", "skaffold.yaml", "Path to the Skaffold configuration file")
 	buildCmd.Flags().String("sbom-output", "", "Directory to output SBOMs")
+	buildCmd.Flags().String("build-result-file", "", "Where to write the build result, - for stdout (default: $OP_BUILD_RESULT_FILE, build_result_file, then build_result.json)")
+	buildCmd.Flags().StringArray("buildpack", nil, "Buildpack to run instead of the builder's order, repeatable (id, id@version, docker://image, path; from=builder keeps the builder's order); overrides the buildpacks of the one artifact built (see --artifact)")
+	buildCmd.Flags().Bool("oci-labels", true, "Label the images with their git source, revision, commit time and version (org.opencontainers.image.*)")
+	buildCmd.Flags().Bool("reproducible", false, "Stamp SOURCE_DATE_EPOCH (default: the commit time) instead of the build time, so rebuilds of a commit give the same digests")
+	buildCmd.Flags().Bool("strict", false, "Fail when a buildpack builder or run image is a mutable tag that "+util.ImageLockFilename+" does not pin")
+	buildCmd.Flags().String("version-tag-policy", "", "When the CI version tag already exists with another digest: fail, skip or overwrite (default: fail for release versions like v1.2.3, overwrite otherwise)")
+	buildCmd.Flags().Bool("merge-build-result", false, "Merge the built artifacts into an existing build result file instead of replacing it (for --artifact jobs sharing a workspace)")
+	buildCmd.Flags().String("results-dir", "", "Directory to write the IMAGE_URL, IMAGE_DIGEST and IMAGES results to (default: /tekton/results in Tekton, "+util.ArgoResultsDir+" in Argo Workflows)")
+	buildCmd.Flags().String("print-digest", "", "Print only the digest of this artifact to stdout (writes no build result file unless --build-result-file is set)")
+	buildCmd.Flags().Bool("keep-going", false, "Keep building the other artifacts when one fails (needs --push); exits non-zero with a summary of the failures")
+	buildCmd.Flags().Duration("artifact-timeout", 0, "Abort an artifact's build and push after this duration, e.g. 20m (default: no limit)")
+	buildCmd.Flags().Duration("build-timeout", 0, "Abort the whole build after this duration; build_result.json still lists the completed artifacts (default: no limit)")
 	buildCmd.Flags().Duration("propagation-timeout", 180*time.Second, "Timeout for waiting for image propagation (default 180s)")
+	buildCmd.Flags().Duration("propagation-interval", time.Second, "First pause between propagation checks; it doubles up to --propagation-max-interval")
+	buildCmd.Flags().Duration("propagation-max-interval", 15*time.Second, "Longest pause between propagation checks")
 }
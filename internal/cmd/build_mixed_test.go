@@ -46,6 +46,9 @@ func TestBuild_MixedArtifacts(t *testing.T) {
 		resolveDefaultRepo = oldResolveDefaultRepo
 	}()
 
+	// op build writes build_result.json to the working directory.
+	t.Chdir(t.TempDir())
+
 	// Mocks
 	mockRunner := new(MockRunner)
 
@@ -64,6 +67,7 @@ func TestBuild_MixedArtifacts(t *testing.T) {
 	}
 
 	// Mock Implementations
+	stubContainerDaemon(t)
 	getAllConfigs = func(ctx context.Context, opts config.SkaffoldOptions) ([]schemaUtil.VersionedConfig, error) {
 		return []schemaUtil.VersionedConfig{}, nil
 	}
@@ -99,7 +103,7 @@ func TestBuild_MixedArtifacts(t *testing.T) {
 		return nil
 	}
 
-	remoteHead = func(ref name.Reference, options ...remote.Option) (*v1.Descriptor, error) {
+	remoteHead = func(_ context.Context, ref name.Reference, options ...remote.Option) (*v1.Descriptor, error) {
 		// Return a dummy descriptor for digest resolution
 		return &v1.Descriptor{
 			Digest: v1.Hash{
@@ -109,8 +113,8 @@ func TestBuild_MixedArtifacts(t *testing.T) {
 		}, nil
 	}
 
-	resolveDefaultRepo = func(string) string {
-		return "test-repo"
+	resolveDefaultRepo = func(string) (string, error) {
+		return "test-repo", nil
 	}
 
 	// Setup Mock Expectation
@@ -136,6 +140,7 @@ func TestBuild_MixedArtifacts(t *testing.T) {
 	_ = buildCmd.Flags().Set("push", "true")
 	_ = buildCmd.Flags().Set("repo", "") // Let mock resolve it
 
+	buildCmd.SetContext(t.Context())
 	err := buildCmd.RunE(buildCmd, []string{})
 	// If the real GetRunContext fails (e.g. valid file check), we might get error.
 	// But we passed empty opts.ConfigurationFile (default skaffold.yaml).
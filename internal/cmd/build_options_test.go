@@ -5,6 +5,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPrepareSkaffoldOptions(t *testing.T) {
@@ -17,7 +18,8 @@ func TestPrepareSkaffoldOptions(t *testing.T) {
 			name: "defaults",
 			args: []string{},
 			expected: func(t *testing.T, cmd *cobra.Command) {
-				opts := prepareSkaffoldOptions(cmd, "/tmp")
+				opts, err := prepareSkaffoldOptions(cmd, "/tmp")
+				require.NoError(t, err)
 				assert.Empty(t, opts.Platforms)
 				assert.Nil(t, opts.PushImages.Value())
 				assert.Equal(t, "manual", opts.Trigger)
@@ -27,7 +29,8 @@ func TestPrepareSkaffoldOptions(t *testing.T) {
 			name: "platform flag single",
 			args: []string{"--platform", "linux/amd64"},
 			expected: func(t *testing.T, cmd *cobra.Command) {
-				opts := prepareSkaffoldOptions(cmd, "/tmp")
+				opts, err := prepareSkaffoldOptions(cmd, "/tmp")
+				require.NoError(t, err)
 				assert.Equal(t, []string{"linux/amd64"}, opts.Platforms)
 			},
 		},
@@ -35,7 +38,8 @@ func TestPrepareSkaffoldOptions(t *testing.T) {
 			name: "platform flag multiple",
 			args: []string{"--platform", "linux/amd64,linux/arm64"},
 			expected: func(t *testing.T, cmd *cobra.Command) {
-				opts := prepareSkaffoldOptions(cmd, "/tmp")
+				opts, err := prepareSkaffoldOptions(cmd, "/tmp")
+				require.NoError(t, err)
 				assert.Equal(t, []string{"linux/amd64", "linux/arm64"}, opts.Platforms)
 			},
 		},
@@ -43,7 +47,8 @@ func TestPrepareSkaffoldOptions(t *testing.T) {
 			name: "push flag",
 			args: []string{"--push"},
 			expected: func(t *testing.T, cmd *cobra.Command) {
-				opts := prepareSkaffoldOptions(cmd, "/tmp")
+				opts, err := prepareSkaffoldOptions(cmd, "/tmp")
+				require.NoError(t, err)
 				assert.NotNil(t, opts.PushImages.Value())
 				assert.True(t, *opts.PushImages.Value())
 			},
@@ -52,7 +57,8 @@ func TestPrepareSkaffoldOptions(t *testing.T) {
 			name: "repo flag",
 			args: []string{"--repo", "ghcr.io/octopilot/test"},
 			expected: func(t *testing.T, cmd *cobra.Command) {
-				opts := prepareSkaffoldOptions(cmd, "/tmp")
+				opts, err := prepareSkaffoldOptions(cmd, "/tmp")
+				require.NoError(t, err)
 				assert.NotNil(t, opts.DefaultRepo.Value())
 				assert.Equal(t, "ghcr.io/octopilot/test", *opts.DefaultRepo.Value())
 			},
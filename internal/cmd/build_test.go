@@ -1,10 +1,24 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/latest"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/octopilot/octopilot-pipeline-tools/pkg/pipeline"
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Since `op build` calls `exec.Command("skaffold", ...)`, mocking it in a real integration test
@@ -60,3 +74,367 @@ func TestBuildExecution_RequiresSkaffoldYaml(t *testing.T) {
 	// We should refactor to not os.Exit in the library code, but return error.
 	// However, for this task, I'll skip execution test that calls os.Exit.
 }
+
+func newBuildResultTestCmd(args ...string) *cobra.Command {
+	c := &cobra.Command{}
+	c.Flags().String("build-result-file", "", "")
+	c.Flags().String("print-digest", "", "")
+	c.Flags().String("results-dir", "", "")
+	c.Flags().Bool("merge-build-result", false, "")
+	_ = c.Flags().Parse(args)
+	return c
+}
+
+func TestWriteBuildResult_File(t *testing.T) {
+	t.Chdir(t.TempDir())
+	builds := []util.BuildEntry{{ImageName: "app", Tag: "ghcr.io/org/app:v1@" + testDigest}}
+
+	require.NoError(t, writeBuildResult(newBuildResultTestCmd(), builds))
+	_, err := util.ReadBuildResult("")
+	require.NoError(t, err)
+
+	require.NoError(t, writeBuildResult(newBuildResultTestCmd("--build-result-file", "out/result.json"), builds))
+	res, err := util.ReadBuildResultFile("out/result.json")
+	require.NoError(t, err)
+	assert.Equal(t, builds[0].Tag, res.Builds[0].Tag)
+
+	t.Setenv("OP_BUILD_RESULT_FILE", "env.json")
+	require.NoError(t, writeBuildResult(newBuildResultTestCmd(), builds))
+	assert.FileExists(t, "env.json")
+}
+
+func TestWriteBuildResult_Merge(t *testing.T) {
+	t.Chdir(t.TempDir())
+	api := []util.BuildEntry{{ImageName: "api", Tag: "ghcr.io/org/api:v1@" + testDigest}}
+	web := []util.BuildEntry{{ImageName: "web", Tag: "ghcr.io/org/web:v1@" + testDigest}}
+
+	require.NoError(t, writeBuildResult(newBuildResultTestCmd("--merge-build-result"), api))
+	require.NoError(t, writeBuildResult(newBuildResultTestCmd("--merge-build-result"), web))
+	res, err := util.ReadBuildResult("")
+	require.NoError(t, err)
+	assert.Equal(t, append(api, web...), res.Builds)
+
+	// Without --merge-build-result the file is replaced.
+	require.NoError(t, writeBuildResult(newBuildResultTestCmd(), web))
+	res, err = util.ReadBuildResult("")
+	require.NoError(t, err)
+	assert.Equal(t, web, res.Builds)
+}
+
+func TestWriteBuildResult_PrintDigest(t *testing.T) {
+	t.Chdir(t.TempDir())
+	builds := []util.BuildEntry{{ImageName: "app", Tag: "ghcr.io/org/app:v1@" + testDigest}, {ImageName: "local", Tag: "local:dev"}}
+
+	// --print-digest alone writes no file.
+	require.NoError(t, writeBuildResult(newBuildResultTestCmd("--print-digest", "app"), builds))
+	assert.NoFileExists(t, util.BuildResultFilename)
+
+	require.NoError(t, writeBuildResult(newBuildResultTestCmd("--print-digest", "app", "--build-result-file", "r.json"), builds))
+	assert.FileExists(t, "r.json")
+
+	assert.ErrorContains(t, writeBuildResult(newBuildResultTestCmd("--print-digest", "local"), builds), "has no digest")
+	assert.ErrorContains(t, writeBuildResult(newBuildResultTestCmd("--print-digest", "web"), builds), `image "web" not found`)
+}
+
+func TestWritePipelineResults(t *testing.T) {
+	t.Chdir(t.TempDir())
+	builds := []util.BuildEntry{
+		{ImageName: "api", Tag: "ghcr.io/org/api:v1@" + testDigest},
+		{ImageName: "app", Tag: "ghcr.io/org/app:v1@" + testDigest},
+		{ImageName: "local", Tag: "local:dev"},
+	}
+	readResult := func(name string) string {
+		data, err := os.ReadFile(filepath.Join("results", name))
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	require.NoError(t, writeBuildResult(newBuildResultTestCmd("--results-dir", "results"), builds[:2]))
+	assert.Equal(t, "ghcr.io/org/app:v1", readResult("IMAGE_URL"))
+	assert.Equal(t, testDigest, readResult("IMAGE_DIGEST"))
+	assert.Equal(t, builds[0].Tag+"\n"+builds[1].Tag, readResult("IMAGES"))
+
+	require.NoError(t, writeBuildResult(newBuildResultTestCmd("--results-dir", "results", "--print-digest", "api"), builds[:2]))
+	assert.Equal(t, "ghcr.io/org/api:v1", readResult("IMAGE_URL"))
+
+	// Without a pushed image there is nothing to report.
+	require.NoError(t, writeBuildResult(newBuildResultTestCmd("--results-dir", "unpushed"), builds[2:]))
+	assert.NoDirExists(t, "unpushed")
+}
+
+func TestRecordBuildMetrics(t *testing.T) {
+	for _, k := range []string{"GITHUB_REPOSITORY", "GITHUB_ACTIONS", "CI"} {
+		t.Setenv(k, "")
+	}
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer srv.Close()
+
+	var looked []string
+	orig := imageSizes
+	defer func() { imageSizes = orig }()
+	imageSizes = func(_ context.Context, ref string, _ []string) (map[string]int64, error) {
+		looked = append(looked, ref)
+		return map[string]int64{"linux/amd64": 2048}, nil
+	}
+
+	started := time.Now()
+	builds := []util.BuildEntry{
+		{ImageName: "app", Tag: "ghcr.io/org/app:v1@" + testDigest, StartedAt: started, FinishedAt: started.Add(90 * time.Second)},
+		{ImageName: "local", Tag: "local:dev"},
+		{ImageName: "chart", Tag: "ghcr.io/org/chart:1.0.0@" + testDigest, Kind: pipeline.ArtifactKindChart},
+	}
+
+	// Disabled: no lookups.
+	util.StartMetrics(util.MetricsConfig{}, "build")
+	recordBuildMetrics(t.Context(), builds, nil)
+	assert.Empty(t, looked)
+
+	util.StartMetrics(util.MetricsConfig{Pushgateway: srv.URL}, "build")
+	recordBuildMetrics(t.Context(), builds, nil)
+	require.NoError(t, util.FinishMetrics(nil))
+	assert.Equal(t, []string{builds[0].Tag}, looked)
+	assert.Contains(t, body, `op_image_size_bytes{artifact="app",command="build",platform="linux/amd64"} 2048`)
+	assert.Contains(t, body, `op_artifact_build_duration_seconds{artifact="app",command="build"} 90`)
+}
+
+func TestRegistryPlatforms(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.RegistryFilename), []byte("ci:\n  - registry: registry.internal:5000/org\n    platforms: [linux/amd64]\n  - ghcr.io/org\n"), 0o644))
+
+	got, err := registryPlatforms(dir, "registry.internal:5000/org", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"linux/amd64"}, got)
+
+	got, err = registryPlatforms(dir, "registry.internal:5000/org", []string{"linux/amd64", "linux/arm64"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"linux/amd64"}, got)
+
+	_, err = registryPlatforms(dir, "registry.internal:5000/org", []string{"linux/arm64"})
+	assert.ErrorContains(t, err, "none of the platforms linux/arm64")
+
+	got, err = registryPlatforms(dir, "ghcr.io/org", []string{"linux/arm64"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"linux/arm64"}, got)
+}
+
+func TestArtifactSBOMDir(t *testing.T) {
+	on, off := true, false
+	cmd := &cobra.Command{}
+	cmd.Flags().String("sbom-output", "", "")
+	assert.Equal(t, "", artifactSBOMDir(cmd, util.ArtifactBuildOpts{}))
+	assert.Equal(t, "sbom", artifactSBOMDir(cmd, util.ArtifactBuildOpts{SBOM: &on}))
+
+	require.NoError(t, cmd.Flags().Set("sbom-output", "out/sbom"))
+	assert.Equal(t, "out/sbom", artifactSBOMDir(cmd, util.ArtifactBuildOpts{}))
+	assert.Equal(t, "", artifactSBOMDir(cmd, util.ArtifactBuildOpts{SBOM: &off}))
+}
+
+func TestArtifactBuildpacks(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().StringArray("buildpack", nil, "")
+	art := &latest.Artifact{ImageName: "api", ArtifactType: latest.ArtifactType{BuildpackArtifact: &latest.BuildpackArtifact{
+		Buildpacks: []string{"paketo-buildpacks/go"},
+	}}}
+	assert.Equal(t, []string{"paketo-buildpacks/go"}, artifactBuildpacks(cmd, art, util.ArtifactBuildOpts{}))
+	withDatadog := util.ArtifactBuildOpts{Buildpacks: []string{"from=builder", "docker://ghcr.io/acme/datadog-buildpack:1.4"}}
+	assert.Equal(t, withDatadog.Buildpacks, artifactBuildpacks(cmd, art, withDatadog))
+
+	require.NoError(t, cmd.Flags().Set("buildpack", "paketo-buildpacks/nodejs"))
+	assert.Equal(t, []string{"paketo-buildpacks/nodejs"}, artifactBuildpacks(cmd, art, withDatadog))
+
+	art.BuildpackArtifact.Buildpacks = nil
+	assert.Nil(t, artifactBuildpacks(&cobra.Command{}, art, util.ArtifactBuildOpts{}), "the builder's order")
+}
+
+func TestCheckBuildpackFlag(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().StringArray("buildpack", nil, "")
+	api := &latest.Artifact{ImageName: "api", ArtifactType: latest.ArtifactType{BuildpackArtifact: &latest.BuildpackArtifact{}}}
+	web := &latest.Artifact{ImageName: "web", ArtifactType: latest.ArtifactType{BuildpackArtifact: &latest.BuildpackArtifact{}}}
+	both := []*latest.Artifact{api, web}
+	require.NoError(t, checkBuildpackFlag(cmd, both))
+
+	require.NoError(t, cmd.Flags().Set("buildpack", "paketo-buildpacks/go"))
+	assert.ErrorContains(t, checkBuildpackFlag(cmd, both), "select it with --artifact (building api, web)")
+
+	// --artifact api leaves one artifact: only it gets the flag's buildpacks.
+	selected, err := pipeline.SelectArtifacts(both, "api")
+	require.NoError(t, err)
+	require.NoError(t, checkBuildpackFlag(cmd, selected))
+	assert.Equal(t, []string{"paketo-buildpacks/go"}, artifactBuildpacks(cmd, selected[0], util.ArtifactBuildOpts{}))
+}
+
+func TestPlatformCacheImage(t *testing.T) {
+	assert.Equal(t, "", platformCacheImage("", "linux/arm64", 2))
+	assert.Equal(t, "ghcr.io/org/cache", platformCacheImage("ghcr.io/org/cache", "linux/arm64", 1))
+	assert.Equal(t, "ghcr.io/org/cache:linux-arm64", platformCacheImage("ghcr.io/org/cache", "linux/arm64", 2))
+	assert.Equal(t, "localhost:5001/cache:app-linux-arm64", platformCacheImage("localhost:5001/cache:app", "linux/arm64", 2))
+	assert.Equal(t, "localhost:5001/cache:linux-amd64", platformCacheImage("localhost:5001/cache", "linux/amd64", 2))
+}
+
+func TestPushVersionTag(t *testing.T) {
+	host := startTestRegistry(t)
+	pushInspectImage(t, host+"/org/app:amd64", v1.Platform{OS: "linux", Architecture: "amd64"})
+	pushInspectImage(t, host+"/org/app:arm64", v1.Platform{OS: "linux", Architecture: "arm64"})
+	list, err := pushArtifactIndex(host+"/org/app:latest", []string{host + "/org/app:amd64", host + "/org/app:arm64"}, nil, time.Time{}, nil, nil)
+	require.NoError(t, err)
+
+	// An index is tagged as the same index.
+	require.NoError(t, pushVersionTag(t.Context(), host+"/org/app:latest", host+"/org/app:1.2.3", nil, nil))
+	digest, err := resolveDigestRef(t.Context(), host+"/org/app:1.2.3", nil)
+	require.NoError(t, err)
+	assert.Equal(t, host+"/org/app@"+list.Digest, digest)
+
+	// A single image as the same image.
+	require.NoError(t, pushVersionTag(t.Context(), host+"/org/app:amd64", host+"/org/app:amd64-1.2.3", nil, nil))
+	want, err := resolveDigestRef(t.Context(), host+"/org/app:amd64", nil)
+	require.NoError(t, err)
+	got, err := resolveDigestRef(t.Context(), host+"/org/app:amd64-1.2.3", nil)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	err = pushVersionTag(t.Context(), host+"/org/app:missing", host+"/org/app:2.0.0", nil, nil)
+	assert.Equal(t, util.ExitPush, util.ExitCode(err))
+}
+
+func TestPushArtifactIndex_Annotations(t *testing.T) {
+	host := startTestRegistry(t)
+	tag := host + "/org/app:latest"
+	pushInspectImage(t, tag, v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	// A single-platform artifact with annotations becomes an OCI index.
+	list, err := pushArtifactIndex(tag, []string{tag}, map[string]string{"org.opencontainers.image.source": "https://github.com/org/app"}, time.Time{}, nil, nil)
+	require.NoError(t, err)
+	im := remoteIndexManifest(t, tag)
+	assert.Equal(t, types.OCIImageIndex, im.MediaType)
+	assert.Equal(t, "https://github.com/org/app", im.Annotations["org.opencontainers.image.source"])
+	require.Len(t, im.Manifests, 1)
+	assert.Equal(t, []pipeline.PlatformDigest{{Platform: "linux/amd64", Digest: im.Manifests[0].Digest.String()}}, list.Platforms)
+
+	digest, err := resolveDigestRef(t.Context(), tag, nil)
+	require.NoError(t, err)
+	assert.Equal(t, host+"/org/app@"+list.Digest, digest)
+}
+
+func TestDockerCacheArgs(t *testing.T) {
+	assert.Empty(t, dockerCacheArgs(nil, "", "", "ghcr.io/org/app:latest", "linux/amd64", 1))
+
+	// type=registry without a ref caches next to the image.
+	assert.Equal(t, []string{
+		"--cache-from", "type=registry,ref=ghcr.io/org/app:buildcache-linux-arm64",
+		"--cache-to", "type=registry,mode=max,ref=ghcr.io/org/app:buildcache-linux-arm64",
+	}, dockerCacheArgs([]string{"type=registry"}, "type=registry,mode=max", "", "ghcr.io/org/app:latest", "linux/arm64", 2))
+
+	// cache_image alone reads and writes the cache; explicit refs and other types are kept.
+	assert.Equal(t, []string{
+		"--cache-from", "type=registry,ref=ghcr.io/org/cache",
+		"--cache-to", "type=registry,mode=max,ref=ghcr.io/org/cache",
+	}, dockerCacheArgs(nil, "", "ghcr.io/org/cache", "ghcr.io/org/app:latest", "linux/amd64", 1))
+	assert.Equal(t, []string{
+		"--cache-from", "type=registry,ref=ghcr.io/org/other:cache",
+		"--cache-from", "type=gha",
+	}, dockerCacheArgs([]string{"type=registry,ref=ghcr.io/org/other:cache", "type=gha"}, "", "ghcr.io/org/cache", "ghcr.io/org/app:latest", "linux/amd64", 1))
+}
+
+func TestDockerArtifactArgs(t *testing.T) {
+	t.Setenv("GO_VERSION", "1.25")
+	version := "{{.GO_VERSION}}"
+	args, err := dockerArtifactArgs(&latest.DockerArtifact{
+		BuildArgs:   map[string]*string{"GO_VERSION": &version, "NPM_TOKEN": nil},
+		Target:      "runtime",
+		NetworkMode: "Host",
+		CacheFrom:   []string{"ghcr.io/org/app:buildcache"},
+		CliFlags:    []string{"--label", "org.opencontainers.image.revision=0123abcd"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"--build-arg", "GO_VERSION=1.25",
+		"--build-arg", "NPM_TOKEN",
+		"--cache-from", "ghcr.io/org/app:buildcache",
+		"--label", "org.opencontainers.image.revision=0123abcd",
+		"--target", "runtime",
+		"--network", "host",
+	}, args)
+
+	bad := "{{.GO_VERSION"
+	_, err = dockerArtifactArgs(&latest.DockerArtifact{BuildArgs: map[string]*string{"GO_VERSION": &bad}})
+	assert.ErrorContains(t, err, "evaluating buildArgs")
+}
+
+func TestFailedDependency(t *testing.T) {
+	failures := []artifactFailure{{imageName: "ghcr.io/org/base", err: errors.New("boom")}}
+	app := &latest.Artifact{
+		ImageName:    "ghcr.io/org/app",
+		Dependencies: []*latest.ArtifactDependency{{ImageName: "ghcr.io/org/base", Alias: "BASE"}},
+	}
+	assert.Equal(t, "ghcr.io/org/base", failedDependency(app, failures))
+
+	runOnBase := &latest.Artifact{ImageName: "ghcr.io/org/web", ArtifactType: latest.ArtifactType{
+		BuildpackArtifact: &latest.BuildpackArtifact{Builder: "paketobuildpacks/builder", RunImage: "ghcr.io/org/base"},
+	}}
+	assert.Equal(t, "ghcr.io/org/base", failedDependency(runOnBase, failures))
+	assert.Empty(t, failedDependency(&latest.Artifact{ImageName: "ghcr.io/org/other"}, failures))
+}
+
+func TestKeepGoingError(t *testing.T) {
+	assert.NoError(t, keepGoingError(nil, 3))
+
+	err := keepGoingError([]artifactFailure{
+		{imageName: "a", err: util.WithExitCode(util.ExitPush, errors.New("denied"))},
+		{imageName: "b", err: errors.New("not built: it depends on a, which failed")},
+	}, 3)
+	assert.ErrorContains(t, err, "2 of 3 artifacts failed (a, b)")
+	assert.ErrorContains(t, err, "a: denied")
+	assert.Equal(t, util.ExitPush, util.ExitCode(err), "the first failure's exit code")
+}
+
+func TestQuayExpiresAfter(t *testing.T) {
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("GITHUB_EVENT_NAME", "push")
+	d, err := quayExpiresAfter("quay.io/org/app:latest", "")
+	require.NoError(t, err)
+	assert.Equal(t, "", d)
+
+	// Pull-request builds pushed to quay.io expire by default.
+	t.Setenv("GITHUB_EVENT_NAME", "pull_request")
+	d, err = quayExpiresAfter("quay.io/org/app:latest", "")
+	require.NoError(t, err)
+	assert.Equal(t, defaultQuayExpiresAfter, d)
+	d, err = quayExpiresAfter("ghcr.io/org/app:latest", "")
+	require.NoError(t, err)
+	assert.Equal(t, "", d)
+
+	// --expires-after applies to any registry.
+	d, err = quayExpiresAfter("ghcr.io/org/app:latest", "12h")
+	require.NoError(t, err)
+	assert.Equal(t, "12h", d)
+}
+
+func TestLabelImages_Expiry(t *testing.T) {
+	t.Setenv("DOCKER_METADATA_OUTPUT_VERSION", "")
+	t.Setenv("CI_COMMIT_TAG", "")
+	host := startTestRegistry(t)
+	tag := host + "/org/app:latest"
+	pushInspectImage(t, host+"/org/app:amd64", v1.Platform{OS: "linux", Architecture: "amd64"})
+	pushInspectImage(t, host+"/org/app:arm64", v1.Platform{OS: "linux", Architecture: "arm64"})
+	list, err := pushArtifactIndex(tag, []string{host + "/org/app:amd64", host + "/org/app:arm64"}, nil, time.Time{}, nil, nil)
+	require.NoError(t, err)
+	built := []util.BuildEntry{{ImageName: "app", Tag: tag + "@" + list.Digest, Platforms: list.Platforms}}
+
+	require.NoError(t, labelImages(t.Context(), built, "2w", nil, time.Time{}, nil))
+	assert.NotEqual(t, list.Digest, built[0].Digest)
+	digest, err := resolveDigestRef(t.Context(), tag, nil)
+	require.NoError(t, err)
+	assert.Equal(t, host+"/org/app@"+built[0].Digest, digest)
+	require.Len(t, built[0].Platforms, 2)
+	for _, p := range built[0].Platforms {
+		i, err := inspectRef(t.Context(), host+"/org/app@"+p.Digest, "", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "2w", i.Image.Labels[pipeline.QuayExpiresAfterLabel], p.Platform)
+		assert.Equal(t, "ghcr.io/octopilot/run:jammy", i.Image.Labels[ociBaseNameLabel])
+	}
+}
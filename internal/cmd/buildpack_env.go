@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/latest"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+)
+
+// buildpackEnv returns the environment of the Pack build of art: base, then
+// buildpacks.env of skaffold.yaml, then the env of the artifact in
+// .github/octopilot.yaml. Secret references among the values (secret://gha/,
+// sops://, op://, env://) are resolved; only the names of those variables
+// are logged.
+func buildpackEnv(ctx context.Context, art *latest.Artifact, artCfg util.ArtifactBuildOpts, base map[string]string) (map[string]string, error) {
+	env := maps.Clone(base)
+	for _, e := range art.BuildpackArtifact.Env {
+		if k, v, ok := strings.Cut(e, "="); ok {
+			env[k] = v
+		}
+	}
+	maps.Copy(env, artCfg.Env)
+	names, err := util.ResolveSecretEnv(ctx, env)
+	if err != nil {
+		return nil, util.WithExitCode(util.ExitConfig, fmt.Errorf("%s: buildpack env %w", art.ImageName, err))
+	}
+	if len(names) > 0 {
+		util.ArtifactLogger(art.ImageName).Info("Resolved buildpack env secrets", "env", names)
+	}
+	return env, nil
+}
+
+// resolveBuildpackEnvSecrets resolves the secret references in the
+// buildpacks.env of artifacts Skaffold builds (see buildpackEnv).
+func resolveBuildpackEnvSecrets(ctx context.Context, artifacts []*latest.Artifact) error {
+	for _, a := range artifacts {
+		bp := a.BuildpackArtifact
+		if bp == nil {
+			continue
+		}
+		for i, e := range bp.Env {
+			k, v, ok := strings.Cut(e, "=")
+			if !ok || !util.IsSecretRef(v) {
+				continue
+			}
+			val, err := util.ResolveSecretRef(ctx, v)
+			if err != nil {
+				return util.WithExitCode(util.ExitConfig, fmt.Errorf("%s: buildpack env %s: %w", a.ImageName, k, err))
+			}
+			bp.Env[i] = k + "=" + val
+		}
+	}
+	return nil
+}
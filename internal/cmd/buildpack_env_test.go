@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/latest"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildpackEnv(t *testing.T) {
+	t.Setenv("NPM_TOKEN", "npm-tok")
+	art := &latest.Artifact{ImageName: "web", ArtifactType: latest.ArtifactType{BuildpackArtifact: &latest.BuildpackArtifact{
+		Env: []string{"BP_NODE_VERSION=20", "BP_NPM_TOKEN=secret://gha/NPM_TOKEN", "BP_GO_PRIVATE=github.com/acme/*"},
+	}}}
+	base := map[string]string{"BP_GO_PRIVATE": "github.com/octopilot/*"}
+
+	env, err := buildpackEnv(t.Context(), art, util.ArtifactBuildOpts{Env: map[string]string{"BP_NODE_VERSION": "22"}}, base)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"BP_GO_PRIVATE":   "github.com/acme/*",
+		"BP_NODE_VERSION": "22",
+		"BP_NPM_TOKEN":    "npm-tok",
+	}, env)
+	assert.Equal(t, map[string]string{"BP_GO_PRIVATE": "github.com/octopilot/*"}, base, "base is not changed")
+	assert.Equal(t, "BP_NPM_TOKEN=secret://gha/NPM_TOKEN", art.BuildpackArtifact.Env[1], "skaffold.yaml keeps the reference")
+
+	_, err = buildpackEnv(t.Context(), art, util.ArtifactBuildOpts{Env: map[string]string{"BP_NPM_TOKEN": "secret://gha/OP_NOT_SET"}}, base)
+	assert.ErrorContains(t, err, "web: buildpack env BP_NPM_TOKEN: resolving secret://gha/OP_NOT_SET")
+	assert.Equal(t, util.ExitConfig, util.ExitCode(err))
+}
+
+func TestResolveBuildpackEnvSecrets(t *testing.T) {
+	t.Setenv("NPM_TOKEN", "npm-tok")
+	artifacts := []*latest.Artifact{
+		{ImageName: "web", ArtifactType: latest.ArtifactType{BuildpackArtifact: &latest.BuildpackArtifact{
+			Env: []string{"BP_NODE_VERSION=22", "BP_NPM_TOKEN=secret://gha/NPM_TOKEN"},
+		}}},
+		{ImageName: "api", ArtifactType: latest.ArtifactType{DockerArtifact: &latest.DockerArtifact{}}},
+	}
+	require.NoError(t, resolveBuildpackEnvSecrets(t.Context(), artifacts))
+	assert.Equal(t, []string{"BP_NODE_VERSION=22", "BP_NPM_TOKEN=npm-tok"}, artifacts[0].BuildpackArtifact.Env)
+
+	artifacts[0].BuildpackArtifact.Env = []string{"BP_NPM_TOKEN=sops://missing.env"}
+	assert.ErrorContains(t, resolveBuildpackEnvSecrets(t.Context(), artifacts), "web: buildpack env BP_NPM_TOKEN: resolving sops://missing.env: expected sops://path/to/file#KEY")
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/octopilot/octopilot-pipeline-tools/pkg/pipeline"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// platformTagSuffixes are tag suffixes per-architecture jobs commonly add
+// (app:1.2.3-arm64); they are dropped to find the shared index tag.
+var platformTagSuffixes = []string{"-amd64", "-arm64", "-arm", "-386", "-ppc64le", "-s390x", "-riscv64"}
+
+// readBuildResultPath reads a build_result.json file, or the one in a directory.
+func readBuildResultPath(path string) (*util.BuildResult, error) {
+	if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+		return util.ReadBuildResultFile(path)
+	}
+	return util.ReadBuildResult(path)
+}
+
+// buildResultFile is the build result op build writes and promote-image and
+// watch-deployment read by default: --build-result-file, then
+// $OP_BUILD_RESULT_FILE, build_result_file, then ./build_result.json.
+func buildResultFile(cmd *cobra.Command) string {
+	file, _ := cmd.Flags().GetString("build-result-file")
+	return firstNonEmpty(file, os.Getenv("OP_BUILD_RESULT_FILE"), viper.GetString("build_result_file"), util.BuildResultFilename)
+}
+
+// buildResultInput is the build result a consuming command reads:
+// build_result.json in --build-result-dir when that is set (and
+// --build-result-file is not), otherwise buildResultFile.
+func buildResultInput(cmd *cobra.Command) string {
+	dir, _ := cmd.Flags().GetString("build-result-dir")
+	if dir != "" && !cmd.Flags().Changed("build-result-file") {
+		return filepath.Join(dir, util.BuildResultFilename)
+	}
+	return buildResultFile(cmd)
+}
+
+// updateBuildResult applies update to every entry of build_result.json in
+// dir (or cwd if empty) and writes it back, so later steps find what a step
+// such as op sign recorded.
+func updateBuildResult(dir string, update func(b *util.BuildEntry)) error {
+	res, err := util.ReadBuildResult(dir)
+	if err != nil {
+		return err
+	}
+	for i := range res.Builds {
+		update(&res.Builds[i])
+	}
+	return util.WriteBuildResult(filepath.Join(dir, util.BuildResultFilename), *res)
+}
+
+// mergeGroup collects the distinct refs recorded for one artifact.
+type mergeGroup struct {
+	imageName string
+	refs      []string
+	entries   []util.BuildEntry // the entry of each ref
+}
+
+// groupBuildResults groups the entries of results by image name, in order of
+// first appearance, dropping refs that are recorded more than once.
+func groupBuildResults(results []*util.BuildResult) []*mergeGroup {
+	var groups []*mergeGroup
+	byName := map[string]*mergeGroup{}
+	for _, res := range results {
+		for _, b := range res.Builds {
+			g, ok := byName[b.ImageName]
+			if !ok {
+				g = &mergeGroup{imageName: b.ImageName}
+				byName[b.ImageName] = g
+				groups = append(groups, g)
+			}
+			dup := false
+			for _, r := range g.refs {
+				dup = dup || r == b.Tag
+			}
+			if !dup {
+				g.refs = append(g.refs, b.Tag)
+				g.entries = append(g.entries, b)
+			}
+		}
+	}
+	return groups
+}
+
+// mergedIndexTag returns the tag the manifest list for refs is pushed to: the
+// refs' common tag once digests and per-platform suffixes are dropped.
+func mergedIndexTag(imageName string, refs []string) (string, error) {
+	var tag string
+	for _, r := range refs {
+		t := stripDigest(r)
+		hasTag := strings.LastIndex(t, ":") > strings.LastIndex(t, "/")
+		for _, s := range platformTagSuffixes {
+			if hasTag && strings.HasSuffix(t, s) {
+				t = strings.TrimSuffix(t, s)
+				break
+			}
+		}
+		if tag != "" && t != tag {
+			return "", fmt.Errorf("%s: cannot merge %s and %s (tags differ)", imageName, tag, t)
+		}
+		tag = t
+	}
+	return tag, nil
+}
+
+// mergedEntry is the entry of the manifest list merging the builds of g. SBOM
+// and signature references of the platform images do not carry over.
+func mergedEntry(g *mergeGroup, indexTag string, list *pipeline.ManifestList) util.BuildEntry {
+	e := g.entries[0]
+	e.Tag = indexTag + "@" + list.Digest
+	e.Digest = list.Digest
+	e.MediaType = string(list.MediaType)
+	e.Platforms = list.Platforms
+	e.SBOM, e.Signature = nil, ""
+	for _, b := range g.entries[1:] {
+		if !b.StartedAt.IsZero() && (e.StartedAt.IsZero() || b.StartedAt.Before(e.StartedAt)) {
+			e.StartedAt = b.StartedAt
+		}
+		if b.FinishedAt.After(e.FinishedAt) {
+			e.FinishedAt = b.FinishedAt
+		}
+	}
+	return e
+}
+
+// mergeBuildResults combines results into one. An artifact recorded with a
+// single digest is kept as is; several digests (one per platform job) are
+// reconciled into a manifest list pushed to their common tag.
+func mergeBuildResults(ctx context.Context, results []*util.BuildResult, mediaType types.MediaType, insecure []string) (*util.BuildResult, error) {
+	merged := &util.BuildResult{}
+	for _, g := range groupBuildResults(results) {
+		if len(g.refs) == 1 {
+			merged.Builds = append(merged.Builds, g.entries[0])
+			continue
+		}
+		indexTag, err := mergedIndexTag(g.imageName, g.refs)
+		if err != nil {
+			return nil, err
+		}
+		util.ArtifactLogger(g.imageName).Info("Merging platform builds", "builds", len(g.refs), util.LogKeyTag, indexTag)
+		list, err := pushManifestList(indexTag, g.refs, mediaType, insecure, remoteOptionsFor(ctx, indexTag, insecure))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", g.imageName, err)
+		}
+		merged.Builds = append(merged.Builds, mergedEntry(g, indexTag, list))
+	}
+	return merged, nil
+}
+
+var buildResultCmd = &cobra.Command{
+	Use:   "build-result",
+	Short: "Work with build_result.json files.",
+}
+
+var buildResultMergeCmd = &cobra.Command{
+	Use:   "merge <dir|file>...",
+	Short: "Combine build_result.json files from fan-out CI jobs into one.",
+	Long: `Merge the build_result.json files of matrix jobs (one per architecture or
+per artifact) into a single result for promote, sign, gitops-update and the
+other downstream steps. Each argument is a build_result.json or a directory
+containing one.
+
+Artifacts built by one job are copied unchanged. When an artifact has
+different digests from several jobs (e.g. native amd64 and arm64 runners),
+the digests are combined into a manifest list, pushed to the artifact's tag,
+and the index digest is recorded. Per-platform tag suffixes such as -amd64
+and -arm64 are dropped to find that tag.
+
+  op build-result merge results/amd64 results/arm64 -o build_result.json`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+		format, _ := cmd.Flags().GetString("format")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		mediaType, err := manifestMediaType(format)
+		if err != nil {
+			return err
+		}
+
+		var results []*util.BuildResult
+		for _, path := range args {
+			res, err := readBuildResultPath(path)
+			if err != nil {
+				return err
+			}
+			results = append(results, res)
+		}
+		merged, err := mergeBuildResults(cmd.Context(), results, mediaType, insecureRegistries(insecureFlag))
+		if err != nil {
+			return err
+		}
+		if err := util.WriteBuildResult(output, *merged); err != nil {
+			return err
+		}
+		slog.Info("Wrote build result", "file", output, "builds", len(merged.Builds))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(buildResultCmd)
+	buildResultCmd.AddCommand(buildResultMergeCmd)
+	buildResultMergeCmd.Flags().StringP("output", "o", util.BuildResultFilename, "Path of the merged build_result.json")
+	buildResultMergeCmd.Flags().String("format", "docker", "Media type of merged indexes: docker (manifest list) or oci (image index)")
+	buildResultMergeCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+}
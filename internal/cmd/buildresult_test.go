@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/octopilot/octopilot-pipeline-tools/pkg/pipeline"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergedIndexTag(t *testing.T) {
+	tag, err := mergedIndexTag("app", []string{"r/app:1@sha256:a", "r/app:1@sha256:b"})
+	require.NoError(t, err)
+	assert.Equal(t, "r/app:1", tag)
+
+	tag, err = mergedIndexTag("app", []string{"localhost:5000/app:1-amd64@sha256:a", "localhost:5000/app:1-arm64@sha256:b"})
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:5000/app:1", tag)
+
+	// Suffixes are only dropped from the tag, never the repository.
+	tag, err = mergedIndexTag("app", []string{"r/app-arm64@sha256:a"})
+	require.NoError(t, err)
+	assert.Equal(t, "r/app-arm64", tag)
+
+	_, err = mergedIndexTag("app", []string{"r/app:1@sha256:a", "r/app:2@sha256:b"})
+	assert.ErrorContains(t, err, "tags differ")
+}
+
+func TestGroupBuildResults(t *testing.T) {
+	groups := groupBuildResults([]*util.BuildResult{
+		{Builds: []util.BuildEntry{{ImageName: "base", Tag: "r/base:1@sha256:a"}, {ImageName: "app", Tag: "r/app:1@sha256:b"}}},
+		{Builds: []util.BuildEntry{{ImageName: "base", Tag: "r/base:1@sha256:a"}, {ImageName: "app", Tag: "r/app:1@sha256:c"}}},
+		{Builds: []util.BuildEntry{{ImageName: "worker", Tag: "r/worker:1@sha256:d"}}},
+	})
+	require.Len(t, groups, 3)
+	assert.Equal(t, &mergeGroup{imageName: "base", refs: []string{"r/base:1@sha256:a"},
+		entries: []util.BuildEntry{{ImageName: "base", Tag: "r/base:1@sha256:a"}}}, groups[0])
+	assert.Equal(t, &mergeGroup{imageName: "app", refs: []string{"r/app:1@sha256:b", "r/app:1@sha256:c"},
+		entries: []util.BuildEntry{{ImageName: "app", Tag: "r/app:1@sha256:b"}, {ImageName: "app", Tag: "r/app:1@sha256:c"}}}, groups[1])
+	assert.Equal(t, "worker", groups[2].imageName)
+}
+
+func TestBuildResultMergeCmd(t *testing.T) {
+	host := startTestRegistry(t)
+	amd := pushInspectImage(t, host+"/org/app:1-amd64", v1.Platform{OS: "linux", Architecture: "amd64"})
+	arm := pushInspectImage(t, host+"/org/app:1-arm64", v1.Platform{OS: "linux", Architecture: "arm64"})
+	amdDigest, _ := amd.Digest()
+	armDigest, _ := arm.Digest()
+
+	dir := t.TempDir()
+	worker := util.BuildEntry{ImageName: "worker", Tag: "ghcr.io/org/worker:1@" + testDigest}
+	for arch, d := range map[string]v1.Hash{"amd64": amdDigest, "arm64": armDigest} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, arch), 0o755))
+		writeBuildResultFile(t, filepath.Join(dir, arch), []util.BuildEntry{{ImageName: "app", Tag: host + "/org/app:1-" + arch + "@" + d.String()}, worker})
+	}
+
+	out := filepath.Join(dir, "merged.json")
+	_ = buildResultMergeCmd.Flags().Set("output", out)
+	defer func() { _ = buildResultMergeCmd.Flags().Set("output", util.BuildResultFilename) }()
+	buildResultMergeCmd.SetContext(t.Context())
+	require.NoError(t, buildResultMergeCmd.RunE(buildResultMergeCmd, []string{
+		filepath.Join(dir, "amd64"),
+		filepath.Join(dir, "arm64", util.BuildResultFilename),
+	}))
+
+	require.NoError(t, os.Rename(out, filepath.Join(dir, util.BuildResultFilename)))
+	res, err := util.ReadBuildResult(dir)
+	require.NoError(t, err)
+	require.Len(t, res.Builds, 2)
+	assert.Equal(t, "app", res.Builds[0].ImageName)
+	assert.Contains(t, res.Builds[0].Tag, host+"/org/app:1@sha256:")
+	assert.Equal(t, worker, res.Builds[1])
+
+	im := remoteIndexManifest(t, res.Builds[0].Tag)
+	assert.Equal(t, types.DockerManifestList, im.MediaType)
+	require.Len(t, im.Manifests, 2)
+	assert.Equal(t, armDigest, im.Manifests[1].Digest)
+	assert.Equal(t, host+"/org/app:1@"+res.Builds[0].Digest, res.Builds[0].Tag)
+	assert.Equal(t, []pipeline.PlatformDigest{
+		{Platform: "linux/amd64", Digest: amdDigest.String()},
+		{Platform: "linux/arm64", Digest: armDigest.String()},
+	}, res.Builds[0].Platforms)
+
+	assert.ErrorContains(t, buildResultMergeCmd.RunE(buildResultMergeCmd, []string{filepath.Join(dir, "missing")}), "missing")
+}
+
+func TestBuildResultInput(t *testing.T) {
+	newCmd := func(args ...string) *cobra.Command {
+		c := &cobra.Command{}
+		c.Flags().String("build-result-dir", "", "")
+		c.Flags().String("build-result-file", "", "")
+		require.NoError(t, c.Flags().Parse(args))
+		return c
+	}
+	assert.Equal(t, util.BuildResultFilename, buildResultInput(newCmd()))
+	assert.Equal(t, filepath.Join("out", util.BuildResultFilename), buildResultInput(newCmd("--build-result-dir", "out")))
+	assert.Equal(t, "r.json", buildResultInput(newCmd("--build-result-dir", "out", "--build-result-file", "r.json")))
+
+	t.Setenv("OP_BUILD_RESULT_FILE", "/tmp/op/result.json")
+	assert.Equal(t, "/tmp/op/result.json", buildResultInput(newCmd()))
+	assert.Equal(t, filepath.Join("out", util.BuildResultFilename), buildResultInput(newCmd("--build-result-dir", "out")))
+}
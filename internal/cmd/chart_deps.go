@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Modes of chart dependency resolution (--chart-dependencies,
+// chart_dependencies in .github/octopilot.yaml).
+const (
+	// chartDepsUpdate resolves the version ranges of Chart.yaml and
+	// rewrites Chart.lock (helm dependency update).
+	chartDepsUpdate = "update"
+	// chartDepsLocked fetches exactly the versions of Chart.lock, failing
+	// when it is missing or out of sync with Chart.yaml (helm dependency
+	// build).
+	chartDepsLocked = "locked"
+)
+
+// artifactChartDependencies returns the chart dependency mode of a chart
+// artifact: --chart-dependencies, else chart_dependencies of the artifact
+// in .github/octopilot.yaml ("" leaves the charts/ directory as it is).
+func artifactChartDependencies(cmd *cobra.Command, artCfg util.ArtifactBuildOpts) (string, error) {
+	mode, _ := cmd.Flags().GetString("chart-dependencies")
+	if !cmd.Flags().Changed("chart-dependencies") {
+		mode = artCfg.ChartDependencies
+	}
+	switch mode {
+	case "", chartDepsUpdate, chartDepsLocked:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown chart dependency mode %q (expected %s or %s)", mode, chartDepsUpdate, chartDepsLocked)
+}
+
+// resolveChartDependencies fetches the subcharts of the Helm chart in dir
+// into its charts/ directory (from OCI or classic repositories), as mode
+// says, before the chart is packaged. A chart without dependencies is left
+// alone.
+func resolveChartDependencies(ctx context.Context, dir, mode string) error {
+	if mode == "" {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if err != nil {
+		return fmt.Errorf("reading the chart: %w", err)
+	}
+	var chart struct {
+		Dependencies []struct {
+			Name string `yaml:"name"`
+		} `yaml:"dependencies"`
+	}
+	if err := yaml.Unmarshal(data, &chart); err != nil {
+		return fmt.Errorf("parsing %s: %w", filepath.Join(dir, "Chart.yaml"), err)
+	}
+	if len(chart.Dependencies) == 0 {
+		return nil
+	}
+	args := []string{"dependency", "update", dir}
+	if mode == chartDepsLocked {
+		// Without a Chart.lock, helm dependency build resolves like update.
+		if _, err := os.Stat(filepath.Join(dir, "Chart.lock")); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%s has dependencies but no Chart.lock: run helm dependency update and commit it", dir)
+		}
+		args = []string{"dependency", "build", dir}
+	}
+	if err := util.RunCommand(ctx, "helm", args...); err != nil {
+		return fmt.Errorf("helm %s %s failed: %w", args[0], args[1], err)
+	}
+	return nil
+}
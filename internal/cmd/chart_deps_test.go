@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const umbrellaChart = `apiVersion: v2
+name: platform
+version: 1.4.0
+dependencies:
+  - name: redis
+    version: ~19.0.0
+    repository: oci://registry-1.docker.io/bitnamicharts
+  - name: ingress-nginx
+    version: 4.x
+    repository: https://kubernetes.github.io/ingress-nginx
+`
+
+func TestArtifactChartDependencies(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("chart-dependencies", "", "")
+
+	mode, err := artifactChartDependencies(cmd, util.ArtifactBuildOpts{})
+	require.NoError(t, err)
+	assert.Empty(t, mode)
+	mode, err = artifactChartDependencies(cmd, util.ArtifactBuildOpts{ChartDependencies: "locked"})
+	require.NoError(t, err)
+	assert.Equal(t, chartDepsLocked, mode)
+
+	require.NoError(t, cmd.Flags().Set("chart-dependencies", "update"))
+	mode, err = artifactChartDependencies(cmd, util.ArtifactBuildOpts{ChartDependencies: "locked"})
+	require.NoError(t, err)
+	assert.Equal(t, chartDepsUpdate, mode)
+
+	require.NoError(t, cmd.Flags().Set("chart-dependencies", "latest"))
+	_, err = artifactChartDependencies(cmd, util.ArtifactBuildOpts{})
+	assert.ErrorContains(t, err, `unknown chart dependency mode "latest"`)
+}
+
+func TestResolveChartDependencies(t *testing.T) {
+	orig := util.RunCommandFn
+	t.Cleanup(func() { util.RunCommandFn = orig })
+	var calls [][]string
+	util.RunCommandFn = func(_ context.Context, name string, args ...string) error {
+		calls = append(calls, append([]string{name}, args...))
+		return nil
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("apiVersion: v2\nname: app\nversion: 0.1.0\n"), 0o644))
+	require.NoError(t, resolveChartDependencies(t.Context(), dir, chartDepsUpdate))
+	assert.Empty(t, calls, "no dependencies")
+	require.NoError(t, resolveChartDependencies(t.Context(), t.TempDir(), ""), "off")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte(umbrellaChart), 0o644))
+	require.NoError(t, resolveChartDependencies(t.Context(), dir, chartDepsUpdate))
+	assert.Equal(t, []string{"helm", "dependency", "update", dir}, calls[0])
+
+	assert.ErrorContains(t, resolveChartDependencies(t.Context(), dir, chartDepsLocked), "no Chart.lock")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Chart.lock"), []byte("dependencies: []\n"), 0o644))
+	require.NoError(t, resolveChartDependencies(t.Context(), dir, chartDepsLocked))
+	assert.Equal(t, []string{"helm", "dependency", "build", dir}, calls[1])
+
+	util.RunCommandFn = func(context.Context, string, ...string) error { return errors.New("exit status 1") }
+	assert.ErrorContains(t, resolveChartDependencies(t.Context(), dir, chartDepsLocked), "helm dependency build failed: exit status 1")
+
+	assert.ErrorContains(t, resolveChartDependencies(t.Context(), t.TempDir(), chartDepsUpdate), "reading the chart")
+}
@@ -0,0 +1,375 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// The jobs op ci generate manages sit between these lines; the rest of the
+// workflow is the user's and kept on regeneration.
+const (
+	ciBeginMarker = "# >>> op ci generate: managed jobs, regenerate instead of editing >>>"
+	ciEndMarker   = "# <<< op ci generate <<<"
+)
+
+// ciImage is an artifact deployed by the generated workflow.
+type ciImage struct {
+	Name      string
+	Component string
+	Namespace string
+	// StepID is the id of the scan job step that looks up the image's tag.
+	StepID string
+}
+
+// ciStage is the deploy job of one environment: the first is deployed from
+// the build, each next one promoted from Source.
+type ciStage struct {
+	Job         string
+	Needs       string
+	Environment string
+	Source      string
+	// Logins are the registries to log in to before promoting.
+	Logins []ciLogin
+	GitOps bool
+}
+
+// ciLogin is an op login step: Registry as written in .registry, and Host,
+// the argument that logs in to its host.
+type ciLogin struct {
+	Registry string
+	Host     string
+}
+
+// ciWorkflow is what the workflow template renders.
+type ciWorkflow struct {
+	Branch       string
+	Login        ciLogin
+	Images       []ciImage
+	Scan         bool
+	ScanSeverity string
+	Stages       []ciStage
+}
+
+var ciStepIDUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// registryLogin returns the op login step of a registry or repository as
+// written in .registry. When the host is not literal (the registry is a
+// variable such as ${PROD_REGISTRY}), the step's shell expands it and cuts
+// the host.
+func registryLogin(registry string) ciLogin {
+	host, _, _ := strings.Cut(registry, "/")
+	if strings.Contains(host, "$") {
+		host = `"$(echo "` + registry + `" | cut -d/ -f1)"`
+	}
+	return ciLogin{Registry: registry, Host: host}
+}
+
+// ciEnvironments returns the promotion order: ci.environments, else the
+// environments of .registry with dev, pp and prod first.
+func ciEnvironments(cwd string, cfg util.CIOpts) []string {
+	if len(cfg.Environments) > 0 {
+		return cfg.Environments
+	}
+	envs := util.RegistryEnvironments(cwd)
+	rank := func(env string) int {
+		if i := slices.Index([]string{"dev", "pp", "prod"}, env); i >= 0 {
+			return i
+		}
+		return 3
+	}
+	slices.SortStableFunc(envs, func(a, b string) int { return cmp.Compare(rank(a), rank(b)) })
+	return envs
+}
+
+// buildCIWorkflow derives the workflow of the repo in cwd from its
+// artifacts, .registry and the ci and gitops sections of runCfg.
+func buildCIWorkflow(cwd string, artifacts []artifactInfo, runCfg *util.RunConfig) ciWorkflow {
+	cfg := runCfg.CI
+	w := ciWorkflow{
+		Branch:       cmp.Or(cfg.Branch, "main"),
+		Login:        registryLogin("ghcr.io"),
+		Scan:         cfg.Scan == nil || *cfg.Scan,
+		ScanSeverity: cmp.Or(cfg.ScanSeverity, "high"),
+	}
+	if regs := util.RegistriesAsWritten(cwd, ""); len(regs) > 0 {
+		w.Login = registryLogin(regs[0])
+	}
+	for _, a := range artifacts {
+		if strings.HasSuffix(a.Image, "-chart") {
+			continue
+		}
+		component := cmp.Or(cfg.Components[a.Image], a.Image)
+		w.Images = append(w.Images, ciImage{
+			Name:      a.Image,
+			Component: component,
+			Namespace: cmp.Or(cfg.Namespace, component),
+			StepID:    "tag-" + ciStepIDUnsafe.ReplaceAllString(a.Image, "-"),
+		})
+	}
+
+	needs := "build"
+	if w.Scan && len(w.Images) > 0 {
+		needs = "scan"
+	}
+	envs := ciEnvironments(cwd, cfg)
+	for i, env := range envs {
+		_, gitops := runCfg.GitOps.Environments[env]
+		s := ciStage{Job: "deploy-" + env, Needs: needs, Environment: env, GitOps: gitops}
+		if i > 0 {
+			s.Job, s.Source = "promote-"+env, envs[i-1]
+			for _, e := range []string{s.Source, env} {
+				for _, reg := range util.RegistriesAsWritten(cwd, e) {
+					l := registryLogin(reg)
+					if !slices.ContainsFunc(s.Logins, func(o ciLogin) bool { return o.Host == l.Host }) {
+						s.Logins = append(s.Logins, l)
+					}
+				}
+			}
+		}
+		w.Stages = append(w.Stages, s)
+		needs = s.Job
+	}
+	return w
+}
+
+// ciTemplates use [[ ]] so GitHub Actions ${{ }} expressions pass through.
+const ciTemplates = `[[define "install"]]      - name: Install op
+        run: |
+          curl -fsSL https://github.com/octopilot/octopilot-pipeline-tools/releases/latest/download/op-linux-amd64 -o /usr/local/bin/op
+          chmod +x /usr/local/bin/op[[end]]
+[[define "login"]]      - name: Log in to [[.Registry]]
+        run: op login [[.Host]] --oidc
+        env:
+          GITHUB_TOKEN: ${{ secrets.GITHUB_TOKEN }}[[end]]
+[[define "header"]]name: op
+
+on:
+  push:
+    branches: [[printf "[%s]" .Branch]]
+  pull_request:
+
+permissions:
+  contents: read
+  packages: write
+  id-token: write
+
+jobs:
+[[end]]
+[[define "jobs"]]  ` + ciBeginMarker + `
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+[[template "install"]]
+      - uses: docker/setup-qemu-action@v3
+[[template "login" .Login]]
+      - name: Build and push
+        run: op build --push
+      - uses: actions/upload-artifact@v4
+        with:
+          name: build-result
+          path: build_result.json
+[[- if and .Scan .Images]]
+
+  scan:
+    needs: build
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+[[template "install"]]
+      - uses: actions/download-artifact@v4
+        with:
+          name: build-result
+[[template "login" .Login]]
+      - name: Verify the build
+        run: op verify-build --build-result-dir .
+[[- range .Images]]
+      - id: [[.StepID]]
+        run: echo "tag=$(jq -r '.builds[] | select(.imageName == "[[.Name]]") | .tag' build_result.json)" >> "$GITHUB_OUTPUT"
+      - name: Scan [[.Name]]
+        uses: anchore/scan-action@v6
+        with:
+          image: ${{ steps.[[.StepID]].outputs.tag }}
+          fail-build: true
+          severity-cutoff: [[$.ScanSeverity]]
+[[- end]]
+[[- end]]
+[[- range $stage := .Stages]]
+
+  [[.Job]]:
+[[- if not .Source]]
+    if: github.ref == 'refs/heads/[[$.Branch]]' && github.event_name == 'push'
+[[- end]]
+    needs: [[.Needs]]
+    runs-on: ubuntu-latest
+    environment: [[.Environment]]
+    steps:
+      - uses: actions/checkout@v4
+[[template "install"]]
+      - uses: actions/download-artifact@v4
+        with:
+          name: build-result
+[[- if .Source]]
+[[- range .Logins]]
+[[template "login" .]]
+[[- end]]
+[[- range $.Images]]
+      - name: Promote [[.Name]] from [[$stage.Source]] to [[$stage.Environment]]
+        run: op promote-image --source [[$stage.Source]] --destination [[$stage.Environment]] --build-result-dir . --image-name [[.Name]]
+[[- end]]
+[[- end]]
+[[- if .GitOps]]
+      - name: Update the [[.Environment]] GitOps manifests
+        run: op gitops-update --environment [[.Environment]] --build-result-dir .
+        env:
+          GITHUB_TOKEN: ${{ secrets.GITOPS_TOKEN }}
+[[- end]]
+[[- if $.Images]]
+      # Configure access to the [[.Environment]] cluster (kubeconfig) before these steps.
+[[- end]]
+[[- range $.Images]]
+      - name: Wait for the [[.Component]] rollout in [[$stage.Environment]]
+        run: op watch-deployment --component [[.Component]] --environment [[$stage.Environment]] --namespace [[.Namespace]] --build-result-dir . --image-name [[.Name]]
+[[- end]]
+[[- end]]
+  ` + ciEndMarker + `
+[[end]]`
+
+// renderCIWorkflow renders the header a new workflow starts with and the
+// managed jobs block, markers included.
+func renderCIWorkflow(w ciWorkflow) (header, jobs string, err error) {
+	t, err := template.New("ci").Delims("[[", "]]").Parse(ciTemplates)
+	if err != nil {
+		return "", "", err
+	}
+	var h, j bytes.Buffer
+	if err := t.ExecuteTemplate(&h, "header", w); err != nil {
+		return "", "", err
+	}
+	if err := t.ExecuteTemplate(&j, "jobs", w); err != nil {
+		return "", "", err
+	}
+	return h.String(), j.String(), nil
+}
+
+// spliceManagedBlock replaces the lines from ciBeginMarker to ciEndMarker in
+// existing with block, reporting false when existing has no such block.
+func spliceManagedBlock(existing, block string) (string, bool) {
+	lines := strings.SplitAfter(existing, "\n")
+	begin := slices.IndexFunc(lines, func(l string) bool { return strings.TrimSpace(l) == ciBeginMarker })
+	if begin < 0 {
+		return "", false
+	}
+	end := slices.IndexFunc(lines[begin:], func(l string) bool { return strings.TrimSpace(l) == ciEndMarker })
+	if end < 0 {
+		return "", false
+	}
+	end += begin
+	var b strings.Builder
+	for _, l := range lines[:begin] {
+		b.WriteString(l)
+	}
+	b.WriteString(block)
+	for _, l := range lines[end+1:] {
+		b.WriteString(l)
+	}
+	return b.String(), true
+}
+
+var ciCmd = &cobra.Command{
+	Use:   "ci",
+	Short: "Manage the CI pipeline of the repository.",
+}
+
+var ciGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate or update the GitHub Actions workflow: build, scan, promote and watch.",
+	Long: `Write a GitHub Actions workflow that runs the repo's pipeline:
+
+  build              op build --push on every push and pull request
+  scan               op verify-build, then a vulnerability scan of each image
+  deploy-<env>       on pushes to the branch: gitops-update (when the
+                     environment is in gitops.environments) and
+                     watch-deployment of each image
+  promote-<env>      for each next environment: promote-image from the one
+                     before, then as deploy
+
+Artifacts come from skaffold.yaml (charts are built but not deployed),
+environments from ci.environments in .github/octopilot.yaml, else from
+.registry (dev, pp, prod first), and the registries to log in to from
+.registry.
+
+The jobs are written between marker comments. Running op ci generate again
+replaces only them, so the header and jobs added outside the markers are
+kept. A workflow without markers is left alone unless --force is set.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		output, _ := cmd.Flags().GetString("output")
+		force, _ := cmd.Flags().GetBool("force")
+		file, _ := cmd.Flags().GetString("filename")
+		profiles, _ := cmd.Flags().GetStringSlice("profile")
+		if val := viper.GetString("SKAFFOLD_PROFILE"); len(profiles) == 0 && val != "" {
+			profiles = strings.Split(val, ",")
+		}
+		runCfg, err := util.LoadRunConfig(cwd)
+		if err != nil {
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("reading %s: %w", util.RunConfigFilename, err))
+		}
+		artifacts, err := listArtifacts(cmd.Context(), file, profiles)
+		if err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
+
+		header, jobs, err := renderCIWorkflow(buildCIWorkflow(cwd, artifacts, runCfg))
+		if err != nil {
+			return fmt.Errorf("rendering the workflow: %w", err)
+		}
+		content, verb := header+jobs, "Created"
+		if existing, err := os.ReadFile(output); err == nil {
+			spliced, ok := spliceManagedBlock(string(existing), jobs)
+			switch {
+			case ok:
+				content, verb = spliced, "Updated"
+			case !force:
+				return util.WithExitCode(util.ExitConfig, util.WithHint(
+					fmt.Errorf("%s has no op ci generate markers", output),
+					"Pass --force to overwrite it, or add the two marker lines under jobs: to have op manage the jobs between them."))
+			default:
+				verb = "Overwrote"
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(output), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(output, []byte(content), 0o644); err != nil {
+			return err
+		}
+		slog.Info(verb+" workflow", "file", output)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ciCmd)
+	ciCmd.AddCommand(ciGenerateCmd)
+	ciGenerateCmd.Flags().StringP("output", "o", initWorkflowPath, "Workflow file to write")
+	ciGenerateCmd.Flags().Bool("force", false, "Overwrite a workflow without op ci generate markers")
+	ciGenerateCmd.Flags().StringP("filename", "f", "skaffold.yaml", "Path to skaffold.yaml")
+	ciGenerateCmd.Flags().StringSliceP("profile", "p", nil, "Skaffold profile(s) to activate (default: $SKAFFOLD_PROFILE)")
+}
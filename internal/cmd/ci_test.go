@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCIEnvironments(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.RegistryFilename), []byte("environments:\n  qa: gcr.io/acme/qa\n  prod: gcr.io/acme/prod\n  dev: gcr.io/acme/dev\n"), 0o644))
+	assert.Equal(t, []string{"dev", "prod", "qa"}, ciEnvironments(dir, util.CIOpts{}))
+	assert.Equal(t, []string{"staging", "live"}, ciEnvironments(dir, util.CIOpts{Environments: []string{"staging", "live"}}))
+}
+
+func TestBuildCIWorkflow(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.RegistryFilename), []byte(`ci:
+  - ghcr.io/${GITHUB_REPOSITORY_OWNER}
+environments:
+  dev: europe-docker.pkg.dev/acme/dev
+  prod: ${PROD_REGISTRY:-gcr.io/acme-prod}
+`), 0o644))
+	runCfg := &util.RunConfig{}
+	runCfg.CI.Components = map[string]string{"api": "api-server"}
+	runCfg.CI.Namespace = "shop"
+	runCfg.GitOps.Environments = map[string]util.GitOpsEnvironment{"dev": {}}
+	artifacts := []artifactInfo{{Image: "api"}, {Image: "ghcr.io/acme/worker"}, {Image: "api-chart"}}
+
+	w := buildCIWorkflow(dir, artifacts, runCfg)
+	assert.Equal(t, "main", w.Branch)
+	assert.Equal(t, ciLogin{Registry: "ghcr.io/${GITHUB_REPOSITORY_OWNER}", Host: "ghcr.io"}, w.Login)
+	assert.True(t, w.Scan)
+	assert.Equal(t, []ciImage{
+		{Name: "api", Component: "api-server", Namespace: "shop", StepID: "tag-api"},
+		{Name: "ghcr.io/acme/worker", Component: "ghcr.io/acme/worker", Namespace: "shop", StepID: "tag-ghcr-io-acme-worker"},
+	}, w.Images)
+	assert.Equal(t, []ciStage{
+		{Job: "deploy-dev", Needs: "scan", Environment: "dev", GitOps: true},
+		{Job: "promote-prod", Needs: "deploy-dev", Environment: "prod", Source: "dev", Logins: []ciLogin{
+			{Registry: "europe-docker.pkg.dev/acme/dev", Host: "europe-docker.pkg.dev"},
+			{Registry: "${PROD_REGISTRY:-gcr.io/acme-prod}", Host: `"$(echo "${PROD_REGISTRY:-gcr.io/acme-prod}" | cut -d/ -f1)"`},
+		}},
+	}, w.Stages)
+
+	scan := false
+	runCfg.CI.Scan = &scan
+	w = buildCIWorkflow(dir, artifacts, runCfg)
+	assert.Equal(t, "build", w.Stages[0].Needs)
+}
+
+func TestRenderCIWorkflow(t *testing.T) {
+	w := ciWorkflow{
+		Branch: "trunk", Login: ciLogin{Registry: "ghcr.io/acme", Host: "ghcr.io"}, Scan: true, ScanSeverity: "critical",
+		Images: []ciImage{{Name: "api", Component: "api", Namespace: "api", StepID: "tag-api"}},
+		Stages: []ciStage{
+			{Job: "deploy-dev", Needs: "scan", Environment: "dev", GitOps: true},
+			{Job: "promote-prod", Needs: "deploy-dev", Environment: "prod", Source: "dev", Logins: []ciLogin{{Registry: "gcr.io/acme", Host: "gcr.io"}}},
+		},
+	}
+	header, jobs, err := renderCIWorkflow(w)
+	require.NoError(t, err)
+	var wf struct {
+		On struct {
+			Push struct {
+				Branches []string `yaml:"branches"`
+			} `yaml:"push"`
+		} `yaml:"on"`
+		Jobs map[string]struct {
+			If          string `yaml:"if"`
+			Needs       string `yaml:"needs"`
+			Environment string `yaml:"environment"`
+			Steps       []struct {
+				Name string            `yaml:"name"`
+				Uses string            `yaml:"uses"`
+				Run  string            `yaml:"run"`
+				With map[string]string `yaml:"with"`
+			} `yaml:"steps"`
+		} `yaml:"jobs"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte(header+jobs), &wf), header+jobs)
+	assert.Equal(t, []string{"trunk"}, wf.On.Push.Branches)
+	require.Len(t, wf.Jobs, 4)
+	assert.Equal(t, "build", wf.Jobs["scan"].Needs)
+	assert.Equal(t, "github.ref == 'refs/heads/trunk' && github.event_name == 'push'", wf.Jobs["deploy-dev"].If)
+	assert.Equal(t, "deploy-dev", wf.Jobs["promote-prod"].Needs)
+	assert.Empty(t, wf.Jobs["promote-prod"].If)
+	assert.Equal(t, "prod", wf.Jobs["promote-prod"].Environment)
+
+	assert.Contains(t, jobs, `select(.imageName == "api")`)
+	assert.Contains(t, jobs, "image: ${{ steps.tag-api.outputs.tag }}")
+	assert.Contains(t, jobs, "severity-cutoff: critical")
+	assert.Contains(t, jobs, "run: op gitops-update --environment dev --build-result-dir .")
+	assert.Contains(t, jobs, "run: op login ghcr.io --oidc")
+	assert.Contains(t, jobs, "- name: Log in to gcr.io/acme\n        run: op login gcr.io --oidc")
+	assert.Contains(t, jobs, "run: op promote-image --source dev --destination prod --build-result-dir . --image-name api")
+	assert.Contains(t, jobs, "run: op watch-deployment --component api --environment prod --namespace api --build-result-dir . --image-name api")
+}
+
+func TestSpliceManagedBlock(t *testing.T) {
+	existing := "name: op\njobs:\n  lint:\n    runs-on: ubuntu-latest\n  " + ciBeginMarker + "\n  build: {}\n  " + ciEndMarker + "\n  notify: {}\n"
+	out, ok := spliceManagedBlock(existing, "  "+ciBeginMarker+"\n  build2: {}\n  "+ciEndMarker+"\n")
+	require.True(t, ok)
+	assert.Equal(t, "name: op\njobs:\n  lint:\n    runs-on: ubuntu-latest\n  "+ciBeginMarker+"\n  build2: {}\n  "+ciEndMarker+"\n  notify: {}\n", out)
+
+	_, ok = spliceManagedBlock("name: op\njobs:\n  build: {}\n", "x")
+	assert.False(t, ok)
+	_, ok = spliceManagedBlock("  "+ciBeginMarker+"\n  build: {}\n", "x")
+	assert.False(t, ok)
+}
+
+func TestCIGenerate_KeepsUnmanagedWorkflow(t *testing.T) {
+	dir := writeArtifactsProject(t)
+	out := filepath.Join(dir, initWorkflowPath)
+	require.NoError(t, os.MkdirAll(filepath.Dir(out), 0o755))
+	require.NoError(t, os.WriteFile(out, []byte("name: mine\n"), 0o644))
+	require.NoError(t, ciGenerateCmd.Flags().Set("output", out))
+	t.Cleanup(func() { _ = ciGenerateCmd.Flags().Set("output", initWorkflowPath) })
+
+	ciGenerateCmd.SetContext(t.Context())
+	err := ciGenerateCmd.RunE(ciGenerateCmd, nil)
+	require.Error(t, err)
+	assert.Equal(t, util.ExitConfig, util.ExitCode(err))
+	data, _ := os.ReadFile(out)
+	assert.Equal(t, "name: mine\n", string(data))
+
+	require.NoError(t, os.WriteFile(out, []byte("name: mine\njobs:\n  "+ciBeginMarker+"\n  "+ciEndMarker+"\n"), 0o644))
+	require.NoError(t, ciGenerateCmd.RunE(ciGenerateCmd, nil))
+	data, _ = os.ReadFile(out)
+	assert.Contains(t, string(data), "name: mine\njobs:\n  "+ciBeginMarker+"\n  build:\n")
+	assert.Contains(t, string(data), "- name: Scan api")
+}
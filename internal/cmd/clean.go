@@ -0,0 +1,324 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// platformTagPattern matches the per-platform tags pushed before a multi-arch
+// index is assembled: <tag>-linux-amd64 (op build) or <tag>_linux_arm64 (CI).
+var platformTagPattern = regexp.MustCompile(`[-_]linux[-_](amd64|arm64|arm|386|ppc64le|s390x|riscv64)([-_]v\d)?$`)
+
+// ephemeralTagPattern matches pull-request and ttl tags, deleted once stale.
+var ephemeralTagPattern = regexp.MustCompile(`^(pr|ttl)-`)
+
+// cleanTag is a tag in the repository being cleaned.
+type cleanTag struct {
+	Tag    string
+	Digest string
+	// Children are the manifests of an index, kept alive by the tag.
+	Children []string
+	// Created is the image creation time; zero when unknown or the fixed
+	// timestamp of a reproducible (buildpack) build.
+	Created time.Time
+}
+
+// cleanRules are the retention rules of `op clean`.
+type cleanRules struct {
+	// Keep is the number of newest non-release tags to keep.
+	Keep int
+	// OlderThan is the minimum age of a deleted tag (0 ignores age).
+	OlderThan time.Duration
+	Release   *regexp.Regexp
+	KeepTags  []*regexp.Regexp
+	Now       time.Time
+}
+
+// cleanDecision is the outcome of the rules for one tag.
+type cleanDecision struct {
+	cleanTag
+	Delete bool
+	Reason string
+}
+
+// parseAge parses a duration that may also use d (days) and w (weeks), e.g. 30d.
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// planClean applies r to tags and returns a decision per tag, newest first.
+// Release and --keep-tag tags are always kept and platform intermediates
+// always deleted. PR/ttl tags are deleted once older than r.OlderThan; other
+// tags beyond the r.Keep newest are deleted once older than r.OlderThan.
+// Tags without a known creation time are only deleted by the first rules.
+func planClean(tags []cleanTag, r cleanRules) []cleanDecision {
+	sorted := append([]cleanTag(nil), tags...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Created.Equal(sorted[j].Created) {
+			return sorted[i].Tag > sorted[j].Tag
+		}
+		return sorted[i].Created.After(sorted[j].Created)
+	})
+	decisions := make([]cleanDecision, 0, len(sorted))
+	kept := 0
+	for _, t := range sorted {
+		d := cleanDecision{cleanTag: t}
+		// byAge deletes t if it is older than r.OlderThan.
+		byAge := func(reason string) {
+			switch {
+			case r.OlderThan == 0:
+				d.Delete = true
+			case t.Created.IsZero():
+				reason += ", unknown age"
+			case r.Now.Sub(t.Created) > r.OlderThan:
+				d.Delete = true
+			default:
+				reason += ", newer than " + formatAge(r.OlderThan)
+			}
+			d.Reason = reason
+		}
+		switch {
+		case r.Release != nil && r.Release.MatchString(t.Tag):
+			d.Reason = "release"
+		case matchesAny(r.KeepTags, t.Tag):
+			d.Reason = "--keep-tag"
+		case platformTagPattern.MatchString(t.Tag):
+			d.Delete, d.Reason = true, "platform intermediate"
+		case ephemeralTagPattern.MatchString(t.Tag):
+			byAge("PR/ttl tag")
+		case kept < r.Keep:
+			kept++
+			d.Reason = fmt.Sprintf("newest %d", r.Keep)
+		default:
+			byAge(fmt.Sprintf("beyond newest %d", r.Keep))
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatAge prints whole days as e.g. 30d.
+func formatAge(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+// cleanDeleteRefs returns what to DELETE for the decisions marked Delete.
+// A manifest still referenced by a kept tag (directly or as a child of a
+// kept index) is only untagged; other manifests are deleted by digest, once.
+func cleanDeleteRefs(decisions []cleanDecision) []string {
+	inUse := map[string]bool{}
+	for _, d := range decisions {
+		if !d.Delete {
+			inUse[d.Digest] = true
+			for _, c := range d.Children {
+				inUse[c] = true
+			}
+		}
+	}
+	var refs []string
+	seen := map[string]bool{}
+	for _, d := range decisions {
+		if !d.Delete {
+			continue
+		}
+		ref := "@" + d.Digest
+		if inUse[d.Digest] {
+			ref = ":" + d.Tag
+		}
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// reproducibleEpoch is before the fixed creation time of reproducible builds
+// (pack uses 1980-01-01), which says nothing about a tag's age.
+var reproducibleEpoch = time.Date(1981, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// listCleanTags reads every tag of repo with its digest, index children and
+// creation time (of the first platform image for an index).
+func listCleanTags(ctx context.Context, repo name.Repository, opts ...remote.Option) ([]cleanTag, error) {
+	tags, err := remote.List(repo, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("listing tags of %s: %w", repo, err)
+	}
+	var result []cleanTag
+	for _, tag := range tags {
+		desc, err := remoteGet(ctx, repo.Tag(tag), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s:%s: %w", repo, tag, err)
+		}
+		t := cleanTag{Tag: tag, Digest: desc.Digest.String()}
+		var img v1.Image
+		if desc.MediaType.IsIndex() {
+			idx, err := desc.ImageIndex()
+			if err != nil {
+				return nil, err
+			}
+			manifest, err := idx.IndexManifest()
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range manifest.Manifests {
+				t.Children = append(t.Children, m.Digest.String())
+			}
+			if len(manifest.Manifests) > 0 {
+				img, _ = idx.Image(manifest.Manifests[0].Digest)
+			}
+		} else {
+			img, _ = desc.Image()
+		}
+		if img != nil {
+			if cfg, err := img.ConfigFile(); err == nil && cfg.Created.After(reproducibleEpoch) {
+				t.Created = cfg.Created.Time
+			}
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+func printCleanPlan(decisions []cleanDecision) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tTAG\tCREATED\tREASON")
+	for _, d := range decisions {
+		action := "keep"
+		if d.Delete {
+			action = "delete"
+		}
+		created := "-"
+		if !d.Created.IsZero() {
+			created = d.Created.UTC().Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", action, d.Tag, created, d.Reason)
+	}
+	_ = w.Flush()
+}
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Delete old tags from a registry repository according to retention rules.",
+	Long: `List the tags of --repo and apply retention rules:
+
+  - release tags (--release-pattern, default vX.Y.Z) and --keep-tag matches are kept;
+  - platform-suffixed intermediates (<tag>-linux-amd64, <tag>_linux_arm64) are deleted;
+  - pr-* and ttl-* tags are deleted once older than --older-than;
+  - of the remaining tags the newest --keep are kept, older ones are deleted
+    once older than --older-than.
+
+Age is the image creation time; tags of reproducible builds (buildpacks,
+created 1980-01-01) have no usable age and are only deleted by the platform
+rule. Manifests still referenced by a kept tag are untagged rather than
+deleted (needs a registry that supports tag deletion). Use --dry-run to
+only print the plan.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoFlag, _ := cmd.Flags().GetString("repo")
+		keep, _ := cmd.Flags().GetInt("keep")
+		olderThan, _ := cmd.Flags().GetString("older-than")
+		releasePattern, _ := cmd.Flags().GetString("release-pattern")
+		keepTags, _ := cmd.Flags().GetStringArray("keep-tag")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+
+		rules := cleanRules{Keep: keep, Now: time.Now()}
+		var err error
+		if rules.OlderThan, err = parseAge(olderThan); err != nil {
+			return err
+		}
+		if rules.Release, err = regexp.Compile(releasePattern); err != nil {
+			return fmt.Errorf("invalid --release-pattern: %w", err)
+		}
+		for _, p := range keepTags {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return fmt.Errorf("invalid --keep-tag %q: %w", p, err)
+			}
+			rules.KeepTags = append(rules.KeepTags, re)
+		}
+
+		insecure := insecureRegistries(insecureFlag)
+		var nameOpts []name.Option
+		if isInsecureRegistry(repoFlag, insecure) {
+			nameOpts = append(nameOpts, name.Insecure)
+		}
+		repo, err := name.NewRepository(repoFlag, nameOpts...)
+		if err != nil {
+			return fmt.Errorf("parsing --repo: %w", err)
+		}
+		opts := remoteOptionsFor(cmd.Context(), repoFlag, insecure)
+		tags, err := listCleanTags(cmd.Context(), repo, opts...)
+		if err != nil {
+			return err
+		}
+		decisions := planClean(tags, rules)
+		printCleanPlan(decisions)
+
+		refs := cleanDeleteRefs(decisions)
+		if dryRun {
+			slog.Info("Dry run: nothing deleted", "would_delete", len(refs), "tags", len(tags))
+			return nil
+		}
+		for _, r := range refs {
+			ref, err := name.ParseReference(repo.String()+r, nameOpts...)
+			if err != nil {
+				return err
+			}
+			slog.Info("Deleting", util.LogKeyTag, ref)
+			if err := remote.Delete(ref, opts...); err != nil {
+				return fmt.Errorf("deleting %s: %w", ref, err)
+			}
+		}
+		slog.Info("Deleted manifests and tags", "deleted", len(refs))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cleanCmd)
+	cleanCmd.Flags().String("repo", "", "Repository to clean, e.g. ghcr.io/my-org/my-app")
+	cleanCmd.Flags().Int("keep", 20, "Number of newest non-release tags to keep")
+	cleanCmd.Flags().String("older-than", "30d", "Only delete tags older than this (e.g. 30d, 2w, 72h; 0 ignores age)")
+	cleanCmd.Flags().String("release-pattern", `^v?\d+\.\d+\.\d+$`, "Regexp of release tags, which are always kept")
+	cleanCmd.Flags().StringArray("keep-tag", []string{"^latest$"}, "Regexp of tags to always keep (repeatable)")
+	cleanCmd.Flags().Bool("dry-run", false, "Print the plan without deleting anything")
+	cleanCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+	_ = cleanCmd.MarkFlagRequired("repo")
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAge(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"72h": 72 * time.Hour,
+		"0":   0,
+	} {
+		got, err := parseAge(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := parseAge("xd")
+	assert.Error(t, err)
+}
+
+func TestPlatformTagPattern(t *testing.T) {
+	assert.True(t, platformTagPattern.MatchString("v1.2.3-linux-amd64"))
+	assert.True(t, platformTagPattern.MatchString("v0.0.34_linux_arm64"))
+	assert.True(t, platformTagPattern.MatchString("sha-abc-linux-arm-v7"))
+	assert.False(t, platformTagPattern.MatchString("v1.2.3"))
+}
+
+func TestPlanClean(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return now.Add(-time.Duration(n) * 24 * time.Hour) }
+	tags := []cleanTag{
+		{Tag: "v1.0.0", Created: day(400)},
+		{Tag: "latest", Created: day(1)},
+		{Tag: "v1.1.0-linux-amd64", Created: day(1)},
+		{Tag: "pr-12", Created: day(40)},
+		{Tag: "pr-13", Created: day(2)},
+		{Tag: "sha-new", Created: day(3)},
+		{Tag: "sha-mid", Created: day(35)},
+		{Tag: "sha-old", Created: day(60)},
+		{Tag: "sha-recent", Created: day(10)},
+		{Tag: "main"},
+	}
+	decisions := planClean(tags, cleanRules{
+		Keep:      1,
+		OlderThan: 30 * 24 * time.Hour,
+		Release:   regexp.MustCompile(`^v?\d+\.\d+\.\d+$`),
+		KeepTags:  []*regexp.Regexp{regexp.MustCompile(`^latest$`)},
+		Now:       now,
+	})
+
+	got := map[string]string{}
+	var order []string
+	for _, d := range decisions {
+		action := "keep"
+		if d.Delete {
+			action = "delete"
+		}
+		got[d.Tag] = action + ": " + d.Reason
+		order = append(order, d.Tag)
+	}
+	assert.Equal(t, map[string]string{
+		"v1.0.0":             "keep: release",
+		"latest":             "keep: --keep-tag",
+		"v1.1.0-linux-amd64": "delete: platform intermediate",
+		"pr-12":              "delete: PR/ttl tag",
+		"pr-13":              "keep: PR/ttl tag, newer than 30d",
+		"sha-new":            "keep: newest 1",
+		"sha-recent":         "keep: beyond newest 1, newer than 30d",
+		"sha-mid":            "delete: beyond newest 1",
+		"sha-old":            "delete: beyond newest 1",
+		"main":               "keep: beyond newest 1, unknown age",
+	}, got)
+	assert.Equal(t, "main", order[len(order)-1], "tags without a creation time sort last")
+}
+
+func TestPlanClean_NoAgeLimit(t *testing.T) {
+	decisions := planClean([]cleanTag{{Tag: "a", Created: time.Now()}, {Tag: "b"}}, cleanRules{Keep: 1, Now: time.Now()})
+	assert.False(t, decisions[0].Delete)
+	assert.True(t, decisions[1].Delete)
+}
+
+func TestCleanDeleteRefs(t *testing.T) {
+	refs := cleanDeleteRefs([]cleanDecision{
+		{cleanTag: cleanTag{Tag: "v1.0.0", Digest: "sha256:index", Children: []string{"sha256:amd64"}}},
+		{cleanTag: cleanTag{Tag: "v1.0.0-linux-amd64", Digest: "sha256:amd64"}, Delete: true},
+		{cleanTag: cleanTag{Tag: "sha-old", Digest: "sha256:old"}, Delete: true},
+		{cleanTag: cleanTag{Tag: "pr-1", Digest: "sha256:old"}, Delete: true},
+		{cleanTag: cleanTag{Tag: "sha-abc", Digest: "sha256:index"}, Delete: true},
+	})
+	assert.Equal(t, []string{":v1.0.0-linux-amd64", "@sha256:old", ":sha-abc"}, refs)
+}
+
+func TestListCleanTags(t *testing.T) {
+	repo, err := name.NewRepository(startTestRegistry(t) + "/app")
+	require.NoError(t, err)
+	created := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	img, err = mutate.CreatedAt(img, v1.Time{Time: created})
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(repo.Tag("sha-abc"), img))
+
+	reproducible, err := mutate.CreatedAt(img, v1.Time{Time: time.Date(1980, 1, 1, 0, 0, 1, 0, time.UTC)})
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(repo.Tag("buildpack"), reproducible))
+
+	idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img})
+	require.NoError(t, remote.WriteIndex(repo.Tag("v1.0.0"), idx))
+
+	tags, err := listCleanTags(t.Context(), repo)
+	require.NoError(t, err)
+	byTag := map[string]cleanTag{}
+	for _, tag := range tags {
+		byTag[tag.Tag] = tag
+	}
+	require.Len(t, byTag, 3)
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, digest.String(), byTag["sha-abc"].Digest)
+	assert.True(t, created.Equal(byTag["sha-abc"].Created))
+	assert.True(t, byTag["buildpack"].Created.IsZero())
+	assert.Equal(t, []string{digest.String()}, byTag["v1.0.0"].Children)
+	assert.True(t, created.Equal(byTag["v1.0.0"].Created))
+}
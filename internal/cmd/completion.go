@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// Dynamic shell completions. Cobra's built-in "op completion bash|zsh|fish"
+// scripts call back into op ("op __complete ...") and these functions read
+// the project files in the current directory to offer values. Errors are
+// swallowed: a missing or broken file simply yields no suggestions.
+
+// defaultEnvironments are the environments known to promote-image and
+// watch-deployment through the GOOGLE_GKE_IMAGE_*_REPOSITORY keys; the
+// environments of .registry are offered as well.
+var defaultEnvironments = []string{"dev", "pp", "prod"}
+
+// completionSkaffoldFile returns the skaffold.yaml path selected by the
+// command's --filename or --skaffold-file flag.
+func completionSkaffoldFile(cmd *cobra.Command) string {
+	for _, name := range []string{"filename", "skaffold-file"} {
+		if f := cmd.Flags().Lookup(name); f != nil && f.Value.String() != "" {
+			return f.Value.String()
+		}
+	}
+	return "skaffold.yaml"
+}
+
+func completionArtifacts(cmd *cobra.Command) []util.Artifact {
+	artifacts, err := util.ParseSkaffoldArtifacts(completionSkaffoldFile(cmd))
+	if err != nil {
+		return nil
+	}
+	return artifacts
+}
+
+// filterCompletions keeps the unique values starting with toComplete.
+func filterCompletions(values []string, toComplete string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, v := range values {
+		if v == "" || seen[v] || !strings.HasPrefix(v, toComplete) {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	return out
+}
+
+// completeSkaffoldImages completes artifact image names from skaffold.yaml.
+func completeSkaffoldImages(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var images []string
+	for _, art := range completionArtifacts(cmd) {
+		images = append(images, art.Image)
+	}
+	return filterCompletions(images, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRunArgs completes "op run <context>" with the artifact contexts of
+// skaffold.yaml and the "context list" and "export-compose" subcommands.
+func completeRunArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch {
+	case len(args) == 1 && args[0] == "context":
+		return filterCompletions([]string{"list"}, toComplete), cobra.ShellCompDirectiveNoFileComp
+	case len(args) > 0:
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var values []string
+	for _, art := range completionArtifacts(cmd) {
+		values = append(values, art.Context)
+	}
+	values = append(values, "context", "export-compose")
+	return filterCompletions(values, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeBuildResultImages completes image names from build_result.json in
+// the command's --build-result-dir (default: current directory).
+func completeBuildResultImages(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	dir, _ := cmd.Flags().GetString("build-result-dir")
+	res, err := util.ReadBuildResult(dir)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var images []string
+	for _, b := range res.Builds {
+		images = append(images, b.ImageName)
+	}
+	return filterCompletions(images, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completionEnvironments returns the gitops environments of
+// .github/octopilot.yaml, sorted.
+func completionEnvironments() []string {
+	cwd, _ := os.Getwd()
+	cfg, err := util.LoadRunConfig(cwd)
+	if err != nil {
+		return nil
+	}
+	var envs []string
+	for name := range cfg.GitOps.Environments {
+		envs = append(envs, name)
+	}
+	sort.Strings(envs)
+	return envs
+}
+
+// completeEnvironments completes dev, pp and prod plus the environments
+// configured in .github/octopilot.yaml.
+func completeEnvironments(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	envs := append(append([]string{}, defaultEnvironments...), util.RegistryEnvironments("")...)
+	return filterCompletions(append(envs, completionEnvironments()...), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeGitOpsEnvironments completes only the environments configured under
+// gitops in .github/octopilot.yaml.
+func completeGitOpsEnvironments(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return filterCompletions(completionEnvironments(), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
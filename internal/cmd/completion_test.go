@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupCompletionDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "skaffold.yaml"), []byte(`apiVersion: skaffold/v4beta1
+kind: Config
+build:
+  artifacts:
+    - image: ghcr.io/org/api
+      context: api
+    - image: ghcr.io/org/web
+      context: web
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.BuildResultFilename), []byte(`{"builds":[{"imageName":"api","tag":"ghcr.io/org/api:v1"},{"imageName":"web","tag":"ghcr.io/org/web:v1"}]}`), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".github"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.RunConfigFilename), []byte("gitops:\n  environments:\n    staging: {}\n    dev: {}\n"), 0o644))
+	cwd, _ := os.Getwd()
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+	return dir
+}
+
+func TestCompleteSkaffoldImages(t *testing.T) {
+	setupCompletionDir(t)
+	got, directive := completeSkaffoldImages(buildCmd, nil, "ghcr.io/org/w")
+	assert.Equal(t, []string{"ghcr.io/org/web"}, got)
+	assert.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+
+	_ = buildCmd.Flags().Set("filename", "missing.yaml")
+	defer func() { _ = buildCmd.Flags().Set("filename", "skaffold.yaml") }()
+	got, _ = completeSkaffoldImages(buildCmd, nil, "")
+	assert.Empty(t, got)
+}
+
+func TestCompleteRunArgs(t *testing.T) {
+	setupCompletionDir(t)
+	got, _ := completeRunArgs(runCmd, nil, "")
+	assert.Equal(t, []string{"api", "web", "context", "export-compose"}, got)
+	got, _ = completeRunArgs(runCmd, nil, "w")
+	assert.Equal(t, []string{"web"}, got)
+	got, _ = completeRunArgs(runCmd, []string{"context"}, "")
+	assert.Equal(t, []string{"list"}, got)
+	got, _ = completeRunArgs(runCmd, []string{"api"}, "")
+	assert.Empty(t, got)
+}
+
+func TestCompleteBuildResultImages(t *testing.T) {
+	dir := setupCompletionDir(t)
+	got, _ := completeBuildResultImages(promoteCmd, nil, "")
+	assert.Equal(t, []string{"api", "web"}, got)
+
+	_ = signCmd.Flags().Set("build-result-dir", filepath.Join(dir, "none"))
+	defer func() { _ = signCmd.Flags().Set("build-result-dir", "") }()
+	got, _ = completeBuildResultImages(signCmd, nil, "")
+	assert.Empty(t, got)
+}
+
+func TestCompleteEnvironments(t *testing.T) {
+	dir := setupCompletionDir(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.RegistryFilename), []byte("environments:\n  qa: ghcr.io/org/qa\n  prod: ghcr.io/org/prod\n"), 0o644))
+	got, _ := completeEnvironments(watchCmd, nil, "")
+	assert.Equal(t, []string{"dev", "pp", "prod", "qa", "staging"}, got)
+	got, _ = completeEnvironments(watchCmd, nil, "p")
+	assert.Equal(t, []string{"pp", "prod"}, got)
+	got, _ = completeGitOpsEnvironments(gitopsUpdateCmd, nil, "")
+	assert.Equal(t, []string{"dev", "staging"}, got)
+}
+
+func TestCompletionRegistered(t *testing.T) {
+	for _, c := range []struct {
+		cmd  *cobra.Command
+		flag string
+	}{
+		{buildCmd, "artifact"},
+		{promoteCmd, "image-name"},
+		{promoteCmd, "source"},
+		{watchCmd, "environment"},
+		{gitopsUpdateCmd, "environment"},
+		{testCmd, "image-name"},
+		{diffCmd, "image-name"},
+	} {
+		_, ok := c.cmd.GetFlagCompletionFunc(c.flag)
+		assert.True(t, ok, "%s --%s", c.cmd.Name(), c.flag)
+	}
+	assert.NotNil(t, runCmd.ValidArgsFunction)
+}
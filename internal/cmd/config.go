@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// printUserConfig writes the entries of the user config as sorted key=value
+// lines.
+func printUserConfig(w io.Writer, cfg map[string]interface{}) {
+	flat := util.FlattenUserConfig(cfg)
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s=%s\n", k, util.FormatUserConfigValue(flat[k]))
+	}
+}
+
+// printUserConfigKeys writes the settings op reads from the user config.
+func printUserConfigKeys(w io.Writer) {
+	for _, k := range util.UserConfigKeys {
+		name := k.Key
+		if name == "environments." {
+			name = "environments.<name>"
+		}
+		if k.List {
+			name += " (list)"
+		}
+		fmt.Fprintf(w, "%-28s %s\n", name, k.Description)
+	}
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage user-level defaults (~/.config/octopilot/config.yaml).",
+	Long: `Read and write the user config file: $OP_USER_CONFIG, else
+$XDG_CONFIG_HOME/octopilot/config.yaml, else ~/.config/octopilot/config.yaml.
+
+Its settings are defaults for every command. Precedence, highest first:
+  1. command-line flags
+  2. environment variables (e.g. SKAFFOLD_DEFAULT_REPO)
+  3. project config (.github/octopilot.yaml, or --config)
+  4. user config
+  5. built-in defaults
+
+  op config set default_repo ghcr.io/my-org
+  op config set platforms linux/amd64,linux/arm64
+  op config set environments.prod europe-docker.pkg.dev/my-project/prod
+  op config list`,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print a value from the user config.",
+	Long: `Print the value of key in the user config. With --effective, print the value
+commands see after environment variables and the project config are applied.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeUserConfigKeys,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := args[0]
+		if _, ok := util.LookupUserConfigKey(key); !ok {
+			return fmt.Errorf("unknown config key %q (see op config list --keys)", key)
+		}
+		if effective, _ := cmd.Flags().GetBool("effective"); effective {
+			if v := viper.Get(key); v != nil {
+				fmt.Println(util.FormatUserConfigValue(v))
+			}
+			return nil
+		}
+		path, err := util.UserConfigPath()
+		if err != nil {
+			return err
+		}
+		cfg, err := util.ReadUserConfig(path)
+		if err != nil {
+			return err
+		}
+		v, ok := util.FlattenUserConfig(cfg)[key]
+		if !ok {
+			return fmt.Errorf("%s is not set in %s", key, path)
+		}
+		fmt.Println(util.FormatUserConfigValue(v))
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a value in the user config (an empty value removes it).",
+	Long: `Set key to value in the user config, creating the file if needed. List
+settings (platforms, insecure_registries, notification_urls) take a
+comma-separated value. An empty value ("") removes the key.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeUserConfigKeys,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := util.UserConfigPath()
+		if err != nil {
+			return err
+		}
+		if err := util.SetUserConfigValue(path, args[0], args[1]); err != nil {
+			return err
+		}
+		slog.Info("Updated user config", "path", path)
+		return nil
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the user config, or with --keys the supported settings.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if keys, _ := cmd.Flags().GetBool("keys"); keys {
+			printUserConfigKeys(os.Stdout)
+			return nil
+		}
+		path, err := util.UserConfigPath()
+		if err != nil {
+			return err
+		}
+		cfg, err := util.ReadUserConfig(path)
+		if err != nil {
+			return err
+		}
+		printUserConfig(os.Stdout, cfg)
+		return nil
+	},
+}
+
+// completeUserConfigKeys completes the settings op reads from the user config.
+func completeUserConfigKeys(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var keys []string
+	for _, k := range util.UserConfigKeys {
+		if !strings.HasSuffix(k.Key, ".") {
+			keys = append(keys, k.Key)
+		}
+	}
+	for _, env := range defaultEnvironments {
+		keys = append(keys, "environments."+env)
+	}
+	return filterCompletions(keys, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configGetCmd, configSetCmd, configListCmd)
+	configGetCmd.Flags().Bool("effective", false, "Print the value after environment variables and the project config are applied")
+	configListCmd.Flags().Bool("keys", false, "List the supported settings instead of the current values")
+}
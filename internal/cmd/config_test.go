@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigCmds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("OP_USER_CONFIG", path)
+
+	require.NoError(t, configSetCmd.RunE(configSetCmd, []string{"platforms", "linux/amd64,linux/arm64"}))
+	require.NoError(t, configSetCmd.RunE(configSetCmd, []string{"environments.prod", "gcr.io/prod"}))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "- linux/arm64")
+
+	var out bytes.Buffer
+	cfg := map[string]interface{}{"platforms": []interface{}{"linux/amd64", "linux/arm64"}, "environments": map[string]interface{}{"prod": "gcr.io/prod"}}
+	printUserConfig(&out, cfg)
+	assert.Equal(t, "environments.prod=gcr.io/prod\nplatforms=linux/amd64,linux/arm64\n", out.String())
+
+	require.NoError(t, configGetCmd.RunE(configGetCmd, []string{"environments.prod"}))
+	assert.ErrorContains(t, configGetCmd.RunE(configGetCmd, []string{"default_repo"}), "default_repo is not set")
+	assert.ErrorContains(t, configGetCmd.RunE(configGetCmd, []string{"nope"}), "unknown config key")
+	assert.ErrorContains(t, configSetCmd.RunE(configSetCmd, []string{"nope", "x"}), "unknown config key")
+
+	out.Reset()
+	printUserConfigKeys(&out)
+	assert.Contains(t, out.String(), "environments.<name>")
+	assert.Contains(t, out.String(), "platforms (list)")
+}
+
+func TestCompleteUserConfigKeys(t *testing.T) {
+	keys, _ := completeUserConfigKeys(configGetCmd, nil, "env")
+	assert.Equal(t, []string{"environments.dev", "environments.pp", "environments.prod"}, keys)
+	keys, _ = completeUserConfigKeys(configGetCmd, []string{"platforms"}, "")
+	assert.Empty(t, keys)
+}
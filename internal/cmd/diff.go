@@ -0,0 +1,472 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// imageSnapshot is what `op diff` compares for one image.
+type imageSnapshot struct {
+	Layers []layerInfo
+	// Files maps absolute paths in the flattened filesystem to their metadata.
+	Files map[string]fileInfo
+	// Packages maps installed OS package names (dpkg or apk) to versions.
+	Packages map[string]string
+	Config   v1.Config
+}
+
+type layerInfo struct {
+	DiffID string
+	Size   int64
+}
+
+type fileInfo struct {
+	Size int64
+	// Digest is the sha256 of a regular file's content; Link the target of a link.
+	Digest string
+	Link   string
+}
+
+// diffChange is one difference: Kind is '+' (added), '-' (removed) or '~' (changed).
+type diffChange struct {
+	Kind     byte
+	Name     string
+	Old, New string
+}
+
+func (c diffChange) String() string {
+	switch c.Kind {
+	case '+':
+		return strings.TrimSpace("+ " + c.Name + " " + c.New)
+	case '-':
+		return strings.TrimSpace("- " + c.Name + " " + c.Old)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Name, c.Old, c.New)
+}
+
+// imageDiff is the result of comparing two snapshots.
+type imageDiff struct {
+	SharedLayers int
+	Layers       []diffChange
+	Config       []diffChange
+	Packages     []diffChange
+	Files        []diffChange
+}
+
+// packageDatabases are the OS package databases read from the image
+// filesystem; dpkg status.d/ holds one file per package on distroless images.
+var packageDatabases = map[string]func([]byte, map[string]string){
+	"/var/lib/dpkg/status":   parseDpkgStatus,
+	"/var/lib/dpkg/status.d": parseDpkgStatus,
+	"/lib/apk/db/installed":  parseApkInstalled,
+}
+
+// snapshotImage reads the layers, flattened filesystem and config of img.
+func snapshotImage(img v1.Image) (*imageSnapshot, error) {
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	s := &imageSnapshot{Files: map[string]fileInfo{}, Packages: map[string]string{}, Config: cfg.Config}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range layers {
+		diffID, err := l.DiffID()
+		if err != nil {
+			return nil, err
+		}
+		size, _ := l.Size()
+		s.Layers = append(s.Layers, layerInfo{DiffID: diffID.String(), Size: size})
+	}
+
+	rc := mutate.Extract(img)
+	defer func() { _ = rc.Close() }()
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		p := path.Clean("/" + hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeSymlink, tar.TypeLink:
+			s.Files[p] = fileInfo{Link: hdr.Linkname}
+		case tar.TypeReg:
+			parse := packageDatabases[p]
+			if parse == nil {
+				parse = packageDatabases[path.Dir(p)]
+			}
+			h := sha256.New()
+			var db bytes.Buffer
+			w := io.Writer(h)
+			if parse != nil {
+				w = io.MultiWriter(h, &db)
+			}
+			if _, err := io.Copy(w, tr); err != nil {
+				return nil, err
+			}
+			s.Files[p] = fileInfo{Size: hdr.Size, Digest: hex.EncodeToString(h.Sum(nil))}
+			if parse != nil {
+				parse(db.Bytes(), s.Packages)
+			}
+		}
+	}
+}
+
+// parseDpkgStatus adds the installed packages of a dpkg status file to pkgs.
+func parseDpkgStatus(data []byte, pkgs map[string]string) {
+	var pkg, version, status string
+	flush := func() {
+		if pkg != "" && (status == "" || strings.HasSuffix(status, " installed")) {
+			pkgs[pkg] = version
+		}
+		pkg, version, status = "", "", ""
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(line, " ") {
+			continue
+		}
+		switch k {
+		case "Package":
+			pkg = strings.TrimSpace(v)
+		case "Version":
+			version = strings.TrimSpace(v)
+		case "Status":
+			status = strings.TrimSpace(v)
+		}
+	}
+	flush()
+}
+
+// parseApkInstalled adds the packages of an Alpine apk database to pkgs.
+func parseApkInstalled(data []byte, pkgs map[string]string) {
+	var pkg, version string
+	for _, line := range append(strings.Split(string(data), "\n"), "") {
+		switch {
+		case line == "":
+			if pkg != "" {
+				pkgs[pkg] = version
+			}
+			pkg, version = "", ""
+		case strings.HasPrefix(line, "P:"):
+			pkg = line[2:]
+		case strings.HasPrefix(line, "V:"):
+			version = line[2:]
+		}
+	}
+}
+
+// diffImages compares two snapshots.
+func diffImages(a, b *imageSnapshot) imageDiff {
+	d := imageDiff{}
+	d.SharedLayers, d.Layers = diffLayers(a.Layers, b.Layers)
+	d.Config = diffConfig(a.Config, b.Config)
+	d.Packages = diffStringMaps("", a.Packages, b.Packages)
+	d.Files = diffFiles(a.Files, b.Files)
+	return d
+}
+
+// diffLayers returns the number of layers both images start with and the
+// layers only in a (removed) or only in b (added).
+func diffLayers(a, b []layerInfo) (int, []diffChange) {
+	shared := 0
+	for shared < len(a) && shared < len(b) && a[shared].DiffID == b[shared].DiffID {
+		shared++
+	}
+	var changes []diffChange
+	for _, l := range a[shared:] {
+		changes = append(changes, diffChange{Kind: '-', Name: l.DiffID, Old: humanSize(l.Size)})
+	}
+	for _, l := range b[shared:] {
+		changes = append(changes, diffChange{Kind: '+', Name: l.DiffID, New: humanSize(l.Size)})
+	}
+	return shared, changes
+}
+
+// diffConfig compares env, entrypoint, cmd, user, workdir, exposed ports and labels.
+func diffConfig(a, b v1.Config) []diffChange {
+	var changes []diffChange
+	changes = append(changes, diffStringMaps("env ", envMap(a.Env), envMap(b.Env))...)
+	for _, f := range []struct {
+		name     string
+		old, new []string
+	}{
+		{"entrypoint", a.Entrypoint, b.Entrypoint},
+		{"cmd", a.Cmd, b.Cmd},
+		{"user", []string{a.User}, []string{b.User}},
+		{"workdir", []string{a.WorkingDir}, []string{b.WorkingDir}},
+		{"exposed ports", sortedKeys(a.ExposedPorts), sortedKeys(b.ExposedPorts)},
+	} {
+		if strings.Join(f.old, "\x00") != strings.Join(f.new, "\x00") {
+			changes = append(changes, diffChange{Kind: '~', Name: f.name, Old: fmt.Sprintf("%q", f.old), New: fmt.Sprintf("%q", f.new)})
+		}
+	}
+	for _, c := range diffStringMaps("label ", a.Labels, b.Labels) {
+		c.Old, c.New = truncate(c.Old, 60), truncate(c.New, 60)
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// diffStringMaps returns the added, removed and changed keys, sorted, with
+// prefix prepended to the names.
+func diffStringMaps(prefix string, a, b map[string]string) []diffChange {
+	var changes []diffChange
+	for k, old := range a {
+		if cur, ok := b[k]; !ok {
+			changes = append(changes, diffChange{Kind: '-', Name: prefix + k, Old: old})
+		} else if cur != old {
+			changes = append(changes, diffChange{Kind: '~', Name: prefix + k, Old: old, New: cur})
+		}
+	}
+	for k, cur := range b {
+		if _, ok := a[k]; !ok {
+			changes = append(changes, diffChange{Kind: '+', Name: prefix + k, New: cur})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// diffFiles returns the added, removed and changed (content or link target) paths, sorted.
+func diffFiles(a, b map[string]fileInfo) []diffChange {
+	describe := func(f fileInfo) string {
+		if f.Link != "" {
+			return "-> " + f.Link
+		}
+		return humanSize(f.Size)
+	}
+	var changes []diffChange
+	for p, old := range a {
+		if cur, ok := b[p]; !ok {
+			changes = append(changes, diffChange{Kind: '-', Name: p, Old: describe(old)})
+		} else if cur != old {
+			changes = append(changes, diffChange{Kind: '~', Name: p, Old: describe(old), New: describe(cur)})
+		}
+	}
+	for p, cur := range b {
+		if _, ok := a[p]; !ok {
+			changes = append(changes, diffChange{Kind: '+', Name: p, New: describe(cur)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+func envMap(env []string) map[string]string {
+	m := map[string]string{}
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		m[k] = v
+	}
+	return m
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// humanSize formats n bytes as B, KiB, MiB or GiB.
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit && exp < 2; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMG"[exp])
+}
+
+// printImageDiff writes d to w, listing at most maxFiles file changes (0 for all).
+func printImageDiff(w io.Writer, d imageDiff, maxFiles int) {
+	counts := func(changes []diffChange) string {
+		n := map[byte]int{}
+		for _, c := range changes {
+			n[c.Kind]++
+		}
+		return fmt.Sprintf("%d added, %d removed, %d changed", n['+'], n['-'], n['~'])
+	}
+	section := func(title string, changes []diffChange, limit int) {
+		fmt.Fprintf(w, "%s: %s\n", title, counts(changes))
+		for i, c := range changes {
+			if limit > 0 && i == limit {
+				fmt.Fprintf(w, "  ... %d more (use --max-files 0 to list all)\n", len(changes)-limit)
+				break
+			}
+			fmt.Fprintf(w, "  %s\n", c)
+		}
+	}
+	fmt.Fprintf(w, "Layers: %d shared, %s\n", d.SharedLayers, counts(d.Layers))
+	for _, c := range d.Layers {
+		fmt.Fprintf(w, "  %s\n", c)
+	}
+	section("Config", d.Config, 0)
+	section("Packages", d.Packages, 0)
+	section("Files", d.Files, maxFiles)
+}
+
+// diffDeploymentImages returns the container images of a Deployment. It is a
+// var so tests can replace it.
+var diffDeploymentImages = func(ctx context.Context, namespace, deployment string) ([]string, error) {
+	out, err := exec.CommandContext(ctx,
+		"kubectl", "-n", namespace,
+		"get", "deployment", deployment,
+		"-o", `jsonpath={range .spec.template.spec.containers[*]}{.image}{"\n"}{end}`,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("reading deployment %s/%s: %w", namespace, deployment, err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// deployedImage picks the image of a Deployment that has the same repository
+// as ref, falling back to the first container.
+func deployedImage(images []string, ref string) (string, error) {
+	if len(images) == 0 {
+		return "", fmt.Errorf("deployment has no containers")
+	}
+	want, err := name.ParseReference(ref, name.WeakValidation)
+	if err != nil {
+		return "", err
+	}
+	for _, img := range images {
+		if r, err := name.ParseReference(img, name.WeakValidation); err == nil && r.Context() == want.Context() {
+			return img, nil
+		}
+	}
+	return images[0], nil
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [old-ref] [new-ref]",
+	Short: "Show what changed between two images: layers, config, packages and files.",
+	Long: `Compare two images read from the registry and report layer, config
+(env, entrypoint, cmd, user, workdir, ports, labels), OS package (dpkg, apk)
+and file differences, to answer "what actually changed?" before promoting.
+
+The new image defaults to the one in build_result.json (--image-name, default
+the last entry). The old image is the first argument or, with --deployment,
+the image currently running in that Deployment (read with kubectl):
+
+  op diff ghcr.io/my-org/my-app:1.2.3 ghcr.io/my-org/my-app:1.3.0
+  op diff ghcr.io/my-org/my-app:1.2.3          # vs build_result.json
+  op diff --deployment my-app -n production    # deployed vs build_result.json`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deployment, _ := cmd.Flags().GetString("deployment")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		imageName, _ := cmd.Flags().GetString("image-name")
+		maxFiles, _ := cmd.Flags().GetInt("max-files")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+
+		var oldRef, newRef string
+		switch {
+		case len(args) == 2:
+			oldRef, newRef = args[0], args[1]
+		case len(args) == 1 && deployment == "":
+			oldRef = args[0]
+		case len(args) == 0 && deployment != "":
+		default:
+			return fmt.Errorf("give an old image ref or --deployment (and optionally a new image ref)")
+		}
+		if newRef == "" {
+			res, err := util.ReadBuildResult(buildResultDir)
+			if err != nil {
+				return err
+			}
+			if newRef, err = util.SelectTag(res, imageName); err != nil {
+				return err
+			}
+		}
+		if oldRef == "" {
+			images, err := diffDeploymentImages(cmd.Context(), namespace, deployment)
+			if err != nil {
+				return err
+			}
+			if oldRef, err = deployedImage(images, newRef); err != nil {
+				return fmt.Errorf("deployment %s/%s: %w", namespace, deployment, err)
+			}
+		}
+
+		insecure := insecureRegistries(insecureFlag)
+		var snapshots []*imageSnapshot
+		for _, ref := range []string{oldRef, newRef} {
+			parsed, err := parseReferenceForRemote(ref, insecure)
+			if err != nil {
+				return fmt.Errorf("parsing %s: %w", ref, err)
+			}
+			img, err := remoteImage(parsed, remoteOptionsFor(cmd.Context(), ref, insecure)...)
+			if err != nil {
+				return fmt.Errorf("fetching %s: %w", ref, err)
+			}
+			slog.Info("Reading image", util.LogKeyTag, ref)
+			s, err := snapshotImage(img)
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", ref, err)
+			}
+			snapshots = append(snapshots, s)
+		}
+
+		fmt.Printf("old: %s\nnew: %s\n\n", oldRef, newRef)
+		printImageDiff(os.Stdout, diffImages(snapshots[0], snapshots[1]), maxFiles)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().String("deployment", "", "Use the image running in this Deployment as the old image")
+	diffCmd.Flags().StringP("namespace", "n", "default", "Kubernetes namespace of --deployment")
+	diffCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json, used when no new ref is given")
+	diffCmd.Flags().String("image-name", "", "Artifact to compare from build_result.json (default: last entry)")
+	_ = diffCmd.RegisterFlagCompletionFunc("image-name", completeBuildResultImages)
+	diffCmd.Flags().Int("max-files", 100, "Maximum number of file changes to list (0 for all)")
+	diffCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+}
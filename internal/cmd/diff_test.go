@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDpkgStatus = `Package: libc6
+Status: install ok installed
+Version: 2.36-9
+Description: GNU C Library
+ multi-line description: with a colon
+
+Package: removed-pkg
+Status: deinstall ok config-files
+Version: 1.0
+
+Package: openssl
+Status: install ok installed
+Version: 3.0.11-1
+`
+
+func diffTestImage(t *testing.T, files map[string][]byte, env ...string) v1.Image {
+	t.Helper()
+	base, err := crane.Layer(map[string][]byte{"var/lib/dpkg/status": []byte(testDpkgStatus)})
+	require.NoError(t, err)
+	app, err := crane.Layer(files)
+	require.NoError(t, err)
+	img, err := mutate.AppendLayers(empty.Image, base, app)
+	require.NoError(t, err)
+	cfg, err := img.ConfigFile()
+	require.NoError(t, err)
+	cfg.Config.Env = env
+	img, err = mutate.ConfigFile(img, cfg)
+	require.NoError(t, err)
+	return img
+}
+
+func TestParseDpkgStatus(t *testing.T) {
+	pkgs := map[string]string{}
+	parseDpkgStatus([]byte(testDpkgStatus), pkgs)
+	assert.Equal(t, map[string]string{"libc6": "2.36-9", "openssl": "3.0.11-1"}, pkgs)
+}
+
+func TestParseApkInstalled(t *testing.T) {
+	pkgs := map[string]string{}
+	parseApkInstalled([]byte("C:Q1abc\nP:musl\nV:1.2.4-r2\nA:x86_64\n\nP:busybox\nV:1.36.1-r5\n"), pkgs)
+	assert.Equal(t, map[string]string{"musl": "1.2.4-r2", "busybox": "1.36.1-r5"}, pkgs)
+}
+
+func TestSnapshotImage(t *testing.T) {
+	img := diffTestImage(t, map[string][]byte{"workspace/bin/app": []byte("v1")}, "PORT=8080")
+	s, err := snapshotImage(img)
+	require.NoError(t, err)
+	assert.Len(t, s.Layers, 2)
+	assert.Equal(t, int64(2), s.Files["/workspace/bin/app"].Size)
+	assert.Equal(t, "2.36-9", s.Packages["libc6"])
+	assert.Equal(t, []string{"PORT=8080"}, s.Config.Env)
+}
+
+func TestDiffImages(t *testing.T) {
+	oldImg := diffTestImage(t, map[string][]byte{"workspace/bin/app": []byte("v1"), "workspace/old.txt": []byte("x")}, "PORT=8080", "MODE=a")
+	newImg := diffTestImage(t, map[string][]byte{"workspace/bin/app": []byte("v2.0"), "workspace/new.txt": []byte("y")}, "PORT=9090", "DEBUG=1")
+	a, err := snapshotImage(oldImg)
+	require.NoError(t, err)
+	b, err := snapshotImage(newImg)
+	require.NoError(t, err)
+
+	d := diffImages(a, b)
+	assert.Equal(t, 1, d.SharedLayers)
+	require.Len(t, d.Layers, 2)
+	assert.Equal(t, byte('-'), d.Layers[0].Kind)
+	assert.Equal(t, byte('+'), d.Layers[1].Kind)
+	assert.Equal(t, []diffChange{
+		{Kind: '+', Name: "env DEBUG", New: "1"},
+		{Kind: '-', Name: "env MODE", Old: "a"},
+		{Kind: '~', Name: "env PORT", Old: "8080", New: "9090"},
+	}, d.Config)
+	assert.Empty(t, d.Packages)
+	assert.Equal(t, []diffChange{
+		{Kind: '~', Name: "/workspace/bin/app", Old: "2 B", New: "4 B"},
+		{Kind: '+', Name: "/workspace/new.txt", New: "1 B"},
+		{Kind: '-', Name: "/workspace/old.txt", Old: "1 B"},
+	}, d.Files)
+}
+
+func TestDiffConfig(t *testing.T) {
+	changes := diffConfig(
+		v1.Config{Entrypoint: []string{"/cnb/process/web"}, User: "1000", ExposedPorts: map[string]struct{}{"8080/tcp": {}}},
+		v1.Config{Entrypoint: []string{"/app"}, User: "1000", ExposedPorts: map[string]struct{}{"8080/tcp": {}, "9090/tcp": {}}, Labels: map[string]string{"version": "1.3.0"}},
+	)
+	assert.Equal(t, []diffChange{
+		{Kind: '~', Name: "entrypoint", Old: `["/cnb/process/web"]`, New: `["/app"]`},
+		{Kind: '~', Name: "exposed ports", Old: `["8080/tcp"]`, New: `["8080/tcp" "9090/tcp"]`},
+		{Kind: '+', Name: "label version", New: "1.3.0"},
+	}, changes)
+}
+
+func TestHumanSize(t *testing.T) {
+	assert.Equal(t, "512 B", humanSize(512))
+	assert.Equal(t, "1.5 KiB", humanSize(1536))
+	assert.Equal(t, "2.0 MiB", humanSize(2*1024*1024))
+	assert.Equal(t, "3.0 GiB", humanSize(3*1024*1024*1024))
+}
+
+func TestDeployedImage(t *testing.T) {
+	images := []string{"ghcr.io/org/sidecar:1.0", "ghcr.io/org/app:1.2.3"}
+	img, err := deployedImage(images, "ghcr.io/org/app:1.3.0@"+testDigest)
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/org/app:1.2.3", img)
+
+	img, err = deployedImage(images, "ghcr.io/org/other:1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/org/sidecar:1.0", img)
+
+	_, err = deployedImage(nil, "ghcr.io/org/app:1.0")
+	assert.Error(t, err)
+}
+
+func TestPrintImageDiff_LimitsFiles(t *testing.T) {
+	var buf bytes.Buffer
+	printImageDiff(&buf, imageDiff{
+		SharedLayers: 3,
+		Files:        []diffChange{{Kind: '+', Name: "/a", New: "1 B"}, {Kind: '+', Name: "/b", New: "1 B"}},
+	}, 1)
+	assert.Equal(t, `Layers: 3 shared, 0 added, 0 removed, 0 changed
+Config: 0 added, 0 removed, 0 changed
+Packages: 0 added, 0 removed, 0 changed
+Files: 2 added, 0 removed, 0 changed
+  + /a 1 B
+  ... 1 more (use --max-files 0 to list all)
+`, buf.String())
+}
@@ -0,0 +1,333 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// doctorProbeRepo is the repository the push/pull check writes its test image to.
+const doctorProbeRepo = "octopilot-doctor"
+
+// Doctor check results.
+const (
+	doctorOK   = "ok"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+	doctorSkip = "skip"
+)
+
+// doctorCheck is one line of `op doctor` output; Fix is printed for failures and warnings.
+type doctorCheck struct {
+	Name   string
+	Status string
+	Detail string
+	Fix    string
+}
+
+// dockerInfoIndexConfigs returns the daemon's per-registry config
+// (docker info .RegistryConfig.IndexConfigs). A var so tests can replace it.
+var dockerInfoIndexConfigs = func(ctx context.Context) (string, error) {
+	out, err := registryDockerOutput(ctx, "info", "--format", "{{json .RegistryConfig.IndexConfigs}}")
+	if err != nil {
+		return "", fmt.Errorf("%s info: %s", util.ContainerCLI(), out)
+	}
+	return out, nil
+}
+
+// registryHost returns the registry part of a repo ("localhost:5001/team" → "localhost:5001").
+func registryHost(repo string) string {
+	host, _, _ := strings.Cut(repo, "/")
+	return host
+}
+
+// checkRegistryTLS performs a TLS handshake with hostPort, verifying against pool.
+func checkRegistryTLS(hostPort string, pool *x509.CertPool) doctorCheck {
+	c := doctorCheck{Name: "TLS handshake"}
+	host, _, _ := net.SplitHostPort(hostPort)
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", hostPort,
+		&tls.Config{RootCAs: pool, ServerName: host})
+	if err != nil {
+		c.Status, c.Detail = doctorFail, err.Error()
+		var unknownCA x509.UnknownAuthorityError
+		switch {
+		case errors.As(err, &unknownCA):
+			c.Fix = "pass the registry CA with --ca, or run op start-registry --trust"
+		case errors.Is(err, os.ErrDeadlineExceeded), strings.Contains(err.Error(), "connection refused"):
+			c.Fix = "start the registry (op start-registry) or check --registry-host/--registry-port"
+		}
+		return c
+	}
+	defer func() { _ = conn.Close() }()
+	cert := conn.ConnectionState().PeerCertificates[0]
+	c.Status = doctorOK
+	c.Detail = fmt.Sprintf("%s verified (expires %s)", hostPort, cert.NotAfter.Format(time.DateOnly))
+	if time.Until(cert.NotAfter) < 30*24*time.Hour {
+		c.Status = doctorWarn
+		c.Fix = "run op registry rotate-certs"
+	}
+	return c
+}
+
+// checkRegistryAuth pings the registry and obtains a push token for repo
+// with the credentials from util.Keychain.
+func checkRegistryAuth(ctx context.Context, repo name.Repository, rt http.RoundTripper) doctorCheck {
+	c := doctorCheck{Name: "Authentication"}
+	auth, err := util.Keychain().Resolve(repo)
+	if err != nil {
+		c.Status, c.Detail = doctorFail, err.Error()
+		return c
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	if _, err := transport.NewWithContext(ctx, repo.Registry, auth, rt, []string{repo.Scope(transport.PushScope)}); err != nil {
+		c.Status, c.Detail = doctorFail, err.Error()
+		c.Fix = fmt.Sprintf("run docker login %s (or op start-registry --auth user:password for the local registry)", repo.RegistryStr())
+		return c
+	}
+	c.Status = doctorOK
+	if auth == authn.Anonymous {
+		c.Detail = "anonymous access accepted"
+	} else if _, ok := util.RegistryOIDCConfig("", repo.String()); ok {
+		c.Detail = "credentials from OIDC federation accepted"
+	} else {
+		c.Detail = "credentials from the Docker config accepted"
+	}
+	return c
+}
+
+// checkRegistryPushPull pushes a tiny random image to repo and pulls it back.
+func checkRegistryPushPull(repo name.Repository, opts ...remote.Option) doctorCheck {
+	c := doctorCheck{Name: "Push/pull"}
+	img, err := random.Image(256, 1)
+	if err != nil {
+		c.Status, c.Detail = doctorFail, err.Error()
+		return c
+	}
+	tag := repo.Tag("probe")
+	if err := remote.Write(tag, img, opts...); err != nil {
+		c.Status, c.Detail = doctorFail, "push: "+err.Error()
+		c.Fix = "check that the credentials can push to " + repo.String()
+		return c
+	}
+	want, _ := img.Digest()
+	pulled, err := remote.Image(tag, opts...)
+	if err != nil {
+		c.Status, c.Detail = doctorFail, "pull: "+err.Error()
+		return c
+	}
+	if got, _ := pulled.Digest(); got != want {
+		c.Status, c.Detail = doctorFail, fmt.Sprintf("pulled digest %s, pushed %s", got, want)
+		return c
+	}
+	c.Status, c.Detail = doctorOK, fmt.Sprintf("%s (%s)", tag, want)
+	return c
+}
+
+// checkDaemonInsecure reports whether the container daemon treats host as an
+// insecure registry. That is only a problem when TLS cannot be verified.
+func checkDaemonInsecure(ctx context.Context, host string, tlsVerified bool) doctorCheck {
+	c := doctorCheck{Name: "Daemon config"}
+	out, err := dockerInfoIndexConfigs(ctx)
+	if err != nil {
+		c.Status, c.Detail = doctorSkip, err.Error()
+		return c
+	}
+	var configs map[string]struct{ Secure bool }
+	if err := json.Unmarshal([]byte(out), &configs); err != nil {
+		c.Status, c.Detail = doctorSkip, "unexpected docker info output"
+		return c
+	}
+	if cfg, ok := configs[host]; ok && !cfg.Secure {
+		c.Status, c.Detail = doctorOK, host+" is in the daemon's insecure-registries"
+		return c
+	}
+	if tlsVerified {
+		c.Status, c.Detail = doctorOK, "daemon verifies TLS for "+host
+		return c
+	}
+	c.Status, c.Detail = doctorFail, host+" is not trusted and not in the daemon's insecure-registries"
+	c.Fix = fmt.Sprintf("run op start-registry --trust, or add %q to insecure-registries in the daemon config", host)
+	return c
+}
+
+// checkHostTrust reports whether the registry CA was installed in the host trust store.
+func checkHostTrust(ctx context.Context, caPath string) doctorCheck {
+	c := doctorCheck{Name: "Host trust"}
+	if util.IsHostTrusted(ctx, caPath) {
+		c.Status, c.Detail = doctorOK, caPath+" installed"
+		return c
+	}
+	c.Status, c.Detail = doctorWarn, caPath+" not installed by op start-registry --trust"
+	c.Fix = "run op start-registry --trust"
+	return c
+}
+
+// checkVMTrust compares the CA installed in the container VM for hostPort with caPath.
+func checkVMTrust(ctx context.Context, caPath, hostPort, vm, instance string) doctorCheck {
+	c := doctorCheck{Name: "VM trust"}
+	if vm == util.VMNone || vm == "" {
+		c.Status, c.Detail = doctorSkip, "no container VM detected"
+		return c
+	}
+	want, err := os.ReadFile(caPath)
+	if err != nil {
+		c.Status, c.Detail = doctorFail, err.Error()
+		return c
+	}
+	got, err := util.ReadVMTrust(ctx, vm, instance, hostPort)
+	switch {
+	case err != nil:
+		c.Status, c.Detail = doctorFail, fmt.Sprintf("%s: no CA for %s", vm, hostPort)
+		c.Fix = "run op start-registry --trust (or --trust-vm " + vm + ")"
+	case !bytes.Equal(bytes.TrimSpace(got), bytes.TrimSpace(want)):
+		c.Status, c.Detail = doctorFail, fmt.Sprintf("%s: CA for %s differs from %s (stale after a restart or rotation?)", vm, hostPort, caPath)
+		c.Fix = "run op start-registry --trust (or --trust-vm " + vm + ")"
+	default:
+		c.Status, c.Detail = doctorOK, fmt.Sprintf("%s trusts %s", vm, hostPort)
+	}
+	return c
+}
+
+// registryDoctorOptions configures the registry checks of `op doctor`.
+type registryDoctorOptions struct {
+	Repo     string
+	CAPath   string
+	SkipPush bool
+	// Local enables the host and VM trust checks for the local registry.
+	Local bool
+}
+
+// runRegistryDoctor runs the registry checks in order, skipping those that
+// cannot succeed after an earlier failure.
+func runRegistryDoctor(ctx context.Context, o registryDoctorOptions) []doctorCheck {
+	host := registryHost(o.Repo)
+	var checks []doctorCheck
+
+	pool, err := util.RegistryCertPool(o.CAPath)
+	if err != nil {
+		return append(checks, doctorCheck{Name: "Registry CA", Status: doctorFail, Detail: err.Error(),
+			Fix: "pass the registry CA with --ca (op start-registry copies it to ~/.config/registry-tls/certs)"})
+	}
+	tlsCheck := checkRegistryTLS(host, pool)
+	checks = append(checks, tlsCheck)
+	checks = append(checks, checkDaemonInsecure(ctx, host, tlsCheck.Status != doctorFail))
+	if o.Local && o.CAPath != "" {
+		checks = append(checks, checkHostTrust(ctx, o.CAPath))
+		vm, instance := util.DetectContainerVM()
+		checks = append(checks, checkVMTrust(ctx, o.CAPath, host, vm, instance))
+	}
+	if tlsCheck.Status == doctorFail {
+		return append(checks,
+			doctorCheck{Name: "Authentication", Status: doctorSkip, Detail: "TLS handshake failed"},
+			doctorCheck{Name: "Push/pull", Status: doctorSkip, Detail: "TLS handshake failed"})
+	}
+
+	repo, err := name.NewRepository(strings.TrimSuffix(o.Repo, "/") + "/" + doctorProbeRepo)
+	if err != nil {
+		return append(checks, doctorCheck{Name: "Authentication", Status: doctorFail, Detail: err.Error()})
+	}
+	rt := util.RegistryHTTPTransport(false).Clone()
+	rt.TLSClientConfig = &tls.Config{RootCAs: pool}
+	authCheck := checkRegistryAuth(ctx, repo, rt)
+	checks = append(checks, authCheck)
+	switch {
+	case o.SkipPush:
+		checks = append(checks, doctorCheck{Name: "Push/pull", Status: doctorSkip, Detail: "--skip-push"})
+	case authCheck.Status == doctorFail:
+		checks = append(checks, doctorCheck{Name: "Push/pull", Status: doctorSkip, Detail: "authentication failed"})
+	default:
+		checks = append(checks, checkRegistryPushPull(repo,
+			remote.WithContext(ctx), remote.WithTransport(rt), remote.WithAuthFromKeychain(util.Keychain())))
+	}
+	return checks
+}
+
+// printDoctorChecks prints checks and returns how many failed.
+func printDoctorChecks(checks []doctorCheck) int {
+	failed := 0
+	for _, c := range checks {
+		fmt.Printf("[%-4s] %-15s %s\n", c.Status, c.Name, c.Detail)
+		if c.Fix != "" && (c.Status == doctorFail || c.Status == doctorWarn) {
+			fmt.Printf("       %-15s fix: %s\n", "", c.Fix)
+		}
+		if c.Status == doctorFail {
+			failed++
+		}
+	}
+	return failed
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check registry connectivity, trust and credentials.",
+	Long: `Check that the registry builds push to is usable from this machine:
+
+  TLS handshake   verified against the system roots plus --ca
+  Daemon config   whether the daemon lists it in insecure-registries
+  Host/VM trust   local registry only: the CA installed by op start-registry
+                  --trust on the host and in the Colima, Rancher Desktop,
+                  Lima or Docker Desktop VM
+  Authentication  a push token with the Docker config credentials
+  Push/pull       a tiny test image (octopilot-doctor:probe)
+
+The registry is --registry, else the default repo (SKAFFOLD_DEFAULT_REPO,
+default_repo, .registry, then the local registry). For the local registry
+--ca defaults to ~/.config/registry-tls/certs/tls.crt, else to --registry-ca. Each failure is
+printed with a suggested fix; the command exits non-zero if any check fails.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cwd, _ := os.Getwd()
+		o := registryDoctorOptions{}
+		o.Repo, _ = cmd.Flags().GetString("registry")
+		o.CAPath, _ = cmd.Flags().GetString("ca")
+		o.SkipPush, _ = cmd.Flags().GetBool("skip-push")
+		if o.Repo == "" {
+			var err error
+			if o.Repo, err = util.ResolveDefaultRepo(cwd); err != nil {
+				return err
+			}
+		}
+		o.Local = util.ResolveLocalRegistry(cwd).Matches(o.Repo)
+		if o.CAPath == "" && o.Local {
+			crt := filepath.Join(defaultRegistryConfigDir(), "certs", "tls.crt")
+			if _, err := os.Stat(crt); err == nil {
+				o.CAPath = crt
+			}
+		}
+		if o.CAPath == "" {
+			o.CAPath = util.RegistryCAPath()
+		}
+
+		fmt.Printf("Registry: %s\n", o.Repo)
+		if failed := printDoctorChecks(runRegistryDoctor(cmd.Context(), o)); failed > 0 {
+			return fmt.Errorf("%d check(s) failed", failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().String("registry", "", "Registry or repo to check (default: the resolved default repo)")
+	doctorCmd.Flags().String("ca", "", "CA certificate to verify the registry with (default for the local registry: ~/.config/registry-tls/certs/tls.crt)")
+	doctorCmd.Flags().Bool("skip-push", false, "Skip pushing and pulling the test image")
+}
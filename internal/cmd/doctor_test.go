@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestTLSRegistry serves an in-memory registry over TLS and returns its
+// host:port and the path of its CA.
+func startTestTLSRegistry(t *testing.T) (string, string) {
+	t.Helper()
+	srv := httptest.NewTLSServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(srv.Close)
+	ca := filepath.Join(t.TempDir(), "tls.crt")
+	require.NoError(t, os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o644))
+	return strings.TrimPrefix(srv.URL, "https://"), ca
+}
+
+func stubDockerInfo(t *testing.T, out string) {
+	t.Helper()
+	old := dockerInfoIndexConfigs
+	dockerInfoIndexConfigs = func(context.Context) (string, error) { return out, nil }
+	t.Cleanup(func() { dockerInfoIndexConfigs = old })
+}
+
+func checkStatuses(checks []doctorCheck) map[string]string {
+	statuses := map[string]string{}
+	for _, c := range checks {
+		statuses[c.Name] = c.Status
+	}
+	return statuses
+}
+
+func TestRegistryHost(t *testing.T) {
+	assert.Equal(t, "localhost:5001", registryHost("localhost:5001"))
+	assert.Equal(t, "ghcr.io", registryHost("ghcr.io/octopilot/app"))
+}
+
+func TestRunRegistryDoctor(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	host, ca := startTestTLSRegistry(t)
+	stubDockerInfo(t, `{"docker.io":{"Secure":true}}`)
+
+	checks := runRegistryDoctor(t.Context(), registryDoctorOptions{Repo: host, CAPath: ca})
+	assert.Equal(t, map[string]string{
+		"TLS handshake":  doctorOK,
+		"Daemon config":  doctorOK,
+		"Authentication": doctorOK,
+		"Push/pull":      doctorOK,
+	}, checkStatuses(checks))
+	assert.Equal(t, 0, printDoctorChecks(checks))
+}
+
+func TestRunRegistryDoctor_UntrustedCA(t *testing.T) {
+	host, _ := startTestTLSRegistry(t)
+	stubDockerInfo(t, `{}`)
+
+	checks := runRegistryDoctor(t.Context(), registryDoctorOptions{Repo: host})
+	statuses := checkStatuses(checks)
+	assert.Equal(t, doctorFail, statuses["TLS handshake"])
+	assert.Equal(t, doctorFail, statuses["Daemon config"])
+	assert.Equal(t, doctorSkip, statuses["Push/pull"])
+	assert.Contains(t, checks[0].Fix, "--ca")
+	assert.Contains(t, checks[1].Fix, "insecure-registries")
+}
+
+func TestCheckDaemonInsecure(t *testing.T) {
+	stubDockerInfo(t, `{"localhost:5001":{"Secure":false}}`)
+	c := checkDaemonInsecure(t.Context(), "localhost:5001", false)
+	assert.Equal(t, doctorOK, c.Status)
+	assert.Contains(t, c.Detail, "insecure-registries")
+}
+
+func TestCheckVMTrust(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	_, ca := startTestTLSRegistry(t)
+
+	c := checkVMTrust(t.Context(), ca, "localhost:5001", "docker-desktop", "")
+	assert.Equal(t, doctorFail, c.Status)
+	assert.Contains(t, c.Fix, "--trust")
+
+	dir := filepath.Join(home, ".docker", "certs.d", "localhost:5001")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	data, err := os.ReadFile(ca)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ca.crt"), data, 0o644))
+	assert.Equal(t, doctorOK, checkVMTrust(t.Context(), ca, "localhost:5001", "docker-desktop", "").Status)
+
+	assert.Equal(t, doctorSkip, checkVMTrust(t.Context(), ca, "localhost:5001", "none", "").Status)
+}
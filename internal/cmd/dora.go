@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+)
+
+// imageCommitTime returns the commit time op build stamped on the image ref
+// (its org.opencontainers.image.created label; see gitOCILabels). It is a
+// var so tests can replace it.
+var imageCommitTime = func(ctx context.Context, ref string) (time.Time, error) {
+	insecure := insecureRegistries("")
+	r, err := parseReferenceForRemote(ref, insecure)
+	if err != nil {
+		return time.Time{}, err
+	}
+	img, err := remote.Image(r, remoteOptionsFor(ctx, ref, insecure)...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return time.Time{}, err
+	}
+	created := cfg.Config.Labels[ociCreatedLabel]
+	if created == "" {
+		return time.Time{}, fmt.Errorf("%s has no %s label", ref, ociCreatedLabel)
+	}
+	return time.Parse(time.RFC3339, created)
+}
+
+// deploymentCommitTime returns the commit time of the image ref: its OCI
+// label, else the time of the checked-out HEAD commit (zero when neither is
+// known).
+func deploymentCommitTime(ctx context.Context, ref string) time.Time {
+	t, err := imageCommitTime(ctx, ref)
+	if err == nil {
+		return t
+	}
+	slog.Debug("No commit time on the image; using HEAD", util.LogKeyTag, ref, "error", err)
+	out, err := gitRun(ctx, "", "log", "-1", "--format=%cI", "HEAD")
+	if err != nil {
+		return time.Time{}
+	}
+	t, _ = time.Parse(time.RFC3339, strings.TrimSpace(out))
+	return t
+}
+
+// recordDeployment records the completed rollout of ref for the DORA
+// metrics (see util.RecordDeployment), when metrics are exported.
+func recordDeployment(ctx context.Context, component, environment, ref string, deployedAt time.Time) {
+	if !util.MetricsEnabled() {
+		return
+	}
+	var leadTime time.Duration
+	if committed := deploymentCommitTime(ctx, ref); !committed.IsZero() {
+		leadTime = deployedAt.Sub(committed)
+	}
+	util.RecordDeployment(component, environment, leadTime)
+}
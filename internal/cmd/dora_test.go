@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func stubCommitTimes(t *testing.T, image, head string) {
+	t.Helper()
+	origImage, origGit := imageCommitTime, gitRun
+	t.Cleanup(func() { imageCommitTime, gitRun = origImage, origGit })
+	imageCommitTime = func(context.Context, string) (time.Time, error) {
+		if image == "" {
+			return time.Time{}, errors.New("no label")
+		}
+		return time.Parse(time.RFC3339, image)
+	}
+	gitRun = func(_ context.Context, _ string, args ...string) (string, error) {
+		assert.Equal(t, []string{"log", "-1", "--format=%cI", "HEAD"}, args)
+		if head == "" {
+			return "fatal: not a git repository", errors.New("exit status 128")
+		}
+		return head + "\n", nil
+	}
+}
+
+func TestDeploymentCommitTime(t *testing.T) {
+	const ref = "ghcr.io/acme/api:v1.2.0@sha256:bbb"
+	stubCommitTimes(t, "2026-10-16T08:00:00Z", "2026-10-16T09:30:00+02:00")
+	assert.Equal(t, time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC), deploymentCommitTime(t.Context(), ref).UTC(), "image label")
+
+	stubCommitTimes(t, "", "2026-10-16T09:30:00+02:00")
+	assert.Equal(t, time.Date(2026, 10, 16, 7, 30, 0, 0, time.UTC), deploymentCommitTime(t.Context(), ref).UTC(), "HEAD")
+
+	stubCommitTimes(t, "", "")
+	assert.True(t, deploymentCommitTime(t.Context(), ref).IsZero())
+}
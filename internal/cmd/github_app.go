@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitHub App credentials, used by githubToken when neither GITHUB_TOKEN nor
+// GH_TOKEN is set. The private key is the PEM GitHub generates for the app,
+// given inline or as a file.
+const (
+	githubAppIDEnv             = "GITHUB_APP_ID"
+	githubAppPrivateKeyEnv     = "GITHUB_APP_PRIVATE_KEY"
+	githubAppPrivateKeyFileEnv = "GITHUB_APP_PRIVATE_KEY_FILE"
+	githubAppInstallationEnv   = "GITHUB_APP_INSTALLATION_ID"
+)
+
+// githubAppTokenMargin is how long before it expires an installation token
+// is replaced.
+const githubAppTokenMargin = 5 * time.Minute
+
+// githubAppNow is the clock the app JWT and token expiry use; a var so
+// tests can replace it.
+var githubAppNow = time.Now
+
+// githubAppCache holds the installation token minted last, reused by every
+// GitHub call of the command until it nears expiry.
+var githubAppCache struct {
+	sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// githubAppInstallationToken returns an installation token of the GitHub
+// App in $GITHUB_APP_ID, minting one when none is cached.
+func githubAppInstallationToken() (string, error) {
+	githubAppCache.Lock()
+	defer githubAppCache.Unlock()
+	if githubAppCache.token != "" && githubAppNow().Add(githubAppTokenMargin).Before(githubAppCache.expires) {
+		return githubAppCache.token, nil
+	}
+	token, expires, err := mintGitHubAppToken()
+	if err != nil {
+		return "", err
+	}
+	githubAppCache.token, githubAppCache.expires = token, expires
+	return token, nil
+}
+
+// mintGitHubAppToken signs an app JWT and exchanges it for an installation
+// token. Without $GITHUB_APP_INSTALLATION_ID the app must be installed
+// exactly once.
+func mintGitHubAppToken() (string, time.Time, error) {
+	appID := os.Getenv(githubAppIDEnv)
+	keyPEM := []byte(os.Getenv(githubAppPrivateKeyEnv))
+	if path := os.Getenv(githubAppPrivateKeyFileEnv); len(keyPEM) == 0 && path != "" {
+		var err error
+		if keyPEM, err = os.ReadFile(path); err != nil {
+			return "", time.Time{}, fmt.Errorf("reading %s: %w", githubAppPrivateKeyFileEnv, err)
+		}
+	}
+	if len(keyPEM) == 0 {
+		return "", time.Time{}, fmt.Errorf("%s is set but neither %s nor %s", githubAppIDEnv, githubAppPrivateKeyEnv, githubAppPrivateKeyFileEnv)
+	}
+	key, err := parseGitHubAppKey(keyPEM)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	jwt, err := githubAppJWT(appID, key, githubAppNow())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	installation := os.Getenv(githubAppInstallationEnv)
+	if installation == "" {
+		var installs []struct {
+			ID      int64 `json:"id"`
+			Account struct {
+				Login string `json:"login"`
+			} `json:"account"`
+		}
+		if err := githubRequest(http.MethodGet, githubAPIURL()+"/app/installations", "application/json", nil, jwt, http.StatusOK, &installs); err != nil {
+			return "", time.Time{}, fmt.Errorf("listing the GitHub App installations: %w", err)
+		}
+		if len(installs) != 1 {
+			var accounts []string
+			for _, i := range installs {
+				accounts = append(accounts, fmt.Sprintf("%s (%d)", i.Account.Login, i.ID))
+			}
+			return "", time.Time{}, fmt.Errorf("GitHub App %s has %d installations [%s]; set %s", appID, len(installs), strings.Join(accounts, ", "), githubAppInstallationEnv)
+		}
+		installation = strconv.FormatInt(installs[0].ID, 10)
+	}
+
+	var out struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	u := githubAPIURL() + "/app/installations/" + installation + "/access_tokens"
+	if err := githubRequest(http.MethodPost, u, "application/json", nil, jwt, http.StatusCreated, &out); err != nil {
+		return "", time.Time{}, fmt.Errorf("minting a GitHub App installation token: %w", err)
+	}
+	return out.Token, out.ExpiresAt, nil
+}
+
+// parseGitHubAppKey parses the app's private key: PKCS#1, as GitHub
+// generates it, or PKCS#8.
+func parseGitHubAppKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("GitHub App private key is not PEM")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing GitHub App private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("GitHub App private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// githubAppJWT returns the RS256 JWT that authenticates as the app: issued a
+// minute in the past against clock drift, valid for nine minutes (GitHub
+// allows ten).
+func githubAppJWT(appID string, key *rsa.PrivateKey, now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("signing GitHub App JWT: %w", err)
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resetGitHubAppCache forgets the cached installation token.
+func resetGitHubAppCache(t *testing.T) {
+	t.Helper()
+	githubAppCache.token, githubAppCache.expires = "", time.Time{}
+	t.Cleanup(func() { githubAppCache.token, githubAppCache.expires = "", time.Time{} })
+}
+
+func TestGitHubToken_App(t *testing.T) {
+	resetGitHubAppCache(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "app.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0o600))
+
+	var mints int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every call is authenticated with a JWT signed by the app key.
+		jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parts := strings.Split(jwt, ".")
+		require.Len(t, parts, 3)
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig))
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var c struct {
+			Iss string `json:"iss"`
+		}
+		require.NoError(t, json.Unmarshal(claims, &c))
+		assert.Equal(t, "1234", c.Iss)
+
+		switch r.URL.Path {
+		case "/app/installations":
+			_, _ = w.Write([]byte(`[{"id": 42, "account": {"login": "acme"}}]`))
+		case "/app/installations/42/access_tokens":
+			mints++
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"token": "ghs_installation", "expires_at": "` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("GITHUB_API_URL", srv.URL)
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "")
+	t.Setenv(githubAppIDEnv, "1234")
+	t.Setenv(githubAppPrivateKeyEnv, "")
+	t.Setenv(githubAppPrivateKeyFileEnv, keyFile)
+	t.Setenv(githubAppInstallationEnv, "")
+
+	assert.Equal(t, "ghs_installation", githubToken())
+	// The token is reused until it nears expiry.
+	assert.Equal(t, "ghs_installation", githubToken())
+	assert.Equal(t, 1, mints)
+
+	// A personal token still takes precedence.
+	t.Setenv("GITHUB_TOKEN", "pat")
+	assert.Equal(t, "pat", githubToken())
+}
+
+func TestMintGitHubAppToken_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"id": 1, "account": {"login": "acme"}}, {"id": 2, "account": {"login": "other"}}]`))
+	}))
+	defer srv.Close()
+	t.Setenv("GITHUB_API_URL", srv.URL)
+	t.Setenv(githubAppIDEnv, "1234")
+	t.Setenv(githubAppPrivateKeyFileEnv, "")
+	t.Setenv(githubAppInstallationEnv, "")
+
+	t.Setenv(githubAppPrivateKeyEnv, "")
+	_, _, err := mintGitHubAppToken()
+	assert.ErrorContains(t, err, "neither GITHUB_APP_PRIVATE_KEY nor GITHUB_APP_PRIVATE_KEY_FILE")
+
+	t.Setenv(githubAppPrivateKeyEnv, "not a key")
+	_, _, err = mintGitHubAppToken()
+	assert.ErrorContains(t, err, "not PEM")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	t.Setenv(githubAppPrivateKeyEnv, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})))
+	_, _, err = mintGitHubAppToken()
+	assert.ErrorContains(t, err, "has 2 installations [acme (1), other (2)]; set GITHUB_APP_INSTALLATION_ID")
+}
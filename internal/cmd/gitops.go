@@ -0,0 +1,369 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// gitRun runs git in dir (the current directory when empty) and returns its
+// combined output. It is a var so tests can replace it.
+var gitRun = func(ctx context.Context, dir string, args ...string) (string, error) {
+	c := exec.CommandContext(ctx, "git", args...)
+	c.Dir = dir
+	out, err := c.CombinedOutput()
+	return string(out), err
+}
+
+// githubToken is the token used to clone, push and open pull requests:
+// GITHUB_TOKEN, GH_TOKEN, or an installation token of the GitHub App in
+// GITHUB_APP_ID (see githubAppInstallationToken). A failure to mint one is
+// logged and yields "".
+func githubToken() string {
+	if t := firstNonEmpty(os.Getenv("GITHUB_TOKEN"), os.Getenv("GH_TOKEN")); t != "" {
+		return t
+	}
+	if os.Getenv(githubAppIDEnv) == "" {
+		return ""
+	}
+	t, err := githubAppInstallationToken()
+	if err != nil {
+		slog.Warn("Could not authenticate as the GitHub App", "error", err)
+		return ""
+	}
+	return t
+}
+
+// githubAPIURL is the GitHub REST API base (GITHUB_API_URL on GitHub Enterprise).
+func githubAPIURL() string {
+	if u := os.Getenv("GITHUB_API_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "https://api.github.com"
+}
+
+// authenticatedCloneURL embeds token in an https repository URL; other URLs
+// (ssh, file) are returned unchanged.
+func authenticatedCloneURL(repo, token string) string {
+	u, err := url.Parse(repo)
+	if err != nil || token == "" || u.Scheme != "https" || u.User != nil {
+		return repo
+	}
+	u.User = url.UserPassword("x-access-token", token)
+	return u.String()
+}
+
+// githubRepoSlug returns owner/name for a GitHub https or ssh repository URL.
+func githubRepoSlug(repo string) (string, error) {
+	s := strings.TrimSuffix(repo, ".git")
+	if rest, ok := strings.CutPrefix(s, "git@"); ok {
+		_, s, _ = strings.Cut(rest, ":")
+	} else if u, err := url.Parse(s); err == nil && u.Host != "" {
+		s = strings.TrimPrefix(u.Path, "/")
+	}
+	if parts := strings.Split(s, "/"); len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+		return s, nil
+	}
+	return "", fmt.Errorf("cannot derive owner/name from repository %q", repo)
+}
+
+// gitopsChange is one image reference written to a file.
+type gitopsChange struct {
+	File  string
+	Image string
+	Ref   string
+}
+
+// applyGitOpsUpdates rewrites the files of env in the checkout at dir with
+// the images of res and returns the changes made.
+func applyGitOpsUpdates(dir string, env util.GitOpsEnvironment, res *util.BuildResult) ([]gitopsChange, error) {
+	var changes []gitopsChange
+	for _, u := range env.Updates {
+		ref, err := util.GetTagForImage(res, u.Image)
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(u.File))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", u.File, err)
+		}
+		out, changed, err := util.UpdateImageInYAML(data, u, ref)
+		if err != nil {
+			return nil, fmt.Errorf("updating %s: %w", u.File, err)
+		}
+		if !changed {
+			continue
+		}
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return nil, err
+		}
+		changes = append(changes, gitopsChange{File: u.File, Image: u.Image, Ref: ref})
+	}
+	return changes, nil
+}
+
+// gitopsCommitMessage summarises changes for environment.
+func gitopsCommitMessage(environment string, changes []gitopsChange) string {
+	var images, body []string
+	seen := map[string]bool{}
+	for _, c := range changes {
+		_, tag, digest := util.SplitImageRef(c.Ref)
+		if !seen[c.Image] {
+			seen[c.Image] = true
+			images = append(images, util.K8sName(c.Image)+" "+orShortDigest(tag, digest))
+		}
+		body = append(body, fmt.Sprintf("- %s: %s", c.File, c.Ref))
+	}
+	return fmt.Sprintf("Update %s: %s\n\n%s\n", environment, strings.Join(images, ", "), strings.Join(body, "\n"))
+}
+
+func orShortDigest(tag, digest string) string {
+	if tag != "" {
+		return tag
+	}
+	if hex, ok := strings.CutPrefix(digest, "sha256:"); ok && len(hex) >= 12 {
+		return hex[:12]
+	}
+	return digest
+}
+
+// gitopsBranchName is the pull request branch for changes.
+func gitopsBranchName(environment string, changes []gitopsChange) string {
+	_, tag, digest := util.SplitImageRef(changes[0].Ref)
+	id := orShortDigest("", digest)
+	if id == "" {
+		id = tag
+	}
+	return fmt.Sprintf("op/gitops-update/%s/%s-%s", environment, util.K8sName(changes[0].Image), id)
+}
+
+// gitIdentityArgs returns -c user.name/user.email for commits when git has no
+// identity configured (e.g. in CI).
+func gitIdentityArgs(ctx context.Context, dir string) []string {
+	if os.Getenv("GIT_AUTHOR_NAME") != "" {
+		return nil
+	}
+	if out, err := gitRun(ctx, dir, "config", "user.name"); err == nil && strings.TrimSpace(out) != "" {
+		return nil
+	}
+	return []string{"-c", "user.name=octopilot", "-c", "user.email=octopilot@users.noreply.github.com"}
+}
+
+// createPullRequest opens a pull request on GitHub and returns its URL.
+func createPullRequest(slug, head, base, title, body, token string) (string, error) {
+	payload, err := json.Marshal(map[string]string{"title": title, "head": head, "base": base, "body": body})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, githubAPIURL()+"/repos/"+slug+"/pulls", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var pr struct {
+		HTMLURL string `json:"html_url"`
+		Message string `json:"message"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&pr)
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("creating pull request on %s: %s %s", slug, resp.Status, pr.Message)
+	}
+	return pr.HTMLURL, nil
+}
+
+// gitopsPush pushes HEAD to branch, rebasing onto concurrent updates.
+func gitopsPush(ctx context.Context, dir, branch string, redact func(string) string) error {
+	var out string
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if out, err = gitRun(ctx, dir, "push", "origin", "HEAD:refs/heads/"+branch); err == nil {
+			return nil
+		}
+		if rout, rerr := gitRun(ctx, dir, "pull", "--rebase", "origin", branch); rerr != nil {
+			return fmt.Errorf("git pull --rebase: %s", redact(rout))
+		}
+	}
+	return fmt.Errorf("git push: %s", redact(out))
+}
+
+var gitopsUpdateCmd = &cobra.Command{
+	Use:   "gitops-update",
+	Short: "Bump image tags/digests from build_result.json in a GitOps repository.",
+	Long: `Clone the environment's GitOps repository, set the images from
+build_result.json in HelmRelease values, Kustomize images or any YAML path,
+commit, and push to the branch or open a GitHub pull request. Configured
+in .github/octopilot.yaml:
+
+  gitops:
+    repo: https://github.com/my-org/gitops.git
+    branch: main
+    environments:
+      dev:
+        updates:
+          - file: clusters/dev/my-app/helmrelease.yaml
+            image: ghcr.io/my-org/my-app          # imageName in build_result.json
+      prod:
+        pull_request: true
+        updates:
+          - file: clusters/prod/kustomization.yaml
+            image: ghcr.io/my-org/my-app
+            type: kustomize
+          - file: clusters/prod/cronjob.yaml
+            image: ghcr.io/my-org/my-app
+            type: yaml
+            path: spec.jobTemplate.spec.template.spec.containers[name=app].image
+
+HTTPS repositories are cloned and pushed with GITHUB_TOKEN (or GH_TOKEN, or
+a GitHub App: GITHUB_APP_ID and GITHUB_APP_PRIVATE_KEY), which also opens the
+pull request (GITHUB_API_URL for GitHub Enterprise).
+Use --dry-run to print the diff without committing.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cwd, _ := os.Getwd()
+		envName, _ := cmd.Flags().GetString("environment")
+		repoFlag, _ := cmd.Flags().GetString("repo")
+		branchFlag, _ := cmd.Flags().GetString("branch")
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		message, _ := cmd.Flags().GetString("message")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		ctx := cmd.Context()
+
+		cfg, err := util.LoadRunConfig(cwd)
+		if err != nil {
+			return err
+		}
+		env, ok := cfg.GitOps.Environments[envName]
+		if !ok {
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("no gitops environment %q in %s", envName, util.RunConfigFilename))
+		}
+		repo := firstNonEmpty(repoFlag, env.Repo, cfg.GitOps.Repo)
+		if repo == "" {
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("no gitops repository: set gitops.repo in %s or --repo", util.RunConfigFilename))
+		}
+		branch := firstNonEmpty(branchFlag, env.Branch, cfg.GitOps.Branch, "main")
+		pullRequest := env.PullRequest
+		if cmd.Flags().Changed("pr") {
+			pullRequest, _ = cmd.Flags().GetBool("pr")
+		}
+		res, err := util.ReadBuildResult(buildResultDir)
+		if err != nil {
+			return err
+		}
+
+		token := githubToken()
+		redact := func(s string) string {
+			if token == "" {
+				return s
+			}
+			return strings.ReplaceAll(s, token, "***")
+		}
+		dir, err := os.MkdirTemp("", "op-gitops-")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.RemoveAll(dir) }()
+		slog.Info("Cloning", "repo", repo, "branch", branch)
+		if out, err := gitRun(ctx, "", "clone", "--depth", "1", "--branch", branch, authenticatedCloneURL(repo, token), dir); err != nil {
+			return fmt.Errorf("git clone: %s", redact(out))
+		}
+
+		changes, err := applyGitOpsUpdates(dir, env, res)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			slog.Info("Already up to date", "environment", envName)
+			return nil
+		}
+		for _, c := range changes {
+			fmt.Printf("%s: %s\n", c.File, c.Ref)
+		}
+		if dryRun {
+			out, _ := gitRun(ctx, dir, "diff")
+			fmt.Print(out)
+			return nil
+		}
+
+		if message == "" {
+			message = gitopsCommitMessage(envName, changes)
+		}
+		addArgs := []string{"add", "--"}
+		for _, c := range changes {
+			addArgs = append(addArgs, filepath.FromSlash(c.File))
+		}
+		if out, err := gitRun(ctx, dir, addArgs...); err != nil {
+			return fmt.Errorf("git add: %s", out)
+		}
+		commitArgs := append(gitIdentityArgs(ctx, dir), "commit", "-m", message)
+		if out, err := gitRun(ctx, dir, commitArgs...); err != nil {
+			return fmt.Errorf("git commit: %s", out)
+		}
+
+		if !pullRequest {
+			if err := gitopsPush(ctx, dir, branch, redact); err != nil {
+				return err
+			}
+			slog.Info("Pushed", "repo", repo, "branch", branch)
+			return nil
+		}
+		head := gitopsBranchName(envName, changes)
+		if out, err := gitRun(ctx, dir, "push", "--force", "origin", "HEAD:refs/heads/"+head); err != nil {
+			return fmt.Errorf("git push: %s", redact(out))
+		}
+		slug, err := githubRepoSlug(repo)
+		if err != nil {
+			return err
+		}
+		if token == "" {
+			return fmt.Errorf("pushed %s; set GITHUB_TOKEN or GITHUB_APP_ID to open the pull request", head)
+		}
+		title, body, _ := strings.Cut(message, "\n")
+		prURL, err := createPullRequest(slug, head, branch, title, strings.TrimSpace(body), token)
+		if err != nil {
+			return err
+		}
+		slog.Info("Opened pull request", "url", prURL)
+		fmt.Println(prURL)
+		return nil
+	},
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func init() {
+	rootCmd.AddCommand(gitopsUpdateCmd)
+	gitopsUpdateCmd.Flags().String("environment", "", "GitOps environment from .github/octopilot.yaml (e.g. dev, prod)")
+	gitopsUpdateCmd.Flags().String("repo", "", "GitOps repository URL (overrides gitops.repo)")
+	gitopsUpdateCmd.Flags().String("branch", "", "Branch to update or target with the pull request (default: gitops.branch, then main)")
+	gitopsUpdateCmd.Flags().Bool("pr", false, "Open a pull request instead of pushing (overrides the environment's pull_request)")
+	gitopsUpdateCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json (default: cwd)")
+	gitopsUpdateCmd.Flags().String("message", "", "Commit message (default: generated from the updated images)")
+	gitopsUpdateCmd.Flags().Bool("dry-run", false, "Print the diff without committing or pushing")
+	_ = gitopsUpdateCmd.MarkFlagRequired("environment")
+	_ = gitopsUpdateCmd.RegisterFlagCompletionFunc("environment", completeGitOpsEnvironments)
+}
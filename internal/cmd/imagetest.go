@@ -0,0 +1,426 @@
+package cmd
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// imageTestResult is the outcome of one `op test` assertion; Failure is empty when it passed.
+type imageTestResult struct {
+	Image    string
+	Name     string
+	Failure  string
+	Duration time.Duration
+}
+
+// imageTestRun runs the container CLI with args and returns the combined
+// output and exit code. err is only set when the CLI could not be run.
+// It is a var so tests can replace it.
+var imageTestRun = func(ctx context.Context, args ...string) (string, int, error) {
+	out, err := exec.CommandContext(ctx, util.ContainerCLI(), args...).CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), exitErr.ExitCode(), nil
+	}
+	return string(out), 0, err
+}
+
+// daemonImage reads ref from the local daemon (docker, or podman through
+// its DOCKER_HOST socket). It is a var so tests can replace it.
+var daemonImage = func(ctx context.Context, ref name.Reference) (v1.Image, error) {
+	return daemon.Image(ref, daemon.WithContext(ctx))
+}
+
+// pullTestImage pulls ref for the command tests unless pull is false.
+func pullTestImage(ctx context.Context, ref string, pull bool) (string, int, error) {
+	if !pull {
+		return "", 0, nil
+	}
+	return imageTestRun(ctx, "pull", ref)
+}
+
+// commandTestArgs returns the docker run arguments for t against ref. Like
+// `op run --shell`, buildpack images run the command through the launcher.
+func commandTestArgs(ref string, entrypoint []string, t util.CommandTest) []string {
+	ep, pre := runShellEntrypoint(entrypoint, t.Command)
+	args := []string{"run", "--rm", "--entrypoint", ep}
+	keys := make([]string, 0, len(t.Env))
+	for k := range t.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-e", k+"="+t.Env[k])
+	}
+	args = append(args, ref)
+	args = append(args, pre...)
+	return append(args, t.Args...)
+}
+
+// runCommandTest runs t in ref and checks exit code and output patterns.
+func runCommandTest(ctx context.Context, ref string, entrypoint []string, t util.CommandTest) imageTestResult {
+	r := imageTestResult{Name: "command: " + t.Name}
+	if t.Name == "" {
+		r.Name = "command: " + strings.Join(append([]string{t.Command}, t.Args...), " ")
+	}
+	start := time.Now()
+	out, code, err := imageTestRun(ctx, commandTestArgs(ref, entrypoint, t)...)
+	r.Duration = time.Since(start)
+	if err != nil {
+		r.Failure = err.Error()
+		return r
+	}
+	var failures []string
+	if code != t.ExitCode {
+		failures = append(failures, fmt.Sprintf("exit code %d, expected %d", code, t.ExitCode))
+	}
+	for _, pattern := range t.ExpectedOutput {
+		if re, err := regexp.Compile(pattern); err != nil {
+			failures = append(failures, fmt.Sprintf("invalid expected_output %q: %v", pattern, err))
+		} else if !re.MatchString(out) {
+			failures = append(failures, fmt.Sprintf("output does not match %q", pattern))
+		}
+	}
+	for _, pattern := range t.ExcludedOutput {
+		if re, err := regexp.Compile(pattern); err != nil {
+			failures = append(failures, fmt.Sprintf("invalid excluded_output %q: %v", pattern, err))
+		} else if re.MatchString(out) {
+			failures = append(failures, fmt.Sprintf("output matches excluded %q", pattern))
+		}
+	}
+	if len(failures) > 0 {
+		r.Failure = strings.Join(failures, "; ") + "\noutput:\n" + out
+	}
+	return r
+}
+
+// imageFilePaths returns the absolute paths (files and their parent
+// directories) in the flattened filesystem of img.
+func imageFilePaths(img v1.Image) (map[string]bool, error) {
+	rc := mutate.Extract(img)
+	defer func() { _ = rc.Close() }()
+	paths := map[string]bool{"/": true}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return paths, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Layers need not contain entries for parent directories.
+		for p := path.Clean("/" + hdr.Name); !paths[p]; p = path.Dir(p) {
+			paths[p] = true
+		}
+	}
+}
+
+// runFileExistenceTests checks each path against the image filesystem.
+func runFileExistenceTests(img v1.Image, tests []util.FileExistenceTest) []imageTestResult {
+	start := time.Now()
+	paths, err := imageFilePaths(img)
+	var results []imageTestResult
+	for _, t := range tests {
+		r := imageTestResult{Name: "file: " + t.Name, Duration: time.Since(start)}
+		if t.Name == "" {
+			r.Name = "file: " + t.Path
+		}
+		shouldExist := t.ShouldExist == nil || *t.ShouldExist
+		switch exists := paths[path.Clean("/"+t.Path)]; {
+		case err != nil:
+			r.Failure = "reading image filesystem: " + err.Error()
+		case shouldExist && !exists:
+			r.Failure = t.Path + " does not exist"
+		case !shouldExist && exists:
+			r.Failure = t.Path + " exists"
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// runMetadataTest compares the set fields of m with the image config, one result per field.
+func runMetadataTest(cfg *v1.ConfigFile, m util.MetadataTest) []imageTestResult {
+	var results []imageTestResult
+	check := func(name, failure string) {
+		results = append(results, imageTestResult{Name: "metadata: " + name, Failure: failure})
+	}
+	if len(m.Env) > 0 {
+		env := map[string]string{}
+		for _, kv := range cfg.Config.Env {
+			k, v, _ := strings.Cut(kv, "=")
+			env[k] = v
+		}
+		var failures []string
+		for k, want := range m.Env {
+			if got, ok := env[k]; !ok {
+				failures = append(failures, k+" is not set")
+			} else if got != want {
+				failures = append(failures, fmt.Sprintf("%s=%q, expected %q", k, got, want))
+			}
+		}
+		sort.Strings(failures)
+		check("env", strings.Join(failures, "; "))
+	}
+	if len(m.ExposedPorts) > 0 {
+		var missing []string
+		for _, p := range m.ExposedPorts {
+			if !strings.Contains(p, "/") {
+				p += "/tcp"
+			}
+			if _, ok := cfg.Config.ExposedPorts[p]; !ok {
+				missing = append(missing, p)
+			}
+		}
+		failure := ""
+		if len(missing) > 0 {
+			failure = "not exposed: " + strings.Join(missing, ", ")
+		}
+		check("exposed_ports", failure)
+	}
+	compare := func(name string, want, got []string) {
+		failure := ""
+		if strings.Join(want, "\x00") != strings.Join(got, "\x00") {
+			failure = fmt.Sprintf("%q, expected %q", got, want)
+		}
+		check(name, failure)
+	}
+	if m.Entrypoint != nil {
+		compare("entrypoint", m.Entrypoint, cfg.Config.Entrypoint)
+	}
+	if m.Cmd != nil {
+		compare("cmd", m.Cmd, cfg.Config.Cmd)
+	}
+	if m.User != "" {
+		compare("user", []string{m.User}, []string{cfg.Config.User})
+	}
+	if m.Workdir != "" {
+		compare("workdir", []string{m.Workdir}, []string{cfg.Config.WorkingDir})
+	}
+	return results
+}
+
+// runImageTests runs all tests of opts against img (pulled as ref first when
+// pull is set; local images are not) and labels the results with image.
+func runImageTests(ctx context.Context, image, ref string, img v1.Image, opts util.ImageTestOpts, pull bool) []imageTestResult {
+	var results []imageTestResult
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return []imageTestResult{{Image: image, Name: "config", Failure: err.Error()}}
+	}
+	if opts.Metadata != nil {
+		results = append(results, runMetadataTest(cfg, *opts.Metadata)...)
+	}
+	if len(opts.FileExistenceTests) > 0 {
+		results = append(results, runFileExistenceTests(img, opts.FileExistenceTests)...)
+	}
+	if len(opts.CommandTests) > 0 {
+		if out, code, err := pullTestImage(ctx, ref, pull); err != nil || code != 0 {
+			results = append(results, imageTestResult{Name: "pull", Failure: fmt.Sprintf("pulling %s: %v %s", ref, err, out)})
+		} else {
+			for _, t := range opts.CommandTests {
+				results = append(results, runCommandTest(ctx, ref, cfg.Config.Entrypoint, t))
+			}
+		}
+	}
+	for i := range results {
+		results[i].Image = image
+	}
+	return results
+}
+
+// JUnit XML report, as consumed by CI test reporters.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitReport groups results into one test suite per image.
+func junitReport(results []imageTestResult) junitTestSuites {
+	var report junitTestSuites
+	var totals []time.Duration
+	index := map[string]int{}
+	for _, r := range results {
+		i, ok := index[r.Image]
+		if !ok {
+			i = len(report.Suites)
+			index[r.Image] = i
+			report.Suites = append(report.Suites, junitTestSuite{Name: r.Image})
+			totals = append(totals, 0)
+		}
+		totals[i] += r.Duration
+		s := &report.Suites[i]
+		tc := junitTestCase{Name: r.Name, ClassName: r.Image, Time: fmt.Sprintf("%.3f", r.Duration.Seconds())}
+		if r.Failure != "" {
+			msg, _, _ := strings.Cut(r.Failure, "\n")
+			tc.Failure = &junitFailure{Message: msg, Text: r.Failure}
+			s.Failures++
+		}
+		s.Tests++
+		s.Cases = append(s.Cases, tc)
+	}
+	for i := range report.Suites {
+		report.Suites[i].Time = fmt.Sprintf("%.3f", totals[i].Seconds())
+	}
+	return report
+}
+
+// writeJUnit writes results to path as JUnit XML.
+func writeJUnit(path string, results []imageTestResult) error {
+	data, err := xml.MarshalIndent(junitReport(results), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0o644)
+}
+
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Run image tests against the images in build_result.json.",
+	Long: `Run container-structure-test style assertions against the images in
+build_result.json, pulled by digest (images built without --push are read
+from the local daemon). Tests are configured per artifact under
+"tests" in .github/octopilot.yaml, keyed by image name:
+
+  tests:
+    ghcr.io/my-org/my-app:
+      metadata:
+        exposed_ports: ["8080"]
+        env: {PORT: "8080"}
+      file_existence_tests:
+        - path: /workspace/bin/app
+      command_tests:
+        - name: version
+          command: /workspace/bin/app
+          args: ["--version"]
+          expected_output: ["v\\d+"]
+
+Command tests run with the container runtime (buildpack images go through
+the CNB launcher); metadata and file tests read the image from the registry,
+or from the local daemon for the images op build --load recorded.
+Use --junit to write a JUnit XML report for CI.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cwd, _ := os.Getwd()
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		imageName, _ := cmd.Flags().GetString("image-name")
+		junitPath, _ := cmd.Flags().GetString("junit")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+
+		cfg, err := util.LoadRunConfig(cwd)
+		if err != nil {
+			return err
+		}
+		res, err := util.ReadBuildResult(buildResultDir)
+		if err != nil {
+			return err
+		}
+		insecure := insecureRegistries(insecureFlag)
+
+		var results []imageTestResult
+		for _, b := range res.Builds {
+			if imageName != "" && b.ImageName != imageName {
+				continue
+			}
+			tests, ok := cfg.Tests[b.ImageName]
+			if !ok {
+				util.ArtifactLogger(b.ImageName).Info("No tests configured")
+				continue
+			}
+			var img v1.Image
+			if b.IsLocal() {
+				// Built with op build --load (or without --push): read it from the daemon.
+				ref, err := name.ParseReference(b.Tag)
+				if err != nil {
+					return fmt.Errorf("parsing %s: %w", b.Tag, err)
+				}
+				img, err = daemonImage(cmd.Context(), ref)
+			} else {
+				ref, err := parseReferenceForRemote(b.Tag, insecure)
+				if err != nil {
+					return fmt.Errorf("parsing %s: %w", b.Tag, err)
+				}
+				img, err = remoteImage(ref, remoteOptionsFor(cmd.Context(), b.Tag, insecure)...)
+			}
+			if err != nil {
+				results = append(results, imageTestResult{Image: b.ImageName, Name: "fetch", Failure: err.Error()})
+				continue
+			}
+			results = append(results, runImageTests(cmd.Context(), b.ImageName, b.Tag, img, tests, !b.IsLocal())...)
+		}
+		if len(results) == 0 {
+			return fmt.Errorf("no tests ran: add tests for the images in build_result.json to %s", util.RunConfigFilename)
+		}
+
+		failed := 0
+		for _, r := range results {
+			status := "PASS"
+			if r.Failure != "" {
+				status = "FAIL"
+				failed++
+			}
+			fmt.Printf("%s  %s  %s\n", status, r.Image, r.Name)
+			if r.Failure != "" {
+				fmt.Printf("      %s\n", strings.ReplaceAll(r.Failure, "\n", "\n      "))
+			}
+		}
+		if junitPath != "" {
+			if err := writeJUnit(junitPath, results); err != nil {
+				return fmt.Errorf("writing %s: %w", junitPath, err)
+			}
+		}
+		fmt.Printf("%d passed, %d failed\n", len(results)-failed, failed)
+		if failed > 0 {
+			return util.WithExitCode(util.ExitVerification, fmt.Errorf("%d image test(s) failed", failed))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(testCmd)
+	testCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json (default: current directory)")
+	testCmd.Flags().String("image-name", "", "Only test this artifact (image name from build_result.json)")
+	_ = testCmd.RegisterFlagCompletionFunc("image-name", completeBuildResultImages)
+	testCmd.Flags().String("junit", "", "Write a JUnit XML report to this path")
+	testCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+}
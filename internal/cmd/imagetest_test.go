@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testImage(t *testing.T) v1.Image {
+	t.Helper()
+	img, err := crane.Image(map[string][]byte{"workspace/bin/app": []byte("app")})
+	require.NoError(t, err)
+	cfg, err := img.ConfigFile()
+	require.NoError(t, err)
+	cfg.Config.Env = []string{"PORT=8080", "LOG_LEVEL=info"}
+	cfg.Config.ExposedPorts = map[string]struct{}{"8080/tcp": {}}
+	cfg.Config.Entrypoint = []string{"/cnb/process/web"}
+	img, err = mutate.ConfigFile(img, cfg)
+	require.NoError(t, err)
+	return img
+}
+
+func failures(results []imageTestResult) map[string]string {
+	m := map[string]string{}
+	for _, r := range results {
+		m[r.Name] = r.Failure
+	}
+	return m
+}
+
+func TestRunMetadataTest(t *testing.T) {
+	cfg, err := testImage(t).ConfigFile()
+	require.NoError(t, err)
+
+	got := failures(runMetadataTest(cfg, util.MetadataTest{
+		Env:          map[string]string{"PORT": "8080", "LOG_LEVEL": "debug"},
+		ExposedPorts: []string{"8080", "9090/tcp"},
+		Entrypoint:   []string{"/cnb/process/web"},
+	}))
+	assert.Equal(t, `LOG_LEVEL="info", expected "debug"`, got["metadata: env"])
+	assert.Equal(t, "not exposed: 9090/tcp", got["metadata: exposed_ports"])
+	assert.Empty(t, got["metadata: entrypoint"])
+}
+
+func TestRunFileExistenceTests(t *testing.T) {
+	no := false
+	got := failures(runFileExistenceTests(testImage(t), []util.FileExistenceTest{
+		{Path: "/workspace/bin/app"},
+		{Path: "/workspace"},
+		{Path: "/bin/sh"},
+		{Name: "no secrets", Path: "/workspace/.env", ShouldExist: &no},
+	}))
+	assert.Empty(t, got["file: /workspace/bin/app"])
+	assert.Empty(t, got["file: /workspace"])
+	assert.Equal(t, "/bin/sh does not exist", got["file: /bin/sh"])
+	assert.Empty(t, got["file: no secrets"])
+}
+
+func TestCommandTestArgs(t *testing.T) {
+	test := util.CommandTest{Command: "app", Args: []string{"--version"}, Env: map[string]string{"B": "2", "A": "1"}}
+	assert.Equal(t,
+		[]string{"run", "--rm", "--entrypoint", buildpackLauncher, "-e", "A=1", "-e", "B=2", "img@sha256:abc", "app", "--version"},
+		commandTestArgs("img@sha256:abc", []string{"/cnb/process/web"}, test))
+	assert.Equal(t,
+		[]string{"run", "--rm", "--entrypoint", "app", "img", "--version"},
+		commandTestArgs("img", []string{"/app"}, util.CommandTest{Command: "app", Args: []string{"--version"}}))
+}
+
+func TestRunImageTests_Commands(t *testing.T) {
+	var calls [][]string
+	old := imageTestRun
+	imageTestRun = func(_ context.Context, args ...string) (string, int, error) {
+		calls = append(calls, args)
+		if args[0] == "pull" {
+			return "", 0, nil
+		}
+		return "app v1.2.3\n", 0, nil
+	}
+	defer func() { imageTestRun = old }()
+
+	results := runImageTests(t.Context(), "my-app", "localhost:5001/my-app@sha256:abc", testImage(t), util.ImageTestOpts{
+		CommandTests: []util.CommandTest{
+			{Name: "version", Command: "app", ExpectedOutput: []string{`v\d+\.\d+`}},
+			{Name: "exit", Command: "app", ExitCode: 3, ExcludedOutput: []string{"v1"}},
+		},
+	}, true)
+	got := failures(results)
+	assert.Empty(t, got["command: version"])
+	assert.Contains(t, got["command: exit"], "exit code 0, expected 3")
+	assert.Contains(t, got["command: exit"], `output matches excluded "v1"`)
+	assert.Equal(t, []string{"pull", "localhost:5001/my-app@sha256:abc"}, calls[0])
+	assert.Equal(t, "my-app", results[0].Image)
+
+	// A local image (op build --load) is not pulled.
+	calls = nil
+	runImageTests(t.Context(), "my-app", "localhost:5001/my-app:latest", testImage(t), util.ImageTestOpts{
+		CommandTests: []util.CommandTest{{Name: "version", Command: "app"}},
+	}, false)
+	require.Len(t, calls, 1)
+	assert.Equal(t, "run", calls[0][0])
+}
+
+func TestWriteJUnit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "junit.xml")
+	require.NoError(t, writeJUnit(path, []imageTestResult{
+		{Image: "api", Name: "file: /app"},
+		{Image: "api", Name: "command: version", Failure: "exit code 1, expected 0\noutput:\nboom"},
+		{Image: "web", Name: "metadata: env"},
+	}))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var report junitTestSuites
+	require.NoError(t, xml.Unmarshal(data, &report))
+	require.Len(t, report.Suites, 2)
+	assert.Equal(t, 2, report.Suites[0].Tests)
+	assert.Equal(t, 1, report.Suites[0].Failures)
+	assert.Equal(t, "exit code 1, expected 0", report.Suites[0].Cases[1].Failure.Message)
+	assert.Equal(t, "web", report.Suites[1].Name)
+}
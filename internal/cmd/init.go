@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// initWorkflowPath is the starter GitHub Actions workflow written by `op init`.
+const initWorkflowPath = ".github/workflows/op.yaml"
+
+// initAnswers are the values rendered into the generated files.
+type initAnswers struct {
+	util.ProjectInfo
+	Image         string
+	LocalRegistry string
+	CIRegistry    string
+	Platforms     string
+}
+
+// CIRegistryHost is the registry host `op login` authenticates against.
+func (a initAnswers) CIRegistryHost() string {
+	host, _, _ := strings.Cut(a.CIRegistry, "/")
+	return host
+}
+
+// BuildpackEnv returns the buildpack environment for the detected language.
+func (a initAnswers) BuildpackEnv() []string {
+	if a.Language == "go" {
+		return []string{"BP_GO_BUILD_FLAGS=-buildvcs=false"}
+	}
+	return nil
+}
+
+// Templates use [[ ]] so GitHub Actions ${{ }} expressions pass through.
+var initTemplates = map[string]string{
+	"skaffold.yaml": `apiVersion: skaffold/v4beta1
+kind: Config
+metadata:
+  name: [[.Image]]
+build:
+  artifacts:
+    - image: [[.Image]]
+      context: .
+[[- if .Dockerfile]]
+      docker:
+        dockerfile: Dockerfile
+[[- else]]
+      buildpacks:
+        builder: ghcr.io/octopilot/builder-jammy-base:latest
+[[- with .BuildpackEnv]]
+        env:
+[[- range .]]
+          - [[.]]
+[[- end]]
+[[- end]]
+[[- end]]
+`,
+	util.RegistryFilename: `# Registry for op build: local outside CI, the first matching ci entry in GitHub Actions.
+local: [[.LocalRegistry]]
+ci:
+  - [[.CIRegistry]]
+`,
+	util.RunConfigFilename: `# op configuration, see https://github.com/octopilot/octopilot-pipeline-tools#configuration
+contexts:
+  [[.Image]]:
+    ports: ["[[.ContainerPort]]:[[.ContainerPort]]"]
+    env:
+      PORT: "[[.ContainerPort]]"
+`,
+	initWorkflowPath: `name: op
+
+on:
+  push:
+    branches: [main]
+  pull_request:
+
+permissions:
+  contents: read
+  packages: write
+  id-token: write
+
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - name: Install op
+        run: |
+          curl -fsSL https://github.com/octopilot/octopilot-pipeline-tools/releases/latest/download/op-linux-amd64 -o /usr/local/bin/op
+          chmod +x /usr/local/bin/op
+      - uses: docker/setup-qemu-action@v3
+      - name: Log in to [[.CIRegistryHost]]
+        run: op login [[.CIRegistryHost]] --oidc
+        env:
+          GITHUB_TOKEN: ${{ secrets.GITHUB_TOKEN }}
+      - name: Build and push
+        run: op build --push --platform [[.Platforms]]
+      - uses: actions/upload-artifact@v4
+        with:
+          name: build-result
+          path: build_result.json
+
+  deploy-dev:
+    if: github.ref == 'refs/heads/main'
+    needs: build
+    runs-on: ubuntu-latest
+    environment: dev
+    steps:
+      - name: Install op
+        run: |
+          curl -fsSL https://github.com/octopilot/octopilot-pipeline-tools/releases/latest/download/op-linux-amd64 -o /usr/local/bin/op
+          chmod +x /usr/local/bin/op
+      - uses: actions/download-artifact@v4
+        with:
+          name: build-result
+      # Configure access to the dev cluster (kubeconfig) before this step.
+      - name: Wait for the dev rollout
+        run: op watch-deployment --component [[.Image]] --environment dev --namespace [[.Image]]
+
+  promote-pp:
+    needs: deploy-dev
+    runs-on: ubuntu-latest
+    environment: pp
+    steps:
+      - name: Install op
+        run: |
+          curl -fsSL https://github.com/octopilot/octopilot-pipeline-tools/releases/latest/download/op-linux-amd64 -o /usr/local/bin/op
+          chmod +x /usr/local/bin/op
+      - uses: actions/download-artifact@v4
+        with:
+          name: build-result
+      - name: Log in to [[.CIRegistryHost]]
+        run: op login [[.CIRegistryHost]] --oidc
+        env:
+          GITHUB_TOKEN: ${{ secrets.GITHUB_TOKEN }}
+      - name: Promote to pp
+        run: op promote-image --source dev --destination pp --build-result-dir .
+`,
+}
+
+// initFiles is the order in which files are generated.
+var initFiles = []string{"skaffold.yaml", util.RegistryFilename, util.RunConfigFilename, initWorkflowPath}
+
+// renderInitFile renders the generated content of path.
+func renderInitFile(path string, a initAnswers) ([]byte, error) {
+	t, err := template.New(path).Delims("[[", "]]").Parse(initTemplates[path])
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, a); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// promptValue asks for label on w and reads the answer from r, returning def
+// for an empty answer or at end of input.
+func promptValue(r *bufio.Reader, w io.Writer, label, def string) string {
+	fmt.Fprintf(w, "%s [%s]: ", label, def)
+	line, _ := r.ReadString('\n')
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
+
+// defaultInitAnswers returns the answers used with --yes for the repo in dir.
+func defaultInitAnswers(dir string) initAnswers {
+	return initAnswers{
+		ProjectInfo:   util.InferProject(dir),
+		Image:         util.K8sName(filepath.Base(dir)),
+		LocalRegistry: util.ResolveLocalRegistry(dir).Endpoint(),
+		CIRegistry:    "ghcr.io/${GITHUB_REPOSITORY_OWNER}",
+		Platforms:     "linux/amd64,linux/arm64",
+	}
+}
+
+// askInitAnswers prompts for each answer, offering a as the defaults.
+func askInitAnswers(r io.Reader, w io.Writer, a initAnswers) initAnswers {
+	br := bufio.NewReader(r)
+	a.Image = promptValue(br, w, "Image name", a.Image)
+	if port, err := strconv.Atoi(promptValue(br, w, "Container port", strconv.Itoa(a.ContainerPort))); err == nil {
+		a.ContainerPort = port
+	}
+	a.LocalRegistry = promptValue(br, w, "Local registry", a.LocalRegistry)
+	a.CIRegistry = promptValue(br, w, "CI registry", a.CIRegistry)
+	a.Platforms = promptValue(br, w, "Platforms", a.Platforms)
+	return a
+}
+
+// writeInitFiles writes the generated files under dir, keeping existing
+// files unless force is set. It returns the paths written.
+func writeInitFiles(dir string, a initAnswers, force bool, w io.Writer) ([]string, error) {
+	var written []string
+	for _, path := range initFiles {
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if _, err := os.Stat(target); err == nil && !force {
+			fmt.Fprintf(w, "Skipped %s (exists; use --force to overwrite)\n", path)
+			continue
+		}
+		data, err := renderInitFile(path, a)
+		if err != nil {
+			return written, fmt.Errorf("rendering %s: %w", path, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return written, err
+		}
+		if err := os.WriteFile(target, data, 0o644); err != nil {
+			return written, err
+		}
+		fmt.Fprintf(w, "Created %s\n", path)
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init [dir]",
+	Short: "Scaffold skaffold.yaml, .registry, .github/octopilot.yaml and a GitHub Actions workflow.",
+	Long: `Inspect the repository (language, Dockerfile, Procfile and container port,
+as op run does) and generate:
+
+  skaffold.yaml                  Dockerfile artifact, or buildpacks without one
+  .registry                      local and CI registries
+  .github/octopilot.yaml         op run context with the detected port
+  .github/workflows/op.yaml      op build on every push, then watch-deployment
+                                 (dev) and promote-image (pp) on main
+
+Answers are prompted for with detected defaults; --yes accepts them all.
+Existing files are kept unless --force is set.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		yes, _ := cmd.Flags().GetBool("yes")
+		force, _ := cmd.Flags().GetBool("force")
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			if dir, err = filepath.Abs(args[0]); err != nil {
+				return err
+			}
+		}
+
+		a := defaultInitAnswers(dir)
+		lang := firstNonEmpty(a.Language, "unknown")
+		builder := "buildpacks"
+		if a.Dockerfile {
+			builder = "Dockerfile"
+		}
+		slog.Info("Detected project", "language", lang, "build", builder, "port", a.ContainerPort)
+		if !yes {
+			a = askInitAnswers(os.Stdin, os.Stdout, a)
+		}
+		written, err := writeInitFiles(dir, a, force, os.Stdout)
+		if err != nil {
+			return err
+		}
+		if len(written) > 0 {
+			slog.Info("Next: op start-registry && op build --push && op run " + a.Image)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+	initCmd.Flags().BoolP("yes", "y", false, "Accept the detected defaults without prompting")
+	initCmd.Flags().Bool("force", false, "Overwrite existing files")
+}
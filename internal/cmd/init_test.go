@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRenderInitFile_Skaffold(t *testing.T) {
+	a := initAnswers{ProjectInfo: util.ProjectInfo{Language: "go"}, Image: "my-app"}
+	data, err := renderInitFile("skaffold.yaml", a)
+	require.NoError(t, err)
+	var cfg struct {
+		Build struct {
+			Artifacts []util.Artifact `yaml:"artifacts"`
+		} `yaml:"build"`
+	}
+	require.NoError(t, yaml.Unmarshal(data, &cfg))
+	require.Len(t, cfg.Build.Artifacts, 1)
+	art := cfg.Build.Artifacts[0]
+	assert.Equal(t, "my-app", art.Image)
+	require.NotNil(t, art.Buildpacks)
+	assert.Equal(t, "ghcr.io/octopilot/builder-jammy-base:latest", art.Buildpacks.Builder)
+	assert.Equal(t, []string{"BP_GO_BUILD_FLAGS=-buildvcs=false"}, art.Buildpacks.Env)
+
+	a.Dockerfile = true
+	data, err = renderInitFile("skaffold.yaml", a)
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(data, &cfg))
+	require.NotNil(t, cfg.Build.Artifacts[0].Docker)
+	assert.Equal(t, "Dockerfile", cfg.Build.Artifacts[0].Docker.Dockerfile)
+	assert.Nil(t, cfg.Build.Artifacts[0].Buildpacks)
+}
+
+func TestRenderInitFile_Workflow(t *testing.T) {
+	a := initAnswers{Image: "my-app", CIRegistry: "ghcr.io/${GITHUB_REPOSITORY_OWNER}", Platforms: "linux/amd64"}
+	data, err := renderInitFile(initWorkflowPath, a)
+	require.NoError(t, err)
+	var wf map[string]any
+	require.NoError(t, yaml.Unmarshal(data, &wf), string(data))
+	s := string(data)
+	assert.Contains(t, s, "run: op login ghcr.io --oidc")
+	assert.Contains(t, s, "GITHUB_TOKEN: ${{ secrets.GITHUB_TOKEN }}")
+	assert.Contains(t, s, "run: op build --push --platform linux/amd64")
+	assert.Contains(t, s, "op watch-deployment --component my-app --environment dev")
+	assert.Contains(t, s, "op promote-image --source dev --destination pp")
+}
+
+func TestAskInitAnswers(t *testing.T) {
+	def := initAnswers{ProjectInfo: util.ProjectInfo{ContainerPort: 8080}, Image: "dir", LocalRegistry: "localhost:5001", CIRegistry: "ghcr.io/org", Platforms: "linux/amd64"}
+	var out bytes.Buffer
+	a := askInitAnswers(strings.NewReader("web\n3000\n\nregistry.example.com/team\n"), &out, def)
+	assert.Equal(t, "web", a.Image)
+	assert.Equal(t, 3000, a.ContainerPort)
+	assert.Equal(t, "localhost:5001", a.LocalRegistry)
+	assert.Equal(t, "registry.example.com/team", a.CIRegistry)
+	assert.Equal(t, "linux/amd64", a.Platforms)
+	assert.Contains(t, out.String(), "Image name [dir]: ")
+}
+
+func TestWriteInitFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "package.json"), []byte("{}"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "skaffold.yaml"), []byte("keep"), 0o644))
+	a := defaultInitAnswers(dir)
+	assert.Equal(t, "node", a.Language)
+
+	var out bytes.Buffer
+	written, err := writeInitFiles(dir, a, false, &out)
+	require.NoError(t, err)
+	assert.Equal(t, []string{util.RegistryFilename, util.RunConfigFilename, initWorkflowPath}, written)
+	assert.Contains(t, out.String(), "Skipped skaffold.yaml")
+	data, _ := os.ReadFile(filepath.Join(dir, "skaffold.yaml"))
+	assert.Equal(t, "keep", string(data))
+
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("GITHUB_REPOSITORY_OWNER", "my-org")
+	repo, err := util.GetDefaultRepoFromRegistry(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/my-org", repo)
+	cfg, err := util.LoadRunConfig(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"8080:8080"}, cfg.Contexts[a.Image].Ports)
+
+	written, err = writeInitFiles(dir, a, true, &out)
+	require.NoError(t, err)
+	assert.Len(t, written, 4)
+	data, _ = os.ReadFile(filepath.Join(dir, "skaffold.yaml"))
+	assert.Contains(t, string(data), "buildpacks:")
+}
@@ -0,0 +1,400 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// Buildpack image labels read by `op inspect`.
+const (
+	buildpackBuildLabel   = "io.buildpacks.build.metadata"
+	buildpackStackIDLabel = "io.buildpacks.stack.id"
+	ociBaseNameLabel      = "org.opencontainers.image.base.name"
+	ociBaseDigestLabel    = "org.opencontainers.image.base.digest"
+)
+
+// imageInspection is what `op inspect` reports for a ref; Index is set when
+// the ref is a manifest list, Image describes the selected platform image.
+type imageInspection struct {
+	Ref    string            `json:"ref"`
+	Digest string            `json:"digest"`
+	Index  []indexChild      `json:"index,omitempty"`
+	Image  *imageDescription `json:"image"`
+}
+
+type indexChild struct {
+	Platform string `json:"platform"`
+	Digest   string `json:"digest"`
+	Size     int64  `json:"size"`
+}
+
+type imageDescription struct {
+	Digest     string            `json:"digest"`
+	MediaType  string            `json:"mediaType"`
+	Platform   string            `json:"platform"`
+	Created    string            `json:"created,omitempty"`
+	User       string            `json:"user,omitempty"`
+	WorkingDir string            `json:"workingDir,omitempty"`
+	Entrypoint []string          `json:"entrypoint,omitempty"`
+	Cmd        []string          `json:"cmd,omitempty"`
+	Env        []string          `json:"env,omitempty"`
+	Ports      []string          `json:"ports,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Layers     []imageLayer      `json:"layers"`
+	Size       int64             `json:"size"`
+	BaseImage  string            `json:"baseImage,omitempty"`
+	Buildpacks *buildpackInfo    `json:"buildpacks,omitempty"`
+}
+
+type imageLayer struct {
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	CreatedBy string `json:"createdBy,omitempty"`
+}
+
+// buildpackInfo is the buildpack metadata of an image built by the CNB
+// lifecycle, from its io.buildpacks.* labels.
+type buildpackInfo struct {
+	StackID    string             `json:"stackId,omitempty"`
+	RunImage   string             `json:"runImage,omitempty"`
+	RunTop     string             `json:"runImageTopLayer,omitempty"`
+	Buildpacks []string           `json:"buildpacks,omitempty"`
+	Processes  []buildpackProcess `json:"processes,omitempty"`
+}
+
+type buildpackProcess struct {
+	Type    string `json:"type"`
+	Command string `json:"command"`
+	Default bool   `json:"default,omitempty"`
+}
+
+// parseBuildpackInfo reads the io.buildpacks.* labels; nil when the image was
+// not built with buildpacks.
+func parseBuildpackInfo(labels map[string]string) (*buildpackInfo, error) {
+	lifecycle, build := labels[buildpackMetadataLabel], labels[buildpackBuildLabel]
+	if lifecycle == "" && build == "" {
+		return nil, nil
+	}
+	info := &buildpackInfo{StackID: labels[buildpackStackIDLabel]}
+	if lifecycle != "" {
+		type runImage struct {
+			TopLayer  string `json:"topLayer"`
+			Reference string `json:"reference"`
+			Image     string `json:"image"`
+		}
+		var md struct {
+			RunImage runImage `json:"runImage"`
+			Stack    struct {
+				RunImage runImage `json:"runImage"`
+			} `json:"stack"`
+		}
+		if err := json.Unmarshal([]byte(lifecycle), &md); err != nil {
+			return nil, fmt.Errorf("parsing %s label: %w", buildpackMetadataLabel, err)
+		}
+		info.RunImage = firstNonEmpty(md.RunImage.Reference, md.RunImage.Image, md.Stack.RunImage.Image)
+		info.RunTop = md.RunImage.TopLayer
+	}
+	if build != "" {
+		var md struct {
+			Buildpacks []struct {
+				ID      string `json:"id"`
+				Version string `json:"version"`
+			} `json:"buildpacks"`
+			Processes []struct {
+				Type    string   `json:"type"`
+				Command any      `json:"command"`
+				Args    []string `json:"args"`
+				Default bool     `json:"default"`
+			} `json:"processes"`
+		}
+		if err := json.Unmarshal([]byte(build), &md); err != nil {
+			return nil, fmt.Errorf("parsing %s label: %w", buildpackBuildLabel, err)
+		}
+		for _, bp := range md.Buildpacks {
+			info.Buildpacks = append(info.Buildpacks, bp.ID+"@"+bp.Version)
+		}
+		for _, p := range md.Processes {
+			// Platform API < 0.10 uses a string command, later versions a list.
+			var command []string
+			switch c := p.Command.(type) {
+			case string:
+				command = []string{c}
+			case []any:
+				for _, s := range c {
+					command = append(command, fmt.Sprint(s))
+				}
+			}
+			info.Processes = append(info.Processes, buildpackProcess{Type: p.Type, Command: strings.Join(append(command, p.Args...), " "), Default: p.Default})
+		}
+	}
+	return info, nil
+}
+
+func platformString(p *v1.Platform) string {
+	if p == nil {
+		return ""
+	}
+	return p.String()
+}
+
+// describeImage collects the config, layers and buildpack metadata of img.
+func describeImage(img v1.Image) (*imageDescription, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, err
+	}
+	mediaType, _ := img.MediaType()
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	d := &imageDescription{
+		Digest:     digest.String(),
+		MediaType:  string(mediaType),
+		Platform:   platformString(cfg.Platform()),
+		User:       cfg.Config.User,
+		WorkingDir: cfg.Config.WorkingDir,
+		Entrypoint: cfg.Config.Entrypoint,
+		Cmd:        cfg.Config.Cmd,
+		Env:        cfg.Config.Env,
+		Labels:     cfg.Config.Labels,
+	}
+	if !cfg.Created.IsZero() {
+		d.Created = cfg.Created.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	for p := range cfg.Config.ExposedPorts {
+		d.Ports = append(d.Ports, p)
+	}
+	sort.Strings(d.Ports)
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	// History has an entry per layer plus empty_layer entries for config-only steps.
+	var createdBy []string
+	for _, h := range cfg.History {
+		if !h.EmptyLayer {
+			createdBy = append(createdBy, h.CreatedBy)
+		}
+	}
+	for i, l := range manifest.Layers {
+		layer := imageLayer{Digest: l.Digest.String(), Size: l.Size}
+		if len(createdBy) == len(manifest.Layers) {
+			layer.CreatedBy = createdBy[i]
+		}
+		d.Layers = append(d.Layers, layer)
+		d.Size += l.Size
+	}
+
+	if d.Buildpacks, err = parseBuildpackInfo(cfg.Config.Labels); err != nil {
+		return nil, err
+	}
+	if base := cfg.Config.Labels[ociBaseNameLabel]; base != "" {
+		d.BaseImage = base
+		if digest := cfg.Config.Labels[ociBaseDigestLabel]; digest != "" {
+			d.BaseImage += "@" + digest
+		}
+	}
+	return d, nil
+}
+
+// inspectRef reads ref from the registry. For an index, the children are
+// listed and the image for platform (os/arch[/variant]) is described.
+func inspectRef(ctx context.Context, ref, platform string, insecure []string) (*imageInspection, error) {
+	parsed, err := parseReferenceForRemote(ref, insecure)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", ref, err)
+	}
+	opts := remoteOptionsFor(ctx, ref, insecure)
+	desc, err := remoteGet(ctx, parsed, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", ref, err)
+	}
+	out := &imageInspection{Ref: ref, Digest: desc.Digest.String()}
+
+	var img v1.Image
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return nil, err
+		}
+		im, err := idx.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		want, err := v1.ParsePlatform(platform)
+		if err != nil {
+			return nil, err
+		}
+		var selected *v1.Hash
+		for _, m := range im.Manifests {
+			out.Index = append(out.Index, indexChild{Platform: platformString(m.Platform), Digest: m.Digest.String(), Size: m.Size})
+			if selected == nil && m.Platform != nil && m.Platform.Satisfies(*want) {
+				h := m.Digest
+				selected = &h
+			}
+		}
+		if selected == nil {
+			return nil, fmt.Errorf("%s has no image for platform %s", ref, platform)
+		}
+		if img, err = idx.Image(*selected); err != nil {
+			return nil, err
+		}
+	} else if img, err = desc.Image(); err != nil {
+		return nil, err
+	}
+	if out.Image, err = describeImage(img); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", ref, err)
+	}
+	return out, nil
+}
+
+// inspectTarget maps an artifact name from build_result.json to its pushed
+// tag; anything else is used as an image ref.
+func inspectTarget(arg, buildResultDir string) string {
+	res, err := util.ReadBuildResult(buildResultDir)
+	if err != nil {
+		return arg
+	}
+	if tag, err := util.GetTagForImage(res, arg); err == nil {
+		return tag
+	}
+	return arg
+}
+
+// printInspection writes i in a human-readable layout.
+func printInspection(w io.Writer, i *imageInspection) {
+	fmt.Fprintf(w, "Ref:      %s\nDigest:   %s\n", i.Ref, i.Digest)
+	if len(i.Index) > 0 {
+		fmt.Fprintf(w, "Index:    %d platform(s)\n", len(i.Index))
+		for _, c := range i.Index {
+			fmt.Fprintf(w, "  %-16s %s  %s\n", firstNonEmpty(c.Platform, "unknown"), c.Digest, humanSize(c.Size))
+		}
+		fmt.Fprintf(w, "\nImage (%s): %s\n", i.Image.Platform, i.Image.Digest)
+	}
+	d := i.Image
+	fmt.Fprintf(w, "Platform: %s\nCreated:  %s\nSize:     %s (compressed)\n", d.Platform, firstNonEmpty(d.Created, "-"), humanSize(d.Size))
+	if d.BaseImage != "" {
+		fmt.Fprintf(w, "Base:     %s\n", d.BaseImage)
+	}
+
+	fmt.Fprintln(w, "\nConfig:")
+	fmt.Fprintf(w, "  User:       %s\n", firstNonEmpty(d.User, "(root)"))
+	fmt.Fprintf(w, "  WorkingDir: %s\n", firstNonEmpty(d.WorkingDir, "/"))
+	fmt.Fprintf(w, "  Entrypoint: %s\n", firstNonEmpty(strings.Join(d.Entrypoint, " "), "-"))
+	fmt.Fprintf(w, "  Cmd:        %s\n", firstNonEmpty(strings.Join(d.Cmd, " "), "-"))
+	if len(d.Ports) > 0 {
+		fmt.Fprintf(w, "  Ports:      %s\n", strings.Join(d.Ports, ", "))
+	}
+	if len(d.Env) > 0 {
+		fmt.Fprintln(w, "  Env:")
+		for _, e := range d.Env {
+			fmt.Fprintf(w, "    %s\n", e)
+		}
+	}
+	if len(d.Labels) > 0 {
+		fmt.Fprintln(w, "  Labels:")
+		keys := make([]string, 0, len(d.Labels))
+		for k := range d.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			// The buildpack metadata labels are large JSON documents summarised below.
+			if strings.HasPrefix(k, "io.buildpacks.") && strings.HasSuffix(k, ".metadata") {
+				fmt.Fprintf(w, "    %s: (%s)\n", k, humanSize(int64(len(d.Labels[k]))))
+				continue
+			}
+			fmt.Fprintf(w, "    %s: %s\n", k, d.Labels[k])
+		}
+	}
+
+	if bp := d.Buildpacks; bp != nil {
+		fmt.Fprintln(w, "\nBuildpacks:")
+		if bp.StackID != "" {
+			fmt.Fprintf(w, "  Stack:     %s\n", bp.StackID)
+		}
+		if bp.RunImage != "" {
+			fmt.Fprintf(w, "  Run image: %s\n", bp.RunImage)
+		}
+		if bp.RunTop != "" {
+			fmt.Fprintf(w, "  Run image top layer: %s\n", bp.RunTop)
+		}
+		for _, b := range bp.Buildpacks {
+			fmt.Fprintf(w, "  - %s\n", b)
+		}
+		if len(bp.Processes) > 0 {
+			fmt.Fprintln(w, "  Processes:")
+			for _, p := range bp.Processes {
+				def := ""
+				if p.Default {
+					def = " (default)"
+				}
+				fmt.Fprintf(w, "    %s%s: %s\n", p.Type, def, p.Command)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\nLayers (%d):\n", len(d.Layers))
+	for _, l := range d.Layers {
+		fmt.Fprintf(w, "  %s  %10s  %s\n", l.Digest, humanSize(l.Size), truncate(l.CreatedBy, 80))
+	}
+}
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <ref|artifact>",
+	Short: "Show an image's config, layers, platforms and buildpack metadata.",
+	Long: `Read an image from the registry and print its config (user, workdir,
+entrypoint, cmd, env, ports, labels), its layers with sizes and the command
+that created them, the platform children of an index, the base image (OCI
+base labels) and, for buildpack images, the stack, run image, buildpacks and
+processes from the io.buildpacks.* labels.
+
+The argument is an image ref or an artifact name from build_result.json
+(--build-result-dir). For an index, the image for --platform is described
+(default: linux and the host architecture). --json prints the same data as
+JSON for scripts.
+
+  op inspect ghcr.io/my-org/my-app:1.2.3
+  op inspect my-app --platform linux/arm64
+  op inspect my-app --json | jq .image.buildpacks`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeBuildResultImages,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		platform, _ := cmd.Flags().GetString("platform")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+
+		i, err := inspectRef(cmd.Context(), inspectTarget(args[0], buildResultDir), platform, insecureRegistries(insecureFlag))
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(i)
+		}
+		printInspection(os.Stdout, i)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+	inspectCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json, used to resolve artifact names")
+	inspectCmd.Flags().String("platform", "linux/"+runtime.GOARCH, "Platform of an index to describe (os/arch[/variant])")
+	inspectCmd.Flags().Bool("json", false, "Print the inspection as JSON")
+	inspectCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+}
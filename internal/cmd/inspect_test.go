@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBuildpackInfo(t *testing.T) {
+	info, err := parseBuildpackInfo(map[string]string{"maintainer": "me"})
+	require.NoError(t, err)
+	assert.Nil(t, info)
+
+	info, err = parseBuildpackInfo(map[string]string{
+		buildpackStackIDLabel:  "io.buildpacks.stacks.jammy",
+		buildpackMetadataLabel: `{"runImage":{"topLayer":"sha256:top","reference":"ghcr.io/octopilot/run@sha256:abc"}}`,
+		buildpackBuildLabel: `{"buildpacks":[{"id":"paketo-buildpacks/go","version":"4.0.0"}],
+			"processes":[{"type":"web","command":["/cnb/process/web"],"args":["--port","8080"],"default":true},{"type":"worker","command":"worker"}]}`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &buildpackInfo{
+		StackID:    "io.buildpacks.stacks.jammy",
+		RunImage:   "ghcr.io/octopilot/run@sha256:abc",
+		RunTop:     "sha256:top",
+		Buildpacks: []string{"paketo-buildpacks/go@4.0.0"},
+		Processes: []buildpackProcess{
+			{Type: "web", Command: "/cnb/process/web --port 8080", Default: true},
+			{Type: "worker", Command: "worker"},
+		},
+	}, info)
+
+	// Older lifecycles record the run image under stack.
+	info, err = parseBuildpackInfo(map[string]string{buildpackMetadataLabel: `{"stack":{"runImage":{"image":"cnbs/run"}}}`})
+	require.NoError(t, err)
+	assert.Equal(t, "cnbs/run", info.RunImage)
+
+	_, err = parseBuildpackInfo(map[string]string{buildpackBuildLabel: "{"})
+	assert.ErrorContains(t, err, buildpackBuildLabel)
+}
+
+func pushInspectImage(t *testing.T, ref string, platform v1.Platform) v1.Image {
+	t.Helper()
+	img, err := random.Image(256, 2)
+	require.NoError(t, err)
+	cfg, err := img.ConfigFile()
+	require.NoError(t, err)
+	cfg = cfg.DeepCopy()
+	cfg.OS, cfg.Architecture = platform.OS, platform.Architecture
+	cfg.Config.User = "1000"
+	cfg.Config.Entrypoint = []string{"/cnb/lifecycle/launcher"}
+	cfg.Config.Env = []string{"PORT=8080"}
+	cfg.Config.ExposedPorts = map[string]struct{}{"8080/tcp": {}}
+	cfg.Config.Labels = map[string]string{
+		ociBaseNameLabel:       "ghcr.io/octopilot/run:jammy",
+		buildpackMetadataLabel: `{"runImage":{"reference":"ghcr.io/octopilot/run@sha256:abc"}}`,
+	}
+	cfg.History = []v1.History{{CreatedBy: "layer one"}, {CreatedBy: "ENV PORT=8080", EmptyLayer: true}, {CreatedBy: "layer two"}}
+	img, err = mutate.ConfigFile(img, cfg)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, ref))
+	return img
+}
+
+func TestInspectRef_Image(t *testing.T) {
+	host := startTestRegistry(t)
+	ref := host + "/org/app:1"
+	pushInspectImage(t, ref, v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	i, err := inspectRef(t.Context(), ref, "linux/amd64", nil)
+	require.NoError(t, err)
+	assert.Empty(t, i.Index)
+	assert.Equal(t, i.Digest, i.Image.Digest)
+	assert.Equal(t, "linux/amd64", i.Image.Platform)
+	assert.Equal(t, []string{"8080/tcp"}, i.Image.Ports)
+	require.Len(t, i.Image.Layers, 2)
+	assert.Equal(t, "layer two", i.Image.Layers[1].CreatedBy)
+	assert.Equal(t, "ghcr.io/octopilot/run:jammy", i.Image.BaseImage)
+	require.NotNil(t, i.Image.Buildpacks)
+	assert.Equal(t, "ghcr.io/octopilot/run@sha256:abc", i.Image.Buildpacks.RunImage)
+
+	var out bytes.Buffer
+	printInspection(&out, i)
+	assert.Contains(t, out.String(), "User:       1000")
+	assert.Contains(t, out.String(), "Run image: ghcr.io/octopilot/run@sha256:abc")
+	assert.Contains(t, out.String(), buildpackMetadataLabel+": (")
+	assert.Contains(t, out.String(), "Layers (2):")
+}
+
+func TestInspectRef_Index(t *testing.T) {
+	host := startTestRegistry(t)
+	amd := pushInspectImage(t, host+"/org/app:amd64", v1.Platform{OS: "linux", Architecture: "amd64"})
+	arm := pushInspectImage(t, host+"/org/app:arm64", v1.Platform{OS: "linux", Architecture: "arm64"})
+	idx := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: amd, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}}},
+		mutate.IndexAddendum{Add: arm, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}}},
+	)
+	tag, err := name.NewTag(host + "/org/app:multi")
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(tag, idx))
+
+	i, err := inspectRef(t.Context(), tag.String(), "linux/arm64", nil)
+	require.NoError(t, err)
+	require.Len(t, i.Index, 2)
+	assert.Equal(t, "linux/amd64", i.Index[0].Platform)
+	armDigest, _ := arm.Digest()
+	assert.Equal(t, armDigest.String(), i.Image.Digest)
+	assert.Equal(t, "linux/arm64", i.Image.Platform)
+
+	var out bytes.Buffer
+	printInspection(&out, i)
+	assert.Contains(t, out.String(), "Index:    2 platform(s)")
+
+	_, err = inspectRef(t.Context(), tag.String(), "linux/s390x", nil)
+	assert.ErrorContains(t, err, "no image for platform linux/s390x")
+}
+
+func TestInspectTarget(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, "ghcr.io/org/app:1", inspectTarget("ghcr.io/org/app:1", dir))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.BuildResultFilename), []byte(`{"builds":[{"imageName":"app","tag":"ghcr.io/org/app:v2@`+testDigest+`"}]}`), 0o644))
+	assert.Equal(t, "ghcr.io/org/app:v2@"+testDigest, inspectTarget("app", dir))
+	assert.Equal(t, "other:1", inspectTarget("other:1", dir))
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/latest"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/pack"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/octopilot/octopilot-pipeline-tools/pkg/pipeline"
+	"github.com/spf13/cobra"
+)
+
+// localImageID returns the ID of ref in the local daemon (docker or podman).
+// It is a var so tests can replace it.
+var localImageID = func(ctx context.Context, ref string) (string, error) {
+	out, err := exec.CommandContext(ctx, util.ContainerCLI(), "image", "inspect", "--format", "{{.Id}}", ref).Output()
+	if err != nil {
+		return "", fmt.Errorf("inspecting local image %s: %w", ref, err)
+	}
+	id := strings.TrimSpace(string(out))
+	if !strings.HasPrefix(id, "sha256:") {
+		// podman prints the bare hex.
+		id = "sha256:" + id
+	}
+	return id, nil
+}
+
+// recordLocalImageIDs sets the ImageID of the builds left in the local
+// daemon (no digest), so op run and op test can find them.
+func recordLocalImageIDs(ctx context.Context, builds []util.BuildEntry) {
+	for i, b := range builds {
+		if b.ArtifactKind() != pipeline.ArtifactKindImage || b.ImageDigest() != "" || b.ImageID != "" {
+			continue
+		}
+		id, err := localImageID(ctx, b.Tag)
+		if err != nil {
+			util.ArtifactLogger(b.ImageName).Warn("Could not read the local image ID for build_result.json", util.LogKeyTag, b.Tag, "error", err)
+			continue
+		}
+		builds[i].ImageID = id
+	}
+}
+
+// localArtifactTag is the tag of an artifact op build --load leaves in the
+// local daemon: <repo>/<image>:latest, as op build --push would push it.
+func localArtifactTag(repo, imageName string) string {
+	switch {
+	case repo == "":
+		return imageName + ":latest"
+	case strings.HasSuffix(repo, "/"):
+		return repo + imageName + ":latest"
+	default:
+		return repo + "/" + imageName + ":latest"
+	}
+}
+
+// splitLoadArtifacts splits artifacts into the buildpack artifacts op build
+// --load builds itself with Pack and the others, which Skaffold builds.
+func splitLoadArtifacts(artifacts []*latest.Artifact) (load, rest []*latest.Artifact) {
+	for _, a := range artifacts {
+		if a.BuildpackArtifact != nil && !strings.HasSuffix(a.ImageName, "-chart") {
+			load = append(load, a)
+		} else {
+			rest = append(rest, a)
+		}
+	}
+	return load, rest
+}
+
+// loadBuildpackArtifacts builds the buildpack artifacts of op build --load
+// into the local daemon with Pack, with the same env, buildpacks and
+// project.toml as op build --push, and returns their build_result.json
+// entries. platform is "" for the daemon's own; created is the creation time
+// of a reproducible build (else zero, Pack's fixed time).
+func loadBuildpackArtifacts(ctx context.Context, cmd *cobra.Command, cwd, repo, platform string, created time.Time, artifacts []*latest.Artifact, runCfg *util.RunConfig, insecure []string, out io.Writer) ([]util.BuildEntry, error) {
+	var built []util.BuildEntry
+	for _, art := range artifacts {
+		started := time.Now()
+		artCfg := runCfg.ArtifactBuild(art.ImageName)
+		tag := localArtifactTag(repo, art.ImageName)
+		log := util.ArtifactLogger(art.ImageName)
+		log.Info("Building artifact into the local daemon", util.LogKeyTag, tag)
+
+		env, err := buildpackEnv(ctx, art, artCfg, map[string]string{
+			"BP_GO_PRIVATE": "github.com/octopilot/*",
+		})
+		if err != nil {
+			return built, err
+		}
+		po := pack.BuildOptions{
+			ImageName:          tag,
+			Builder:            art.BuildpackArtifact.Builder,
+			Path:               filepath.Join(cwd, art.Workspace),
+			Publish:            false,
+			RunImage:           art.BuildpackArtifact.RunImage,
+			Target:             platform,
+			Env:                env,
+			SBOMDir:            artifactSBOMDir(cmd, artCfg),
+			InsecureRegistries: insecure,
+			Verbose:            util.Verbose(),
+			Quiet:              util.Quiet(),
+			Buildpacks:         artifactBuildpacks(cmd, art, artCfg),
+		}
+		if !created.IsZero() {
+			po.CreationTime = &created
+		}
+		if err := packBuild(ctx, po, out); err != nil {
+			return built, util.WithExitCode(util.ExitBuild, fmt.Errorf("pack build failed for %s: %w", art.ImageName, err))
+		}
+
+		entry := builtEntry(art.ImageName, tag, pipeline.ArtifactKindImage, started)
+		entry.Builder = art.BuildpackArtifact.Builder
+		entry.RunImage = art.BuildpackArtifact.RunImage
+		if po.SBOMDir != "" {
+			entry.SBOM = []string{po.SBOMDir}
+		}
+		built = append(built, entry)
+		log.Info("Loaded image", util.LogKeyTag, tag)
+	}
+	recordLocalImageIDs(ctx, built)
+	return built, nil
+}
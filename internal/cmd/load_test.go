@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/latest"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/pack"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubLocalImageID(t *testing.T, ids map[string]string) {
+	t.Helper()
+	orig := localImageID
+	t.Cleanup(func() { localImageID = orig })
+	localImageID = func(_ context.Context, ref string) (string, error) {
+		if id, ok := ids[ref]; ok {
+			return id, nil
+		}
+		return "", errors.New("no such image: " + ref)
+	}
+}
+
+func TestLocalArtifactTag(t *testing.T) {
+	assert.Equal(t, "my-app:latest", localArtifactTag("", "my-app"))
+	assert.Equal(t, "localhost:5001/my-app:latest", localArtifactTag("localhost:5001", "my-app"))
+	assert.Equal(t, "ghcr.io/org/my-app:latest", localArtifactTag("ghcr.io/org/", "my-app"))
+}
+
+func TestSplitLoadArtifacts(t *testing.T) {
+	api := &latest.Artifact{ImageName: "api", ArtifactType: latest.ArtifactType{BuildpackArtifact: &latest.BuildpackArtifact{}}}
+	chart := &latest.Artifact{ImageName: "api-chart", ArtifactType: latest.ArtifactType{BuildpackArtifact: &latest.BuildpackArtifact{}}}
+	web := &latest.Artifact{ImageName: "web", ArtifactType: latest.ArtifactType{DockerArtifact: &latest.DockerArtifact{}}}
+
+	load, rest := splitLoadArtifacts([]*latest.Artifact{api, chart, web})
+	assert.Equal(t, []*latest.Artifact{api}, load)
+	assert.Equal(t, []*latest.Artifact{chart, web}, rest)
+}
+
+func TestRecordLocalImageIDs(t *testing.T) {
+	stubLocalImageID(t, map[string]string{"localhost:5001/web:4f2a": "sha256:4f2a"})
+	builds := []util.BuildEntry{
+		{ImageName: "web", Tag: "localhost:5001/web:4f2a"},
+		{ImageName: "api", Tag: "ghcr.io/org/api:latest@sha256:aaa"},
+		{ImageName: "gone", Tag: "localhost:5001/gone:latest"},
+	}
+	recordLocalImageIDs(t.Context(), builds)
+	assert.Equal(t, "sha256:4f2a", builds[0].ImageID)
+	assert.True(t, builds[0].IsLocal())
+	assert.Empty(t, builds[1].ImageID, "pushed")
+	assert.Empty(t, builds[2].ImageID, "not in the daemon")
+}
+
+func TestLoadBuildpackArtifacts(t *testing.T) {
+	stubLocalImageID(t, map[string]string{"localhost:5001/api:latest": "sha256:1234"})
+	orig := packBuild
+	t.Cleanup(func() { packBuild = orig })
+	var got []pack.BuildOptions
+	packBuild = func(_ context.Context, opts pack.BuildOptions, _ io.Writer) error {
+		got = append(got, opts)
+		return nil
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().StringArray("buildpack", nil, "")
+	artifacts := []*latest.Artifact{{ImageName: "api", Workspace: "api", ArtifactType: latest.ArtifactType{BuildpackArtifact: &latest.BuildpackArtifact{
+		Builder: "ghcr.io/octopilot/builder-jammy-base:latest",
+		Env:     []string{"BP_GO_VERSION=1.25"},
+	}}}}
+	runCfg := &util.RunConfig{}
+	runCfg.Build.Artifacts = map[string]util.ArtifactBuildOpts{"api": {Env: map[string]string{"BP_GO_TARGETS": "./cmd/api"}}}
+
+	created := time.Unix(1767225600, 0).UTC()
+	built, err := loadBuildpackArtifacts(context.Background(), cmd, "/src", "localhost:5001", "linux/arm64", created, artifacts, runCfg, nil, io.Discard)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "localhost:5001/api:latest", got[0].ImageName)
+	assert.False(t, got[0].Publish)
+	assert.Equal(t, "/src/api", got[0].Path)
+	assert.Equal(t, "linux/arm64", got[0].Target)
+	assert.Equal(t, "1.25", got[0].Env["BP_GO_VERSION"])
+	assert.Equal(t, "./cmd/api", got[0].Env["BP_GO_TARGETS"])
+	assert.Equal(t, &created, got[0].CreationTime)
+
+	require.Len(t, built, 1)
+	assert.Equal(t, "localhost:5001/api:latest", built[0].Tag)
+	assert.Equal(t, "sha256:1234", built[0].ImageID)
+	assert.Empty(t, built[0].Digest)
+
+	packBuild = func(context.Context, pack.BuildOptions, io.Writer) error { return errors.New("builder not found") }
+	_, err = loadBuildpackArtifacts(context.Background(), cmd, "/src", "localhost:5001", "", time.Time{}, artifacts, runCfg, nil, io.Discard)
+	assert.ErrorContains(t, err, "pack build failed for api: builder not found")
+	assert.Equal(t, util.ExitBuild, util.ExitCode(err))
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/latest"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// isFloatingRef reports whether ref names an image by a mutable tag rather
+// than a digest.
+func isFloatingRef(ref string) bool {
+	return ref != "" && !strings.Contains(ref, "@sha256:")
+}
+
+// lockedImage returns ref, the builder or run image (role) of artifact,
+// pinned by lock. A floating ref lock does not pin is used as is with a
+// warning, or is an error when strict.
+func lockedImage(artifact, role, ref string, lock *util.ImageLock, strict bool) (string, error) {
+	if pinned, ok := lock.Pinned(ref); ok {
+		return pinned, nil
+	}
+	if !isFloatingRef(ref) {
+		return ref, nil
+	}
+	if strict {
+		return "", fmt.Errorf("%s %s of %s is a mutable tag: pin it with `op lock` or a digest", role, ref, artifact)
+	}
+	slog.Warn("Buildpack image is a mutable tag; rebuilds may differ (pin it with `op lock`)", util.LogKeyArtifact, artifact, "role", role, "image", ref)
+	return ref, nil
+}
+
+// lockBuildpackImages replaces the builders and run images of the buildpack
+// artifacts with their pinned digests (see lockedImage). Run images that are
+// artifacts of all are left to the build.
+func lockBuildpackImages(artifacts, all []*latest.Artifact, lock *util.ImageLock, strict bool) error {
+	images := map[string]bool{}
+	for _, a := range all {
+		images[a.ImageName] = true
+	}
+	for _, a := range artifacts {
+		bp := a.BuildpackArtifact
+		if bp == nil {
+			continue
+		}
+		var err error
+		if bp.Builder, err = lockedImage(a.ImageName, "builder", bp.Builder, lock, strict); err != nil {
+			return err
+		}
+		if images[bp.RunImage] {
+			continue
+		}
+		if bp.RunImage, err = lockedImage(a.ImageName, "run image", bp.RunImage, lock, strict); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockImages resolves the floating builders and run images of artifacts to
+// digests. Run images that are themselves artifacts are built, not locked.
+func lockImages(ctx context.Context, artifacts []artifactInfo, insecure []string) (*util.ImageLock, error) {
+	images := map[string]bool{}
+	for _, a := range artifacts {
+		images[a.Image] = true
+	}
+	lock := &util.ImageLock{Images: map[string]string{}}
+	for _, a := range artifacts {
+		for _, ref := range []string{a.BuilderImage, a.RunImage} {
+			if !isFloatingRef(ref) || images[ref] || lock.Images[ref] != "" {
+				continue
+			}
+			pinned, err := resolveDigestRef(ctx, ref, insecure)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", a.Image, err)
+			}
+			lock.Images[ref] = pinned
+		}
+	}
+	return lock, nil
+}
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Pin the buildpack builders and run images of skaffold.yaml to digests.",
+	Long: `Resolve every buildpack builder and run image of skaffold.yaml that names a
+tag (paketobuildpacks/run-jammy-base:latest) to its current digest and write
+them to ` + util.ImageLockFilename + `. op build then uses the pinned digests, so a
+rebuild of the same commit uses the same base images.
+
+Run images that are artifacts of skaffold.yaml are built, not locked. Run
+op lock again (e.g. from a scheduled job) to move to newer images.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		file, _ := cmd.Flags().GetString("filename")
+		profiles, _ := cmd.Flags().GetStringSlice("profile")
+		if val := viper.GetString("SKAFFOLD_PROFILE"); len(profiles) == 0 && val != "" {
+			profiles = strings.Split(val, ",")
+		}
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		artifacts, err := listArtifacts(cmd.Context(), file, profiles)
+		if err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
+		lock, err := lockImages(cmd.Context(), artifacts, insecureRegistries(insecureFlag))
+		if err != nil {
+			return err
+		}
+		if err := util.WriteImageLock(cwd, lock); err != nil {
+			return err
+		}
+		for _, ref := range slices.Sorted(maps.Keys(lock.Images)) {
+			slog.Info("Locked image", "image", ref, "pinned", lock.Images[ref])
+		}
+		slog.Info("Wrote image lock", "file", util.ImageLockFilename, "images", len(lock.Images))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lockCmd)
+	lockCmd.Flags().StringP("filename", "f", "skaffold.yaml", "Path to skaffold.yaml")
+	lockCmd.Flags().StringSliceP("profile", "p", nil, "Skaffold profile(s) to activate (default: $SKAFFOLD_PROFILE)")
+	lockCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated (e.g. localhost:5001,myreg:5000). Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+}
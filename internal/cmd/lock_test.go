@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/latest"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockImages(t *testing.T) {
+	host := startTestRegistry(t)
+	builder, run := host+"/org/builder:jammy", host+"/org/run:jammy"
+	pushInspectImage(t, builder, v1.Platform{OS: "linux", Architecture: "amd64"})
+	pushInspectImage(t, run, v1.Platform{OS: "linux", Architecture: "amd64"})
+	builderPinned, err := resolveDigestRef(t.Context(), builder, nil)
+	require.NoError(t, err)
+	runPinned, err := resolveDigestRef(t.Context(), run, nil)
+	require.NoError(t, err)
+
+	lock, err := lockImages(t.Context(), []artifactInfo{
+		{Image: "base", BuilderImage: builder, RunImage: run},
+		{Image: "api", BuilderImage: builder, RunImage: "base"},
+		{Image: "web", BuilderImage: builder, RunImage: runPinned},
+		{Image: "docker"},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{builder: builderPinned, run: runPinned}, lock.Images)
+
+	_, err = lockImages(t.Context(), []artifactInfo{{Image: "api", BuilderImage: host + "/org/builder:gone"}}, nil)
+	assert.ErrorContains(t, err, "api: resolving digest of "+host+"/org/builder:gone")
+
+	dir := t.TempDir()
+	require.NoError(t, util.WriteImageLock(dir, lock))
+	read, err := util.LoadImageLock(dir)
+	require.NoError(t, err)
+	assert.Equal(t, lock, read)
+}
+
+func TestLockBuildpackImages(t *testing.T) {
+	lock := &util.ImageLock{Images: map[string]string{
+		"paketobuildpacks/builder-jammy-base:latest": "index.docker.io/paketobuildpacks/builder-jammy-base@sha256:b1",
+	}}
+	artifacts := func() []*latest.Artifact {
+		return []*latest.Artifact{
+			{ImageName: "base", ArtifactType: latest.ArtifactType{DockerArtifact: &latest.DockerArtifact{}}},
+			{ImageName: "api", ArtifactType: latest.ArtifactType{BuildpackArtifact: &latest.BuildpackArtifact{
+				Builder: "paketobuildpacks/builder-jammy-base:latest", RunImage: "base",
+			}}},
+			{ImageName: "web", ArtifactType: latest.ArtifactType{BuildpackArtifact: &latest.BuildpackArtifact{
+				Builder: "paketobuildpacks/builder-jammy-base:latest", RunImage: "paketobuildpacks/run-jammy-base:latest",
+			}}},
+		}
+	}
+
+	arts := artifacts()
+	require.NoError(t, lockBuildpackImages(arts, arts, lock, false))
+	assert.Equal(t, "index.docker.io/paketobuildpacks/builder-jammy-base@sha256:b1", arts[1].BuildpackArtifact.Builder)
+	assert.Equal(t, "base", arts[1].BuildpackArtifact.RunImage, "artifacts are built, not locked")
+	assert.Equal(t, "paketobuildpacks/run-jammy-base:latest", arts[2].BuildpackArtifact.RunImage, "unpinned tags only warn")
+
+	arts = artifacts()
+	require.NoError(t, lockBuildpackImages(arts[:2], arts, lock, true))
+	err := lockBuildpackImages(arts, arts, lock, true)
+	assert.ErrorContains(t, err, "run image paketobuildpacks/run-jammy-base:latest of web is a mutable tag")
+}
@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// dockerConfigDir is the Docker config directory the default keychain reads
+// (DOCKER_CONFIG or ~/.docker).
+func dockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	return config.Dir()
+}
+
+// credentialKey is the key credentials for registry are stored under; Docker
+// Hub keeps the legacy index URL.
+func credentialKey(registry string) (string, error) {
+	reg, err := name.NewRegistry(registry)
+	if err != nil {
+		return "", err
+	}
+	if reg.Name() == name.DefaultRegistry {
+		return "https://index.docker.io/v1/", nil
+	}
+	return reg.Name(), nil
+}
+
+// storeRegistryCredentials saves auth for registry in the Docker config (or
+// the credential helper it configures), where op build and promote find it.
+func storeRegistryCredentials(registry string, auth types.AuthConfig) error {
+	key, err := credentialKey(registry)
+	if err != nil {
+		return err
+	}
+	cf, err := config.Load(dockerConfigDir())
+	if err != nil {
+		return err
+	}
+	auth.ServerAddress = key
+	if err := cf.GetCredentialsStore(key).Store(auth); err != nil {
+		return fmt.Errorf("storing credentials for %s: %w", key, err)
+	}
+	return cf.Save()
+}
+
+// eraseRegistryCredentials removes the credentials of registry.
+func eraseRegistryCredentials(registry string) error {
+	key, err := credentialKey(registry)
+	if err != nil {
+		return err
+	}
+	cf, err := config.Load(dockerConfigDir())
+	if err != nil {
+		return err
+	}
+	if err := cf.GetCredentialsStore(key).Erase(key); err != nil {
+		return fmt.Errorf("removing credentials for %s: %w", key, err)
+	}
+	return cf.Save()
+}
+
+// verifyRegistryLogin authenticates against registry with auth, as docker
+// login does. It is a var so tests can replace it.
+var verifyRegistryLogin = func(ctx context.Context, registry string, auth types.AuthConfig, insecure bool) error {
+	var opts []name.Option
+	if insecure {
+		opts = append(opts, name.Insecure)
+	}
+	reg, err := name.NewRegistry(registry, opts...)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	_, err = transport.NewWithContext(ctx, reg, authn.FromConfig(authn.AuthConfig{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		IdentityToken: auth.IdentityToken,
+	}), util.RegistryHTTPTransport(insecure), nil)
+	return err
+}
+
+// oidcLoginCommand returns the cloud CLI command that exchanges the ambient
+// workload identity (e.g. GitHub Actions OIDC federated by the provider's
+// auth action) for a registry token, and the username to pair it with.
+func oidcLoginCommand(registry string) (user string, command []string, err error) {
+	host := strings.Split(registry, "/")[0]
+	switch {
+	case host == "ghcr.io":
+		return "", nil, nil
+	case host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") || strings.HasSuffix(host, "-docker.pkg.dev"):
+		return "oauth2accesstoken", []string{"gcloud", "auth", "print-access-token"}, nil
+	case strings.Contains(host, ".dkr.ecr.") && strings.HasSuffix(host, ".amazonaws.com"):
+		// <account>.dkr.ecr.<region>.amazonaws.com
+		region := strings.Split(host, ".")[3]
+		return "AWS", []string{"aws", "ecr", "get-login-password", "--region", region}, nil
+	case strings.HasSuffix(host, ".azurecr.io"):
+		return "00000000-0000-0000-0000-000000000000", []string{"az", "acr", "login", "--name", strings.TrimSuffix(host, ".azurecr.io"),
+			"--expose-token", "--output", "tsv", "--query", "accessToken"}, nil
+	}
+	return "", nil, fmt.Errorf("--oidc is not supported for %s (supported: ghcr.io, gcr.io/*-docker.pkg.dev, *.dkr.ecr.*.amazonaws.com, *.azurecr.io)", host)
+}
+
+// oidcCommandOutput runs a cloud CLI token command. It is a var so tests can replace it.
+var oidcCommandOutput = func(ctx context.Context, command []string) (string, error) {
+	c := exec.CommandContext(ctx, command[0], command[1:]...)
+	c.Stderr = os.Stderr
+	out, err := c.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// oidcAuth returns registry credentials from the CI workload identity:
+// exchanged by op itself when .registry has oidc settings for registry,
+// otherwise from the provider's CLI.
+func oidcAuth(ctx context.Context, registry string) (types.AuthConfig, error) {
+	if cfg, ok := util.RegistryOIDCConfig("", registry); ok {
+		user, password, err := util.RegistryOIDCCredentials(ctx, registry, cfg)
+		if err != nil {
+			return types.AuthConfig{}, err
+		}
+		return types.AuthConfig{Username: user, Password: password}, nil
+	}
+	if user, token, ok := util.CIJobCredentials(registry); ok {
+		// GitLab's registry: the job's CI_JOB_TOKEN.
+		return types.AuthConfig{Username: user, Password: token}, nil
+	}
+	user, command, err := oidcLoginCommand(registry)
+	if err != nil {
+		return types.AuthConfig{}, err
+	}
+	if command == nil {
+		// ghcr.io: the workflow's GITHUB_TOKEN (packages: write permission).
+		token := os.Getenv("GITHUB_TOKEN")
+		if token == "" {
+			return types.AuthConfig{}, fmt.Errorf("--oidc for ghcr.io needs GITHUB_TOKEN (GitHub Actions)")
+		}
+		user = os.Getenv("GITHUB_ACTOR")
+		if user == "" {
+			user = "github-actions"
+		}
+		return types.AuthConfig{Username: user, Password: token}, nil
+	}
+	token, err := oidcCommandOutput(ctx, command)
+	if err != nil {
+		return types.AuthConfig{}, fmt.Errorf("%s: %w", strings.Join(command, " "), err)
+	}
+	return types.AuthConfig{Username: user, Password: token}, nil
+}
+
+// loginOptions are the credential flags of `op login`.
+type loginOptions struct {
+	Username      string
+	Password      string
+	PasswordStdin bool
+	TokenStdin    bool
+	OIDC          bool
+}
+
+// loginAuth builds the credentials for registry from o, reading secrets from
+// stdin or prompting on a terminal. A token with a username is stored as a
+// password (e.g. a GitHub PAT); without one as an identity (refresh) token.
+func loginAuth(ctx context.Context, registry string, o loginOptions, stdin io.Reader) (types.AuthConfig, error) {
+	if o.OIDC {
+		return oidcAuth(ctx, registry)
+	}
+	if o.PasswordStdin || o.TokenStdin {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return types.AuthConfig{}, err
+		}
+		secret := strings.TrimRight(string(data), "\r\n")
+		if secret == "" {
+			return types.AuthConfig{}, fmt.Errorf("empty secret on stdin")
+		}
+		if o.TokenStdin && o.Username == "" {
+			return types.AuthConfig{IdentityToken: secret}, nil
+		}
+		o.Password = secret
+	}
+	if o.Username == "" {
+		return types.AuthConfig{}, fmt.Errorf("--username is required (or use --token-stdin or --oidc)")
+	}
+	if o.Password == "" {
+		f, ok := stdin.(*os.File)
+		if !ok || !term.IsTerminal(int(f.Fd())) {
+			return types.AuthConfig{}, fmt.Errorf("no password: use --password-stdin in non-interactive sessions")
+		}
+		fmt.Fprint(os.Stderr, "Password: ")
+		pw, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return types.AuthConfig{}, err
+		}
+		o.Password = string(pw)
+	}
+	return types.AuthConfig{Username: o.Username, Password: o.Password}, nil
+}
+
+var loginCmd = &cobra.Command{
+	Use:   "login <registry>",
+	Short: "Log in to a container registry for op build, promote-image and friends.",
+	Long: `Store credentials for a registry in the Docker config (or the credential
+helper it configures with credsStore/credHelpers), which the keychain used by
+op build, promote-image, sign and the other registry commands consults.
+
+  op login ghcr.io -u my-user --password-stdin < token.txt   # username/password or PAT
+  op login registry.example.com --token-stdin < token.txt    # identity (refresh) token
+  op login europe-docker.pkg.dev --oidc                      # CI workload identity
+
+--oidc exchanges the CI identity for a registry token: with oidc settings
+for the registry in .registry, op exchanges the CI OIDC token itself (Google
+STS, AWS STS and ECR, or an Entra ID token exchanged with ACR); for ACR the
+service principal of AZURE_CLIENT_ID, AZURE_TENANT_ID and AZURE_CLIENT_SECRET
+when set; otherwise GITHUB_TOKEN for ghcr.io, CI_JOB_TOKEN for the GitLab
+registry of the job (CI_REGISTRY), or the gcloud,
+aws or az CLI already authenticated via OIDC (e.g. google-github-actions/auth,
+aws-actions/configure-aws-credentials, azure/login) for Artifact
+Registry/GCR, ECR and ACR. Credentials are
+checked against the registry before they are stored (skip with --no-verify).`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		o := loginOptions{}
+		o.Username, _ = cmd.Flags().GetString("username")
+		o.Password, _ = cmd.Flags().GetString("password")
+		o.PasswordStdin, _ = cmd.Flags().GetBool("password-stdin")
+		o.TokenStdin, _ = cmd.Flags().GetBool("token-stdin")
+		o.OIDC, _ = cmd.Flags().GetBool("oidc")
+		noVerify, _ := cmd.Flags().GetBool("no-verify")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		if o.Password != "" {
+			slog.Warn("--password is visible in the process list and shell history; prefer --password-stdin")
+		}
+
+		registry := args[0]
+		auth, err := loginAuth(cmd.Context(), registry, o, os.Stdin)
+		if err != nil {
+			return err
+		}
+		if !noVerify {
+			insecure := isInsecureRegistry(registry, insecureRegistries(insecureFlag)) || currentLocalRegistry().Matches(registry)
+			if err := verifyRegistryLogin(cmd.Context(), registry, auth, insecure); err != nil {
+				return fmt.Errorf("login to %s failed: %w", registry, err)
+			}
+		}
+		if err := storeRegistryCredentials(registry, auth); err != nil {
+			return err
+		}
+		slog.Info("Login succeeded", "registry", registry, "config", dockerConfigDir())
+		return nil
+	},
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout <registry>",
+	Short: "Remove stored credentials for a container registry.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := eraseRegistryCredentials(args[0]); err != nil {
+			return err
+		}
+		slog.Info("Removed credentials", "registry", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd)
+	loginCmd.Flags().StringP("username", "u", "", "Username")
+	loginCmd.Flags().StringP("password", "p", "", "Password (prefer --password-stdin)")
+	loginCmd.Flags().Bool("password-stdin", false, "Read the password from stdin")
+	loginCmd.Flags().Bool("token-stdin", false, "Read a token from stdin (identity token without --username, password with it)")
+	loginCmd.Flags().Bool("oidc", false, "Use the CI workload identity (GITHUB_TOKEN, CI_JOB_TOKEN, gcloud, aws or az)")
+	loginCmd.Flags().Bool("no-verify", false, "Store the credentials without checking them against the registry")
+	loginCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+	loginCmd.MarkFlagsMutuallyExclusive("password", "password-stdin", "token-stdin", "oidc")
+
+	rootCmd.AddCommand(logoutCmd)
+}
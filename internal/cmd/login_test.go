@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/cli/cli/config/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialKey(t *testing.T) {
+	for in, want := range map[string]string{
+		"ghcr.io":         "ghcr.io",
+		"localhost:5001":  "localhost:5001",
+		"docker.io":       "https://index.docker.io/v1/",
+		"index.docker.io": "https://index.docker.io/v1/",
+	} {
+		got, err := credentialKey(in)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, in)
+	}
+}
+
+func readDockerConfigAuths(t *testing.T, dir string) map[string]map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	require.NoError(t, err)
+	var cfg struct {
+		Auths map[string]map[string]string `json:"auths"`
+	}
+	require.NoError(t, json.Unmarshal(data, &cfg))
+	return cfg.Auths
+}
+
+func TestStoreAndEraseRegistryCredentials(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+
+	require.NoError(t, storeRegistryCredentials("ghcr.io", types.AuthConfig{Username: "me", Password: "secret"}))
+	require.NoError(t, storeRegistryCredentials("registry.example.com", types.AuthConfig{IdentityToken: "refresh"}))
+	auths := readDockerConfigAuths(t, dir)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("me:secret")), auths["ghcr.io"]["auth"])
+	assert.Equal(t, "refresh", auths["registry.example.com"]["identitytoken"])
+
+	require.NoError(t, eraseRegistryCredentials("ghcr.io"))
+	auths = readDockerConfigAuths(t, dir)
+	assert.NotContains(t, auths, "ghcr.io")
+	assert.Contains(t, auths, "registry.example.com")
+}
+
+func TestLoginAuth(t *testing.T) {
+	auth, err := loginAuth(t.Context(), "ghcr.io", loginOptions{Username: "me", PasswordStdin: true}, strings.NewReader("pat\n"))
+	require.NoError(t, err)
+	assert.Equal(t, types.AuthConfig{Username: "me", Password: "pat"}, auth)
+
+	auth, err = loginAuth(t.Context(), "registry.example.com", loginOptions{TokenStdin: true}, strings.NewReader("refresh\n"))
+	require.NoError(t, err)
+	assert.Equal(t, types.AuthConfig{IdentityToken: "refresh"}, auth)
+
+	auth, err = loginAuth(t.Context(), "ghcr.io", loginOptions{Username: "me", Password: "pw"}, strings.NewReader(""))
+	require.NoError(t, err)
+	assert.Equal(t, types.AuthConfig{Username: "me", Password: "pw"}, auth)
+
+	_, err = loginAuth(t.Context(), "ghcr.io", loginOptions{PasswordStdin: true}, strings.NewReader("pw"))
+	assert.ErrorContains(t, err, "--username is required")
+
+	_, err = loginAuth(t.Context(), "ghcr.io", loginOptions{Username: "me", PasswordStdin: true}, strings.NewReader("\n"))
+	assert.ErrorContains(t, err, "empty secret")
+
+	_, err = loginAuth(t.Context(), "ghcr.io", loginOptions{Username: "me"}, strings.NewReader(""))
+	assert.ErrorContains(t, err, "--password-stdin")
+}
+
+func TestOIDCLoginCommand(t *testing.T) {
+	user, command, err := oidcLoginCommand("europe-docker.pkg.dev/my-project/repo")
+	require.NoError(t, err)
+	assert.Equal(t, "oauth2accesstoken", user)
+	assert.Equal(t, []string{"gcloud", "auth", "print-access-token"}, command)
+
+	user, command, err = oidcLoginCommand("123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	require.NoError(t, err)
+	assert.Equal(t, "AWS", user)
+	assert.Equal(t, []string{"aws", "ecr", "get-login-password", "--region", "eu-west-1"}, command)
+
+	_, command, err = oidcLoginCommand("myregistry.azurecr.io")
+	require.NoError(t, err)
+	assert.Equal(t, "myregistry", command[4])
+
+	_, _, err = oidcLoginCommand("registry.example.com")
+	assert.Error(t, err)
+}
+
+func TestOIDCAuth(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "ghs_token")
+	t.Setenv("GITHUB_ACTOR", "octocat")
+	auth, err := oidcAuth(t.Context(), "ghcr.io")
+	require.NoError(t, err)
+	assert.Equal(t, types.AuthConfig{Username: "octocat", Password: "ghs_token"}, auth)
+
+	orig := oidcCommandOutput
+	t.Cleanup(func() { oidcCommandOutput = orig })
+	var ran []string
+	oidcCommandOutput = func(_ context.Context, command []string) (string, error) {
+		ran = command
+		return "ya29.token", nil
+	}
+	auth, err = oidcAuth(t.Context(), "gcr.io")
+	require.NoError(t, err)
+	assert.Equal(t, types.AuthConfig{Username: "oauth2accesstoken", Password: "ya29.token"}, auth)
+	assert.Equal(t, "gcloud", ran[0])
+
+	t.Setenv("GITHUB_ACTIONS", "")
+	t.Setenv("GITLAB_CI", "true")
+	t.Setenv("CI_REGISTRY", "registry.gitlab.com")
+	t.Setenv("CI_JOB_TOKEN", "job-token")
+	auth, err = oidcAuth(t.Context(), "registry.gitlab.com/acme/app")
+	require.NoError(t, err)
+	assert.Equal(t, types.AuthConfig{Username: "gitlab-ci-token", Password: "job-token"}, auth)
+}
+
+func TestVerifyRegistryLogin(t *testing.T) {
+	host := startTestRegistry(t)
+	assert.NoError(t, verifyRegistryLogin(t.Context(), host, types.AuthConfig{Username: "me", Password: "pw"}, false))
+}
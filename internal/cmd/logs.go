@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// logsGetReplicaSets is a var so tests can replace it.
+var logsGetReplicaSets = func(ctx context.Context, namespace, kubeContext string) ([]byte, error) {
+	return exec.CommandContext(ctx, "kubectl", withKubeContext(kubeContext, "-n", namespace, "get", "replicasets", "-o", "json")...).Output()
+}
+
+// withKubeContext prefixes args with --context when kubeContext is set.
+func withKubeContext(kubeContext string, args ...string) []string {
+	if kubeContext == "" {
+		return args
+	}
+	return append([]string{"--context", kubeContext}, args...)
+}
+
+// replicaSetList is the subset of `kubectl get replicasets -o json` used to
+// find the revisions of a deployment.
+type replicaSetList struct {
+	Items []struct {
+		Metadata struct {
+			Name            string            `json:"name"`
+			Annotations     map[string]string `json:"annotations"`
+			OwnerReferences []struct {
+				Kind string `json:"kind"`
+				Name string `json:"name"`
+			} `json:"ownerReferences"`
+		} `json:"metadata"`
+		Spec struct {
+			Selector struct {
+				MatchLabels map[string]string `json:"matchLabels"`
+			} `json:"selector"`
+			Template struct {
+				Spec struct {
+					Containers []struct {
+						Image string `json:"image"`
+					} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// deploymentRevision is one ReplicaSet of a deployment.
+type deploymentRevision struct {
+	ReplicaSet string
+	Revision   int
+	Images     []string
+	// Selector matches exactly the pods of this revision (it includes
+	// pod-template-hash).
+	Selector string
+}
+
+// deploymentRevisions returns the revisions of deployment in rsJSON, newest
+// first.
+func deploymentRevisions(rsJSON []byte, deployment string) ([]deploymentRevision, error) {
+	var list replicaSetList
+	if err := json.Unmarshal(rsJSON, &list); err != nil {
+		return nil, fmt.Errorf("parsing replicasets: %w", err)
+	}
+	var revs []deploymentRevision
+	for _, rs := range list.Items {
+		owned := false
+		for _, o := range rs.Metadata.OwnerReferences {
+			owned = owned || (o.Kind == "Deployment" && o.Name == deployment)
+		}
+		if !owned {
+			continue
+		}
+		rev := deploymentRevision{ReplicaSet: rs.Metadata.Name}
+		rev.Revision, _ = strconv.Atoi(rs.Metadata.Annotations["deployment.kubernetes.io/revision"])
+		for _, c := range rs.Spec.Template.Spec.Containers {
+			rev.Images = append(rev.Images, c.Image)
+		}
+		var labels []string
+		for k, v := range rs.Spec.Selector.MatchLabels {
+			labels = append(labels, k+"="+v)
+		}
+		sort.Strings(labels)
+		rev.Selector = strings.Join(labels, ",")
+		revs = append(revs, rev)
+	}
+	sort.Slice(revs, func(i, j int) bool { return revs[i].Revision > revs[j].Revision })
+	return revs, nil
+}
+
+// deploymentSelector drops pod-template-hash from a revision's selector.
+func deploymentSelector(revisionSelector string) string {
+	var labels []string
+	for _, l := range strings.Split(revisionSelector, ",") {
+		if !strings.HasPrefix(l, "pod-template-hash=") {
+			labels = append(labels, l)
+		}
+	}
+	return strings.Join(labels, ",")
+}
+
+// revisionRunning returns the newest revision with a container running
+// fullRef: the same digest, or the same version tag (as watch-deployment
+// matches). When repo is set the image must also come from it.
+func revisionRunning(revs []deploymentRevision, fullRef, repo string) (*deploymentRevision, error) {
+	versionTag := extractVersionTag(fullRef)
+	digest := ""
+	if at := strings.Index(fullRef, "@"); at != -1 {
+		digest = fullRef[at+1:]
+	}
+	for i, rev := range revs {
+		for _, img := range rev.Images {
+			if repo != "" && !strings.HasPrefix(img, strings.TrimSuffix(repo, "/")+"/") {
+				continue
+			}
+			if (digest != "" && strings.HasSuffix(img, "@"+digest)) || extractVersionTag(img) == versionTag {
+				return &revs[i], nil
+			}
+		}
+	}
+	var deployed []string
+	for _, rev := range revs {
+		deployed = append(deployed, fmt.Sprintf("%d: %s", rev.Revision, strings.Join(rev.Images, ",")))
+	}
+	return nil, fmt.Errorf("no revision runs %s (deployed revisions: %s)", firstNonEmpty(versionTag, fullRef), firstNonEmpty(strings.Join(deployed, "; "), "none"))
+}
+
+// logsOptions configures the kubectl logs call.
+type logsOptions struct {
+	Namespace   string
+	KubeContext string
+	Follow      bool
+	Since       string
+	Tail        int
+}
+
+// kubectlLogsArgs returns the kubectl arguments streaming the logs of the
+// pods matching selector, prefixed with pod and container names.
+func kubectlLogsArgs(selector string, o logsOptions) []string {
+	args := withKubeContext(o.KubeContext, "-n", o.Namespace, "logs", "-l", selector,
+		"--all-containers", "--prefix", "--max-log-requests", "20", "--tail", strconv.Itoa(o.Tail))
+	if o.Follow {
+		args = append(args, "--follow")
+	}
+	if o.Since != "" {
+		args = append(args, "--since", o.Since)
+	}
+	return args
+}
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Stream logs of the pods running the version from build_result.json.",
+	Long: `Print (or with -f follow) the logs of a component's pods, limited to the
+deployment revision whose image matches build_result.json: the same digest
+or version tag, as watch-deployment matches. Pods of older revisions still
+terminating during a rollout are left out. With --environment, the image must
+also come from that environment's repository (see promote-image).
+
+  op logs --component my-app --environment dev -f
+
+--all-revisions shows the logs of every revision's pods instead.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		component, _ := cmd.Flags().GetString("component")
+		env, _ := cmd.Flags().GetString("environment")
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		imageName, _ := cmd.Flags().GetString("image-name")
+		allRevisions, _ := cmd.Flags().GetBool("all-revisions")
+		o := logsOptions{}
+		o.Namespace, _ = cmd.Flags().GetString("namespace")
+		o.KubeContext, _ = cmd.Flags().GetString("context")
+		o.Follow, _ = cmd.Flags().GetBool("follow")
+		o.Since, _ = cmd.Flags().GetString("since")
+		o.Tail, _ = cmd.Flags().GetInt("tail")
+
+		out, err := logsGetReplicaSets(cmd.Context(), o.Namespace, o.KubeContext)
+		if err != nil {
+			return fmt.Errorf("listing replicasets in %s: %w", o.Namespace, err)
+		}
+		revs, err := deploymentRevisions(out, component)
+		if err != nil {
+			return err
+		}
+		if len(revs) == 0 {
+			return fmt.Errorf("deployment %s not found in namespace %s", component, o.Namespace)
+		}
+
+		// The newest revision's selector without pod-template-hash is the
+		// deployment's own selector, matching all revisions.
+		selector := deploymentSelector(revs[0].Selector)
+		if !allRevisions {
+			res, err := util.ReadBuildResult(buildResultDir)
+			if err != nil {
+				return fmt.Errorf("reading build_result.json: %w", err)
+			}
+			fullRef, err := util.SelectTag(res, imageName)
+			if err != nil {
+				return fmt.Errorf("selecting image: %w", err)
+			}
+			repo := ""
+			if env != "" {
+				if repo, err = util.GetWatchDestinationRepository(env); err != nil {
+					return err
+				}
+			}
+			rev, err := revisionRunning(revs, fullRef, repo)
+			if err != nil {
+				return fmt.Errorf("deployment %s: %w", component, err)
+			}
+			slog.Info("Showing logs of revision", "component", component, "revision", rev.Revision, "replicaset", rev.ReplicaSet)
+			selector = rev.Selector
+		}
+		if err := util.RunCommand(cmd.Context(), "kubectl", kubectlLogsArgs(selector, o)...); err != nil {
+			return fmt.Errorf("kubectl logs failed: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.Flags().String("component", "", "Deployment name")
+	logsCmd.Flags().String("environment", "", "Environment (dev, pp, prod): the image must come from its repository")
+	logsCmd.Flags().String("namespace", "default", "Kubernetes namespace")
+	logsCmd.Flags().String("context", "", "kubeconfig context (default: current context)")
+	logsCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json (default: cwd)")
+	logsCmd.Flags().String("image-name", "", "Artifact whose version to show (default: last entry in build_result.json)")
+	logsCmd.Flags().BoolP("follow", "f", false, "Stream new log lines")
+	logsCmd.Flags().String("since", "", "Only logs newer than a duration, e.g. 10m")
+	logsCmd.Flags().Int("tail", -1, "Lines of recent logs per container (-1: all)")
+	logsCmd.Flags().Bool("all-revisions", false, "Show logs of all revisions' pods, not only the one matching build_result.json")
+	_ = logsCmd.RegisterFlagCompletionFunc("environment", completeEnvironments)
+	_ = logsCmd.RegisterFlagCompletionFunc("image-name", completeBuildResultImages)
+	_ = logsCmd.MarkFlagRequired("component")
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testReplicaSets = `{"items":[
+ {"metadata":{"name":"my-app-5d8f","annotations":{"deployment.kubernetes.io/revision":"2"},"ownerReferences":[{"kind":"Deployment","name":"my-app"}]},
+  "spec":{"selector":{"matchLabels":{"app":"my-app","pod-template-hash":"5d8f"}},"template":{"spec":{"containers":[{"image":"ghcr.io/org/my-app:v2"}]}}}},
+ {"metadata":{"name":"my-app-7c9b","annotations":{"deployment.kubernetes.io/revision":"1"},"ownerReferences":[{"kind":"Deployment","name":"my-app"}]},
+  "spec":{"selector":{"matchLabels":{"app":"my-app","pod-template-hash":"7c9b"}},"template":{"spec":{"containers":[{"image":"ghcr.io/org/my-app:v1"},{"image":"envoy:1.29"}]}}}},
+ {"metadata":{"name":"other-1","annotations":{"deployment.kubernetes.io/revision":"3"},"ownerReferences":[{"kind":"Deployment","name":"other"}]},
+  "spec":{"selector":{"matchLabels":{"app":"other"}},"template":{"spec":{"containers":[{"image":"ghcr.io/org/my-app:v1"}]}}}}
+]}`
+
+func TestDeploymentRevisions(t *testing.T) {
+	revs, err := deploymentRevisions([]byte(testReplicaSets), "my-app")
+	require.NoError(t, err)
+	require.Len(t, revs, 2)
+	assert.Equal(t, 2, revs[0].Revision)
+	assert.Equal(t, "app=my-app,pod-template-hash=5d8f", revs[0].Selector)
+	assert.Equal(t, []string{"ghcr.io/org/my-app:v1", "envoy:1.29"}, revs[1].Images)
+	assert.Equal(t, "app=my-app", deploymentSelector(revs[0].Selector))
+
+	_, err = deploymentRevisions([]byte("{"), "my-app")
+	assert.ErrorContains(t, err, "parsing replicasets")
+}
+
+func TestRevisionRunning(t *testing.T) {
+	revs, err := deploymentRevisions([]byte(testReplicaSets), "my-app")
+	require.NoError(t, err)
+
+	rev, err := revisionRunning(revs, "ghcr.io/org/my-app:v1@"+testDigest, "")
+	require.NoError(t, err)
+	assert.Equal(t, "my-app-7c9b", rev.ReplicaSet)
+
+	rev, err = revisionRunning(revs, "ghcr.io/org/my-app:v2", "ghcr.io/org")
+	require.NoError(t, err)
+	assert.Equal(t, 2, rev.Revision)
+
+	// Promoted image: same tag, other environment's repository.
+	_, err = revisionRunning(revs, "ghcr.io/org/my-app:v2", "europe-docker.pkg.dev/prod")
+	assert.ErrorContains(t, err, "no revision runs v2")
+
+	_, err = revisionRunning(revs, "ghcr.io/org/my-app:v3", "")
+	assert.ErrorContains(t, err, "2: ghcr.io/org/my-app:v2; 1: ghcr.io/org/my-app:v1,envoy:1.29")
+}
+
+func TestKubectlLogsArgs(t *testing.T) {
+	assert.Equal(t, []string{"--context", "dev", "-n", "apps", "logs", "-l", "app=a", "--all-containers", "--prefix",
+		"--max-log-requests", "20", "--tail", "-1", "--follow", "--since", "5m"},
+		kubectlLogsArgs("app=a", logsOptions{Namespace: "apps", KubeContext: "dev", Follow: true, Since: "5m", Tail: -1}))
+}
+
+func TestLogsCmd(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.BuildResultFilename), []byte(`{"builds":[{"imageName":"my-app","tag":"ghcr.io/org/my-app:v1@`+testDigest+`"}]}`), 0o644))
+
+	origRS := logsGetReplicaSets
+	logsGetReplicaSets = func(_ context.Context, namespace, kubeContext string) ([]byte, error) {
+		assert.Equal(t, "apps", namespace)
+		return []byte(testReplicaSets), nil
+	}
+	defer func() { logsGetReplicaSets = origRS }()
+	var calls [][]string
+	orig := util.RunCommandFn
+	util.RunCommandFn = func(_ context.Context, name string, args ...string) error {
+		calls = append(calls, append([]string{name}, args...))
+		return nil
+	}
+	defer func() { util.RunCommandFn = orig }()
+
+	_ = logsCmd.Flags().Set("component", "my-app")
+	_ = logsCmd.Flags().Set("namespace", "apps")
+	_ = logsCmd.Flags().Set("build-result-dir", dir)
+	defer func() {
+		_ = logsCmd.Flags().Set("component", "")
+		_ = logsCmd.Flags().Set("namespace", "default")
+		_ = logsCmd.Flags().Set("build-result-dir", "")
+		_ = logsCmd.Flags().Set("all-revisions", "false")
+	}()
+	logsCmd.SetContext(t.Context())
+	require.NoError(t, logsCmd.RunE(logsCmd, nil))
+	require.Len(t, calls, 1)
+	assert.Equal(t, []string{"kubectl", "-n", "apps", "logs", "-l", "app=my-app,pod-template-hash=7c9b"}, calls[0][:6])
+
+	_ = logsCmd.Flags().Set("all-revisions", "true")
+	require.NoError(t, logsCmd.RunE(logsCmd, nil))
+	assert.Equal(t, "app=my-app", calls[1][5])
+
+	_ = logsCmd.Flags().Set("component", "missing")
+	assert.ErrorContains(t, logsCmd.RunE(logsCmd, nil), "deployment missing not found in namespace apps")
+
+	logsGetReplicaSets = func(context.Context, string, string) ([]byte, error) { return nil, errors.New("forbidden") }
+	assert.ErrorContains(t, logsCmd.RunE(logsCmd, nil), "forbidden")
+}
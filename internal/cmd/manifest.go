@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/octopilot/octopilot-pipeline-tools/pkg/pipeline"
+	"github.com/spf13/cobra"
+)
+
+// harborIndexRetries is how often an index push to a Harbor registry is
+// retried while Harbor does not know its children yet.
+const harborIndexRetries = 4
+
+// pushManifestList assembles a manifest list from refs and pushes it as
+// indexTag (see pipeline.PushManifestList).
+func pushManifestList(indexTag string, refs []string, mediaType types.MediaType, insecure []string, opts []remote.Option) (*pipeline.ManifestList, error) {
+	return pushIndex(indexTag, refs, pipeline.ManifestListOptions{
+		MediaType:          mediaType,
+		InsecureRegistries: insecure,
+		Remote:             opts,
+	})
+}
+
+// pushIndex pushes the manifest list of refs as indexTag with o, retrying
+// children Harbor does not know yet.
+func pushIndex(indexTag string, refs []string, o pipeline.ManifestListOptions) (*pipeline.ManifestList, error) {
+	if _, ok := util.HarborOptions("", indexTag); ok {
+		o.ChildRetries = harborIndexRetries
+	}
+	return pipeline.PushManifestList(indexTag, refs, o)
+}
+
+// manifestMediaType maps --format to an index media type.
+func manifestMediaType(format string) (types.MediaType, error) {
+	switch format {
+	case "docker":
+		return types.DockerManifestList, nil
+	case "oci":
+		return types.OCIImageIndex, nil
+	}
+	return "", fmt.Errorf("unknown format %q (expected docker or oci)", format)
+}
+
+// parseAnnotations parses key=value pairs.
+func parseAnnotations(values []string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, v := range values {
+		k, val, ok := strings.Cut(v, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid annotation %q (expected key=value)", v)
+		}
+		out[k] = val
+	}
+	return out, nil
+}
+
+// manifestAnnotation selects and changes entries of an index for
+// `op manifest annotate`. Without Digest or Platform the index itself is
+// annotated.
+type manifestAnnotation struct {
+	Digest      string
+	Platform    string
+	Annotations map[string]string
+	// OS, Arch and Variant override the platform of the selected entry.
+	OS, Arch, Variant string
+}
+
+// annotateIndex returns idx with the annotation applied.
+func annotateIndex(idx v1.ImageIndex, a manifestAnnotation) (v1.ImageIndex, error) {
+	mediaType, err := idx.MediaType()
+	if err != nil {
+		return nil, err
+	}
+	if len(a.Annotations) > 0 && mediaType == types.DockerManifestList {
+		return nil, fmt.Errorf("docker manifest lists cannot carry annotations; create the index with --format oci")
+	}
+	if a.Digest == "" && a.Platform == "" {
+		if a.OS != "" || a.Arch != "" || a.Variant != "" {
+			return nil, fmt.Errorf("--os/--arch/--variant need an entry selected with --digest or --platform")
+		}
+		return mutate.Annotations(idx, a.Annotations).(v1.ImageIndex), nil
+	}
+	var want *v1.Platform
+	if a.Platform != "" {
+		p, err := v1.ParsePlatform(a.Platform)
+		if err != nil {
+			return nil, err
+		}
+		want = p
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	var out v1.ImageIndex = empty.Index
+	out = mutate.IndexMediaType(out, mediaType)
+	if len(im.Annotations) > 0 {
+		out = mutate.Annotations(out, im.Annotations).(v1.ImageIndex)
+	}
+	matched := 0
+	for _, m := range im.Manifests {
+		selected := m.Digest.String() == a.Digest || (want != nil && m.Platform != nil && m.Platform.Equals(*want))
+		if selected {
+			matched++
+			if len(a.Annotations) > 0 {
+				merged := map[string]string{}
+				for k, v := range m.Annotations {
+					merged[k] = v
+				}
+				for k, v := range a.Annotations {
+					merged[k] = v
+				}
+				m.Annotations = merged
+			}
+			if a.OS != "" || a.Arch != "" || a.Variant != "" {
+				p := v1.Platform{}
+				if m.Platform != nil {
+					p = *m.Platform
+				}
+				p.OS = firstNonEmpty(a.OS, p.OS)
+				p.Architecture = firstNonEmpty(a.Arch, p.Architecture)
+				p.Variant = firstNonEmpty(a.Variant, p.Variant)
+				m.Platform = &p
+			}
+		}
+		var add mutate.Appendable
+		if m.MediaType.IsIndex() {
+			if add, err = idx.ImageIndex(m.Digest); err != nil {
+				return nil, err
+			}
+		} else if add, err = idx.Image(m.Digest); err != nil {
+			return nil, err
+		}
+		out = mutate.AppendManifests(out, mutate.IndexAddendum{Add: add, Descriptor: m})
+	}
+	if matched == 0 {
+		return nil, fmt.Errorf("no index entry matches %s", firstNonEmpty(a.Digest, a.Platform))
+	}
+	return out, nil
+}
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Create and annotate multi-platform manifest lists.",
+	Long: `Assemble manifest lists (image indexes) from images that are already pushed,
+with the same logic op build uses for multi-platform builds. Use it when
+platforms are built on separate runners (e.g. native amd64 and arm64 jobs)
+and merged in a final job without rebuilding.`,
+}
+
+var manifestCreateCmd = &cobra.Command{
+	Use:   "create <index-tag>",
+	Short: "Push a manifest list made of the given images.",
+	Long: `Create a manifest list from the images given with --add and push it as
+<index-tag>. Each entry's platform is read from the image config. An --add
+ref that is itself an index contributes all of its platform children, so
+per-runner indexes can be merged. The same platform may appear only once.
+
+  op manifest create ghcr.io/my-org/app:1.2.3 \
+    --add ghcr.io/my-org/app:1.2.3-amd64 --add ghcr.io/my-org/app:1.2.3-arm64
+
+The pushed digest is printed as <index-tag>@sha256:...`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		refs, _ := cmd.Flags().GetStringArray("add")
+		format, _ := cmd.Flags().GetString("format")
+		annotationFlags, _ := cmd.Flags().GetStringArray("annotation")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		if len(refs) == 0 {
+			return fmt.Errorf("give at least one image with --add")
+		}
+		mediaType, err := manifestMediaType(format)
+		if err != nil {
+			return err
+		}
+		annotations, err := parseAnnotations(annotationFlags)
+		if err != nil {
+			return err
+		}
+
+		indexTag := args[0]
+		insecure := insecureRegistries(insecureFlag)
+		opts := remoteOptionsFor(cmd.Context(), indexTag, insecure)
+		slog.Info("Creating manifest list", util.LogKeyTag, indexTag, "manifests", refs)
+		list, err := pushManifestList(indexTag, refs, mediaType, insecure, opts)
+		if err != nil {
+			return err
+		}
+		digest := list.Digest
+		if len(annotations) > 0 {
+			if digest, err = annotateRemoteIndex(indexTag, manifestAnnotation{Annotations: annotations}, insecure, opts); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("%s@%s\n", indexTag, digest)
+		return nil
+	},
+}
+
+// annotateRemoteIndex applies a to the index at indexTag, pushes it back to
+// the same tag and returns the new digest.
+func annotateRemoteIndex(indexTag string, a manifestAnnotation, insecure []string, opts []remote.Option) (string, error) {
+	ref, err := parseReferenceForRemote(indexTag, insecure)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s: %w", indexTag, err)
+	}
+	idx, err := remote.Index(ref, opts...)
+	if err != nil {
+		return "", fmt.Errorf("reading index %s: %w", indexTag, err)
+	}
+	idx, err = annotateIndex(idx, a)
+	if err != nil {
+		return "", err
+	}
+	if err := remote.WriteIndex(ref, idx, opts...); err != nil {
+		return "", fmt.Errorf("writing manifest list %s: %w", indexTag, err)
+	}
+	d, err := idx.Digest()
+	if err != nil {
+		return "", err
+	}
+	return d.String(), nil
+}
+
+var manifestAnnotateCmd = &cobra.Command{
+	Use:   "annotate <index-tag>",
+	Short: "Set annotations or the platform of a manifest list entry.",
+	Long: `Update the index at <index-tag> in place (the tag then points to a new
+digest). Select an entry with --digest or --platform to set its annotations
+or override its platform (--os, --arch, --variant); without a selector,
+--annotation applies to the index itself.
+
+  op manifest annotate ghcr.io/my-org/app:1.2.3 --platform linux/arm64 --variant v8
+  op manifest annotate ghcr.io/my-org/app:1.2.3 \
+    --annotation org.opencontainers.image.source=https://github.com/my-org/app`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a := manifestAnnotation{}
+		a.Digest, _ = cmd.Flags().GetString("digest")
+		a.Platform, _ = cmd.Flags().GetString("platform")
+		a.OS, _ = cmd.Flags().GetString("os")
+		a.Arch, _ = cmd.Flags().GetString("arch")
+		a.Variant, _ = cmd.Flags().GetString("variant")
+		annotationFlags, _ := cmd.Flags().GetStringArray("annotation")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		var err error
+		if a.Annotations, err = parseAnnotations(annotationFlags); err != nil {
+			return err
+		}
+
+		indexTag := args[0]
+		insecure := insecureRegistries(insecureFlag)
+		digest, err := annotateRemoteIndex(indexTag, a, insecure, remoteOptionsFor(cmd.Context(), indexTag, insecure))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s@%s\n", indexTag, digest)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(manifestCmd)
+	manifestCmd.AddCommand(manifestCreateCmd)
+	manifestCreateCmd.Flags().StringArray("add", nil, "Image or index to include (repeatable)")
+	manifestCreateCmd.Flags().String("format", "docker", "Index media type: docker (manifest list) or oci (image index)")
+	manifestCreateCmd.Flags().StringArray("annotation", nil, "Index annotation key=value (repeatable, --format oci)")
+	manifestCreateCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+
+	manifestCmd.AddCommand(manifestAnnotateCmd)
+	manifestAnnotateCmd.Flags().String("digest", "", "Select the entry with this digest")
+	manifestAnnotateCmd.Flags().String("platform", "", "Select the entry for this platform (os/arch[/variant])")
+	manifestAnnotateCmd.Flags().StringArray("annotation", nil, "Annotation key=value (repeatable)")
+	manifestAnnotateCmd.Flags().String("os", "", "Override the selected entry's OS")
+	manifestAnnotateCmd.Flags().String("arch", "", "Override the selected entry's architecture")
+	manifestAnnotateCmd.Flags().String("variant", "", "Override the selected entry's architecture variant")
+	manifestAnnotateCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+}
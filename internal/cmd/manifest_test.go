@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/octopilot/octopilot-pipeline-tools/pkg/pipeline"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func remoteIndexManifest(t *testing.T, ref string) *v1.IndexManifest {
+	t.Helper()
+	tag, err := name.ParseReference(ref)
+	require.NoError(t, err)
+	idx, err := remote.Index(tag)
+	require.NoError(t, err)
+	im, err := idx.IndexManifest()
+	require.NoError(t, err)
+	return im
+}
+
+func TestPushManifestList(t *testing.T) {
+	host := startTestRegistry(t)
+	pushInspectImage(t, host+"/org/app:amd64", v1.Platform{OS: "linux", Architecture: "amd64"})
+	pushInspectImage(t, host+"/org/app:arm64", v1.Platform{OS: "linux", Architecture: "arm64"})
+
+	list, err := pushManifestList(host+"/org/app:multi", []string{host + "/org/app:amd64", host + "/org/app:arm64"}, types.DockerManifestList, nil, nil)
+	require.NoError(t, err)
+	assert.Contains(t, list.Digest, "sha256:")
+	assert.Equal(t, types.DockerManifestList, list.MediaType)
+	im := remoteIndexManifest(t, host+"/org/app:multi")
+	assert.Equal(t, types.DockerManifestList, im.MediaType)
+	require.Len(t, im.Manifests, 2)
+	assert.Equal(t, "linux/amd64", im.Manifests[0].Platform.String())
+	assert.Equal(t, "linux/arm64", im.Manifests[1].Platform.String())
+	assert.Equal(t, []pipeline.PlatformDigest{
+		{Platform: "linux/amd64", Digest: im.Manifests[0].Digest.String()},
+		{Platform: "linux/arm64", Digest: im.Manifests[1].Digest.String()},
+	}, list.Platforms)
+
+	// An index contributes its children, so per-runner indexes can be merged.
+	pushInspectImage(t, host+"/org/app:s390x", v1.Platform{OS: "linux", Architecture: "s390x"})
+	_, err = pushManifestList(host+"/org/app:all", []string{host + "/org/app:multi", host + "/org/app:s390x"}, types.OCIImageIndex, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, remoteIndexManifest(t, host+"/org/app:all").Manifests, 3)
+
+	_, err = pushManifestList(host+"/org/app:dup", []string{host + "/org/app:multi", host + "/org/app:arm64"}, types.OCIImageIndex, nil, nil)
+	assert.ErrorContains(t, err, "platform linux/arm64 is in both")
+}
+
+func TestPushManifestList_KeepsOrder(t *testing.T) {
+	host := startTestRegistry(t)
+	var refs []string
+	arches := []string{"amd64", "arm64", "s390x", "ppc64le", "riscv64"}
+	for _, arch := range arches {
+		ref := host + "/org/app:" + arch
+		pushInspectImage(t, ref, v1.Platform{OS: "linux", Architecture: arch})
+		refs = append(refs, ref)
+	}
+
+	// Children are fetched concurrently but listed in the order of refs.
+	list, err := pushManifestList(host+"/org/app:multi", refs, types.OCIImageIndex, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, list.Platforms, len(arches))
+	for i, arch := range arches {
+		assert.Equal(t, "linux/"+arch, list.Platforms[i].Platform)
+	}
+
+	_, err = pushManifestList(host+"/org/app:broken", append(refs, host+"/org/app:missing"), types.OCIImageIndex, nil, nil)
+	assert.ErrorContains(t, err, "getting platform image "+host+"/org/app:missing")
+}
+
+func TestManifestMediaType(t *testing.T) {
+	mt, err := manifestMediaType("oci")
+	require.NoError(t, err)
+	assert.Equal(t, types.OCIImageIndex, mt)
+	_, err = manifestMediaType("v2")
+	assert.ErrorContains(t, err, `unknown format "v2"`)
+}
+
+func TestParseAnnotations(t *testing.T) {
+	a, err := parseAnnotations([]string{"a=1", "b=x=y"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "x=y"}, a)
+	_, err = parseAnnotations([]string{"=1"})
+	assert.ErrorContains(t, err, "expected key=value")
+}
+
+func TestAnnotateIndex(t *testing.T) {
+	host := startTestRegistry(t)
+	pushInspectImage(t, host+"/org/app:amd64", v1.Platform{OS: "linux", Architecture: "amd64"})
+	pushInspectImage(t, host+"/org/app:arm64", v1.Platform{OS: "linux", Architecture: "arm64"})
+	refs := []string{host + "/org/app:amd64", host + "/org/app:arm64"}
+	_, err := pushManifestList(host+"/org/app:oci", refs, types.OCIImageIndex, nil, nil)
+	require.NoError(t, err)
+	_, err = pushManifestList(host+"/org/app:docker", refs, types.DockerManifestList, nil, nil)
+	require.NoError(t, err)
+
+	_, err = annotateRemoteIndex(host+"/org/app:oci", manifestAnnotation{Platform: "linux/arm64", Variant: "v8", Annotations: map[string]string{"k": "v"}}, nil, nil)
+	require.NoError(t, err)
+	im := remoteIndexManifest(t, host+"/org/app:oci")
+	require.Len(t, im.Manifests, 2)
+	assert.Equal(t, "linux/arm64/v8", im.Manifests[1].Platform.String())
+	assert.Equal(t, map[string]string{"k": "v"}, im.Manifests[1].Annotations)
+	assert.Empty(t, im.Manifests[0].Annotations)
+
+	_, err = annotateRemoteIndex(host+"/org/app:oci", manifestAnnotation{Annotations: map[string]string{"org.opencontainers.image.source": "https://github.com/org/app"}}, nil, nil)
+	require.NoError(t, err)
+	im = remoteIndexManifest(t, host+"/org/app:oci")
+	assert.Equal(t, "https://github.com/org/app", im.Annotations["org.opencontainers.image.source"])
+
+	// Platform-only changes work on docker lists; annotations do not.
+	_, err = annotateRemoteIndex(host+"/org/app:docker", manifestAnnotation{Platform: "linux/amd64", Variant: "v3"}, nil, nil)
+	require.NoError(t, err)
+	_, err = annotateRemoteIndex(host+"/org/app:docker", manifestAnnotation{Annotations: map[string]string{"k": "v"}}, nil, nil)
+	assert.ErrorContains(t, err, "--format oci")
+
+	_, err = annotateRemoteIndex(host+"/org/app:oci", manifestAnnotation{Platform: "linux/s390x", Arch: "x"}, nil, nil)
+	assert.ErrorContains(t, err, "no index entry matches linux/s390x")
+	_, err = annotateRemoteIndex(host+"/org/app:oci", manifestAnnotation{Arch: "x"}, nil, nil)
+	assert.ErrorContains(t, err, "--digest or --platform")
+}
+
+func TestManifestCreateCmd(t *testing.T) {
+	host := startTestRegistry(t)
+	pushInspectImage(t, host+"/org/app:amd64", v1.Platform{OS: "linux", Architecture: "amd64"})
+	pushInspectImage(t, host+"/org/app:arm64", v1.Platform{OS: "linux", Architecture: "arm64"})
+
+	_ = manifestCreateCmd.Flags().Set("add", host+"/org/app:amd64")
+	_ = manifestCreateCmd.Flags().Set("add", host+"/org/app:arm64")
+	_ = manifestCreateCmd.Flags().Set("format", "oci")
+	_ = manifestCreateCmd.Flags().Set("annotation", "team=platform")
+	defer func() {
+		_ = manifestCreateCmd.Flags().Lookup("add").Value.(pflag.SliceValue).Replace(nil)
+		_ = manifestCreateCmd.Flags().Lookup("annotation").Value.(pflag.SliceValue).Replace(nil)
+		_ = manifestCreateCmd.Flags().Set("format", "docker")
+	}()
+	manifestCreateCmd.SetContext(t.Context())
+	require.NoError(t, manifestCreateCmd.RunE(manifestCreateCmd, []string{host + "/org/app:1"}))
+	im := remoteIndexManifest(t, host+"/org/app:1")
+	assert.Equal(t, types.OCIImageIndex, im.MediaType)
+	assert.Len(t, im.Manifests, 2)
+	assert.Equal(t, "platform", im.Annotations["team"])
+
+	_ = manifestCreateCmd.Flags().Lookup("add").Value.(pflag.SliceValue).Replace(nil)
+	assert.ErrorContains(t, manifestCreateCmd.RunE(manifestCreateCmd, []string{host + "/org/app:2"}), "--add")
+}
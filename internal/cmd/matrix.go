@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// maxMatrixJobs is the most jobs GitHub Actions runs for one matrix.
+const maxMatrixJobs = 256
+
+// matrixEntry is one job of the matrix printed by op matrix.
+type matrixEntry struct {
+	Artifact string `json:"artifact"`
+	Context  string `json:"context"`
+	Platform string `json:"platform,omitempty"`
+	Arch     string `json:"arch"`
+	Runner   string `json:"runner"`
+	// TagSuffix (-amd64, -arm64) is set when the artifact has several
+	// platforms: each job pushes its own tag, and op build-result merge
+	// drops the suffix to push the manifest list to the shared tag.
+	TagSuffix string `json:"tag_suffix,omitempty"`
+}
+
+// defaultMatrixRunners are the GitHub-hosted runners of each architecture.
+var defaultMatrixRunners = map[string]string{
+	"amd64": "ubuntu-latest",
+	"arm64": "ubuntu-24.04-arm",
+}
+
+// platformArch returns the architecture of an os/arch[/variant] platform.
+func platformArch(platform string) string {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 {
+		return platform
+	}
+	return parts[1]
+}
+
+// buildMatrix expands artifacts into one job per artifact and platform, each
+// on the runner of the platform's architecture. An artifact's platforms are
+// chosen as op build --push chooses them: its build.artifacts.<image>.platforms
+// in .github/octopilot.yaml, else those of skaffold.yaml, restricted to what
+// .registry allows for repo, else defaultPlatform. Charts get one job
+// without a platform. Jobs of an artifact with several platforms get a
+// TagSuffix so they do not push over each other's tag.
+func buildMatrix(cwd, repo string, artifacts []artifactInfo, runCfg *util.RunConfig, runners map[string]string, defaultPlatform string) ([]matrixEntry, error) {
+	runnerFor := func(artifact, platform string) (string, string, error) {
+		arch := platformArch(platform)
+		runner, ok := runners[arch]
+		if !ok {
+			return "", "", util.WithExitCode(util.ExitConfig, fmt.Errorf("%s: no runner for %s (set --runner %s=<label>)", artifact, platform, arch))
+		}
+		return arch, runner, nil
+	}
+	entries := []matrixEntry{}
+	for _, a := range artifacts {
+		if strings.HasSuffix(a.Image, "-chart") {
+			arch, runner, err := runnerFor(a.Image, defaultPlatform)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, matrixEntry{Artifact: a.Image, Context: a.Context, Arch: arch, Runner: runner})
+			continue
+		}
+		platforms := a.Platforms
+		if p := runCfg.ArtifactBuild(a.Image).Platforms; len(p) > 0 {
+			platforms = p
+		}
+		platforms, err := registryPlatforms(cwd, repo, platforms)
+		if err != nil {
+			return nil, util.WithExitCode(util.ExitConfig, fmt.Errorf("%s: %w", a.Image, err))
+		}
+		if len(platforms) == 0 {
+			platforms = []string{defaultPlatform}
+		}
+		for _, p := range platforms {
+			arch, runner, err := runnerFor(a.Image, p)
+			if err != nil {
+				return nil, err
+			}
+			entry := matrixEntry{Artifact: a.Image, Context: a.Context, Platform: p, Arch: arch, Runner: runner}
+			if len(platforms) > 1 {
+				entry.TagSuffix = "-" + arch
+			}
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) > maxMatrixJobs {
+		return nil, util.WithExitCode(util.ExitConfig, fmt.Errorf("the matrix has %d jobs; GitHub Actions runs at most %d", len(entries), maxMatrixJobs))
+	}
+	return entries, nil
+}
+
+// appendGitHubOutput appends name=value to the $GITHUB_OUTPUT file of the step.
+func appendGitHubOutput(name, value string) error {
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		return fmt.Errorf("GITHUB_OUTPUT is not set (not in a GitHub Actions step?)")
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%s=%s\n", name, value); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var matrixCmd = &cobra.Command{
+	Use:   "matrix",
+	Short: "Print a GitHub Actions matrix of artifacts × platforms.",
+	Long: `Print a GitHub Actions matrix ({"include": [...]}) with one job per
+artifact and platform of skaffold.yaml, so fan-out workflows follow the
+Skaffold config instead of a hand-maintained list. Each job has artifact,
+context, platform, arch and runner, the runner label of the platform's
+architecture (--runner arch=label; default ubuntu-latest for amd64 and
+ubuntu-24.04-arm for arm64).
+
+Platforms are those op build --push would build: the artifact's platforms
+in .github/octopilot.yaml, else skaffold.yaml's, limited to the platforms
+.registry allows for the push repository, else --default-platform. Helm
+charts get one job without a platform.
+
+Jobs of an artifact with several platforms also have tag_suffix (-amd64,
+-arm64). Append it to the version so each job pushes its own tag, upload
+each build_result.json, and run op build-result merge in a final job: it
+drops the suffix and pushes the manifest list of the jobs' images to the
+shared tag.
+
+  jobs:
+    plan:
+      runs-on: ubuntu-latest
+      outputs:
+        matrix: ${{ steps.matrix.outputs.matrix }}
+      steps:
+        - uses: actions/checkout@v4
+        - id: matrix
+          run: op matrix --github-output matrix
+    build:
+      needs: plan
+      strategy:
+        matrix: ${{ fromJSON(needs.plan.outputs.matrix) }}
+      runs-on: ${{ matrix.runner }}
+      steps:
+        - uses: actions/checkout@v4
+        - run: op build --push --artifact ${{ matrix.artifact }} --platform ${{ matrix.platform }}
+          env:
+            VERSION: ${{ github.sha }}${{ matrix.tag_suffix }}
+        - uses: actions/upload-artifact@v4
+          with:
+            name: build-result-${{ strategy.job-index }}
+            path: build_result.json
+    merge:
+      needs: build
+      runs-on: ubuntu-latest
+      steps:
+        - uses: actions/download-artifact@v4
+          with:
+            pattern: build-result-*
+            path: results
+        - run: op build-result merge results/* -o build_result.json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		file, _ := cmd.Flags().GetString("filename")
+		profiles, _ := cmd.Flags().GetStringSlice("profile")
+		if val := viper.GetString("SKAFFOLD_PROFILE"); len(profiles) == 0 && val != "" {
+			profiles = strings.Split(val, ",")
+		}
+		runners := maps.Clone(defaultMatrixRunners)
+		flagRunners, _ := cmd.Flags().GetStringToString("runner")
+		maps.Copy(runners, flagRunners)
+		defaultPlatform, _ := cmd.Flags().GetString("default-platform")
+		repo, _ := cmd.Flags().GetString("repo")
+		if repo == "" {
+			if repo, err = resolveDefaultRepo(cwd); err != nil {
+				return util.WithExitCode(util.ExitConfig, err)
+			}
+		}
+		runCfg, err := util.LoadRunConfig(cwd)
+		if err != nil {
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("reading %s: %w", util.RunConfigFilename, err))
+		}
+
+		artifacts, err := listArtifacts(cmd.Context(), file, profiles)
+		if err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
+		if only, _ := cmd.Flags().GetStringSlice("artifact"); len(only) > 0 {
+			artifacts = slices.DeleteFunc(artifacts, func(a artifactInfo) bool { return !slices.Contains(only, a.Image) })
+		}
+		entries, err := buildMatrix(cwd, repo, artifacts, runCfg, runners, defaultPlatform)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(map[string][]matrixEntry{"include": entries})
+		if err != nil {
+			return err
+		}
+		if name, _ := cmd.Flags().GetString("github-output"); name != "" {
+			if err := appendGitHubOutput(name, string(data)); err != nil {
+				return fmt.Errorf("--github-output: %w", err)
+			}
+		}
+		fmt.Println(string(data))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(matrixCmd)
+	matrixCmd.Flags().StringP("filename", "f", "skaffold.yaml", "Path to skaffold.yaml")
+	matrixCmd.Flags().StringSliceP("profile", "p", nil, "Skaffold profile(s) to activate (default: $SKAFFOLD_PROFILE)")
+	matrixCmd.Flags().String("repo", "", "Push repository whose .registry platforms apply (default: as op build)")
+	matrixCmd.Flags().StringToString("runner", nil, "Runner label per architecture, e.g. arm64=ubuntu-24.04-arm (repeatable)")
+	matrixCmd.Flags().String("default-platform", "linux/amd64", "Platform of artifacts without platforms")
+	matrixCmd.Flags().StringSlice("artifact", nil, "Only these artifacts (default: all)")
+	matrixCmd.Flags().String("github-output", "", "Also write the matrix to $GITHUB_OUTPUT under this name")
+	_ = matrixCmd.RegisterFlagCompletionFunc("artifact", completeSkaffoldImages)
+}
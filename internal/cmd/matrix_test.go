@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlatformArch(t *testing.T) {
+	assert.Equal(t, "amd64", platformArch("linux/amd64"))
+	assert.Equal(t, "arm", platformArch("linux/arm/v7"))
+	assert.Equal(t, "arm64", platformArch("arm64"))
+}
+
+// artifactNamed returns only the artifact image of artifacts, which
+// listArtifacts orders as Skaffold's config set (required configs first).
+func artifactNamed(t *testing.T, artifacts []artifactInfo, image string) []artifactInfo {
+	t.Helper()
+	i := slices.IndexFunc(artifacts, func(a artifactInfo) bool { return a.Image == image })
+	require.GreaterOrEqual(t, i, 0, "no artifact %s", image)
+	return artifacts[i : i+1]
+}
+
+func TestBuildMatrix(t *testing.T) {
+	dir := writeArtifactsProject(t)
+	artifacts, err := listArtifacts(t.Context(), "skaffold.yaml", nil)
+	require.NoError(t, err)
+	artifacts = append(artifacts, artifactInfo{Image: "api-chart", Context: "charts/api"})
+	runCfg := &util.RunConfig{}
+	runCfg.Build.Artifacts = map[string]util.ArtifactBuildOpts{"web": {Platforms: []string{"linux/arm64"}}}
+
+	entries, err := buildMatrix(dir, "ghcr.io/acme", artifacts, runCfg, defaultMatrixRunners, "linux/amd64")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []matrixEntry{
+		{Artifact: "api", Context: "api", Platform: "linux/amd64", Arch: "amd64", Runner: "ubuntu-latest", TagSuffix: "-amd64"},
+		{Artifact: "api", Context: "api", Platform: "linux/arm64", Arch: "arm64", Runner: "ubuntu-24.04-arm", TagSuffix: "-arm64"},
+		{Artifact: "web", Context: "web", Platform: "linux/arm64", Arch: "arm64", Runner: "ubuntu-24.04-arm"},
+		{Artifact: "worker", Context: filepath.Join("services", "worker"), Platform: "linux/amd64", Arch: "amd64", Runner: "ubuntu-latest"},
+		{Artifact: "api-chart", Context: "charts/api", Arch: "amd64", Runner: "ubuntu-latest"},
+	}, entries)
+
+	// .registry limits the platforms pushed to a registry.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.RegistryFilename), []byte("ci:\n  - registry: ghcr.io/acme\n    platforms: [linux/amd64]\n"), 0o644))
+	entries, err = buildMatrix(dir, "ghcr.io/acme", artifactNamed(t, artifacts, "api"), nil, defaultMatrixRunners, "linux/amd64")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "linux/amd64", entries[0].Platform)
+	assert.Empty(t, entries[0].TagSuffix)
+
+	_, err = buildMatrix(dir, "ghcr.io/other", artifactNamed(t, artifacts, "api"), nil, map[string]string{"amd64": "self-hosted"}, "linux/amd64")
+	assert.ErrorContains(t, err, "api: no runner for linux/arm64 (set --runner arm64=<label>)")
+	assert.Equal(t, util.ExitConfig, util.ExitCode(err))
+}
+
+// TestMatrixJobsMerge follows the documented workflow: each job pushes its
+// platform to the version plus tag_suffix, and merging the jobs' results
+// pushes one manifest list to the shared tag.
+func TestMatrixJobsMerge(t *testing.T) {
+	dir := writeArtifactsProject(t)
+	artifacts, err := listArtifacts(t.Context(), "skaffold.yaml", nil)
+	require.NoError(t, err)
+	entries, err := buildMatrix(dir, "ghcr.io/acme", artifactNamed(t, artifacts, "api"), nil, defaultMatrixRunners, "linux/amd64")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	host := startTestRegistry(t)
+	var results []*util.BuildResult
+	tags := map[string]bool{}
+	for _, e := range entries {
+		tag := host + "/acme/" + e.Artifact + ":1.2.0" + e.TagSuffix
+		tags[tag] = true
+		img := pushInspectImage(t, tag, v1.Platform{OS: "linux", Architecture: e.Arch})
+		d, _ := img.Digest()
+		results = append(results, &util.BuildResult{Builds: []util.BuildEntry{{ImageName: e.Artifact, Tag: tag + "@" + d.String()}}})
+	}
+	assert.Len(t, tags, 2, "jobs must not push to the same tag")
+
+	merged, err := mergeBuildResults(t.Context(), results, types.DockerManifestList, nil)
+	require.NoError(t, err)
+	require.Len(t, merged.Builds, 1)
+	assert.Equal(t, host+"/acme/api:1.2.0@"+merged.Builds[0].Digest, merged.Builds[0].Tag)
+	im := remoteIndexManifest(t, host+"/acme/api:1.2.0")
+	require.Len(t, im.Manifests, 2)
+}
+
+func TestAppendGitHubOutput(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "output")
+	require.NoError(t, os.WriteFile(out, []byte("digest=sha256:abc\n"), 0o644))
+	t.Setenv("GITHUB_OUTPUT", out)
+
+	data, _ := json.Marshal(map[string][]matrixEntry{"include": {{Artifact: "api", Arch: "amd64", Runner: "ubuntu-latest"}}})
+	require.NoError(t, appendGitHubOutput("matrix", string(data)))
+	got, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "digest=sha256:abc\n"+`matrix={"include":[{"artifact":"api","context":"","arch":"amd64","runner":"ubuntu-latest"}]}`+"\n", string(got))
+
+	t.Setenv("GITHUB_OUTPUT", "")
+	assert.ErrorContains(t, appendGitHubOutput("matrix", "{}"), "GITHUB_OUTPUT is not set")
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/octopilot/octopilot-pipeline-tools/pkg/pipeline"
+)
+
+// dockerMetadata is the JSON output of docker/metadata-action
+// (steps.<id>.outputs.json), read with --metadata-file.
+type dockerMetadata struct {
+	// Tags are full references (ghcr.io/org/app:1.2.3); op applies their tag
+	// to every artifact in its own repository.
+	Tags []string `json:"tags"`
+	// Labels are the OCI labels (org.opencontainers.image.*) to set.
+	Labels map[string]string `json:"labels"`
+}
+
+// readDockerMetadata reads the docker/metadata-action JSON at path and
+// checks its tags.
+func readDockerMetadata(path string) (*dockerMetadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var md dockerMetadata
+	if err := json.Unmarshal(data, &md); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if _, err := md.tagNames(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &md, nil
+}
+
+// tagNames returns the distinct tags of md.Tags without their repository,
+// in order; latest is left out as op pushes it anyway.
+func (md *dockerMetadata) tagNames() ([]string, error) {
+	if md == nil {
+		return nil, nil
+	}
+	var names []string
+	for _, t := range md.Tags {
+		tag, err := name.NewTag(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag %q: %w", t, err)
+		}
+		if n := tag.TagStr(); n != "latest" && !slices.Contains(names, n) {
+			names = append(names, n)
+		}
+	}
+	return names, nil
+}
+
+// pushMetadataTags tags the pushed images in built with every tag of md.
+func pushMetadataTags(ctx context.Context, built []util.BuildEntry, md *dockerMetadata, insecure []string) error {
+	names, err := md.tagNames()
+	if err != nil || len(names) == 0 {
+		return err
+	}
+	for _, b := range built {
+		if b.ArtifactKind() != pipeline.ArtifactKindImage || b.ImageDigest() == "" {
+			continue
+		}
+		fullTag, _, _ := strings.Cut(b.Tag, "@")
+		ref, err := name.NewTag(fullTag)
+		if err != nil {
+			return fmt.Errorf("parsing reference %q: %w", fullTag, err)
+		}
+		repo := strings.TrimSuffix(fullTag, ":"+ref.TagStr())
+		opts := remoteOptionsFor(ctx, fullTag, insecure)
+		for _, n := range names {
+			if err := pushVersionTag(ctx, fullTag, repo+":"+n, insecure, opts); err != nil {
+				return err
+			}
+		}
+		util.ArtifactLogger(b.ImageName).Info("Pushed metadata tags", util.LogKeyTag, fullTag, "tags", names)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeMetadataFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "metadata.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestReadDockerMetadata(t *testing.T) {
+	md, err := readDockerMetadata(writeMetadataFile(t, `{
+  "tags": ["ghcr.io/org/app:1.2.3", "ghcr.io/org/app:1.2", "ghcr.io/org/app:latest", "docker.io/org/app:1.2.3"],
+  "labels": {"org.opencontainers.image.revision": "abc123"},
+  "annotations": ["manifest:org.opencontainers.image.revision=abc123"]
+}`))
+	require.NoError(t, err)
+	names, err := md.tagNames()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.2.3", "1.2"}, names)
+	assert.Equal(t, "abc123", md.Labels["org.opencontainers.image.revision"])
+
+	_, err = readDockerMetadata(writeMetadataFile(t, `{"tags": ["ghcr.io/org/app:bad tag"]}`))
+	assert.ErrorContains(t, err, `invalid tag "ghcr.io/org/app:bad tag"`)
+	_, err = readDockerMetadata(writeMetadataFile(t, `tags: []`))
+	assert.ErrorContains(t, err, "parsing")
+}
+
+func TestPushMetadataTags_Labels(t *testing.T) {
+	t.Setenv("DOCKER_METADATA_OUTPUT_VERSION", "")
+	t.Setenv("CI_COMMIT_TAG", "")
+	t.Setenv("GITHUB_EVENT_NAME", "push")
+	host := startTestRegistry(t)
+	tag := host + "/org/app:latest"
+	pushInspectImage(t, tag, v1.Platform{OS: "linux", Architecture: "amd64"})
+	digest, err := resolveDigestRef(t.Context(), tag, nil)
+	require.NoError(t, err)
+	_, d, _ := strings.Cut(digest, "@")
+	built := []util.BuildEntry{{ImageName: "app", Tag: tag + "@" + d}}
+	md := &dockerMetadata{
+		Tags:   []string{"ghcr.io/org/other:1.2.3", "ghcr.io/org/other:pr-7"},
+		Labels: map[string]string{"org.opencontainers.image.revision": "abc123"},
+	}
+
+	require.NoError(t, labelImages(t.Context(), built, "", md, time.Time{}, nil))
+	require.NoError(t, pushMetadataTags(t.Context(), built, md, nil))
+	for _, n := range []string{"1.2.3", "pr-7"} {
+		got, err := resolveDigestRef(t.Context(), host+"/org/app:"+n, nil)
+		require.NoError(t, err)
+		assert.Equal(t, host+"/org/app@"+built[0].Digest, got, n)
+	}
+	i, err := inspectRef(t.Context(), tag, "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", i.Image.Labels["org.opencontainers.image.revision"])
+	assert.Empty(t, i.Image.Labels["quay.expires-after"])
+}
@@ -0,0 +1,403 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// mirrorRefAnnotation records the source reference of each manifest in the
+// OCI layout, as containerd does.
+const mirrorRefAnnotation = "org.opencontainers.image.ref.name"
+
+// mirrorSignatureSuffixes are the cosign tag-scheme suffixes of the
+// signatures, attestations and SBOMs stored next to an image.
+var mirrorSignatureSuffixes = []string{".sig", ".att", ".sbom"}
+
+// readImageList reads image refs from file, one per line; blank lines and
+// # comments are ignored.
+func readImageList(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	var refs []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			refs = append(refs, line)
+		}
+	}
+	return refs, sc.Err()
+}
+
+// mirrorRefs collects the refs to mirror from args, an image list file and
+// build_result.json directories.
+func mirrorRefs(args []string, listFile string, buildResultDirs []string) ([]string, error) {
+	refs := append([]string(nil), args...)
+	if listFile != "" {
+		list, err := readImageList(listFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading image list: %w", err)
+		}
+		refs = append(refs, list...)
+	}
+	for _, dir := range buildResultDirs {
+		res, err := util.ReadBuildResult(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range res.Builds {
+			refs = append(refs, b.Tag)
+		}
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("no images to mirror: give refs, --images or --build-result-dir")
+	}
+	return refs, nil
+}
+
+// mirrorRefName is the name recorded for ref: repository:tag when ref has a
+// tag (also for tag@digest), repository@digest otherwise.
+func mirrorRefName(ref name.Reference) string {
+	if d, ok := ref.(name.Digest); ok {
+		repo, _, _ := strings.Cut(d.String(), "@")
+		if colon := strings.LastIndex(repo, ":"); colon > strings.LastIndex(repo, "/") {
+			return ref.Context().Tag(repo[colon+1:]).Name()
+		}
+	}
+	return ref.Name()
+}
+
+func isNotFound(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound
+}
+
+// mirrorWriter appends manifests (images or whole indexes) to an OCI layout.
+type mirrorWriter struct {
+	path  layout.Path
+	opts  []remote.Option
+	seen  map[string]bool
+	Count int
+}
+
+// add fetches ref and appends it to the layout under refName.
+func (w *mirrorWriter) add(ctx context.Context, ref name.Reference, refName string) (*remote.Descriptor, error) {
+	desc, err := remoteGet(ctx, ref, w.opts...)
+	if err != nil {
+		return nil, err
+	}
+	key := refName + "@" + desc.Digest.String()
+	if w.seen[key] {
+		return desc, nil
+	}
+	w.seen[key] = true
+	annotations := layout.WithAnnotations(map[string]string{mirrorRefAnnotation: refName})
+	if desc.MediaType.IsIndex() {
+		idx, ierr := desc.ImageIndex()
+		if ierr != nil {
+			return nil, ierr
+		}
+		err = w.path.AppendIndex(idx, annotations)
+	} else {
+		img, ierr := desc.Image()
+		if ierr != nil {
+			return nil, ierr
+		}
+		err = w.path.AppendImage(img, annotations)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("writing %s: %w", refName, err)
+	}
+	w.Count++
+	slog.Info("Exported image", util.LogKeyTag, refName)
+	return desc, nil
+}
+
+// exportMirror writes refs, with all platforms, their cosign signatures,
+// attestations and SBOMs, and their referrers, to an OCI layout in dir.
+// It returns the number of manifests written.
+func exportMirror(ctx context.Context, refs []string, dir string, insecure []string) (int, error) {
+	p, err := layout.Write(dir, empty.Index)
+	if err != nil {
+		return 0, err
+	}
+	w := &mirrorWriter{path: p, seen: map[string]bool{}}
+	for _, r := range refs {
+		ref, err := parseReferenceForRemote(r, insecure)
+		if err != nil {
+			return 0, fmt.Errorf("parsing %s: %w", r, err)
+		}
+		w.opts = remoteOptionsFor(ctx, r, insecure)
+		desc, err := w.add(ctx, ref, mirrorRefName(ref))
+		if err != nil {
+			return 0, fmt.Errorf("exporting %s: %w", r, err)
+		}
+		for _, suffix := range mirrorSignatureSuffixes {
+			tag := ref.Context().Tag(strings.Replace(desc.Digest.String(), ":", "-", 1) + suffix)
+			if _, err := w.add(ctx, tag, tag.Name()); err != nil && !isNotFound(err) {
+				return 0, fmt.Errorf("exporting %s: %w", tag, err)
+			}
+		}
+		referrers, err := remote.Referrers(ref.Context().Digest(desc.Digest.String()), w.opts...)
+		if err != nil {
+			return 0, fmt.Errorf("listing referrers of %s: %w", r, err)
+		}
+		manifest, err := referrers.IndexManifest()
+		if err != nil {
+			return 0, err
+		}
+		for _, m := range manifest.Manifests {
+			d := ref.Context().Digest(m.Digest.String())
+			if _, err := w.add(ctx, d, d.Name()); err != nil {
+				return 0, fmt.Errorf("exporting referrer %s: %w", d, err)
+			}
+		}
+	}
+	return w.Count, nil
+}
+
+// importMirror pushes every manifest of the OCI layout in dir to registry
+// (host or host/prefix), keeping repository paths and tags. Digest-only
+// manifests (referrers) are pushed by digest. It returns the pushed refs.
+func importMirror(ctx context.Context, dir, registry string, insecure []string) ([]string, error) {
+	p, err := layout.FromPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := p.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	var pushed []string
+	for _, desc := range manifest.Manifests {
+		refName := desc.Annotations[mirrorRefAnnotation]
+		if refName == "" {
+			continue
+		}
+		src, err := name.ParseReference(refName)
+		if err != nil {
+			return pushed, fmt.Errorf("invalid %s %q: %w", mirrorRefAnnotation, refName, err)
+		}
+		target := strings.TrimSuffix(registry, "/") + "/" + src.Context().RepositoryStr()
+		if _, ok := src.(name.Digest); ok {
+			target += "@" + src.Identifier()
+		} else {
+			target += ":" + src.Identifier()
+		}
+		dst, err := parseReferenceForRemote(target, insecure)
+		if err != nil {
+			return pushed, err
+		}
+		var content remote.Taggable
+		if desc.MediaType.IsIndex() {
+			if content, err = idx.ImageIndex(desc.Digest); err != nil {
+				return pushed, err
+			}
+		} else {
+			if content, err = idx.Image(desc.Digest); err != nil {
+				return pushed, err
+			}
+		}
+		opts, done := withTransferProgress(target, remoteOptionsFor(ctx, target, insecure))
+		err = remote.Push(dst, content, opts...)
+		done()
+		if err != nil {
+			return pushed, fmt.Errorf("pushing %s: %w", target, err)
+		}
+		pushed = append(pushed, target)
+	}
+	return pushed, nil
+}
+
+// tarDirectory writes the files under dir to a tar file.
+func tarDirectory(dir, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(f)
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = src.Close() }()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// untarDirectory extracts the tar file into dir, rejecting paths that escape it.
+func untarDirectory(file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(dst, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path %q in %s", hdr.Name, file)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dst, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+				return err
+			}
+			out, err := os.Create(dst)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			_ = out.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Short: "Copy images to and from an OCI layout tarball for air-gapped registries.",
+	Long: `Mirror images into disconnected environments: op mirror export writes
+images with all platforms, cosign signatures/attestations/SBOMs and OCI
+referrers to an OCI layout tarball; op mirror import pushes the tarball into
+a target registry, keeping repository paths and tags.`,
+}
+
+var mirrorExportCmd = &cobra.Command{
+	Use:   "export <tar> [ref...]",
+	Short: "Write images, signatures and referrers to an OCI layout tarball.",
+	Long: `Write the given refs, the refs listed in --images (one per line, #
+comments allowed) and the images of each --build-result-dir to an OCI layout
+tarball. Each image is copied with every platform of its index, its cosign
+signature, attestation and SBOM tags (sha256-<digest>.sig/.att/.sbom) and
+its OCI referrers.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listFile, _ := cmd.Flags().GetString("images")
+		buildResultDirs, _ := cmd.Flags().GetStringArray("build-result-dir")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		refs, err := mirrorRefs(args[1:], listFile, buildResultDirs)
+		if err != nil {
+			return err
+		}
+		dir, err := os.MkdirTemp("", "op-mirror-")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.RemoveAll(dir) }()
+		count, err := exportMirror(cmd.Context(), refs, dir, insecureRegistries(insecureFlag))
+		if err != nil {
+			return err
+		}
+		if err := tarDirectory(dir, args[0]); err != nil {
+			return fmt.Errorf("writing %s: %w", args[0], err)
+		}
+		slog.Info("Wrote mirror archive", "file", args[0], "manifests", count, "images", len(refs))
+		return nil
+	},
+}
+
+var mirrorImportCmd = &cobra.Command{
+	Use:   "import <tar>",
+	Short: "Push an op mirror export tarball into a registry.",
+	Long: `Push every manifest of a tarball written by op mirror export to
+--registry (a host, or host/prefix), keeping repository paths and tags:
+ghcr.io/my-org/my-app:1.2.3 becomes <registry>/my-org/my-app:1.2.3.
+Signatures and referrers are pushed alongside, so cosign verify and
+op sbom download work against the mirror.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		registry, _ := cmd.Flags().GetString("registry")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		dir, err := os.MkdirTemp("", "op-mirror-")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.RemoveAll(dir) }()
+		if err := untarDirectory(args[0], dir); err != nil {
+			return fmt.Errorf("reading %s: %w", args[0], err)
+		}
+		pushed, err := importMirror(cmd.Context(), dir, registry, insecureRegistries(insecureFlag))
+		for _, ref := range pushed {
+			slog.Info("Imported image", util.LogKeyTag, ref)
+		}
+		return util.WithExitCode(util.ExitPush, err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mirrorCmd)
+	mirrorCmd.AddCommand(mirrorExportCmd)
+	mirrorExportCmd.Flags().String("images", "", "File listing image refs to mirror, one per line")
+	mirrorExportCmd.Flags().StringArray("build-result-dir", nil, "Mirror the images of build_result.json in this directory (repeatable)")
+	mirrorExportCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+
+	mirrorCmd.AddCommand(mirrorImportCmd)
+	mirrorImportCmd.Flags().String("registry", "", "Target registry, e.g. registry.internal:5000 or registry.internal/mirror")
+	mirrorImportCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+	_ = mirrorImportCmd.MarkFlagRequired("registry")
+}
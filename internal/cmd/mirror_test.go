@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadImageList(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "images.txt")
+	require.NoError(t, os.WriteFile(file, []byte("# base images\nghcr.io/org/app:1.0\n\n  busybox:stable  # helper\n"), 0o644))
+	refs, err := readImageList(file)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ghcr.io/org/app:1.0", "busybox:stable"}, refs)
+}
+
+func TestMirrorRefs_RequiresImages(t *testing.T) {
+	_, err := mirrorRefs(nil, "", nil)
+	assert.Error(t, err)
+}
+
+func TestMirrorRefName(t *testing.T) {
+	for in, want := range map[string]string{
+		"ghcr.io/org/app:1.0":                 "ghcr.io/org/app:1.0",
+		"ghcr.io/org/app:1.0@" + testDigest:   "ghcr.io/org/app:1.0",
+		"ghcr.io/org/app@" + testDigest:       "ghcr.io/org/app@" + testDigest,
+		"localhost:5001/app@" + testDigest:    "localhost:5001/app@" + testDigest,
+		"localhost:5001/app:v2@" + testDigest: "localhost:5001/app:v2",
+		"busybox:stable":                      "index.docker.io/library/busybox:stable",
+	} {
+		ref, err := name.ParseReference(in)
+		require.NoError(t, err)
+		assert.Equal(t, want, mirrorRefName(ref), in)
+	}
+}
+
+func TestMirrorExportImport(t *testing.T) {
+	src := startTestRegistry(t)
+	dst := startTestRegistry(t)
+	repo, err := name.NewRepository(src + "/org/app")
+	require.NoError(t, err)
+
+	idx, err := random.Index(64, 1, 2)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(repo.Tag("1.0"), idx))
+	digest, err := idx.Digest()
+	require.NoError(t, err)
+
+	sig, err := random.Image(32, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(repo.Tag(strings.Replace(digest.String(), ":", "-", 1)+".sig"), sig))
+
+	desc, err := partial.Descriptor(idx)
+	require.NoError(t, err)
+	sbom, err := random.Image(32, 1)
+	require.NoError(t, err)
+	referrer, ok := mutate.Subject(mutate.ConfigMediaType(sbom, "application/spdx+json"), *desc).(v1.Image)
+	require.True(t, ok)
+	referrerDigest, err := referrer.Digest()
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(repo.Digest(referrerDigest.String()), referrer))
+
+	dir := t.TempDir()
+	layoutDir := filepath.Join(dir, "layout")
+	count, err := exportMirror(t.Context(), []string{repo.Tag("1.0").String()}, layoutDir, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	file := filepath.Join(dir, "mirror.tar")
+	require.NoError(t, tarDirectory(layoutDir, file))
+	restored := filepath.Join(dir, "restored")
+	require.NoError(t, untarDirectory(file, restored))
+
+	pushed, err := importMirror(t.Context(), restored, dst+"/mirror", nil)
+	require.NoError(t, err)
+	assert.Len(t, pushed, 3)
+
+	head := func(ref string) (*v1.Descriptor, error) {
+		r, err := name.ParseReference(ref)
+		require.NoError(t, err)
+		return remote.Head(r)
+	}
+	got, err := head(dst + "/mirror/org/app:1.0")
+	require.NoError(t, err)
+	assert.Equal(t, digest, got.Digest)
+	_, err = head(dst + "/mirror/org/app:" + strings.Replace(digest.String(), ":", "-", 1) + ".sig")
+	assert.NoError(t, err)
+	_, err = head(dst + "/mirror/org/app@" + referrerDigest.String())
+	assert.NoError(t, err)
+}
+
+func TestUntarDirectory_RejectsEscapingPaths(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "evil.tar")
+	f, err := os.Create(file)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../escape", Typeflag: tar.TypeReg, Mode: 0o644}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	err = untarDirectory(file, filepath.Join(dir, "out"))
+	assert.ErrorContains(t, err, "invalid path")
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/latest"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+)
+
+// OCI labels op build derives from git.
+const (
+	ociSourceLabel   = "org.opencontainers.image.source"
+	ociRevisionLabel = "org.opencontainers.image.revision"
+	ociCreatedLabel  = "org.opencontainers.image.created"
+	ociVersionLabel  = "org.opencontainers.image.version"
+)
+
+// ociLabelBuildpackEnv are the variables of the Paketo image-labels
+// buildpack that set each label on a buildpack image.
+var ociLabelBuildpackEnv = map[string]string{
+	ociSourceLabel:   "BP_OCI_SOURCE",
+	ociRevisionLabel: "BP_OCI_REVISION",
+	ociCreatedLabel:  "BP_OCI_CREATED",
+	ociVersionLabel:  "BP_OCI_VERSION",
+}
+
+// gitOCILabels returns the OCI labels of the checkout at dir: the
+// repository URL (from the CI, else the origin remote), the commit, its
+// commit time, so rebuilds of a commit get the same label, and the CI
+// version. Labels that cannot be derived (no git, no version) are left out.
+func gitOCILabels(ctx context.Context, dir string) map[string]string {
+	labels := map[string]string{}
+	if s := gitSourceURL(ctx, dir); s != "" {
+		labels[ociSourceLabel] = s
+	}
+	if out, err := gitRun(ctx, dir, "rev-parse", "HEAD"); err == nil {
+		labels[ociRevisionLabel] = strings.TrimSpace(out)
+	}
+	if out, err := gitRun(ctx, dir, "log", "-1", "--format=%cI", "HEAD"); err == nil {
+		labels[ociCreatedLabel] = strings.TrimSpace(out)
+	}
+	if v := util.CIVersion(); v != "" {
+		labels[ociVersionLabel] = v
+	}
+	return labels
+}
+
+// gitSourceURL is the web URL of the repository: GitHub's and GitLab's CI
+// variables, else the origin remote with credentials removed and ssh
+// remotes (git@host:org/repo.git) as https.
+func gitSourceURL(ctx context.Context, dir string) string {
+	if repo := os.Getenv("GITHUB_REPOSITORY"); repo != "" {
+		return firstNonEmpty(os.Getenv("GITHUB_SERVER_URL"), "https://github.com") + "/" + repo
+	}
+	if u := os.Getenv("CI_PROJECT_URL"); u != "" {
+		return u
+	}
+	out, err := gitRun(ctx, dir, "remote", "get-url", "origin")
+	if err != nil {
+		return ""
+	}
+	remote := strings.TrimSuffix(strings.TrimSpace(out), ".git")
+	if rest, ok := strings.CutPrefix(remote, "git@"); ok {
+		host, path, _ := strings.Cut(rest, ":")
+		return "https://" + host + "/" + path
+	}
+	u, err := url.Parse(remote)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	u.User = nil
+	if u.Scheme == "ssh" {
+		u.Scheme = "https"
+		u.Host = u.Hostname()
+	}
+	return u.String()
+}
+
+// addOCILabels sets labels on the artifacts Skaffold or Pack builds:
+// buildpack artifacts through the image-labels buildpack (variables an
+// artifact sets itself win), Dockerfile artifacts through docker build
+// --label.
+func addOCILabels(artifacts []*latest.Artifact, labels map[string]string) {
+	for _, a := range artifacts {
+		if a.DockerArtifact != nil {
+			a.DockerArtifact.CliFlags = append(a.DockerArtifact.CliFlags, dockerLabelArgs(labels)...)
+		}
+		bp := a.BuildpackArtifact
+		if bp == nil {
+			continue
+		}
+		for _, label := range slices.Sorted(maps.Keys(labels)) {
+			env := ociLabelBuildpackEnv[label]
+			if env == "" || slices.ContainsFunc(bp.Env, func(e string) bool { return strings.HasPrefix(e, env+"=") }) {
+				continue
+			}
+			bp.Env = append(bp.Env, env+"="+labels[label])
+		}
+	}
+}
+
+// dockerLabelArgs are the docker build arguments setting labels.
+func dockerLabelArgs(labels map[string]string) []string {
+	var args []string
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", k, labels[k]))
+	}
+	return args
+}
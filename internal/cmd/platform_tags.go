@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+)
+
+// cleanupPlatformTags deletes the intermediate per-platform tags
+// (<tag>-linux-amd64, ...) an index tag was assembled from, for op build
+// --cleanup-platform-tags. Only the tags go: the platform images stay in the
+// registry as children of the index. A registry that cannot delete a tag
+// keeps it with a warning (Docker Distribution only deletes by digest, which
+// would remove the image the index points to).
+func cleanupPlatformTags(indexTag string, platformTags []string, insecure []string, opts []remote.Option) {
+	log := util.ArtifactLogger(indexTag)
+	for _, t := range platformTags {
+		if t == indexTag {
+			continue
+		}
+		ref, err := parseReferenceForRemote(t, insecure)
+		if err != nil {
+			log.Warn("Could not parse the platform tag", util.LogKeyTag, t, "error", err)
+			continue
+		}
+		if _, ok := ref.(name.Tag); !ok {
+			continue
+		}
+		if err := remoteDelete(ref, opts...); err != nil {
+			log.Warn("Could not delete the platform tag; the registry may not support deleting tags (see op clean)", util.LogKeyTag, t, "error", err)
+			continue
+		}
+		log.Info("Deleted platform tag", util.LogKeyTag, t)
+	}
+}
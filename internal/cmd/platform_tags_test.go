@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanupPlatformTags(t *testing.T) {
+	host := startTestRegistry(t)
+	index := host + "/org/app:latest"
+	amd64, arm64 := index+"-linux-amd64", index+"-linux-arm64"
+	pushInspectImage(t, amd64, v1.Platform{OS: "linux", Architecture: "amd64"})
+	pushInspectImage(t, arm64, v1.Platform{OS: "linux", Architecture: "arm64"})
+	opts := remoteOptionsFor(t.Context(), index, nil)
+	list, err := pushArtifactIndex(index, []string{amd64, arm64}, nil, time.Time{}, nil, opts)
+	require.NoError(t, err)
+
+	cleanupPlatformTags(index, []string{amd64, arm64}, nil, opts)
+
+	for _, tag := range []string{amd64, arm64} {
+		d, err := tagDigest(t.Context(), tag, nil, opts)
+		require.NoError(t, err)
+		assert.Empty(t, d, "%s is deleted", tag)
+	}
+	// The index and its platform images remain.
+	d, err := tagDigest(t.Context(), index, nil, opts)
+	require.NoError(t, err)
+	assert.Equal(t, list.Digest, d)
+	for _, p := range list.Platforms {
+		ref, err := name.ParseReference(host + "/org/app@" + p.Digest)
+		require.NoError(t, err)
+		_, err = remote.Head(ref, opts...)
+		assert.NoError(t, err, p.Platform)
+	}
+}
+
+func TestCleanupPlatformTags_Unsupported(t *testing.T) {
+	orig := remoteDelete
+	t.Cleanup(func() { remoteDelete = orig })
+	var deleted []string
+	remoteDelete = func(ref name.Reference, _ ...remote.Option) error {
+		deleted = append(deleted, ref.String())
+		return errors.New("UNSUPPORTED: The operation is unsupported.")
+	}
+
+	// A failed delete is only a warning; the index tag itself is never deleted.
+	cleanupPlatformTags("ghcr.io/org/app:latest", []string{"ghcr.io/org/app:latest", "ghcr.io/org/app:latest-linux-amd64", "ghcr.io/org/app:latest-linux-arm64"}, nil, nil)
+	assert.Equal(t, []string{"ghcr.io/org/app:latest-linux-amd64", "ghcr.io/org/app:latest-linux-arm64"}, deleted)
+}
@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// previewCommentMarker identifies the pull request comment maintained by
+// `op preview-env`, so redeploys edit it instead of adding new ones.
+const previewCommentMarker = "<!-- op-preview-env -->"
+
+var githubPullRefPattern = regexp.MustCompile(`^refs/pull/(\d+)/`)
+
+// previewPRNumber returns the --pr flag or the number from GITHUB_REF
+// (refs/pull/<n>/merge in pull_request workflows).
+func previewPRNumber(flag int) (int, error) {
+	if flag > 0 {
+		return flag, nil
+	}
+	if m := githubPullRefPattern.FindStringSubmatch(os.Getenv("GITHUB_REF")); m != nil {
+		return strconv.Atoi(m[1])
+	}
+	return 0, fmt.Errorf("no pull request number: set --pr or run in a pull_request workflow")
+}
+
+// previewProject is the project name used for default release names and
+// ttl.sh paths: the GitHub repository name, else the working directory.
+func previewProject(ctx context.Context, cwd string) string {
+	if slug, err := currentGitHubRepo(ctx); err == nil {
+		return util.K8sName(slug)
+	}
+	return util.K8sName(filepath.Base(cwd))
+}
+
+// previewBuildArgs returns the `op build` arguments pushing PR images to
+// <repo>/pr-<n>, or to ttl.sh when no repo is configured.
+func previewBuildArgs(o util.PreviewOpts, project string, n util.PreviewNames, insecure string) []string {
+	args := []string{"build", "--push"}
+	if o.Repo != "" {
+		args = append(args, "--repo", fmt.Sprintf("%s/pr-%d", strings.TrimSuffix(o.Repo, "/"), n.PR))
+	} else {
+		args = append(args, "--ttl-uuid", fmt.Sprintf("%s-pr-%d", project, n.PR), "--ttl-tag", firstNonEmpty(o.TTL, "24h"))
+	}
+	if insecure != "" {
+		args = append(args, "--insecure-registry", insecure)
+	}
+	return args
+}
+
+// previewBuild runs `op build` for the preview images. It is a var so tests
+// can replace it.
+var previewBuild = func(ctx context.Context, args []string) error {
+	return runSelf(ctx, nil, args...)
+}
+
+// previewHelmArgs returns the helm upgrade --install arguments deploying
+// the images of res.
+func previewHelmArgs(o util.PreviewOpts, chart string, n util.PreviewNames, res *util.BuildResult) ([]string, error) {
+	args := []string{"upgrade", "--install", n.Release, chart,
+		"--namespace", n.Namespace, "--create-namespace", "--wait", "--timeout", "10m"}
+	if o.KubeContext != "" {
+		args = append(args, "--kube-context", o.KubeContext)
+	}
+	for _, b := range res.Builds {
+		prefix := o.ImageValues[b.ImageName]
+		if prefix == "" && len(res.Builds) == 1 {
+			prefix = "image"
+		}
+		if prefix == "" {
+			continue
+		}
+		repo, tag, digest := util.SplitImageRef(b.Tag)
+		args = append(args, "--set", prefix+".repository="+repo, "--set", prefix+".tag="+tag)
+		if tag == "" && digest != "" {
+			args = append(args, "--set", prefix+".digest="+digest)
+		}
+	}
+	if len(res.Builds) > 1 && len(o.ImageValues) == 0 {
+		return nil, fmt.Errorf("build_result.json has %d images: set preview.image_values in %s", len(res.Builds), util.RunConfigFilename)
+	}
+	keys := make([]string, 0, len(o.Values))
+	for k := range o.Values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--set", k+"="+n.Expand(o.Values[k]))
+	}
+	return args, nil
+}
+
+// upsertPRComment creates or edits the preview comment on pull request pr.
+func upsertPRComment(slug string, pr int, body, token string) error {
+	body = previewCommentMarker + "\n" + body
+	api := githubAPIURL() + "/repos/" + slug + "/issues"
+	var comments []struct {
+		ID   int64  `json:"id"`
+		Body string `json:"body"`
+	}
+	if err := githubRequest(http.MethodGet, fmt.Sprintf("%s/%d/comments?per_page=100", api, pr), "application/json", nil, token, http.StatusOK, &comments); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+	for _, c := range comments {
+		if strings.Contains(c.Body, previewCommentMarker) {
+			return githubRequest(http.MethodPatch, fmt.Sprintf("%s/comments/%d", api, c.ID), "application/json", bytes.NewReader(payload), token, http.StatusOK, nil)
+		}
+	}
+	return githubRequest(http.MethodPost, fmt.Sprintf("%s/%d/comments", api, pr), "application/json", bytes.NewReader(payload), token, http.StatusCreated, nil)
+}
+
+// previewNotify posts body to the pull request when a GitHub token is set,
+// and to the configured notification_urls.
+func previewNotify(ctx context.Context, pr int, body string) {
+	notifyWebhooks(viper.GetStringSlice("notification_urls"), body)
+	token := githubToken()
+	if token == "" {
+		return
+	}
+	slug, err := currentGitHubRepo(ctx)
+	if err == nil {
+		err = upsertPRComment(slug, pr, body, token)
+	}
+	if err != nil {
+		slog.Warn("Could not comment on pull request", "pr", pr, "error", err)
+	}
+}
+
+// notifyWebhooks posts text as {"text": ...} (the Slack incoming-webhook
+// format, also accepted by Mattermost and Teams workflows) to each URL.
+// Failures are warnings naming only the host: webhook URLs embed secrets.
+func notifyWebhooks(urls []string, text string) {
+	payload, _ := json.Marshal(map[string]string{"text": text})
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, u := range urls {
+		resp, err := client.Post(u, "application/json", bytes.NewReader(payload))
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("status %s", resp.Status)
+			}
+		}
+		if err != nil {
+			host := "webhook"
+			if parsed, perr := url.Parse(u); perr == nil && parsed.Host != "" {
+				host = parsed.Host
+			}
+			slog.Warn("Notification failed", "host", host, "error", err)
+		}
+	}
+}
+
+// previewSetup loads the preview configuration and names for the command.
+func previewSetup(cmd *cobra.Command) (string, util.PreviewOpts, util.PreviewNames, error) {
+	cwd, _ := os.Getwd()
+	prFlag, _ := cmd.Flags().GetInt("pr")
+	pr, err := previewPRNumber(prFlag)
+	if err != nil {
+		return "", util.PreviewOpts{}, util.PreviewNames{}, err
+	}
+	cfg, err := util.LoadRunConfig(cwd)
+	if err != nil {
+		return "", util.PreviewOpts{}, util.PreviewNames{}, err
+	}
+	return cwd, cfg.Preview, cfg.Preview.Names(pr, previewProject(cmd.Context(), cwd)), nil
+}
+
+var previewEnvCmd = &cobra.Command{
+	Use:   "preview-env",
+	Short: "Deploy and destroy per-pull-request preview environments.",
+	Long: `Manage ephemeral preview environments for pull requests, configured in
+.github/octopilot.yaml:
+
+  preview:
+    chart: deploy/chart
+    namespace: preview              # -> preview-pr-<n>
+    repo: ghcr.io/my-org/previews   # -> ghcr.io/my-org/previews/pr-<n>; default ttl.sh
+    kube_context: dev
+    values:
+      ingress.host: "{release}.preview.example.com"
+    url: https://{release}.preview.example.com
+
+The pull request number comes from --pr or GITHUB_REF. With GITHUB_TOKEN (or
+GitHub App credentials, GITHUB_APP_ID) set the preview URL is posted to (and
+kept up to date on) the pull request.`,
+}
+
+var previewEnvDeployCmd = &cobra.Command{
+	Use:   "deploy",
+	Short: "Build the PR images and deploy the chart into the PR namespace.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		skipBuild, _ := cmd.Flags().GetBool("skip-build")
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		insecure, _ := cmd.Flags().GetString("insecure-registry")
+
+		cwd, o, n, err := previewSetup(cmd)
+		if err != nil {
+			return err
+		}
+		if o.Chart == "" {
+			return fmt.Errorf("no preview chart: set preview.chart in %s", util.RunConfigFilename)
+		}
+		if !skipBuild {
+			if err := previewBuild(cmd.Context(), previewBuildArgs(o, previewProject(cmd.Context(), cwd), n, insecure)); err != nil {
+				return fmt.Errorf("build failed: %w", err)
+			}
+		}
+		res, err := util.ReadBuildResult(buildResultDir)
+		if err != nil {
+			return err
+		}
+		helmArgs, err := previewHelmArgs(o, resolveChartPath(cwd, o.Chart), n, res)
+		if err != nil {
+			return err
+		}
+		if err := util.RunCommand(cmd.Context(), "helm", helmArgs...); err != nil {
+			return fmt.Errorf("helm install of %s failed: %w", o.Chart, err)
+		}
+
+		msg := fmt.Sprintf("Preview environment for #%d deployed: release `%s` in namespace `%s`.", n.PR, n.Release, n.Namespace)
+		if o.URL != "" {
+			msg = fmt.Sprintf("Preview environment for #%d: %s", n.PR, n.Expand(o.URL))
+		}
+		fmt.Println(msg)
+		previewNotify(cmd.Context(), n.PR, msg)
+		return nil
+	},
+}
+
+var previewEnvDestroyCmd = &cobra.Command{
+	Use:   "destroy",
+	Short: "Uninstall the PR release and delete its namespace.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, o, n, err := previewSetup(cmd)
+		if err != nil {
+			return err
+		}
+		helmArgs := []string{"uninstall", n.Release, "--namespace", n.Namespace, "--ignore-not-found"}
+		kubectlArgs := []string{"delete", "namespace", n.Namespace, "--ignore-not-found"}
+		if o.KubeContext != "" {
+			helmArgs = append(helmArgs, "--kube-context", o.KubeContext)
+			kubectlArgs = append(kubectlArgs, "--context", o.KubeContext)
+		}
+		if err := util.RunCommand(cmd.Context(), "helm", helmArgs...); err != nil {
+			return fmt.Errorf("helm uninstall failed: %w", err)
+		}
+		if err := util.RunCommand(cmd.Context(), "kubectl", kubectlArgs...); err != nil {
+			return fmt.Errorf("deleting namespace %s failed: %w", n.Namespace, err)
+		}
+		msg := fmt.Sprintf("Preview environment for #%d destroyed.", n.PR)
+		fmt.Println(msg)
+		previewNotify(cmd.Context(), n.PR, msg)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(previewEnvCmd)
+	previewEnvCmd.AddCommand(previewEnvDeployCmd, previewEnvDestroyCmd)
+	for _, c := range []*cobra.Command{previewEnvDeployCmd, previewEnvDestroyCmd} {
+		c.Flags().Int("pr", 0, "Pull request number (default: from GITHUB_REF)")
+	}
+	previewEnvDeployCmd.Flags().Bool("skip-build", false, "Deploy the images already in build_result.json without building")
+	previewEnvDeployCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json (default: cwd)")
+	previewEnvDeployCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated (e.g. localhost:5001,myreg:5000). Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreviewPRNumber(t *testing.T) {
+	t.Setenv("GITHUB_REF", "refs/pull/17/merge")
+	pr, err := previewPRNumber(0)
+	require.NoError(t, err)
+	assert.Equal(t, 17, pr)
+
+	pr, err = previewPRNumber(5)
+	require.NoError(t, err)
+	assert.Equal(t, 5, pr)
+
+	t.Setenv("GITHUB_REF", "refs/heads/main")
+	_, err = previewPRNumber(0)
+	assert.Error(t, err)
+}
+
+func TestPreviewBuildArgs(t *testing.T) {
+	n := util.PreviewNames{PR: 9}
+	assert.Equal(t, []string{"build", "--push", "--ttl-uuid", "my-app-pr-9", "--ttl-tag", "24h"},
+		previewBuildArgs(util.PreviewOpts{}, "my-app", n, ""))
+	assert.Equal(t, []string{"build", "--push", "--repo", "ghcr.io/org/previews/pr-9", "--insecure-registry", "localhost:5001"},
+		previewBuildArgs(util.PreviewOpts{Repo: "ghcr.io/org/previews/", TTL: "2h"}, "my-app", n, "localhost:5001"))
+}
+
+func TestPreviewHelmArgs(t *testing.T) {
+	n := util.PreviewNames{PR: 9, Release: "my-app-pr-9", Namespace: "preview-pr-9"}
+	res := &util.BuildResult{Builds: []util.BuildEntry{{ImageName: "my-app", Tag: "ttl.sh/my-app-pr-9-app:24h@" + testDigest}}}
+	o := util.PreviewOpts{KubeContext: "dev", Values: map[string]string{"ingress.host": "{release}.example.com", "replicas": "1"}}
+
+	args, err := previewHelmArgs(o, "/repo/chart", n, res)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"upgrade", "--install", "my-app-pr-9", "/repo/chart",
+		"--namespace", "preview-pr-9", "--create-namespace", "--wait", "--timeout", "10m",
+		"--kube-context", "dev",
+		"--set", "image.repository=ttl.sh/my-app-pr-9-app", "--set", "image.tag=24h",
+		"--set", "ingress.host=my-app-pr-9.example.com", "--set", "replicas=1"}, args)
+
+	res.Builds = append(res.Builds, util.BuildEntry{ImageName: "worker", Tag: "ghcr.io/org/worker:pr-9"})
+	_, err = previewHelmArgs(util.PreviewOpts{}, "chart", n, res)
+	assert.ErrorContains(t, err, "preview.image_values")
+
+	args, err = previewHelmArgs(util.PreviewOpts{ImageValues: map[string]string{"worker": "worker.image"}}, "chart", n, res)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--set", "worker.image.repository=ghcr.io/org/worker", "--set", "worker.image.tag=pr-9"}, args[len(args)-4:])
+}
+
+func TestUpsertPRComment(t *testing.T) {
+	var method, path, body string
+	existing := `[{"id":1,"body":"LGTM"}]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			assert.Equal(t, "/repos/org/app/issues/4/comments", r.URL.Path)
+			_, _ = w.Write([]byte(existing))
+			return
+		}
+		method, path = r.Method, r.URL.Path
+		var payload map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		body = payload["body"]
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("GITHUB_API_URL", srv.URL)
+
+	require.NoError(t, upsertPRComment("org/app", 4, "deployed", "tok"))
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, "/repos/org/app/issues/4/comments", path)
+	assert.Equal(t, previewCommentMarker+"\ndeployed", body)
+
+	existing = `[{"id":1,"body":"LGTM"},{"id":99,"body":"` + previewCommentMarker + `\nold"}]`
+	require.NoError(t, upsertPRComment("org/app", 4, "destroyed", "tok"))
+	assert.Equal(t, http.MethodPatch, method)
+	assert.Equal(t, "/repos/org/app/issues/comments/99", path)
+}
+
+func TestPreviewEnvDestroy(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(dir+"/.github", 0o755))
+	require.NoError(t, os.WriteFile(dir+"/"+util.RunConfigFilename, []byte("preview:\n  release: web\n  kube_context: dev\n"), 0o644))
+	cwd, _ := os.Getwd()
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "")
+
+	var ran [][]string
+	oldRun := util.RunCommandFn
+	util.RunCommandFn = func(_ context.Context, name string, args ...string) error {
+		ran = append(ran, append([]string{name}, args...))
+		return nil
+	}
+	defer func() { util.RunCommandFn = oldRun }()
+
+	_ = previewEnvDestroyCmd.Flags().Set("pr", "12")
+	defer func() { _ = previewEnvDestroyCmd.Flags().Set("pr", "0") }()
+	previewEnvDestroyCmd.SetContext(t.Context())
+	require.NoError(t, previewEnvDestroyCmd.RunE(previewEnvDestroyCmd, nil))
+	assert.Equal(t, [][]string{
+		{"helm", "uninstall", "web-pr-12", "--namespace", "preview-pr-12", "--ignore-not-found", "--kube-context", "dev"},
+		{"kubectl", "delete", "namespace", "preview-pr-12", "--ignore-not-found", "--context", "dev"},
+	}, ran)
+}
@@ -2,24 +2,36 @@ package cmd
 
 import (
 	"fmt"
-	"strings"
+	"log/slog"
 
 	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/octopilot/octopilot-pipeline-tools/pkg/pipeline"
 	"github.com/spf13/cobra"
 )
 
-// craneCopy is a var so it can be replaced in tests.
+// craneCopy is a var so it can be replaced in tests. The copy reports its
+// progress (see util.TrackTransfer).
 var craneCopy = func(src, dst string, opts ...crane.Option) error {
-	return crane.Copy(src, dst, opts...)
+	updates, done := util.TrackTransfer(dst)
+	defer done()
+	return crane.Copy(src, dst, append(opts, func(o *crane.Options) {
+		o.Remote = append(o.Remote, remote.WithProgress(updates))
+	})...)
 }
 
+// craneVerify checks the destination after the copy; a var so it can be
+// replaced in tests.
+var craneVerify = pipeline.VerifyCopy
+
 var promoteCmd = &cobra.Command{
 	Use:   "promote-image",
 	Short: "Copy image from source to destination registry (using crane library).",
 	Long: `Promote (copy) a container image from a source environment registry to a
 destination registry without rebuilding. Reads the image reference from
-build_result.json.
+build_result.json. After the copy the destination is checked to hold the
+source digest and, for a multi-platform index, every platform image.
 
 When skaffold.yaml defines multiple artifacts (e.g. a base image and an
 application image), use --image-name to select which artifact to promote.
@@ -28,44 +40,47 @@ image; base images appear first by convention).`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		sourceEnv, _ := cmd.Flags().GetString("source")
 		destEnv, _ := cmd.Flags().GetString("destination")
-		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
 		imageName, _ := cmd.Flags().GetString("image-name")
+		estargz, _ := cmd.Flags().GetBool("estargz")
 
-		srcRepo, destRepo := util.GetPromoteRepositories(sourceEnv, destEnv)
-		if srcRepo == "" || destRepo == "" {
-			return fmt.Errorf("could not resolve repositories — set GOOGLE_GKE_IMAGE_* env vars or config")
-		}
-
-		res, err := util.ReadBuildResult(buildResultDir)
+		srcRepo, destRepo, err := util.GetPromoteRepositories(sourceEnv, destEnv)
 		if err != nil {
-			return fmt.Errorf("reading build_result.json: %w", err)
+			return util.WithExitCode(util.ExitConfig, err)
 		}
-
-		// Select the correct artifact (by name or last entry).
-		fullRef, err := util.SelectTag(res, imageName)
-		if err != nil {
-			return fmt.Errorf("selecting image: %w", err)
+		if srcRepo == "" || destRepo == "" {
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("could not resolve repositories — set environments in .registry, GOOGLE_GKE_IMAGE_* env vars or config"))
 		}
 
-		// fullRef is the fully-qualified stored ref:
-		//   ghcr.io/octopilot/op:v1.0.0@sha256:abc123...
-		//
-		// srcRef: use the stored ref directly (it already includes the source registry).
-		// destRef: replace the source registry prefix with the destination prefix.
-		srcRef := fullRef
-		imageRelPath := fullRef
-		if strings.HasPrefix(fullRef, srcRepo+"/") {
-			imageRelPath = strings.TrimPrefix(fullRef, srcRepo+"/")
+		craneOpts := []crane.Option{crane.WithAuthFromKeychain(util.Keychain())}
+		endpoints := util.ResolveRegistryEndpoints("", insecureRegistries(""))
+		insecure := endpoints.InsecureRegistries()
+		insecureRepo := endpoints.Insecure(srcRepo) || endpoints.Insecure(destRepo)
+		if insecureRepo {
+			craneOpts = append(craneOpts, crane.Insecure)
+		}
+		craneOpts = append(craneOpts, crane.WithTransport(util.RegistryTransport(util.RegistryHTTPTransport(insecureRepo))))
+		if err := ensureHarborProject(cmd.Context(), destRepo, insecure); err != nil {
+			return err
 		}
-		destRef := fmt.Sprintf("%s/%s", strings.TrimSuffix(destRepo, "/"), imageRelPath)
-
-		fmt.Printf("Promoting %s\n     -> %s\n", srcRef, destRef)
 
-		if err := craneCopy(srcRef, destRef); err != nil {
-			return fmt.Errorf("promotion failed: %w", err)
+		if _, err := pipeline.Promote(cmd.Context(), pipeline.PromoteOptions{
+			BuildResultFile: buildResultInput(cmd),
+			ImageName:       imageName,
+			SourceRepo:      srcRepo,
+			DestinationRepo: destRepo,
+			Copy: func(src, dst string, opts ...crane.Option) error {
+				return util.WithExitCode(util.ExitPush, craneCopy(src, dst, opts...))
+			},
+			Verify: func(src, dst string, opts ...crane.Option) error {
+				return util.WithExitCode(util.ExitPush, craneVerify(src, dst, opts...))
+			},
+			CraneOptions: craneOpts,
+			Estargz:      estargz,
+		}); err != nil {
+			return err
 		}
 
-		fmt.Println("Promotion successful.")
+		slog.Info("Promotion successful")
 		return nil
 	},
 }
@@ -75,7 +90,12 @@ func init() {
 	promoteCmd.Flags().String("source", "", "Source environment (dev, pp, prod)")
 	promoteCmd.Flags().String("destination", "", "Destination environment (pp, prod)")
 	promoteCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json (default: cwd)")
+	promoteCmd.Flags().String("build-result-file", "", "Build result file to read (default: $OP_BUILD_RESULT_FILE, build_result_file, then build_result.json)")
 	promoteCmd.Flags().String("image-name", "", "Artifact name to promote (default: last entry in build_result.json)")
+	promoteCmd.Flags().Bool("estargz", false, "Convert the layers to eStargz for lazy-pulling snapshotters (the destination gets a new digest)")
 	_ = promoteCmd.MarkFlagRequired("source")
 	_ = promoteCmd.MarkFlagRequired("destination")
+	_ = promoteCmd.RegisterFlagCompletionFunc("source", completeEnvironments)
+	_ = promoteCmd.RegisterFlagCompletionFunc("destination", completeEnvironments)
+	_ = promoteCmd.RegisterFlagCompletionFunc("image-name", completeBuildResultImages)
 }
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -35,12 +36,14 @@ func TestPromote_SingleArtifact(t *testing.T) {
 		return nil
 	}
 	defer func() { craneCopy = old }()
+	stubCraneVerify(t, nil)
 
 	_ = promoteCmd.Flags().Set("source", "dev")
 	_ = promoteCmd.Flags().Set("destination", "pp")
 	_ = promoteCmd.Flags().Set("build-result-dir", dir)
 	_ = promoteCmd.Flags().Set("image-name", "")
 
+	promoteCmd.SetContext(t.Context())
 	err := promoteCmd.RunE(promoteCmd, nil)
 	require.NoError(t, err)
 
@@ -65,12 +68,14 @@ func TestPromote_MultiArtifact_SelectsByName(t *testing.T) {
 		return nil
 	}
 	defer func() { craneCopy = old }()
+	stubCraneVerify(t, nil)
 
 	_ = promoteCmd.Flags().Set("source", "dev")
 	_ = promoteCmd.Flags().Set("destination", "pp")
 	_ = promoteCmd.Flags().Set("build-result-dir", dir)
 	_ = promoteCmd.Flags().Set("image-name", "op")
 
+	promoteCmd.SetContext(t.Context())
 	err := promoteCmd.RunE(promoteCmd, nil)
 	require.NoError(t, err)
 
@@ -95,18 +100,52 @@ func TestPromote_MultiArtifact_DefaultsToLast(t *testing.T) {
 		return nil
 	}
 	defer func() { craneCopy = old }()
+	stubCraneVerify(t, nil)
 
 	_ = promoteCmd.Flags().Set("source", "dev")
 	_ = promoteCmd.Flags().Set("destination", "pp")
 	_ = promoteCmd.Flags().Set("build-result-dir", dir)
 	_ = promoteCmd.Flags().Set("image-name", "")
 
+	promoteCmd.SetContext(t.Context())
 	err := promoteCmd.RunE(promoteCmd, nil)
 	require.NoError(t, err)
 	// Default is last entry = op, not op-base
 	assert.Equal(t, "ghcr.io/acme/op:v1@sha256:bbb", srcRef)
 }
 
+func TestPromote_CopyFailureIsPushError(t *testing.T) {
+	dir := t.TempDir()
+	writeBuildResultFile(t, dir, []util.BuildEntry{
+		{ImageName: "my-app", Tag: "ghcr.io/acme/my-app:v1@sha256:abc"},
+	})
+
+	t.Setenv("GOOGLE_GKE_IMAGE_REPOSITORY", "ghcr.io/acme")
+	t.Setenv("GOOGLE_GKE_IMAGE_PP_REPOSITORY", "europe-west1-docker.pkg.dev/proj/reg")
+
+	old := craneCopy
+	craneCopy = func(src, dst string, _ ...crane.Option) error {
+		return errors.New("DENIED: permission denied")
+	}
+	defer func() { craneCopy = old }()
+	stubCraneVerify(t, nil)
+
+	_ = promoteCmd.Flags().Set("source", "dev")
+	_ = promoteCmd.Flags().Set("destination", "pp")
+	_ = promoteCmd.Flags().Set("build-result-dir", dir)
+	_ = promoteCmd.Flags().Set("image-name", "")
+
+	promoteCmd.SetContext(t.Context())
+	err := promoteCmd.RunE(promoteCmd, nil)
+	require.Error(t, err)
+	assert.Equal(t, util.ExitPush, util.ExitCode(err))
+
+	_ = promoteCmd.Flags().Set("destination", "nope")
+	err = promoteCmd.RunE(promoteCmd, nil)
+	require.Error(t, err)
+	assert.Equal(t, util.ExitConfig, util.ExitCode(err))
+}
+
 func TestPromote_MissingBuildResult(t *testing.T) {
 	t.Setenv("GOOGLE_GKE_IMAGE_REPOSITORY", "ghcr.io/acme")
 	t.Setenv("GOOGLE_GKE_IMAGE_PP_REPOSITORY", "europe-west1-docker.pkg.dev/proj/reg")
@@ -116,7 +155,42 @@ func TestPromote_MissingBuildResult(t *testing.T) {
 	_ = promoteCmd.Flags().Set("build-result-dir", t.TempDir()) // empty dir
 	_ = promoteCmd.Flags().Set("image-name", "")
 
+	promoteCmd.SetContext(t.Context())
 	err := promoteCmd.RunE(promoteCmd, nil)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "build_result.json")
 }
+
+// stubCraneVerify replaces craneVerify with a check returning err.
+func stubCraneVerify(t *testing.T, err error) {
+	t.Helper()
+	old := craneVerify
+	craneVerify = func(string, string, ...crane.Option) error { return err }
+	t.Cleanup(func() { craneVerify = old })
+}
+
+func TestPromote_VerifyFailureIsPushError(t *testing.T) {
+	dir := t.TempDir()
+	writeBuildResultFile(t, dir, []util.BuildEntry{
+		{ImageName: "my-app", Tag: "ghcr.io/acme/my-app:v1@sha256:abc"},
+	})
+
+	t.Setenv("GOOGLE_GKE_IMAGE_REPOSITORY", "ghcr.io/acme")
+	t.Setenv("GOOGLE_GKE_IMAGE_PP_REPOSITORY", "europe-west1-docker.pkg.dev/proj/reg")
+
+	old := craneCopy
+	craneCopy = func(string, string, ...crane.Option) error { return nil }
+	defer func() { craneCopy = old }()
+	stubCraneVerify(t, errors.New("the destination registry rewrote the manifest"))
+
+	_ = promoteCmd.Flags().Set("source", "dev")
+	_ = promoteCmd.Flags().Set("destination", "pp")
+	_ = promoteCmd.Flags().Set("build-result-dir", dir)
+	_ = promoteCmd.Flags().Set("image-name", "")
+
+	promoteCmd.SetContext(t.Context())
+	err := promoteCmd.RunE(promoteCmd, nil)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "rewrote the manifest")
+	assert.Equal(t, util.ExitPush, util.ExitCode(err))
+}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// Local registry container conventions (see CONTRIBUTING.md). The container
+// name, host and port are configurable; see util.ResolveLocalRegistry.
+const (
+	localRegistryImage      = "ghcr.io/octopilot/registry-tls:latest"
+	localRegistryDataPath   = "/var/lib/registry"
+	localRegistryCertsPath  = "/etc/envoy/certs"
+	localRegistryCertPath   = localRegistryCertsPath + "/tls.crt"
+	localRegistryAuthPath   = "/auth"
+	localRegistryConfigPath = "/etc/docker/registry/config.yml"
+)
+
+// currentLocalRegistry resolves the local registry settings for the working directory.
+func currentLocalRegistry() util.LocalRegistryOpts {
+	cwd, _ := os.Getwd()
+	return util.ResolveLocalRegistry(cwd)
+}
+
+// registryDataVolume and registryCertsVolume name the volumes of the registry
+// container name (octopilot-registry-data, octopilot-registry-certs by default).
+func registryDataVolume(name string) string  { return name + "-data" }
+func registryCertsVolume(name string) string { return name + "-certs" }
+
+// registryDockerOutput runs docker with args and returns its combined output.
+// It is a var so tests can replace it without a Docker daemon.
+var registryDockerOutput = func(ctx context.Context, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, util.ContainerCLI(), args...).CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
+// registryStatus is what `op registry status` reports about the local registry.
+type registryStatus struct {
+	State      string
+	Ports      string
+	CertExpiry time.Time
+	DiskUsage  string
+}
+
+// inspectLocalRegistry collects the container state, published port, TLS
+// certificate expiry and data size of the named registry container. Only a
+// missing container is an error; the remaining fields are best effort.
+func inspectLocalRegistry(ctx context.Context, name string) (*registryStatus, error) {
+	state, err := registryDockerOutput(ctx, "inspect", "--format", "{{.State.Status}}", name)
+	if err != nil {
+		return nil, fmt.Errorf("registry container %s not found: %s", name, state)
+	}
+	st := &registryStatus{State: state}
+	if state != "running" {
+		return st, nil
+	}
+	if ports, err := registryDockerOutput(ctx, "port", name); err == nil {
+		st.Ports = ports
+	}
+	if crt, err := registryDockerOutput(ctx, "exec", name, "cat", localRegistryCertPath); err == nil {
+		if expiry, err := parseCertExpiry([]byte(crt)); err == nil {
+			st.CertExpiry = expiry
+		}
+	}
+	if du, err := registryDockerOutput(ctx, "exec", name, "du", "-sh", localRegistryDataPath); err == nil {
+		if fields := strings.Fields(du); len(fields) > 0 {
+			st.DiskUsage = fields[0]
+		}
+	}
+	return st, nil
+}
+
+// parseCertExpiry returns the NotAfter time of the first certificate in pemData.
+func parseCertExpiry(pemData []byte) (time.Time, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return time.Time{}, fmt.Errorf("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing certificate: %w", err)
+	}
+	return cert.NotAfter, nil
+}
+
+// stopLocalRegistry removes the registry container and, with purge, its data volume.
+func stopLocalRegistry(ctx context.Context, name string, purge bool) error {
+	if out, err := registryDockerOutput(ctx, "rm", "-f", name); err != nil {
+		return fmt.Errorf("removing registry container %s: %s", name, out)
+	}
+	slog.Info("Removed registry container", "container", name)
+	if purge {
+		volume := registryDataVolume(name)
+		if out, err := registryDockerOutput(ctx, "volume", "rm", volume); err != nil {
+			return fmt.Errorf("removing volume %s: %s", volume, out)
+		}
+		slog.Info("Removed registry volume", "volume", volume)
+	}
+	return nil
+}
+
+// pruneLocalRegistry runs the registry garbage collector (deleting untagged
+// manifests and unreferenced blobs) and restarts the container so the
+// registry does not serve stale blob descriptors from its cache.
+func pruneLocalRegistry(ctx context.Context, name, configPath string, dryRun bool) error {
+	args := []string{"exec", name, "registry", "garbage-collect", "--delete-untagged"}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+	args = append(args, configPath)
+	out, err := registryDockerOutput(ctx, args...)
+	if out != "" {
+		fmt.Println(out)
+	}
+	if err != nil {
+		return fmt.Errorf("registry garbage-collect failed: %w", err)
+	}
+	if dryRun {
+		return nil
+	}
+	if out, err := registryDockerOutput(ctx, "restart", name); err != nil {
+		return fmt.Errorf("restarting registry container %s: %s", name, out)
+	}
+	return nil
+}
+
+var stopRegistryCmd = &cobra.Command{
+	Use:   "stop-registry",
+	Short: "Stop and remove the local registry container.",
+	Long: `Stop and remove the local registry container (octopilot-registry).
+
+Images are kept in the octopilot-registry-data volume; pass --purge to
+delete it as well.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		purge, _ := cmd.Flags().GetBool("purge")
+		return stopLocalRegistry(cmd.Context(), currentLocalRegistry().Name, purge)
+	},
+}
+
+var registryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "Inspect and maintain the local registry.",
+}
+
+var registryStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show local registry container state, port, cert expiry and disk usage.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := currentLocalRegistry().Name
+		st, err := inspectLocalRegistry(cmd.Context(), name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Container:  %s (%s)\n", name, st.State)
+		if st.Ports != "" {
+			fmt.Printf("Ports:      %s\n", strings.ReplaceAll(st.Ports, "\n", "\n            "))
+		}
+		if !st.CertExpiry.IsZero() {
+			days := int(time.Until(st.CertExpiry).Hours() / 24)
+			fmt.Printf("Cert:       expires %s (%d days)\n", st.CertExpiry.Format(time.DateOnly), days)
+		}
+		if st.DiskUsage != "" {
+			fmt.Printf("Disk usage: %s\n", st.DiskUsage)
+		}
+		return nil
+	},
+}
+
+var registryPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete untagged manifests and unreferenced blobs from the local registry.",
+	Long: `Run the registry garbage collector inside the local registry container,
+deleting untagged manifests and the blobs only they referenced, then
+restart the container. Use --dry-run to list what would be deleted.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		configPath, _ := cmd.Flags().GetString("registry-config")
+		return pruneLocalRegistry(cmd.Context(), currentLocalRegistry().Name, configPath, dryRun)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stopRegistryCmd)
+	stopRegistryCmd.Flags().Bool("purge", false, "Also delete the registry data volume")
+
+	rootCmd.AddCommand(registryCmd)
+	registryCmd.AddCommand(registryStatusCmd)
+	registryCmd.AddCommand(registryPruneCmd)
+	registryPruneCmd.Flags().Bool("dry-run", false, "Only print what would be deleted")
+	registryPruneCmd.Flags().String("registry-config", localRegistryConfigPath, "Registry config path inside the container")
+}
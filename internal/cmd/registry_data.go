@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// registryHelperImage runs tar against the registry data volume.
+const registryHelperImage = "busybox:stable"
+
+// volumeTarArgs returns the docker run arguments that run a tar command in a
+// throwaway container with volume at /data and the directory of file at /backup.
+func volumeTarArgs(volume, file string, tarArgs ...string) ([]string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"run", "--rm",
+		"-v", volume + ":/data",
+		"-v", filepath.Dir(abs) + ":/backup",
+		registryHelperImage, "tar"}
+	return append(args, tarArgs...), nil
+}
+
+// exportRegistryVolume writes the contents of the registry data volume to file.
+func exportRegistryVolume(ctx context.Context, name, file string) error {
+	args, err := volumeTarArgs(registryDataVolume(name), file, "-C", "/data", "-cf", "/backup/"+filepath.Base(file), ".")
+	if err != nil {
+		return err
+	}
+	if out, err := registryDockerOutput(ctx, args...); err != nil {
+		return fmt.Errorf("exporting volume %s: %s", registryDataVolume(name), out)
+	}
+	return nil
+}
+
+// importRegistryVolume extracts file into the registry data volume and
+// restarts the registry (when running) so it does not serve stale cache entries.
+func importRegistryVolume(ctx context.Context, name, file string) error {
+	args, err := volumeTarArgs(registryDataVolume(name), file, "-C", "/data", "-xf", "/backup/"+filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	if out, err := registryDockerOutput(ctx, args...); err != nil {
+		return fmt.Errorf("importing into volume %s: %s", registryDataVolume(name), out)
+	}
+	if _, err := registryDockerOutput(ctx, "inspect", name); err == nil {
+		if out, err := registryDockerOutput(ctx, "restart", name); err != nil {
+			return fmt.Errorf("restarting registry container %s: %s", name, out)
+		}
+	}
+	return nil
+}
+
+// exportRegistryRepos pulls every tag of repos from registry and writes them
+// to file as a docker-save tarball (one platform per tag).
+func exportRegistryRepos(registry string, repos []string, file string, opts ...crane.Option) error {
+	refToImage := map[name.Reference]v1.Image{}
+	for _, repo := range repos {
+		src := registry + "/" + repo
+		tags, err := crane.ListTags(src, opts...)
+		if err != nil {
+			return fmt.Errorf("listing tags of %s: %w", src, err)
+		}
+		for _, tag := range tags {
+			ref, err := name.NewTag(src+":"+tag, name.Insecure)
+			if err != nil {
+				return err
+			}
+			img, err := crane.Pull(ref.String(), opts...)
+			if err != nil {
+				return fmt.Errorf("pulling %s: %w", ref, err)
+			}
+			refToImage[ref] = img
+			slog.Info("Exporting image", util.LogKeyTag, ref)
+		}
+	}
+	if len(refToImage) == 0 {
+		return fmt.Errorf("no tags found in %s for %s", registry, strings.Join(repos, ", "))
+	}
+	return tarball.MultiRefWriteToFile(file, refToImage)
+}
+
+// importRegistryRepos pushes every tagged image in the docker-save tarball at
+// file to registry, keeping repository paths and tags but not the original
+// registry host. It returns the pushed references.
+func importRegistryRepos(registry, file string, opts ...crane.Option) ([]string, error) {
+	manifest, err := tarball.LoadManifest(fileOpener(file))
+	if err != nil {
+		return nil, err
+	}
+	var pushed []string
+	for _, desc := range manifest {
+		for _, t := range desc.RepoTags {
+			tag, err := name.NewTag(t, name.Insecure)
+			if err != nil {
+				return pushed, err
+			}
+			img, err := tarball.ImageFromPath(file, &tag)
+			if err != nil {
+				return pushed, fmt.Errorf("reading %s from %s: %w", t, file, err)
+			}
+			dst := registry + "/" + tag.RepositoryStr() + ":" + tag.TagStr()
+			if err := crane.Push(img, dst, opts...); err != nil {
+				return pushed, fmt.Errorf("pushing %s: %w", dst, err)
+			}
+			pushed = append(pushed, dst)
+		}
+	}
+	sort.Strings(pushed)
+	return pushed, nil
+}
+
+// isImageTarball reports whether file is a docker-save tarball (has manifest.json)
+// rather than a raw registry volume snapshot.
+func isImageTarball(file string) bool {
+	_, err := tarball.LoadManifest(fileOpener(file))
+	return err == nil
+}
+
+func fileOpener(file string) tarball.Opener {
+	return func() (io.ReadCloser, error) { return os.Open(file) }
+}
+
+// localRegistryCraneOptions talks to the local registry, whose certificate is self-signed.
+func localRegistryCraneOptions(ctx context.Context, platform string) ([]crane.Option, error) {
+	if platform == "" {
+		platform = "linux/" + runtime.GOARCH
+	}
+	p, err := v1.ParsePlatform(platform)
+	if err != nil {
+		return nil, err
+	}
+	return []crane.Option{crane.Insecure, crane.WithPlatform(p), crane.WithContext(ctx)}, nil
+}
+
+var registryExportCmd = &cobra.Command{
+	Use:   "export <tar>",
+	Short: "Snapshot the local registry data (or selected repositories) to a tar file.",
+	Long: `Write the local registry's data volume (octopilot-registry-data) to a tar
+file, for seeding a colleague's machine or a CI registry service container
+with pre-warmed base images. Restore it with op registry import.
+
+With --repo (repeatable), only the tags of those repositories are copied,
+as a docker-save tarball of one platform per tag (--platform, default
+linux/<host arch>), instead of the whole volume.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repos, _ := cmd.Flags().GetStringArray("repo")
+		platform, _ := cmd.Flags().GetString("platform")
+		registry := currentLocalRegistry()
+		if len(repos) == 0 {
+			if err := exportRegistryVolume(cmd.Context(), registry.Name, args[0]); err != nil {
+				return err
+			}
+		} else {
+			opts, err := localRegistryCraneOptions(cmd.Context(), platform)
+			if err != nil {
+				return err
+			}
+			if err := exportRegistryRepos(registry.Endpoint(), repos, args[0], opts...); err != nil {
+				return err
+			}
+		}
+		slog.Info("Exported registry data", "file", args[0])
+		return nil
+	},
+}
+
+var registryImportCmd = &cobra.Command{
+	Use:   "import <tar>",
+	Short: "Restore a tar file written by op registry export into the local registry.",
+	Long: `Restore a tar file written by op registry export. A volume snapshot is
+extracted into the registry data volume and the registry is restarted; a
+--repo export (docker-save tarball) is pushed to the running local registry,
+keeping repository paths and tags.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		registry := currentLocalRegistry()
+		if !isImageTarball(args[0]) {
+			if err := importRegistryVolume(cmd.Context(), registry.Name, args[0]); err != nil {
+				return err
+			}
+			slog.Info("Imported registry data", "file", args[0], "volume", registryDataVolume(registry.Name))
+			return nil
+		}
+		opts, err := localRegistryCraneOptions(cmd.Context(), "")
+		if err != nil {
+			return err
+		}
+		pushed, err := importRegistryRepos(registry.Endpoint(), args[0], opts...)
+		for _, ref := range pushed {
+			slog.Info("Imported image", util.LogKeyTag, ref)
+		}
+		return err
+	},
+}
+
+func init() {
+	registryCmd.AddCommand(registryExportCmd)
+	registryExportCmd.Flags().StringArray("repo", nil, "Only export this repository, e.g. my-app-base (repeatable)")
+	registryExportCmd.Flags().String("platform", "", "Platform to export with --repo (default linux/<host arch>)")
+
+	registryCmd.AddCommand(registryImportCmd)
+}
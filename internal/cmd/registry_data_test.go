@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startTestRegistry(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestExportRegistryVolume(t *testing.T) {
+	calls := stubRegistryDocker(t, func([]string) (string, error) { return "", nil })
+	dir := t.TempDir()
+
+	require.NoError(t, exportRegistryVolume(t.Context(), "octopilot-registry", filepath.Join(dir, "registry.tar")))
+	assert.Equal(t, "run --rm -v octopilot-registry-data:/data -v "+dir+":/backup busybox:stable tar -C /data -cf /backup/registry.tar .", (*calls)[0])
+}
+
+func TestImportRegistryVolume_RestartsRegistry(t *testing.T) {
+	calls := stubRegistryDocker(t, func([]string) (string, error) { return "", nil })
+	dir := t.TempDir()
+
+	require.NoError(t, importRegistryVolume(t.Context(), "octopilot-registry", filepath.Join(dir, "registry.tar")))
+	require.Len(t, *calls, 3)
+	assert.Contains(t, (*calls)[0], "tar -C /data -xf /backup/registry.tar")
+	assert.Equal(t, "restart octopilot-registry", (*calls)[2])
+}
+
+func TestExportImportRegistryRepos(t *testing.T) {
+	src, dst := startTestRegistry(t), startTestRegistry(t)
+	opts, err := localRegistryCraneOptions(t.Context(), "")
+	require.NoError(t, err)
+
+	img, err := random.Image(128, 1)
+	require.NoError(t, err)
+	for _, tag := range []string{"v1", "v2"} {
+		require.NoError(t, crane.Push(img, src+"/team/base:"+tag, opts...))
+	}
+
+	file := filepath.Join(t.TempDir(), "repos.tar")
+	require.NoError(t, exportRegistryRepos(src, []string{"team/base"}, file, opts...))
+	assert.True(t, isImageTarball(file))
+
+	pushed, err := importRegistryRepos(dst, file, opts...)
+	require.NoError(t, err)
+	assert.Equal(t, []string{dst + "/team/base:v1", dst + "/team/base:v2"}, pushed)
+
+	want, _ := img.Digest()
+	got, err := crane.Digest(dst+"/team/base:v2", opts...)
+	require.NoError(t, err)
+	assert.Equal(t, want.String(), got)
+}
+
+func TestExportRegistryRepos_NoTags(t *testing.T) {
+	src := startTestRegistry(t)
+	err := exportRegistryRepos(src, []string{"missing"}, filepath.Join(t.TempDir(), "x.tar"), crane.Insecure)
+	require.Error(t, err)
+}
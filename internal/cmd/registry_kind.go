@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+)
+
+// kindRegistryAlias is the registry's alias on the kind network. The
+// registry certificate has a SAN for it, so nodes can verify TLS.
+const kindRegistryAlias = "registry.local"
+
+// kindNodes lists the node containers of a kind cluster. A var so tests can replace it.
+var kindNodes = func(ctx context.Context, cluster string) ([]string, error) {
+	out, err := exec.CommandContext(ctx, "kind", "get", "nodes", "--name", cluster).Output()
+	if err != nil {
+		return nil, fmt.Errorf("kind get nodes --name %s: %w", cluster, err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// kubectlApplyContext pipes manifest to kubectl apply against kubeContext.
+// A var so tests can replace it.
+var kubectlApplyContext = func(ctx context.Context, kubeContext, manifest string) error {
+	c := exec.CommandContext(ctx, "kubectl", "--context", kubeContext, "apply", "-f", "-")
+	c.Stdin = strings.NewReader(manifest)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// kindHostsTOML is the containerd hosts.toml that sends pulls of the registry
+// endpoint to the registry container over the kind network, where it listens
+// on its in-container port whatever the host port is.
+func kindHostsTOML(caPath string) string {
+	return fmt.Sprintf("[host.\"https://%s:%d\"]\n  capabilities = [\"pull\", \"resolve\"]\n  ca = %q\n",
+		kindRegistryAlias, util.DefaultLocalRegistryPort, caPath)
+}
+
+// localRegistryHostingConfigMap documents the local registry for tools that
+// read KEP-1755 (local-registry-hosting in kube-public).
+func localRegistryHostingConfigMap(registryHostPort string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: local-registry-hosting
+  namespace: kube-public
+data:
+  localRegistryHosting.v1: |
+    host: "%s"
+    help: "https://kind.sigs.k8s.io/docs/user/local-registry/"
+`, registryHostPort)
+}
+
+// connectRegistryToKind makes images pushed to the local registry pullable in
+// a kind cluster: the registry container joins the "kind" network as
+// registry.local, every node gets a containerd certs.d entry for the
+// registry endpoint (with the registry CA) and the local-registry-hosting
+// ConfigMap is applied. Nodes must use containerd's config_path
+// (/etc/containerd/certs.d), the default for kind node images since v0.27.
+func connectRegistryToKind(ctx context.Context, cluster, caPath string, registry util.LocalRegistryOpts) error {
+	registryHostPort := registry.Endpoint()
+
+	out, err := registryDockerOutput(ctx, "network", "connect", "--alias", kindRegistryAlias, "kind", registry.Name)
+	if err != nil && !strings.Contains(out, "already exists") {
+		return fmt.Errorf("connecting %s to the kind network: %s", registry.Name, out)
+	}
+
+	nodes, err := kindNodes(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("kind cluster %q has no nodes", cluster)
+	}
+
+	tmp, err := os.MkdirTemp("", "op-kind-registry-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+	nodeDir := "/etc/containerd/certs.d/" + registryHostPort
+	hostsFile := filepath.Join(tmp, "hosts.toml")
+	if err := os.WriteFile(hostsFile, []byte(kindHostsTOML(nodeDir+"/ca.crt")), 0o644); err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		if out, err := registryDockerOutput(ctx, "exec", node, "mkdir", "-p", nodeDir); err != nil {
+			return fmt.Errorf("configuring node %s: %s", node, out)
+		}
+		if out, err := registryDockerOutput(ctx, "cp", caPath, node+":"+nodeDir+"/ca.crt"); err != nil {
+			return fmt.Errorf("copying CA to node %s: %s", node, out)
+		}
+		if out, err := registryDockerOutput(ctx, "cp", hostsFile, node+":"+nodeDir+"/hosts.toml"); err != nil {
+			return fmt.Errorf("copying hosts.toml to node %s: %s", node, out)
+		}
+		slog.Info("Configured registry on kind node", "registry", registryHostPort, "node", node)
+	}
+
+	if err := kubectlApplyContext(ctx, "kind-"+cluster, localRegistryHostingConfigMap(registryHostPort)); err != nil {
+		return fmt.Errorf("applying local-registry-hosting ConfigMap: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKindHostsTOML(t *testing.T) {
+	toml := kindHostsTOML("/etc/containerd/certs.d/localhost:5001/ca.crt")
+	assert.Contains(t, toml, `[host."https://registry.local:5001"]`)
+	assert.Contains(t, toml, `ca = "/etc/containerd/certs.d/localhost:5001/ca.crt"`)
+}
+
+func TestConnectRegistryToKind(t *testing.T) {
+	ca := filepath.Join(t.TempDir(), "tls.crt")
+	require.NoError(t, os.WriteFile(ca, []byte("ca"), 0o644))
+
+	calls := stubRegistryDocker(t, func(args []string) (string, error) { return "", nil })
+
+	oldNodes := kindNodes
+	kindNodes = func(_ context.Context, cluster string) ([]string, error) {
+		assert.Equal(t, "dev", cluster)
+		return []string{"dev-control-plane", "dev-worker"}, nil
+	}
+	defer func() { kindNodes = oldNodes }()
+
+	var appliedContext, applied string
+	oldApply := kubectlApplyContext
+	kubectlApplyContext = func(_ context.Context, kubeContext, manifest string) error {
+		appliedContext, applied = kubeContext, manifest
+		return nil
+	}
+	defer func() { kubectlApplyContext = oldApply }()
+
+	require.NoError(t, connectRegistryToKind(t.Context(), "dev", ca, testLocalRegistry))
+	assert.Equal(t, "network connect --alias registry.local kind octopilot-registry", (*calls)[0])
+	// mkdir + ca.crt + hosts.toml per node
+	assert.Len(t, *calls, 1+2*3)
+	var copied int
+	for _, c := range *calls {
+		if strings.HasPrefix(c, "cp ") && strings.Contains(c, "dev-worker:/etc/containerd/certs.d/localhost:5001/") {
+			copied++
+		}
+	}
+	assert.Equal(t, 2, copied)
+	assert.Equal(t, "kind-dev", appliedContext)
+	assert.Contains(t, applied, "local-registry-hosting")
+	assert.Contains(t, applied, `host: "localhost:5001"`)
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// rotateRegistryCerts makes the registry container generate a new certificate:
+// the certs volume is emptied and the container restarted (the image creates
+// the certificate at startup when none exists). The new certs are copied to
+// certsDir; the path of the new tls.crt is returned.
+func rotateRegistryCerts(ctx context.Context, name, certsDir string) (string, error) {
+	if state, err := registryDockerOutput(ctx, "inspect", "--format", "{{.State.Status}}", name); err != nil {
+		return "", fmt.Errorf("registry container %s not found (run op start-registry): %s", name, state)
+	}
+	if out, err := registryDockerOutput(ctx, "exec", name, "sh", "-c", "rm -rf "+localRegistryCertsPath+"/*"); err != nil {
+		return "", fmt.Errorf("removing old certs in %s: %s", name, out)
+	}
+	if out, err := registryDockerOutput(ctx, "restart", name); err != nil {
+		return "", fmt.Errorf("restarting registry container %s: %s", name, out)
+	}
+	return copyRegistryCerts(ctx, name, certsDir)
+}
+
+var registryRotateCertsCmd = &cobra.Command{
+	Use:   "rotate-certs",
+	Short: "Regenerate the local registry certificate and re-install trust.",
+	Long: `Regenerate the local registry's self-signed certificate, restart the
+registry container with it, copy it to --certs-dir and install it in the
+host trust store and the container VM's Docker daemon (as start-registry
+--trust does). Images in the data volume are kept.
+
+Kind clusters wired with start-registry --connect-kind keep the old CA;
+run start-registry --connect-kind <cluster> again after rotating.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		certsDir, _ := cmd.Flags().GetString("certs-dir")
+		vm, _ := cmd.Flags().GetString("trust-vm")
+		if certsDir == "" {
+			certsDir = filepath.Join(defaultRegistryConfigDir(), "certs")
+		}
+		registry := currentLocalRegistry()
+		crt, err := rotateRegistryCerts(cmd.Context(), registry.Name, certsDir)
+		if err != nil {
+			return err
+		}
+		if data, err := os.ReadFile(crt); err == nil {
+			if expiry, err := parseCertExpiry(data); err == nil {
+				slog.Info("Rotated registry certificate", "file", crt, "expires", expiry.Format(time.DateOnly))
+			}
+		}
+
+		updated, err := trustRegistryCert(cmd.Context(), crt, vm, registry.Port)
+		for _, store := range updated {
+			slog.Info("Trusted registry certificate", "store", store)
+		}
+		return err
+	},
+}
+
+func init() {
+	registryCmd.AddCommand(registryRotateCertsCmd)
+	registryRotateCertsCmd.Flags().String("certs-dir", "", "Directory the registry certs are copied to (default ~/.config/registry-tls/certs)")
+	registryRotateCertsCmd.Flags().String("trust-vm", "auto", "Container VM to install the certificate in: auto, colima, rancher-desktop, lima, docker-desktop or none")
+}
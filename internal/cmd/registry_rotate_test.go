@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotateRegistryCerts(t *testing.T) {
+	certsDir := filepath.Join(t.TempDir(), "certs")
+	calls := stubRegistryDocker(t, func([]string) (string, error) { return "", nil })
+
+	crt, err := rotateRegistryCerts(t.Context(), testLocalRegistry.Name, certsDir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(certsDir, "tls.crt"), crt)
+	assert.Equal(t, []string{
+		"inspect --format {{.State.Status}} octopilot-registry",
+		"exec octopilot-registry sh -c rm -rf /etc/envoy/certs/*",
+		"restart octopilot-registry",
+		"exec octopilot-registry test -f /etc/envoy/certs/tls.crt",
+		"cp octopilot-registry:/etc/envoy/certs/. " + certsDir,
+	}, *calls)
+}
+
+func TestRotateRegistryCerts_NotRunning(t *testing.T) {
+	calls := stubRegistryDocker(t, func([]string) (string, error) {
+		return "No such object: octopilot-registry", errors.New("exit status 1")
+	})
+
+	_, err := rotateRegistryCerts(t.Context(), testLocalRegistry.Name, t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "op start-registry")
+	assert.Len(t, *calls, 1)
+}
@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// registryCertWaitInterval is the time between checks for the generated
+// certificate after the registry container starts. Reduced in tests.
+var registryCertWaitInterval = 500 * time.Millisecond
+
+// dockerLogin logs the Docker CLI in to registry, passing the password on stdin.
+// It is a var so tests can replace it.
+var dockerLogin = func(ctx context.Context, registry, user, password string) error {
+	c := exec.CommandContext(ctx, util.ContainerCLI(), "login", registry, "--username", user, "--password-stdin")
+	c.Stdin = strings.NewReader(password)
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// registryStartOptions configures `op start-registry`.
+type registryStartOptions struct {
+	// Registry is the container name and host port (see util.ResolveLocalRegistry).
+	Registry util.LocalRegistryOpts
+	Image    string
+	CertsDir string
+	// Auth is "user:password"; when set the registry requires htpasswd auth.
+	Auth string
+}
+
+// defaultRegistryConfigDir is where start-registry keeps the copied certs and
+// the generated htpasswd file.
+func defaultRegistryConfigDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "registry-tls")
+}
+
+// splitRegistryAuth parses a --auth value of the form user:password.
+func splitRegistryAuth(auth string) (string, string, error) {
+	user, password, ok := strings.Cut(auth, ":")
+	if !ok || user == "" || password == "" {
+		return "", "", fmt.Errorf("invalid --auth %q (expected user:password)", auth)
+	}
+	return user, password, nil
+}
+
+// writeHtpasswd writes a bcrypt htpasswd file for user/password (the only
+// hash format the registry's htpasswd backend accepts).
+func writeHtpasswd(path, user, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hashing registry password: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(fmt.Sprintf("%s:%s\n", user, hash)), 0o600)
+}
+
+// registryRunArgs returns the docker run arguments for the registry container.
+// Only the TLS port is published; certs and data live in named volumes so
+// they survive restarts. authDir, when set, holds the htpasswd file.
+// The registry listens on 5001 inside the container; the host port is configurable.
+func registryRunArgs(opts registryStartOptions, authDir string) []string {
+	name := opts.Registry.Name
+	args := []string{"run", "-d",
+		"--name", name,
+		"--restart", "unless-stopped",
+		"-p", fmt.Sprintf("%d:%d", opts.Registry.Port, util.DefaultLocalRegistryPort),
+		"-v", registryDataVolume(name) + ":" + localRegistryDataPath,
+		"-v", registryCertsVolume(name) + ":" + localRegistryCertsPath,
+	}
+	if authDir != "" {
+		args = append(args,
+			"-v", authDir+":"+localRegistryAuthPath+":ro",
+			"-e", "REGISTRY_AUTH=htpasswd",
+			"-e", "REGISTRY_AUTH_HTPASSWD_REALM=octopilot-registry",
+			"-e", "REGISTRY_AUTH_HTPASSWD_PATH="+localRegistryAuthPath+"/htpasswd",
+		)
+	}
+	return append(args, opts.Image)
+}
+
+// startLocalRegistry replaces any existing registry container, waits for the
+// TLS certificate it generates, copies the certs to opts.CertsDir and, with
+// auth, logs the Docker CLI in. It returns the path of the copied tls.crt.
+func startLocalRegistry(ctx context.Context, opts registryStartOptions) (string, error) {
+	var authDir, user, password string
+	if opts.Auth != "" {
+		var err error
+		if user, password, err = splitRegistryAuth(opts.Auth); err != nil {
+			return "", err
+		}
+		authDir = filepath.Join(filepath.Dir(opts.CertsDir), "auth")
+		if err := writeHtpasswd(filepath.Join(authDir, "htpasswd"), user, password); err != nil {
+			return "", err
+		}
+	}
+
+	name := opts.Registry.Name
+	_, _ = registryDockerOutput(ctx, "rm", "-f", name)
+	if out, err := registryDockerOutput(ctx, registryRunArgs(opts, authDir)...); err != nil {
+		return "", fmt.Errorf("starting registry container: %s", out)
+	}
+
+	crt, err := copyRegistryCerts(ctx, name, opts.CertsDir)
+	if err != nil {
+		return "", err
+	}
+
+	if user != "" {
+		registry := opts.Registry.Endpoint()
+		if err := dockerLogin(ctx, registry, user, password); err != nil {
+			slog.Warn("docker login failed (is the registry CA trusted by the daemon?)", "registry", registry, "ca", crt, "error", err)
+		}
+	}
+	return crt, nil
+}
+
+// copyRegistryCerts waits for the registry container to generate its TLS
+// certificate, copies the certs to certsDir and returns the path of tls.crt.
+func copyRegistryCerts(ctx context.Context, name, certsDir string) (string, error) {
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		if _, err := registryDockerOutput(ctx, "exec", name, "test", "-f", localRegistryCertPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("timed out waiting for %s in %s", localRegistryCertPath, name)
+		}
+		time.Sleep(registryCertWaitInterval)
+	}
+
+	if err := os.MkdirAll(certsDir, 0o755); err != nil {
+		return "", err
+	}
+	if out, err := registryDockerOutput(ctx, "cp", name+":"+localRegistryCertsPath+"/.", certsDir); err != nil {
+		return "", fmt.Errorf("copying certs from %s: %s", name, out)
+	}
+	return filepath.Join(certsDir, "tls.crt"), nil
+}
+
+// trustRegistryCert installs crt in the host trust store and in the Docker
+// daemon of the container VM (vm, or the detected one for "auto") for the
+// registry's port, returning the trust stores that were updated.
+func trustRegistryCert(ctx context.Context, crt, vm string, port int) ([]string, error) {
+	var updated []string
+	store, err := util.InstallHostTrust(ctx, crt)
+	if err != nil {
+		return nil, fmt.Errorf("installing host trust for %s: %w", crt, err)
+	}
+	if store != "" {
+		updated = append(updated, store)
+	}
+
+	instance := os.Getenv("LIMA_INSTANCE")
+	if vm == "" || vm == "auto" {
+		var detected string
+		vm, detected = util.DetectContainerVM()
+		if instance == "" {
+			instance = detected
+		}
+	}
+	vmStores, err := util.InstallVMTrust(ctx, vm, instance, crt, util.RegistryTrustHostPorts(port))
+	if err != nil {
+		return updated, err
+	}
+	return append(updated, vmStores...), nil
+}
+
+var startRegistryCmd = &cobra.Command{
+	Use:   "start-registry",
+	Short: "Start the local TLS registry container.",
+	Long: `Start (or replace) the local TLS registry container (octopilot-registry)
+on port 5001 and copy its self-signed certificate to --certs-dir. The
+container name and port follow --registry-name/--registry-port,
+OP_REGISTRY_NAME/OP_REGISTRY_PORT or local_registry in octopilot.yaml.
+
+With --auth user:password, the registry requires htpasswd authentication
+(REGISTRY_AUTH=htpasswd) and op runs docker login for localhost:5001, so
+local builds exercise the same credential paths as CI registries.
+
+With --trust, the certificate is added to the host trust store (macOS
+System keychain, the Linux CA bundle or the Windows Root store; may
+prompt for sudo or elevation) and to the
+Docker daemon of the container VM: Colima, Rancher Desktop, Lima (instance
+from the Docker endpoint or LIMA_INSTANCE) or Docker Desktop
+(~/.docker/certs.d). The VM is detected from the Docker endpoint unless
+--trust-vm is set.
+
+With --connect-kind <cluster>, the registry joins the kind network as
+registry.local, each node's containerd gets a certs.d entry for
+localhost:5001 with the registry CA, and the local-registry-hosting
+ConfigMap is applied, so images pushed to localhost:5001 can be pulled in
+the cluster as localhost:5001/<image>.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := ensureContainerDaemon(cmd); err != nil {
+			return err
+		}
+		opts := registryStartOptions{Registry: currentLocalRegistry()}
+		opts.Image, _ = cmd.Flags().GetString("image")
+		opts.CertsDir, _ = cmd.Flags().GetString("certs-dir")
+		opts.Auth, _ = cmd.Flags().GetString("auth")
+		if opts.CertsDir == "" {
+			opts.CertsDir = filepath.Join(defaultRegistryConfigDir(), "certs")
+		}
+		crt, err := startLocalRegistry(cmd.Context(), opts)
+		if err != nil {
+			return err
+		}
+		slog.Info("Registry running", "registry", opts.Registry.Endpoint(), "ca", crt)
+
+		if trust, _ := cmd.Flags().GetBool("trust"); trust {
+			vm, _ := cmd.Flags().GetString("trust-vm")
+			updated, err := trustRegistryCert(cmd.Context(), crt, vm, opts.Registry.Port)
+			for _, store := range updated {
+				slog.Info("Trusted registry certificate", "store", store)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if cluster, _ := cmd.Flags().GetString("connect-kind"); cluster != "" {
+			if err := connectRegistryToKind(cmd.Context(), cluster, crt, opts.Registry); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(startRegistryCmd)
+	startRegistryCmd.Flags().String("image", localRegistryImage, "Registry image")
+	startRegistryCmd.Flags().String("certs-dir", "", "Directory the registry certs are copied to (default ~/.config/registry-tls/certs)")
+	startRegistryCmd.Flags().Bool("trust", false, "Trust the registry certificate on the host and in the container VM")
+	startRegistryCmd.Flags().String("trust-vm", "auto", "Container VM to install the certificate in: auto, colima, rancher-desktop, lima, docker-desktop or none")
+	startRegistryCmd.Flags().String("connect-kind", "", "Wire the registry into this kind cluster (network, containerd config, ConfigMap)")
+	startRegistryCmd.Flags().String("auth", "", "Require htpasswd authentication with user:password and docker login locally")
+}
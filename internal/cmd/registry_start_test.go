@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSplitRegistryAuth(t *testing.T) {
+	user, password, err := splitRegistryAuth("dev:s3cr:et")
+	require.NoError(t, err)
+	assert.Equal(t, "dev", user)
+	assert.Equal(t, "s3cr:et", password)
+
+	_, _, err = splitRegistryAuth("dev")
+	require.Error(t, err)
+}
+
+func TestWriteHtpasswd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth", "htpasswd")
+	require.NoError(t, writeHtpasswd(path, "dev", "secret"))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	user, hash, ok := strings.Cut(strings.TrimSpace(string(data)), ":")
+	require.True(t, ok)
+	assert.Equal(t, "dev", user)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("secret")))
+}
+
+func TestStartLocalRegistry_Auth(t *testing.T) {
+	certsDir := filepath.Join(t.TempDir(), "certs")
+	calls := stubRegistryDocker(t, func([]string) (string, error) { return "", nil })
+
+	var loggedIn string
+	oldLogin := dockerLogin
+	dockerLogin = func(_ context.Context, registry, user, password string) error {
+		loggedIn = registry + " " + user + " " + password
+		return nil
+	}
+	defer func() { dockerLogin = oldLogin }()
+
+	crt, err := startLocalRegistry(t.Context(), registryStartOptions{Registry: testLocalRegistry, Image: localRegistryImage, CertsDir: certsDir, Auth: "dev:secret"})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(certsDir, "tls.crt"), crt)
+	assert.Equal(t, "localhost:5001 dev secret", loggedIn)
+	assert.FileExists(t, filepath.Join(filepath.Dir(certsDir), "auth", "htpasswd"))
+
+	run := (*calls)[1]
+	assert.Contains(t, run, "-e REGISTRY_AUTH=htpasswd")
+	assert.NotContains(t, run, "secret")
+}
+
+func TestRegistryRunArgs_NoAuth(t *testing.T) {
+	args := registryRunArgs(registryStartOptions{Registry: testLocalRegistry, Image: localRegistryImage}, "")
+	assert.Equal(t, localRegistryImage, args[len(args)-1])
+	assert.NotContains(t, strings.Join(args, " "), "REGISTRY_AUTH")
+}
+
+func TestRegistryRunArgs_CustomRegistry(t *testing.T) {
+	reg := util.LocalRegistryOpts{Host: "localhost", Port: 5002, Name: "op-registry-2"}
+	joined := strings.Join(registryRunArgs(registryStartOptions{Registry: reg, Image: localRegistryImage}, ""), " ")
+	assert.Contains(t, joined, "--name op-registry-2")
+	assert.Contains(t, joined, "-p 5002:5001")
+	assert.Contains(t, joined, "-v op-registry-2-data:/var/lib/registry")
+	assert.Contains(t, joined, "-v op-registry-2-certs:/etc/envoy/certs")
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLocalRegistry is the default local registry.
+var testLocalRegistry = util.LocalRegistryOpts{Host: "localhost", Port: 5001, Name: "octopilot-registry"}
+
+func testCertPEM(t *testing.T, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    notAfter.Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// stubRegistryDocker replaces registryDockerOutput with fn and records calls.
+func stubRegistryDocker(t *testing.T, fn func(args []string) (string, error)) *[]string {
+	t.Helper()
+	var calls []string
+	old := registryDockerOutput
+	registryDockerOutput = func(_ context.Context, args ...string) (string, error) {
+		calls = append(calls, strings.Join(args, " "))
+		return fn(args)
+	}
+	t.Cleanup(func() { registryDockerOutput = old })
+	return &calls
+}
+
+func TestParseCertExpiry(t *testing.T) {
+	notAfter := time.Date(2035, 1, 2, 0, 0, 0, 0, time.UTC)
+	expiry, err := parseCertExpiry(testCertPEM(t, notAfter))
+	require.NoError(t, err)
+	assert.True(t, expiry.Equal(notAfter))
+
+	_, err = parseCertExpiry([]byte("not a cert"))
+	require.Error(t, err)
+}
+
+func TestInspectLocalRegistry(t *testing.T) {
+	notAfter := time.Date(2035, 1, 2, 0, 0, 0, 0, time.UTC)
+	certPEM := string(testCertPEM(t, notAfter))
+	stubRegistryDocker(t, func(args []string) (string, error) {
+		switch {
+		case args[0] == "inspect":
+			return "running", nil
+		case args[0] == "port":
+			return "5001/tcp -> 0.0.0.0:5001", nil
+		case args[0] == "exec" && args[2] == "cat":
+			return certPEM, nil
+		case args[0] == "exec" && args[2] == "du":
+			return "42.0M\t/var/lib/registry", nil
+		}
+		return "", errors.New("unexpected")
+	})
+
+	st, err := inspectLocalRegistry(t.Context(), testLocalRegistry.Name)
+	require.NoError(t, err)
+	assert.Equal(t, "running", st.State)
+	assert.Equal(t, "5001/tcp -> 0.0.0.0:5001", st.Ports)
+	assert.True(t, st.CertExpiry.Equal(notAfter))
+	assert.Equal(t, "42.0M", st.DiskUsage)
+}
+
+func TestInspectLocalRegistry_NotFound(t *testing.T) {
+	stubRegistryDocker(t, func([]string) (string, error) {
+		return "Error: No such object: octopilot-registry", errors.New("exit status 1")
+	})
+	_, err := inspectLocalRegistry(t.Context(), testLocalRegistry.Name)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+}
+
+func TestPruneLocalRegistry(t *testing.T) {
+	calls := stubRegistryDocker(t, func([]string) (string, error) { return "", nil })
+
+	require.NoError(t, pruneLocalRegistry(t.Context(), "octopilot-registry", localRegistryConfigPath, true))
+	assert.Equal(t, []string{
+		"exec octopilot-registry registry garbage-collect --delete-untagged --dry-run /etc/docker/registry/config.yml",
+	}, *calls)
+
+	*calls = nil
+	require.NoError(t, pruneLocalRegistry(t.Context(), "octopilot-registry", localRegistryConfigPath, false))
+	assert.Equal(t, "restart octopilot-registry", (*calls)[len(*calls)-1])
+}
+
+func TestStopLocalRegistry_Purge(t *testing.T) {
+	calls := stubRegistryDocker(t, func([]string) (string, error) { return "", nil })
+
+	require.NoError(t, stopLocalRegistry(t.Context(), "octopilot-registry", true))
+	assert.Equal(t, []string{"rm -f octopilot-registry", "volume rm octopilot-registry-data"}, *calls)
+}
@@ -0,0 +1,450 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// semVersion is a MAJOR.MINOR.PATCH version; pre-release and build metadata
+// of existing tags are dropped.
+type semVersion struct {
+	Major, Minor, Patch int
+}
+
+func (v semVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// less reports whether v is an older version than o.
+func (v semVersion) less(o semVersion) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	return v.Patch < o.Patch
+}
+
+var semVersionPattern = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)([-+].*)?$`)
+
+// parseSemVersion parses 1.2.3 (after the tag prefix has been removed).
+func parseSemVersion(s string) (semVersion, error) {
+	m := semVersionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return semVersion{}, fmt.Errorf("invalid version %q (expected MAJOR.MINOR.PATCH)", s)
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	patch, _ := strconv.Atoi(m[3])
+	return semVersion{major, minor, patch}, nil
+}
+
+// conventionalCommit is a commit message parsed as type(scope)!: subject.
+type conventionalCommit struct {
+	Hash     string
+	Type     string
+	Scope    string
+	Subject  string
+	Breaking bool
+}
+
+var conventionalSubjectPattern = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?:\s*(.+)$`)
+
+// parseConventionalCommit parses subject and body; commits that do not follow
+// the convention get an empty Type.
+func parseConventionalCommit(hash, subject, body string) conventionalCommit {
+	c := conventionalCommit{Hash: hash, Subject: subject}
+	if m := conventionalSubjectPattern.FindStringSubmatch(subject); m != nil {
+		c.Type, c.Scope, c.Breaking, c.Subject = strings.ToLower(m[1]), m[2], m[3] == "!", m[4]
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "BREAKING CHANGE:") || strings.HasPrefix(line, "BREAKING-CHANGE:") {
+			c.Breaking = true
+		}
+	}
+	return c
+}
+
+// releaseBump is the version component to increase.
+type releaseBump int
+
+const (
+	bumpNone releaseBump = iota
+	bumpPatch
+	bumpMinor
+	bumpMajor
+)
+
+// commitsBump returns the bump required by commits: major for breaking
+// changes, minor for feat, patch for fix and perf.
+func commitsBump(commits []conventionalCommit) releaseBump {
+	bump := bumpNone
+	for _, c := range commits {
+		b := bumpNone
+		switch {
+		case c.Breaking:
+			b = bumpMajor
+		case c.Type == "feat":
+			b = bumpMinor
+		case c.Type == "fix" || c.Type == "perf":
+			b = bumpPatch
+		}
+		if b > bump {
+			bump = b
+		}
+	}
+	return bump
+}
+
+// nextVersion applies bump to v. Before 1.0.0 breaking changes bump the
+// minor version and features the patch version.
+func nextVersion(v semVersion, bump releaseBump) semVersion {
+	if v.Major == 0 && bump > bumpPatch {
+		bump--
+	}
+	switch bump {
+	case bumpMajor:
+		return semVersion{v.Major + 1, 0, 0}
+	case bumpMinor:
+		return semVersion{v.Major, v.Minor + 1, 0}
+	case bumpPatch:
+		return semVersion{v.Major, v.Minor, v.Patch + 1}
+	}
+	return v
+}
+
+// changelogSections are the changelog headings, in order.
+var changelogSections = []struct {
+	Title string
+	Match func(conventionalCommit) bool
+}{
+	{"Breaking Changes", func(c conventionalCommit) bool { return c.Breaking }},
+	{"Features", func(c conventionalCommit) bool { return c.Type == "feat" }},
+	{"Bug Fixes", func(c conventionalCommit) bool { return c.Type == "fix" }},
+	{"Performance", func(c conventionalCommit) bool { return c.Type == "perf" }},
+}
+
+// releaseChangelog renders the Markdown changelog of tag. Commits other than
+// breaking changes, features, fixes and performance improvements are omitted.
+func releaseChangelog(tag string, date time.Time, commits []conventionalCommit) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s (%s)\n", tag, date.Format("2006-01-02"))
+	for _, section := range changelogSections {
+		var lines []string
+		for _, c := range commits {
+			if !section.Match(c) {
+				continue
+			}
+			line := "- "
+			if c.Scope != "" {
+				line += "**" + c.Scope + ":** "
+			}
+			line += c.Subject
+			if len(c.Hash) >= 7 {
+				line += " (" + c.Hash[:7] + ")"
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) > 0 {
+			fmt.Fprintf(&b, "\n### %s\n\n%s\n", section.Title, strings.Join(lines, "\n"))
+		}
+	}
+	return b.String()
+}
+
+// latestReleaseTag returns the newest tag reachable from HEAD matching
+// prefix, or "" when there is none.
+func latestReleaseTag(ctx context.Context, prefix string) (string, error) {
+	out, err := gitRun(ctx, "", "describe", "--tags", "--abbrev=0", "--match", prefix+"[0-9]*")
+	if err != nil {
+		if strings.Contains(out, "No names found") || strings.Contains(out, "No tags can describe") {
+			return "", nil
+		}
+		return "", fmt.Errorf("git describe: %s", strings.TrimSpace(out))
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// commitsSince returns the commits after tag (all commits when tag is "").
+func commitsSince(ctx context.Context, tag string) ([]conventionalCommit, error) {
+	rev := "HEAD"
+	if tag != "" {
+		rev = tag + "..HEAD"
+	}
+	out, err := gitRun(ctx, "", "log", "--no-merges", "--format=%H%x1f%s%x1f%b%x1e", rev)
+	if err != nil {
+		return nil, fmt.Errorf("git log: %s", strings.TrimSpace(out))
+	}
+	var commits []conventionalCommit
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimLeft(record, "\n"), "\x1f")
+		if len(fields) != 3 {
+			continue
+		}
+		commits = append(commits, parseConventionalCommit(fields[0], fields[1], fields[2]))
+	}
+	return commits, nil
+}
+
+// runSelf runs this op binary with args and extra environment variables.
+func runSelf(ctx context.Context, env []string, args ...string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	c := exec.CommandContext(ctx, self, args...)
+	c.Env = append(os.Environ(), env...)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// releaseBuild runs `op build --push` with VERSION set to version, so the
+// images are tagged with the release. It is a var so tests can replace it.
+var releaseBuild = func(ctx context.Context, version string, args []string) error {
+	return runSelf(ctx, []string{"VERSION=" + version}, append([]string{"build", "--push"}, args...)...)
+}
+
+// releaseChecksums returns sha256sum-style lines for files.
+func releaseChecksums(files []string) (string, error) {
+	var b strings.Builder
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(&b, "%s  %s\n", hex.EncodeToString(sum[:]), filepath.Base(f))
+	}
+	return b.String(), nil
+}
+
+// githubRequest sends a GitHub API request (unauthenticated when token is
+// empty) and decodes the JSON response into out, failing unless the status
+// is want.
+func githubRequest(method, rawURL, contentType string, body io.Reader, token string, want int, out any) error {
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != want {
+		var e struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &e)
+		return fmt.Errorf("%s %s: %s %s", method, rawURL, resp.Status, e.Message)
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// createGitHubRelease creates the release for tag and uploads assets,
+// returning the release URL.
+func createGitHubRelease(slug, tag, notes string, prerelease bool, assets map[string][]byte, token string) (string, error) {
+	payload, err := json.Marshal(map[string]any{"tag_name": tag, "name": tag, "body": notes, "prerelease": prerelease})
+	if err != nil {
+		return "", err
+	}
+	var release struct {
+		HTMLURL   string `json:"html_url"`
+		UploadURL string `json:"upload_url"`
+	}
+	if err := githubRequest(http.MethodPost, githubAPIURL()+"/repos/"+slug+"/releases", "application/json", bytes.NewReader(payload), token, http.StatusCreated, &release); err != nil {
+		return "", fmt.Errorf("creating release: %w", err)
+	}
+	// upload_url is a URI template: .../assets{?name,label}
+	uploadURL, _, _ := strings.Cut(release.UploadURL, "{")
+	for assetName, data := range assets {
+		u := uploadURL + "?name=" + url.QueryEscape(assetName)
+		if err := githubRequest(http.MethodPost, u, "application/octet-stream", bytes.NewReader(data), token, http.StatusCreated, nil); err != nil {
+			return "", fmt.Errorf("uploading %s: %w", assetName, err)
+		}
+	}
+	return release.HTMLURL, nil
+}
+
+// currentGitHubRepo returns owner/name from GITHUB_REPOSITORY or the origin remote.
+func currentGitHubRepo(ctx context.Context) (string, error) {
+	if s := os.Getenv("GITHUB_REPOSITORY"); s != "" {
+		return s, nil
+	}
+	out, err := gitRun(ctx, "", "remote", "get-url", "origin")
+	if err != nil {
+		return "", fmt.Errorf("git remote get-url origin: %s", strings.TrimSpace(out))
+	}
+	return githubRepoSlug(strings.TrimSpace(out))
+}
+
+var releaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "Tag, build and publish a release versioned from conventional commits.",
+	Long: `Compute the next semantic version from the conventional commits since the
+last release tag (BREAKING CHANGE or "!" -> major, feat -> minor, fix/perf ->
+patch; before 1.0.0 one level lower), create an annotated git tag, run
+'op build --push' with VERSION set to the tag, push the tag, and create a
+GitHub release with the changelog as notes and build_result.json and
+checksums.txt attached.
+
+Requires GITHUB_TOKEN (or GH_TOKEN, or a GitHub App: GITHUB_APP_ID and
+GITHUB_APP_PRIVATE_KEY) for the release; the repository is taken from
+GITHUB_REPOSITORY or the origin remote. Use --dry-run to print the next
+version and changelog only.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prefix, _ := cmd.Flags().GetString("tag-prefix")
+		versionFlag, _ := cmd.Flags().GetString("version")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		skipBuild, _ := cmd.Flags().GetBool("skip-build")
+		skipGitHub, _ := cmd.Flags().GetBool("no-github-release")
+		prerelease, _ := cmd.Flags().GetBool("prerelease")
+		changelogFile, _ := cmd.Flags().GetString("changelog-file")
+		extraAssets, _ := cmd.Flags().GetStringArray("asset")
+		ctx := cmd.Context()
+
+		last, err := latestReleaseTag(ctx, prefix)
+		if err != nil {
+			return err
+		}
+		commits, err := commitsSince(ctx, last)
+		if err != nil {
+			return err
+		}
+		var version semVersion
+		if versionFlag != "" {
+			if version, err = parseSemVersion(strings.TrimPrefix(versionFlag, prefix)); err != nil {
+				return err
+			}
+		} else {
+			current := semVersion{}
+			if last != "" {
+				if current, err = parseSemVersion(strings.TrimPrefix(last, prefix)); err != nil {
+					return fmt.Errorf("last tag %s: %w", last, err)
+				}
+			}
+			bump := commitsBump(commits)
+			if bump == bumpNone {
+				slog.Info("No releasable commits", "since", firstNonEmpty(last, "the first commit"))
+				return nil
+			}
+			version = nextVersion(current, bump)
+		}
+		tag := prefix + version.String()
+		notes := releaseChangelog(tag, time.Now(), commits)
+		slog.Info("Releasing", "version", tag, "previous", firstNonEmpty(last, "none"))
+		fmt.Println(notes)
+		if changelogFile != "" {
+			if err := os.WriteFile(changelogFile, []byte(notes), 0o644); err != nil {
+				return err
+			}
+		}
+		if dryRun {
+			return nil
+		}
+
+		if out, err := gitRun(ctx, "", "tag", "-a", tag, "-m", "Release "+tag); err != nil {
+			return fmt.Errorf("git tag: %s", strings.TrimSpace(out))
+		}
+		if !skipBuild {
+			var buildArgs []string
+			for _, f := range []string{"repo", "platform", "insecure-registry"} {
+				if v, _ := cmd.Flags().GetString(f); v != "" {
+					buildArgs = append(buildArgs, "--"+f, v)
+				}
+			}
+			if err := releaseBuild(ctx, tag, buildArgs); err != nil {
+				// Remove the tag even when the build was interrupted.
+				_, _ = gitRun(context.WithoutCancel(ctx), "", "tag", "-d", tag)
+				return fmt.Errorf("build failed, tag %s removed: %w", tag, err)
+			}
+		}
+		if out, err := gitRun(ctx, "", "push", "origin", "refs/tags/"+tag); err != nil {
+			return fmt.Errorf("git push %s: %s", tag, strings.TrimSpace(out))
+		}
+		slog.Info("Pushed tag", "version", tag)
+		if skipGitHub {
+			return nil
+		}
+
+		token := githubToken()
+		if token == "" {
+			return fmt.Errorf("set GITHUB_TOKEN or GITHUB_APP_ID to create the GitHub release (or use --no-github-release)")
+		}
+		slug, err := currentGitHubRepo(ctx)
+		if err != nil {
+			return err
+		}
+		files := extraAssets
+		if !skipBuild {
+			files = append([]string{util.BuildResultFilename}, files...)
+		}
+		assets := map[string][]byte{}
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				return err
+			}
+			assets[filepath.Base(f)] = data
+		}
+		if len(files) > 0 {
+			sums, err := releaseChecksums(files)
+			if err != nil {
+				return err
+			}
+			assets["checksums.txt"] = []byte(sums)
+		}
+		releaseURL, err := createGitHubRelease(slug, tag, notes, prerelease, assets, token)
+		if err != nil {
+			return err
+		}
+		slog.Info("Created release", "url", releaseURL)
+		fmt.Println(releaseURL)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(releaseCmd)
+	releaseCmd.Flags().String("tag-prefix", "v", "Prefix of release tags")
+	releaseCmd.Flags().String("version", "", "Release this version instead of computing it from commits (e.g. 1.4.0)")
+	releaseCmd.Flags().Bool("dry-run", false, "Print the next version and changelog without tagging, building or publishing")
+	releaseCmd.Flags().Bool("skip-build", false, "Tag and publish without running op build --push")
+	releaseCmd.Flags().Bool("no-github-release", false, "Push the tag but do not create a GitHub release")
+	releaseCmd.Flags().Bool("prerelease", false, "Mark the GitHub release as a pre-release")
+	releaseCmd.Flags().String("changelog-file", "", "Also write the changelog to this file")
+	releaseCmd.Flags().StringArray("asset", nil, "Additional file to attach to the release (repeatable)")
+	releaseCmd.Flags().String("repo", "", "Registry to push to (passed to op build)")
+	releaseCmd.Flags().String("platform", "", "Target platforms (passed to op build, e.g. linux/amd64,linux/arm64)")
+	releaseCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated (e.g. localhost:5001,myreg:5000). Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+}
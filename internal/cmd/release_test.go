@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSemVersion(t *testing.T) {
+	v, err := parseSemVersion("1.2.3-rc.1+build")
+	require.NoError(t, err)
+	assert.Equal(t, semVersion{1, 2, 3}, v)
+	assert.Equal(t, "1.2.3", v.String())
+	_, err = parseSemVersion("1.2")
+	assert.Error(t, err)
+}
+
+func TestParseConventionalCommit(t *testing.T) {
+	assert.Equal(t, conventionalCommit{Hash: "h", Type: "feat", Scope: "cli", Subject: "add release"},
+		parseConventionalCommit("h", "feat(cli): add release", ""))
+	assert.Equal(t, conventionalCommit{Hash: "h", Type: "fix", Subject: "drop flag", Breaking: true},
+		parseConventionalCommit("h", "fix!: drop flag", ""))
+	assert.True(t, parseConventionalCommit("h", "refactor: x", "details\n\nBREAKING CHANGE: removed y").Breaking)
+	assert.Equal(t, conventionalCommit{Hash: "h", Subject: "Merge stuff"}, parseConventionalCommit("h", "Merge stuff", ""))
+}
+
+func TestNextVersion(t *testing.T) {
+	feat := conventionalCommit{Type: "feat"}
+	fix := conventionalCommit{Type: "fix"}
+	breaking := conventionalCommit{Type: "chore", Breaking: true}
+	docs := conventionalCommit{Type: "docs"}
+
+	assert.Equal(t, bumpNone, commitsBump([]conventionalCommit{docs}))
+	assert.Equal(t, bumpPatch, commitsBump([]conventionalCommit{docs, fix}))
+	assert.Equal(t, bumpMinor, commitsBump([]conventionalCommit{fix, feat}))
+	assert.Equal(t, bumpMajor, commitsBump([]conventionalCommit{feat, breaking}))
+
+	assert.Equal(t, semVersion{2, 0, 0}, nextVersion(semVersion{1, 4, 2}, bumpMajor))
+	assert.Equal(t, semVersion{1, 5, 0}, nextVersion(semVersion{1, 4, 2}, bumpMinor))
+	assert.Equal(t, semVersion{1, 4, 3}, nextVersion(semVersion{1, 4, 2}, bumpPatch))
+	assert.Equal(t, semVersion{0, 4, 0}, nextVersion(semVersion{0, 3, 1}, bumpMajor))
+	assert.Equal(t, semVersion{0, 3, 2}, nextVersion(semVersion{0, 3, 1}, bumpMinor))
+}
+
+func TestReleaseChangelog(t *testing.T) {
+	commits := []conventionalCommit{
+		{Hash: "aaaaaaaaaa", Type: "feat", Scope: "build", Subject: "add arm64"},
+		{Hash: "bbbbbbbbbb", Type: "fix", Subject: "retry push"},
+		{Hash: "cccccccccc", Type: "chore", Subject: "bump deps"},
+		{Hash: "dddddddddd", Type: "feat", Subject: "drop v1 config", Breaking: true},
+	}
+	assert.Equal(t, `## v1.0.0 (2026-03-01)
+
+### Breaking Changes
+
+- drop v1 config (ddddddd)
+
+### Features
+
+- **build:** add arm64 (aaaaaaa)
+- drop v1 config (ddddddd)
+
+### Bug Fixes
+
+- retry push (bbbbbbb)
+`, releaseChangelog("v1.0.0", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), commits))
+}
+
+func TestLatestReleaseTagAndCommitsSince(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	cwd, _ := os.Getwd()
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+	git := func(args ...string) {
+		out, err := gitRun(t.Context(), "", append([]string{"-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+		require.NoError(t, err, out)
+	}
+	git("init", "-q")
+
+	git("commit", "-q", "--allow-empty", "-m", "feat: first")
+	tag, err := latestReleaseTag(t.Context(), "v")
+	require.NoError(t, err)
+	assert.Empty(t, tag)
+
+	git("tag", "-a", "v0.1.0", "-m", "Release v0.1.0")
+	git("commit", "-q", "--allow-empty", "-m", "fix(api): handle nil\n\nBREAKING CHANGE: nil is an error")
+	git("commit", "-q", "--allow-empty", "-m", "docs: readme")
+	tag, err = latestReleaseTag(t.Context(), "v")
+	require.NoError(t, err)
+	assert.Equal(t, "v0.1.0", tag)
+
+	commits, err := commitsSince(t.Context(), tag)
+	require.NoError(t, err)
+	require.Len(t, commits, 2)
+	assert.Equal(t, "docs", commits[0].Type)
+	assert.Equal(t, "api", commits[1].Scope)
+	assert.True(t, commits[1].Breaking)
+	assert.Len(t, commits[1].Hash, 40)
+}
+
+func TestReleaseChecksums(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "build_result.json")
+	require.NoError(t, os.WriteFile(f, []byte("hello"), 0o644))
+	sums, err := releaseChecksums([]string{f})
+	require.NoError(t, err)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  build_result.json\n", sums)
+}
+
+func TestCreateGitHubRelease(t *testing.T) {
+	uploads := map[string]string{}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer tok", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/repos/org/app/releases":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"html_url":"https://github.com/org/app/releases/tag/v1.0.0","upload_url":"` + srv.URL + `/uploads/1/assets{?name,label}"}`))
+		case "/uploads/1/assets":
+			data, _ := io.ReadAll(r.Body)
+			uploads[r.URL.Query().Get("name")] = string(data)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("GITHUB_API_URL", srv.URL)
+
+	releaseURL, err := createGitHubRelease("org/app", "v1.0.0", "notes", false,
+		map[string][]byte{"build_result.json": []byte("{}"), "checksums.txt": []byte("sum")}, "tok")
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/org/app/releases/tag/v1.0.0", releaseURL)
+	assert.Equal(t, map[string]string{"build_result.json": "{}", "checksums.txt": "sum"}, uploads)
+
+	_, err = createGitHubRelease("other/app", "v1.0.0", "notes", false, nil, "tok")
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestReleaseCmdDryRun(t *testing.T) {
+	orig := gitRun
+	t.Cleanup(func() { gitRun = orig })
+	var ran []string
+	gitRun = func(_ context.Context, dir string, args ...string) (string, error) {
+		ran = append(ran, args[0])
+		switch args[0] {
+		case "describe":
+			return "v1.2.3\n", nil
+		case "log":
+			return "abcdef0123\x1ffeat: add release\x1f\x1e\n", nil
+		}
+		t.Fatalf("unexpected git %v", args)
+		return "", nil
+	}
+	origBuild := releaseBuild
+	t.Cleanup(func() { releaseBuild = origBuild })
+	releaseBuild = func(context.Context, string, []string) error {
+		t.Fatal("build must not run in dry-run")
+		return nil
+	}
+
+	changelog := filepath.Join(t.TempDir(), "CHANGELOG.md")
+	_ = releaseCmd.Flags().Set("dry-run", "true")
+	_ = releaseCmd.Flags().Set("changelog-file", changelog)
+	t.Cleanup(func() {
+		_ = releaseCmd.Flags().Set("dry-run", "false")
+		_ = releaseCmd.Flags().Set("changelog-file", "")
+	})
+	releaseCmd.SetContext(t.Context())
+	require.NoError(t, releaseCmd.RunE(releaseCmd, nil))
+	assert.Equal(t, []string{"describe", "log"}, ran)
+	data, err := os.ReadFile(changelog)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "## v1.3.0 ("))
+	assert.Contains(t, string(data), "- add release (abcdef0)")
+}
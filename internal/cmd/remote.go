@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/octopilot/octopilot-pipeline-tools/pkg/pipeline"
+	"github.com/spf13/viper"
+)
+
+// insecureRegistries returns the registries to treat as insecure (self-signed
+// TLS or HTTP) from SKAFFOLD_INSECURE_REGISTRY/SKAFFOLD_INSECURE_REGISTRIES
+// and a comma-separated --insecure-registry value, plus insecure_registries
+// from the config and the registries marked insecure in .registry.
+func insecureRegistries(flagValue string) []string {
+	var regs []string
+	for _, val := range []string{os.Getenv("SKAFFOLD_INSECURE_REGISTRY"), os.Getenv("SKAFFOLD_INSECURE_REGISTRIES"), flagValue} {
+		if val != "" {
+			regs = append(regs, strings.Split(val, ",")...)
+		}
+	}
+	regs = append(regs, viper.GetStringSlice("insecure_registries")...)
+	return append(regs, util.RegistryInsecureRegistries("")...)
+}
+
+// isInsecureRegistry reports whether ref is hosted on one of insecureRegistries.
+func isInsecureRegistry(ref string, insecureRegistries []string) bool {
+	return pipeline.IsInsecureRegistry(ref, insecureRegistries)
+}
+
+// remoteOptionsFor returns the remote options for tag (see pipeline.RemoteOptions),
+// bound to ctx so --timeout and Ctrl-C cancel the request, with
+// credentials from util.Keychain (OIDC federation, then Docker) and the
+// rate-limit aware util.RegistryTransport over the shared proxy and CA
+// bundle transport of util.RegistryHTTPTransport. The transport reuses the
+// connections, and the pings and bearer tokens of the auth handshake, of
+// earlier calls.
+func remoteOptionsFor(ctx context.Context, tag string, insecureRegistries []string) []remote.Option {
+	insecure := isInsecureRegistry(tag, insecureRegistries)
+	return append(pipeline.RemoteOptions(tag, insecureRegistries),
+		remote.WithContext(ctx), remote.WithAuthFromKeychain(util.Keychain()),
+		remote.WithTransport(util.RegistryTransport(util.RegistryHTTPTransport(insecure))))
+}
+
+// withTransferProgress returns opts reporting the push to ref (see
+// util.TrackTransfer) and the function to call once the push returned.
+func withTransferProgress(ref string, opts []remote.Option) ([]remote.Option, func()) {
+	updates, done := util.TrackTransfer(ref)
+	return append(slices.Clip(opts), remote.WithProgress(updates)), done
+}
+
+// registryCache holds what op learned from registries in this process: per
+// context the descriptors of digest references, which cannot change.
+// Descriptors stay bound to the context they were fetched with, so each
+// context gets its own entries, dropped once it is done. Tags are never
+// cached: they move. Pullers and pushers are not shared, as they would
+// ignore the caller's options (context, platform, auth, progress); tokens
+// and connections are, below them (see remoteOptionsFor).
+var registryCache struct {
+	sync.Mutex
+	byCtx map[context.Context]*registryEntries
+}
+
+// registryEntries are the digest descriptors fetched under one context.
+type registryEntries struct {
+	descriptors map[string]*remote.Descriptor
+	heads       map[string]*v1.Descriptor
+}
+
+// registryEntriesLocked returns the cache entries of ctx, created on first
+// use and removed when ctx is done. registryCache must be locked.
+func registryEntriesLocked(ctx context.Context) *registryEntries {
+	if e, ok := registryCache.byCtx[ctx]; ok {
+		return e
+	}
+	e := &registryEntries{descriptors: map[string]*remote.Descriptor{}, heads: map[string]*v1.Descriptor{}}
+	if registryCache.byCtx == nil {
+		registryCache.byCtx = map[context.Context]*registryEntries{}
+	}
+	registryCache.byCtx[ctx] = e
+	context.AfterFunc(ctx, func() {
+		registryCache.Lock()
+		defer registryCache.Unlock()
+		delete(registryCache.byCtx, ctx)
+	})
+	return e
+}
+
+// isDigestRef reports whether ref names a manifest by digest.
+func isDigestRef(ref name.Reference) bool {
+	_, ok := ref.(name.Digest)
+	return ok
+}
+
+// cachedRemoteGet is remote.Get, answering digest references from
+// registryCache after the first fetch under ctx. opts must be bound to ctx.
+func cachedRemoteGet(ctx context.Context, ref name.Reference, opts ...remote.Option) (*remote.Descriptor, error) {
+	if !isDigestRef(ref) {
+		return remote.Get(ref, opts...)
+	}
+	registryCache.Lock()
+	desc, ok := registryEntriesLocked(ctx).descriptors[ref.Name()]
+	registryCache.Unlock()
+	if ok {
+		return desc, nil
+	}
+	desc, err := remote.Get(ref, opts...)
+	if err != nil {
+		return nil, err
+	}
+	registryCache.Lock()
+	defer registryCache.Unlock()
+	registryEntriesLocked(ctx).descriptors[ref.Name()] = desc
+	return desc, nil
+}
+
+// cachedRemoteHead is remote.Head, answering digest references from
+// registryCache (a descriptor fetched or an earlier Head under ctx).
+func cachedRemoteHead(ctx context.Context, ref name.Reference, opts ...remote.Option) (*v1.Descriptor, error) {
+	if !isDigestRef(ref) {
+		return remote.Head(ref, opts...)
+	}
+	registryCache.Lock()
+	entries := registryEntriesLocked(ctx)
+	if desc, ok := entries.descriptors[ref.Name()]; ok {
+		registryCache.Unlock()
+		d := desc.Descriptor
+		return &d, nil
+	}
+	head, ok := entries.heads[ref.Name()]
+	registryCache.Unlock()
+	if ok {
+		return head, nil
+	}
+	head, err := remote.Head(ref, opts...)
+	if err != nil {
+		return nil, err
+	}
+	registryCache.Lock()
+	defer registryCache.Unlock()
+	registryEntriesLocked(ctx).heads[ref.Name()] = head
+	return head, nil
+}
+
+// parseReferenceForRemote parses an image reference for use with remote get/write
+// (see pipeline.ParseReference).
+func parseReferenceForRemote(tag string, insecureRegistries []string) (name.Reference, error) {
+	return pipeline.ParseReference(tag, insecureRegistries)
+}
+
+// ensureHarborProject creates the Harbor project of repo before op pushes to
+// it, when its .registry entry sets harbor.create_project.
+func ensureHarborProject(ctx context.Context, repo string, insecureRegistries []string) error {
+	h, ok := util.HarborOptions("", repo)
+	if !ok || !h.CreateProject {
+		return nil
+	}
+	created, err := util.EnsureHarborProject(ctx, repo, h, isInsecureRegistry(repo, insecureRegistries))
+	if err != nil {
+		return util.WithExitCode(util.ExitPush, err)
+	}
+	if created {
+		slog.Info("Created Harbor project", "repository", repo)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsecureRegistries(t *testing.T) {
+	t.Setenv("SKAFFOLD_INSECURE_REGISTRY", "localhost:5001")
+	t.Setenv("SKAFFOLD_INSECURE_REGISTRIES", "a:5000,b:5000")
+	assert.Equal(t, []string{"localhost:5001", "a:5000", "b:5000", "c:5000"}, insecureRegistries("c:5000"))
+}
+
+func TestInsecureRegistries_RegistryFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.RegistryFilename), []byte("local: localhost:5001\nci:\n  - registry: registry.internal:5000/org\n    insecure: true\n"), 0o644))
+	cwd, _ := os.Getwd()
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+	t.Setenv("SKAFFOLD_INSECURE_REGISTRY", "")
+	t.Setenv("SKAFFOLD_INSECURE_REGISTRIES", "")
+	assert.Equal(t, []string{"registry.internal:5000/org"}, insecureRegistries(""))
+}
+
+func TestRemoteOptionsFor(t *testing.T) {
+	insecure := []string{"localhost:5001"}
+	assert.True(t, isInsecureRegistry("localhost:5001/app:v1", insecure))
+	assert.False(t, isInsecureRegistry("ghcr.io/org/app:v1", insecure))
+	// The insecure transport of pipeline.RemoteOptions is one more option.
+	assert.Len(t, remoteOptionsFor(t.Context(), "localhost:5001/app:v1", insecure), 5)
+	assert.Len(t, remoteOptionsFor(t.Context(), "ghcr.io/org/app:v1", insecure), 4)
+}
+
+func TestRegistryCache(t *testing.T) {
+	var manifestRequests atomic.Int32
+	reg := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/manifests/") {
+			manifestRequests.Add(1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	pushInspectImage(t, host+"/org/app:v1", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	tag, err := name.ParseReference(host + "/org/app:v1")
+	require.NoError(t, err)
+	ctx := t.Context()
+	opts := remoteOptionsFor(ctx, tag.String(), nil)
+	manifestRequests.Store(0)
+
+	// Tags are asked every time: they move.
+	for range 2 {
+		_, err = cachedRemoteHead(ctx, tag, opts...)
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, 2, manifestRequests.Load())
+
+	head, err := cachedRemoteHead(ctx, tag, opts...)
+	require.NoError(t, err)
+	digest := tag.Context().Digest(head.Digest.String())
+	manifestRequests.Store(0)
+	desc, err := cachedRemoteGet(ctx, digest, opts...)
+	require.NoError(t, err)
+	again, err := cachedRemoteGet(ctx, digest, opts...)
+	require.NoError(t, err)
+	assert.Same(t, desc, again)
+	digestHead, err := cachedRemoteHead(ctx, digest, opts...)
+	require.NoError(t, err)
+	assert.Equal(t, head.Digest, digestHead.Digest)
+	// One fetch answers every later Get and Head of the digest.
+	assert.EqualValues(t, 1, manifestRequests.Load())
+
+	// Descriptors are bound to their context: another one fetches again.
+	other, cancel := context.WithCancel(ctx)
+	_, err = cachedRemoteGet(other, digest, remoteOptionsFor(other, tag.String(), nil)...)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, manifestRequests.Load())
+	cancel()
+	assert.Eventually(t, func() bool {
+		registryCache.Lock()
+		defer registryCache.Unlock()
+		_, ok := registryCache.byCtx[other]
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+
+	// Every request runs with the caller's own options, here its context.
+	_, err = cachedRemoteHead(other, tag, remoteOptionsFor(other, tag.String(), nil)...)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/latest"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+)
+
+// sourceDateEpoch returns SOURCE_DATE_EPOCH when set, else the commit time
+// of HEAD in dir.
+func sourceDateEpoch(ctx context.Context, dir string) (time.Time, error) {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		out, err := gitRun(ctx, dir, "log", "-1", "--format=%ct", "HEAD")
+		if err != nil {
+			return time.Time{}, fmt.Errorf("reading the commit time for SOURCE_DATE_EPOCH: %s", strings.TrimSpace(out))
+		}
+		v = strings.TrimSpace(out)
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("SOURCE_DATE_EPOCH %q is not a Unix time", v)
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+// dockerPushArgs are the docker build arguments pushing the image. A
+// reproducible build (t set) rewrites the layer timestamps to t.
+func dockerPushArgs(t time.Time) []string {
+	if t.IsZero() {
+		return []string{"--push"}
+	}
+	return []string{"--output", "type=registry,rewrite-timestamp=true"}
+}
+
+// dockerLoadArgs are the docker build arguments loading the image into the
+// local daemon at t, rewriting the layer timestamps like dockerPushArgs
+// (none when t is zero: the build loads it as usual). Podman has no such
+// output; its --timestamp (see reproducibleDockerArgs) covers the layers.
+func dockerLoadArgs(t time.Time) []string {
+	if t.IsZero() || util.IsPodman() {
+		return nil
+	}
+	return []string{"--output", "type=docker,rewrite-timestamp=true"}
+}
+
+// addReproducibleArgs adds the arguments of a reproducible build at t to the
+// Docker artifacts Skaffold builds into the local daemon. Its buildpack
+// builds use Pack's fixed creation time (1980-01-01).
+func addReproducibleArgs(artifacts []*latest.Artifact, t time.Time) {
+	args := append(dockerLoadArgs(t), reproducibleDockerArgs(t)...)
+	if len(args) == 0 {
+		return
+	}
+	for _, a := range artifacts {
+		if a.DockerArtifact != nil {
+			a.DockerArtifact.CliFlags = append(a.DockerArtifact.CliFlags, args...)
+		}
+	}
+}
+
+// reproducibleDockerArgs are the docker (or podman) build arguments of a
+// reproducible build at t (none when t is zero). BuildKit's provenance and
+// SBOM attestations are turned off: they record when and where the image
+// was built.
+func reproducibleDockerArgs(t time.Time) []string {
+	if t.IsZero() {
+		return nil
+	}
+	epoch := strconv.FormatInt(t.Unix(), 10)
+	if util.IsPodman() {
+		return []string{"--timestamp", epoch}
+	}
+	return []string{"--build-arg", "SOURCE_DATE_EPOCH=" + epoch, "--provenance=false", "--sbom=false"}
+}
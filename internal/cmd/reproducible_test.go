@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/latest"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceDateEpoch(t *testing.T) {
+	orig := gitRun
+	t.Cleanup(func() { gitRun = orig })
+	gitRun = func(_ context.Context, _ string, args ...string) (string, error) {
+		assert.Equal(t, []string{"log", "-1", "--format=%ct", "HEAD"}, args)
+		return "1767225600\n", nil
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	got, err := sourceDateEpoch(t.Context(), "")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), got)
+
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	got, err = sourceDateEpoch(t.Context(), "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1700000000), got.Unix())
+
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	_, err = sourceDateEpoch(t.Context(), "")
+	assert.ErrorContains(t, err, `SOURCE_DATE_EPOCH "yesterday" is not a Unix time`)
+
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	gitRun = func(context.Context, string, ...string) (string, error) {
+		return "fatal: not a git repository\n", errors.New("exit status 128")
+	}
+	_, err = sourceDateEpoch(t.Context(), "")
+	assert.ErrorContains(t, err, "fatal: not a git repository")
+}
+
+func TestReproducibleDockerArgs(t *testing.T) {
+	orig := util.ContainerCLI()
+	t.Cleanup(func() { _ = util.SetContainerRuntime(orig) })
+	epoch := time.Unix(1767225600, 0)
+
+	require.NoError(t, util.SetContainerRuntime(util.RuntimeDocker))
+	assert.Equal(t, []string{"--push"}, dockerPushArgs(time.Time{}))
+	assert.Equal(t, []string{"--output", "type=registry,rewrite-timestamp=true"}, dockerPushArgs(epoch))
+	assert.Nil(t, reproducibleDockerArgs(time.Time{}))
+	assert.Equal(t, []string{"--build-arg", "SOURCE_DATE_EPOCH=1767225600", "--provenance=false", "--sbom=false"}, reproducibleDockerArgs(epoch))
+	assert.Nil(t, dockerLoadArgs(time.Time{}))
+	assert.Equal(t, []string{"--output", "type=docker,rewrite-timestamp=true"}, dockerLoadArgs(epoch))
+
+	require.NoError(t, util.SetContainerRuntime(util.RuntimePodman))
+	assert.Equal(t, []string{"--timestamp", "1767225600"}, reproducibleDockerArgs(epoch))
+	assert.Nil(t, dockerLoadArgs(epoch))
+}
+
+func TestAddReproducibleArgs(t *testing.T) {
+	orig := util.ContainerCLI()
+	t.Cleanup(func() { _ = util.SetContainerRuntime(orig) })
+	require.NoError(t, util.SetContainerRuntime(util.RuntimeDocker))
+	artifacts := []*latest.Artifact{
+		{ImageName: "api", ArtifactType: latest.ArtifactType{DockerArtifact: &latest.DockerArtifact{CliFlags: []string{"--pull"}}}},
+		{ImageName: "web", ArtifactType: latest.ArtifactType{BuildpackArtifact: &latest.BuildpackArtifact{}}},
+	}
+	addReproducibleArgs(artifacts, time.Time{})
+	assert.Equal(t, []string{"--pull"}, artifacts[0].DockerArtifact.CliFlags)
+
+	addReproducibleArgs(artifacts, time.Unix(1767225600, 0))
+	assert.Equal(t, []string{"--pull", "--output", "type=docker,rewrite-timestamp=true",
+		"--build-arg", "SOURCE_DATE_EPOCH=1767225600", "--provenance=false", "--sbom=false"}, artifacts[0].DockerArtifact.CliFlags)
+	assert.Empty(t, artifacts[1].BuildpackArtifact.Env)
+}
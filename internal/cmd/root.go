@@ -1,15 +1,42 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var cfgFile string
 
+// configErr is a config file that failed to interpolate; commands other than
+// op config (which must still be able to fix it) report it before running.
+var configErr error
+
+// userConfigFile is the op config file initConfig read ("" when none); it is
+// logged once logging is configured.
+var userConfigFile string
+
+// userConfigErr is a user config file initConfig ignored, and configFile the
+// project config file it read; both are logged once logging is configured.
+var (
+	userConfigErr error
+	configFile    string
+)
+
+// cancelCommand releases the --timeout context of the running command.
+var cancelCommand context.CancelFunc = func() {}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "op",
@@ -17,16 +44,103 @@ var rootCmd = &cobra.Command{
 	Long: `Organisation-agnostic CLI for Skaffold/Buildpacks pipelines: 
 build, push, build_result.json, watch-deployment, promote-image. 
 Runs in Docker or GitHub Actions.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if configErr != nil && !isConfigCommand(cmd) {
+			return util.WithExitCode(util.ExitConfig, configErr)
+		}
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		if err := util.SetVerbosity(verbose, quiet); err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
+		logFormat, _ := cmd.Flags().GetString("log-format")
+		logLevel, _ := cmd.Flags().GetString("log-level")
+		if err := util.ConfigureLogging(os.Stderr,
+			firstNonEmpty(logFormat, os.Getenv("OP_LOG_FORMAT"), viper.GetString("log_format")),
+			firstNonEmpty(logLevel, os.Getenv("OP_LOG_LEVEL"), viper.GetString("log_level"), util.DefaultLogLevel())); err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
+		if userConfigErr != nil {
+			slog.Warn("Ignoring user config", "error", userConfigErr)
+		}
+		if userConfigFile != "" {
+			slog.Debug("Using user config file", "path", userConfigFile)
+		}
+		if configFile != "" {
+			slog.Info("Using config file", "path", configFile)
+		}
+		runtimeName, _ := cmd.Flags().GetString("runtime")
+		if err := util.SetContainerRuntime(runtimeName); err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
+		util.ConfigureRuntimeEnv()
+		var registry util.LocalRegistryOpts
+		registry.Host, _ = cmd.Flags().GetString("registry-host")
+		registry.Port, _ = cmd.Flags().GetInt("registry-port")
+		registry.Name, _ = cmd.Flags().GetString("registry-name")
+		util.SetLocalRegistryOverride(registry)
+		registryCA, _ := cmd.Flags().GetString("registry-ca")
+		if err := util.SetRegistryCA(firstNonEmpty(registryCA, os.Getenv("OP_REGISTRY_CA_PATH"), viper.GetString("registry_ca"))); err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
+		if timeout, _ := cmd.Flags().GetDuration("timeout"); timeout > 0 {
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			cmd.SetContext(ctx)
+			cancelCommand = cancel
+		}
+		util.StartMetrics(util.LoadMetricsConfig(), strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" "))
+		return nil
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		printUpdateNotice(cmd, os.Stderr)
+	},
+}
+
+// ensureContainerDaemon checks the container daemon before a command that
+// needs it (see util.EnsureContainerDaemon), starting Colima with
+// --auto-start-vm or auto_start_vm. It is a var so tests can replace it.
+var ensureContainerDaemon = func(cmd *cobra.Command) error {
+	autoStart, _ := cmd.Flags().GetBool("auto-start-vm")
+	if !cmd.Flags().Changed("auto-start-vm") {
+		autoStart = viper.GetBool("auto_start_vm")
+	}
+	return util.EnsureContainerDaemon(cmd.Context(), autoStart)
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// SIGINT and SIGTERM cancel the context every command runs under.
 func Execute() error {
-	return rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cmd, err := rootCmd.ExecuteContextC(ctx)
+	defer cancelCommand()
+	if err != nil && errors.Is(cmd.Context().Err(), context.DeadlineExceeded) {
+		timeout, _ := rootCmd.PersistentFlags().GetDuration("timeout")
+		err = fmt.Errorf("timed out after %s: %w", timeout, err)
+	}
+	if mErr := util.FinishMetrics(err); mErr != nil {
+		slog.Warn("Could not export metrics", "error", mErr)
+	}
+	return err
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	rootCmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return util.WithExitCode(util.ExitConfig, err)
+	})
+	rootCmd.PersistentFlags().String("runtime", "", "Container runtime: docker, podman or auto (default: $OP_CONTAINER_RUNTIME, then auto-detect)")
+	rootCmd.PersistentFlags().Bool("auto-start-vm", false, "Start a stopped Colima VM before build, run and start-registry (default: auto_start_vm)")
+	rootCmd.PersistentFlags().String("registry-host", "", "Local registry host (default: $OP_REGISTRY_HOST, local_registry.host, then localhost)")
+	rootCmd.PersistentFlags().Int("registry-port", 0, "Local registry port (default: $OP_REGISTRY_PORT, local_registry.port, then 5001)")
+	rootCmd.PersistentFlags().String("registry-name", "", "Local registry container name (default: $OP_REGISTRY_NAME, local_registry.name, then octopilot-registry)")
+	rootCmd.PersistentFlags().String("registry-ca", "", "PEM CA bundle to trust for registry calls and builders, on top of the system roots (default: $OP_REGISTRY_CA_PATH, then registry_ca)")
+	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Verbose output: debug logs, Pack and Skaffold details (same as OP_DEBUG=true)")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Only print warnings, errors and results; suppress progress output")
+	rootCmd.PersistentFlags().String("log-format", "", "Log format: text or json (default: $OP_LOG_FORMAT, log_format, then text)")
+	rootCmd.PersistentFlags().String("log-level", "", "Log level: debug, info, warn or error (default: $OP_LOG_LEVEL, log_level, then info)")
+	rootCmd.PersistentFlags().Duration("timeout", 0, "Abort the command (registry calls, builds, external commands) after this duration, e.g. 30m (default: no limit)")
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is pipeline.properties or .github/octopilot.yaml)")
 }
 
@@ -45,7 +159,51 @@ func initConfig() {
 
 	viper.AutomaticEnv() // read in environment variables that match
 
+	// User-level defaults (op config); every other source overrides them.
+	if path, err := util.LoadUserConfig(); err != nil {
+		var interpErr *util.InterpolationError
+		if errors.As(err, &interpErr) {
+			configErr = err
+		} else {
+			userConfigErr = err
+		}
+	} else {
+		userConfigFile = path
+	}
+
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+		configFile = viper.ConfigFileUsed()
+		if err := interpolateConfig(viper.ConfigFileUsed()); err != nil && configErr == nil {
+			configErr = err
+		}
+	}
+}
+
+// interpolateConfig re-reads the YAML config file at path with variable
+// references expanded (see util.Interpolate). Other formats are left as read.
+func interpolateConfig(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	default:
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	out, err := util.InterpolateYAML(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return viper.ReadConfig(bytes.NewReader(out))
+}
+
+// isConfigCommand reports whether cmd is op config or one of its subcommands.
+func isConfigCommand(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c == configCmd {
+			return true
+		}
 	}
+	return false
 }
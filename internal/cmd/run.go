@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
 	"github.com/spf13/cobra"
@@ -17,6 +21,9 @@ var runCmd = &cobra.Command{
 
 Use "op run context list" to list contexts defined in skaffold.yaml.
 Use "op run <context>" to run that context.
+Use "op run export-compose" to write a docker-compose.yaml for all contexts
+(--output, "-" for stdout) with the same images, ports, env, volumes and
+dependencies; secrets are not exported.
 
 The image reference is resolved in order:
   1. build_result.json (if present) — uses the exact pushed digest.
@@ -24,9 +31,65 @@ The image reference is resolved in order:
      with tag "latest" as fallback.
 
 Ports, environment variables, and volume mounts are read from
-.github/octopilot.yaml; if absent, defaults apply (8080:8080, PORT=8080).`,
-	Args: cobra.MinimumNArgs(1),
+.github/octopilot.yaml; if absent, defaults apply (8080:8080, PORT=8080).
+
+With --build, the artifact is built into the local Docker daemon first
+(Pack for buildpack artifacts, docker build otherwise; nothing is pushed).
+This also happens automatically when build_result.json has no entry for
+the image and the default image is not present locally.
+
+With --watch, the artifact is built locally (Pack for buildpack artifacts,
+docker build otherwise) and the container is rebuilt and restarted whenever
+a file in the context directory changes.
+
+With --debug, a debugger port is published and the container is started
+with the runtime's debug settings: delve for Go (the image must contain dlv),
+the inspector for Node.js (NODE_OPTIONS) and JDWP for JVM apps
+(JAVA_TOOL_OPTIONS). The runtime is inferred from the context directory
+(go.mod, package.json, pom.xml/build.gradle) unless --debug-runtime is set.
+
+--pull controls whether the image is pulled before running: "missing"
+(default) pulls only when the image is not in the local daemon, "always"
+pulls every time and "never" fails fast when it is absent. --platform is
+passed through to docker pull/run; a warning is printed when the image
+architecture differs from the host and will run under emulation.
+
+With --cluster kind|k3d, the image is loaded into a local kind or k3d
+cluster and deployed as a minimal Deployment+Service (or with the Helm
+chart set as "chart" for the context in .github/octopilot.yaml), then the
+service is port-forwarded to localhost. Resources are removed on exit.
+
+With --wait, op waits until the container is ready — healthy according to
+the image's Docker HEALTHCHECK, or, without one, until the first mapped
+port answers 2xx on --health-path — and prints the ready URL. Combine with
+--detach in CI smoke jobs to return as soon as the app is ready instead of
+sleeping for an arbitrary duration.
+
+Backing services listed under "dependencies" for the context in
+.github/octopilot.yaml (image, env, ports, volumes) are started on a shared
+Docker network before the app and removed afterwards; the app reaches each
+one by its key as hostname (e.g. postgres:5432).
+
+--cpus, --memory, --network and --add-host are passed to docker run, and
+--docker-arg adds any other docker run argument verbatim (repeatable). The
+same settings can be set per context in .github/octopilot.yaml (cpus,
+memory, network, add_hosts, docker_args); flags override scalar values and
+extend the lists.
+
+With --shell, the image is started with an interactive shell (--shell-path,
+default /bin/sh) instead of its entrypoint, for inspecting image contents.
+Buildpack images run the shell through the CNB launcher so the app's
+environment is set. --mount-workspace mounts the context directory at
+/workspace.
+
+Secrets are injected from "secrets" (env name → op://vault/item/field,
+resolved with the 1Password CLI, or env://NAME) and "secret_files"
+(SOPS-encrypted dotenv/YAML/JSON, decrypted with sops). Values are passed
+to docker through its environment and never printed.`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeRunArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
 		cwd, _ := os.Getwd()
 		skaffoldFile, _ := cmd.Flags().GetString("skaffold-file")
 
@@ -44,6 +107,12 @@ Ports, environment variables, and volume mounts are read from
 			return nil
 		}
 
+		// "op run export-compose"
+		if args[0] == "export-compose" {
+			output, _ := cmd.Flags().GetString("output")
+			return exportCompose(cwd, artifacts, output)
+		}
+
 		contextName := args[0]
 		var matched *util.Artifact
 		for i, art := range artifacts {
@@ -56,36 +125,220 @@ Ports, environment variables, and volume mounts are read from
 			return fmt.Errorf("unknown context %q — use 'op run context list' to see available contexts", contextName)
 		}
 
+		watch, _ := cmd.Flags().GetBool("watch")
+		cluster, _ := cmd.Flags().GetString("cluster")
+		if watch && cluster != "" {
+			return fmt.Errorf("--watch cannot be combined with --cluster")
+		}
+		shell, _ := cmd.Flags().GetBool("shell")
+		if shell && (watch || cluster != "") {
+			return fmt.Errorf("--shell cannot be combined with --watch or --cluster")
+		}
+
+		if err := ensureContainerDaemon(cmd); err != nil {
+			return err
+		}
+
 		// Resolve image: prefer build_result.json, fall back to default repo + latest.
-		fullImage := resolveRunImage(cwd, matched.Image)
+		// In watch mode the image is always built locally; otherwise it is built
+		// with --build, or when the fallback image is not in the local daemon.
+		fullImage, fromBuildResult, err := resolveRunImageSource(cwd, matched.Image)
+		if err != nil {
+			return err
+		}
+		platform, _ := cmd.Flags().GetString("platform")
+		pullPolicy, _ := cmd.Flags().GetString("pull")
+		build, _ := cmd.Flags().GetBool("build")
+		if !watch && !build && !fromBuildResult && pullPolicy != pullAlways && !imageExistsLocally(ctx, fullImage) {
+			slog.Info("Image not found locally; building it first", "image", fullImage)
+			build = true
+		}
+		switch {
+		case watch || build:
+			// --watch builds here too, so --debug inspects the image it runs.
+			if fullImage, err = localRunImage(cwd, matched.Image); err != nil {
+				return err
+			}
+			if err := buildRunArtifact(ctx, cwd, *matched, artifacts, fullImage); err != nil {
+				return err
+			}
+		default:
+			if err := ensureRunImage(ctx, fullImage, pullPolicy, platform); err != nil {
+				return err
+			}
+			warnIfEmulated(ctx, fullImage, platform)
+		}
 
 		cfg, _ := util.LoadRunConfig(cwd)
 		contextDir := filepath.Join(cwd, matched.Context)
 		hostPorts, env, volumes, containerPort := util.GetRunOptionsForContext(contextName, cwd, cfg, contextDir)
+		var ctxOpts util.ContextOpts
+		if cfg != nil {
+			ctxOpts = cfg.Contexts[contextName]
+		}
+		resources := mergeRunResources(ctxOpts, runResourceOptionsFromFlags(cmd))
+
+		if shell {
+			shellPath, _ := cmd.Flags().GetString("shell-path")
+			var workspace string
+			if mount, _ := cmd.Flags().GetBool("mount-workspace"); mount {
+				workspace = contextDir
+			}
+			dockerArgs, err := shellDockerArgs(ctx, fullImage, platform, shellPath, env, volumes, workspace, resources.dockerArgs())
+			if err != nil {
+				return err
+			}
+			slog.Info("Running command", "command", util.ContainerCLI(), "args", dockerArgs)
+			c := exec.CommandContext(ctx, util.ContainerCLI(), dockerArgs...)
+			c.Stdout = os.Stdout
+			c.Stderr = os.Stderr
+			c.Stdin = os.Stdin
+			if err := c.Run(); err != nil {
+				return fmt.Errorf("docker run failed: %w", err)
+			}
+			return nil
+		}
 
 		if len(hostPorts) == 0 {
-			freePort, err := util.FindFreePort(8080, 100)
+			// Map the app port, then any other inferred port, to free host ports.
+			ports := []int{containerPort}
+			for _, port := range util.InferRunOptions(contextDir).Ports {
+				if port != containerPort {
+					ports = append(ports, port)
+				}
+			}
+			next := 8080
+			for i, port := range ports {
+				freePort, err := util.FindFreePort(next, 100)
+				if err != nil {
+					return fmt.Errorf("finding free port: %w", err)
+				}
+				hostPorts = append(hostPorts, fmt.Sprintf("%d:%d", freePort, port))
+				if i == 0 {
+					slog.Info("Mapped port", "port", port, "url", fmt.Sprintf("http://localhost:%d", freePort))
+				} else {
+					slog.Info("Mapped port", "port", port, "host_port", freePort)
+				}
+				next = freePort + 1
+			}
+		}
+
+		if cluster != "" {
+			hostPort, _, err := splitPortMapping(hostPorts[0])
+			if err != nil {
+				return err
+			}
+			var chart string
+			if cfg != nil {
+				chart = resolveChartPath(cwd, cfg.Contexts[contextName].Chart)
+			}
+			clusterName, _ := cmd.Flags().GetString("cluster-name")
+			namespace, _ := cmd.Flags().GetString("namespace")
+			return runInCluster(ctx, clusterRunOptions{
+				Provider:      cluster,
+				ClusterName:   clusterName,
+				Namespace:     namespace,
+				Image:         fullImage,
+				Env:           env,
+				ContainerPort: containerPort,
+				HostPort:      hostPort,
+				Chart:         chart,
+			})
+		}
+
+		var debug *runDebugSetup
+		if enabled, _ := cmd.Flags().GetBool("debug"); enabled {
+			runtime, _ := cmd.Flags().GetString("debug-runtime")
+			debug, err = prepareRunDebug(ctx, contextDir, runtime, fullImage)
 			if err != nil {
-				return fmt.Errorf("finding free port: %w", err)
+				return err
+			}
+			for k, v := range debug.Options.Env {
+				env[k] = v
 			}
-			hostPorts = []string{fmt.Sprintf("%d:%d", freePort, containerPort)}
-			fmt.Fprintf(os.Stderr, "Mapped to http://localhost:%d\n", freePort)
 		}
 
-		dockerArgs := []string{"run", "--rm", "-it"}
+		wait, _ := cmd.Flags().GetBool("wait")
+		detach, _ := cmd.Flags().GetBool("detach")
+		if detach && watch {
+			return fmt.Errorf("--detach cannot be combined with --watch")
+		}
+
+		var secretNames []string
+		if cfg != nil {
+			secrets, err := util.ResolveContextSecrets(ctx, cwd, cfg.Contexts[contextName])
+			if err != nil {
+				return fmt.Errorf("resolving secrets: %w", err)
+			}
+			if secretNames, err = exportRunSecrets(secrets, env); err != nil {
+				return err
+			}
+		}
+
+		var deps *runDependencies
+		if cfg != nil && len(cfg.Contexts[contextName].Dependencies) > 0 {
+			if resources.Network != "" {
+				return fmt.Errorf("--network cannot be combined with dependencies (they use their own network)")
+			}
+			deps, err = startRunDependencies(ctx, contextName, cfg.Contexts[contextName].Dependencies)
+			if err != nil {
+				return err
+			}
+			if detach {
+				fmt.Fprintf(os.Stderr, "Dependencies left running; remove them with:\n%s", deps.CleanupHint())
+			} else {
+				defer deps.Stop(ctx)
+			}
+		}
+
+		containerName := runContainerName(contextName)
+		dockerArgs := []string{"run", "--rm"}
+		switch {
+		case detach:
+			dockerArgs = append(dockerArgs, "-d", "--name", containerName)
+		case watch || wait:
+			dockerArgs = append(dockerArgs, "--name", containerName)
+		default:
+			dockerArgs = append(dockerArgs, "-it")
+		}
+		if platform != "" {
+			dockerArgs = append(dockerArgs, "--platform", platform)
+		}
+		if deps != nil {
+			dockerArgs = append(dockerArgs, "--network", deps.Network)
+		}
 		for _, p := range hostPorts {
 			dockerArgs = append(dockerArgs, "-p", p)
 		}
 		for k, v := range env {
 			dockerArgs = append(dockerArgs, "-e", fmt.Sprintf("%s=%s", k, v))
 		}
+		for _, name := range secretNames {
+			dockerArgs = append(dockerArgs, "-e", name)
+		}
 		for _, v := range volumes {
 			dockerArgs = append(dockerArgs, "-v", v)
 		}
+		dockerArgs = append(dockerArgs, resources.dockerArgs()...)
+		if debug != nil {
+			dockerArgs = append(dockerArgs, debug.Flags...)
+		}
 		dockerArgs = append(dockerArgs, fullImage)
+		if debug != nil {
+			dockerArgs = append(dockerArgs, debug.Command...)
+			fmt.Fprint(os.Stderr, debug.Options.AttachInstructions(debug.HostPort))
+		}
+
+		if watch {
+			return runWatchLoop(ctx, cwd, *matched, artifacts, fullImage, containerName, dockerArgs)
+		}
+
+		if wait || detach {
+			return runAndWait(ctx, cmd, containerName, hostPorts[0], dockerArgs, wait, detach)
+		}
 
-		fmt.Fprintf(os.Stderr, "Running: docker %v\n", dockerArgs)
-		c := exec.Command("docker", dockerArgs...)
+		slog.Info("Running command", "command", util.ContainerCLI(), "args", dockerArgs)
+		c := exec.CommandContext(ctx, util.ContainerCLI(), dockerArgs...)
 		c.Stdout = os.Stdout
 		c.Stderr = os.Stderr
 		c.Stdin = os.Stdin
@@ -96,20 +349,104 @@ Ports, environment variables, and volume mounts are read from
 	},
 }
 
+// runAndWait starts the container (detached or in the background), optionally
+// waits for it to become ready and prints the ready URL. Without --detach it
+// then stays attached until the container exits.
+func runAndWait(ctx context.Context, cmd *cobra.Command, containerName, portMapping string, dockerArgs []string, wait, detach bool) error {
+	// exited is closed when the attached docker run ends, with its error in
+	// runErr; nil when detached.
+	var exited chan struct{}
+	var runErr error
+	if detach {
+		if err := util.RunCommand(ctx, util.ContainerCLI(), dockerArgs...); err != nil {
+			return fmt.Errorf("docker run failed: %w", err)
+		}
+	} else {
+		c, err := startRunContainer(ctx, dockerArgs)
+		if err != nil {
+			return fmt.Errorf("docker run failed: %w", err)
+		}
+		exited = make(chan struct{})
+		go func() {
+			runErr = c.Wait()
+			close(exited)
+		}()
+	}
+
+	if wait {
+		hostPort, _, err := splitPortMapping(portMapping)
+		if err != nil {
+			return err
+		}
+		healthPath, _ := cmd.Flags().GetString("health-path")
+		if !strings.HasPrefix(healthPath, "/") {
+			healthPath = "/" + healthPath
+		}
+		url := fmt.Sprintf("http://localhost:%d%s", hostPort, healthPath)
+		timeout, _ := cmd.Flags().GetDuration("wait-timeout")
+		if err := waitForContainerReady(ctx, containerName, url, timeout, exited); err != nil {
+			if exited != nil {
+				_ = stopRunContainer(context.WithoutCancel(ctx), containerName)
+				<-exited
+			}
+			return err
+		}
+		slog.Info("Ready", "url", url)
+		fmt.Println(url)
+	}
+
+	if exited != nil {
+		<-exited
+		if runErr != nil {
+			return fmt.Errorf("docker run failed: %w", runErr)
+		}
+	}
+	return nil
+}
+
 // resolveRunImage finds the fully-qualified image reference for imageName.
 // It checks build_result.json first; if absent or the image isn't listed,
 // it falls back to <defaultRepo>/<imageName>:latest.
-func resolveRunImage(cwd, imageName string) string {
+func resolveRunImage(cwd, imageName string) (string, error) {
+	ref, _, err := resolveRunImageSource(cwd, imageName)
+	return ref, err
+}
+
+// resolveRunImageSource is resolveRunImage that also reports whether the
+// reference came from build_result.json (true) or the default-repo fallback.
+func resolveRunImageSource(cwd, imageName string) (string, bool, error) {
 	if res, err := util.ReadBuildResult(cwd); err == nil {
 		if tag, err := util.GetTagForImage(res, imageName); err == nil && tag != "" {
-			return tag
+			return tag, true, nil
 		}
 	}
-	repo := util.ResolveDefaultRepo(cwd)
-	return fmt.Sprintf("%s/%s:latest", repo, imageName)
+	ref, err := localRunImage(cwd, imageName)
+	return ref, false, err
 }
 
 func init() {
 	rootCmd.AddCommand(runCmd)
 	runCmd.Flags().String("skaffold-file", "skaffold.yaml", "Path to skaffold.yaml")
+	runCmd.Flags().Bool("build", false, "Build the artifact locally (no push) before running")
+	runCmd.Flags().Bool("watch", false, "Rebuild and restart the container when files in the context change")
+	runCmd.Flags().Bool("debug", false, "Expose a debugger port and print IDE attach instructions")
+	runCmd.Flags().String("pull", pullMissing, "Pull policy before running: always, missing or never")
+	runCmd.Flags().String("platform", "", "Platform to pull and run (e.g. linux/amd64)")
+	runCmd.Flags().String("cluster", "", "Run inside a local cluster instead of docker: kind or k3d")
+	runCmd.Flags().String("cluster-name", "", "Local cluster name (default: the provider's default cluster)")
+	runCmd.Flags().String("namespace", "default", "Kubernetes namespace used with --cluster")
+	runCmd.Flags().Bool("wait", false, "Wait until the container is healthy (HEALTHCHECK or HTTP 2xx) and print the ready URL")
+	runCmd.Flags().Duration("wait-timeout", 60*time.Second, "Maximum time to wait for readiness with --wait")
+	runCmd.Flags().String("health-path", "/", "HTTP path probed by --wait when the image has no HEALTHCHECK")
+	runCmd.Flags().BoolP("detach", "d", false, "Run the container in the background and return (use with --wait in CI)")
+	runCmd.Flags().StringP("output", "o", "docker-compose.yaml", "File written by export-compose (\"-\" for stdout)")
+	runCmd.Flags().String("cpus", "", "CPU limit passed to docker run (e.g. 1.5)")
+	runCmd.Flags().String("memory", "", "Memory limit passed to docker run (e.g. 512m)")
+	runCmd.Flags().String("network", "", "Docker network to attach the container to")
+	runCmd.Flags().StringArray("add-host", nil, "Extra host-to-IP mapping (host:ip), repeatable")
+	runCmd.Flags().StringArray("docker-arg", nil, "Extra argument passed verbatim to docker run, repeatable (e.g. --docker-arg=--read-only)")
+	runCmd.Flags().Bool("shell", false, "Start an interactive shell in the image instead of its entrypoint")
+	runCmd.Flags().String("shell-path", "/bin/sh", "Shell started by --shell")
+	runCmd.Flags().Bool("mount-workspace", false, "With --shell, mount the context directory at /workspace")
+	runCmd.Flags().String("debug-runtime", "", "Debugger runtime: go, node or jvm (default: inferred from the context)")
 }
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+)
+
+// Local cluster providers supported by `op run --cluster`.
+const (
+	clusterKind = "kind"
+	clusterK3d  = "k3d"
+)
+
+// clusterRunOptions configures running a context inside a local cluster.
+type clusterRunOptions struct {
+	Provider      string
+	ClusterName   string
+	Namespace     string
+	Image         string
+	Env           map[string]string
+	ContainerPort int
+	HostPort      int
+	// Chart, when set, is installed with Helm instead of the generated manifest.
+	Chart string
+}
+
+// kubectlApply and kubectlDelete pipe manifest to kubectl. They are vars so
+// tests can replace them.
+var kubectlApply = func(ctx context.Context, namespace, manifest string) error {
+	return kubectlWithStdin(ctx, "apply", namespace, manifest)
+}
+
+var kubectlDelete = func(ctx context.Context, namespace, manifest string) error {
+	return kubectlWithStdin(ctx, "delete", namespace, manifest)
+}
+
+func kubectlWithStdin(ctx context.Context, verb, namespace, manifest string) error {
+	args := []string{verb, "-f", "-"}
+	if namespace != "" {
+		args = append(args, "-n", namespace)
+	}
+	slog.Info("Running command", "command", "kubectl", "args", args)
+	c := exec.CommandContext(ctx, "kubectl", args...)
+	c.Stdin = strings.NewReader(manifest)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// kubectlPortForward blocks forwarding hostPort to the service until ctx is done.
+var kubectlPortForward = func(ctx context.Context, namespace, service string, hostPort, containerPort int) error {
+	c := exec.CommandContext(ctx, "kubectl", "-n", namespace, "port-forward",
+		"service/"+service, fmt.Sprintf("%d:%d", hostPort, containerPort))
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// stripDigest removes an @sha256:... suffix from an image reference.
+// Local cluster image loading requires a tag, not a digest.
+func stripDigest(ref string) string {
+	if at := strings.Index(ref, "@"); at != -1 {
+		return ref[:at]
+	}
+	return ref
+}
+
+// splitPortMapping parses a docker port mapping ("8081:8080",
+// "127.0.0.1:8081:8080") into host and container ports.
+func splitPortMapping(mapping string) (int, int, error) {
+	parts := strings.Split(mapping, ":")
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("invalid port mapping %q (expected host:container)", mapping)
+	}
+	host, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid host port in %q: %w", mapping, err)
+	}
+	container, err := strconv.Atoi(strings.SplitN(parts[len(parts)-1], "/", 2)[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid container port in %q: %w", mapping, err)
+	}
+	return host, container, nil
+}
+
+// loadImageIntoCluster makes a local image available to the cluster nodes.
+func loadImageIntoCluster(ctx context.Context, provider, clusterName, image string) error {
+	switch provider {
+	case clusterKind:
+		args := []string{"load", "docker-image", image}
+		if clusterName != "" {
+			args = append(args, "--name", clusterName)
+		}
+		return util.RunCommand(ctx, "kind", args...)
+	case clusterK3d:
+		args := []string{"image", "import", image}
+		if clusterName != "" {
+			args = append(args, "--cluster", clusterName)
+		}
+		return util.RunCommand(ctx, "k3d", args...)
+	}
+	return fmt.Errorf("unsupported --cluster %q (expected %s or %s)", provider, clusterKind, clusterK3d)
+}
+
+// runInCluster loads the image into a local kind/k3d cluster, deploys it
+// (generated Deployment+Service or the project's chart), waits for the rollout
+// and port-forwards until ctx is cancelled. Resources are removed on exit.
+func runInCluster(ctx context.Context, o clusterRunOptions) error {
+	if o.Namespace == "" {
+		o.Namespace = "default"
+	}
+	name := util.K8sName(o.Image)
+
+	// Re-tag digest-pinned refs: kind/k3d can only import tagged images.
+	image := stripDigest(o.Image)
+	if image != o.Image {
+		if err := util.RunCommand(ctx, util.ContainerCLI(), "tag", o.Image, image); err != nil {
+			return fmt.Errorf("tagging %s as %s: %w", o.Image, image, err)
+		}
+	}
+	if err := loadImageIntoCluster(ctx, o.Provider, o.ClusterName, image); err != nil {
+		return fmt.Errorf("loading image into %s cluster: %w", o.Provider, err)
+	}
+
+	// Clean up even after ctx is cancelled by Ctrl+C.
+	cleanupCtx := context.WithoutCancel(ctx)
+	var cleanup func()
+	if o.Chart != "" {
+		repo, tag := image, "latest"
+		if colon := strings.LastIndex(image, ":"); colon > strings.LastIndex(image, "/") {
+			repo, tag = image[:colon], image[colon+1:]
+		}
+		args := []string{"upgrade", "--install", name, o.Chart,
+			"--namespace", o.Namespace,
+			"--set", "image.repository=" + repo,
+			"--set", "image.tag=" + tag,
+			"--set", "image.pullPolicy=IfNotPresent",
+			"--wait",
+		}
+		if err := util.RunCommand(ctx, "helm", args...); err != nil {
+			return fmt.Errorf("helm install of %s failed: %w", o.Chart, err)
+		}
+		cleanup = func() { _ = util.RunCommand(cleanupCtx, "helm", "uninstall", name, "--namespace", o.Namespace) }
+	} else {
+		manifest, err := util.RenderDevManifest(util.DevWorkload{
+			Name:          name,
+			Namespace:     o.Namespace,
+			Image:         image,
+			ContainerPort: o.ContainerPort,
+			Env:           o.Env,
+		})
+		if err != nil {
+			return err
+		}
+		if err := kubectlApply(ctx, o.Namespace, manifest); err != nil {
+			return fmt.Errorf("kubectl apply failed: %w", err)
+		}
+		cleanup = func() { _ = kubectlDelete(cleanupCtx, o.Namespace, manifest) }
+		if err := util.RunCommand(ctx, "kubectl", "-n", o.Namespace, "rollout", "status",
+			"deployment/"+name, "--timeout", "2m"); err != nil {
+			cleanup()
+			return fmt.Errorf("rollout failed: %w", err)
+		}
+	}
+	defer cleanup()
+
+	slog.Info("Forwarding (Ctrl+C to stop and clean up)", "url", fmt.Sprintf("http://localhost:%d", o.HostPort), "service", name, "port", o.ContainerPort)
+	return kubectlPortForward(ctx, o.Namespace, name, o.HostPort, o.ContainerPort)
+}
+
+// resolveChartPath returns chart relative to cwd when it is not absolute.
+func resolveChartPath(cwd, chart string) string {
+	if chart == "" || filepath.IsAbs(chart) {
+		return chart
+	}
+	return filepath.Join(cwd, chart)
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitPortMapping(t *testing.T) {
+	h, c, err := splitPortMapping("8081:8080")
+	require.NoError(t, err)
+	assert.Equal(t, 8081, h)
+	assert.Equal(t, 8080, c)
+
+	h, c, err = splitPortMapping("127.0.0.1:9000:3000/tcp")
+	require.NoError(t, err)
+	assert.Equal(t, 9000, h)
+	assert.Equal(t, 3000, c)
+
+	_, _, err = splitPortMapping("8080")
+	assert.Error(t, err)
+}
+
+func TestStripDigest(t *testing.T) {
+	assert.Equal(t, "ghcr.io/a/b:v1", stripDigest("ghcr.io/a/b:v1@sha256:abc"))
+	assert.Equal(t, "ghcr.io/a/b:v1", stripDigest("ghcr.io/a/b:v1"))
+}
+
+func TestRunInCluster_KindManifest(t *testing.T) {
+	var commands []string
+	oldRun := util.RunCommandFn
+	util.RunCommandFn = func(_ context.Context, name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	defer func() { util.RunCommandFn = oldRun }()
+
+	var applied, deleted string
+	oldApply, oldDelete := kubectlApply, kubectlDelete
+	kubectlApply = func(_ context.Context, _, manifest string) error { applied = manifest; return nil }
+	kubectlDelete = func(_ context.Context, _, manifest string) error { deleted = manifest; return nil }
+	defer func() { kubectlApply, kubectlDelete = oldApply, oldDelete }()
+
+	var forwarded string
+	oldPF := kubectlPortForward
+	kubectlPortForward = func(_ context.Context, ns, svc string, hostPort, containerPort int) error {
+		forwarded = strings.Join([]string{ns, svc}, "/")
+		assert.Equal(t, 8081, hostPort)
+		assert.Equal(t, 8080, containerPort)
+		return nil
+	}
+	defer func() { kubectlPortForward = oldPF }()
+
+	err := runInCluster(t.Context(), clusterRunOptions{
+		Provider:      clusterKind,
+		ClusterName:   "dev",
+		Image:         "ghcr.io/acme/api:v1@sha256:abc",
+		ContainerPort: 8080,
+		HostPort:      8081,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "docker tag ghcr.io/acme/api:v1@sha256:abc ghcr.io/acme/api:v1", commands[0])
+	assert.Equal(t, "kind load docker-image ghcr.io/acme/api:v1 --name dev", commands[1])
+	assert.Contains(t, commands[2], "rollout status deployment/api")
+	assert.Contains(t, applied, "image: ghcr.io/acme/api:v1")
+	assert.Equal(t, applied, deleted)
+	assert.Equal(t, "default/api", forwarded)
+}
+
+func TestRunInCluster_ChartUsesHelm(t *testing.T) {
+	var commands []string
+	oldRun := util.RunCommandFn
+	util.RunCommandFn = func(_ context.Context, name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	defer func() { util.RunCommandFn = oldRun }()
+
+	oldPF := kubectlPortForward
+	kubectlPortForward = func(context.Context, string, string, int, int) error { return nil }
+	defer func() { kubectlPortForward = oldPF }()
+
+	err := runInCluster(t.Context(), clusterRunOptions{
+		Provider: clusterK3d,
+		Image:    "localhost:5001/web:latest",
+		Chart:    "/repo/chart",
+		HostPort: 8080, ContainerPort: 8080,
+	})
+	require.NoError(t, err)
+	require.Len(t, commands, 3)
+	assert.Equal(t, "k3d image import localhost:5001/web:latest", commands[0])
+	assert.Contains(t, commands[1], "helm upgrade --install web /repo/chart")
+	assert.Contains(t, commands[1], "image.repository=localhost:5001/web")
+	assert.Contains(t, commands[1], "image.tag=latest")
+	assert.Equal(t, "helm uninstall web --namespace default", commands[2])
+}
+
+func TestLoadImageIntoCluster_Unsupported(t *testing.T) {
+	assert.Error(t, loadImageIntoCluster(t.Context(), "minikube", "", "img"))
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+// composeFile is the subset of the Compose specification written by
+// `op run export-compose`.
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Image       string            `yaml:"image"`
+	Ports       []string          `yaml:"ports,omitempty"`
+	Environment map[string]string `yaml:"environment,omitempty"`
+	Volumes     []string          `yaml:"volumes,omitempty"`
+	ExtraHosts  []string          `yaml:"extra_hosts,omitempty"`
+	CPUs        string            `yaml:"cpus,omitempty"`
+	MemLimit    string            `yaml:"mem_limit,omitempty"`
+	DependsOn   []string          `yaml:"depends_on,omitempty"`
+}
+
+// composeServiceName is the Compose service name for a Skaffold context,
+// the container name used by `op run` without its "op-run-" prefix.
+func composeServiceName(contextName string) string {
+	return strings.TrimPrefix(runContainerName(contextName), "op-run-")
+}
+
+// buildComposeFile renders every artifact in artifacts as a Compose service,
+// using the same image resolution and octopilot.yaml options as `op run`.
+// Dependencies become services of their own, shared by key across contexts.
+// Secrets and docker_args have no portable Compose form and are left out
+// (a warning is printed for docker_args).
+func buildComposeFile(cwd string, artifacts []util.Artifact, cfg *util.RunConfig) (*composeFile, error) {
+	out := &composeFile{Services: map[string]composeService{}}
+	deps := map[string]util.DependencyOpts{}
+
+	for _, art := range artifacts {
+		name := composeServiceName(art.Context)
+		if _, exists := out.Services[name]; exists {
+			return nil, fmt.Errorf("contexts map to duplicate compose service %q", name)
+		}
+		contextDir := filepath.Join(cwd, art.Context)
+		hostPorts, env, volumes, _ := util.GetRunOptionsForContext(art.Context, cwd, cfg, contextDir)
+		if len(hostPorts) == 0 {
+			// Publish every inferred port on an ephemeral host port so services never collide.
+			for _, port := range util.InferRunOptions(contextDir).Ports {
+				hostPorts = append(hostPorts, fmt.Sprintf("%d", port))
+			}
+		}
+		image, err := resolveRunImage(cwd, art.Image)
+		if err != nil {
+			return nil, err
+		}
+		svc := composeService{
+			Image:       image,
+			Ports:       hostPorts,
+			Environment: env,
+			Volumes:     volumes,
+		}
+
+		if ctxOpts, ok := cfg.Contexts[art.Context]; ok {
+			svc.ExtraHosts = ctxOpts.AddHosts
+			svc.CPUs = ctxOpts.CPUs
+			svc.MemLimit = ctxOpts.Memory
+			if len(ctxOpts.DockerArgs) > 0 {
+				slog.Warn("docker_args are not exported to compose", "context", art.Context)
+			}
+			for depName, dep := range ctxOpts.Dependencies {
+				if dep.Image == "" {
+					return nil, fmt.Errorf("dependency %q has no image", depName)
+				}
+				if existing, ok := deps[depName]; ok && existing.Image != dep.Image {
+					return nil, fmt.Errorf("dependency %q is defined with different images (%s, %s)", depName, existing.Image, dep.Image)
+				}
+				deps[depName] = dep
+				svc.DependsOn = append(svc.DependsOn, depName)
+			}
+			sort.Strings(svc.DependsOn)
+		}
+		out.Services[name] = svc
+	}
+
+	for depName, dep := range deps {
+		if _, exists := out.Services[depName]; exists {
+			return nil, fmt.Errorf("dependency %q has the same name as a context service", depName)
+		}
+		out.Services[depName] = composeService{
+			Image:       dep.Image,
+			Ports:       dep.Ports,
+			Environment: dep.Env,
+			Volumes:     dep.Volumes,
+		}
+	}
+	return out, nil
+}
+
+// exportCompose writes the Compose file for artifacts to output ("-" for stdout).
+func exportCompose(cwd string, artifacts []util.Artifact, output string) error {
+	cfg, err := util.LoadRunConfig(cwd)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", util.RunConfigFilename, err)
+	}
+	compose, err := buildComposeFile(cwd, artifacts, cfg)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(compose)
+	if err != nil {
+		return fmt.Errorf("rendering compose file: %w", err)
+	}
+	if output == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if !filepath.IsAbs(output) {
+		output = filepath.Join(cwd, output)
+	}
+	if err := os.WriteFile(output, data, 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", output, err)
+	}
+	slog.Info("Wrote compose file", "file", output, "services", len(compose.Services))
+	return nil
+}
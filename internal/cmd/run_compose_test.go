@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestBuildComposeFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SKAFFOLD_DEFAULT_REPO", "localhost:5001")
+	artifacts := []util.Artifact{
+		{Image: "api", Context: "services/api"},
+		{Image: "web", Context: "web"},
+	}
+	cfg := &util.RunConfig{Contexts: map[string]util.ContextOpts{
+		"services/api": {
+			Ports:  []string{"8081:8080"},
+			Env:    map[string]string{"LOG_LEVEL": "debug"},
+			Memory: "512m",
+			Dependencies: map[string]util.DependencyOpts{
+				"postgres": {Image: "postgres:16", Ports: []string{"5432:5432"}},
+			},
+		},
+	}}
+
+	compose, err := buildComposeFile(dir, artifacts, cfg)
+	require.NoError(t, err)
+	require.Len(t, compose.Services, 3)
+
+	api := compose.Services["services-api"]
+	assert.Equal(t, "localhost:5001/api:latest", api.Image)
+	assert.Equal(t, []string{"8081:8080"}, api.Ports)
+	assert.Equal(t, "debug", api.Environment["LOG_LEVEL"])
+	assert.Equal(t, "512m", api.MemLimit)
+	assert.Equal(t, []string{"postgres"}, api.DependsOn)
+
+	web := compose.Services["web"]
+	assert.Equal(t, []string{"8080"}, web.Ports)
+	assert.Equal(t, "postgres:16", compose.Services["postgres"].Image)
+}
+
+func TestBuildComposeFile_InferredPorts(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SKAFFOLD_DEFAULT_REPO", "localhost:5001")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "web"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "web", "Dockerfile"), []byte("FROM node:20\nEXPOSE 3000 9229/tcp\n"), 0o644))
+
+	compose, err := buildComposeFile(dir, []util.Artifact{{Image: "web", Context: "web"}}, &util.RunConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3000", "9229"}, compose.Services["web"].Ports)
+	assert.Equal(t, "3000", compose.Services["web"].Environment["PORT"])
+}
+
+func TestBuildComposeFile_ConflictingDependency(t *testing.T) {
+	artifacts := []util.Artifact{{Image: "a", Context: "a"}, {Image: "b", Context: "b"}}
+	cfg := &util.RunConfig{Contexts: map[string]util.ContextOpts{
+		"a": {Dependencies: map[string]util.DependencyOpts{"db": {Image: "postgres:15"}}},
+		"b": {Dependencies: map[string]util.DependencyOpts{"db": {Image: "postgres:16"}}},
+	}}
+	_, err := buildComposeFile(t.TempDir(), artifacts, cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "db")
+}
+
+func TestRunCmd_ExportCompose(t *testing.T) {
+	dir := t.TempDir()
+	writeSkaffoldForRun(t, dir)
+	t.Setenv("SKAFFOLD_DEFAULT_REPO", "localhost:5001")
+
+	orig, _ := os.Getwd()
+	require.NoError(t, os.Chdir(dir))
+	defer func() { _ = os.Chdir(orig) }()
+
+	_ = runCmd.Flags().Set("skaffold-file", "skaffold.yaml")
+	runCmd.SetContext(t.Context())
+	require.NoError(t, runCmd.RunE(runCmd, []string{"export-compose"}))
+
+	data, err := os.ReadFile(filepath.Join(dir, "docker-compose.yaml"))
+	require.NoError(t, err)
+	var compose composeFile
+	require.NoError(t, yaml.Unmarshal(data, &compose))
+	assert.Equal(t, "localhost:5001/my-app:latest", compose.Services["app"].Image)
+}
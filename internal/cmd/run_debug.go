@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+)
+
+// inspectImageCommand returns the image's configured entrypoint followed by its cmd.
+// It is a var so tests can replace it without a Docker daemon.
+var inspectImageCommand = func(ctx context.Context, image string) ([]string, error) {
+	out, err := exec.CommandContext(ctx, util.ContainerCLI(), "image", "inspect", "--format", "{{json .Config}}", image).Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker image inspect %s: %w", image, err)
+	}
+	var cfg struct {
+		Entrypoint []string `json:"Entrypoint"`
+		Cmd        []string `json:"Cmd"`
+	}
+	if err := json.Unmarshal(out, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing image config for %s: %w", image, err)
+	}
+	return append(cfg.Entrypoint, cfg.Cmd...), nil
+}
+
+// inspectImageLabels returns the labels of a local image. It is a var so
+// tests can replace it without a Docker daemon.
+var inspectImageLabels = func(ctx context.Context, image string) (map[string]string, error) {
+	out, err := exec.CommandContext(ctx, util.ContainerCLI(), "image", "inspect", "--format", "{{json .Config.Labels}}", image).Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker image inspect %s: %w", image, err)
+	}
+	var labels map[string]string
+	if err := json.Unmarshal(out, &labels); err != nil {
+		return nil, fmt.Errorf("parsing image labels for %s: %w", image, err)
+	}
+	return labels, nil
+}
+
+// buildpackProcessCommand returns the command and arguments of the buildpack
+// process imageCmd starts: /cnb/process/<type>, or the default process when
+// the entrypoint is the launcher itself.
+func buildpackProcessCommand(ctx context.Context, image string, imageCmd []string) ([]string, error) {
+	labels, err := inspectImageLabels(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	var md struct {
+		Processes []struct {
+			Type    string   `json:"type"`
+			Command any      `json:"command"`
+			Args    []string `json:"args"`
+			Default bool     `json:"default"`
+		} `json:"processes"`
+	}
+	if err := json.Unmarshal([]byte(labels[buildpackBuildLabel]), &md); err != nil {
+		return nil, fmt.Errorf("parsing %s label of %s: %w", buildpackBuildLabel, image, err)
+	}
+	processType, isProcess := strings.CutPrefix(imageCmd[0], "/cnb/process/")
+	for _, p := range md.Processes {
+		if (isProcess && p.Type != processType) || (!isProcess && !p.Default) {
+			continue
+		}
+		// Platform API < 0.10 uses a string command, later versions a list.
+		var command []string
+		switch c := p.Command.(type) {
+		case string:
+			command = []string{c}
+		case []any:
+			for _, s := range c {
+				command = append(command, fmt.Sprint(s))
+			}
+		}
+		if len(command) > 0 {
+			return append(command, p.Args...), nil
+		}
+	}
+	return nil, fmt.Errorf("image %s has no buildpack process for %s to debug", image, strings.Join(imageCmd, " "))
+}
+
+// runDebugSetup is the docker run configuration for `op run --debug`.
+type runDebugSetup struct {
+	Options  util.DebugOptions
+	HostPort int
+	// Flags are docker run flags placed before the image reference.
+	Flags []string
+	// Command is placed after the image reference (entrypoint arguments).
+	Command []string
+}
+
+// prepareRunDebug resolves the debug runtime (explicit or inferred from
+// contextDir), publishes the debugger port on a free host port and, for
+// runtimes that wrap the process (delve), rewrites the entrypoint. Buildpack
+// images keep the launcher, which runs the debugger around the process
+// command with the app's environment.
+func prepareRunDebug(ctx context.Context, contextDir, runtime, image string) (*runDebugSetup, error) {
+	if runtime == "" {
+		runtime = util.InferDebugRuntime(contextDir)
+		if runtime == "" {
+			return nil, fmt.Errorf("could not infer debug runtime for %s — pass --debug-runtime (go, node, jvm)", contextDir)
+		}
+	}
+	opts, err := util.GetDebugOptions(runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	hostPort, err := util.FindFreePort(opts.Port, 100)
+	if err != nil {
+		return nil, fmt.Errorf("finding free debug port: %w", err)
+	}
+
+	setup := &runDebugSetup{Options: opts, HostPort: hostPort}
+	setup.Flags = append(setup.Flags, "-p", fmt.Sprintf("%d:%d", hostPort, opts.Port))
+	setup.Flags = append(setup.Flags, opts.DockerArgs...)
+
+	if opts.Entrypoint != "" {
+		imageCmd, err := inspectImageCommand(ctx, image)
+		if err != nil {
+			return nil, err
+		}
+		if len(imageCmd) == 0 {
+			return nil, fmt.Errorf("image %s has no entrypoint or cmd to debug", image)
+		}
+		if !isBuildpackCommand(imageCmd) {
+			setup.Flags = append(setup.Flags, "--entrypoint", opts.Entrypoint)
+			setup.Command = opts.WrapCommand(imageCmd)
+			return setup, nil
+		}
+		process, err := buildpackProcessCommand(ctx, image, imageCmd)
+		if err != nil {
+			return nil, err
+		}
+		setup.Flags = append(setup.Flags, "--entrypoint", buildpackLauncher)
+		setup.Command = append([]string{opts.Entrypoint}, opts.WrapCommand(process)...)
+	}
+	return setup, nil
+}
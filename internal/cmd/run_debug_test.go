@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareRunDebug_NodeInferred(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "package.json"), []byte("{}"), 0o644))
+
+	setup, err := prepareRunDebug(t.Context(), dir, "", "localhost:5001/web:latest")
+	require.NoError(t, err)
+	assert.Equal(t, "node", setup.Options.Runtime)
+	assert.GreaterOrEqual(t, setup.HostPort, 9229)
+	assert.Contains(t, setup.Flags, "-p")
+	assert.NotContains(t, setup.Flags, "--entrypoint")
+	assert.Empty(t, setup.Command)
+}
+
+func TestPrepareRunDebug_GoWrapsEntrypoint(t *testing.T) {
+	oldInspect := inspectImageCommand
+	inspectImageCommand = func(_ context.Context, image string) ([]string, error) {
+		assert.Equal(t, "localhost:5001/api:latest", image)
+		return []string{"/app/api"}, nil
+	}
+	defer func() { inspectImageCommand = oldInspect }()
+
+	setup, err := prepareRunDebug(t.Context(), t.TempDir(), "go", "localhost:5001/api:latest")
+	require.NoError(t, err)
+	assert.Contains(t, setup.Flags, "--entrypoint")
+	assert.Contains(t, setup.Flags, "--cap-add=SYS_PTRACE")
+	assert.Equal(t, "/app/api", setup.Command[len(setup.Command)-1])
+}
+
+func TestPrepareRunDebug_BuildpackUsesLauncher(t *testing.T) {
+	oldInspect, oldLabels := inspectImageCommand, inspectImageLabels
+	inspectImageCommand = func(context.Context, string) ([]string, error) {
+		return []string{"/cnb/process/web"}, nil
+	}
+	inspectImageLabels = func(context.Context, string) (map[string]string, error) {
+		return map[string]string{buildpackBuildLabel: `{"processes":[
+			{"type":"worker","command":["/workspace/bin/worker"]},
+			{"type":"web","command":["/workspace/bin/api"],"args":["--port","8080"],"default":true}]}`}, nil
+	}
+	defer func() { inspectImageCommand, inspectImageLabels = oldInspect, oldLabels }()
+
+	setup, err := prepareRunDebug(t.Context(), t.TempDir(), "go", "localhost:5001/api:latest")
+	require.NoError(t, err)
+	assert.Contains(t, setup.Flags, buildpackLauncher)
+	assert.Equal(t, "dlv", setup.Command[0])
+	assert.Equal(t, []string{"/workspace/bin/api", "--", "--port", "8080"}, setup.Command[len(setup.Command)-4:])
+
+	inspectImageCommand = func(context.Context, string) ([]string, error) {
+		return []string{"/cnb/process/cron"}, nil
+	}
+	_, err = prepareRunDebug(t.Context(), t.TempDir(), "go", "localhost:5001/api:latest")
+	assert.ErrorContains(t, err, "no buildpack process")
+}
+
+func TestPrepareRunDebug_UnknownRuntime(t *testing.T) {
+	_, err := prepareRunDebug(t.Context(), t.TempDir(), "", "img")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--debug-runtime")
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+)
+
+// runDependencies tracks the network and dependency containers started for a context.
+type runDependencies struct {
+	Network    string
+	Containers []string
+}
+
+// startRunDependencies creates a shared network for the context and starts each
+// dependency on it, reachable from the app by its key (network alias). Dependencies
+// are started in name order. On failure, anything already started is torn down.
+func startRunDependencies(ctx context.Context, contextName string, deps map[string]util.DependencyOpts) (*runDependencies, error) {
+	network := runContainerName(contextName)
+	if err := util.RunCommand(ctx, util.ContainerCLI(), "network", "create", network); err != nil {
+		// Most likely left over from a previous run; reuse it.
+		slog.Warn("Could not create network; reusing the existing one", "network", network, "error", err)
+	}
+	started := &runDependencies{Network: network}
+
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		dep := deps[name]
+		if dep.Image == "" {
+			started.Stop(ctx)
+			return nil, fmt.Errorf("dependency %q has no image", name)
+		}
+		containerName := fmt.Sprintf("%s-%s", network, name)
+		args := []string{"run", "-d", "--rm",
+			"--name", containerName,
+			"--network", network,
+			"--network-alias", name,
+		}
+		for _, p := range dep.Ports {
+			args = append(args, "-p", p)
+		}
+		envNames := make([]string, 0, len(dep.Env))
+		for k := range dep.Env {
+			envNames = append(envNames, k)
+		}
+		sort.Strings(envNames)
+		for _, k := range envNames {
+			args = append(args, "-e", fmt.Sprintf("%s=%s", k, dep.Env[k]))
+		}
+		for _, v := range dep.Volumes {
+			args = append(args, "-v", v)
+		}
+		args = append(args, dep.Image)
+
+		slog.Info("Starting dependency", "dependency", name, "image", dep.Image)
+		if err := util.RunCommand(ctx, util.ContainerCLI(), args...); err != nil {
+			started.Stop(ctx)
+			return nil, fmt.Errorf("starting dependency %s: %w", name, err)
+		}
+		started.Containers = append(started.Containers, containerName)
+	}
+	return started, nil
+}
+
+// Stop removes the dependency containers (in reverse start order) and the
+// network. It still runs when ctx has been cancelled (Ctrl+C).
+func (d *runDependencies) Stop(ctx context.Context) {
+	if d == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	for i := len(d.Containers) - 1; i >= 0; i-- {
+		_ = util.RunCommand(ctx, util.ContainerCLI(), "rm", "-f", d.Containers[i])
+	}
+	_ = util.RunCommand(ctx, util.ContainerCLI(), "network", "rm", d.Network)
+}
+
+// CleanupHint returns the commands to remove detached dependencies manually.
+func (d *runDependencies) CleanupHint() string {
+	hint := ""
+	for _, c := range d.Containers {
+		hint += fmt.Sprintf("  docker rm -f %s\n", c)
+	}
+	return hint + fmt.Sprintf("  docker network rm %s\n", d.Network)
+}
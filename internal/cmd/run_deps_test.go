@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartRunDependencies(t *testing.T) {
+	var commands []string
+	oldRun := util.RunCommandFn
+	util.RunCommandFn = func(_ context.Context, name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	defer func() { util.RunCommandFn = oldRun }()
+
+	deps, err := startRunDependencies(t.Context(), "api", map[string]util.DependencyOpts{
+		"redis":    {Image: "redis:7"},
+		"postgres": {Image: "postgres:16", Env: map[string]string{"POSTGRES_PASSWORD": "dev"}, Ports: []string{"5432:5432"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "op-run-api", deps.Network)
+	assert.Equal(t, []string{"op-run-api-postgres", "op-run-api-redis"}, deps.Containers)
+
+	require.Len(t, commands, 3)
+	assert.Equal(t, "docker network create op-run-api", commands[0])
+	assert.Equal(t, "docker run -d --rm --name op-run-api-postgres --network op-run-api --network-alias postgres "+
+		"-p 5432:5432 -e POSTGRES_PASSWORD=dev postgres:16", commands[1])
+	assert.Contains(t, commands[2], "--network-alias redis")
+
+	commands = nil
+	deps.Stop(t.Context())
+	assert.Equal(t, []string{
+		"docker rm -f op-run-api-redis",
+		"docker rm -f op-run-api-postgres",
+		"docker network rm op-run-api",
+	}, commands)
+}
+
+func TestStartRunDependencies_FailureTearsDown(t *testing.T) {
+	var commands []string
+	oldRun := util.RunCommandFn
+	util.RunCommandFn = func(_ context.Context, name string, args ...string) error {
+		cmd := name + " " + strings.Join(args, " ")
+		commands = append(commands, cmd)
+		if strings.Contains(cmd, "redis:7") {
+			return errors.New("pull failed")
+		}
+		return nil
+	}
+	defer func() { util.RunCommandFn = oldRun }()
+
+	_, err := startRunDependencies(t.Context(), "api", map[string]util.DependencyOpts{
+		"postgres": {Image: "postgres:16"},
+		"redis":    {Image: "redis:7"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "redis")
+	assert.Contains(t, commands, "docker rm -f op-run-api-postgres")
+	assert.Contains(t, commands, "docker network rm op-run-api")
+}
+
+func TestStartRunDependencies_MissingImage(t *testing.T) {
+	oldRun := util.RunCommandFn
+	util.RunCommandFn = func(context.Context, string, ...string) error { return nil }
+	defer func() { util.RunCommandFn = oldRun }()
+
+	_, err := startRunDependencies(t.Context(), "api", map[string]util.DependencyOpts{"db": {}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no image")
+}
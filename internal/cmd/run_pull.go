@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+)
+
+// Pull policies for `op run --pull`.
+const (
+	pullAlways  = "always"
+	pullMissing = "missing"
+	pullNever   = "never"
+)
+
+// imageExistsLocally reports whether image is present in the local Docker daemon.
+// It is a var so tests can replace it.
+var imageExistsLocally = func(ctx context.Context, image string) bool {
+	return exec.CommandContext(ctx, util.ContainerCLI(), "image", "inspect", image).Run() == nil
+}
+
+// pullImage pulls image (optionally for a specific platform) into the local
+// daemon. Podman skips TLS verification for insecure registries (see
+// util.RegistryEndpoints); Docker reads them from its daemon config.
+var pullImage = func(ctx context.Context, image, platform string) error {
+	args := []string{"pull"}
+	if platform != "" {
+		args = append(args, "--platform", platform)
+	}
+	if util.IsPodman() && util.ResolveRegistryEndpoints("", insecureRegistries("")).Insecure(image) {
+		args = append(args, "--tls-verify=false")
+	}
+	args = append(args, image)
+	return util.RunCommand(ctx, util.ContainerCLI(), args...)
+}
+
+// inspectImagePlatform returns the os/arch of a local image (e.g. "linux/amd64").
+var inspectImagePlatform = func(ctx context.Context, image string) (string, error) {
+	out, err := exec.CommandContext(ctx, util.ContainerCLI(), "image", "inspect", "--format", "{{.Os}}/{{.Architecture}}", image).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ensureRunImage applies the pull policy so that image is available locally
+// before docker run, turning the daemon's cryptic "not found" into an
+// actionable error.
+func ensureRunImage(ctx context.Context, image, policy, platform string) error {
+	switch policy {
+	case pullAlways:
+		if err := pullImage(ctx, image, platform); err != nil {
+			return fmt.Errorf("pulling %s: %w", image, err)
+		}
+	case pullMissing, "":
+		if imageExistsLocally(ctx, image) {
+			return nil
+		}
+		slog.Info("Image not found locally; pulling", "image", image)
+		if err := pullImage(ctx, image, platform); err != nil {
+			return fmt.Errorf("pulling %s: %w (build it with 'op build' or check registry access)", image, err)
+		}
+	case pullNever:
+		if !imageExistsLocally(ctx, image) {
+			return fmt.Errorf("image %s not found locally and --pull=never — build it first or use --pull=missing", image)
+		}
+	default:
+		return fmt.Errorf("invalid --pull value %q (expected %s, %s or %s)", policy, pullAlways, pullMissing, pullNever)
+	}
+	return nil
+}
+
+// emulationWarning returns a warning when imagePlatform (os/arch[/variant])
+// does not match the host architecture, i.e. the container will run under
+// emulation (e.g. amd64 images on Apple Silicon). Returns "" otherwise.
+func emulationWarning(imagePlatform, hostArch string) string {
+	parts := strings.Split(imagePlatform, "/")
+	if len(parts) < 2 || parts[1] == "" || parts[1] == hostArch {
+		return ""
+	}
+	return fmt.Sprintf("Warning: image platform %s does not match host architecture %s; the container will run under emulation (slow, and some software may crash). Build for linux/%s or pass --platform.",
+		imagePlatform, hostArch, hostArch)
+}
+
+// warnIfEmulated prints emulationWarning for a local image, using the
+// requested platform when set.
+func warnIfEmulated(ctx context.Context, image, platform string) {
+	if platform == "" {
+		var err error
+		if platform, err = inspectImagePlatform(ctx, image); err != nil {
+			return
+		}
+	}
+	if w := emulationWarning(platform, runtime.GOARCH); w != "" {
+		slog.Warn(w, util.LogKeyPlatform, platform)
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubPull(t *testing.T, exists bool, pullErr error) *[]string {
+	t.Helper()
+	var pulled []string
+
+	oldExists := imageExistsLocally
+	imageExistsLocally = func(context.Context, string) bool { return exists }
+	t.Cleanup(func() { imageExistsLocally = oldExists })
+
+	oldPull := pullImage
+	pullImage = func(_ context.Context, image, platform string) error {
+		pulled = append(pulled, image+"|"+platform)
+		return pullErr
+	}
+	t.Cleanup(func() { pullImage = oldPull })
+	return &pulled
+}
+
+func TestEnsureRunImage_Missing(t *testing.T) {
+	pulled := stubPull(t, true, nil)
+	require.NoError(t, ensureRunImage(t.Context(), "img:1", pullMissing, ""))
+	assert.Empty(t, *pulled)
+
+	pulled = stubPull(t, false, nil)
+	require.NoError(t, ensureRunImage(t.Context(), "img:1", pullMissing, "linux/amd64"))
+	assert.Equal(t, []string{"img:1|linux/amd64"}, *pulled)
+}
+
+func TestEnsureRunImage_Always(t *testing.T) {
+	pulled := stubPull(t, true, nil)
+	require.NoError(t, ensureRunImage(t.Context(), "img:1", pullAlways, ""))
+	assert.Len(t, *pulled, 1)
+}
+
+func TestEnsureRunImage_Never(t *testing.T) {
+	pulled := stubPull(t, false, nil)
+	err := ensureRunImage(t.Context(), "img:1", pullNever, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found locally")
+	assert.Empty(t, *pulled)
+}
+
+func TestEnsureRunImage_PullFailure(t *testing.T) {
+	stubPull(t, false, errors.New("denied"))
+	err := ensureRunImage(t.Context(), "img:1", pullMissing, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "denied")
+}
+
+func TestEnsureRunImage_InvalidPolicy(t *testing.T) {
+	stubPull(t, true, nil)
+	assert.Error(t, ensureRunImage(t.Context(), "img:1", "sometimes", ""))
+}
+
+func TestEmulationWarning(t *testing.T) {
+	assert.Empty(t, emulationWarning("linux/arm64", "arm64"))
+	assert.Empty(t, emulationWarning("", "arm64"))
+	assert.Contains(t, emulationWarning("linux/amd64", "arm64"), "emulation")
+	assert.Contains(t, emulationWarning("linux/arm/v7", "amd64"), "linux/amd64")
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// runResourceOptions are the resource limits and extra docker run arguments
+// for `op run`, from flags and the context's octopilot.yaml entry.
+type runResourceOptions struct {
+	CPUs       string
+	Memory     string
+	Network    string
+	AddHosts   []string
+	DockerArgs []string
+}
+
+// runResourceOptionsFromFlags reads --cpus, --memory, --network, --add-host
+// and --docker-arg.
+func runResourceOptionsFromFlags(cmd *cobra.Command) runResourceOptions {
+	var o runResourceOptions
+	o.CPUs, _ = cmd.Flags().GetString("cpus")
+	o.Memory, _ = cmd.Flags().GetString("memory")
+	o.Network, _ = cmd.Flags().GetString("network")
+	o.AddHosts, _ = cmd.Flags().GetStringArray("add-host")
+	o.DockerArgs, _ = cmd.Flags().GetStringArray("docker-arg")
+	return o
+}
+
+// mergeRunResources applies flags over the context config: scalar flags
+// replace configured values, list flags are appended to them.
+func mergeRunResources(ctxOpts util.ContextOpts, flags runResourceOptions) runResourceOptions {
+	merged := runResourceOptions{
+		CPUs:       ctxOpts.CPUs,
+		Memory:     ctxOpts.Memory,
+		Network:    ctxOpts.Network,
+		AddHosts:   append(append([]string{}, ctxOpts.AddHosts...), flags.AddHosts...),
+		DockerArgs: append(append([]string{}, ctxOpts.DockerArgs...), flags.DockerArgs...),
+	}
+	if flags.CPUs != "" {
+		merged.CPUs = flags.CPUs
+	}
+	if flags.Memory != "" {
+		merged.Memory = flags.Memory
+	}
+	if flags.Network != "" {
+		merged.Network = flags.Network
+	}
+	return merged
+}
+
+// dockerArgs returns the docker run flags for o, placed before the image.
+func (o runResourceOptions) dockerArgs() []string {
+	var args []string
+	if o.CPUs != "" {
+		args = append(args, "--cpus", o.CPUs)
+	}
+	if o.Memory != "" {
+		args = append(args, "--memory", o.Memory)
+	}
+	if o.Network != "" {
+		args = append(args, "--network", o.Network)
+	}
+	for _, h := range o.AddHosts {
+		args = append(args, "--add-host", h)
+	}
+	return append(args, o.DockerArgs...)
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeRunResources(t *testing.T) {
+	ctxOpts := util.ContextOpts{
+		CPUs:       "0.5",
+		Memory:     "256m",
+		AddHosts:   []string{"db.internal:10.0.0.5"},
+		DockerArgs: []string{"--read-only"},
+	}
+	merged := mergeRunResources(ctxOpts, runResourceOptions{
+		Memory:     "1g",
+		AddHosts:   []string{"api.internal:host-gateway"},
+		DockerArgs: []string{"--tmpfs=/tmp"},
+	})
+
+	assert.Equal(t, "0.5", merged.CPUs)
+	assert.Equal(t, "1g", merged.Memory)
+	assert.Equal(t, []string{
+		"--cpus", "0.5",
+		"--memory", "1g",
+		"--add-host", "db.internal:10.0.0.5",
+		"--add-host", "api.internal:host-gateway",
+		"--read-only", "--tmpfs=/tmp",
+	}, merged.dockerArgs())
+}
+
+func TestRunResourceOptions_Empty(t *testing.T) {
+	assert.Empty(t, mergeRunResources(util.ContextOpts{}, runResourceOptions{}).dockerArgs())
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// exportRunSecrets makes secret values available to the docker client through
+// its own environment and returns the sorted secret names. Containers then get
+// them with "-e NAME" (no value), so secrets never appear on the command line,
+// in the process list or in the printed docker command. Secrets replace any
+// plain env entry of the same name.
+func exportRunSecrets(secrets map[string]string, env map[string]string) ([]string, error) {
+	names := make([]string, 0, len(secrets))
+	for k, v := range secrets {
+		if err := os.Setenv(k, v); err != nil {
+			return nil, fmt.Errorf("exporting secret %s: %w", k, err)
+		}
+		delete(env, k)
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportRunSecrets(t *testing.T) {
+	t.Setenv("OP_TEST_SECRET_A", "")
+	t.Setenv("OP_TEST_SECRET_B", "")
+	env := map[string]string{"PORT": "8080", "OP_TEST_SECRET_A": "plain"}
+
+	names, err := exportRunSecrets(map[string]string{
+		"OP_TEST_SECRET_B": "b",
+		"OP_TEST_SECRET_A": "a",
+	}, env)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"OP_TEST_SECRET_A", "OP_TEST_SECRET_B"}, names)
+	assert.Equal(t, "a", os.Getenv("OP_TEST_SECRET_A"))
+	assert.Equal(t, map[string]string{"PORT": "8080"}, env)
+}
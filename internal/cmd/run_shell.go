@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// buildpackLauncher is the CNB lifecycle launcher set as the entrypoint of
+// buildpack-built images. Running a command through it sets up the same
+// environment (PATH, layer env vars) the app process gets.
+const buildpackLauncher = "/cnb/lifecycle/launcher"
+
+// isBuildpackCommand reports whether imageCmd (entrypoint and cmd) starts the
+// CNB launcher, i.e. the image was built with buildpacks.
+func isBuildpackCommand(imageCmd []string) bool {
+	return len(imageCmd) > 0 && strings.HasPrefix(imageCmd[0], "/cnb/")
+}
+
+// runShellWorkdir is where --mount-workspace mounts the context directory.
+const runShellWorkdir = "/workspace"
+
+// runShellEntrypoint returns the --entrypoint and arguments used by
+// `op run --shell` for an image whose configured command is imageCmd.
+// Buildpack images go through the launcher so the shell sees the app's
+// environment; everything else gets shell directly.
+func runShellEntrypoint(imageCmd []string, shell string) (string, []string) {
+	if isBuildpackCommand(imageCmd) {
+		return buildpackLauncher, []string{shell}
+	}
+	return shell, nil
+}
+
+// shellDockerArgs builds the docker run arguments for an interactive shell
+// in image. When workspace is set it is mounted at /workspace and used as the
+// working directory. extra is placed before the image reference.
+func shellDockerArgs(ctx context.Context, image, platform, shell string, env map[string]string, volumes []string, workspace string, extra []string) ([]string, error) {
+	imageCmd, err := inspectImageCommand(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	entrypoint, command := runShellEntrypoint(imageCmd, shell)
+
+	args := []string{"run", "--rm", "-it", "--entrypoint", entrypoint}
+	if platform != "" {
+		args = append(args, "--platform", platform)
+	}
+	for k, v := range env {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", k, v))
+	}
+	for _, v := range volumes {
+		args = append(args, "-v", v)
+	}
+	if workspace != "" {
+		args = append(args, "-v", workspace+":"+runShellWorkdir, "-w", runShellWorkdir)
+	}
+	args = append(args, extra...)
+	args = append(args, image)
+	return append(args, command...), nil
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunShellEntrypoint(t *testing.T) {
+	entrypoint, command := runShellEntrypoint([]string{"/app/api"}, "/bin/sh")
+	assert.Equal(t, "/bin/sh", entrypoint)
+	assert.Empty(t, command)
+
+	entrypoint, command = runShellEntrypoint([]string{"/cnb/process/web"}, "/bin/bash")
+	assert.Equal(t, buildpackLauncher, entrypoint)
+	assert.Equal(t, []string{"/bin/bash"}, command)
+}
+
+func TestShellDockerArgs(t *testing.T) {
+	oldInspect := inspectImageCommand
+	inspectImageCommand = func(context.Context, string) ([]string, error) {
+		return []string{"/cnb/lifecycle/launcher"}, nil
+	}
+	defer func() { inspectImageCommand = oldInspect }()
+
+	args, err := shellDockerArgs(t.Context(), "localhost:5001/api:latest", "linux/amd64", "/bin/sh",
+		map[string]string{"PORT": "8080"}, []string{"/data:/data"}, "/src/api", []string{"--memory", "512m"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"run", "--rm", "-it", "--entrypoint", buildpackLauncher, "--platform", "linux/amd64",
+		"-e", "PORT=8080", "-v", "/data:/data", "-v", "/src/api:/workspace", "-w", "/workspace", "--memory", "512m",
+		"localhost:5001/api:latest", "/bin/sh"}, args)
+}
@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -25,6 +28,14 @@ build:
 	require.NoError(t, os.WriteFile(filepath.Join(dir, "skaffold.yaml"), []byte(yaml), 0o644))
 }
 
+// stubContainerDaemon makes ensureContainerDaemon succeed without a daemon.
+func stubContainerDaemon(t *testing.T) {
+	t.Helper()
+	orig := ensureContainerDaemon
+	t.Cleanup(func() { ensureContainerDaemon = orig })
+	ensureContainerDaemon = func(*cobra.Command) error { return nil }
+}
+
 func TestResolveRunImage_FromBuildResult(t *testing.T) {
 	dir := t.TempDir()
 	data, _ := json.Marshal(util.BuildResult{Builds: []util.BuildEntry{
@@ -32,7 +43,8 @@ func TestResolveRunImage_FromBuildResult(t *testing.T) {
 	}})
 	require.NoError(t, os.WriteFile(filepath.Join(dir, util.BuildResultFilename), data, 0o644))
 
-	img := resolveRunImage(dir, "my-app")
+	img, err := resolveRunImage(dir, "my-app")
+	require.NoError(t, err)
 	assert.Equal(t, "ghcr.io/acme/my-app:v1@sha256:abc", img)
 }
 
@@ -40,7 +52,8 @@ func TestResolveRunImage_FallbackToDefault(t *testing.T) {
 	dir := t.TempDir()
 	t.Setenv("SKAFFOLD_DEFAULT_REPO", "localhost:5001")
 	// No build_result.json
-	img := resolveRunImage(dir, "my-app")
+	img, err := resolveRunImage(dir, "my-app")
+	require.NoError(t, err)
 	assert.Equal(t, "localhost:5001/my-app:latest", img)
 }
 
@@ -52,7 +65,8 @@ func TestResolveRunImage_BuildResultWrongImage(t *testing.T) {
 	require.NoError(t, os.WriteFile(filepath.Join(dir, util.BuildResultFilename), data, 0o644))
 
 	t.Setenv("SKAFFOLD_DEFAULT_REPO", "ghcr.io/acme")
-	img := resolveRunImage(dir, "my-app")
+	img, err := resolveRunImage(dir, "my-app")
+	require.NoError(t, err)
 	// my-app not found in build_result → falls back to default
 	assert.Equal(t, "ghcr.io/acme/my-app:latest", img)
 }
@@ -67,6 +81,7 @@ func TestRunCmd_ContextList(t *testing.T) {
 	defer func() { _ = os.Chdir(orig) }()
 
 	_ = runCmd.Flags().Set("skaffold-file", "skaffold.yaml")
+	runCmd.SetContext(t.Context())
 	err := runCmd.RunE(runCmd, []string{"context", "list"})
 	require.NoError(t, err)
 }
@@ -80,7 +95,58 @@ func TestRunCmd_UnknownContext(t *testing.T) {
 	defer func() { _ = os.Chdir(orig) }()
 
 	_ = runCmd.Flags().Set("skaffold-file", "skaffold.yaml")
+	runCmd.SetContext(t.Context())
 	err := runCmd.RunE(runCmd, []string{"nonexistent"})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "nonexistent")
 }
+
+func TestResolveRunImageSource(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SKAFFOLD_DEFAULT_REPO", "localhost:5001")
+
+	ref, fromResult, err := resolveRunImageSource(dir, "my-app")
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:5001/my-app:latest", ref)
+	assert.False(t, fromResult)
+
+	data, _ := json.Marshal(util.BuildResult{Builds: []util.BuildEntry{
+		{ImageName: "my-app", Tag: "ghcr.io/acme/my-app:v1@sha256:abc"},
+	}})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.BuildResultFilename), data, 0o644))
+	ref, fromResult, err = resolveRunImageSource(dir, "my-app")
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/acme/my-app:v1@sha256:abc", ref)
+	assert.True(t, fromResult)
+}
+
+func TestRunCmd_BuildsWhenImageMissing(t *testing.T) {
+	dir := t.TempDir()
+	writeSkaffoldForRun(t, dir)
+	t.Setenv("SKAFFOLD_DEFAULT_REPO", "localhost:5001")
+	stubContainerDaemon(t)
+
+	orig, _ := os.Getwd()
+	require.NoError(t, os.Chdir(dir))
+	defer func() { _ = os.Chdir(orig) }()
+
+	oldExists := imageExistsLocally
+	imageExistsLocally = func(context.Context, string) bool { return false }
+	defer func() { imageExistsLocally = oldExists }()
+
+	var builtTag string
+	oldBuild := buildRunArtifact
+	buildRunArtifact = func(_ context.Context, _ string, art util.Artifact, _ []util.Artifact, tag string) error {
+		assert.Equal(t, "my-app", art.Image)
+		builtTag = tag
+		return errors.New("stop after build")
+	}
+	defer func() { buildRunArtifact = oldBuild }()
+
+	_ = runCmd.Flags().Set("skaffold-file", "skaffold.yaml")
+	runCmd.SetContext(t.Context())
+	err := runCmd.RunE(runCmd, []string{"app"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stop after build")
+	assert.Equal(t, "localhost:5001/my-app:latest", builtTag)
+}
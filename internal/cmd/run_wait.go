@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+)
+
+// runWaitInterval is the time between readiness checks in `op run --wait`.
+// Reduced in tests to avoid sleeping.
+var runWaitInterval = time.Second
+
+// errContainerGone is returned by inspectContainerState for a container that
+// does not exist. op run starts containers with --rm, so one that exited is
+// gone.
+var errContainerGone = errors.New("no such container")
+
+// inspectContainerState returns the container status (running, exited, ...)
+// and its HEALTHCHECK status ("" when the image defines no health check).
+// It is a var so tests can replace it.
+var inspectContainerState = func(ctx context.Context, name string) (string, string, error) {
+	out, err := exec.CommandContext(ctx, util.ContainerCLI(), "inspect", "--format",
+		"{{.State.Status}} {{if .State.Health}}{{.State.Health.Status}}{{end}}", name).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && strings.Contains(strings.ToLower(string(exitErr.Stderr)), "no such") {
+			return "", "", errContainerGone
+		}
+		return "", "", err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", "", fmt.Errorf("unexpected docker inspect output %q", out)
+	}
+	health := ""
+	if len(fields) > 1 {
+		health = fields[1]
+	}
+	return fields[0], health, nil
+}
+
+// httpProbe reports whether url answers with a 2xx status.
+var httpProbe = func(url string) bool {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// waitForContainerReady polls until the container is ready or timeout elapses.
+// Containers with a Docker HEALTHCHECK are ready when healthy; otherwise the
+// inferred HTTP endpoint (url) must return 2xx. A container that exits or
+// reports unhealthy fails immediately. exited is closed when the docker run
+// process ends (nil for a detached container, which exists once docker run
+// returns); until then, or until the container has been seen, a missing
+// container is still being created.
+func waitForContainerReady(ctx context.Context, name, url string, timeout time.Duration, exited <-chan struct{}) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(runWaitInterval)
+	defer ticker.Stop()
+
+	exitedErr := fmt.Errorf("container %s exited before becoming ready", name)
+	seen := exited == nil
+	for {
+		select {
+		case <-exited:
+			return exitedErr
+		default:
+		}
+		state, health, err := inspectContainerState(ctx, name)
+		switch {
+		case errors.Is(err, errContainerGone):
+			if seen {
+				return exitedErr
+			}
+		case err == nil:
+			seen = true
+			switch {
+			case state == "exited" || state == "dead":
+				return exitedErr
+			case health == "unhealthy":
+				return fmt.Errorf("container %s reported unhealthy", name)
+			case health == "healthy":
+				return nil
+			case health == "" && state == "running" && httpProbe(url):
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out (%s) waiting for container %s to become ready at %s", timeout, name, url)
+		case <-exited:
+			return exitedErr
+		case <-ticker.C:
+		}
+	}
+}
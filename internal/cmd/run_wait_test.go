@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubContainerState(t *testing.T, states [][2]string, probeOK bool) {
+	t.Helper()
+	i := 0
+	oldInspect := inspectContainerState
+	inspectContainerState = func(context.Context, string) (string, string, error) {
+		s := states[i]
+		if i < len(states)-1 {
+			i++
+		}
+		if s[0] == "gone" {
+			return "", "", errContainerGone
+		}
+		return s[0], s[1], nil
+	}
+	t.Cleanup(func() { inspectContainerState = oldInspect })
+
+	oldProbe := httpProbe
+	httpProbe = func(_ string) bool { return probeOK }
+	t.Cleanup(func() { httpProbe = oldProbe })
+
+	oldInterval := runWaitInterval
+	runWaitInterval = time.Millisecond
+	t.Cleanup(func() { runWaitInterval = oldInterval })
+}
+
+func TestWaitForContainerReady_HealthCheck(t *testing.T) {
+	stubContainerState(t, [][2]string{{"running", "starting"}, {"running", "healthy"}}, false)
+	require.NoError(t, waitForContainerReady(t.Context(), "c", "http://localhost:8080/", time.Second, nil))
+}
+
+func TestWaitForContainerReady_HTTPProbe(t *testing.T) {
+	stubContainerState(t, [][2]string{{"running", ""}}, true)
+	require.NoError(t, waitForContainerReady(t.Context(), "c", "http://localhost:8080/", time.Second, nil))
+}
+
+func TestWaitForContainerReady_Unhealthy(t *testing.T) {
+	stubContainerState(t, [][2]string{{"running", "unhealthy"}}, true)
+	err := waitForContainerReady(t.Context(), "c", "http://localhost:8080/", time.Second, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unhealthy")
+}
+
+func TestWaitForContainerReady_Exited(t *testing.T) {
+	stubContainerState(t, [][2]string{{"exited", ""}}, false)
+	err := waitForContainerReady(t.Context(), "c", "http://localhost:8080/", time.Second, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exited")
+}
+
+func TestWaitForContainerReady_Timeout(t *testing.T) {
+	stubContainerState(t, [][2]string{{"running", ""}}, false)
+	err := waitForContainerReady(t.Context(), "c", "http://localhost:8080/", 20*time.Millisecond, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+}
+
+func TestWaitForContainerReady_Removed(t *testing.T) {
+	// op run uses --rm: an exited container is gone.
+	stubContainerState(t, [][2]string{{"gone", ""}, {"running", ""}, {"gone", ""}}, false)
+	exited := make(chan struct{})
+	err := waitForContainerReady(t.Context(), "c", "http://localhost:8080/", time.Second, exited)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exited before becoming ready")
+	assert.NotContains(t, err.Error(), "docker logs")
+
+	// Detached containers exist once docker run returns.
+	stubContainerState(t, [][2]string{{"gone", ""}}, false)
+	err = waitForContainerReady(t.Context(), "c", "http://localhost:8080/", time.Second, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exited before becoming ready")
+}
+
+func TestWaitForContainerReady_RunProcessExited(t *testing.T) {
+	stubContainerState(t, [][2]string{{"gone", ""}}, false)
+	exited := make(chan struct{})
+	close(exited)
+	start := time.Now()
+	err := waitForContainerReady(t.Context(), "c", "http://localhost:8080/", time.Minute, exited)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exited before becoming ready")
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/pack"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+)
+
+// runWatchInterval is the time between file-system polls in `op run --watch`.
+// Reduced in tests to avoid sleeping.
+var runWatchInterval = time.Second
+
+// buildRunArtifact builds a single Skaffold artifact into the local Docker daemon
+// (no push). Buildpack artifacts use the direct Pack integration; Docker artifacts
+// use docker build. It is a var so tests can replace it.
+var buildRunArtifact = func(ctx context.Context, cwd string, art util.Artifact, artifacts []util.Artifact, tag string) error {
+	contextDir := filepath.Join(cwd, art.Context)
+
+	if art.Buildpacks != nil {
+		packEnv := map[string]string{
+			"BP_GO_PRIVATE": "github.com/octopilot/*",
+		}
+		for _, env := range art.Buildpacks.Env {
+			parts := strings.SplitN(env, "=", 2)
+			if len(parts) == 2 {
+				packEnv[parts[0]] = parts[1]
+			}
+		}
+
+		// runImage may name another artifact in skaffold.yaml (e.g. a custom base image);
+		// resolve it the same way `op run` resolves images.
+		runImage := art.Buildpacks.RunImage
+		for _, other := range artifacts {
+			if other.Image == runImage {
+				var err error
+				if runImage, err = resolveRunImage(cwd, runImage); err != nil {
+					return err
+				}
+				break
+			}
+		}
+
+		po := pack.BuildOptions{
+			ImageName: tag,
+			Builder:   art.Buildpacks.Builder,
+			Path:      contextDir,
+			Publish:   false,
+			RunImage:  runImage,
+			Env:       packEnv,
+			Verbose:   util.Verbose(),
+			Quiet:     util.Quiet(),
+		}
+		if err := packBuild(ctx, po, os.Stdout); err != nil {
+			return fmt.Errorf("pack build failed for %s: %w", art.Image, err)
+		}
+		return nil
+	}
+
+	dockerfile := "Dockerfile"
+	if art.Docker != nil && art.Docker.Dockerfile != "" {
+		dockerfile = art.Docker.Dockerfile
+	}
+	if !filepath.IsAbs(dockerfile) {
+		dockerfile = filepath.Join(contextDir, dockerfile)
+	}
+	c := exec.CommandContext(ctx, util.ContainerCLI(), "build", "--tag", tag, "--file", dockerfile, contextDir)
+	c.Stdout = util.ProgressWriter(os.Stdout)
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("docker build failed for %s: %w", art.Image, err)
+	}
+	return nil
+}
+
+// startRunContainer starts `docker <args>` in the background and returns the process.
+var startRunContainer = func(ctx context.Context, args []string) (*exec.Cmd, error) {
+	slog.Info("Running command", "command", util.ContainerCLI(), "args", args)
+	c := exec.CommandContext(ctx, util.ContainerCLI(), args...)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// stopRunContainer force-removes the named container.
+var stopRunContainer = func(ctx context.Context, name string) error {
+	return exec.CommandContext(ctx, util.ContainerCLI(), "rm", "-f", name).Run()
+}
+
+var reContainerNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// runContainerName returns a stable docker container name for a Skaffold context.
+//
+//	"api"          → "op-run-api"
+//	"services/web" → "op-run-services-web"
+//	"."            → "op-run-root"
+func runContainerName(contextName string) string {
+	name := strings.Trim(reContainerNameInvalid.ReplaceAllString(contextName, "-"), "-.")
+	if name == "" {
+		name = "root"
+	}
+	return "op-run-" + name
+}
+
+// localRunImage is the tag used for images built locally by `op run`.
+// It is also the fallback used by resolveRunImage, so a plain `op run` picks it up.
+func localRunImage(cwd, imageName string) (string, error) {
+	repo, err := util.ResolveDefaultRepo(cwd)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s:latest", repo, imageName), nil
+}
+
+// runWatchLoop starts the container of the already built image and then polls
+// the context directory, rebuilding and restarting on every change until ctx is done.
+// dockerArgs must contain --name containerName and end with the image reference.
+func runWatchLoop(ctx context.Context, cwd string, art util.Artifact, artifacts []util.Artifact, image, containerName string, dockerArgs []string) error {
+	contextDir := filepath.Join(cwd, art.Context)
+
+	snap, err := util.SnapshotDir(contextDir)
+	if err != nil {
+		return fmt.Errorf("watching %s: %w", contextDir, err)
+	}
+	// Remove the container even after ctx is cancelled by Ctrl+C.
+	cleanupCtx := context.WithoutCancel(ctx)
+	var running *exec.Cmd
+	restart := func() error {
+		if running != nil {
+			_ = stopRunContainer(cleanupCtx, containerName)
+			_ = running.Wait()
+			running = nil
+		}
+		c, err := startRunContainer(ctx, dockerArgs)
+		if err != nil {
+			return fmt.Errorf("docker run failed: %w", err)
+		}
+		running = c
+		return nil
+	}
+	defer func() {
+		if running != nil {
+			_ = stopRunContainer(cleanupCtx, containerName)
+			_ = running.Wait()
+		}
+	}()
+
+	if err := restart(); err != nil {
+		return err
+	}
+	slog.Info("Watching for changes (Ctrl+C to stop)", "dir", contextDir)
+
+	ticker := time.NewTicker(runWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		next, err := util.SnapshotDir(contextDir)
+		if err != nil {
+			slog.Warn("Could not scan for changes", "dir", contextDir, "error", err)
+			continue
+		}
+		changed := snap.Diff(next)
+		if len(changed) == 0 {
+			continue
+		}
+		snap = next
+		slog.Info("Detected changes", "files", changed)
+
+		// Keep the previous container running when the rebuild fails so the
+		// developer can fix the error without losing the running app.
+		if err := buildRunArtifact(ctx, cwd, art, artifacts, image); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			slog.Error("Rebuild failed", "error", err)
+			continue
+		}
+		if err := restart(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunContainerName(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{"api", "op-run-api"},
+		{"services/web", "op-run-services-web"},
+		{".", "op-run-root"},
+		{"./app", "op-run-app"},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, runContainerName(tc.input), "input=%q", tc.input)
+	}
+}
+
+func TestRunWatchLoop_RebuildsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "app"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app", "main.go"), []byte("package main\n"), 0o644))
+
+	var mu sync.Mutex
+	builds, starts, stops := 0, 0, 0
+
+	oldBuild := buildRunArtifact
+	buildRunArtifact = func(_ context.Context, _ string, _ util.Artifact, _ []util.Artifact, tag string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "localhost:5001/my-app:latest", tag)
+		builds++
+		return nil
+	}
+	defer func() { buildRunArtifact = oldBuild }()
+
+	oldStart := startRunContainer
+	startRunContainer = func(context.Context, []string) (*exec.Cmd, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		starts++
+		c := exec.Command("true")
+		return c, c.Start()
+	}
+	defer func() { startRunContainer = oldStart }()
+
+	oldStop := stopRunContainer
+	stopRunContainer = func(_ context.Context, name string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "op-run-app", name)
+		stops++
+		return nil
+	}
+	defer func() { stopRunContainer = oldStop }()
+
+	oldInterval := runWatchInterval
+	runWatchInterval = 5 * time.Millisecond
+	defer func() { runWatchInterval = oldInterval }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	art := util.Artifact{Image: "my-app", Context: "app"}
+	done := make(chan error, 1)
+	go func() {
+		done <- runWatchLoop(ctx, dir, art, []util.Artifact{art}, "localhost:5001/my-app:latest", "op-run-app",
+			[]string{"run", "--rm", "--name", "op-run-app", "localhost:5001/my-app:latest"})
+	}()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return starts == 1
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app", "new.go"), []byte("package main\n"), 0o644))
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return starts == 2
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, builds) // the first build is the caller's
+	assert.Equal(t, 2, stops)  // one restart + final teardown
+}
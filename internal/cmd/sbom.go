@@ -0,0 +1,377 @@
+package cmd
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// buildpackMetadataLabel holds the lifecycle metadata of a buildpack image,
+// including the diff ID of the layer with the buildpack-generated SBOMs.
+const buildpackMetadataLabel = "io.buildpacks.lifecycle.metadata"
+
+// sbomFormats maps `op sbom generate --format` values to syft output formats
+// and file extensions.
+var sbomFormats = map[string]struct{ syft, ext string }{
+	"cyclonedx": {"cyclonedx-json", ".cdx.json"},
+	"spdx":      {"spdx-json", ".spdx.json"},
+	"syft":      {"syft-json", ".syft.json"},
+}
+
+// runSyft runs the syft CLI with extra environment. A var so tests can replace it.
+var runSyft = func(ctx context.Context, env []string, args ...string) error {
+	bin := os.Getenv("OP_SYFT")
+	if bin == "" {
+		bin = "syft"
+	}
+	c := exec.CommandContext(ctx, bin, args...)
+	c.Env = append(os.Environ(), env...)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// sbomFileName names the SBOM of digestRef: <image>-<first 12 digest hex chars><ext>.
+func sbomFileName(digestRef, ext string) string {
+	base := util.K8sName(digestRef)
+	if _, digest, ok := strings.Cut(digestRef, "@sha256:"); ok && len(digest) >= 12 {
+		base += "-" + digest[:12]
+	}
+	return base + ext
+}
+
+// syftArgs returns the syft arguments that scan digestRef straight from the
+// registry and write format to output ("-" for stdout).
+func syftArgs(digestRef, format, output string) []string {
+	out := sbomFormats[format].syft
+	if output != "-" {
+		out += "=" + output
+	}
+	return []string{"scan", "registry:" + digestRef, "-o", out}
+}
+
+// buildpackSBOMLayer returns the diff ID of the SBOM layer recorded in the
+// lifecycle metadata label of a buildpack image, or "" if there is none.
+func buildpackSBOMLayer(cfg *v1.ConfigFile) (string, error) {
+	label := cfg.Config.Labels[buildpackMetadataLabel]
+	if label == "" {
+		return "", nil
+	}
+	var md struct {
+		SBOM *struct {
+			SHA string `json:"sha"`
+		} `json:"sbom"`
+	}
+	if err := json.Unmarshal([]byte(label), &md); err != nil {
+		return "", fmt.Errorf("parsing %s label: %w", buildpackMetadataLabel, err)
+	}
+	if md.SBOM == nil {
+		return "", nil
+	}
+	return md.SBOM.SHA, nil
+}
+
+// extractBuildpackSBOMs copies the files under layers/sbom/ of the SBOM layer
+// of img into dir (keeping the <launch|build>/<buildpack>/... layout) and
+// returns the written paths.
+func extractBuildpackSBOMs(img v1.Image, dir string) ([]string, error) {
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	sha, err := buildpackSBOMLayer(cfg)
+	if err != nil || sha == "" {
+		return nil, err
+	}
+	diffID, err := v1.NewHash(sha)
+	if err != nil {
+		return nil, err
+	}
+	layer, err := img.LayerByDiffID(diffID)
+	if err != nil {
+		return nil, fmt.Errorf("SBOM layer %s: %w", sha, err)
+	}
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+
+	var written []string
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+		rel, ok := strings.CutPrefix(path.Clean("/"+hdr.Name), "/layers/sbom/")
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return written, err
+		}
+		f, err := os.Create(dst)
+		if err != nil {
+			return written, err
+		}
+		_, err = io.Copy(f, tr)
+		_ = f.Close()
+		if err != nil {
+			return written, err
+		}
+		written = append(written, dst)
+	}
+}
+
+// sbomExtension picks a file extension for an SBOM blob from its media or artifact type.
+func sbomExtension(mediaType string) string {
+	switch {
+	case strings.Contains(mediaType, "cyclonedx"):
+		return ".cdx.json"
+	case strings.Contains(mediaType, "spdx"):
+		return ".spdx.json"
+	case strings.Contains(mediaType, "syft"):
+		return ".syft.json"
+	}
+	return ".json"
+}
+
+// isSBOMArtifact reports whether a referrer's artifact type is an SBOM format.
+func isSBOMArtifact(artifactType string) bool {
+	t := strings.ToLower(artifactType)
+	return strings.Contains(t, "spdx") || strings.Contains(t, "cyclonedx") || strings.Contains(t, "sbom") || strings.Contains(t, "syft")
+}
+
+// downloadSBOMReferrers writes the layers of every SBOM referrer of d
+// (OCI 1.1 referrers API, or the fallback tag schema) into dir.
+func downloadSBOMReferrers(d name.Digest, dir string, opts ...remote.Option) ([]string, error) {
+	idx, err := remote.Referrers(d, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("listing referrers of %s: %w", d, err)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	var written []string
+	for _, desc := range manifest.Manifests {
+		if !isSBOMArtifact(desc.ArtifactType) {
+			continue
+		}
+		img, err := remote.Image(d.Context().Digest(desc.Digest.String()), opts...)
+		if err != nil {
+			return written, fmt.Errorf("fetching referrer %s: %w", desc.Digest, err)
+		}
+		layers, err := img.Layers()
+		if err != nil {
+			return written, err
+		}
+		for i, layer := range layers {
+			mt, _ := layer.MediaType()
+			ext := sbomExtension(string(mt))
+			if ext == ".json" {
+				ext = sbomExtension(desc.ArtifactType)
+			}
+			dst := filepath.Join(dir, "referrers", fmt.Sprintf("%s-%d%s", desc.Digest.Hex[:12], i, ext))
+			if err := writeLayerBlob(layer, dst); err != nil {
+				return written, err
+			}
+			written = append(written, dst)
+		}
+	}
+	return written, nil
+}
+
+func writeLayerBlob(layer v1.Layer, dst string) error {
+	rc, err := layer.Compressed()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	_, err = io.Copy(f, rc)
+	return err
+}
+
+// sbomTargets returns the digest refs to process: args, or every image in build_result.json.
+func sbomTargets(ctx context.Context, args []string, buildResultDir string, insecure []string) ([]string, error) {
+	refs := args
+	if len(refs) == 0 {
+		res, err := util.ReadBuildResult(buildResultDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range res.Builds {
+			refs = append(refs, b.Tag)
+		}
+	}
+	var digestRefs []string
+	for _, r := range refs {
+		ref, err := resolveDigestRef(ctx, r, insecure)
+		if err != nil {
+			return nil, err
+		}
+		digestRefs = append(digestRefs, ref)
+	}
+	return digestRefs, nil
+}
+
+var sbomCmd = &cobra.Command{
+	Use:   "sbom",
+	Short: "Generate or download SBOMs for built images.",
+}
+
+var sbomGenerateCmd = &cobra.Command{
+	Use:   "generate [ref...]",
+	Short: "Generate a CycloneDX or SPDX SBOM for images with syft.",
+	Long: `Generate an SBOM with syft for each ref (resolved to its digest), or for
+every image in build_result.json when no refs are given. The image is read
+from the registry, so it works for any built digest, Dockerfile or
+buildpack. Files are written to --output-dir as <image>-<digest>.cdx.json
+(or .spdx.json / .syft.json); --output-dir - writes to stdout. Requires the
+syft CLI (override with OP_SYFT).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		outDir, _ := cmd.Flags().GetString("output-dir")
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		f, ok := sbomFormats[format]
+		if !ok {
+			return fmt.Errorf("invalid --format %q (expected cyclonedx, spdx or syft)", format)
+		}
+		insecure := insecureRegistries(insecureFlag)
+		refs, err := sbomTargets(cmd.Context(), args, buildResultDir, insecure)
+		if err != nil {
+			return err
+		}
+		if outDir != "-" {
+			if err := os.MkdirAll(outDir, 0o755); err != nil {
+				return err
+			}
+		}
+		written := map[string]string{}
+		for _, ref := range refs {
+			output := "-"
+			if outDir != "-" {
+				output = filepath.Join(outDir, sbomFileName(ref, f.ext))
+			}
+			var env []string
+			if isInsecureRegistry(ref, insecure) {
+				env = append(env, "SYFT_REGISTRY_INSECURE_SKIP_TLS_VERIFY=true")
+			}
+			if err := runSyft(cmd.Context(), env, syftArgs(ref, format, output)...); err != nil {
+				return fmt.Errorf("syft scan %s: %w", ref, err)
+			}
+			if output != "-" {
+				slog.Info("Wrote SBOM", util.LogKeyTag, ref, "file", output)
+				written[ref] = output
+			}
+		}
+		if len(args) > 0 || len(written) == 0 {
+			return nil
+		}
+		// Record the SBOMs of the build_result.json images for later steps.
+		return updateBuildResult(buildResultDir, func(b *util.BuildEntry) {
+			ref, err := resolveDigestRef(cmd.Context(), b.Tag, insecure)
+			if out, ok := written[ref]; err == nil && ok && !slices.Contains(b.SBOM, out) {
+				b.SBOM = append(b.SBOM, out)
+			}
+		})
+	},
+}
+
+var sbomDownloadCmd = &cobra.Command{
+	Use:   "download [ref...]",
+	Short: "Download SBOMs attached to images in the registry.",
+	Long: `Download the SBOMs that already exist for each ref (resolved to its
+digest), or for every image in build_result.json when no refs are given:
+
+  - buildpack images: the SBOM layer written by the CNB lifecycle
+    (layers/sbom/<launch|build>/<buildpack>/...), recorded in the
+    io.buildpacks.lifecycle.metadata label;
+  - SBOM referrers (OCI 1.1 referrers API or the fallback tag schema),
+    e.g. attached with oras or cosign attach sbom.
+
+Files are written under --output-dir/<image>-<digest>/.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outDir, _ := cmd.Flags().GetString("output-dir")
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		insecure := insecureRegistries(insecureFlag)
+		refs, err := sbomTargets(cmd.Context(), args, buildResultDir, insecure)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			dir := filepath.Join(outDir, sbomFileName(ref, ""))
+			opts := remoteOptionsFor(cmd.Context(), ref, insecure)
+			parsed, err := parseReferenceForRemote(ref, insecure)
+			if err != nil {
+				return err
+			}
+			digest, ok := parsed.(name.Digest)
+			if !ok {
+				return fmt.Errorf("%s is not a digest reference", ref)
+			}
+			img, err := remoteImage(digest, opts...)
+			if err != nil {
+				return fmt.Errorf("fetching %s: %w", ref, err)
+			}
+			written, err := extractBuildpackSBOMs(img, dir)
+			if err != nil {
+				return fmt.Errorf("extracting buildpack SBOMs of %s: %w", ref, err)
+			}
+			referrers, err := downloadSBOMReferrers(digest, dir, opts...)
+			if err != nil {
+				return err
+			}
+			written = append(written, referrers...)
+			if len(written) == 0 {
+				slog.Warn("No SBOMs found (use op sbom generate)", util.LogKeyTag, ref)
+				continue
+			}
+			for _, p := range written {
+				slog.Info("Wrote SBOM", util.LogKeyTag, ref, "file", p)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sbomCmd)
+	for _, c := range []*cobra.Command{sbomGenerateCmd, sbomDownloadCmd} {
+		sbomCmd.AddCommand(c)
+		c.Flags().String("output-dir", "sbom", "Directory to write SBOMs to")
+		c.Flags().String("build-result-dir", "", "Directory containing build_result.json, used when no refs are given")
+		c.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+	}
+	sbomGenerateCmd.Flags().String("format", "cyclonedx", "SBOM format: cyclonedx, spdx or syft")
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSbomFileName(t *testing.T) {
+	assert.Equal(t, "app-4f53cda18c2b.cdx.json", sbomFileName("ghcr.io/org/app@"+testDigest, ".cdx.json"))
+}
+
+func TestSyftArgs(t *testing.T) {
+	ref := "ghcr.io/org/app@" + testDigest
+	assert.Equal(t, []string{"scan", "registry:" + ref, "-o", "cyclonedx-json=sbom/app.cdx.json"}, syftArgs(ref, "cyclonedx", "sbom/app.cdx.json"))
+	assert.Equal(t, []string{"scan", "registry:" + ref, "-o", "spdx-json"}, syftArgs(ref, "spdx", "-"))
+}
+
+func TestSbomGenerateCmd_RecordsSBOM(t *testing.T) {
+	old := runSyft
+	var scanned []string
+	runSyft = func(_ context.Context, env []string, args ...string) error {
+		scanned = append(scanned, args[1])
+		return nil
+	}
+	defer func() { runSyft = old }()
+	dir := t.TempDir()
+	writeBuildResultFile(t, dir, []util.BuildEntry{{ImageName: "app", Tag: "ghcr.io/org/app:v1@" + testDigest}})
+	outDir := filepath.Join(dir, "sbom")
+	_ = sbomGenerateCmd.Flags().Set("build-result-dir", dir)
+	_ = sbomGenerateCmd.Flags().Set("output-dir", outDir)
+	defer func() {
+		_ = sbomGenerateCmd.Flags().Set("build-result-dir", "")
+		_ = sbomGenerateCmd.Flags().Set("output-dir", "sbom")
+	}()
+
+	sbomGenerateCmd.SetContext(t.Context())
+	require.NoError(t, sbomGenerateCmd.RunE(sbomGenerateCmd, nil))
+	assert.Equal(t, []string{"registry:ghcr.io/org/app@" + testDigest}, scanned)
+	res, err := util.ReadBuildResult(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(outDir, "app-4f53cda18c2b.cdx.json")}, res.Builds[0].SBOM)
+}
+
+func TestBuildpackSBOMLayer(t *testing.T) {
+	cfg := &v1.ConfigFile{}
+	sha, err := buildpackSBOMLayer(cfg)
+	require.NoError(t, err)
+	assert.Empty(t, sha)
+
+	cfg.Config.Labels = map[string]string{buildpackMetadataLabel: `{"sbom":{"sha":"sha256:abc"}}`}
+	sha, err = buildpackSBOMLayer(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:abc", sha)
+
+	cfg.Config.Labels[buildpackMetadataLabel] = "{"
+	_, err = buildpackSBOMLayer(cfg)
+	assert.Error(t, err)
+}
+
+func TestExtractBuildpackSBOMs(t *testing.T) {
+	img, err := crane.Image(map[string][]byte{"workspace/bin/app": []byte("app")})
+	require.NoError(t, err)
+	sbomLayer, err := crane.Layer(map[string][]byte{
+		"layers/sbom/launch/paketo-buildpacks_go-build/sbom.cdx.json": []byte(`{"bomFormat":"CycloneDX"}`),
+		"layers/config/metadata.toml":                                 []byte("[[processes]]"),
+	})
+	require.NoError(t, err)
+	img, err = mutate.AppendLayers(img, sbomLayer)
+	require.NoError(t, err)
+	diffID, err := sbomLayer.DiffID()
+	require.NoError(t, err)
+	cfg, err := img.ConfigFile()
+	require.NoError(t, err)
+	cfg.Config.Labels = map[string]string{buildpackMetadataLabel: `{"sbom":{"sha":"` + diffID.String() + `"}}`}
+	img, err = mutate.ConfigFile(img, cfg)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	written, err := extractBuildpackSBOMs(img, dir)
+	require.NoError(t, err)
+	want := filepath.Join(dir, "launch", "paketo-buildpacks_go-build", "sbom.cdx.json")
+	assert.Equal(t, []string{want}, written)
+	data, err := os.ReadFile(want)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"bomFormat":"CycloneDX"}`, string(data))
+}
+
+func TestExtractBuildpackSBOMs_NoLabel(t *testing.T) {
+	img, err := crane.Image(map[string][]byte{"app": []byte("app")})
+	require.NoError(t, err)
+	written, err := extractBuildpackSBOMs(img, t.TempDir())
+	require.NoError(t, err)
+	assert.Empty(t, written)
+}
+
+func TestSbomExtension(t *testing.T) {
+	assert.Equal(t, ".cdx.json", sbomExtension("application/vnd.cyclonedx+json"))
+	assert.Equal(t, ".spdx.json", sbomExtension("application/spdx+json"))
+	assert.Equal(t, ".json", sbomExtension("application/json"))
+}
+
+func TestIsSBOMArtifact(t *testing.T) {
+	assert.True(t, isSBOMArtifact("application/vnd.cyclonedx+json"))
+	assert.True(t, isSBOMArtifact("application/spdx+json"))
+	assert.False(t, isSBOMArtifact("application/vnd.dev.cosign.artifact.sig.v1+json"))
+}
+
+func TestDownloadSBOMReferrers(t *testing.T) {
+	host := startTestRegistry(t)
+	img, err := crane.Image(map[string][]byte{"app": []byte("app")})
+	require.NoError(t, err)
+	tag, err := name.NewTag(host + "/app:v1")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(tag, img))
+	desc, err := partial.Descriptor(img)
+	require.NoError(t, err)
+
+	const sbomType = "application/vnd.cyclonedx+json"
+	artifact := mutate.ConfigMediaType(empty.Image, sbomType)
+	artifact, err = mutate.Append(artifact, mutate.Addendum{Layer: static.NewLayer([]byte(`{"bomFormat":"CycloneDX"}`), sbomType)})
+	require.NoError(t, err)
+	artifact = mutate.MediaType(artifact, types.OCIManifestSchema1)
+	withSubject, ok := mutate.Subject(artifact, *desc).(v1.Image)
+	require.True(t, ok)
+	artifactDigest, err := withSubject.Digest()
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(tag.Context().Digest(artifactDigest.String()), withSubject))
+
+	dir := t.TempDir()
+	written, err := downloadSBOMReferrers(tag.Context().Digest(desc.Digest.String()), dir)
+	require.NoError(t, err)
+	require.Len(t, written, 1)
+	assert.Equal(t, filepath.Join(dir, "referrers", artifactDigest.Hex[:12]+"-0.cdx.json"), written[0])
+	data, err := os.ReadFile(written[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"bomFormat":"CycloneDX"}`, string(data))
+}
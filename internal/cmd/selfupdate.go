@@ -0,0 +1,408 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// opReleaseRepo is the GitHub repository op releases are published to;
+// override with OP_RELEASE_REPO (e.g. for a fork or an internal mirror).
+func opReleaseRepo() string {
+	if r := os.Getenv("OP_RELEASE_REPO"); r != "" {
+		return r
+	}
+	return "octopilot/octopilot-pipeline-tools"
+}
+
+// opRelease is the subset of a GitHub release used by self-update.
+type opRelease struct {
+	TagName string           `json:"tag_name"`
+	HTMLURL string           `json:"html_url"`
+	Assets  []opReleaseAsset `json:"assets"`
+}
+
+type opReleaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// asset returns the download URL of the asset called name, or "".
+func (r *opRelease) asset(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+// fetchOpRelease returns the release for tag, or the latest release when tag
+// is empty. It is a var so tests can stub the GitHub API.
+var fetchOpRelease = func(tag string) (*opRelease, error) {
+	u := githubAPIURL() + "/repos/" + opReleaseRepo() + "/releases/latest"
+	if tag != "" {
+		u = githubAPIURL() + "/repos/" + opReleaseRepo() + "/releases/tags/" + url.PathEscape(tag)
+	}
+	var r opRelease
+	if err := githubRequest(http.MethodGet, u, "application/json", nil, githubToken(), http.StatusOK, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// downloadReleaseAsset fetches a release asset.
+var downloadReleaseAsset = func(rawURL string) ([]byte, error) {
+	resp, err := http.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// opBinaryAssetName is the release asset for this platform, e.g. op-linux-amd64.
+func opBinaryAssetName(goos, goarch string) string {
+	name := "op-" + goos + "-" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// updateAvailable compares the running version with a release tag. Versions
+// that do not parse (e.g. "dev" builds) never report an update.
+func updateAvailable(current, tag string) (semVersion, bool) {
+	latest, err := parseSemVersion(strings.TrimPrefix(tag, "v"))
+	if err != nil {
+		return semVersion{}, false
+	}
+	cur, err := parseSemVersion(strings.TrimPrefix(current, "v"))
+	if err != nil {
+		return latest, false
+	}
+	return latest, cur.less(latest)
+}
+
+// verifyChecksum checks data against its entry in a sha256sum-style
+// checksums.txt ("<hex>  <name>" per line).
+func verifyChecksum(checksums []byte, name string, data []byte) error {
+	sum := sha256.Sum256(data)
+	got := hex.EncodeToString(sum[:])
+	for _, line := range strings.Split(string(checksums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		if !strings.EqualFold(fields[0], got) {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, fields[0], got)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s is not listed in checksums.txt", name)
+}
+
+// cosignVerifyBlobArgs returns the cosign arguments that verify the keyless
+// Sigstore bundle of checksums.txt against the releasing workflow identity.
+func cosignVerifyBlobArgs(file, bundle, identityRegexp, issuer string) []string {
+	return []string{"verify-blob", "--bundle", bundle,
+		"--certificate-identity-regexp", identityRegexp,
+		"--certificate-oidc-issuer", issuer, file}
+}
+
+// replaceExecutable atomically replaces the binary at path with data: the new
+// binary is written next to it and renamed over it. On Windows the running
+// executable cannot be overwritten, so it is moved aside to <path>.old first.
+func replaceExecutable(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".op-update-*")
+	if err != nil {
+		return fmt.Errorf("cannot write next to %s (try sudo or --output): %w", path, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0o111); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		_ = os.Remove(path + ".old")
+		if err := os.Rename(path, path+".old"); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// selfUpdateOptions configures `op self-update`.
+type selfUpdateOptions struct {
+	Version          string
+	Check            bool
+	Force            bool
+	Output           string
+	RequireSignature bool
+	IdentityRegexp   string
+	OIDCIssuer       string
+}
+
+func runSelfUpdate(ctx context.Context, o selfUpdateOptions, w io.Writer) error {
+	rel, err := fetchOpRelease(o.Version)
+	if err != nil {
+		return fmt.Errorf("looking up release: %w", err)
+	}
+	latest, newer := updateAvailable(Version, rel.TagName)
+	if o.Check && newer {
+		fmt.Fprintf(w, "op %s is available (running %s): %s\n", latest, Version, rel.HTMLURL)
+		return nil
+	}
+	if o.Check || (!newer && !o.Force && o.Version == "") {
+		fmt.Fprintf(w, "op %s is up to date (latest release %s)\n", Version, rel.TagName)
+		return nil
+	}
+
+	name := opBinaryAssetName(runtime.GOOS, runtime.GOARCH)
+	binURL := rel.asset(name)
+	if binURL == "" {
+		return fmt.Errorf("release %s has no %s asset", rel.TagName, name)
+	}
+	sumsURL := rel.asset("checksums.txt")
+	if sumsURL == "" {
+		return fmt.Errorf("release %s has no checksums.txt; refusing to install an unverified binary", rel.TagName)
+	}
+	slog.Info("Downloading release", "asset", name, "release", rel.TagName)
+	data, err := downloadReleaseAsset(binURL)
+	if err != nil {
+		return err
+	}
+	sums, err := downloadReleaseAsset(sumsURL)
+	if err != nil {
+		return err
+	}
+	if err := verifySelfUpdateSignature(ctx, rel, sums, o); err != nil {
+		return err
+	}
+	if err := verifyChecksum(sums, name, data); err != nil {
+		return err
+	}
+	slog.Info("Checksum verified", "file", "checksums.txt")
+
+	target := o.Output
+	if target == "" {
+		if target, err = os.Executable(); err != nil {
+			return err
+		}
+		if target, err = filepath.EvalSymlinks(target); err != nil {
+			return err
+		}
+	} else if _, err := os.Stat(target); os.IsNotExist(err) {
+		if err := os.WriteFile(target, data, 0o755); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Wrote op %s to %s\n", rel.TagName, target)
+		return nil
+	}
+	if err := replaceExecutable(target, data); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Updated %s from %s to %s\n", target, Version, rel.TagName)
+	return nil
+}
+
+// cosignLookPath is exec.LookPath; a var so tests can control whether cosign
+// is installed.
+var cosignLookPath = exec.LookPath
+
+// verifySelfUpdateSignature checks checksums.txt against its Sigstore bundle
+// (checksums.txt.bundle) with cosign. Releases without a bundle, or hosts
+// without cosign, only warn unless signatures are required.
+func verifySelfUpdateSignature(ctx context.Context, rel *opRelease, sums []byte, o selfUpdateOptions) error {
+	bundleURL := rel.asset("checksums.txt.bundle")
+	if bundleURL == "" {
+		if o.RequireSignature {
+			return fmt.Errorf("release %s has no checksums.txt.bundle signature", rel.TagName)
+		}
+		slog.Warn("Release has no signature bundle; verifying the checksum only", "release", rel.TagName)
+		return nil
+	}
+	if _, err := cosignLookPath(cosignBinary()); err != nil {
+		if o.RequireSignature {
+			return fmt.Errorf("cosign is required to verify the release signature: %w", err)
+		}
+		slog.Warn("cosign not found; skipping signature verification")
+		return nil
+	}
+	bundle, err := downloadReleaseAsset(bundleURL)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "op-self-update-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	sumsFile := filepath.Join(dir, "checksums.txt")
+	bundleFile := sumsFile + ".bundle"
+	if err := os.WriteFile(sumsFile, sums, 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(bundleFile, bundle, 0o644); err != nil {
+		return err
+	}
+	if err := util.RunCommand(ctx, cosignBinary(), cosignVerifyBlobArgs(sumsFile, bundleFile, o.IdentityRegexp, o.OIDCIssuer)...); err != nil {
+		return fmt.Errorf("signature verification of checksums.txt failed: %w", err)
+	}
+	slog.Info("Signature verified", "file", "checksums.txt")
+	return nil
+}
+
+// updateCheckCache records the last update check so that a CI job running op
+// many times asks GitHub at most once per updateCheckInterval.
+type updateCheckCache struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Latest    string    `json:"latest"`
+}
+
+const updateCheckInterval = 24 * time.Hour
+
+// updateCheckTimeout bounds the GitHub lookup so a slow API never delays a
+// pipeline step noticeably.
+const updateCheckTimeout = 3 * time.Second
+
+func updateCheckCachePath() string {
+	return filepath.Join(os.TempDir(), "op-update-check.json")
+}
+
+// updateNoticeEnabled reports whether the "new version available" notice
+// runs: only in CI (see util.CIProvider), unless OP_NO_UPDATE_CHECK is set.
+func updateNoticeEnabled() bool {
+	if os.Getenv("OP_NO_UPDATE_CHECK") != "" {
+		return false
+	}
+	return util.CIProvider() != ""
+}
+
+// latestReleaseTagCached returns the latest release tag, from the cache when
+// it is fresh. Lookup errors and timeouts yield "" so the notice never fails
+// a command.
+func latestReleaseTagCached(now time.Time) string {
+	path := updateCheckCachePath()
+	var c updateCheckCache
+	if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &c) == nil && now.Sub(c.CheckedAt) < updateCheckInterval {
+		return c.Latest
+	}
+	result := make(chan *opRelease, 1)
+	go func() {
+		rel, err := fetchOpRelease("")
+		if err != nil {
+			rel = nil
+		}
+		result <- rel
+	}()
+	var rel *opRelease
+	select {
+	case rel = <-result:
+	case <-time.After(updateCheckTimeout):
+	}
+	if rel == nil {
+		return ""
+	}
+	c = updateCheckCache{CheckedAt: now, Latest: rel.TagName}
+	if data, err := json.Marshal(c); err == nil {
+		_ = os.WriteFile(path, data, 0o644)
+	}
+	return c.Latest
+}
+
+// printUpdateNotice writes a one-line notice when a newer op is released. In
+// GitHub Actions it is a ::notice:: annotation so it shows on the run summary
+// without cluttering the log.
+func printUpdateNotice(cmd *cobra.Command, w io.Writer) {
+	switch cmd.Name() {
+	case selfUpdateCmd.Name(), versionCmd.Name(), "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return
+	}
+	if cmd.Parent() != nil && cmd.Parent().Name() == "completion" {
+		return
+	}
+	if !updateNoticeEnabled() {
+		return
+	}
+	latest, newer := updateAvailable(Version, latestReleaseTagCached(time.Now()))
+	if !newer {
+		return
+	}
+	msg := fmt.Sprintf("op %s is available (running %s). Run 'op self-update' or bump the pinned op version.", latest, Version)
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		fmt.Fprintf(w, "::notice title=op update available::%s\n", msg)
+		return
+	}
+	fmt.Fprintf(w, "Notice: %s\n", msg)
+}
+
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Update op to the latest (or a given) release.",
+	Long: `Download the op binary for this platform from the GitHub releases of
+octopilot/octopilot-pipeline-tools (OP_RELEASE_REPO to override), verify it
+against the release's checksums.txt and, when the release carries a Sigstore
+bundle (checksums.txt.bundle) and cosign is installed, verify the signature
+of checksums.txt. The running binary is then replaced in place.
+
+--check only reports whether a newer release exists. --version installs a
+specific release tag (also older ones). --output writes the binary to another
+path instead of replacing the running one.
+
+In CI (GitHub Actions, GitLab CI, Azure Pipelines or CI set), every op command prints a one-line notice
+when a newer release is available, at most one GitHub lookup per day per
+runner. Set OP_NO_UPDATE_CHECK=1 to disable it.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		o := selfUpdateOptions{}
+		o.Version, _ = cmd.Flags().GetString("version")
+		o.Check, _ = cmd.Flags().GetBool("check")
+		o.Force, _ = cmd.Flags().GetBool("force")
+		o.Output, _ = cmd.Flags().GetString("output")
+		o.RequireSignature, _ = cmd.Flags().GetBool("require-signature")
+		o.IdentityRegexp, _ = cmd.Flags().GetString("certificate-identity-regexp")
+		o.OIDCIssuer, _ = cmd.Flags().GetString("certificate-oidc-issuer")
+		return runSelfUpdate(cmd.Context(), o, cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(selfUpdateCmd)
+	selfUpdateCmd.Flags().String("version", "", "Release tag to install (default: latest)")
+	selfUpdateCmd.Flags().Bool("check", false, "Only report whether a newer release is available")
+	selfUpdateCmd.Flags().Bool("force", false, "Reinstall even when already up to date")
+	selfUpdateCmd.Flags().StringP("output", "o", "", "Write the binary to this path instead of replacing the running op")
+	selfUpdateCmd.Flags().Bool("require-signature", false, "Fail unless the release signature can be verified with cosign")
+	selfUpdateCmd.Flags().String("certificate-identity-regexp", "^https://github.com/octopilot/", "Signature: regexp the signing workflow identity must match")
+	selfUpdateCmd.Flags().String("certificate-oidc-issuer", "https://token.actions.githubusercontent.com", "Signature: expected OIDC issuer")
+}
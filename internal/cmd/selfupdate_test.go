@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateAvailable(t *testing.T) {
+	latest, newer := updateAvailable("1.0.6", "v1.1.0")
+	assert.True(t, newer)
+	assert.Equal(t, "1.1.0", latest.String())
+	_, newer = updateAvailable("1.1.0", "v1.1.0")
+	assert.False(t, newer)
+	_, newer = updateAvailable("2.0.0", "1.9.9")
+	assert.False(t, newer)
+	_, newer = updateAvailable("dev", "v1.1.0")
+	assert.False(t, newer)
+	_, newer = updateAvailable("1.0.0", "nightly")
+	assert.False(t, newer)
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	data := []byte("binary")
+	sum := sha256.Sum256(data)
+	sums := []byte(hex.EncodeToString(sum[:]) + "  op-linux-amd64\n0000  op-darwin-arm64\n")
+	assert.NoError(t, verifyChecksum(sums, "op-linux-amd64", data))
+	assert.ErrorContains(t, verifyChecksum(sums, "op-darwin-arm64", data), "checksum mismatch")
+	assert.ErrorContains(t, verifyChecksum(sums, "op-windows-amd64.exe", data), "not listed")
+	assert.Equal(t, "op-windows-amd64.exe", opBinaryAssetName("windows", "amd64"))
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "op")
+	require.NoError(t, os.WriteFile(path, []byte("old"), 0o700))
+	require.NoError(t, replaceExecutable(path, []byte("new")))
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, "new", string(data))
+	info, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0o711), info.Mode().Perm())
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	assert.Len(t, entries, 1)
+}
+
+// stubOpRelease serves a release with a binary for this platform, its
+// checksums.txt and, when bundle is set, a signature bundle.
+func stubOpRelease(t *testing.T, tag string, binary []byte, bundle bool) {
+	t.Helper()
+	name := opBinaryAssetName(runtime.GOOS, runtime.GOARCH)
+	sum := sha256.Sum256(binary)
+	files := map[string][]byte{
+		"/" + name:              binary,
+		"/checksums.txt":        []byte(fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), name)),
+		"/checksums.txt.bundle": []byte("{}"),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	rel := &opRelease{TagName: tag, HTMLURL: "https://example.com/" + tag, Assets: []opReleaseAsset{
+		{Name: name, URL: srv.URL + "/" + name},
+		{Name: "checksums.txt", URL: srv.URL + "/checksums.txt"},
+	}}
+	if bundle {
+		rel.Assets = append(rel.Assets, opReleaseAsset{Name: "checksums.txt.bundle", URL: srv.URL + "/checksums.txt.bundle"})
+	}
+	orig := fetchOpRelease
+	fetchOpRelease = func(string) (*opRelease, error) { return rel, nil }
+	t.Cleanup(func() { fetchOpRelease = orig })
+}
+
+// captureSlog routes the default logger to a buffer for the test.
+func captureSlog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(old) })
+	return &buf
+}
+
+func TestRunSelfUpdate(t *testing.T) {
+	stubOpRelease(t, "v9.0.0", []byte("new-op"), false)
+	logs := captureSlog(t)
+	var out bytes.Buffer
+	require.NoError(t, runSelfUpdate(t.Context(), selfUpdateOptions{Check: true}, &out))
+	assert.Contains(t, out.String(), "op 9.0.0 is available")
+
+	target := filepath.Join(t.TempDir(), "op")
+	require.NoError(t, os.WriteFile(target, []byte("old-op"), 0o755))
+	out.Reset()
+	require.NoError(t, runSelfUpdate(t.Context(), selfUpdateOptions{Output: target}, &out))
+	data, _ := os.ReadFile(target)
+	assert.Equal(t, "new-op", string(data))
+	assert.Contains(t, logs.String(), "Release has no signature bundle")
+	assert.Contains(t, out.String(), "Updated "+target)
+	assert.NotContains(t, out.String(), "Downloading")
+
+	assert.ErrorContains(t, runSelfUpdate(t.Context(), selfUpdateOptions{Output: target, RequireSignature: true}, &out), "no checksums.txt.bundle")
+}
+
+func TestRunSelfUpdate_UpToDate(t *testing.T) {
+	stubOpRelease(t, "v"+Version, []byte("same"), false)
+	var out bytes.Buffer
+	require.NoError(t, runSelfUpdate(t.Context(), selfUpdateOptions{}, &out))
+	assert.Contains(t, out.String(), "is up to date")
+}
+
+func TestRunSelfUpdate_ChecksumMismatch(t *testing.T) {
+	stubOpRelease(t, "v9.0.0", []byte("new-op"), false)
+	orig := downloadReleaseAsset
+	downloadReleaseAsset = func(u string) ([]byte, error) {
+		data, err := orig(u)
+		if filepath.Base(u) == opBinaryAssetName(runtime.GOOS, runtime.GOARCH) {
+			data = []byte("tampered")
+		}
+		return data, err
+	}
+	defer func() { downloadReleaseAsset = orig }()
+	target := filepath.Join(t.TempDir(), "op")
+	require.NoError(t, os.WriteFile(target, []byte("old-op"), 0o755))
+	assert.ErrorContains(t, runSelfUpdate(t.Context(), selfUpdateOptions{Output: target}, &bytes.Buffer{}), "checksum mismatch")
+	data, _ := os.ReadFile(target)
+	assert.Equal(t, "old-op", string(data))
+}
+
+func TestRunSelfUpdate_Signature(t *testing.T) {
+	stubOpRelease(t, "v9.0.0", []byte("new-op"), true)
+	origLook, origRun := cosignLookPath, util.RunCommandFn
+	defer func() { cosignLookPath, util.RunCommandFn = origLook, origRun }()
+	cosignLookPath = func(string) (string, error) { return "/usr/bin/cosign", nil }
+	var cosignArgs []string
+	util.RunCommandFn = func(_ context.Context, name string, args ...string) error {
+		cosignArgs = args
+		return nil
+	}
+	target := filepath.Join(t.TempDir(), "op")
+	logs := captureSlog(t)
+	var out bytes.Buffer
+	require.NoError(t, runSelfUpdate(t.Context(), selfUpdateOptions{Output: target, IdentityRegexp: "^https://github.com/octopilot/", OIDCIssuer: "https://token.actions.githubusercontent.com"}, &out))
+	assert.Contains(t, logs.String(), "Signature verified")
+	assert.Contains(t, out.String(), "Wrote op v9.0.0 to "+target)
+	require.NotEmpty(t, cosignArgs)
+	assert.Equal(t, "verify-blob", cosignArgs[0])
+	assert.Contains(t, cosignArgs, "^https://github.com/octopilot/")
+
+	util.RunCommandFn = func(context.Context, string, ...string) error { return errors.New("bad signature") }
+	assert.ErrorContains(t, runSelfUpdate(t.Context(), selfUpdateOptions{Force: true, Output: target}, &out), "signature verification of checksums.txt failed")
+
+	cosignLookPath = func(string) (string, error) { return "", errors.New("not found") }
+	assert.ErrorContains(t, runSelfUpdate(t.Context(), selfUpdateOptions{Force: true, Output: target, RequireSignature: true}, &out), "cosign is required")
+}
+
+func TestPrintUpdateNotice(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv("OP_NO_UPDATE_CHECK", "")
+	t.Setenv("CI", "")
+	t.Setenv("GITHUB_ACTIONS", "true")
+	calls := 0
+	orig := fetchOpRelease
+	fetchOpRelease = func(string) (*opRelease, error) {
+		calls++
+		return &opRelease{TagName: "v99.0.0"}, nil
+	}
+	defer func() { fetchOpRelease = orig }()
+
+	var out bytes.Buffer
+	printUpdateNotice(buildCmd, &out)
+	assert.Contains(t, out.String(), "::notice title=op update available::op 99.0.0 is available")
+	printUpdateNotice(buildCmd, &out)
+	assert.Equal(t, 1, calls, "second check is served from the cache")
+
+	out.Reset()
+	printUpdateNotice(selfUpdateCmd, &out)
+	printUpdateNotice(&cobra.Command{Use: cobra.ShellCompRequestCmd}, &out)
+	assert.Empty(t, out.String())
+
+	t.Setenv("OP_NO_UPDATE_CHECK", "1")
+	printUpdateNotice(buildCmd, &out)
+	assert.Empty(t, out.String())
+}
+
+func TestLatestReleaseTagCached_Expired(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	orig := fetchOpRelease
+	defer func() { fetchOpRelease = orig }()
+	fetchOpRelease = func(string) (*opRelease, error) { return &opRelease{TagName: "v1.0.0"}, nil }
+	now := time.Now()
+	assert.Equal(t, "v1.0.0", latestReleaseTagCached(now))
+	fetchOpRelease = func(string) (*opRelease, error) { return &opRelease{TagName: "v2.0.0"}, nil }
+	assert.Equal(t, "v1.0.0", latestReleaseTagCached(now.Add(time.Hour)))
+	assert.Equal(t, "v2.0.0", latestReleaseTagCached(now.Add(25*time.Hour)))
+	fetchOpRelease = func(string) (*opRelease, error) { return nil, errors.New("offline") }
+	assert.Equal(t, "v2.0.0", latestReleaseTagCached(now.Add(26*time.Hour)))
+}
@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// cosignBinary is the cosign CLI; override with OP_COSIGN.
+func cosignBinary() string {
+	if bin := os.Getenv("OP_COSIGN"); bin != "" {
+		return bin
+	}
+	return "cosign"
+}
+
+// resolveDigestRef pins ref to its digest (registry/image@sha256:...) so
+// signatures are created and checked for exactly the pushed manifest.
+// Refs from build_result.json already carry a digest.
+func resolveDigestRef(ctx context.Context, ref string, insecure []string) (string, error) {
+	if strings.Contains(ref, "@sha256:") {
+		repo, digest, _ := strings.Cut(ref, "@")
+		// Drop the tag from registry/image:tag@digest; cosign wants one or the other.
+		if colon := strings.LastIndex(repo, ":"); colon > strings.LastIndex(repo, "/") {
+			repo = repo[:colon]
+		}
+		return repo + "@" + digest, nil
+	}
+	parsed, err := parseReferenceForRemote(ref, insecure)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s: %w", ref, err)
+	}
+	desc, err := remoteHead(ctx, parsed, remoteOptionsFor(ctx, ref, insecure)...)
+	if err != nil {
+		return "", fmt.Errorf("resolving digest of %s: %w", ref, err)
+	}
+	return parsed.Context().String() + "@" + desc.Digest.String(), nil
+}
+
+// cosignSignatureRef is the tag cosign stores the signature of digestRef
+// (registry/image@sha256:abc) under: registry/image:sha256-abc.sig.
+func cosignSignatureRef(digestRef string) string {
+	repo, digest, _ := strings.Cut(digestRef, "@")
+	return repo + ":" + strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// cosignSignOptions configures `op sign`.
+type cosignSignOptions struct {
+	// Key is a cosign key (file, KMS URI, ...); empty signs keyless with OIDC.
+	Key         string
+	Annotations []string
+	Insecure    bool
+}
+
+// cosignSignArgs returns the cosign arguments that sign digestRef.
+func cosignSignArgs(digestRef string, o cosignSignOptions) []string {
+	args := []string{"sign", "--yes"}
+	if o.Key != "" {
+		args = append(args, "--key", o.Key)
+	}
+	for _, a := range o.Annotations {
+		args = append(args, "-a", a)
+	}
+	if o.Insecure {
+		args = append(args, "--allow-insecure-registry")
+	}
+	return append(args, digestRef)
+}
+
+// cosignVerifyOptions configures `op verify`. Either Key or a certificate
+// identity and OIDC issuer (exact or regexp) are required.
+type cosignVerifyOptions struct {
+	Key              string
+	Identity         string
+	IdentityRegexp   string
+	OIDCIssuer       string
+	OIDCIssuerRegexp string
+	Insecure         bool
+}
+
+// validate rejects keyless verification without identity constraints, which
+// would accept a signature from anyone with a Sigstore certificate.
+func (o cosignVerifyOptions) validate() error {
+	if o.Key != "" {
+		return nil
+	}
+	if o.Identity == "" && o.IdentityRegexp == "" {
+		return fmt.Errorf("keyless verification requires --certificate-identity or --certificate-identity-regexp (or use --key)")
+	}
+	if o.OIDCIssuer == "" && o.OIDCIssuerRegexp == "" {
+		return fmt.Errorf("keyless verification requires --certificate-oidc-issuer or --certificate-oidc-issuer-regexp (or use --key)")
+	}
+	return nil
+}
+
+// cosignVerifyArgs returns the cosign arguments that verify digestRef.
+func cosignVerifyArgs(digestRef string, o cosignVerifyOptions) []string {
+	args := []string{"verify"}
+	if o.Key != "" {
+		args = append(args, "--key", o.Key)
+	}
+	for _, f := range []struct{ flag, val string }{
+		{"--certificate-identity", o.Identity},
+		{"--certificate-identity-regexp", o.IdentityRegexp},
+		{"--certificate-oidc-issuer", o.OIDCIssuer},
+		{"--certificate-oidc-issuer-regexp", o.OIDCIssuerRegexp},
+	} {
+		if f.val != "" {
+			args = append(args, f.flag, f.val)
+		}
+	}
+	if o.Insecure {
+		args = append(args, "--allow-insecure-registry")
+	}
+	return append(args, digestRef)
+}
+
+var signCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "Sign the images in build_result.json with cosign.",
+	Long: `Sign every image in build_result.json (or --image-name only) with cosign,
+by digest. With --key the given cosign key is used (file, KMS or
+Kubernetes secret URI); without it cosign signs keyless via Sigstore OIDC
+(e.g. GitHub Actions' id-token). Registry credentials come from the Docker
+config, and --insecure-registry / SKAFFOLD_INSECURE_REGISTRY are honoured as
+for op build. Requires the cosign CLI (override with OP_COSIGN).`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		imageName, _ := cmd.Flags().GetString("image-name")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		o := cosignSignOptions{}
+		o.Key, _ = cmd.Flags().GetString("key")
+		o.Annotations, _ = cmd.Flags().GetStringArray("annotation")
+
+		res, err := util.ReadBuildResult(buildResultDir)
+		if err != nil {
+			return err
+		}
+		insecure := insecureRegistries(insecureFlag)
+		signatures := map[string]string{}
+		for _, b := range res.Builds {
+			if imageName != "" && b.ImageName != imageName {
+				continue
+			}
+			ref, err := resolveDigestRef(cmd.Context(), b.Tag, insecure)
+			if err != nil {
+				return err
+			}
+			o.Insecure = isInsecureRegistry(ref, insecure)
+			slog.Info("Signing", util.LogKeyTag, ref)
+			if err := util.RunCommand(cmd.Context(), cosignBinary(), cosignSignArgs(ref, o)...); err != nil {
+				return util.WithExitCode(util.ExitPush, fmt.Errorf("cosign sign %s: %w", ref, err))
+			}
+			signatures[b.Tag] = cosignSignatureRef(ref)
+		}
+		if len(signatures) == 0 {
+			return fmt.Errorf("no images to sign (image name %q not in build_result.json?)", imageName)
+		}
+		return updateBuildResult(buildResultDir, func(b *util.BuildEntry) {
+			if sig, ok := signatures[b.Tag]; ok {
+				b.Signature = sig
+			}
+		})
+	},
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [ref...]",
+	Short: "Verify cosign signatures of image refs or the images in build_result.json.",
+	Long: `Verify the cosign signatures of the given image refs (tags are resolved to
+digests first), or of every image in build_result.json when no refs are
+given. Use --key for key-based signatures; keyless signatures require an
+identity constraint (--certificate-identity[-regexp]) and an issuer
+(--certificate-oidc-issuer[-regexp]), e.g. for GitHub Actions:
+
+  op verify ghcr.io/my-org/my-app:1.2.3 \
+    --certificate-identity-regexp '^https://github.com/my-org/' \
+    --certificate-oidc-issuer https://token.actions.githubusercontent.com`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		o := cosignVerifyOptions{}
+		o.Key, _ = cmd.Flags().GetString("key")
+		o.Identity, _ = cmd.Flags().GetString("certificate-identity")
+		o.IdentityRegexp, _ = cmd.Flags().GetString("certificate-identity-regexp")
+		o.OIDCIssuer, _ = cmd.Flags().GetString("certificate-oidc-issuer")
+		o.OIDCIssuerRegexp, _ = cmd.Flags().GetString("certificate-oidc-issuer-regexp")
+		if err := o.validate(); err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
+
+		refs := args
+		if len(refs) == 0 {
+			res, err := util.ReadBuildResult(buildResultDir)
+			if err != nil {
+				return err
+			}
+			for _, b := range res.Builds {
+				refs = append(refs, b.Tag)
+			}
+		}
+		insecure := insecureRegistries(insecureFlag)
+		for _, r := range refs {
+			ref, err := resolveDigestRef(cmd.Context(), r, insecure)
+			if err != nil {
+				return err
+			}
+			o.Insecure = isInsecureRegistry(ref, insecure)
+			slog.Info("Verifying signature", util.LogKeyTag, ref)
+			if err := util.RunCommand(cmd.Context(), cosignBinary(), cosignVerifyArgs(ref, o)...); err != nil {
+				return util.WithExitCode(util.ExitVerification, fmt.Errorf("signature verification failed for %s: %w", ref, err))
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(signCmd)
+	signCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json (default: current directory)")
+	signCmd.Flags().String("image-name", "", "Only sign this artifact (image name from build_result.json)")
+	_ = signCmd.RegisterFlagCompletionFunc("image-name", completeBuildResultImages)
+	signCmd.Flags().String("key", "", "Cosign private key (path, KMS or k8s:// URI); keyless when empty")
+	signCmd.Flags().StringArray("annotation", nil, "Signature annotation key=value (repeatable)")
+	signCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json, used when no refs are given")
+	verifyCmd.Flags().String("key", "", "Cosign public key (path, KMS or k8s:// URI)")
+	verifyCmd.Flags().String("certificate-identity", "", "Keyless: expected certificate identity (e.g. workflow URL)")
+	verifyCmd.Flags().String("certificate-identity-regexp", "", "Keyless: regexp the certificate identity must match")
+	verifyCmd.Flags().String("certificate-oidc-issuer", "", "Keyless: expected OIDC issuer")
+	verifyCmd.Flags().String("certificate-oidc-issuer-regexp", "", "Keyless: regexp the OIDC issuer must match")
+	verifyCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDigest = "sha256:4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945"
+
+func TestResolveDigestRef_BuildResultTag(t *testing.T) {
+	ref, err := resolveDigestRef(t.Context(), "localhost:5001/app:v1@"+testDigest, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:5001/app@"+testDigest, ref)
+}
+
+func TestResolveDigestRef_Tag(t *testing.T) {
+	old := remoteHead
+	remoteHead = func(_ context.Context, ref name.Reference, options ...remote.Option) (*v1.Descriptor, error) {
+		assert.Equal(t, "ghcr.io/org/app:1.2.3", ref.String())
+		h, err := v1.NewHash(testDigest)
+		return &v1.Descriptor{Digest: h}, err
+	}
+	defer func() { remoteHead = old }()
+
+	ref, err := resolveDigestRef(t.Context(), "ghcr.io/org/app:1.2.3", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/org/app@"+testDigest, ref)
+}
+
+func TestCosignSignArgs(t *testing.T) {
+	assert.Equal(t, []string{"sign", "--yes", "img@" + testDigest},
+		cosignSignArgs("img@"+testDigest, cosignSignOptions{}))
+	assert.Equal(t, []string{"sign", "--yes", "--key", "cosign.key", "-a", "git_sha=abc", "--allow-insecure-registry", "img@" + testDigest},
+		cosignSignArgs("img@"+testDigest, cosignSignOptions{Key: "cosign.key", Annotations: []string{"git_sha=abc"}, Insecure: true}))
+}
+
+func TestCosignSignatureRef(t *testing.T) {
+	assert.Equal(t, "ghcr.io/org/app:sha256-"+strings.TrimPrefix(testDigest, "sha256:")+".sig",
+		cosignSignatureRef("ghcr.io/org/app@"+testDigest))
+}
+
+func TestSignCmd_RecordsSignature(t *testing.T) {
+	t.Setenv("OP_COSIGN", "true")
+	dir := t.TempDir()
+	writeBuildResultFile(t, dir, []util.BuildEntry{{ImageName: "app", Tag: "ghcr.io/org/app:v1@" + testDigest}})
+	_ = signCmd.Flags().Set("build-result-dir", dir)
+	defer func() { _ = signCmd.Flags().Set("build-result-dir", "") }()
+
+	signCmd.SetContext(t.Context())
+	require.NoError(t, signCmd.RunE(signCmd, nil))
+	res, err := util.ReadBuildResult(dir)
+	require.NoError(t, err)
+	assert.Equal(t, cosignSignatureRef("ghcr.io/org/app@"+testDigest), res.Builds[0].Signature)
+}
+
+func TestCosignVerifyOptions_Validate(t *testing.T) {
+	assert.NoError(t, cosignVerifyOptions{Key: "cosign.pub"}.validate())
+	assert.ErrorContains(t, cosignVerifyOptions{}.validate(), "--certificate-identity")
+	assert.ErrorContains(t, cosignVerifyOptions{IdentityRegexp: ".*"}.validate(), "--certificate-oidc-issuer")
+	assert.NoError(t, cosignVerifyOptions{IdentityRegexp: "^https://github.com/org/", OIDCIssuer: "https://token.actions.githubusercontent.com"}.validate())
+}
+
+func TestCosignVerifyArgs(t *testing.T) {
+	args := cosignVerifyArgs("img@"+testDigest, cosignVerifyOptions{
+		IdentityRegexp: "^https://github.com/org/",
+		OIDCIssuer:     "https://token.actions.githubusercontent.com",
+	})
+	assert.Equal(t, []string{"verify",
+		"--certificate-identity-regexp", "^https://github.com/org/",
+		"--certificate-oidc-issuer", "https://token.actions.githubusercontent.com",
+		"img@" + testDigest}, args)
+}
@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// statusGetDeploymentImage and statusRegistryDigest are vars so tests can
+// replace them.
+var statusGetDeploymentImage = func(ctx context.Context, kubeContext, namespace, component string) (string, error) {
+	out, err := exec.CommandContext(ctx, "kubectl", withKubeContext(kubeContext,
+		"-n", namespace, "get", "deployment", component,
+		"-o", "jsonpath={.spec.template.spec.containers[0].image}")...).Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+var statusRegistryDigest = func(ctx context.Context, ref string, insecure []string) (string, error) {
+	parsed, err := parseReferenceForRemote(ref, insecure)
+	if err != nil {
+		return "", err
+	}
+	desc, err := remoteHead(ctx, parsed, remoteOptionsFor(ctx, ref, insecure)...)
+	if err != nil {
+		return "", err
+	}
+	return desc.Digest.String(), nil
+}
+
+// statusRow is the state of the image in one environment.
+type statusRow struct {
+	Environment string `json:"environment"`
+	// Deployed is the image the environment runs, read from Source (gitops
+	// or cluster); empty when unknown.
+	Deployed string `json:"deployed,omitempty"`
+	Source   string `json:"source,omitempty"`
+	// Registry is the environment's copy of the built tag; RegistryDigest
+	// is empty when it does not exist.
+	Registry       string `json:"registry,omitempty"`
+	RegistryDigest string `json:"registryDigest,omitempty"`
+	Status         string `json:"status"`
+	Error          string `json:"error,omitempty"`
+}
+
+// statusEnvironments returns the environments to report: flagEnvs, or dev,
+// pp, prod and the gitops environments of the project config.
+func statusEnvironments(cfg *util.RunConfig, flagEnvs []string) []string {
+	if len(flagEnvs) > 0 {
+		return flagEnvs
+	}
+	envs := append([]string{}, defaultEnvironments...)
+	var extra []string
+	for name := range cfg.GitOps.Environments {
+		known := false
+		for _, e := range envs {
+			known = known || e == name
+		}
+		if !known {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	return append(envs, extra...)
+}
+
+// statusEnvRef returns where the built tag is promoted to in envRepo, as
+// promote-image computes it: the path below the build repository (or below
+// the registry host) appended to envRepo, without digest.
+func statusEnvRef(fullRef, buildRepo, envRepo string) string {
+	ref := stripDigest(fullRef)
+	rel := ref
+	if buildRepo != "" && strings.HasPrefix(ref, strings.TrimSuffix(buildRepo, "/")+"/") {
+		rel = strings.TrimPrefix(ref, strings.TrimSuffix(buildRepo, "/")+"/")
+	} else if _, after, ok := strings.Cut(ref, "/"); ok {
+		rel = after
+	}
+	return strings.TrimSuffix(envRepo, "/") + "/" + rel
+}
+
+// sameImage reports whether deployed is the built image: the same digest
+// when both have one, else the same version tag.
+func sameImage(deployed, built string) bool {
+	_, deployedTag, deployedDigest := util.SplitImageRef(deployed)
+	_, builtTag, builtDigest := util.SplitImageRef(built)
+	if deployedDigest != "" && builtDigest != "" {
+		return deployedDigest == builtDigest
+	}
+	return deployedTag != "" && deployedTag == builtTag
+}
+
+// statusGitOps reads the images the gitops environments set, cloning each
+// repository and branch once.
+type statusGitOps struct {
+	cfg    *util.RunConfig
+	clones map[string]string
+}
+
+// deployedImage returns the image env sets for build entry imageName, or ""
+// when the environment has no gitops update for it.
+func (g *statusGitOps) deployedImage(ctx context.Context, env, imageName, builtRef string) (string, error) {
+	e, ok := g.cfg.GitOps.Environments[env]
+	if !ok {
+		return "", nil
+	}
+	for _, u := range e.Updates {
+		if u.Image != imageName {
+			continue
+		}
+		repo := firstNonEmpty(e.Repo, g.cfg.GitOps.Repo)
+		if repo == "" {
+			return "", fmt.Errorf("no gitops repository: set gitops.repo in %s", util.RunConfigFilename)
+		}
+		branch := firstNonEmpty(e.Branch, g.cfg.GitOps.Branch, "main")
+		key := repo + "#" + branch
+		dir, ok := g.clones[key]
+		if !ok {
+			var err error
+			if dir, err = os.MkdirTemp("", "op-status-"); err != nil {
+				return "", err
+			}
+			g.clones[key] = dir
+			token := githubToken()
+			if out, err := gitRun(ctx, "", "clone", "--depth", "1", "--branch", branch, authenticatedCloneURL(repo, token), dir); err != nil {
+				if token != "" {
+					out = strings.ReplaceAll(out, token, "***")
+				}
+				return "", fmt.Errorf("git clone %s: %s", repo, out)
+			}
+		}
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(u.File)))
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", u.File, err)
+		}
+		return util.ReadImageFromYAML(data, u, builtRef)
+	}
+	return "", nil
+}
+
+func (g *statusGitOps) cleanup() {
+	for _, dir := range g.clones {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// statusOptions configures collectStatus.
+type statusOptions struct {
+	Environments []string
+	Component    string
+	Namespace    string
+	// KubeContexts maps environments to kubeconfig contexts; only mapped
+	// environments are looked up in a cluster.
+	KubeContexts map[string]string
+	Insecure     []string
+}
+
+// collectStatus reports, per environment, what is deployed and whether the
+// built image (imageName, builtRef) is in the environment's registry.
+func collectStatus(ctx context.Context, cfg *util.RunConfig, imageName, builtRef string, o statusOptions) []statusRow {
+	g := &statusGitOps{cfg: cfg, clones: map[string]string{}}
+	defer g.cleanup()
+	buildRepo, buildRepoErr := util.GetWatchDestinationRepository("dev")
+
+	var rows []statusRow
+	for _, env := range statusEnvironments(cfg, o.Environments) {
+		row := statusRow{Environment: env}
+		var errs []string
+
+		if deployed, err := g.deployedImage(ctx, env, imageName, builtRef); err != nil {
+			errs = append(errs, err.Error())
+		} else if deployed != "" {
+			row.Deployed, row.Source = deployed, "gitops"
+		}
+		if kubeContext, ok := o.KubeContexts[env]; ok && row.Deployed == "" && o.Component != "" {
+			if deployed, err := statusGetDeploymentImage(ctx, kubeContext, o.Namespace, o.Component); err != nil {
+				errs = append(errs, fmt.Sprintf("kubectl (%s): %v", kubeContext, err))
+			} else if deployed != "" {
+				row.Deployed, row.Source = deployed, "cluster"
+			}
+		}
+
+		if envRepo, err := util.GetWatchDestinationRepository(env); err != nil {
+			errs = append(errs, err.Error())
+		} else if buildRepoErr != nil {
+			errs = append(errs, buildRepoErr.Error())
+		} else if envRepo != "" {
+			row.Registry = statusEnvRef(builtRef, buildRepo, envRepo)
+			// A missing tag is the expected answer before promotion.
+			row.RegistryDigest, _ = statusRegistryDigest(ctx, row.Registry, o.Insecure)
+		}
+
+		switch {
+		case row.Deployed == "":
+			row.Status = "unknown"
+		case sameImage(row.Deployed, builtRef):
+			row.Status = "current"
+		default:
+			row.Status = "different"
+		}
+		row.Error = strings.Join(errs, "; ")
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// registryState summarises the registry column for builtRef.
+func registryState(row statusRow, builtRef string) string {
+	_, _, builtDigest := util.SplitImageRef(builtRef)
+	switch {
+	case row.Registry == "":
+		return "-"
+	case row.RegistryDigest == "":
+		return "missing"
+	case builtDigest == "" || row.RegistryDigest == builtDigest:
+		return "present"
+	}
+	return "other digest"
+}
+
+// printStatus writes rows as a table.
+func printStatus(w io.Writer, builtRef string, rows []statusRow) {
+	fmt.Fprintf(w, "Built: %s\n\n", builtRef)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENVIRONMENT\tSTATUS\tDEPLOYED\tSOURCE\tREGISTRY")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Environment, r.Status, firstNonEmpty(r.Deployed, "-"), firstNonEmpty(r.Source, "-"), registryState(r, builtRef))
+	}
+	_ = tw.Flush()
+	for _, r := range rows {
+		if r.Error != "" {
+			fmt.Fprintf(w, "%s: %s\n", r.Environment, r.Error)
+		}
+	}
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show what is deployed in each environment compared with build_result.json.",
+	Long: `For each environment (dev, pp, prod and the gitops environments of
+.github/octopilot.yaml, or --environment), show:
+
+  - the deployed image: from the GitOps repository when the environment has a
+    gitops update for the image, else from the cluster for environments
+    mapped with --kube-context env=context (deployment --component);
+  - whether it is the image in build_result.json (same digest, or same tag);
+  - whether the built tag exists in the environment's repository (the
+    promote-image destination) with the built digest.
+
+  op status --component my-app --kube-context dev=gke-dev --kube-context prod=gke-prod`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cwd, _ := os.Getwd()
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		imageName, _ := cmd.Flags().GetString("image-name")
+		output, _ := cmd.Flags().GetString("output")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		o := statusOptions{}
+		o.Environments, _ = cmd.Flags().GetStringSlice("environment")
+		o.Component, _ = cmd.Flags().GetString("component")
+		o.Namespace, _ = cmd.Flags().GetString("namespace")
+		o.KubeContexts, _ = cmd.Flags().GetStringToString("kube-context")
+		o.Insecure = insecureRegistries(insecureFlag)
+		if output != "text" && output != "json" {
+			return fmt.Errorf("unknown output %q (expected text or json)", output)
+		}
+
+		cfg, err := util.LoadRunConfig(cwd)
+		if err != nil {
+			return err
+		}
+		res, err := util.ReadBuildResult(buildResultDir)
+		if err != nil {
+			return fmt.Errorf("reading build_result.json: %w", err)
+		}
+		builtRef, err := util.SelectTag(res, imageName)
+		if err != nil {
+			return fmt.Errorf("selecting image: %w", err)
+		}
+		if imageName == "" {
+			imageName = res.Builds[len(res.Builds)-1].ImageName
+		}
+
+		rows := collectStatus(cmd.Context(), cfg, imageName, builtRef, o)
+		if output == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(struct {
+				Image        string      `json:"image"`
+				Built        string      `json:"built"`
+				Environments []statusRow `json:"environments"`
+			}{imageName, builtRef, rows})
+		}
+		printStatus(os.Stdout, builtRef, rows)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().StringSlice("environment", nil, "Environments to show (default: dev, pp, prod and gitops environments)")
+	statusCmd.Flags().String("component", "", "Deployment name, for environments looked up in a cluster")
+	statusCmd.Flags().String("namespace", "default", "Kubernetes namespace of the deployment")
+	statusCmd.Flags().StringToString("kube-context", nil, "Look up an environment in a cluster: env=kubeconfig-context (repeatable)")
+	statusCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json (default: cwd)")
+	statusCmd.Flags().String("image-name", "", "Artifact to report (default: last entry in build_result.json)")
+	statusCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+	statusCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+	_ = statusCmd.RegisterFlagCompletionFunc("environment", completeEnvironments)
+	_ = statusCmd.RegisterFlagCompletionFunc("image-name", completeBuildResultImages)
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusEnvRef(t *testing.T) {
+	assert.Equal(t, "europe-docker.pkg.dev/prod/my-app:v2", statusEnvRef("ghcr.io/org/my-app:v2@"+testDigest, "ghcr.io/org", "europe-docker.pkg.dev/prod"))
+	assert.Equal(t, "ghcr.io/org/my-app:v2", statusEnvRef("ghcr.io/org/my-app:v2", "ghcr.io/org", "ghcr.io/org/"))
+	// Unknown build repository: keep the path below the registry host.
+	assert.Equal(t, "gcr.io/prod/org/my-app:v2", statusEnvRef("ghcr.io/org/my-app:v2", "", "gcr.io/prod"))
+}
+
+func TestSameImage(t *testing.T) {
+	assert.True(t, sameImage("r/app:v2", "ghcr.io/org/app:v2@"+testDigest))
+	assert.True(t, sameImage("other/app@"+testDigest, "ghcr.io/org/app:v2@"+testDigest))
+	assert.False(t, sameImage("r/app:v2@sha256:0000", "ghcr.io/org/app:v2@"+testDigest))
+	assert.False(t, sameImage("r/app", "ghcr.io/org/app:v2"))
+}
+
+func TestStatusEnvironments(t *testing.T) {
+	cfg := &util.RunConfig{}
+	cfg.GitOps.Environments = map[string]util.GitOpsEnvironment{"prod": {}, "staging": {}}
+	assert.Equal(t, []string{"dev", "pp", "prod", "staging"}, statusEnvironments(cfg, nil))
+	assert.Equal(t, []string{"qa"}, statusEnvironments(cfg, []string{"qa"}))
+}
+
+func TestStatusCmd(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	require.NoError(t, os.MkdirAll(".github", 0o755))
+	require.NoError(t, os.WriteFile(util.RunConfigFilename, []byte(`gitops:
+  repo: https://github.com/org/gitops.git
+  environments:
+    prod:
+      updates:
+        - file: prod/my-app.yaml
+          image: my-app
+`), 0o644))
+	require.NoError(t, os.WriteFile(util.BuildResultFilename, []byte(`{"builds":[{"imageName":"my-app","tag":"ghcr.io/org/my-app:v2@`+testDigest+`"}]}`), 0o644))
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "")
+	t.Setenv("WATCH_DESTINATION_REPOSITORY", "")
+	t.Setenv("GOOGLE_GKE_IMAGE_REPOSITORY", "ghcr.io/org")
+	t.Setenv("GOOGLE_GKE_IMAGE_PP_REPOSITORY", "europe-docker.pkg.dev/pp")
+	t.Setenv("GOOGLE_GKE_IMAGE_PROD_REPOSITORY", "europe-docker.pkg.dev/prod")
+
+	origGit, origKube, origDigest := gitRun, statusGetDeploymentImage, statusRegistryDigest
+	t.Cleanup(func() { gitRun, statusGetDeploymentImage, statusRegistryDigest = origGit, origKube, origDigest })
+	var clones int
+	gitRun = func(_ context.Context, _ string, args ...string) (string, error) {
+		clones++
+		dest := args[len(args)-1]
+		require.NoError(t, os.MkdirAll(filepath.Join(dest, "prod"), 0o755))
+		return "", os.WriteFile(filepath.Join(dest, "prod", "my-app.yaml"), []byte("spec:\n  values:\n    image:\n      repository: europe-docker.pkg.dev/prod/my-app\n      tag: v1\n"), 0o644)
+	}
+	statusGetDeploymentImage = func(_ context.Context, kubeContext, namespace, component string) (string, error) {
+		assert.Equal(t, "kind-dev", kubeContext)
+		assert.Equal(t, "my-app", component)
+		return "ghcr.io/org/my-app:v2", nil
+	}
+	statusRegistryDigest = func(_ context.Context, ref string, _ []string) (string, error) {
+		if ref == "europe-docker.pkg.dev/prod/my-app:v2" {
+			return "", errors.New("MANIFEST_UNKNOWN")
+		}
+		return testDigest, nil
+	}
+
+	cfg, err := util.LoadRunConfig(dir)
+	require.NoError(t, err)
+	rows := collectStatus(t.Context(), cfg, "my-app", "ghcr.io/org/my-app:v2@"+testDigest, statusOptions{
+		Component: "my-app", Namespace: "default", KubeContexts: map[string]string{"dev": "kind-dev"},
+	})
+	require.Len(t, rows, 3)
+	assert.Equal(t, 1, clones)
+	assert.Equal(t, statusRow{Environment: "dev", Deployed: "ghcr.io/org/my-app:v2", Source: "cluster", Registry: "ghcr.io/org/my-app:v2", RegistryDigest: testDigest, Status: "current"}, rows[0])
+	assert.Equal(t, "unknown", rows[1].Status)
+	assert.Equal(t, "europe-docker.pkg.dev/pp/my-app:v2", rows[1].Registry)
+	assert.Equal(t, statusRow{Environment: "prod", Deployed: "europe-docker.pkg.dev/prod/my-app:v1", Source: "gitops", Registry: "europe-docker.pkg.dev/prod/my-app:v2", Status: "different"}, rows[2])
+
+	var out bytes.Buffer
+	printStatus(&out, "ghcr.io/org/my-app:v2@"+testDigest, rows)
+	assert.Contains(t, out.String(), "ENVIRONMENT  STATUS     DEPLOYED")
+	assert.Contains(t, out.String(), "prod         different  europe-docker.pkg.dev/prod/my-app:v1  gitops   missing")
+	assert.Contains(t, out.String(), "pp           unknown    -                                     -        present")
+
+	_ = statusCmd.Flags().Set("output", "yaml")
+	defer func() { _ = statusCmd.Flags().Set("output", "text") }()
+	statusCmd.SetContext(t.Context())
+	assert.ErrorContains(t, statusCmd.RunE(statusCmd, nil), `unknown output "yaml"`)
+}
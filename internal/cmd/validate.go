@@ -0,0 +1,378 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/config"
+	skaffoldlog "github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/output/log"
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/parser"
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/validation"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/octopilot/octopilot-pipeline-tools/pkg/pipeline"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// runConfigViperKeys are top-level .github/octopilot.yaml keys read through
+// viper rather than util.RunConfig.
+var runConfigViperKeys = []string{
+	"GOOGLE_GKE_IMAGE_REPOSITORY", "GOOGLE_GKE_IMAGE_PP_REPOSITORY", "GOOGLE_GKE_IMAGE_PROD_REPOSITORY",
+	"PROMOTE_SOURCE_REPOSITORY", "PROMOTE_DESTINATION_REPOSITORY", "WATCH_DESTINATION_REPOSITORY",
+	"SKAFFOLD_PROFILE", "SKAFFOLD_LABEL", "SKAFFOLD_NAMESPACE",
+}
+
+// skaffoldArtifactInfo is an artifact of skaffold.yaml with the location of
+// its buildpacks runImage.
+type skaffoldArtifactInfo struct {
+	Image    string
+	Context  string
+	RunImage *yaml.Node
+}
+
+// validateSkaffold parses file with Skaffold (schema, version upgrade and
+// Skaffold's own validation) and returns its artifacts.
+func validateSkaffold(ctx context.Context, file string) ([]skaffoldArtifactInfo, []util.ValidationIssue) {
+	rel := relPath(file)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, []util.ValidationIssue{{File: rel, Message: err.Error()}}
+	}
+	// Skaffold logs every located config field at info level.
+	skaffoldlog.SetLevel(skaffoldlog.WarnLevel)
+	set, err := parser.GetConfigSet(ctx, config.SkaffoldOptions{ConfigurationFile: file, Command: "build"})
+	if err != nil {
+		return nil, []util.ValidationIssue{{File: rel, Message: strings.TrimSpace(err.Error())}}
+	}
+	var issues []util.ValidationIssue
+	for _, e := range validation.ProcessToErrorWithLocation(set, validation.Options{}) {
+		issue := util.ValidationIssue{File: rel, Message: e.Error.Error()}
+		if e.Location != nil && e.Location.StartLine > 0 {
+			issue.Line, issue.Column = e.Location.StartLine, e.Location.StartColumn
+		}
+		issues = append(issues, issue)
+	}
+
+	var artifacts []skaffoldArtifactInfo
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			break
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		list := util.YAMLLookup(doc.Content[0], "build", "artifacts")
+		if list == nil || list.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, a := range list.Content {
+			info := skaffoldArtifactInfo{Context: "."}
+			if n := util.YAMLLookup(a, "image"); n != nil {
+				info.Image = n.Value
+			}
+			if n := util.YAMLLookup(a, "context"); n != nil {
+				info.Context = n.Value
+			}
+			info.RunImage = util.YAMLLookup(a, "buildpacks", "runImage")
+			artifacts = append(artifacts, info)
+		}
+	}
+	return artifacts, issues
+}
+
+// validateRegistryFile checks .registry against its schema, that each entry
+// is a repository reference (entries with $VARS are not checked) and that
+// branch rules are valid globs.
+func validateRegistryFile(file string, data []byte) []util.ValidationIssue {
+	rel := relPath(file)
+	root, issues := util.ValidateSchema(rel, data, util.RegistryFileType, "yaml")
+	if root == nil {
+		if len(issues) == 0 {
+			issues = append(issues, util.ValidationIssue{File: rel, Message: "empty file: set local and/or ci"})
+		}
+		return issues
+	}
+	var entries []*yaml.Node
+	addEntry := func(n *yaml.Node) {
+		if n.Kind != yaml.MappingNode {
+			entries = append(entries, n)
+			return
+		}
+		if branches := util.YAMLLookup(n, "branches"); branches != nil && branches.Kind == yaml.SequenceNode {
+			for _, b := range branches.Content {
+				if _, err := path.Match(b.Value, ""); err != nil {
+					issues = append(issues, util.IssueAt(rel, b, "invalid branch pattern %q: %v", b.Value, err))
+				}
+			}
+		}
+		reg := util.YAMLLookup(n, "registry")
+		if reg == nil {
+			issues = append(issues, util.IssueAt(rel, n, "registry entry without a registry"))
+			return
+		}
+		entries = append(entries, reg)
+	}
+	if n := util.YAMLLookup(root, "local"); n != nil {
+		addEntry(n)
+	}
+	for _, key := range []string{"ci", "destinations"} {
+		if n := util.YAMLLookup(root, key); n != nil && n.Kind == yaml.SequenceNode {
+			for _, e := range n.Content {
+				addEntry(e)
+			}
+		}
+	}
+	if n := util.YAMLLookup(root, "environments"); n != nil && n.Kind == yaml.MappingNode {
+		for i := 1; i < len(n.Content); i += 2 {
+			addEntry(n.Content[i])
+		}
+	}
+	if len(entries) == 0 && len(issues) == 0 {
+		issues = append(issues, util.IssueAt(rel, root, "no registries: set local, ci and/or environments"))
+	}
+	for _, n := range entries {
+		if n.Kind != yaml.ScalarNode || strings.Contains(n.Value, "$") {
+			continue
+		}
+		v := strings.TrimSuffix(n.Value, "/")
+		var err error
+		if strings.Contains(v, "/") {
+			_, err = name.NewRepository(v)
+		} else {
+			_, err = name.NewRegistry(v)
+		}
+		if err != nil {
+			issues = append(issues, util.IssueAt(rel, n, "invalid registry %q: %v", n.Value, err))
+		}
+	}
+	return issues
+}
+
+// validateRunConfigFile checks .github/octopilot.yaml against util.RunConfig
+// and that its contexts exist in skaffold.yaml. artifacts is nil when
+// skaffold.yaml could not be read.
+func validateRunConfigFile(file string, data []byte, artifacts []skaffoldArtifactInfo) []util.ValidationIssue {
+	rel := relPath(file)
+	root, issues := util.ValidateSchema(rel, data, reflect.TypeOf(util.RunConfig{}), "yaml", runConfigViperKeys...)
+	if root == nil {
+		return issues
+	}
+	if contexts := util.YAMLLookup(root, "contexts"); artifacts != nil && contexts != nil && contexts.Kind == yaml.MappingNode {
+		known := map[string]bool{}
+		var names []string
+		for _, a := range artifacts {
+			if !known[a.Context] {
+				known[a.Context] = true
+				names = append(names, a.Context)
+			}
+		}
+		for i := 0; i < len(contexts.Content); i += 2 {
+			key := contexts.Content[i]
+			if !known[key.Value] {
+				issues = append(issues, util.IssueAt(rel, key, "context %q is not an artifact context in skaffold.yaml (have: %s)", key.Value, strings.Join(names, ", ")))
+			}
+		}
+	}
+	if builds := util.YAMLLookup(root, "build", "artifacts"); artifacts != nil && builds != nil && builds.Kind == yaml.MappingNode {
+		known := map[string]bool{}
+		var names []string
+		for _, a := range artifacts {
+			known[a.Image] = true
+			names = append(names, a.Image)
+		}
+		for i := 0; i < len(builds.Content); i += 2 {
+			key := builds.Content[i]
+			if !known[key.Value] {
+				issues = append(issues, util.IssueAt(rel, key, "build artifact %q is not an image in skaffold.yaml (have: %s)", key.Value, strings.Join(names, ", ")))
+			}
+		}
+	}
+	if patterns := util.YAMLLookup(root, "build", "version_env", "suffix_patterns"); patterns != nil && patterns.Kind == yaml.SequenceNode {
+		for _, p := range patterns.Content {
+			if _, err := regexp.Compile(p.Value); err != nil {
+				issues = append(issues, util.IssueAt(rel, p, "invalid suffix pattern %q: %v", p.Value, err))
+			}
+		}
+	}
+	if envs := util.YAMLLookup(root, "gitops", "environments"); envs != nil && envs.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(envs.Content); i += 2 {
+			updates := util.YAMLLookup(envs.Content[i+1], "updates")
+			if updates == nil || updates.Kind != yaml.SequenceNode {
+				continue
+			}
+			for _, u := range updates.Content {
+				for _, required := range []string{"file", "image"} {
+					if n := util.YAMLLookup(u, required); n == nil || n.Value == "" {
+						issues = append(issues, util.IssueAt(rel, u, "gitops update in environment %q needs %s", envs.Content[i].Value, required))
+					}
+				}
+				if n := util.YAMLLookup(u, "type"); n != nil && n.Value != "helm" && n.Value != "kustomize" && n.Value != "yaml" {
+					issues = append(issues, util.IssueAt(rel, n, "unknown update type %q (expected helm, kustomize or yaml)", n.Value))
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// validateBuildResultFile checks build_result.json against util.BuildResult
+// and that every tag is a digest-pinned reference.
+func validateBuildResultFile(file string, data []byte) []util.ValidationIssue {
+	rel := relPath(file)
+	root, issues := util.ValidateSchema(rel, data, reflect.TypeOf(util.BuildResult{}), "json")
+	builds := util.YAMLLookup(root, "builds")
+	if builds == nil || builds.Kind != yaml.SequenceNode {
+		return issues
+	}
+	for _, b := range builds.Content {
+		if n := util.YAMLLookup(b, "imageName"); n == nil || n.Value == "" {
+			issues = append(issues, util.IssueAt(rel, b, "build entry needs imageName"))
+		}
+		n := util.YAMLLookup(b, "tag")
+		if n == nil {
+			issues = append(issues, util.IssueAt(rel, b, "build entry needs tag"))
+			continue
+		}
+		if _, err := name.NewDigest(n.Value); err != nil {
+			issues = append(issues, util.IssueAt(rel, n, "tag %q is not a digest-pinned reference (registry/image:tag@sha256:...): %v", n.Value, err))
+		}
+		if k := util.YAMLLookup(b, "kind"); k != nil && k.Value != pipeline.ArtifactKindImage && k.Value != pipeline.ArtifactKindChart {
+			issues = append(issues, util.IssueAt(rel, k, "kind %q must be %s or %s", k.Value, pipeline.ArtifactKindImage, pipeline.ArtifactKindChart))
+		}
+	}
+	return issues
+}
+
+// validateRunImages checks that every buildpacks runImage is another
+// artifact or an image in a registry (looked up unless offline).
+func validateRunImages(ctx context.Context, file string, artifacts []skaffoldArtifactInfo, offline bool, insecure []string) []util.ValidationIssue {
+	rel := relPath(file)
+	images := map[string]bool{}
+	for _, a := range artifacts {
+		images[a.Image] = true
+	}
+	var issues []util.ValidationIssue
+	for _, a := range artifacts {
+		n := a.RunImage
+		if n == nil || n.Value == "" || images[stripDigest(n.Value)] {
+			continue
+		}
+		ref, err := parseReferenceForRemote(n.Value, insecure)
+		if err != nil {
+			issues = append(issues, util.IssueAt(rel, n, "runImage %q of %s: %v", n.Value, a.Image, err))
+			continue
+		}
+		if offline {
+			continue
+		}
+		if _, err := remoteHead(ctx, ref, remoteOptionsFor(ctx, n.Value, insecure)...); err != nil {
+			issues = append(issues, util.IssueAt(rel, n, "runImage %q of %s is neither an artifact nor resolvable in its registry: %v", n.Value, a.Image, err))
+		}
+	}
+	return issues
+}
+
+// relPath shortens path relative to the working directory for messages.
+func relPath(path string) string {
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate skaffold.yaml, .registry, .github/octopilot.yaml and build_result.json.",
+	Long: `Check the op configuration files and report every problem with its
+file:line:column location:
+
+  skaffold.yaml           parsed and validated by Skaffold (schema and rules)
+  .registry               known fields, valid registry references
+  .github/octopilot.yaml  known fields and types, contexts exist in skaffold.yaml,
+                          complete gitops updates
+  build_result.json       known fields, digest-pinned tags
+
+Buildpacks runImages must be another artifact or exist in their registry
+(--offline only checks the reference). Files other than skaffold.yaml are
+skipped when absent. Exits non-zero when a problem is found.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		filename, _ := cmd.Flags().GetString("filename")
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		offline, _ := cmd.Flags().GetBool("offline")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(cwd, filename)
+		}
+		if buildResultDir == "" {
+			buildResultDir = cwd
+		}
+
+		artifacts, issues := validateSkaffold(cmd.Context(), filename)
+		issues = append(issues, validateRunImages(cmd.Context(), filename, artifacts, offline, insecureRegistries(insecureFlag))...)
+		checked := []string{relPath(filename)}
+		optional := []struct {
+			Path     string
+			Validate func(string, []byte) []util.ValidationIssue
+		}{
+			{filepath.Join(cwd, util.RegistryFilename), validateRegistryFile},
+			{filepath.Join(cwd, util.RunConfigFilename), func(f string, d []byte) []util.ValidationIssue {
+				return validateRunConfigFile(f, d, artifacts)
+			}},
+			{filepath.Join(buildResultDir, util.BuildResultFilename), validateBuildResultFile},
+		}
+		for _, o := range optional {
+			data, err := os.ReadFile(o.Path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			checked = append(checked, relPath(o.Path))
+			issues = append(issues, o.Validate(o.Path, data)...)
+		}
+
+		sort.SliceStable(issues, func(i, j int) bool {
+			if issues[i].File != issues[j].File {
+				return issues[i].File < issues[j].File
+			}
+			return issues[i].Line < issues[j].Line
+		})
+		for _, issue := range issues {
+			fmt.Println(issue)
+		}
+		if len(issues) > 0 {
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("%d problem(s) found", len(issues)))
+		}
+		fmt.Printf("OK: %s\n", strings.Join(checked, ", "))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.Flags().StringP("filename", "f", "skaffold.yaml", "Path to the Skaffold configuration file")
+	validateCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json (default: cwd)")
+	validateCmd.Flags().Bool("offline", false, "Do not look up runImages in their registries")
+	validateCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated (e.g. localhost:5001,myreg:5000). Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func issueStrings(issues []util.ValidationIssue) []string {
+	var s []string
+	for _, i := range issues {
+		s = append(s, i.String())
+	}
+	return s
+}
+
+func writeValidateSkaffold(t *testing.T, dir, runImage string) string {
+	t.Helper()
+	path := filepath.Join(dir, "skaffold.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`apiVersion: skaffold/v4beta1
+kind: Config
+build:
+  artifacts:
+    - image: app-base
+      context: base
+      docker:
+        dockerfile: Dockerfile
+    - image: app
+      context: app
+      buildpacks:
+        builder: ghcr.io/octopilot/builder-jammy-base:latest
+        runImage: `+runImage+`
+`), 0o644))
+	return path
+}
+
+func TestValidateSkaffold(t *testing.T) {
+	dir := t.TempDir()
+	path := writeValidateSkaffold(t, dir, "app-base")
+	artifacts, issues := validateSkaffold(t.Context(), path)
+	assert.Empty(t, issues)
+	require.Len(t, artifacts, 2)
+	assert.Equal(t, "base", artifacts[0].Context)
+	assert.Equal(t, "app-base", artifacts[1].RunImage.Value)
+	assert.Equal(t, 13, artifacts[1].RunImage.Line)
+	assert.Empty(t, validateRunImages(t.Context(), path, artifacts, false, nil))
+
+	require.NoError(t, os.WriteFile(path, []byte("apiVersion: skaffold/v4beta1\nkind: Config\nbuild:\n  artifactz: []\n"), 0o644))
+	_, issues = validateSkaffold(t.Context(), path)
+	require.Len(t, issues, 1)
+	assert.Contains(t, issues[0].Message, "artifactz")
+}
+
+func TestValidateRunImages(t *testing.T) {
+	host := startTestRegistry(t)
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, host+"/org/run:1"))
+	dir := t.TempDir()
+	insecure := []string{host}
+
+	path := writeValidateSkaffold(t, dir, host+"/org/run:1")
+	artifacts, _ := validateSkaffold(t.Context(), path)
+	assert.Empty(t, validateRunImages(t.Context(), path, artifacts, false, insecure))
+
+	path = writeValidateSkaffold(t, dir, host+"/org/missing:1")
+	artifacts, _ = validateSkaffold(t.Context(), path)
+	issues := validateRunImages(t.Context(), path, artifacts, false, insecure)
+	require.Len(t, issues, 1)
+	assert.Contains(t, issues[0].Message, "neither an artifact nor resolvable")
+	assert.Equal(t, 13, issues[0].Line)
+	assert.Empty(t, validateRunImages(t.Context(), path, artifacts, true, insecure))
+}
+
+func TestValidateRegistryFile(t *testing.T) {
+	assert.Empty(t, validateRegistryFile(".registry", []byte("local: localhost:5001\nci:\n  - ghcr.io/${GITHUB_REPOSITORY_OWNER}\n  - europe-docker.pkg.dev/proj/repo\n")))
+	assert.Equal(t, []string{
+		`.registry:2:1: unknown field "remote" in document root`,
+		`.registry:1:8: invalid registry "ghcr.io/My Org": repository can only contain the characters ` + "`abcdefghijklmnopqrstuvwxyz0123456789_-./`" + `: My Org`,
+	}, issueStrings(validateRegistryFile(".registry", []byte("local: ghcr.io/My Org\nremote: x\n"))))
+	assert.Equal(t, []string{".registry: empty file: set local and/or ci"}, issueStrings(validateRegistryFile(".registry", nil)))
+}
+
+func TestValidateRegistryFile_Entries(t *testing.T) {
+	assert.Empty(t, validateRegistryFile(".registry", []byte(`local: localhost:5001
+ci:
+  - registry: ghcr.io/acme
+    branches: [main, release/*]
+    events: [push]
+    platforms: [linux/amd64]
+  - registry.internal:5000/acme
+environments:
+  dev: europe-docker.pkg.dev/proj/dev
+  prod:
+    registry: europe-docker.pkg.dev/proj/prod
+    insecure: false
+`)))
+	assert.Equal(t, []string{
+		`.registry:4:15: ci[0].insecure: "maybe" is not a valid bool`,
+		`.registry:3:16: invalid branch pattern "release/[": syntax error in pattern`,
+		`.registry:5:5: registry entry without a registry`,
+		`.registry:7:9: invalid registry "gcr.io/Bad": repository can only contain the characters ` + "`abcdefghijklmnopqrstuvwxyz0123456789_-./`" + `: Bad`,
+	}, issueStrings(validateRegistryFile(".registry", []byte(`ci:
+  - registry: ghcr.io/acme
+    branches: ["release/["]
+    insecure: maybe
+  - events: [push]
+environments:
+  prod: gcr.io/Bad
+`))))
+}
+
+func TestValidateRunConfigFile(t *testing.T) {
+	artifacts := []skaffoldArtifactInfo{{Image: "app", Context: "app"}, {Image: "web", Context: "web"}}
+	data := []byte(`default_repo: localhost:5001
+PROMOTE_SOURCE_REPOSITORY: ghcr.io/org
+contexts:
+  app:
+    ports: ["8080:8080"]
+  api:
+    ports: ["8081:8080"]
+gitops:
+  environments:
+    dev:
+      updates:
+        - file: clusters/dev/hr.yaml
+          type: jsonnet
+        - image: app
+          file: x.yaml
+`)
+	assert.Equal(t, []string{
+		`.github/octopilot.yaml:6:3: context "api" is not an artifact context in skaffold.yaml (have: app, web)`,
+		`.github/octopilot.yaml:12:11: gitops update in environment "dev" needs image`,
+		`.github/octopilot.yaml:13:17: unknown update type "jsonnet" (expected helm, kustomize or yaml)`,
+	}, issueStrings(validateRunConfigFile(".github/octopilot.yaml", data, artifacts)))
+
+	// Without skaffold.yaml, contexts are not cross-checked.
+	assert.Len(t, validateRunConfigFile(".github/octopilot.yaml", data, nil), 2)
+}
+
+func TestValidateRunConfigFile_Build(t *testing.T) {
+	artifacts := []skaffoldArtifactInfo{{Image: "app", Context: "app"}, {Image: "web", Context: "web"}}
+	data := []byte(`build:
+  artifacts:
+    app:
+      env:
+        BP_GO_BUILD_FLAGS: -trimpath
+      platforms: [linux/amd64]
+      cache_image: ghcr.io/org/app-cache
+      annotations:
+        org.opencontainers.image.source: https://github.com/org/app
+      sbom: false
+    worker:
+      sbom: maybe
+  version_env:
+    vars: [VERSION]
+    suffix_patterns: ['-windows-', '(']
+`)
+	assert.Equal(t, []string{
+		`.github/octopilot.yaml:12:13: build.artifacts.worker.sbom: "maybe" is not a valid bool`,
+		`.github/octopilot.yaml:11:5: build artifact "worker" is not an image in skaffold.yaml (have: app, web)`,
+		".github/octopilot.yaml:15:36: invalid suffix pattern \"(\": error parsing regexp: missing closing ): `(`",
+	}, issueStrings(validateRunConfigFile(".github/octopilot.yaml", data, artifacts)))
+}
+
+func TestValidateBuildResultFile(t *testing.T) {
+	assert.Empty(t, validateBuildResultFile("build_result.json", []byte(`{"builds":[{"imageName":"app","tag":"ghcr.io/org/app:v1@`+testDigest+`"}]}`)))
+	issues := issueStrings(validateBuildResultFile("build_result.json", []byte("{\"builds\": [\n  {\"imageName\": \"app\", \"tag\": \"ghcr.io/org/app:v1\"},\n  {\"tag\": \"ghcr.io/org/web@"+testDigest+"\"}\n]}")))
+	require.Len(t, issues, 2)
+	assert.True(t, strings.HasPrefix(issues[0], `build_result.json:2:31: tag "ghcr.io/org/app:v1" is not a digest-pinned reference`), issues[0])
+	assert.Equal(t, "build_result.json:3:3: build entry needs imageName", issues[1])
+
+	issues = issueStrings(validateBuildResultFile("build_result.json", []byte(`{"schemaVersion":2,"builds":[{"imageName":"app","tag":"ghcr.io/org/app:v1@`+testDigest+`","kind":"helm"}]}`)))
+	require.Len(t, issues, 1)
+	assert.Contains(t, issues[0], `kind "helm" must be image or chart`)
+}
+
+func TestValidateCmd(t *testing.T) {
+	dir := t.TempDir()
+	writeValidateSkaffold(t, dir, "app-base")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".github"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.RunConfigFilename), []byte("contexts:\n  app:\n    ports: [\"8080:8080\"]\n"), 0o644))
+	cwd, _ := os.Getwd()
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+
+	validateCmd.SetContext(t.Context())
+	require.NoError(t, validateCmd.RunE(validateCmd, nil))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.RegistryFilename), []byte("locl: localhost:5001\n"), 0o644))
+	assert.EqualError(t, validateCmd.RunE(validateCmd, nil), "1 problem(s) found")
+}
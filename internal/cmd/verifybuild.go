@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/octopilot/octopilot-pipeline-tools/pkg/pipeline"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// verifyBuildEntry checks one build_result.json entry against the registry
+// and returns its problems: the digest must exist, the tag must still point
+// at it, and the image must cover platforms.
+func verifyBuildEntry(ctx context.Context, b util.BuildEntry, platforms []string, insecure []string) []string {
+	repo, tag, digest := util.SplitImageRef(b.Tag)
+	if digest == "" {
+		return []string{fmt.Sprintf("%s: no digest recorded", b.Tag)}
+	}
+	opts := remoteOptionsFor(ctx, b.Tag, insecure)
+	digestRef, err := parseReferenceForRemote(repo+"@"+digest, insecure)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", b.Tag, err)}
+	}
+	desc, err := remoteGet(ctx, digestRef, opts...)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: digest %s not found: %v", b.ImageName, digest, err)}
+	}
+
+	var problems []string
+	if tag != "" {
+		tagRef, err := parseReferenceForRemote(repo+":"+tag, insecure)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", b.Tag, err))
+		} else if head, err := remoteHead(ctx, tagRef, opts...); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: tag %s not found: %v", b.ImageName, tag, err))
+		} else if head.Digest.String() != digest {
+			problems = append(problems, fmt.Sprintf("%s: tag %s now points at %s, not the recorded %s", b.ImageName, tag, head.Digest, digest))
+		}
+	}
+
+	if len(platforms) == 0 {
+		return problems
+	}
+	found, err := descriptorPlatforms(desc)
+	if err != nil {
+		return append(problems, fmt.Sprintf("%s: %v", b.ImageName, err))
+	}
+	for _, want := range platforms {
+		p, err := v1.ParsePlatform(want)
+		if err != nil {
+			return append(problems, fmt.Sprintf("platform %q: %v", want, err))
+		}
+		ok := false
+		for _, f := range found {
+			ok = ok || f.Satisfies(*p)
+		}
+		if !ok {
+			var have []string
+			for _, f := range found {
+				have = append(have, f.String())
+			}
+			problems = append(problems, fmt.Sprintf("%s: platform %s missing (has %s)", b.ImageName, want, firstNonEmpty(strings.Join(have, ", "), "none")))
+		}
+	}
+	return problems
+}
+
+// descriptorPlatforms returns the platforms of an index's children,
+// attestation manifests aside, or the platform of an image's config.
+func descriptorPlatforms(desc *remote.Descriptor) ([]v1.Platform, error) {
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return nil, err
+		}
+		im, err := idx.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		var out []v1.Platform
+		for _, m := range im.Manifests {
+			if m.Platform != nil && !pipeline.IsAttestation(m) {
+				out = append(out, *m.Platform)
+			}
+		}
+		return out, nil
+	}
+	img, err := desc.Image()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if p := cfg.Platform(); p != nil {
+		return []v1.Platform{*p}, nil
+	}
+	return nil, nil
+}
+
+var verifyBuildCmd = &cobra.Command{
+	Use:   "verify-build",
+	Short: "Check that build_result.json still matches the registry.",
+	Long: `Replay build_result.json against the registry before promoting or deploying:
+every recorded digest must still exist, each version tag must still point
+at its recorded digest, and with --platform (or platforms in the config)
+each image must cover those platforms. Catches garbage-collected images and
+force-pushed tags early. All problems are listed before the command fails.
+
+  op verify-build --platform linux/amd64,linux/arm64`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
+		imageName, _ := cmd.Flags().GetString("image-name")
+		platformFlag, _ := cmd.Flags().GetString("platform")
+		insecureFlag, _ := cmd.Flags().GetString("insecure-registry")
+		platforms := viper.GetStringSlice("platforms")
+		if platformFlag != "" {
+			platforms = strings.Split(platformFlag, ",")
+		}
+
+		res, err := util.ReadBuildResult(buildResultDir)
+		if err != nil {
+			return err
+		}
+		insecure := insecureRegistries(insecureFlag)
+		var problems []string
+		checked := 0
+		for _, b := range res.Builds {
+			if imageName != "" && b.ImageName != imageName {
+				continue
+			}
+			checked++
+			p := verifyBuildEntry(cmd.Context(), b, platforms, insecure)
+			if len(p) == 0 {
+				fmt.Printf("ok  %s\n", b.Tag)
+			}
+			problems = append(problems, p...)
+		}
+		if checked == 0 {
+			return fmt.Errorf("image %q not found in build_result.json", imageName)
+		}
+		if len(problems) > 0 {
+			return util.WithExitCode(util.ExitVerification, fmt.Errorf("build_result.json does not match the registry:\n  %s", strings.Join(problems, "\n  ")))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyBuildCmd)
+	verifyBuildCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json (default: cwd)")
+	verifyBuildCmd.Flags().String("image-name", "", "Only verify this artifact (image name from build_result.json)")
+	verifyBuildCmd.Flags().String("platform", "", "Platforms every image must cover, comma-separated (default: platforms from the config)")
+	verifyBuildCmd.Flags().String("insecure-registry", "", "Registry host(s) to treat as insecure (self-signed TLS or HTTP). Comma-separated. Also set via SKAFFOLD_INSECURE_REGISTRY or SKAFFOLD_INSECURE_REGISTRIES.")
+	_ = verifyBuildCmd.RegisterFlagCompletionFunc("image-name", completeBuildResultImages)
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyBuildEntry(t *testing.T) {
+	host := startTestRegistry(t)
+	pushInspectImage(t, host+"/org/app:amd64", v1.Platform{OS: "linux", Architecture: "amd64"})
+	pushInspectImage(t, host+"/org/app:arm64", v1.Platform{OS: "linux", Architecture: "arm64"})
+	list, err := pushManifestList(host+"/org/app:v1", []string{host + "/org/app:amd64", host + "/org/app:arm64"}, types.DockerManifestList, nil, nil)
+	require.NoError(t, err)
+	entry := util.BuildEntry{ImageName: "app", Tag: host + "/org/app:v1@" + list.Digest}
+
+	assert.Empty(t, verifyBuildEntry(t.Context(), entry, []string{"linux/amd64", "linux/arm64"}, nil))
+	assert.Equal(t, []string{"app: platform linux/s390x missing (has linux/amd64, linux/arm64)"},
+		verifyBuildEntry(t.Context(), entry, []string{"linux/s390x"}, nil))
+
+	// Force-pushed tag.
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, host+"/org/app:v1"))
+	problems := verifyBuildEntry(t.Context(), entry, nil, nil)
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0], "app: tag v1 now points at sha256:")
+
+	problems = verifyBuildEntry(t.Context(), util.BuildEntry{ImageName: "app", Tag: host + "/org/app:v1@" + testDigest}, nil, nil)
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0], "app: digest "+testDigest+" not found")
+
+	assert.Equal(t, []string{"r/app:v1: no digest recorded"}, verifyBuildEntry(t.Context(), util.BuildEntry{ImageName: "app", Tag: "r/app:v1"}, nil, nil))
+}
+
+func TestVerifyBuildCmd(t *testing.T) {
+	host := startTestRegistry(t)
+	img := pushInspectImage(t, host+"/org/api:v1", v1.Platform{OS: "linux", Architecture: "amd64"})
+	d, err := img.Digest()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.BuildResultFilename), []byte(`{"builds":[
+		{"imageName":"api","tag":"`+host+`/org/api:v1@`+d.String()+`"},
+		{"imageName":"web","tag":"`+host+`/org/web:v1@`+testDigest+`"}]}`), 0o644))
+
+	_ = verifyBuildCmd.Flags().Set("build-result-dir", dir)
+	_ = verifyBuildCmd.Flags().Set("platform", "linux/amd64")
+	defer func() {
+		_ = verifyBuildCmd.Flags().Set("build-result-dir", "")
+		_ = verifyBuildCmd.Flags().Set("platform", "")
+		_ = verifyBuildCmd.Flags().Set("image-name", "")
+	}()
+	verifyBuildCmd.SetContext(t.Context())
+	err = verifyBuildCmd.RunE(verifyBuildCmd, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "web: digest "+testDigest+" not found")
+	assert.NotContains(t, err.Error(), "api:")
+
+	_ = verifyBuildCmd.Flags().Set("image-name", "api")
+	require.NoError(t, verifyBuildCmd.RunE(verifyBuildCmd, nil))
+	_ = verifyBuildCmd.Flags().Set("image-name", "db")
+	assert.ErrorContains(t, verifyBuildCmd.RunE(verifyBuildCmd, nil), `image "db" not found`)
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+)
+
+// Policies of --version-tag-policy for a version tag that already exists
+// with another digest.
+const (
+	versionTagFail      = "fail"
+	versionTagSkip      = "skip"
+	versionTagOverwrite = "overwrite"
+)
+
+// versionTags holds the --version-tag-policy of the running build and the
+// version tags it pushed itself, which later steps (labels, eStargz) may
+// move whatever the policy.
+var versionTags struct {
+	sync.Mutex
+	policy string
+	pushed map[string]bool
+}
+
+// resetVersionTags starts a build with policy ("" chooses per version, see
+// versionTagPolicyFor).
+func resetVersionTags(policy string) error {
+	switch policy {
+	case "", versionTagFail, versionTagSkip, versionTagOverwrite:
+	default:
+		return fmt.Errorf("invalid --version-tag-policy %q (expected %s, %s or %s)", policy, versionTagFail, versionTagSkip, versionTagOverwrite)
+	}
+	versionTags.Lock()
+	defer versionTags.Unlock()
+	versionTags.policy = policy
+	versionTags.pushed = map[string]bool{}
+	return nil
+}
+
+// versionTagPolicyFor returns the policy for version: the one set by
+// resetVersionTags, else fail for release versions (1.2.3, v1.2.3-rc.1)
+// and overwrite for others (branch names, pr-12).
+func versionTagPolicyFor(version string) string {
+	versionTags.Lock()
+	policy := versionTags.policy
+	versionTags.Unlock()
+	if policy != "" {
+		return policy
+	}
+	if _, err := parseSemVersion(strings.TrimPrefix(version, "v")); err == nil {
+		return versionTagFail
+	}
+	return versionTagOverwrite
+}
+
+// pushCIVersionTag pushes fullTag as its version tag (see pushVersionTag)
+// unless the tag already holds another image this build did not push,
+// which the version tag policy then decides: fail, skip it or overwrite it.
+// It reports whether the tag was pushed.
+func pushCIVersionTag(ctx context.Context, fullTag, version string, insecure []string, opts []remote.Option) (bool, error) {
+	versionTag := strings.TrimSuffix(fullTag, "latest") + version
+	versionTags.Lock()
+	ours := versionTags.pushed[versionTag]
+	versionTags.Unlock()
+	if !ours {
+		existing, err := tagDigest(ctx, versionTag, insecure, opts)
+		if err != nil {
+			return false, util.WithExitCode(util.ExitPush, fmt.Errorf("checking version tag %s: %w", versionTag, err))
+		}
+		want, err := tagDigest(ctx, fullTag, insecure, opts)
+		if err != nil {
+			return false, util.WithExitCode(util.ExitPush, fmt.Errorf("checking %s: %w", fullTag, err))
+		}
+		if existing != "" && existing != want {
+			switch versionTagPolicyFor(version) {
+			case versionTagFail:
+				return false, util.WithExitCode(util.ExitPush, fmt.Errorf("version tag %s already exists with digest %s, not %s of this build; pass --version-tag-policy skip or overwrite to rerun a release", versionTag, existing, want))
+			case versionTagSkip:
+				slog.Warn("Version tag exists with another digest; not pushing it", util.LogKeyTag, versionTag, "digest", existing, "built", want)
+				return false, nil
+			default:
+				slog.Warn("Overwriting version tag", util.LogKeyTag, versionTag, "digest", existing, "built", want)
+			}
+		}
+	}
+	if err := pushVersionTag(ctx, fullTag, versionTag, insecure, opts); err != nil {
+		return false, err
+	}
+	versionTags.Lock()
+	defer versionTags.Unlock()
+	if versionTags.pushed == nil {
+		versionTags.pushed = map[string]bool{}
+	}
+	versionTags.pushed[versionTag] = true
+	return true, nil
+}
+
+// tagDigest returns the digest tag points to, or "" when it does not exist.
+func tagDigest(ctx context.Context, tag string, insecure []string, opts []remote.Option) (string, error) {
+	ref, err := parseReferenceForRemote(tag, insecure)
+	if err != nil {
+		return "", err
+	}
+	desc, err := remoteHead(ctx, ref, opts...)
+	if isNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return desc.Digest.String(), nil
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionTagPolicyFor(t *testing.T) {
+	require.NoError(t, resetVersionTags(""))
+	assert.Equal(t, versionTagFail, versionTagPolicyFor("v1.2.3"))
+	assert.Equal(t, versionTagFail, versionTagPolicyFor("1.2.3-rc.1"))
+	assert.Equal(t, versionTagOverwrite, versionTagPolicyFor("main"))
+	assert.Equal(t, versionTagOverwrite, versionTagPolicyFor("pr-12"))
+
+	require.NoError(t, resetVersionTags(versionTagSkip))
+	assert.Equal(t, versionTagSkip, versionTagPolicyFor("v1.2.3"))
+	assert.ErrorContains(t, resetVersionTags("keep"), `invalid --version-tag-policy "keep"`)
+}
+
+func TestPushCIVersionTag(t *testing.T) {
+	host := startTestRegistry(t)
+	latest := host + "/org/app:latest"
+	release := host + "/org/app:v1.2.3"
+	pushInspectImage(t, latest, v1.Platform{OS: "linux", Architecture: "amd64"})
+	built, err := tagDigest(t.Context(), latest, nil, remoteOptionsFor(t.Context(), latest, nil))
+	require.NoError(t, err)
+	push := func() (bool, error) {
+		return pushCIVersionTag(t.Context(), latest, "v1.2.3", nil, remoteOptionsFor(t.Context(), latest, nil))
+	}
+	digestOf := func(tag string) string {
+		d, err := tagDigest(t.Context(), tag, nil, remoteOptionsFor(t.Context(), tag, nil))
+		require.NoError(t, err)
+		return d
+	}
+
+	// A new tag, and a rerun of the same image, are pushed.
+	require.NoError(t, resetVersionTags(""))
+	pushed, err := push()
+	require.NoError(t, err)
+	assert.True(t, pushed)
+	require.NoError(t, resetVersionTags(""))
+	pushed, err = push()
+	require.NoError(t, err)
+	assert.True(t, pushed)
+
+	// The release tag of an earlier build is kept by default.
+	pushInspectImage(t, release, v1.Platform{OS: "linux", Architecture: "arm64"})
+	earlier := digestOf(release)
+	require.NoError(t, resetVersionTags(""))
+	_, err = push()
+	assert.ErrorContains(t, err, "version tag "+release+" already exists with digest "+earlier)
+	assert.Equal(t, util.ExitPush, util.ExitCode(err))
+
+	require.NoError(t, resetVersionTags(versionTagSkip))
+	pushed, err = push()
+	require.NoError(t, err)
+	assert.False(t, pushed)
+	assert.Equal(t, earlier, digestOf(release))
+
+	require.NoError(t, resetVersionTags(versionTagOverwrite))
+	pushed, err = push()
+	require.NoError(t, err)
+	assert.True(t, pushed)
+	assert.Equal(t, built, digestOf(release))
+
+	// A tag this build pushed moves with the image whatever the policy, as
+	// when labels or eStargz give it a new digest.
+	require.NoError(t, resetVersionTags(versionTagFail))
+	pushed, err = push()
+	require.NoError(t, err)
+	assert.True(t, pushed)
+	pushInspectImage(t, latest, v1.Platform{OS: "linux", Architecture: "386"})
+	_, err = push()
+	require.NoError(t, err)
+	assert.Equal(t, digestOf(latest), digestOf(release))
+}
@@ -3,7 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"os"
+	"log/slog"
 	"os/exec"
 	"strings"
 	"time"
@@ -17,12 +17,12 @@ import (
 var watchPollInterval = 10 * time.Second
 
 // watchFluxReconcile and watchGetDeploymentImage are vars so tests can replace them.
-var watchFluxReconcile = func(component, namespace string) {
-	_ = exec.Command("flux", "reconcile", "helmrelease", component, "-n", namespace).Run()
+var watchFluxReconcile = func(ctx context.Context, component, namespace string) {
+	_ = exec.CommandContext(ctx, "flux", "reconcile", "helmrelease", component, "-n", namespace).Run()
 }
 
-var watchGetDeploymentImage = func(namespace, component string) (string, error) {
-	out, err := exec.Command(
+var watchGetDeploymentImage = func(ctx context.Context, namespace, component string) (string, error) {
+	out, err := exec.CommandContext(ctx,
 		"kubectl", "-n", namespace,
 		"get", "deployment", component,
 		"-o", "jsonpath={.spec.template.spec.containers[0].image}",
@@ -46,16 +46,18 @@ image; base images come first by convention).`,
 		env, _ := cmd.Flags().GetString("environment")
 		namespace, _ := cmd.Flags().GetString("namespace")
 		timeout, _ := cmd.Flags().GetString("timeout")
-		buildResultDir, _ := cmd.Flags().GetString("build-result-dir")
 		imageName, _ := cmd.Flags().GetString("image-name")
 		pollTimeout, _ := cmd.Flags().GetDuration("poll-timeout")
 
-		destRepo := util.GetWatchDestinationRepository(env)
+		destRepo, err := util.GetWatchDestinationRepository(env)
+		if err != nil {
+			return util.WithExitCode(util.ExitConfig, err)
+		}
 		if destRepo == "" {
-			return fmt.Errorf("could not resolve destination repository — set GOOGLE_GKE_IMAGE_* env vars")
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("could not resolve destination repository — set environments in .registry or GOOGLE_GKE_IMAGE_* env vars"))
 		}
 
-		res, err := util.ReadBuildResult(buildResultDir)
+		res, err := util.ReadBuildResultFile(buildResultInput(cmd))
 		if err != nil {
 			return fmt.Errorf("reading build_result.json: %w", err)
 		}
@@ -69,36 +71,38 @@ image; base images come first by convention).`,
 		//   ghcr.io/octopilot/op:v1.0.0@sha256:abc123... → "v1.0.0"
 		versionTag := extractVersionTag(fullRef)
 
-		fmt.Fprintf(os.Stderr, "Watching deployment %s in namespace %s\n", component, namespace)
-		fmt.Fprintf(os.Stderr, "Waiting for image tag: %s\n", versionTag)
+		log := slog.Default().With("component", component, "namespace", namespace)
+		log.Info("Watching deployment", util.LogKeyTag, versionTag)
 
-		ctx, cancel := context.WithTimeout(context.Background(), pollTimeout)
+		ctx := cmd.Context()
+		pollCtx, cancel := context.WithTimeout(ctx, pollTimeout)
 		defer cancel()
 
 		ticker := time.NewTicker(watchPollInterval)
 		defer ticker.Stop()
 
 		for {
-			watchFluxReconcile(component, namespace)
+			watchFluxReconcile(ctx, component, namespace)
 
-			currentImage, err := watchGetDeploymentImage(namespace, component)
+			currentImage, err := watchGetDeploymentImage(ctx, namespace, component)
 			if err == nil && currentImage != "" {
 				if strings.Contains(currentImage, versionTag) || strings.Contains(currentImage, fullRef) {
-					fmt.Fprintf(os.Stderr, "Image matched (%s). Running rollout status (timeout %s)...\n",
-						currentImage, timeout)
-					if err := util.RunCommand("kubectl", "-n", namespace, "rollout", "status",
+					log.Info("Image matched; running rollout status", "image", currentImage, "timeout", timeout)
+					if err := util.RunCommand(ctx, "kubectl", "-n", namespace, "rollout", "status",
 						"deployment/"+component, "--timeout", timeout); err != nil {
-						return fmt.Errorf("rollout failed: %w", err)
+						return util.WithExitCode(util.ExitRollout, fmt.Errorf("rollout failed: %w", err))
 					}
-					fmt.Println("Rollout complete.")
+					log.Info("Rollout complete")
+					recordDeployment(ctx, component, env, fullRef, time.Now())
 					return nil
 				}
 			}
 
 			select {
-			case <-ctx.Done():
-				return fmt.Errorf("timed out (%s) waiting for deployment %s to use tag %s",
-					pollTimeout, component, versionTag)
+			case <-pollCtx.Done():
+				err := fmt.Errorf("timed out (%s) waiting for deployment %s to use tag %s", pollTimeout, component, versionTag)
+				return util.WithExitCode(util.ExitPropagationTimeout, util.WithHint(err,
+					"Check that Flux sees the new tag (flux get images all -A, the HelmRelease's values) or raise --poll-timeout."))
 			case <-ticker.C:
 			}
 		}
@@ -130,8 +134,11 @@ func init() {
 	watchCmd.Flags().String("namespace", "default", "Kubernetes namespace")
 	watchCmd.Flags().String("timeout", "30m", "kubectl rollout status timeout")
 	watchCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json (default: cwd)")
+	watchCmd.Flags().String("build-result-file", "", "Build result file to read (default: $OP_BUILD_RESULT_FILE, build_result_file, then build_result.json)")
 	watchCmd.Flags().String("image-name", "", "Artifact name to watch for (default: last entry in build_result.json)")
 	watchCmd.Flags().Duration("poll-timeout", 10*time.Minute, "Maximum time to poll before failing")
+	_ = watchCmd.RegisterFlagCompletionFunc("environment", completeEnvironments)
+	_ = watchCmd.RegisterFlagCompletionFunc("image-name", completeBuildResultImages)
 	_ = watchCmd.MarkFlagRequired("component")
 	_ = watchCmd.MarkFlagRequired("environment")
 }
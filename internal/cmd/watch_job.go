@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// kubeJob is the part of a batch/v1 Job that op watch-job reads.
+type kubeJob struct {
+	Metadata struct {
+		Name              string    `json:"name"`
+		CreationTimestamp time.Time `json:"creationTimestamp"`
+		OwnerReferences   []struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+		} `json:"ownerReferences"`
+	} `json:"metadata"`
+	Spec struct {
+		Template struct {
+			Spec struct {
+				Containers     []kubeContainer `json:"containers"`
+				InitContainers []kubeContainer `json:"initContainers"`
+			} `json:"spec"`
+		} `json:"template"`
+	} `json:"spec"`
+	Status struct {
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+type kubeContainer struct {
+	Image string `json:"image"`
+}
+
+// jobFilter selects the Jobs op watch-job waits for.
+type jobFilter struct {
+	// Name is a Job name, or the prefix of generated names (<name>-...).
+	Name string
+	// CronJob selects the Jobs a CronJob created.
+	CronJob string
+}
+
+// matches reports whether j passes f and runs the image of fullRef (by
+// digest or version tag, as watch-deployment matches deployments).
+func (f jobFilter) matches(j kubeJob, fullRef, versionTag string) bool {
+	if f.Name != "" && j.Metadata.Name != f.Name && !strings.HasPrefix(j.Metadata.Name, f.Name+"-") {
+		return false
+	}
+	if f.CronJob != "" {
+		owned := false
+		for _, o := range j.Metadata.OwnerReferences {
+			owned = owned || (o.Kind == "CronJob" && o.Name == f.CronJob)
+		}
+		// Runs created with kubectl create job --from=cronjob/... have no
+		// owner but the CronJob's name as prefix.
+		if !owned && !strings.HasPrefix(j.Metadata.Name, f.CronJob+"-") {
+			return false
+		}
+	}
+	spec := j.Spec.Template.Spec
+	for _, c := range slices.Concat(spec.InitContainers, spec.Containers) {
+		if strings.Contains(c.Image, fullRef) || extractVersionTag(c.Image) == versionTag {
+			return true
+		}
+	}
+	return false
+}
+
+// newestJob returns the newest of jobs f matches for fullRef (nil when none).
+func newestJob(jobs []kubeJob, f jobFilter, fullRef, versionTag string) *kubeJob {
+	var newest *kubeJob
+	for i, j := range jobs {
+		if !f.matches(j, fullRef, versionTag) {
+			continue
+		}
+		if newest == nil || j.Metadata.CreationTimestamp.After(newest.Metadata.CreationTimestamp) {
+			newest = &jobs[i]
+		}
+	}
+	return newest
+}
+
+// jobOutcome returns whether j has finished and, when it failed, why.
+func jobOutcome(j kubeJob) (done bool, failure string) {
+	for _, c := range j.Status.Conditions {
+		if c.Status != "True" {
+			continue
+		}
+		switch c.Type {
+		case "Complete":
+			return true, ""
+		case "Failed":
+			return true, strings.TrimSpace(c.Reason + ": " + c.Message)
+		}
+	}
+	return false, ""
+}
+
+// watchGetJobs, watchGetCronJobImages, watchCreateJob and watchJobLogs are
+// vars so tests can replace them.
+var watchGetJobs = func(ctx context.Context, namespace, selector string) ([]kubeJob, error) {
+	args := []string{"-n", namespace, "get", "jobs", "-o", "json"}
+	if selector != "" {
+		args = append(args, "-l", selector)
+	}
+	out, err := exec.CommandContext(ctx, "kubectl", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Items []kubeJob `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("parsing kubectl get jobs: %w", err)
+	}
+	return list.Items, nil
+}
+
+var watchGetCronJobImages = func(ctx context.Context, namespace, cronJob string) (string, error) {
+	out, err := exec.CommandContext(ctx,
+		"kubectl", "-n", namespace,
+		"get", "cronjob", cronJob,
+		"-o", "jsonpath={.spec.jobTemplate.spec.template.spec.containers[*].image}",
+	).Output()
+	return string(out), err
+}
+
+var watchCreateJob = func(ctx context.Context, namespace, cronJob, name string) error {
+	return util.RunCommand(ctx, "kubectl", "-n", namespace, "create", "job", name, "--from=cronjob/"+cronJob)
+}
+
+var watchJobLogs = func(ctx context.Context, namespace, job string, tail int) string {
+	out, _ := exec.CommandContext(ctx,
+		"kubectl", "-n", namespace, "logs", "job/"+job,
+		"--all-containers", "--prefix", "--tail", strconv.Itoa(tail),
+	).CombinedOutput()
+	return string(out)
+}
+
+var watchJobCmd = &cobra.Command{
+	Use:   "watch-job",
+	Short: "Wait for a Job running the new image (e.g. a db migration) to complete.",
+	Long: `Polls until a Job running the image from build_result.json has
+completed, e.g. a Helm hook or Flux-applied db-migration Job, or a run of a
+CronJob. Jobs are selected with --job (name or generated-name prefix),
+--cronjob (the CronJob's runs) and --selector (labels); the newest match is
+watched. When it fails, its logs are printed and op exits with the rollout
+code.
+
+With --cronjob and --trigger, op waits for the CronJob to use the new image
+and creates a run from it (kubectl create job --from=cronjob/...) instead of
+waiting for its schedule.
+
+  op watch-job --job db-migrate --namespace api --image-name api
+  op watch-job --cronjob nightly-report --trigger --poll-timeout 30m`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		namespace, _ := cmd.Flags().GetString("namespace")
+		imageName, _ := cmd.Flags().GetString("image-name")
+		pollTimeout, _ := cmd.Flags().GetDuration("poll-timeout")
+		logTail, _ := cmd.Flags().GetInt("log-tail")
+		selector, _ := cmd.Flags().GetString("selector")
+		trigger, _ := cmd.Flags().GetBool("trigger")
+		var filter jobFilter
+		filter.Name, _ = cmd.Flags().GetString("job")
+		filter.CronJob, _ = cmd.Flags().GetString("cronjob")
+		if filter.Name == "" && filter.CronJob == "" && selector == "" {
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("select the Job with --job, --cronjob or --selector"))
+		}
+		if trigger && filter.CronJob == "" {
+			return util.WithExitCode(util.ExitConfig, fmt.Errorf("--trigger needs --cronjob"))
+		}
+
+		res, err := util.ReadBuildResultFile(buildResultInput(cmd))
+		if err != nil {
+			return fmt.Errorf("reading build_result.json: %w", err)
+		}
+		fullRef, err := util.SelectTag(res, imageName)
+		if err != nil {
+			return fmt.Errorf("selecting image: %w", err)
+		}
+		versionTag := extractVersionTag(fullRef)
+
+		log := slog.Default().With("namespace", namespace)
+		log.Info("Watching job", "job", filter.Name, "cronjob", filter.CronJob, "selector", selector, util.LogKeyTag, versionTag)
+
+		ctx := cmd.Context()
+		pollCtx, cancel := context.WithTimeout(ctx, pollTimeout)
+		defer cancel()
+		ticker := time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+
+		triggered := !trigger
+		for {
+			if !triggered {
+				images, err := watchGetCronJobImages(ctx, namespace, filter.CronJob)
+				if err == nil && (strings.Contains(images, fullRef) || strings.Contains(images, ":"+versionTag)) {
+					name := fmt.Sprintf("%s-op-%d", filter.CronJob, time.Now().Unix())
+					log.Info("CronJob uses the new image; triggering a run", "cronjob", filter.CronJob, "job", name)
+					if err := watchCreateJob(ctx, namespace, filter.CronJob, name); err != nil {
+						return util.WithExitCode(util.ExitRollout, fmt.Errorf("creating job from cronjob/%s: %w", filter.CronJob, err))
+					}
+					filter.Name, triggered = name, true
+				}
+			}
+			if triggered {
+				jobs, err := watchGetJobs(ctx, namespace, selector)
+				if err != nil {
+					log.Debug("Listing jobs failed", "error", err)
+				} else if j := newestJob(jobs, filter, fullRef, versionTag); j != nil {
+					if done, failure := jobOutcome(*j); done {
+						name := j.Metadata.Name
+						if failure != "" {
+							log.Error("Job failed; its last log lines follow", "job", name, "lines", logTail)
+							fmt.Fprintln(os.Stderr, watchJobLogs(ctx, namespace, name, logTail))
+							return util.WithExitCode(util.ExitRollout, fmt.Errorf("job %s failed: %s", name, failure))
+						}
+						log.Info("Job complete", "job", name)
+						return nil
+					}
+				}
+			}
+
+			select {
+			case <-pollCtx.Done():
+				err := fmt.Errorf("timed out (%s) waiting for a job with tag %s to complete", pollTimeout, versionTag)
+				return util.WithExitCode(util.ExitPropagationTimeout, util.WithHint(err,
+					"Check that the Job was created with the new image (kubectl get jobs -n "+namespace+") or raise --poll-timeout."))
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchJobCmd)
+	watchJobCmd.Flags().String("job", "", "Job name, or the prefix of generated Job names (<job>-...)")
+	watchJobCmd.Flags().String("cronjob", "", "Watch the runs of this CronJob")
+	watchJobCmd.Flags().StringP("selector", "l", "", "Label selector of the Jobs")
+	watchJobCmd.Flags().Bool("trigger", false, "With --cronjob: create a run once the CronJob uses the new image")
+	watchJobCmd.Flags().String("namespace", "default", "Kubernetes namespace")
+	watchJobCmd.Flags().String("build-result-dir", "", "Directory containing build_result.json (default: cwd)")
+	watchJobCmd.Flags().String("build-result-file", "", "Build result file to read (default: $OP_BUILD_RESULT_FILE, build_result_file, then build_result.json)")
+	watchJobCmd.Flags().String("image-name", "", "Artifact name the Job runs (default: last entry in build_result.json)")
+	watchJobCmd.Flags().Duration("poll-timeout", 15*time.Minute, "Maximum time to wait for the Job to complete")
+	watchJobCmd.Flags().Int("log-tail", 100, "Log lines of a failed Job to print")
+	_ = watchJobCmd.RegisterFlagCompletionFunc("image-name", completeBuildResultImages)
+}
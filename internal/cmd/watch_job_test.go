@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testJob returns a Job named name running image, created at minute min,
+// with the given condition type ("" while it runs).
+func testJob(t *testing.T, name, image string, min int, condition, owner string) kubeJob {
+	t.Helper()
+	var j kubeJob
+	doc := map[string]any{
+		"metadata": map[string]any{
+			"name":              name,
+			"creationTimestamp": time.Date(2026, 10, 16, 9, min, 0, 0, time.UTC),
+		},
+		"spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+			"containers": []map[string]any{{"image": image}},
+		}}},
+	}
+	if owner != "" {
+		doc["metadata"].(map[string]any)["ownerReferences"] = []map[string]any{{"kind": "CronJob", "name": owner}}
+	}
+	if condition != "" {
+		doc["status"] = map[string]any{"conditions": []map[string]any{
+			{"type": condition, "status": "True", "reason": "BackoffLimitExceeded", "message": "Job has reached the specified backoff limit"},
+		}}
+	}
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &j))
+	return j
+}
+
+func TestNewestJob(t *testing.T) {
+	const ref = "ghcr.io/acme/api:v1.2.0@sha256:bbb"
+	jobs := []kubeJob{
+		testJob(t, "db-migrate-7d2f", "ghcr.io/acme/api:v1.1.0@sha256:aaa", 1, "Complete", ""),
+		testJob(t, "db-migrate-9c1a", "ghcr.io/acme/api:v1.2.0", 2, "", ""),
+		testJob(t, "db-migrate-0b3e", ref, 3, "Failed", ""),
+		testJob(t, "db-migrate-old-x", ref, 4, "", ""),
+		testJob(t, "report-29301", ref, 5, "Complete", "report"),
+	}
+
+	j := newestJob(jobs, jobFilter{Name: "db-migrate"}, ref, "v1.2.0")
+	require.NotNil(t, j)
+	assert.Equal(t, "db-migrate-old-x", j.Metadata.Name, "prefix match")
+	j = newestJob(jobs[:3], jobFilter{Name: "db-migrate"}, ref, "v1.2.0")
+	require.NotNil(t, j)
+	assert.Equal(t, "db-migrate-0b3e", j.Metadata.Name)
+	assert.Nil(t, newestJob(jobs[:1], jobFilter{Name: "db-migrate"}, ref, "v1.2.0"), "old image")
+
+	j = newestJob(jobs, jobFilter{CronJob: "report"}, ref, "v1.2.0")
+	require.NotNil(t, j)
+	assert.Equal(t, "report-29301", j.Metadata.Name)
+	assert.Nil(t, newestJob(jobs, jobFilter{Name: "report"}, "ghcr.io/acme/report:v9@sha256:ccc", "v9"))
+}
+
+func TestJobOutcome(t *testing.T) {
+	done, failure := jobOutcome(testJob(t, "a", "img", 0, "", ""))
+	assert.False(t, done)
+	assert.Empty(t, failure)
+	done, failure = jobOutcome(testJob(t, "a", "img", 0, "Complete", ""))
+	assert.True(t, done)
+	assert.Empty(t, failure)
+	done, failure = jobOutcome(testJob(t, "a", "img", 0, "Failed", ""))
+	assert.True(t, done)
+	assert.Equal(t, "BackoffLimitExceeded: Job has reached the specified backoff limit", failure)
+}
+
+func setupWatchJob(t *testing.T, tag string) string {
+	t.Helper()
+	dir := t.TempDir()
+	data, _ := json.Marshal(util.BuildResult{Builds: []util.BuildEntry{{ImageName: "api", Tag: tag}}})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, util.BuildResultFilename), data, 0o644))
+
+	oldInterval := watchPollInterval
+	watchPollInterval = time.Millisecond
+	oldJobs, oldImages, oldCreate, oldLogs := watchGetJobs, watchGetCronJobImages, watchCreateJob, watchJobLogs
+	t.Cleanup(func() {
+		watchPollInterval = oldInterval
+		watchGetJobs, watchGetCronJobImages, watchCreateJob, watchJobLogs = oldJobs, oldImages, oldCreate, oldLogs
+		for _, f := range []string{"job", "cronjob", "selector", "trigger", "build-result-dir", "poll-timeout"} {
+			_ = watchJobCmd.Flags().Set(f, watchJobCmd.Flags().Lookup(f).DefValue)
+		}
+	})
+	_ = watchJobCmd.Flags().Set("build-result-dir", dir)
+	_ = watchJobCmd.Flags().Set("poll-timeout", "2s")
+	return dir
+}
+
+func TestWatchJobCmd_Failed(t *testing.T) {
+	const ref = "ghcr.io/acme/api:v1.2.0@sha256:bbb"
+	setupWatchJob(t, ref)
+	polls := 0
+	watchGetJobs = func(_ context.Context, namespace, selector string) ([]kubeJob, error) {
+		polls++
+		if polls < 3 {
+			return []kubeJob{testJob(t, "db-migrate-1", ref, 1, "", "")}, nil
+		}
+		return []kubeJob{testJob(t, "db-migrate-1", ref, 1, "Failed", "")}, nil
+	}
+	var logsOf string
+	watchJobLogs = func(_ context.Context, _, job string, _ int) string {
+		logsOf = job
+		return "migration 42 failed"
+	}
+	_ = watchJobCmd.Flags().Set("job", "db-migrate")
+
+	watchJobCmd.SetContext(t.Context())
+	err := watchJobCmd.RunE(watchJobCmd, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "job db-migrate-1 failed: BackoffLimitExceeded")
+	assert.Equal(t, util.ExitRollout, util.ExitCode(err))
+	assert.Equal(t, "db-migrate-1", logsOf)
+	assert.Equal(t, 3, polls)
+}
+
+func TestWatchJobCmd_TriggerCronJob(t *testing.T) {
+	const ref = "ghcr.io/acme/api:v1.2.0@sha256:bbb"
+	setupWatchJob(t, ref)
+	images := []string{"ghcr.io/acme/api:v1.1.0", "ghcr.io/acme/api:v1.2.0"}
+	watchGetCronJobImages = func(_ context.Context, _, cronJob string) (string, error) {
+		assert.Equal(t, "report", cronJob)
+		img := images[0]
+		if len(images) > 1 {
+			images = images[1:]
+		}
+		return img, nil
+	}
+	var created string
+	watchCreateJob = func(_ context.Context, _, cronJob, name string) error {
+		created = name
+		return nil
+	}
+	watchGetJobs = func(context.Context, string, string) ([]kubeJob, error) {
+		if created == "" {
+			return nil, nil
+		}
+		return []kubeJob{testJob(t, created, "ghcr.io/acme/api:v1.2.0", 1, "Complete", "")}, nil
+	}
+	_ = watchJobCmd.Flags().Set("cronjob", "report")
+	_ = watchJobCmd.Flags().Set("trigger", "true")
+
+	watchJobCmd.SetContext(t.Context())
+	require.NoError(t, watchJobCmd.RunE(watchJobCmd, nil))
+	assert.Regexp(t, `^report-op-\d+$`, created)
+}
+
+func TestWatchJobCmd_NeedsSelection(t *testing.T) {
+	setupWatchJob(t, "ghcr.io/acme/api:v1.2.0@sha256:bbb")
+	watchJobCmd.SetContext(t.Context())
+	err := watchJobCmd.RunE(watchJobCmd, nil)
+	assert.ErrorContains(t, err, "select the Job with --job, --cronjob or --selector")
+	assert.Equal(t, util.ExitConfig, util.ExitCode(err))
+}
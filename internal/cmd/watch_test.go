@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
@@ -40,18 +41,18 @@ func TestWatchCmd_MatchesImmediately(t *testing.T) {
 
 	// Override the external commands
 	oldFlux := watchFluxReconcile
-	watchFluxReconcile = func(_, _ string) {}
+	watchFluxReconcile = func(context.Context, string, string) {}
 	defer func() { watchFluxReconcile = oldFlux }()
 
 	oldGet := watchGetDeploymentImage
-	watchGetDeploymentImage = func(_, _ string) (string, error) {
+	watchGetDeploymentImage = func(context.Context, string, string) (string, error) {
 		return "ghcr.io/acme/op:v1.0.0@sha256:bbb", nil
 	}
 	defer func() { watchGetDeploymentImage = oldGet }()
 
 	// Override RunCommand (kubectl rollout status)
 	oldRun := util.RunCommandFn
-	util.RunCommandFn = func(_ string, _ ...string) error { return nil }
+	util.RunCommandFn = func(context.Context, string, ...string) error { return nil }
 	defer func() { util.RunCommandFn = oldRun }()
 
 	oldInterval := watchPollInterval
@@ -66,6 +67,7 @@ func TestWatchCmd_MatchesImmediately(t *testing.T) {
 	_ = watchCmd.Flags().Set("image-name", "op")
 	_ = watchCmd.Flags().Set("poll-timeout", "5s")
 
+	watchCmd.SetContext(t.Context())
 	err := watchCmd.RunE(watchCmd, nil)
 	require.NoError(t, err)
 }
@@ -80,12 +82,12 @@ func TestWatchCmd_PollTimeout(t *testing.T) {
 	t.Setenv("GOOGLE_GKE_IMAGE_REPOSITORY", "ghcr.io/acme")
 
 	oldFlux := watchFluxReconcile
-	watchFluxReconcile = func(_, _ string) {}
+	watchFluxReconcile = func(context.Context, string, string) {}
 	defer func() { watchFluxReconcile = oldFlux }()
 
 	oldGet := watchGetDeploymentImage
 	// Always return an old image tag — never matches
-	watchGetDeploymentImage = func(_, _ string) (string, error) {
+	watchGetDeploymentImage = func(context.Context, string, string) (string, error) {
 		return "ghcr.io/acme/op:v1.0.0@sha256:aaa", nil
 	}
 	defer func() { watchGetDeploymentImage = oldGet }()
@@ -102,7 +104,10 @@ func TestWatchCmd_PollTimeout(t *testing.T) {
 	_ = watchCmd.Flags().Set("image-name", "op")
 	_ = watchCmd.Flags().Set("poll-timeout", "50ms")
 
+	watchCmd.SetContext(t.Context())
 	err := watchCmd.RunE(watchCmd, nil)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "timed out")
+	assert.Equal(t, util.ExitPropagationTimeout, util.ExitCode(err))
+	assert.Contains(t, util.FormatErrorHints(err), "hint: Check that Flux sees the new tag")
 }
@@ -1,14 +1,21 @@
 package pack
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
-
+	"log/slog"
+	"maps"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/buildpacks/pack/pkg/client"
 	"github.com/buildpacks/pack/pkg/logging"
+	"github.com/octopilot/octopilot-pipeline-tools/internal/util"
 )
 
 // BuildOptions mimics the options we need for `pack build --publish`
@@ -19,35 +26,61 @@ type BuildOptions struct {
 	RunImage   string
 	Publish    bool
 	ClearCache bool
+	// CacheImage keeps the build cache in a registry image (needs Publish).
+	CacheImage string
 	Env        map[string]string
 	SBOMDir    string
 	// Registry handling if needed (insecure, etc.)
 	Target             string
 	InsecureRegistries []string
 	Volumes            []string
+	// Verbose and Quiet set the verbosity of the Pack lifecycle output.
+	Verbose bool
+	Quiet   bool
+	// CreationTime is the image creation time (default: the lifecycle's
+	// fixed 1980-01-01); reproducible builds set it to SOURCE_DATE_EPOCH.
+	CreationTime *time.Time
+	// Buildpacks replace the builder's buildpack order (ids, id@version,
+	// docker:// or urn:cnb:registry: references, paths); "from=builder"
+	// keeps the builder's order at that position.
+	Buildpacks []string
 }
 
 // Build performs a pack build using the library.
 func Build(ctx context.Context, opts BuildOptions, out io.Writer) error {
-	logger := logging.NewLogWithWriters(out, out)
-	if os.Getenv("OP_DEBUG") == "true" {
-		logger.WantVerbose(true)
-	}
+	cache := &cacheCounter{w: out}
+	logger := logging.NewLogWithWriters(cache, cache)
+	logger.WantVerbose(opts.Verbose)
+	logger.WantQuiet(opts.Quiet)
 	packClient, err := client.NewClient(client.WithLogger(logger))
 	if err != nil {
 		return fmt.Errorf("failed to create pack client: %w", err)
 	}
+	descriptor, err := readProjectDescriptor(opts.Path, logger)
+	if err != nil {
+		return err
+	}
+	builder := opts.Builder
+	if builder == "" {
+		builder = descriptor.Build.Builder
+	}
 
 	buildOpts := client.BuildOptions{
 		Image:              opts.ImageName,
-		Builder:            opts.Builder,
+		Builder:            builder,
 		RunImage:           opts.RunImage,
 		AppPath:            opts.Path,
 		Publish:            opts.Publish,
 		ClearCache:         opts.ClearCache,
+		CacheImage:         opts.CacheImage,
 		TrustBuilder:       func(s string) bool { return true }, // Always trust for now (internal tool)
 		Env:                opts.Env,
 		SBOMDestinationDir: opts.SBOMDir,
+		CreationTime:       opts.CreationTime,
+		Buildpacks:         opts.Buildpacks,
+		// project.toml settings apply under those of op (see readProjectDescriptor).
+		ProjectDescriptor:        descriptor,
+		ProjectDescriptorBaseDir: opts.Path,
 		// Platform is a top-level field in client.BuildOptions
 		Platform:           opts.Target,
 		InsecureRegistries: opts.InsecureRegistries,
@@ -57,15 +90,59 @@ func Build(ctx context.Context, opts BuildOptions, out io.Writer) error {
 		},
 	}
 
-	// We might need to handle fetch logic if relying on daemon.
-
-	// Log build options for debugging
-	fmt.Printf("[pack] BuildOptions: Image=%s Builder=%s RunImage=%s Target=%s Network=%s Publish=%v InsecureRegistries=%v\n",
-		opts.ImageName, opts.Builder, opts.RunImage, opts.Target, os.Getenv("OP_PACK_NETWORK"), opts.Publish, opts.InsecureRegistries)
-
-	_, _ = fmt.Fprintf(out, "Building %s using builder %s (publish=%v)...\n", opts.ImageName, opts.Builder, opts.Publish)
+	log := slog.Default().With(util.LogKeyTag, opts.ImageName, util.LogKeyPlatform, opts.Target)
+	// Env values may be resolved secrets: log only the names.
+	log.Debug("pack build options", "builder", builder, "runImage", opts.RunImage,
+		"network", os.Getenv("OP_PACK_NETWORK"), "publish", opts.Publish, "insecureRegistries", opts.InsecureRegistries,
+		"buildpacks", opts.Buildpacks,
+		"env", slices.Sorted(maps.Keys(opts.Env)), "projectEnv", projectEnvNames(descriptor))
+	log.Info("Building with pack", "builder", builder, "publish", opts.Publish)
 	if err := packClient.Build(ctx, buildOpts); err != nil {
 		return fmt.Errorf("pack build failed: %w", err)
 	}
+	if cache.hits+cache.misses > 0 {
+		util.RecordBuildCache(opts.ImageName, opts.Target, cache.hits, cache.misses)
+	}
 	return nil
 }
+
+// reCacheLayer matches the lifecycle lines about layers: "Reusing layer 'x'",
+// "Adding cache layer 'x'" and "Reusing 1/1 app layer(s)".
+var reCacheLayer = regexp.MustCompile(`\b(Reusing|Adding)(?: cache)? (?:layer\b|(\d+)/\d+ app layer)`)
+
+// cacheCounter passes the lifecycle output through to w, counting the layers
+// reused from (hits) and added to (misses) the image and build cache.
+type cacheCounter struct {
+	w            io.Writer
+	line         []byte
+	hits, misses int
+}
+
+func (c *cacheCounter) Write(p []byte) (int, error) {
+	c.line = append(c.line, p...)
+	for {
+		i := bytes.IndexByte(c.line, '\n')
+		if i < 0 {
+			break
+		}
+		c.count(c.line[:i])
+		c.line = c.line[i+1:]
+	}
+	return c.w.Write(p)
+}
+
+func (c *cacheCounter) count(line []byte) {
+	m := reCacheLayer.FindSubmatch(line)
+	if m == nil {
+		return
+	}
+	n := 1
+	if len(m[2]) > 0 {
+		n, _ = strconv.Atoi(string(m[2]))
+	}
+	if string(m[1]) == "Reusing" {
+		c.hits += n
+	} else {
+		c.misses += n
+	}
+}
@@ -0,0 +1,34 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheCounter(t *testing.T) {
+	var out bytes.Buffer
+	c := &cacheCounter{w: &out}
+	lines := "===> EXPORTING\n" +
+		"[exporter] Reusing layer 'paketo-buildpacks/ca-certificates:helper'\n" +
+		"[exporter] Adding layer 'paketo-buildpacks/go-build:targets'\n" +
+		"[exporter] Reusing 1/1 app layer(s)\n" +
+		"[exporter] Adding label 'io.buildpacks.lifecycle.metadata'\n" +
+		"[exporter] Reusing cache layer 'paketo-buildpacks/go-dist:go'\n" +
+		"[exporter] Adding cache layer 'paketo-buildpacks/go-build:gocache'\n" +
+		"[exporter] Adding 2/2 app layer(s)"
+	// Split mid-line, as the lifecycle output arrives in chunks.
+	for _, chunk := range []string{lines[:40], lines[40:]} {
+		_, err := fmt.Fprint(c, chunk)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, lines, out.String())
+	assert.Equal(t, 3, c.hits)
+	// The last line has no newline yet.
+	assert.Equal(t, 2, c.misses)
+	_, _ = c.Write([]byte("\n"))
+	assert.Equal(t, 4, c.misses)
+}
@@ -0,0 +1,42 @@
+package pack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/buildpacks/pack/pkg/logging"
+	"github.com/buildpacks/pack/pkg/project"
+	projectTypes "github.com/buildpacks/pack/pkg/project/types"
+)
+
+// ProjectDescriptorFile is the Buildpacks project descriptor in the root of
+// an artifact's workspace.
+const ProjectDescriptorFile = "project.toml"
+
+// readProjectDescriptor reads the project.toml of the app at path, as pack
+// build does; an app without one gets an empty descriptor. Pack applies its
+// [[io.buildpacks.build.env]] under BuildOptions.Env, its include/exclude to
+// the app files, its buildpack group when BuildOptions.Buildpacks is empty
+// and its builder when BuildOptions.Builder is empty.
+func readProjectDescriptor(path string, logger logging.Logger) (projectTypes.Descriptor, error) {
+	file := filepath.Join(path, ProjectDescriptorFile)
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		return projectTypes.Descriptor{}, nil
+	}
+	d, err := project.ReadProjectDescriptor(file, logger)
+	if err != nil {
+		return projectTypes.Descriptor{}, fmt.Errorf("reading %s: %w", file, err)
+	}
+	return d, nil
+}
+
+// projectEnvNames are the names of the build env of d (values are not logged).
+func projectEnvNames(d projectTypes.Descriptor) []string {
+	var names []string
+	for _, e := range d.Build.Env {
+		names = append(names, e.Name)
+	}
+	return names
+}
@@ -0,0 +1,47 @@
+package pack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildpacks/pack/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadProjectDescriptor(t *testing.T) {
+	logger := logging.NewSimpleLogger(os.Stderr)
+	dir := t.TempDir()
+
+	d, err := readProjectDescriptor(dir, logger)
+	require.NoError(t, err)
+	assert.Empty(t, d.Build.Env, "no project.toml")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ProjectDescriptorFile), []byte(`
+[_]
+schema-version = "0.2"
+
+[io.buildpacks]
+builder = "ghcr.io/octopilot/builder-jammy-base:latest"
+exclude = ["README.md", "docs/"]
+
+[[io.buildpacks.group]]
+uri = "docker://ghcr.io/acme/buildpacks/web-server:1.0.0"
+
+[[io.buildpacks.build.env]]
+name = "BP_WEB_SERVER"
+value = "nginx"
+`), 0o644))
+	d, err = readProjectDescriptor(dir, logger)
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/octopilot/builder-jammy-base:latest", d.Build.Builder)
+	assert.Equal(t, []string{"README.md", "docs/"}, d.Build.Exclude)
+	require.Len(t, d.Build.Buildpacks, 1)
+	assert.Equal(t, "docker://ghcr.io/acme/buildpacks/web-server:1.0.0", d.Build.Buildpacks[0].URI)
+	assert.Equal(t, []string{"BP_WEB_SERVER"}, projectEnvNames(d))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ProjectDescriptorFile), []byte("[io.buildpacks\n"), 0o644))
+	_, err = readProjectDescriptor(dir, logger)
+	assert.ErrorContains(t, err, "reading "+filepath.Join(dir, ProjectDescriptorFile))
+}
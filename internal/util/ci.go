@@ -0,0 +1,172 @@
+package util
+
+import (
+	"cmp"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// CI providers returned by CIProvider.
+const (
+	CIGitHubActions  = "github-actions"
+	CIGitLab         = "gitlab"
+	CIAzurePipelines = "azure-pipelines"
+	CIOther          = "other"
+)
+
+// gitlabJobTokenUser is the username GitLab pairs with CI_JOB_TOKEN.
+const gitlabJobTokenUser = "gitlab-ci-token"
+
+// CIProvider returns the CI system op runs in: github-actions
+// (GITHUB_ACTIONS=true), gitlab (GITLAB_CI=true), azure-pipelines
+// (TF_BUILD=True), other when only CI is set, and "" outside CI.
+func CIProvider() string {
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true":
+		return CIGitHubActions
+	case os.Getenv("GITLAB_CI") == "true":
+		return CIGitLab
+	case strings.EqualFold(os.Getenv("TF_BUILD"), "true"):
+		return CIAzurePipelines
+	case os.Getenv("CI") != "":
+		return CIOther
+	}
+	return ""
+}
+
+// ciSelectsRegistry reports whether the CI system op runs in selects a ci
+// entry of .registry (see ResolveRegistry).
+func ciSelectsRegistry() bool {
+	switch CIProvider() {
+	case CIGitHubActions, CIGitLab, CIAzurePipelines:
+		return true
+	}
+	return false
+}
+
+// ciBranch returns the branch of the CI run: the source branch of a pull or
+// merge request, otherwise the branch (or tag) the run is for.
+func ciBranch() string {
+	switch CIProvider() {
+	case CIGitLab:
+		return cmp.Or(os.Getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME"), os.Getenv("CI_COMMIT_REF_NAME"))
+	case CIAzurePipelines:
+		ref := cmp.Or(os.Getenv("SYSTEM_PULLREQUEST_SOURCEBRANCH"), os.Getenv("BUILD_SOURCEBRANCH"))
+		return strings.TrimPrefix(strings.TrimPrefix(ref, "refs/heads/"), "refs/tags/")
+	}
+	return cmp.Or(os.Getenv("GITHUB_HEAD_REF"), os.Getenv("GITHUB_REF_NAME"))
+}
+
+// ciEvent returns what triggered the CI run: GITHUB_EVENT_NAME (push,
+// pull_request, ...), on GitLab CI_PIPELINE_SOURCE (push,
+// merge_request_event, ...) and on Azure Pipelines BUILD_REASON
+// (IndividualCI, PullRequest, Schedule, ...).
+func ciEvent() string {
+	switch CIProvider() {
+	case CIGitLab:
+		return os.Getenv("CI_PIPELINE_SOURCE")
+	case CIAzurePipelines:
+		return os.Getenv("BUILD_REASON")
+	}
+	return os.Getenv("GITHUB_EVENT_NAME")
+}
+
+// CIRepository returns the repository the CI run builds, as owner/name
+// (GITHUB_REPOSITORY), group/project (CI_PROJECT_PATH) or the Azure Repos
+// name (BUILD_REPOSITORY_NAME).
+func CIRepository() string {
+	switch CIProvider() {
+	case CIGitLab:
+		return os.Getenv("CI_PROJECT_PATH")
+	case CIAzurePipelines:
+		return os.Getenv("BUILD_REPOSITORY_NAME")
+	}
+	return os.Getenv("GITHUB_REPOSITORY")
+}
+
+// CIVersion returns the version the CI run releases:
+// DOCKER_METADATA_OUTPUT_VERSION (docker/metadata-action), otherwise the tag
+// of a GitLab tag pipeline (CI_COMMIT_TAG) or of an Azure Pipelines run for
+// a tag (BUILD_SOURCEBRANCH refs/tags/<tag>).
+func CIVersion() string {
+	if v := os.Getenv("DOCKER_METADATA_OUTPUT_VERSION"); v != "" {
+		return v
+	}
+	switch CIProvider() {
+	case CIGitLab:
+		return os.Getenv("CI_COMMIT_TAG")
+	case CIAzurePipelines:
+		if tag, ok := strings.CutPrefix(os.Getenv("BUILD_SOURCEBRANCH"), "refs/tags/"); ok {
+			return tag
+		}
+	}
+	return ""
+}
+
+// CIPullRequest reports whether the CI run builds a pull or merge request,
+// whose images are ephemeral.
+func CIPullRequest() bool {
+	switch ciEvent() {
+	case "pull_request", "pull_request_target", "merge_request_event", "PullRequest":
+		return true
+	}
+	return false
+}
+
+// CIRegistry returns the registry the CI system provides for the project:
+// on GitLab the project's container registry (CI_REGISTRY_IMAGE, or
+// CI_REGISTRY), "" elsewhere.
+func CIRegistry() string {
+	if CIProvider() != CIGitLab {
+		return ""
+	}
+	return strings.TrimSuffix(cmp.Or(os.Getenv("CI_REGISTRY_IMAGE"), os.Getenv("CI_REGISTRY")), "/")
+}
+
+// CIJobCredentials returns the credentials of the CI job for registry (a
+// host or a repository below it): on GitLab, CI_JOB_TOKEN for CI_REGISTRY.
+func CIJobCredentials(registry string) (user, password string, ok bool) {
+	if CIProvider() != CIGitLab {
+		return "", "", false
+	}
+	host, token := os.Getenv("CI_REGISTRY"), os.Getenv("CI_JOB_TOKEN")
+	if host == "" || token == "" || strings.Split(registry, "/")[0] != host {
+		return "", "", false
+	}
+	return gitlabJobTokenUser, token, true
+}
+
+// tektonResultsDir is where Tekton collects the results of a step.
+var tektonResultsDir = "/tekton/results"
+
+// ArgoResultsDir is where op writes results in an Argo Workflows step, for
+// output parameters to read with valueFrom.path.
+const ArgoResultsDir = "/tmp/op-results"
+
+// PipelineResultsDir returns the results directory of the pipeline engine
+// op runs in: /tekton/results in a Tekton step, ArgoResultsDir in an Argo
+// Workflows step (ARGO_TEMPLATE set), "" otherwise.
+func PipelineResultsDir() string {
+	if fi, err := os.Stat(tektonResultsDir); err == nil && fi.IsDir() {
+		return tektonResultsDir
+	}
+	if os.Getenv("ARGO_TEMPLATE") != "" {
+		return ArgoResultsDir
+	}
+	return ""
+}
+
+// ciJobKeychain resolves the CI job's own credentials (see CIJobCredentials)
+// for registries no stored credentials cover.
+type ciJobKeychain struct{}
+
+// Resolve implements authn.Keychain.
+func (ciJobKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	user, password, ok := CIJobCredentials(target.RegistryStr())
+	if !ok {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(authn.AuthConfig{Username: user, Password: password}), nil
+}
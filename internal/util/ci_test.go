@@ -0,0 +1,117 @@
+package util
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setGitLabCI makes the test run look like a GitLab CI job.
+func setGitLabCI(t *testing.T) {
+	t.Helper()
+	t.Setenv("GITHUB_ACTIONS", "")
+	t.Setenv("DOCKER_METADATA_OUTPUT_VERSION", "")
+	t.Setenv("GITLAB_CI", "true")
+	t.Setenv("CI", "true")
+	t.Setenv("CI_REGISTRY", "registry.gitlab.com")
+	t.Setenv("CI_REGISTRY_IMAGE", "registry.gitlab.com/acme/app")
+	t.Setenv("CI_JOB_TOKEN", "job-token")
+	t.Setenv("CI_PROJECT_PATH", "acme/app")
+}
+
+func TestCIProvider(t *testing.T) {
+	t.Setenv("GITHUB_ACTIONS", "")
+	t.Setenv("GITLAB_CI", "")
+	t.Setenv("TF_BUILD", "")
+	t.Setenv("CI", "")
+	assert.Equal(t, "", CIProvider())
+	t.Setenv("CI", "true")
+	assert.Equal(t, CIOther, CIProvider())
+	t.Setenv("TF_BUILD", "True")
+	assert.Equal(t, CIAzurePipelines, CIProvider())
+	t.Setenv("GITLAB_CI", "true")
+	assert.Equal(t, CIGitLab, CIProvider())
+	t.Setenv("GITHUB_ACTIONS", "true")
+	assert.Equal(t, CIGitHubActions, CIProvider())
+}
+
+func TestAzurePipelines(t *testing.T) {
+	t.Setenv("GITHUB_ACTIONS", "")
+	t.Setenv("GITLAB_CI", "")
+	t.Setenv("DOCKER_METADATA_OUTPUT_VERSION", "")
+	t.Setenv("TF_BUILD", "True")
+	t.Setenv("BUILD_REPOSITORY_NAME", "acme-app")
+	t.Setenv("BUILD_REASON", "PullRequest")
+	t.Setenv("BUILD_SOURCEBRANCH", "refs/pull/7/merge")
+	t.Setenv("SYSTEM_PULLREQUEST_SOURCEBRANCH", "refs/heads/feature/x")
+	assert.Equal(t, "acme-app", CIRepository())
+	assert.Equal(t, "PullRequest", ciEvent())
+	assert.Equal(t, "feature/x", ciBranch())
+	assert.Equal(t, "", CIVersion())
+	assert.True(t, CIPullRequest())
+
+	t.Setenv("BUILD_REASON", "IndividualCI")
+	t.Setenv("SYSTEM_PULLREQUEST_SOURCEBRANCH", "")
+	t.Setenv("BUILD_SOURCEBRANCH", "refs/tags/v1.4.0")
+	assert.Equal(t, "v1.4.0", ciBranch())
+	assert.Equal(t, "v1.4.0", CIVersion())
+	assert.False(t, CIPullRequest())
+	assert.True(t, ciSelectsRegistry())
+}
+
+func TestPipelineResultsDir(t *testing.T) {
+	orig := tektonResultsDir
+	t.Cleanup(func() { tektonResultsDir = orig })
+	tektonResultsDir = filepath.Join(t.TempDir(), "missing")
+	t.Setenv("ARGO_TEMPLATE", "")
+	assert.Equal(t, "", PipelineResultsDir())
+
+	t.Setenv("ARGO_TEMPLATE", `{"name":"build"}`)
+	assert.Equal(t, ArgoResultsDir, PipelineResultsDir())
+
+	tektonResultsDir = t.TempDir()
+	assert.Equal(t, tektonResultsDir, PipelineResultsDir())
+}
+
+func TestGitLabCI(t *testing.T) {
+	setGitLabCI(t)
+	assert.Equal(t, "acme/app", CIRepository())
+	assert.Equal(t, "registry.gitlab.com/acme/app", CIRegistry())
+
+	t.Setenv("CI_COMMIT_TAG", "")
+	assert.Equal(t, "", CIVersion())
+	t.Setenv("CI_COMMIT_TAG", "v1.2.3")
+	assert.Equal(t, "v1.2.3", CIVersion())
+	t.Setenv("DOCKER_METADATA_OUTPUT_VERSION", "v2.0.0")
+	assert.Equal(t, "v2.0.0", CIVersion(), "an explicit version wins")
+
+	t.Setenv("CI_COMMIT_REF_NAME", "main")
+	t.Setenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME", "")
+	assert.Equal(t, "main", ciBranch())
+	t.Setenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME", "feature/x")
+	assert.Equal(t, "feature/x", ciBranch())
+
+	user, password, ok := CIJobCredentials("registry.gitlab.com/acme/app")
+	require.True(t, ok)
+	assert.Equal(t, "gitlab-ci-token", user)
+	assert.Equal(t, "job-token", password)
+	_, _, ok = CIJobCredentials("ghcr.io/acme")
+	assert.False(t, ok)
+
+	repo, err := name.NewRepository("registry.gitlab.com/acme/app")
+	require.NoError(t, err)
+	auth, err := ciJobKeychain{}.Resolve(repo)
+	require.NoError(t, err)
+	cfg, err := auth.Authorization()
+	require.NoError(t, err)
+	assert.Equal(t, &authn.AuthConfig{Username: "gitlab-ci-token", Password: "job-token"}, cfg)
+
+	t.Setenv("GITLAB_CI", "")
+	assert.Equal(t, "", CIRegistry())
+	_, _, ok = CIJobCredentials("registry.gitlab.com")
+	assert.False(t, ok)
+}
@@ -9,36 +9,27 @@ import (
 // GetWatchDestinationRepository resolves the destination repo for watch-deployment.
 // Priority:
 // 1. Env: GOOGLE_GKE_IMAGE_<ENV>_REPOSITORY (e.g. GOOGLE_GKE_IMAGE_PROD_REPOSITORY)
-// 2. Env: WATCH_DESTINATION_REPOSITORY
-// 3. Config: Same keys via viper
-func GetWatchDestinationRepository(env string) string {
-	// Env mapping
-	var envKey string
-	switch env {
-	case "dev":
-		envKey = "GOOGLE_GKE_IMAGE_REPOSITORY"
-	case "pp":
-		envKey = "GOOGLE_GKE_IMAGE_PP_REPOSITORY"
-	case "prod":
-		envKey = "GOOGLE_GKE_IMAGE_PROD_REPOSITORY"
-	}
-
-	if val := os.Getenv(envKey); val != "" {
-		return val
-	}
-	if val := viper.GetString(envKey); val != "" {
-		return val
+// 2. Config: Same keys via viper
+// 3. .registry: environments.<env>
+// 4. Config: environments.<env> (e.g. from the user config)
+// 5. Env/config: WATCH_DESTINATION_REPOSITORY
+func GetWatchDestinationRepository(env string) (string, error) {
+	if val, err := getRepoForEnv(env); val != "" || err != nil {
+		return val, err
 	}
 
 	if val := os.Getenv("WATCH_DESTINATION_REPOSITORY"); val != "" {
-		return val
+		return val, nil
 	}
-	return viper.GetString("WATCH_DESTINATION_REPOSITORY")
+	return viper.GetString("WATCH_DESTINATION_REPOSITORY"), nil
 }
 
 // GetPromoteRepositories resolves source and dest repos for promote-image.
-func GetPromoteRepositories(sourceEnv, destEnv string) (string, string) {
-	src := getRepoForEnv(sourceEnv)
+func GetPromoteRepositories(sourceEnv, destEnv string) (string, string, error) {
+	src, err := getRepoForEnv(sourceEnv)
+	if err != nil {
+		return "", "", err
+	}
 	if src == "" {
 		src = os.Getenv("PROMOTE_SOURCE_REPOSITORY")
 	}
@@ -46,7 +37,10 @@ func GetPromoteRepositories(sourceEnv, destEnv string) (string, string) {
 		src = viper.GetString("PROMOTE_SOURCE_REPOSITORY")
 	}
 
-	dest := getRepoForEnv(destEnv)
+	dest, err := getRepoForEnv(destEnv)
+	if err != nil {
+		return "", "", err
+	}
 	if dest == "" {
 		dest = os.Getenv("PROMOTE_DESTINATION_REPOSITORY")
 	}
@@ -54,10 +48,10 @@ func GetPromoteRepositories(sourceEnv, destEnv string) (string, string) {
 		dest = viper.GetString("PROMOTE_DESTINATION_REPOSITORY")
 	}
 
-	return src, dest
+	return src, dest, nil
 }
 
-func getRepoForEnv(env string) string {
+func getRepoForEnv(env string) (string, error) {
 	var key string
 	switch env {
 	case "dev":
@@ -68,7 +62,13 @@ func getRepoForEnv(env string) string {
 		key = "GOOGLE_GKE_IMAGE_PROD_REPOSITORY"
 	}
 	if val := os.Getenv(key); val != "" {
-		return val
+		return val, nil
+	}
+	if val := viper.GetString(key); val != "" {
+		return val, nil
+	}
+	if e, ok, err := GetRegistryEnvironment("", env); ok || err != nil {
+		return e.Registry, err
 	}
-	return viper.GetString(key)
+	return GetEnvironmentRepository(env), nil
 }
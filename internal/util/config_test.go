@@ -6,8 +6,16 @@ import (
 
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func watchDestination(t *testing.T, env string) string {
+	t.Helper()
+	repo, err := GetWatchDestinationRepository(env)
+	require.NoError(t, err)
+	return repo
+}
+
 func TestGetWatchDestinationRepository(t *testing.T) {
 	// Reset viper and env
 	viper.Reset()
@@ -15,16 +23,16 @@ func TestGetWatchDestinationRepository(t *testing.T) {
 
 	// Case 1: viper default
 	viper.Set("WATCH_DESTINATION_REPOSITORY", "default-repo")
-	assert.Equal(t, "default-repo", GetWatchDestinationRepository("dev"))
+	assert.Equal(t, "default-repo", watchDestination(t, "dev"))
 
 	// Case 2: viper specific env
 	viper.Set("GOOGLE_GKE_IMAGE_REPOSITORY", "dev-repo")
-	assert.Equal(t, "dev-repo", GetWatchDestinationRepository("dev"))
-	assert.Equal(t, "default-repo", GetWatchDestinationRepository("prod"))
+	assert.Equal(t, "dev-repo", watchDestination(t, "dev"))
+	assert.Equal(t, "default-repo", watchDestination(t, "prod"))
 
 	// Case 3: Env var override
 	_ = os.Setenv("GOOGLE_GKE_IMAGE_PROD_REPOSITORY", "prod-env-repo")
-	assert.Equal(t, "prod-env-repo", GetWatchDestinationRepository("prod"))
+	assert.Equal(t, "prod-env-repo", watchDestination(t, "prod"))
 }
 
 func TestGetPromoteRepositories(t *testing.T) {
@@ -34,7 +42,8 @@ func TestGetPromoteRepositories(t *testing.T) {
 	viper.Set("GOOGLE_GKE_IMAGE_REPOSITORY", "dev-repo")
 	viper.Set("GOOGLE_GKE_IMAGE_PROD_REPOSITORY", "prod-repo")
 
-	src, dest := GetPromoteRepositories("dev", "prod")
+	src, dest, err := GetPromoteRepositories("dev", "prod")
+	require.NoError(t, err)
 	assert.Equal(t, "dev-repo", src)
 	assert.Equal(t, "prod-repo", dest)
 
@@ -43,7 +52,42 @@ func TestGetPromoteRepositories(t *testing.T) {
 	viper.Set("PROMOTE_SOURCE_REPOSITORY", "src-fallback")
 	viper.Set("PROMOTE_DESTINATION_REPOSITORY", "dest-fallback")
 
-	src, dest = GetPromoteRepositories("dev", "prod")
+	src, dest, err = GetPromoteRepositories("dev", "prod")
+	require.NoError(t, err)
 	assert.Equal(t, "src-fallback", src)
 	assert.Equal(t, "dest-fallback", dest)
 }
+
+func TestGetPromoteRepositories_RegistryEnvironments(t *testing.T) {
+	viper.Reset()
+	os.Clearenv()
+	dir := t.TempDir()
+	cwd, _ := os.Getwd()
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+	writeRegistryFile(t, dir, "environments:\n  dev: europe-docker.pkg.dev/acme/dev\n  pp:\n    registry: europe-docker.pkg.dev/acme/pp\n")
+
+	src, dest, err := GetPromoteRepositories("dev", "pp")
+	require.NoError(t, err)
+	assert.Equal(t, "europe-docker.pkg.dev/acme/dev", src)
+	assert.Equal(t, "europe-docker.pkg.dev/acme/pp", dest)
+
+	// Explicit keys still win over .registry
+	viper.Set("GOOGLE_GKE_IMAGE_PP_REPOSITORY", "pp-repo")
+	assert.Equal(t, "pp-repo", watchDestination(t, "pp"))
+}
+
+func TestGetPromoteRepositories_RequiredVariable(t *testing.T) {
+	viper.Reset()
+	os.Clearenv()
+	dir := t.TempDir()
+	cwd, _ := os.Getwd()
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+	writeRegistryFile(t, dir, "environments:\n  dev: europe-docker.pkg.dev/acme/dev\n  prod: ${PROD_REGISTRY:?set PROD_REGISTRY}\n")
+
+	_, _, err := GetPromoteRepositories("dev", "prod")
+	assert.EqualError(t, err, ".registry: PROD_REGISTRY: set PROD_REGISTRY")
+	_, err = GetWatchDestinationRepository("prod")
+	assert.Error(t, err)
+}
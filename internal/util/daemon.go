@@ -0,0 +1,135 @@
+package util
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// daemonPing checks that the container runtime's daemon answers. It is a var
+// so tests can replace it.
+var daemonPing = func(ctx context.Context) error {
+	out, err := exec.CommandContext(ctx, ContainerCLI(), "info").CombinedOutput()
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return fmt.Errorf("%s info: %s", ContainerCLI(), cmp.Or(strings.TrimSpace(lines[len(lines)-1]), err.Error()))
+	}
+	return nil
+}
+
+// startColima starts the Colima VM of profile. A var so tests can replace it.
+var startColima = func(ctx context.Context, profile string) error {
+	return RunCommand(ctx, "colima", "start", "--profile", profile)
+}
+
+// colimaProfile is the Colima profile op starts and looks for:
+// $COLIMA_PROFILE, else default.
+func colimaProfile() string {
+	return cmp.Or(os.Getenv("COLIMA_PROFILE"), "default")
+}
+
+// dockerSockets are the Docker API sockets of the local VMs, in the order
+// they are tried when the current endpoint does not answer: Colima, Docker
+// Desktop, Rancher Desktop, then the system socket.
+func dockerSockets() []string {
+	var socks []string
+	if home, err := os.UserHomeDir(); err == nil {
+		socks = append(socks,
+			filepath.Join(home, ".colima", colimaProfile(), "docker.sock"),
+			filepath.Join(home, ".docker", "run", "docker.sock"),
+			filepath.Join(home, ".rd", "docker.sock"),
+		)
+	}
+	return append(socks, "/var/run/docker.sock")
+}
+
+// useReachableDockerSocket points DOCKER_HOST at the first socket of
+// dockerSockets whose daemon answers, returning it ("" when none does;
+// DOCKER_HOST is then left unset).
+func useReachableDockerSocket(ctx context.Context) string {
+	for _, sock := range dockerSockets() {
+		if _, err := os.Stat(sock); err != nil {
+			continue
+		}
+		host := "unix://" + sock
+		_ = os.Setenv("DOCKER_HOST", host)
+		if daemonPing(ctx) == nil {
+			return host
+		}
+	}
+	_ = os.Unsetenv("DOCKER_HOST")
+	return ""
+}
+
+// EnsureContainerDaemon checks that the container daemon answers before a
+// command that needs it (op build, op run, op start-registry) and sets
+// DOCKER_HOST to the daemon in use, so the libraries speaking the Docker API
+// (Pack, the daemon image loader), which ignore docker contexts, reach the
+// same daemon as the CLI.
+//
+// When the current endpoint does not answer and DOCKER_HOST is unset, the
+// sockets of Colima, Docker Desktop and Rancher Desktop are tried. With
+// autoStartVM, a stopped Colima is started. Otherwise the error says which
+// VM to start.
+func EnsureContainerDaemon(ctx context.Context, autoStartVM bool) error {
+	if IsPodman() {
+		if err := daemonPing(ctx); err != nil {
+			return WithHint(fmt.Errorf("the podman service is not reachable: %w", err),
+				"Start it with `podman machine start` (macOS, Windows) or `systemctl --user start podman.socket`.")
+		}
+		return nil
+	}
+	pingErr := daemonPing(ctx)
+	if os.Getenv("DOCKER_HOST") == "" {
+		if pingErr == nil {
+			// The CLI reached the daemon of its context; hand that endpoint
+			// to the libraries too.
+			if endpoint := dockerEndpoint(); endpoint != "" {
+				_ = os.Setenv("DOCKER_HOST", endpoint)
+			}
+			return nil
+		}
+		if host := useReachableDockerSocket(ctx); host != "" {
+			slog.Info("Docker context does not answer; using a running daemon", "docker_host", host)
+			return nil
+		}
+	} else if pingErr == nil {
+		return nil
+	}
+
+	vm, _ := containerVMForEndpoint(cmp.Or(os.Getenv("DOCKER_HOST"), dockerEndpoint()))
+	_, colimaErr := lookPath("colima")
+	if autoStartVM && (vm == VMColima || (vm == VMNone && colimaErr == nil)) {
+		if colimaErr != nil {
+			return errors.New("--auto-start-vm: colima is not installed")
+		}
+		profile := colimaProfile()
+		slog.Info("Starting Colima", "profile", profile)
+		if err := startColima(ctx, profile); err != nil {
+			return fmt.Errorf("starting Colima: %w", err)
+		}
+		if os.Getenv("DOCKER_HOST") == "" {
+			_ = useReachableDockerSocket(ctx)
+		}
+		if pingErr = daemonPing(ctx); pingErr == nil {
+			return nil
+		}
+	}
+
+	err := fmt.Errorf("the container daemon is not reachable: %w", pingErr)
+	switch {
+	case vm == VMColima || (vm == VMNone && colimaErr == nil):
+		return WithHint(err, "Colima is not running: start it with `colima start`, or pass --auto-start-vm.")
+	case vm == VMDockerDesktop:
+		return WithHint(err, "Docker Desktop is not running: start it, or pick another runtime with --runtime.")
+	case vm == VMRancherDesktop || vm == VMLima:
+		return WithHint(err, "The "+vm+" VM is not running: start it, or pick another runtime with --runtime.")
+	}
+	return WithHint(err, "Start Docker (or Podman), or pick one with --runtime.")
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withDaemon stubs the daemon checks: the daemon answers on the hosts in
+// up ("" is the docker context's own endpoint, endpoint). It returns the
+// Colima profiles started.
+func withDaemon(t *testing.T, endpoint string, up ...string) *[]string {
+	t.Helper()
+	withRuntime(t, "docker")
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("COLIMA_PROFILE", "")
+	oldPing, oldStart, oldEndpoint := daemonPing, startColima, dockerEndpoint
+	t.Cleanup(func() { daemonPing, startColima, dockerEndpoint = oldPing, oldStart, oldEndpoint })
+	dockerEndpoint = func() string { return endpoint }
+	daemonPing = func(context.Context) error {
+		for _, host := range up {
+			if host == os.Getenv("DOCKER_HOST") {
+				return nil
+			}
+		}
+		return errors.New("docker info: Cannot connect to the Docker daemon")
+	}
+	var started []string
+	startColima = func(_ context.Context, profile string) error {
+		started = append(started, profile)
+		sock := filepath.Join(home, ".colima", profile, "docker.sock")
+		require.NoError(t, os.MkdirAll(filepath.Dir(sock), 0o755))
+		require.NoError(t, os.WriteFile(sock, nil, 0o600))
+		up = append(up, "unix://"+sock)
+		return nil
+	}
+	return &started
+}
+
+func TestEnsureContainerDaemon_ContextEndpoint(t *testing.T) {
+	withDaemon(t, "unix:///Users/me/.colima/default/docker.sock", "")
+	require.NoError(t, EnsureContainerDaemon(t.Context(), false))
+	assert.Equal(t, "unix:///Users/me/.colima/default/docker.sock", os.Getenv("DOCKER_HOST"), "libraries get the context's endpoint")
+}
+
+func TestEnsureContainerDaemon_FindsRunningVM(t *testing.T) {
+	home := t.TempDir()
+	withDaemon(t, "unix:///Users/me/.colima/default/docker.sock", "unix://"+filepath.Join(home, ".docker", "run", "docker.sock"))
+	t.Setenv("HOME", home)
+	sock := filepath.Join(home, ".docker", "run", "docker.sock")
+	require.NoError(t, os.MkdirAll(filepath.Dir(sock), 0o755))
+	require.NoError(t, os.WriteFile(sock, nil, 0o600))
+
+	require.NoError(t, EnsureContainerDaemon(t.Context(), false))
+	assert.Equal(t, "unix://"+sock, os.Getenv("DOCKER_HOST"))
+}
+
+func TestEnsureContainerDaemon_StoppedColima(t *testing.T) {
+	started := withDaemon(t, "unix:///Users/me/.colima/default/docker.sock")
+	err := EnsureContainerDaemon(t.Context(), false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the container daemon is not reachable: docker info: Cannot connect")
+	assert.Equal(t, []string{"Colima is not running: start it with `colima start`, or pass --auto-start-vm."}, ErrorHints(err))
+	assert.Empty(t, *started)
+	assert.Empty(t, os.Getenv("DOCKER_HOST"))
+
+	withRuntime(t, "docker", "colima")
+	t.Setenv("COLIMA_PROFILE", "work")
+	require.NoError(t, EnsureContainerDaemon(t.Context(), true))
+	assert.Equal(t, []string{"work"}, *started)
+	home, _ := os.UserHomeDir()
+	assert.Equal(t, "unix://"+filepath.Join(home, ".colima", "work", "docker.sock"), os.Getenv("DOCKER_HOST"))
+}
+
+func TestEnsureContainerDaemon_DockerDesktopHint(t *testing.T) {
+	started := withDaemon(t, "unix:///Users/me/.docker/run/docker.sock")
+	withRuntime(t, "docker", "colima")
+	err := EnsureContainerDaemon(t.Context(), true)
+	require.Error(t, err)
+	assert.Equal(t, []string{"Docker Desktop is not running: start it, or pick another runtime with --runtime."}, ErrorHints(err))
+	assert.Empty(t, *started, "only Colima is started")
+}
+
+func TestEnsureContainerDaemon_ExplicitDockerHost(t *testing.T) {
+	withDaemon(t, "", "tcp://10.0.0.5:2376")
+	t.Setenv("DOCKER_HOST", "tcp://10.0.0.5:2376")
+	require.NoError(t, EnsureContainerDaemon(t.Context(), false))
+
+	t.Setenv("DOCKER_HOST", "tcp://10.0.0.6:2376")
+	err := EnsureContainerDaemon(t.Context(), false)
+	require.Error(t, err)
+	assert.Equal(t, "tcp://10.0.0.6:2376", os.Getenv("DOCKER_HOST"), "an explicit DOCKER_HOST is kept")
+	assert.Equal(t, []string{"Start Docker (or Podman), or pick one with --runtime."}, ErrorHints(err))
+}
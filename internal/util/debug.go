@@ -0,0 +1,121 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Debug runtimes supported by `op run --debug`.
+const (
+	DebugRuntimeGo   = "go"
+	DebugRuntimeNode = "node"
+	DebugRuntimeJVM  = "jvm"
+)
+
+// DebugOptions describes how to expose a debugger for a container.
+type DebugOptions struct {
+	Runtime string
+	// Port is the debugger port inside the container.
+	Port int
+	// Env is merged into the container environment.
+	Env map[string]string
+	// Entrypoint, when set, replaces the image entrypoint. The original
+	// entrypoint and command are appended after EntrypointArgs.
+	Entrypoint     string
+	EntrypointArgs []string
+	// DockerArgs are extra docker run flags (e.g. ptrace capabilities for delve).
+	DockerArgs []string
+}
+
+// InferDebugRuntime determines the debugger runtime from the context directory,
+// in the same spirit as InferRunOptions. Returns "" when no runtime is detected.
+func InferDebugRuntime(contextDir string) string {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(contextDir, name))
+		return err == nil
+	}
+	switch {
+	case exists("go.mod"):
+		return DebugRuntimeGo
+	case exists("package.json"):
+		return DebugRuntimeNode
+	case exists("pom.xml"), exists("build.gradle"), exists("build.gradle.kts"):
+		return DebugRuntimeJVM
+	}
+	return ""
+}
+
+// GetDebugOptions returns the debugger configuration for runtime.
+func GetDebugOptions(runtime string) (DebugOptions, error) {
+	switch runtime {
+	case DebugRuntimeGo:
+		return DebugOptions{
+			Runtime:    runtime,
+			Port:       2345,
+			Env:        map[string]string{},
+			Entrypoint: "dlv",
+			EntrypointArgs: []string{
+				"exec", "--headless", "--continue", "--accept-multiclient",
+				"--api-version=2", "--listen=:2345",
+			},
+			DockerArgs: []string{"--cap-add=SYS_PTRACE", "--security-opt", "seccomp=unconfined"},
+		}, nil
+	case DebugRuntimeNode:
+		return DebugOptions{
+			Runtime: runtime,
+			Port:    9229,
+			Env:     map[string]string{"NODE_OPTIONS": "--inspect=0.0.0.0:9229"},
+		}, nil
+	case DebugRuntimeJVM:
+		return DebugOptions{
+			Runtime: runtime,
+			Port:    5005,
+			Env: map[string]string{
+				"JAVA_TOOL_OPTIONS": "-agentlib:jdwp=transport=dt_socket,server=y,suspend=n,address=*:5005",
+			},
+		}, nil
+	}
+	return DebugOptions{}, fmt.Errorf("unsupported debug runtime %q (supported: %s, %s, %s)",
+		runtime, DebugRuntimeGo, DebugRuntimeNode, DebugRuntimeJVM)
+}
+
+// WrapCommand returns the container command when the entrypoint is overridden:
+// EntrypointArgs followed by the image's original entrypoint and command.
+// For delve the program arguments are separated with "--".
+func (o DebugOptions) WrapCommand(imageCmd []string) []string {
+	if o.Entrypoint == "" || len(imageCmd) == 0 {
+		return nil
+	}
+	args := append([]string{}, o.EntrypointArgs...)
+	args = append(args, imageCmd[0])
+	if len(imageCmd) > 1 {
+		if o.Runtime == DebugRuntimeGo {
+			args = append(args, "--")
+		}
+		args = append(args, imageCmd[1:]...)
+	}
+	return args
+}
+
+// AttachInstructions returns human-readable IDE attach instructions for a
+// debugger published on hostPort.
+func (o DebugOptions) AttachInstructions(hostPort int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Debugger (%s) listening on localhost:%d\n", o.Runtime, hostPort)
+	switch o.Runtime {
+	case DebugRuntimeGo:
+		fmt.Fprintf(&b, "  CLI:     dlv connect localhost:%d\n", hostPort)
+		fmt.Fprintf(&b, "  VS Code: {\"type\": \"go\", \"request\": \"attach\", \"mode\": \"remote\", \"host\": \"127.0.0.1\", \"port\": %d}\n", hostPort)
+		b.WriteString("  GoLand:  Run > Edit Configurations > Go Remote, host localhost, port above\n")
+		b.WriteString("  Note:    the image must contain dlv on PATH\n")
+	case DebugRuntimeNode:
+		fmt.Fprintf(&b, "  Chrome:  chrome://inspect, add localhost:%d\n", hostPort)
+		fmt.Fprintf(&b, "  VS Code: {\"type\": \"node\", \"request\": \"attach\", \"address\": \"localhost\", \"port\": %d}\n", hostPort)
+	case DebugRuntimeJVM:
+		fmt.Fprintf(&b, "  IntelliJ: Run > Edit Configurations > Remote JVM Debug, host localhost, port %d\n", hostPort)
+		fmt.Fprintf(&b, "  VS Code:  {\"type\": \"java\", \"request\": \"attach\", \"hostName\": \"localhost\", \"port\": %d}\n", hostPort)
+	}
+	return b.String()
+}
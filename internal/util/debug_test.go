@@ -0,0 +1,63 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferDebugRuntime(t *testing.T) {
+	cases := []struct {
+		file string
+		want string
+	}{
+		{"go.mod", DebugRuntimeGo},
+		{"package.json", DebugRuntimeNode},
+		{"pom.xml", DebugRuntimeJVM},
+		{"build.gradle.kts", DebugRuntimeJVM},
+		{"README.md", ""},
+	}
+	for _, tc := range cases {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, tc.file), []byte("x"), 0o644))
+		assert.Equal(t, tc.want, InferDebugRuntime(dir), "file=%s", tc.file)
+	}
+}
+
+func TestGetDebugOptions(t *testing.T) {
+	node, err := GetDebugOptions(DebugRuntimeNode)
+	require.NoError(t, err)
+	assert.Equal(t, 9229, node.Port)
+	assert.Equal(t, "--inspect=0.0.0.0:9229", node.Env["NODE_OPTIONS"])
+	assert.Empty(t, node.Entrypoint)
+
+	goOpts, err := GetDebugOptions(DebugRuntimeGo)
+	require.NoError(t, err)
+	assert.Equal(t, 2345, goOpts.Port)
+	assert.Equal(t, "dlv", goOpts.Entrypoint)
+
+	_, err = GetDebugOptions("cobol")
+	assert.Error(t, err)
+}
+
+func TestDebugOptions_WrapCommand(t *testing.T) {
+	goOpts, _ := GetDebugOptions(DebugRuntimeGo)
+	args := goOpts.WrapCommand([]string{"/app/server", "--port", "8080"})
+	assert.Equal(t, []string{
+		"exec", "--headless", "--continue", "--accept-multiclient", "--api-version=2", "--listen=:2345",
+		"/app/server", "--", "--port", "8080",
+	}, args)
+
+	node, _ := GetDebugOptions(DebugRuntimeNode)
+	assert.Nil(t, node.WrapCommand([]string{"node", "server.js"}))
+}
+
+func TestDebugOptions_AttachInstructions(t *testing.T) {
+	goOpts, _ := GetDebugOptions(DebugRuntimeGo)
+	out := goOpts.AttachInstructions(2346)
+	assert.Contains(t, out, "dlv connect localhost:2346")
+	assert.Contains(t, out, `"port": 2346`)
+}
@@ -1,7 +1,8 @@
 package util
 
 import (
-	"fmt"
+	"context"
+	"log/slog"
 	"os"
 	"os/exec"
 )
@@ -10,14 +11,15 @@ import (
 // It is a var so tests can replace it without spawning real processes.
 var RunCommandFn = runCommandImpl
 
-// RunCommand executes a command, connecting stdout/stderr/stdin.
-func RunCommand(name string, args ...string) error {
-	return RunCommandFn(name, args...)
+// RunCommand executes a command, connecting stdout/stderr/stdin. Cancelling
+// ctx kills it.
+func RunCommand(ctx context.Context, name string, args ...string) error {
+	return RunCommandFn(ctx, name, args...)
 }
 
-func runCommandImpl(name string, args ...string) error {
-	fmt.Printf("Running: %s %v\n", name, args)
-	cmd := exec.Command(name, args...)
+func runCommandImpl(ctx context.Context, name string, args ...string) error {
+	slog.Info("Running command", "command", name, "args", args)
+	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
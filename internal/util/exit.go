@@ -0,0 +1,76 @@
+package util
+
+import (
+	"errors"
+)
+
+// Exit codes of op, so workflows can branch on the kind of failure. Any other
+// error exits with ExitFailure.
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	// ExitConfig: invalid flags, config files (.registry, skaffold.yaml,
+	// .github/octopilot.yaml, user config) or unresolved settings.
+	ExitConfig = 2
+	// ExitBuild: an artifact failed to build.
+	ExitBuild = 3
+	// ExitPush: pushing, tagging or copying an image or index failed.
+	ExitPush = 4
+	// ExitPropagationTimeout: the new tag did not reach the deployment in time.
+	ExitPropagationTimeout = 5
+	// ExitRollout: the rollout of the new image failed.
+	ExitRollout = 6
+	// ExitVerification: signatures, attestations, image tests or the build
+	// result did not verify.
+	ExitVerification = 7
+)
+
+// exitCategories names each exit code, e.g. for metrics.
+var exitCategories = map[int]string{
+	ExitConfig:             "config",
+	ExitBuild:              "build",
+	ExitPush:               "push",
+	ExitPropagationTimeout: "propagation_timeout",
+	ExitRollout:            "rollout",
+	ExitVerification:       "verification",
+}
+
+// ExitError is an error that exits op with Code.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string { return e.Err.Error() }
+
+func (e *ExitError) Unwrap() error { return e.Err }
+
+// WithExitCode marks err to exit with code; nil stays nil. An error already
+// marked keeps its code, so the innermost (most specific) marking wins.
+func WithExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return err
+	}
+	return &ExitError{Code: code, Err: err}
+}
+
+// ExitCode returns the exit code for err: ExitOK for nil, the code of an
+// ExitError, ExitConfig for an interpolation error, else ExitFailure.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	var interpErr *InterpolationError
+	if errors.As(err, &interpErr) {
+		return ExitConfig
+	}
+	return ExitFailure
+}
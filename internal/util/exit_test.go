@@ -0,0 +1,32 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, ExitOK, ExitCode(nil))
+	assert.Equal(t, ExitFailure, ExitCode(errors.New("boom")))
+
+	err := WithExitCode(ExitBuild, errors.New("pack build failed"))
+	assert.Equal(t, ExitBuild, ExitCode(err))
+	assert.EqualError(t, err, "pack build failed")
+
+	// Wrapping keeps the code; re-marking keeps the innermost one.
+	wrapped := fmt.Errorf("build failed, tag v1 removed: %w", err)
+	assert.Equal(t, ExitBuild, ExitCode(wrapped))
+	assert.Equal(t, ExitBuild, ExitCode(WithExitCode(ExitPush, wrapped)))
+
+	assert.Equal(t, ExitConfig, ExitCode(fmt.Errorf(".registry: %w", &InterpolationError{Name: "REPO", Message: "required"})))
+	assert.NoError(t, WithExitCode(ExitPush, nil))
+}
+
+func TestFailureCategory_ExitCode(t *testing.T) {
+	assert.Equal(t, "propagation_timeout", FailureCategory(WithExitCode(ExitPropagationTimeout, errors.New("timed out (5m) waiting for deployment"))))
+	assert.Equal(t, "push", FailureCategory(WithExitCode(ExitPush, errors.New("UNAUTHORIZED"))))
+	assert.Equal(t, "verification", FailureCategory(WithExitCode(ExitVerification, errors.New("2 image test(s) failed"))))
+}
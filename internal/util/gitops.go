@@ -0,0 +1,366 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GitOpsOpts configures `op gitops-update`: the GitOps repository and, per
+// environment, which files reference which images.
+type GitOpsOpts struct {
+	Repo         string                       `yaml:"repo"`
+	Branch       string                       `yaml:"branch"`
+	Environments map[string]GitOpsEnvironment `yaml:"environments"`
+}
+
+// GitOpsEnvironment overrides the repository and branch for one environment
+// and lists its image updates. With PullRequest the change is pushed to a
+// new branch and a pull request is opened instead of pushing to Branch.
+type GitOpsEnvironment struct {
+	Repo        string         `yaml:"repo"`
+	Branch      string         `yaml:"branch"`
+	PullRequest bool           `yaml:"pull_request"`
+	Updates     []GitOpsUpdate `yaml:"updates"`
+}
+
+// GitOpsUpdate sets the image of build_result.json entry Image in File.
+//
+// Type selects how:
+//   - helm (default): Path (default spec.values.image) is a values map whose
+//     tag (and digest and repository, when present) are set, or an image string;
+//   - kustomize: the images entry named Name (default: the image repository)
+//     gets newTag and digest;
+//   - yaml: the string at Path is set to the full image reference.
+//
+// Path is a dotted path with optional [index] or [key=value] selectors, e.g.
+// spec.template.spec.containers[name=app].image.
+type GitOpsUpdate struct {
+	File  string `yaml:"file"`
+	Image string `yaml:"image"`
+	Type  string `yaml:"type"`
+	Path  string `yaml:"path"`
+	Name  string `yaml:"name"`
+}
+
+// SplitImageRef splits registry/repo:tag@sha256:... into its repository, tag
+// and digest; tag and digest may be empty.
+func SplitImageRef(ref string) (repo, tag, digest string) {
+	repo, digest, _ = strings.Cut(ref, "@")
+	if colon := strings.LastIndex(repo, ":"); colon > strings.LastIndex(repo, "/") {
+		repo, tag = repo[:colon], repo[colon+1:]
+	}
+	return repo, tag, digest
+}
+
+// UpdateImageInYAML applies u to the (possibly multi-document) YAML data for
+// image reference ref and returns the new content and whether it changed.
+// Comments are preserved; the output is re-indented with two spaces.
+func UpdateImageInYAML(data []byte, u GitOpsUpdate, ref string) ([]byte, bool, error) {
+	var docs []*yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, false, err
+		}
+		docs = append(docs, &doc)
+	}
+
+	repo, tag, digest := SplitImageRef(ref)
+	changed, matched := false, false
+	for _, doc := range docs {
+		if len(doc.Content) == 0 {
+			continue
+		}
+		root := doc.Content[0]
+		var ok, c bool
+		var err error
+		switch u.Type {
+		case "", "helm":
+			ok, c, err = updateHelmImage(root, u.Path, ref, repo, tag, digest)
+		case "kustomize":
+			ok, c = updateKustomizeImage(root, u.Name, repo, tag, digest)
+		case "yaml":
+			ok, c, err = updateYAMLImage(root, u.Path, ref)
+		default:
+			err = fmt.Errorf("unknown update type %q (expected helm, kustomize or yaml)", u.Type)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		matched = matched || ok
+		changed = changed || c
+	}
+	if !matched {
+		return nil, false, fmt.Errorf("no %s image found in %s", orDefault(u.Type, "helm"), u.File)
+	}
+	if !changed {
+		return data, false, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return nil, false, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), true, nil
+}
+
+// ReadImageFromYAML returns the image reference u currently sets in the
+// (possibly multi-document) YAML data: the inverse of UpdateImageInYAML.
+// ref is the built image, whose repository selects unnamed Kustomize
+// entries. Helm image maps and Kustomize entries are joined as
+// repository:tag@digest.
+func ReadImageFromYAML(data []byte, u GitOpsUpdate, ref string) (string, error) {
+	repo, _, _ := SplitImageRef(ref)
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return "", err
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		root := doc.Content[0]
+		var current string
+		var err error
+		switch u.Type {
+		case "", "helm":
+			current, err = readHelmImage(root, u.Path)
+		case "kustomize":
+			current = readKustomizeImage(root, u.Name, repo)
+		case "yaml":
+			current, err = readYAMLImage(root, u.Path)
+		default:
+			err = fmt.Errorf("unknown update type %q (expected helm, kustomize or yaml)", u.Type)
+		}
+		if err != nil || current != "" {
+			return current, err
+		}
+	}
+	return "", fmt.Errorf("no %s image found in %s", orDefault(u.Type, "helm"), u.File)
+}
+
+// joinImageRef is the inverse of SplitImageRef.
+func joinImageRef(repo, tag, digest string) string {
+	ref := repo
+	if tag != "" {
+		ref += ":" + tag
+	}
+	if digest != "" {
+		ref += "@" + digest
+	}
+	return ref
+}
+
+func scalarValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+func readHelmImage(root *yaml.Node, path string) (string, error) {
+	node, err := yamlPathLookup(root, orDefault(path, "spec.values.image"))
+	if err != nil || node == nil {
+		return "", err
+	}
+	if node.Kind == yaml.ScalarNode {
+		return node.Value, nil
+	}
+	return joinImageRef(scalarValue(mappingValue(node, "repository")), scalarValue(mappingValue(node, "tag")), scalarValue(mappingValue(node, "digest"))), nil
+}
+
+func readKustomizeImage(root *yaml.Node, name, repo string) string {
+	images := mappingValue(root, "images")
+	if images == nil || images.Kind != yaml.SequenceNode {
+		return ""
+	}
+	for _, entry := range images.Content {
+		n := scalarValue(mappingValue(entry, "name"))
+		nn := scalarValue(mappingValue(entry, "newName"))
+		if (name != "" && n == name) || (name == "" && (n == repo || nn == repo)) {
+			return joinImageRef(orDefault(nn, n), scalarValue(mappingValue(entry, "newTag")), scalarValue(mappingValue(entry, "digest")))
+		}
+	}
+	return ""
+}
+
+func readYAMLImage(root *yaml.Node, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("type yaml requires a path")
+	}
+	node, err := yamlPathLookup(root, path)
+	if err != nil {
+		return "", err
+	}
+	return scalarValue(node), nil
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func updateHelmImage(root *yaml.Node, path, ref, repo, tag, digest string) (bool, bool, error) {
+	node, err := yamlPathLookup(root, orDefault(path, "spec.values.image"))
+	if err != nil || node == nil {
+		return false, false, err
+	}
+	if node.Kind == yaml.ScalarNode {
+		return true, setScalar(node, ref), nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return false, false, fmt.Errorf("%s is neither an image map nor a string", path)
+	}
+	changed := false
+	if r := mappingValue(node, "repository"); r != nil {
+		changed = setScalar(r, repo) || changed
+	}
+	if d := mappingValue(node, "digest"); d != nil || (tag == "" && digest != "") {
+		changed = setMappingScalar(node, "digest", digest) || changed
+	}
+	if tag != "" {
+		changed = setMappingScalar(node, "tag", tag) || changed
+	}
+	return true, changed, nil
+}
+
+func updateKustomizeImage(root *yaml.Node, name, repo, tag, digest string) (bool, bool) {
+	images := mappingValue(root, "images")
+	if images == nil || images.Kind != yaml.SequenceNode {
+		return false, false
+	}
+	for _, entry := range images.Content {
+		n := mappingValue(entry, "name")
+		nn := mappingValue(entry, "newName")
+		matches := (name != "" && n != nil && n.Value == name) ||
+			(name == "" && ((n != nil && n.Value == repo) || (nn != nil && nn.Value == repo)))
+		if !matches {
+			continue
+		}
+		changed := false
+		if tag != "" {
+			changed = setMappingScalar(entry, "newTag", tag) || changed
+		}
+		if digest != "" {
+			changed = setMappingScalar(entry, "digest", digest) || changed
+		}
+		return true, changed
+	}
+	return false, false
+}
+
+func updateYAMLImage(root *yaml.Node, path, ref string) (bool, bool, error) {
+	if path == "" {
+		return false, false, fmt.Errorf("type yaml requires a path")
+	}
+	node, err := yamlPathLookup(root, path)
+	if err != nil || node == nil {
+		return false, false, err
+	}
+	if node.Kind != yaml.ScalarNode {
+		return false, false, fmt.Errorf("%s is not a string", path)
+	}
+	return true, setScalar(node, ref), nil
+}
+
+// yamlPathLookup resolves a dotted path with [index] and [key=value]
+// selectors (a leading $ or . is ignored). It returns nil when a segment
+// does not exist.
+func yamlPathLookup(node *yaml.Node, path string) (*yaml.Node, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	for _, segment := range strings.Split(path, ".") {
+		key, rest, _ := strings.Cut(segment, "[")
+		if key != "" {
+			if node = mappingValue(node, key); node == nil {
+				return nil, nil
+			}
+		}
+		for rest != "" {
+			sel, after, ok := strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("invalid path segment %q", segment)
+			}
+			rest = strings.TrimPrefix(after, "[")
+			if node.Kind != yaml.SequenceNode {
+				return nil, nil
+			}
+			if k, v, isMatch := strings.Cut(sel, "="); isMatch {
+				var found *yaml.Node
+				for _, item := range node.Content {
+					if f := mappingValue(item, k); f != nil && f.Value == v {
+						found = item
+						break
+					}
+				}
+				if node = found; node == nil {
+					return nil, nil
+				}
+				continue
+			}
+			i, err := strconv.Atoi(sel)
+			if err != nil {
+				return nil, fmt.Errorf("invalid selector [%s] in %q", sel, path)
+			}
+			if i < 0 || i >= len(node.Content) {
+				return nil, nil
+			}
+			node = node.Content[i]
+		}
+	}
+	return node, nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingScalar sets key to a string value, adding it when missing.
+func setMappingScalar(node *yaml.Node, key, value string) bool {
+	if v := mappingValue(node, key); v != nil {
+		return setScalar(v, value)
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+	return true
+}
+
+func setScalar(node *yaml.Node, value string) bool {
+	if node.Value == value && node.Tag == "!!str" {
+		return false
+	}
+	node.Kind, node.Tag, node.Value = yaml.ScalarNode, "!!str", value
+	return true
+}
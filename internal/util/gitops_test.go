@@ -0,0 +1,141 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGitOpsDigest = "sha256:4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945"
+
+func TestSplitImageRef(t *testing.T) {
+	repo, tag, digest := SplitImageRef("localhost:5001/org/app:v1.2.3@" + testGitOpsDigest)
+	assert.Equal(t, "localhost:5001/org/app", repo)
+	assert.Equal(t, "v1.2.3", tag)
+	assert.Equal(t, testGitOpsDigest, digest)
+
+	repo, tag, digest = SplitImageRef("localhost:5001/org/app")
+	assert.Equal(t, "localhost:5001/org/app", repo)
+	assert.Empty(t, tag)
+	assert.Empty(t, digest)
+}
+
+func TestUpdateImageInYAML_HelmRelease(t *testing.T) {
+	in := `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+  values:
+    image:
+      repository: ghcr.io/org/app # keep this comment
+      tag: v1.0.0
+`
+	out, changed, err := UpdateImageInYAML([]byte(in), GitOpsUpdate{File: "hr.yaml"}, "ghcr.io/org/app:v1.1.0@"+testGitOpsDigest)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+  values:
+    image:
+      repository: ghcr.io/org/app # keep this comment
+      tag: v1.1.0
+`, string(out))
+
+	_, changed, err = UpdateImageInYAML(out, GitOpsUpdate{File: "hr.yaml"}, "ghcr.io/org/app:v1.1.0@"+testGitOpsDigest)
+	require.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestUpdateImageInYAML_HelmDigestAndScalar(t *testing.T) {
+	out, _, err := UpdateImageInYAML([]byte("spec:\n  values:\n    image:\n      tag: \"1.0\"\n      digest: \"\"\n"), GitOpsUpdate{}, "ghcr.io/org/app:1.1@"+testGitOpsDigest)
+	require.NoError(t, err)
+	assert.Equal(t, "spec:\n  values:\n    image:\n      tag: \"1.1\"\n      digest: \""+testGitOpsDigest+"\"\n", string(out))
+
+	out, _, err = UpdateImageInYAML([]byte("spec:\n  values:\n    app:\n      image: ghcr.io/org/app:1.0\n"), GitOpsUpdate{Path: "spec.values.app.image"}, "ghcr.io/org/app:1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "spec:\n  values:\n    app:\n      image: ghcr.io/org/app:1.1\n", string(out))
+}
+
+func TestUpdateImageInYAML_Kustomize(t *testing.T) {
+	in := `resources:
+  - deployment.yaml
+images:
+  - name: ghcr.io/org/other
+    newTag: "2.0"
+  - name: ghcr.io/org/app
+    newTag: v1.0.0
+`
+	out, changed, err := UpdateImageInYAML([]byte(in), GitOpsUpdate{Type: "kustomize"}, "ghcr.io/org/app:v1.1.0@"+testGitOpsDigest)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, string(out), "  - name: ghcr.io/org/app\n    newTag: v1.1.0\n    digest: "+testGitOpsDigest+"\n")
+	assert.Contains(t, string(out), "newTag: \"2.0\"")
+
+	_, _, err = UpdateImageInYAML([]byte(in), GitOpsUpdate{Type: "kustomize", Name: "missing"}, "ghcr.io/org/app:v1.1.0")
+	assert.ErrorContains(t, err, "no kustomize image found")
+}
+
+func TestUpdateImageInYAML_PathSelectorMultiDoc(t *testing.T) {
+	in := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+        - name: sidecar
+          image: envoy:1.0
+        - name: app
+          image: ghcr.io/org/app:1.0
+`
+	u := GitOpsUpdate{Type: "yaml", Path: "$.spec.template.spec.containers[name=app].image"}
+	out, changed, err := UpdateImageInYAML([]byte(in), u, "ghcr.io/org/app:1.1@"+testGitOpsDigest)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, string(out), "image: envoy:1.0\n")
+	assert.Contains(t, string(out), "image: ghcr.io/org/app:1.1@"+testGitOpsDigest+"\n")
+	assert.Contains(t, string(out), "---\n")
+
+	u.Path = "spec.template.spec.containers[1].image"
+	_, changed, err = UpdateImageInYAML(out, u, "ghcr.io/org/app:1.1@"+testGitOpsDigest)
+	require.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestUpdateImageInYAML_Errors(t *testing.T) {
+	_, _, err := UpdateImageInYAML([]byte("a: 1\n"), GitOpsUpdate{Type: "yaml"}, "app:1")
+	assert.ErrorContains(t, err, "requires a path")
+	_, _, err = UpdateImageInYAML([]byte("a: 1\n"), GitOpsUpdate{Type: "jsonnet"}, "app:1")
+	assert.ErrorContains(t, err, "unknown update type")
+	_, _, err = UpdateImageInYAML([]byte("a: 1\n"), GitOpsUpdate{File: "values.yaml"}, "app:1")
+	assert.ErrorContains(t, err, "no helm image found in values.yaml")
+}
+
+func TestReadImageFromYAML(t *testing.T) {
+	helm := "spec:\n  values:\n    image:\n      repository: ghcr.io/org/app\n      tag: v1.0.0\n      digest: " + testGitOpsDigest + "\n"
+	ref, err := ReadImageFromYAML([]byte(helm), GitOpsUpdate{}, "ghcr.io/org/app:v1.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/org/app:v1.0.0@"+testGitOpsDigest, ref)
+
+	kustomize := "images:\n  - name: ghcr.io/org/other\n    newTag: \"2.0\"\n  - name: app\n    newName: ghcr.io/org/app\n    newTag: v1.0.0\n"
+	ref, err = ReadImageFromYAML([]byte(kustomize), GitOpsUpdate{Type: "kustomize"}, "ghcr.io/org/app:v1.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/org/app:v1.0.0", ref)
+
+	multi := "kind: ConfigMap\n---\nspec:\n  containers:\n    - name: app\n      image: ghcr.io/org/app:v0.9\n"
+	ref, err = ReadImageFromYAML([]byte(multi), GitOpsUpdate{Type: "yaml", Path: "spec.containers[name=app].image"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/org/app:v0.9", ref)
+
+	_, err = ReadImageFromYAML([]byte(kustomize), GitOpsUpdate{Type: "kustomize", File: "k.yaml"}, "ghcr.io/org/missing:1")
+	assert.ErrorContains(t, err, "no kustomize image found in k.yaml")
+}
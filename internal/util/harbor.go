@@ -0,0 +1,159 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// HarborRobotSecretEnv holds the secret of the robot account of a Harbor
+// registry (see RegistryHarbor.Robot).
+const HarborRobotSecretEnv = "HARBOR_ROBOT_SECRET"
+
+// RegistryHarbor marks a .registry entry as a Harbor registry:
+//
+//	ci:
+//	  - registry: harbor.internal/team
+//	    harbor:
+//	      create_project: true
+//	      robot: robot$team+ci
+type RegistryHarbor struct {
+	// CreateProject creates the Harbor project of a repository through the
+	// Harbor API before op pushes to it, as Harbor refuses pushes to a
+	// project that does not exist.
+	CreateProject bool `yaml:"create_project"`
+	// Public makes created projects public (default: private).
+	Public bool `yaml:"public"`
+	// Robot is the robot account to authenticate as, with the secret from
+	// $HARBOR_ROBOT_SECRET; taken literally, as robot names contain a $.
+	Robot string `yaml:"robot"`
+}
+
+// HarborOptions returns the Harbor settings of the .registry entry in
+// repoRoot that repo belongs to.
+func HarborOptions(repoRoot, repo string) (*RegistryHarbor, bool) {
+	e, ok := RegistryOptions(repoRoot, repo)
+	if !ok || e.Harbor == nil {
+		return nil, false
+	}
+	return e.Harbor, true
+}
+
+// harborProject splits repo (host/project/name...) into the registry host
+// and the Harbor project.
+func harborProject(repo string) (host, project string, err error) {
+	parts := strings.Split(strings.TrimSuffix(repo, "/"), "/")
+	if len(parts) < 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("%s names no Harbor project (want <host>/<project>[/<repository>])", repo)
+	}
+	return parts[0], parts[1], nil
+}
+
+// harborHTTPClient calls the Harbor API; a var so tests can replace it.
+var harborHTTPClient = func(insecure bool) *http.Client {
+	return &http.Client{Transport: RegistryHTTPTransport(insecure)}
+}
+
+// EnsureHarborProject creates the Harbor project of repo when it does not
+// exist, authenticating with the registry credentials of repo (see
+// Keychain). insecure allows a self-signed certificate and plain HTTP.
+func EnsureHarborProject(ctx context.Context, repo string, h *RegistryHarbor, insecure bool) (created bool, err error) {
+	host, project, err := harborProject(repo)
+	if err != nil {
+		return false, err
+	}
+	auth, err := harborAuth(repo)
+	if err != nil {
+		return false, err
+	}
+	client := harborHTTPClient(insecure)
+	base := "https://" + host + "/api/v2.0"
+	call := func(method, path string, body []byte) (*http.Response, error) {
+		for {
+			req, err := http.NewRequestWithContext(ctx, method, base+path, bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if auth.Username != "" {
+				req.SetBasicAuth(auth.Username, auth.Password)
+			}
+			resp, err := client.Do(req)
+			if err != nil && insecure && strings.HasPrefix(base, "https://") && strings.Contains(err.Error(), "HTTP response to HTTPS client") {
+				base = "http://" + host + "/api/v2.0"
+				continue
+			}
+			return resp, err
+		}
+	}
+
+	resp, err := call(http.MethodHead, "/projects?project_name="+url.QueryEscape(project), nil)
+	if err != nil {
+		return false, fmt.Errorf("checking Harbor project %s: %w", project, err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return false, nil
+	case http.StatusNotFound:
+	default:
+		return false, fmt.Errorf("checking Harbor project %s on %s: %s", project, host, resp.Status)
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"project_name": project,
+		"metadata":     map[string]string{"public": strconv.FormatBool(h.Public)},
+	})
+	resp, err = call(http.MethodPost, "/projects", body)
+	if err != nil {
+		return false, fmt.Errorf("creating Harbor project %s: %w", project, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusConflict:
+		// Created concurrently, e.g. by another matrix job.
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return false, fmt.Errorf("creating Harbor project %s on %s: %s: %s", project, host, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// harborAuth returns the basic credentials for the Harbor API of repo.
+func harborAuth(repo string) (*authn.AuthConfig, error) {
+	r, err := name.NewRepository(repo)
+	if err != nil {
+		return nil, err
+	}
+	a, err := Keychain().Resolve(r)
+	if err != nil {
+		return nil, err
+	}
+	return a.Authorization()
+}
+
+// harborKeychain authenticates as the robot account of Harbor registries
+// configured with one in .registry.
+type harborKeychain struct{}
+
+// Resolve implements authn.Keychain; other registries, and robots without
+// $HARBOR_ROBOT_SECRET, are anonymous so the next keychain answers.
+func (harborKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	h, ok := HarborOptions("", target.String())
+	secret := os.Getenv(HarborRobotSecretEnv)
+	if !ok || h.Robot == "" || secret == "" {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(authn.AuthConfig{Username: h.Robot, Password: secret}), nil
+}
@@ -0,0 +1,88 @@
+package util
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsureHarborProject(t *testing.T) {
+	projects := map[string]bool{"existing": true}
+	var created []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "robot$team+ci" || pass != "robot-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodHead && r.URL.Path == "/api/v2.0/projects":
+			if !projects[r.URL.Query().Get("project_name")] {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v2.0/projects":
+			body, _ := io.ReadAll(r.Body)
+			created = append(created, string(body))
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	orig := harborHTTPClient
+	t.Cleanup(func() { harborHTTPClient = orig })
+	harborHTTPClient = func(bool) *http.Client { return srv.Client() }
+
+	host := strings.TrimPrefix(srv.URL, "https://")
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile(filepath.Join(".", RegistryFilename), []byte("ci:\n  - registry: "+host+"\n    harbor:\n      create_project: true\n      robot: robot$team+ci\n"), 0o644))
+	t.Setenv(HarborRobotSecretEnv, "robot-secret")
+	h, ok := HarborOptions("", host+"/team")
+	require.True(t, ok)
+	assert.True(t, h.CreateProject)
+
+	ok, err := EnsureHarborProject(t.Context(), host+"/existing/app", h, false)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Empty(t, created)
+
+	ok, err = EnsureHarborProject(t.Context(), host+"/team/app", h, false)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.Len(t, created, 1)
+	assert.JSONEq(t, `{"project_name":"team","metadata":{"public":"false"}}`, created[0])
+
+	_, err = EnsureHarborProject(t.Context(), host, h, false)
+	assert.ErrorContains(t, err, "names no Harbor project")
+
+	t.Setenv(HarborRobotSecretEnv, "")
+	_, err = EnsureHarborProject(t.Context(), host+"/team/app", h, false)
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestHarborKeychain(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile(filepath.Join(".", RegistryFilename), []byte("ci:\n  - registry: harbor.internal/team\n    harbor:\n      robot: robot$team+ci\n"), 0o644))
+	repo, err := name.NewRepository("harbor.internal/team/app")
+	require.NoError(t, err)
+
+	t.Setenv(HarborRobotSecretEnv, "")
+	auth, err := harborKeychain{}.Resolve(repo)
+	require.NoError(t, err)
+	assert.Equal(t, authn.Anonymous, auth)
+
+	t.Setenv(HarborRobotSecretEnv, "robot-secret")
+	auth, err = harborKeychain{}.Resolve(repo)
+	require.NoError(t, err)
+	cfg, err := auth.Authorization()
+	require.NoError(t, err)
+	assert.Equal(t, &authn.AuthConfig{Username: "robot$team+ci", Password: "robot-secret"}, cfg)
+}
@@ -0,0 +1,132 @@
+package util
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// HintError attaches a remediation hint to an error; see WithHint.
+type HintError struct {
+	Err  error
+	Hint string
+}
+
+func (e *HintError) Error() string { return e.Err.Error() }
+
+func (e *HintError) Unwrap() error { return e.Err }
+
+// WithHint attaches hint to err, printed after the error in a "hint:" block;
+// nil stays nil.
+func WithHint(err error, hint string) error {
+	if err == nil {
+		return nil
+	}
+	return &HintError{Err: err, Hint: hint}
+}
+
+// errorHintRules suggest a hint for common failures, matched in order against
+// the lowercased error message; the first match wins.
+var errorHintRules = []struct {
+	re   *regexp.Regexp
+	hint string
+}{
+	{
+		regexp.MustCompile(`ghcr\.io.*(unauthorized|denied|\b40[13]\b|authentication required)`),
+		"GHCR rejected the credentials. In GitHub Actions, give the job `permissions: packages: write` and log in with GITHUB_TOKEN;\n" +
+			"elsewhere run `op login ghcr.io` with a token that has the write:packages scope.",
+	},
+	{
+		regexp.MustCompile(`harbor project.*(\b40[13]\b|unauthorized|forbidden)`),
+		"Creating a Harbor project needs a user or system robot account allowed to create projects (robot: in .registry,\n" +
+			"with HARBOR_ROBOT_SECRET); otherwise create the project in Harbor and drop harbor.create_project.",
+	},
+	{
+		regexp.MustCompile(`azurecr\.io.*(unauthorized|denied|\b40[13]\b|authentication required)`),
+		"ACR rejected the credentials. Give the service principal or managed identity the AcrPush role on the registry (AcrPull to read);\n" +
+			"set AZURE_CLIENT_ID, AZURE_TENANT_ID and AZURE_CLIENT_SECRET, or `oidc: {provider: azure}` on its .registry entry for a managed identity.",
+	},
+	{
+		regexp.MustCompile(`unauthorized|authentication required|\b401\b`),
+		"The registry rejected the credentials: run `op login <registry>` (or docker login) and check the token can push to this repository.",
+	},
+	{
+		// Registry responses only: a local "permission denied" (files,
+		// the docker socket, locks) is not about the token.
+		regexp.MustCompile(`(^|: )denied:|/v2/.*(forbidden|\b403\b)|unexpected status code 403`),
+		"The credentials are valid but not allowed this action: check the token or service account has push (write) access to the repository.",
+	},
+	{
+		regexp.MustCompile(`x509: certificate signed by unknown authority|certificate is not trusted|x509: certificate is valid for`),
+		"The registry's TLS certificate is not trusted. For the local registry run `op start-registry --trust`;\n" +
+			"for another self-signed registry add it with `op config set insecure_registries <host:port>`.",
+	},
+	{
+		regexp.MustCompile(`server gave http response to https client`),
+		"The registry only speaks plain HTTP: add it with `op config set insecure_registries <host:port>`.",
+	},
+	{
+		regexp.MustCompile(`manifest[ _]unknown|name[ _]unknown`),
+		"The image or tag does not exist in that registry (yet). Check the tag in build_result.json, that the push\n" +
+			"has propagated (op build waits up to --propagation-timeout) and, for another environment, that it was promoted there.",
+	},
+	{
+		regexp.MustCompile(`toomanyrequests|rate limit`),
+		"The registry is rate limiting: log in (`op login <registry>`) to raise the limit, or retry later.",
+	},
+	{
+		regexp.MustCompile(`(localhost|127\.0\.0\.1)(:\d+)?.*connection refused`),
+		"Nothing is listening on the local registry: start it with `op start-registry`.",
+	},
+	{
+		regexp.MustCompile(`cannot connect to the docker daemon|docker\.sock.*(no such file|connection refused)`),
+		"The container runtime is not running: start Docker (or Podman), or pick one with --runtime.",
+	},
+	{
+		regexp.MustCompile(`no such host`),
+		"The registry host name does not resolve: check the repository in .registry, --repo or default_repo.",
+	},
+	{
+		regexp.MustCompile(`build_result\.json.*no such file`),
+		"No build result here: run `op build` first, or point at it with --build-result-dir / --build-result-file.",
+	},
+}
+
+// ErrorHints returns the remediation hints for err: those attached with
+// WithHint, outermost first, else the first matching common failure.
+func ErrorHints(err error) []string {
+	if err == nil {
+		return nil
+	}
+	var hints []string
+	for e := err; e != nil; {
+		var hintErr *HintError
+		if !errors.As(e, &hintErr) {
+			break
+		}
+		hints = append(hints, hintErr.Hint)
+		e = hintErr.Err
+	}
+	if len(hints) > 0 {
+		return hints
+	}
+	msg := strings.ToLower(err.Error())
+	for _, r := range errorHintRules {
+		if r.re.MatchString(msg) {
+			return []string{r.hint}
+		}
+	}
+	return nil
+}
+
+// FormatErrorHints renders the hints of err as a block printed after the
+// error ("" when there are none); continuation lines are indented.
+func FormatErrorHints(err error) string {
+	var b strings.Builder
+	for _, h := range ErrorHints(err) {
+		b.WriteString("hint: ")
+		b.WriteString(strings.ReplaceAll(h, "\n", "\n      "))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorHints_CommonFailures(t *testing.T) {
+	tests := []struct {
+		err  string
+		want string // substring of the hint; "" for none
+	}{
+		{"PUT https://ghcr.io/v2/acme/app/manifests/v1: UNAUTHORIZED: authentication required", "packages: write"},
+		{"creating Harbor project team on harbor.internal: 403 Forbidden: {}", "robot account"},
+		{"HEAD https://acme.azurecr.io/v2/app/blobs/sha256:abc: unexpected status code 401 Unauthorized", "AcrPush"},
+		{"GET https://europe-docker.pkg.dev/v2/token: unexpected status code 401 Unauthorized", "op login"},
+		{"PUT https://registry.example.com/v2/app/blobs: DENIED: requested access to the resource is denied", "push (write) access"},
+		{"denied: requested access to the resource is denied", "push (write) access"},
+		{"HEAD https://registry.example.com/v2/app/manifests/v1: unexpected status code 403 Forbidden (HEAD responses have no body, use GET for details)", "push (write) access"},
+		{"open /home/ci/.docker/config.json: permission denied", ""},
+		{"dial unix /var/run/docker.sock: connect: permission denied", ""},
+		{"locking build_result.json: open .op-lock: permission denied", ""},
+		{`Get "https://registry.local:5000/v2/": tls: failed to verify certificate: x509: certificate signed by unknown authority`, "op start-registry --trust"},
+		{`Get "https://registry.local:5000/v2/": http: server gave HTTP response to HTTPS client`, "insecure_registries"},
+		{"GET https://ghcr.io/v2/acme/app/manifests/v2: MANIFEST_UNKNOWN: manifest unknown", "propagated"},
+		{`Get "https://localhost:5001/v2/": dial tcp 127.0.0.1:5001: connect: connection refused`, "op start-registry"},
+		{"Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?", "--runtime"},
+		{"reading build_result.json: open build_result.json: no such file or directory", "op build"},
+		{"something unrelated", ""},
+	}
+	for _, tt := range tests {
+		hints := ErrorHints(fmt.Errorf("pushing: %w", errors.New(tt.err)))
+		if tt.want == "" {
+			assert.Empty(t, hints, tt.err)
+			continue
+		}
+		require.Len(t, hints, 1, tt.err)
+		assert.Contains(t, hints[0], tt.want, tt.err)
+	}
+	assert.Nil(t, ErrorHints(nil))
+}
+
+func TestErrorHints_Attached(t *testing.T) {
+	base := errors.New("MANIFEST_UNKNOWN: manifest unknown")
+	err := fmt.Errorf("watch: %w", WithHint(WithHint(base, "inner"), "outer"))
+	assert.Equal(t, []string{"outer", "inner"}, ErrorHints(err))
+	assert.EqualError(t, err, "watch: MANIFEST_UNKNOWN: manifest unknown")
+	assert.True(t, errors.Is(err, base))
+	assert.NoError(t, WithHint(nil, "x"))
+
+	// Exit codes and hints combine.
+	err = WithExitCode(ExitPush, WithHint(base, "promote first"))
+	assert.Equal(t, ExitPush, ExitCode(err))
+	assert.Equal(t, []string{"promote first"}, ErrorHints(err))
+}
+
+func TestFormatErrorHints(t *testing.T) {
+	assert.Empty(t, FormatErrorHints(errors.New("something unrelated")))
+	assert.Equal(t, "hint: first line\n      second line\n", FormatErrorHints(WithHint(errors.New("x"), "first line\nsecond line")))
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ImageLockFilename is the lockfile `op lock` writes next to skaffold.yaml.
+const ImageLockFilename = "op.lock"
+
+// ImageLock pins the buildpack builders and run images of skaffold.yaml,
+// which name mutable tags, to the digests `op lock` resolved them to.
+// `op build` uses the pinned digests, so rebuilds are reproducible.
+type ImageLock struct {
+	// Images maps a reference as written in skaffold.yaml to
+	// registry/repository@sha256:...
+	Images map[string]string `yaml:"images"`
+}
+
+// Pinned returns the digest reference ref is pinned to.
+func (l *ImageLock) Pinned(ref string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	pinned, ok := l.Images[ref]
+	return pinned, ok && pinned != ""
+}
+
+// LoadImageLock reads the lockfile in dir; it is empty when absent.
+func LoadImageLock(dir string) (*ImageLock, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ImageLockFilename))
+	if os.IsNotExist(err) {
+		return &ImageLock{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var l ImageLock
+	if err := yaml.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("%s: %w", ImageLockFilename, err)
+	}
+	return &l, nil
+}
+
+// WriteImageLock writes l as the lockfile in dir.
+func WriteImageLock(dir string, l *ImageLock) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	header := "# Generated by `op lock`; run it again to move to newer images.\n"
+	return os.WriteFile(filepath.Join(dir, ImageLockFilename), append([]byte(header), data...), 0o644)
+}
@@ -2,9 +2,11 @@ package util
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -12,47 +14,71 @@ const DefaultContainerPort = 8080
 
 // RunOptions holds inferred configuration
 type RunOptions struct {
+	// ContainerPort is the port the app serves on, the first of Ports.
 	ContainerPort int
-	Env           map[string]string
+	// Ports are all ports the app exposes.
+	Ports []int
+	Env   map[string]string
 }
 
-// InferRunOptions determines port and env from context directory.
-func InferRunOptions(contextDir string) RunOptions {
-	defaults := RunOptions{
-		ContainerPort: DefaultContainerPort,
-		Env:           map[string]string{"PORT": "8080"},
-	}
+// runOptionSources infer ports (and env) from a context directory, in order
+// of precedence; the first source that finds a port wins.
+var runOptionSources = []func(dir string) ([]int, map[string]string){
+	func(dir string) ([]int, map[string]string) {
+		port, env := inferFromProcfile(filepath.Join(dir, "Procfile"))
+		return portList(port), env
+	},
+	inferFromCompose,
+	inferFromJavaApp,
+	inferFromPackageJSON,
+	inferFromGoMain,
+	// project.toml (Buildpacks) -> default 8080
+	func(dir string) ([]int, map[string]string) {
+		if _, err := os.Stat(filepath.Join(dir, "project.toml")); err == nil {
+			return []int{DefaultContainerPort}, nil
+		}
+		return nil, nil
+	},
+	func(dir string) ([]int, map[string]string) {
+		return inferFromDockerfile(filepath.Join(dir, "Dockerfile")), nil
+	},
+	func(dir string) ([]int, map[string]string) {
+		return inferFromNginx(filepath.Join(dir, "nginx.conf")), nil
+	},
+}
 
-	// 1. Procfile
-	if port, _ := inferFromProcfile(filepath.Join(contextDir, "Procfile")); port != 0 {
-		return RunOptions{
-			ContainerPort: port,
-			Env:           map[string]string{"PORT": fmtInt(port)},
+// InferRunOptions determines ports and env from context directory: Procfile,
+// docker-compose.yaml, Spring/Quarkus application config, package.json
+// scripts, Go main packages, project.toml, Dockerfile EXPOSE and nginx.conf,
+// in that order. PORT is set to the first port.
+func InferRunOptions(contextDir string) RunOptions {
+	for _, infer := range runOptionSources {
+		if ports, env := infer(contextDir); len(ports) > 0 {
+			return newRunOptions(ports, env)
 		}
 	}
+	return newRunOptions([]int{DefaultContainerPort}, nil)
+}
 
-	// 2. project.toml (Buildpacks) -> Default 8080
-	if _, err := os.Stat(filepath.Join(contextDir, "project.toml")); err == nil {
-		return defaults
+func newRunOptions(ports []int, env map[string]string) RunOptions {
+	opts := RunOptions{
+		ContainerPort: ports[0],
+		Env:           map[string]string{"PORT": fmtInt(ports[0])},
 	}
-
-	// 3. Dockerfile -> EXPOSE
-	if port := inferFromDockerfile(filepath.Join(contextDir, "Dockerfile")); port != 0 {
-		return RunOptions{
-			ContainerPort: port,
-			Env:           map[string]string{"PORT": fmtInt(port)},
+	for _, p := range ports {
+		if !slices.Contains(opts.Ports, p) {
+			opts.Ports = append(opts.Ports, p)
 		}
 	}
+	maps.Copy(opts.Env, env)
+	return opts
+}
 
-	// 4. nginx.conf -> listen
-	if port := inferFromNginx(filepath.Join(contextDir, "nginx.conf")); port != 0 {
-		return RunOptions{
-			ContainerPort: port,
-			Env:           map[string]string{"PORT": fmtInt(port)},
-		}
+func portList(port int) []int {
+	if port == 0 {
+		return nil
 	}
-
-	return defaults
+	return []int{port}
 }
 
 func inferFromProcfile(path string) (int, map[string]string) {
@@ -107,28 +133,38 @@ func inferFromProcfile(path string) (int, map[string]string) {
 	return 0, nil
 }
 
-func inferFromDockerfile(path string) int {
+var (
+	reDockerExpose = regexp.MustCompile(`(?im)^\s*EXPOSE\s+(.+)$`)
+	reNginxListen  = regexp.MustCompile(`listen\s+(?:\S*:)?(\d+)[^;]*;`)
+)
+
+func inferFromDockerfile(path string) []int {
 	content, err := os.ReadFile(path)
 	if err != nil {
-		return 0
+		return nil
 	}
-	re := regexp.MustCompile(`(?i)EXPOSE\s+(\d+)`)
-	if m := re.FindStringSubmatch(string(content)); len(m) > 1 {
-		return parseInt(m[1])
+	var ports []int
+	for _, m := range reDockerExpose.FindAllStringSubmatch(string(content), -1) {
+		for _, field := range strings.Fields(m[1]) {
+			// 8080, 8080/tcp; $PORT is left to the image.
+			if port := parseInt(strings.Split(field, "/")[0]); port != 0 {
+				ports = append(ports, port)
+			}
+		}
 	}
-	return 0
+	return ports
 }
 
-func inferFromNginx(path string) int {
+func inferFromNginx(path string) []int {
 	content, err := os.ReadFile(path)
 	if err != nil {
-		return 0
+		return nil
 	}
-	re := regexp.MustCompile(`listen\s+(\d+)\s*;`)
-	if m := re.FindStringSubmatch(string(content)); len(m) > 1 {
-		return parseInt(m[1])
+	var ports []int
+	for _, m := range reNginxListen.FindAllStringSubmatch(string(content), -1) {
+		ports = append(ports, parseInt(m[1]))
 	}
-	return 0
+	return ports
 }
 
 func parseInt(s string) int {
@@ -141,3 +177,53 @@ func parseInt(s string) int {
 func fmtInt(i int) string {
 	return fmt.Sprintf("%d", i)
 }
+
+// ProjectInfo describes a repository as detected by InferProject.
+type ProjectInfo struct {
+	// Language is go, node, python, java, ruby, php, dotnet or "" when unknown.
+	Language      string
+	Dockerfile    bool
+	Procfile      bool
+	ContainerPort int
+}
+
+// projectLanguageFiles maps marker files to languages, in detection order.
+var projectLanguageFiles = []struct {
+	File     string
+	Language string
+}{
+	{"go.mod", "go"},
+	{"package.json", "node"},
+	{"pyproject.toml", "python"},
+	{"requirements.txt", "python"},
+	{"Pipfile", "python"},
+	{"pom.xml", "java"},
+	{"build.gradle", "java"},
+	{"build.gradle.kts", "java"},
+	{"Gemfile", "ruby"},
+	{"composer.json", "php"},
+}
+
+// InferProject detects the language, Dockerfile/Procfile presence and
+// container port of the project in dir.
+func InferProject(dir string) ProjectInfo {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+	info := ProjectInfo{
+		Dockerfile:    exists("Dockerfile"),
+		Procfile:      exists("Procfile"),
+		ContainerPort: InferRunOptions(dir).ContainerPort,
+	}
+	for _, l := range projectLanguageFiles {
+		if exists(l.File) {
+			info.Language = l.Language
+			return info
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.csproj")); len(matches) > 0 {
+		info.Language = "dotnet"
+	}
+	return info
+}
@@ -0,0 +1,292 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// composeFileNames are the Compose files looked at, in Compose's own order.
+var composeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+type composeServiceSpec struct {
+	Build       interface{}   `yaml:"build"`
+	Ports       []interface{} `yaml:"ports"`
+	Expose      []interface{} `yaml:"expose"`
+	Environment interface{}   `yaml:"environment"`
+}
+
+// inferFromCompose reads the container ports (ports and expose) and
+// environment of the Compose service built from dir.
+func inferFromCompose(dir string) ([]int, map[string]string) {
+	for _, name := range composeFileNames {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		var f struct {
+			Services map[string]composeServiceSpec `yaml:"services"`
+		}
+		if err := yaml.Unmarshal(data, &f); err != nil {
+			return nil, nil
+		}
+		svc, ok := composeAppService(f.Services)
+		if !ok {
+			return nil, nil
+		}
+		var ports []int
+		for _, p := range append(svc.Ports, svc.Expose...) {
+			if port := composeContainerPort(p); port != 0 {
+				ports = append(ports, port)
+			}
+		}
+		return ports, composeEnvironment(svc.Environment)
+	}
+	return nil, nil
+}
+
+// composeAppService picks the service that builds the app: the one whose build
+// context is the Compose file's directory, else the only service with a build,
+// else the only service.
+func composeAppService(services map[string]composeServiceSpec) (composeServiceSpec, bool) {
+	names := slices.Sorted(maps.Keys(services))
+	var built []string
+	for _, name := range names {
+		svc := services[name]
+		ctx := ""
+		switch b := svc.Build.(type) {
+		case nil:
+			continue
+		case string:
+			ctx = b
+		case map[string]interface{}:
+			ctx, _ = b["context"].(string)
+		}
+		if filepath.Clean(ctx) == "." {
+			return svc, true
+		}
+		built = append(built, name)
+	}
+	switch {
+	case len(built) == 1:
+		return services[built[0]], true
+	case len(built) == 0 && len(names) == 1:
+		return services[names[0]], true
+	}
+	return composeServiceSpec{}, false
+}
+
+// composeContainerPort returns the container side of a ports or expose entry:
+// 8080, "8081:8080", "127.0.0.1:8081:8080/tcp" or {target: 8080}. Ranges are
+// skipped.
+func composeContainerPort(entry interface{}) int {
+	switch v := entry.(type) {
+	case int:
+		return v
+	case string:
+		v = strings.Split(v, "/")[0]
+		v = v[strings.LastIndex(v, ":")+1:]
+		if strings.Contains(v, "-") {
+			return 0
+		}
+		return parseInt(v)
+	case map[string]interface{}:
+		return composeContainerPort(v["target"])
+	}
+	return 0
+}
+
+// composeEnvironment reads environment as a mapping or a list of KEY=VALUE.
+// Entries without a value (passed through from the host) are skipped.
+func composeEnvironment(environment interface{}) map[string]string {
+	env := map[string]string{}
+	switch v := environment.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if val != nil {
+				env[k] = fmt.Sprint(val)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if k, val, ok := strings.Cut(fmt.Sprint(item), "="); ok {
+				env[k] = val
+			}
+		}
+	}
+	return env
+}
+
+// javaAppConfigFiles are where Spring Boot and Quarkus read their config,
+// relative to the context directory.
+var javaAppConfigFiles = []string{
+	"src/main/resources/application.properties",
+	"src/main/resources/application.yaml",
+	"src/main/resources/application.yml",
+	"application.properties",
+	"application.yaml",
+	"application.yml",
+}
+
+// javaPortSettings maps the port property of each framework to the
+// environment variable that overrides it.
+var javaPortSettings = []struct {
+	Property string
+	Env      string
+}{
+	{"server.port", "SERVER_PORT"},
+	{"quarkus.http.port", "QUARKUS_HTTP_PORT"},
+}
+
+// reSpringPlaceholder matches ${PORT:8080}, a property with a default.
+var reSpringPlaceholder = regexp.MustCompile(`^\$\{[^:}]+:(\d+)\}$`)
+
+// inferFromJavaApp reads server.port (Spring Boot) or quarkus.http.port
+// (Quarkus) from application.properties/application.yaml; without one, a
+// Spring Boot or Quarkus build file means the framework default, 8080. The
+// framework's port variable is set so the app listens on that port.
+func inferFromJavaApp(dir string) ([]int, map[string]string) {
+	for _, name := range javaAppConfigFiles {
+		props := readJavaAppConfig(filepath.Join(dir, name))
+		for _, s := range javaPortSettings {
+			value := props[s.Property]
+			if m := reSpringPlaceholder.FindStringSubmatch(value); m != nil {
+				value = m[1]
+			}
+			if port := parseInt(value); port != 0 {
+				return []int{port}, map[string]string{s.Env: fmtInt(port)}
+			}
+		}
+	}
+	for _, name := range []string{"pom.xml", "build.gradle", "build.gradle.kts"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		port := fmtInt(DefaultContainerPort)
+		switch {
+		case bytes.Contains(data, []byte("spring-boot")):
+			return []int{DefaultContainerPort}, map[string]string{"SERVER_PORT": port}
+		case bytes.Contains(data, []byte("io.quarkus")):
+			return []int{DefaultContainerPort}, map[string]string{"QUARKUS_HTTP_PORT": port}
+		}
+	}
+	return nil, nil
+}
+
+// readJavaAppConfig returns the properties of an application.properties or
+// application.yaml file as dotted keys; nil when it does not exist.
+func readJavaAppConfig(path string) map[string]string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	props := map[string]string{}
+	if filepath.Ext(path) != ".properties" {
+		var doc map[string]interface{}
+		if yaml.Unmarshal(data, &doc) != nil {
+			return nil
+		}
+		for k, v := range FlattenUserConfig(doc) {
+			props[k] = fmt.Sprint(v)
+		}
+		return props
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		if i := strings.IndexAny(line, "=:"); i > 0 {
+			props[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return props
+}
+
+// packageJSONScripts are the scripts looked at for a port, in order; start is
+// what buildpacks run.
+var packageJSONScripts = []string{"start", "serve", "dev", "preview"}
+
+var (
+	// --port 3000, --port=3000, -p 3000, PORT=3000
+	reScriptPort = regexp.MustCompile(`(?:--port[= ]|-p\s+|\bPORT=)(\d+)`)
+	// Servers that listen on 3000 unless told otherwise.
+	reScriptPort3000 = regexp.MustCompile(`\b(?:next start|nuxt start|react-scripts start|remix-serve)\b`)
+)
+
+// inferFromPackageJSON reads the port from the package.json scripts: an
+// explicit --port/-p/PORT=, else the default of a known server started by
+// the start script.
+func inferFromPackageJSON(dir string) ([]int, map[string]string) {
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return nil, nil
+	}
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if json.Unmarshal(data, &pkg) != nil {
+		return nil, nil
+	}
+	for _, name := range packageJSONScripts {
+		if m := reScriptPort.FindStringSubmatch(pkg.Scripts[name]); m != nil {
+			return portList(parseInt(m[1])), nil
+		}
+	}
+	if reScriptPort3000.MatchString(pkg.Scripts["start"]) {
+		return []int{3000}, nil
+	}
+	return nil, nil
+}
+
+var (
+	// http.ListenAndServe(":8080", ...), net.Listen("tcp", "0.0.0.0:8080"), r.Run(":8080")
+	reGoListen = regexp.MustCompile(`(?:Listen(?:AndServe(?:TLS)?)?|\.Run|\.Start)\((?:"tcp\d?",\s*)?"[^":]*:(\d+)"`)
+	// Addr: ":8080"
+	reGoAddr = regexp.MustCompile(`Addr:\s*"[^":]*:(\d+)"`)
+	// port = "8080", the usual default for os.Getenv("PORT")
+	reGoPortDefault = regexp.MustCompile(`(?i)\bport\s*:?=\s*"(\d+)"`)
+)
+
+// inferFromGoMain reads listen addresses from the main packages of a Go
+// module (the module root and cmd/*); a default for $PORT comes first, as
+// the port the app serves on.
+func inferFromGoMain(dir string) ([]int, map[string]string) {
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err != nil {
+		return nil, nil
+	}
+	pkgDirs := []string{dir}
+	if cmdDirs, err := filepath.Glob(filepath.Join(dir, "cmd", "*")); err == nil {
+		pkgDirs = append(pkgDirs, cmdDirs...)
+	}
+	var ports []int
+	for _, pkgDir := range pkgDirs {
+		files, _ := filepath.Glob(filepath.Join(pkgDir, "*.go"))
+		for _, f := range files {
+			if strings.HasSuffix(f, "_test.go") {
+				continue
+			}
+			src, err := os.ReadFile(f)
+			if err != nil || !bytes.Contains(src, []byte("package main")) {
+				continue
+			}
+			for _, re := range []*regexp.Regexp{reGoPortDefault, reGoAddr, reGoListen} {
+				for _, m := range re.FindAllSubmatch(src, -1) {
+					ports = append(ports, parseInt(string(m[1])))
+				}
+			}
+		}
+	}
+	return ports, nil
+}
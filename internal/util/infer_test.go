@@ -71,3 +71,144 @@ func TestInferRunOptions_ProcfileNonWebLine(t *testing.T) {
 	// Falls back to first line's port
 	assert.Equal(t, 5555, opts.ContainerPort)
 }
+
+func TestInferProject(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module x\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\nEXPOSE 9000\n"), 0o644))
+	assert.Equal(t, ProjectInfo{Language: "go", Dockerfile: true, ContainerPort: 9000}, InferProject(dir))
+
+	dir = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "requirements.txt"), nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Procfile"), []byte("web: gunicorn app --port 5000\n"), 0o644))
+	assert.Equal(t, ProjectInfo{Language: "python", Procfile: true, ContainerPort: 5000}, InferProject(dir))
+
+	dir = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "App.csproj"), nil, 0o644))
+	assert.Equal(t, "dotnet", InferProject(dir).Language)
+	assert.Equal(t, ProjectInfo{ContainerPort: DefaultContainerPort}, InferProject(t.TempDir()))
+}
+
+func TestInferRunOptions_DockerfileMultipleExpose(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"),
+		[]byte("FROM ubuntu:jammy\nEXPOSE 9090 9091/tcp\nEXPOSE $METRICS_PORT\nexpose 53/udp\n"), 0o644))
+
+	opts := InferRunOptions(dir)
+	assert.Equal(t, 9090, opts.ContainerPort)
+	assert.Equal(t, []int{9090, 9091, 53}, opts.Ports)
+	assert.Equal(t, "9090", opts.Env["PORT"])
+}
+
+func TestInferRunOptions_Compose(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker-compose.yaml"), []byte(`
+services:
+  db:
+    image: postgres:16
+    ports: ["5432:5432"]
+  app:
+    build: .
+    ports:
+      - "127.0.0.1:8081:3000/tcp"
+      - target: 9229
+        published: 9229
+      - "6000-6001:6000-6001"
+    expose: [4000]
+    environment:
+      - NODE_ENV=development
+      - PASSTHROUGH
+`), 0o644))
+
+	opts := InferRunOptions(dir)
+	assert.Equal(t, 3000, opts.ContainerPort)
+	assert.Equal(t, []int{3000, 9229, 4000}, opts.Ports)
+	assert.Equal(t, map[string]string{"PORT": "3000", "NODE_ENV": "development"}, opts.Env)
+}
+
+func TestInferRunOptions_ComposeAmbiguous(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte(`
+services:
+  api: {build: ./api, ports: ["9000:9000"]}
+  web: {build: ./web, ports: ["3000:3000"]}
+`), 0o644))
+
+	assert.Equal(t, DefaultContainerPort, InferRunOptions(dir).ContainerPort)
+}
+
+func TestInferRunOptions_Spring(t *testing.T) {
+	dir := t.TempDir()
+	res := filepath.Join(dir, "src", "main", "resources")
+	require.NoError(t, os.MkdirAll(res, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(res, "application.properties"),
+		[]byte("# web\nspring.application.name=api\nserver.port=${PORT:9000}\n"), 0o644))
+
+	opts := InferRunOptions(dir)
+	assert.Equal(t, 9000, opts.ContainerPort)
+	assert.Equal(t, map[string]string{"PORT": "9000", "SERVER_PORT": "9000"}, opts.Env)
+}
+
+func TestInferRunOptions_QuarkusYAML(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "application.yaml"),
+		[]byte("quarkus:\n  http:\n    port: 8181\n"), 0o644))
+
+	opts := InferRunOptions(dir)
+	assert.Equal(t, 8181, opts.ContainerPort)
+	assert.Equal(t, "8181", opts.Env["QUARKUS_HTTP_PORT"])
+}
+
+func TestInferRunOptions_JavaFrameworkDefault(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pom.xml"),
+		[]byte("<artifactId>spring-boot-starter-web</artifactId>"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("EXPOSE 9999\n"), 0o644))
+
+	opts := InferRunOptions(dir)
+	assert.Equal(t, DefaultContainerPort, opts.ContainerPort)
+	assert.Equal(t, "8080", opts.Env["SERVER_PORT"])
+}
+
+func TestInferRunOptions_PackageJSON(t *testing.T) {
+	tests := []struct {
+		scripts string
+		want    int
+	}{
+		{`{"start": "node server.js --port=4000"}`, 4000},
+		{`{"start": "node server.js", "dev": "vite -p 5173"}`, 5173},
+		{`{"start": "PORT=3001 node index.js"}`, 3001},
+		{`{"start": "next start"}`, 3000},
+		{`{"start": "node server.js"}`, DefaultContainerPort},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "package.json"),
+			[]byte(`{"name": "app", "scripts": `+tt.scripts+`}`), 0o644))
+		assert.Equal(t, tt.want, InferRunOptions(dir).ContainerPort, tt.scripts)
+	}
+}
+
+func TestInferRunOptions_GoMain(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "cmd", "server"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cmd", "server", "main.go"), []byte(`package main
+
+func main() {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8090"
+	}
+	go http.ListenAndServe("127.0.0.1:9100", metrics)
+	srv := &http.Server{Addr: ":" + port}
+	_ = srv.ListenAndServe()
+}
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cmd", "server", "main_test.go"),
+		[]byte("package main\n\nvar addr = \":7777\"\nfunc f() { http.ListenAndServe(\":7777\", nil) }\n"), 0o644))
+
+	opts := InferRunOptions(dir)
+	assert.Equal(t, 8090, opts.ContainerPort)
+	assert.Equal(t, []int{8090, 9100}, opts.Ports)
+}
@@ -0,0 +1,199 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// InterpolationError is a ${VAR:?message} reference whose variable is unset
+// (or empty), or a malformed reference.
+type InterpolationError struct {
+	Name    string
+	Message string
+}
+
+func (e *InterpolationError) Error() string {
+	if e.Name == "" {
+		return e.Message
+	}
+	return e.Name + ": " + e.Message
+}
+
+// Interpolate expands environment variable references in s, as a POSIX
+// shell expands parameters:
+//   - $VAR, ${VAR}        → value of VAR, empty if unset
+//   - ${VAR:-default}     → default if VAR is unset or empty (${VAR-default}: only if unset)
+//   - ${VAR:+alt}         → alt if VAR is set and non-empty (${VAR+alt}: if set)
+//   - ${VAR:?message}     → an error if VAR is unset or empty (${VAR?message}: if unset)
+//   - $$                  → literal $
+//
+// default, alt and message are expanded themselves, so defaults nest:
+// ${A:-${B:-fallback}}. A $ that starts no reference is kept.
+func Interpolate(s string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch next := s[i+1]; {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+		case next == '{':
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				return "", &InterpolationError{Message: fmt.Sprintf("unterminated ${ in %q", s)}
+			}
+			v, err := expandParameter(s[i+2 : end])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+			i = end
+		case isVarNameStart(next):
+			j := i + 1
+			for j < len(s) && isVarNameChar(s[j]) {
+				j++
+			}
+			b.WriteString(os.Getenv(s[i+1 : j]))
+			i = j - 1
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
+
+// closingBrace returns the index of the } that closes the ${ whose body
+// starts at start, skipping nested references; -1 if there is none.
+func closingBrace(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '$':
+			i++
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// expandParameter expands the body of ${...}: a name, optionally followed by
+// an operator (-, +, ?, each optionally preceded by :) and its word.
+func expandParameter(body string) (string, error) {
+	n := 0
+	for n < len(body) && isVarNameChar(body[n]) {
+		n++
+	}
+	name, rest := body[:n], body[n:]
+	if name == "" || !isVarNameStart(name[0]) {
+		return "", &InterpolationError{Message: fmt.Sprintf("invalid variable name in ${%s}", body)}
+	}
+	value, set := os.LookupEnv(name)
+	if rest == "" {
+		return value, nil
+	}
+	if strings.HasPrefix(rest, ":") {
+		// With a colon, an empty value counts as unset.
+		rest = rest[1:]
+		set = set && value != ""
+	}
+	if rest == "" {
+		return "", &InterpolationError{Name: name, Message: fmt.Sprintf("missing operator in ${%s}", body)}
+	}
+	word := rest[1:]
+	switch rest[0] {
+	case '-':
+		if set {
+			return value, nil
+		}
+		return Interpolate(word)
+	case '+':
+		if !set {
+			return "", nil
+		}
+		return Interpolate(word)
+	case '?':
+		if set {
+			return value, nil
+		}
+		msg, err := Interpolate(word)
+		if err != nil {
+			return "", err
+		}
+		if msg == "" {
+			msg = "required but not set"
+		}
+		return "", &InterpolationError{Name: name, Message: msg}
+	}
+	return "", &InterpolationError{Name: name, Message: fmt.Sprintf("unknown operator %q in ${%s}", rest[0], body)}
+}
+
+func isVarNameStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isVarNameChar(c byte) bool {
+	return isVarNameStart(c) || ('0' <= c && c <= '9')
+}
+
+// InterpolateYAML expands variable references (see Interpolate) in the
+// string values of a YAML document; keys are kept as written. Plain values
+// are resolved again, so port: ${PORT:-8080} still reads as a number.
+func InterpolateYAML(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return data, nil
+	}
+	if err := interpolateNode(&doc); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(&doc)
+}
+
+func interpolateNode(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.ShortTag() != "!!str" || !strings.Contains(n.Value, "$") {
+			return nil
+		}
+		v, err := Interpolate(n.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		n.Value = v
+		if n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			n.Tag = ""
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := interpolateNode(n.Content[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		for _, c := range n.Content {
+			if err := interpolateNode(c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
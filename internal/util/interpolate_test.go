@@ -0,0 +1,97 @@
+package util
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestInterpolate_Syntax(t *testing.T) {
+	t.Setenv("OWNER", "acme")
+	t.Setenv("EMPTY", "")
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"ghcr.io/acme", "ghcr.io/acme"},
+		{"ghcr.io/$OWNER/app", "ghcr.io/acme/app"},
+		{"ghcr.io/${OWNER}", "ghcr.io/acme"},
+		{"${UNSET_VAR}", ""},
+		{"${UNSET_VAR:-ghcr.io/x}", "ghcr.io/x"},
+		{"${EMPTY:-fallback}", "fallback"},
+		{"${EMPTY-fallback}", ""},
+		{"${UNSET_VAR-fallback}", "fallback"},
+		{"${OWNER:+-suffix}", "-suffix"},
+		{"${EMPTY:+alt}", ""},
+		{"${EMPTY+alt}", "alt"},
+		{"${UNSET_VAR+alt}", ""},
+		{"${UNSET_VAR:-${OWNER}}", "acme"},
+		{"${UNSET_VAR:-${ALSO_UNSET:-deep}}", "deep"},
+		{"${OWNER:?never}", "acme"},
+		{"cost $$5", "cost $5"},
+		{"$${OWNER}", "${OWNER}"},
+		{"${UNSET_VAR:-a$$b}", "a$b"},
+		{"price: 5$", "price: 5$"},
+		{"$1", "$1"},
+	}
+	for _, tt := range tests {
+		got, err := Interpolate(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+}
+
+func TestInterpolate_Errors(t *testing.T) {
+	t.Setenv("EMPTY", "")
+
+	_, err := Interpolate("${UNSET_VAR:?set it in CI}")
+	var interpErr *InterpolationError
+	require.True(t, errors.As(err, &interpErr))
+	assert.Equal(t, "UNSET_VAR", interpErr.Name)
+	assert.EqualError(t, err, "UNSET_VAR: set it in CI")
+
+	_, err = Interpolate("${EMPTY:?}")
+	assert.EqualError(t, err, "EMPTY: required but not set")
+	v, err := Interpolate("${EMPTY?}")
+	require.NoError(t, err)
+	assert.Empty(t, v)
+
+	_, err = Interpolate("${UNSET_VAR:-${OTHER_UNSET:?nested}}")
+	assert.EqualError(t, err, "OTHER_UNSET: nested")
+
+	for _, in := range []string{"${OWNER", "${}", "${1X}", "${OWNER:}", "${OWNER/x}"} {
+		_, err := Interpolate(in)
+		assert.True(t, errors.As(err, &interpErr), in)
+	}
+}
+
+func TestInterpolateYAML(t *testing.T) {
+	t.Setenv("OWNER", "acme")
+	data, err := InterpolateYAML([]byte(`
+$KEY: ${OWNER}
+port: ${PORT:-8080}
+quoted: "${PORT:-8080}"
+list:
+  - ghcr.io/${OWNER}
+  - cost $$5
+`))
+	require.NoError(t, err)
+
+	var out map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(data, &out))
+	assert.Equal(t, "acme", out["$KEY"])
+	assert.Equal(t, 8080, out["port"])
+	assert.Equal(t, "8080", out["quoted"])
+	assert.Equal(t, []interface{}{"ghcr.io/acme", "cost $5"}, out["list"])
+
+	_, err = InterpolateYAML([]byte("a: b\nrepo: ${OWNER_UNSET:?needed}\n"))
+	assert.EqualError(t, err, "line 2: OWNER_UNSET: needed")
+
+	data, err = InterpolateYAML(nil)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
@@ -0,0 +1,117 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DevWorkload describes a single-container workload rendered for local clusters.
+type DevWorkload struct {
+	Name          string
+	Namespace     string
+	Image         string
+	ContainerPort int
+	Env           map[string]string
+}
+
+var reK8sNameInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// K8sName converts s into a valid Kubernetes resource name (RFC 1123 label).
+// The last path segment and tag of an image reference are dropped:
+//
+//	"ghcr.io/acme/My_App:v1" → "my-app"
+func K8sName(s string) string {
+	if at := strings.Index(s, "@"); at != -1 {
+		s = s[:at]
+	}
+	if slash := strings.LastIndex(s, "/"); slash != -1 {
+		s = s[slash+1:]
+	}
+	if colon := strings.Index(s, ":"); colon != -1 {
+		s = s[:colon]
+	}
+	name := strings.Trim(reK8sNameInvalid.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	if name == "" {
+		name = "app"
+	}
+	return name
+}
+
+// RenderDevManifest renders a minimal Deployment and ClusterIP Service for w
+// as a multi-document YAML string suitable for kubectl apply.
+func RenderDevManifest(w DevWorkload) (string, error) {
+	labels := map[string]string{
+		"app.kubernetes.io/name":       w.Name,
+		"app.kubernetes.io/managed-by": "op",
+	}
+
+	envNames := make([]string, 0, len(w.Env))
+	for k := range w.Env {
+		envNames = append(envNames, k)
+	}
+	sort.Strings(envNames)
+	env := make([]map[string]string, 0, len(envNames))
+	for _, k := range envNames {
+		env = append(env, map[string]string{"name": k, "value": w.Env[k]})
+	}
+
+	meta := map[string]any{"name": w.Name, "labels": labels}
+	if w.Namespace != "" {
+		meta["namespace"] = w.Namespace
+	}
+
+	deployment := map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   meta,
+		"spec": map[string]any{
+			"replicas": 1,
+			"selector": map[string]any{"matchLabels": labels},
+			"template": map[string]any{
+				"metadata": map[string]any{"labels": labels},
+				"spec": map[string]any{
+					"containers": []map[string]any{{
+						"name":            w.Name,
+						"image":           w.Image,
+						"imagePullPolicy": "IfNotPresent",
+						"ports":           []map[string]any{{"containerPort": w.ContainerPort}},
+						"env":             env,
+					}},
+				},
+			},
+		},
+	}
+	service := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   meta,
+		"spec": map[string]any{
+			"selector": labels,
+			"ports": []map[string]any{{
+				"port":       w.ContainerPort,
+				"targetPort": w.ContainerPort,
+			}},
+		},
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, doc := range []any{deployment, service} {
+		if err := enc.Encode(doc); err != nil {
+			return "", fmt.Errorf("rendering manifest for %s: %w", w.Name, err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestK8sName(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{"my-app", "my-app"},
+		{"ghcr.io/acme/My_App:v1", "my-app"},
+		{"localhost:5001/api:latest@sha256:abc", "api"},
+		{"___", "app"},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, K8sName(tc.input), "input=%q", tc.input)
+	}
+	assert.LessOrEqual(t, len(K8sName(strings.Repeat("a", 80))), 63)
+}
+
+func TestRenderDevManifest(t *testing.T) {
+	out, err := RenderDevManifest(DevWorkload{
+		Name:          "api",
+		Namespace:     "dev",
+		Image:         "localhost:5001/api:latest",
+		ContainerPort: 8080,
+		Env:           map[string]string{"PORT": "8080", "A": "1"},
+	})
+	require.NoError(t, err)
+
+	dec := yaml.NewDecoder(strings.NewReader(out))
+	var kinds []string
+	for {
+		var doc map[string]any
+		if err := dec.Decode(&doc); err != nil {
+			break
+		}
+		kinds = append(kinds, doc["kind"].(string))
+		meta := doc["metadata"].(map[string]any)
+		assert.Equal(t, "api", meta["name"])
+		assert.Equal(t, "dev", meta["namespace"])
+	}
+	assert.Equal(t, []string{"Deployment", "Service"}, kinds)
+	assert.Contains(t, out, "image: localhost:5001/api:latest")
+	assert.Contains(t, out, "containerPort: 8080")
+	// Env is sorted for stable output.
+	assert.Less(t, strings.Index(out, "name: A"), strings.Index(out, "name: PORT"))
+}
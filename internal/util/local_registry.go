@@ -0,0 +1,114 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Local registry defaults, used when neither flags, env nor octopilot.yaml set them.
+const (
+	DefaultLocalRegistryHost = "localhost"
+	DefaultLocalRegistryPort = 5001
+	DefaultLocalRegistryName = "octopilot-registry"
+)
+
+// LocalRegistryOpts is the local development registry: where it listens and
+// the name of its container. Set under "local_registry" in octopilot.yaml.
+type LocalRegistryOpts struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	Name string `yaml:"name"`
+}
+
+// localRegistryOverride holds values from the --registry-* flags.
+var localRegistryOverride LocalRegistryOpts
+
+// SetLocalRegistryOverride sets flag values that take precedence over env and
+// config in ResolveLocalRegistry. Zero fields are ignored.
+func SetLocalRegistryOverride(o LocalRegistryOpts) {
+	localRegistryOverride = o
+}
+
+// ResolveLocalRegistry determines the local registry endpoint and container name.
+// Order (per field):
+// 1. --registry-host / --registry-port / --registry-name flags
+// 2. Env vars OP_REGISTRY_HOST, OP_REGISTRY_PORT, OP_REGISTRY_NAME
+// 3. "local_registry" in .github/octopilot.yaml
+// 4. Defaults: localhost, 5001, octopilot-registry
+func ResolveLocalRegistry(cwd string) LocalRegistryOpts {
+	r := LocalRegistryOpts{
+		Host: DefaultLocalRegistryHost,
+		Port: DefaultLocalRegistryPort,
+		Name: DefaultLocalRegistryName,
+	}
+	if cfg, err := LoadRunConfig(cwd); err == nil {
+		r = r.merge(cfg.LocalRegistry)
+	}
+	var env LocalRegistryOpts
+	env.Host = os.Getenv("OP_REGISTRY_HOST")
+	env.Name = os.Getenv("OP_REGISTRY_NAME")
+	if p, err := strconv.Atoi(os.Getenv("OP_REGISTRY_PORT")); err == nil {
+		env.Port = p
+	}
+	return r.merge(env).merge(localRegistryOverride)
+}
+
+func (r LocalRegistryOpts) merge(o LocalRegistryOpts) LocalRegistryOpts {
+	if o.Host != "" {
+		r.Host = o.Host
+	}
+	if o.Port != 0 {
+		r.Port = o.Port
+	}
+	if o.Name != "" {
+		r.Name = o.Name
+	}
+	return r
+}
+
+// Endpoint returns host:port, the registry address used in image references.
+func (r LocalRegistryOpts) Endpoint() string {
+	return fmt.Sprintf("%s:%d", r.Host, r.Port)
+}
+
+// loopbackEndpoints are the addresses that only resolve to the registry from
+// the host itself: the configured endpoint plus localhost/127.0.0.1 on its port.
+func (r LocalRegistryOpts) loopbackEndpoints() []string {
+	eps := []string{r.Endpoint()}
+	for _, h := range []string{"localhost", "127.0.0.1"} {
+		if ep := fmt.Sprintf("%s:%d", h, r.Port); ep != r.Endpoint() {
+			eps = append(eps, ep)
+		}
+	}
+	return eps
+}
+
+// Matches reports whether s (a registry, repo or image reference) points at
+// the local registry.
+func (r LocalRegistryOpts) Matches(s string) bool {
+	for _, ep := range r.loopbackEndpoints() {
+		if s == ep || strings.HasPrefix(s, ep+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// RewriteLocalRegistry replaces host-only references to the local registry in s
+// (localhost:<port>, 127.0.0.1:<port>, the configured endpoint) with target,
+// for use from inside a container. It reports whether s referenced the registry.
+func (r LocalRegistryOpts) RewriteLocalRegistry(s, target string) (string, bool) {
+	if target == "" {
+		return s, false
+	}
+	found := false
+	for _, ep := range r.loopbackEndpoints() {
+		if strings.Contains(s, ep) {
+			found = true
+			s = strings.ReplaceAll(s, ep, target)
+		}
+	}
+	return s, found
+}
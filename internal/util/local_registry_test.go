@@ -0,0 +1,58 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveLocalRegistry_Defaults(t *testing.T) {
+	t.Setenv("OP_REGISTRY_HOST", "")
+	t.Setenv("OP_REGISTRY_PORT", "")
+	t.Setenv("OP_REGISTRY_NAME", "")
+
+	r := ResolveLocalRegistry(t.TempDir())
+	assert.Equal(t, "localhost:5001", r.Endpoint())
+	assert.Equal(t, "octopilot-registry", r.Name)
+}
+
+func TestResolveLocalRegistry_Precedence(t *testing.T) {
+	cwd := t.TempDir()
+	writeRunConfig(t, cwd, `
+local_registry:
+  host: registry.test
+  port: 5002
+  name: op-registry-2
+`)
+	t.Setenv("OP_REGISTRY_HOST", "")
+	t.Setenv("OP_REGISTRY_PORT", "")
+	t.Setenv("OP_REGISTRY_NAME", "")
+
+	r := ResolveLocalRegistry(cwd)
+	assert.Equal(t, LocalRegistryOpts{Host: "registry.test", Port: 5002, Name: "op-registry-2"}, r)
+
+	t.Setenv("OP_REGISTRY_PORT", "5003")
+	r = ResolveLocalRegistry(cwd)
+	assert.Equal(t, "registry.test:5003", r.Endpoint())
+
+	SetLocalRegistryOverride(LocalRegistryOpts{Port: 5004})
+	defer SetLocalRegistryOverride(LocalRegistryOpts{})
+	r = ResolveLocalRegistry(cwd)
+	assert.Equal(t, "registry.test:5004", r.Endpoint())
+	assert.Equal(t, "op-registry-2", r.Name)
+}
+
+func TestRewriteLocalRegistry(t *testing.T) {
+	r := LocalRegistryOpts{Host: "localhost", Port: 5002}
+
+	out, ok := r.RewriteLocalRegistry("127.0.0.1:5002/app:dev", "host.docker.internal:5002")
+	assert.True(t, ok)
+	assert.Equal(t, "host.docker.internal:5002/app:dev", out)
+
+	out, ok = r.RewriteLocalRegistry("localhost:5001/app:dev", "host.docker.internal:5002")
+	assert.False(t, ok)
+	assert.Equal(t, "localhost:5001/app:dev", out)
+
+	_, ok = r.RewriteLocalRegistry("localhost:5002/app", "")
+	assert.False(t, ok)
+}
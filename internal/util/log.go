@@ -0,0 +1,114 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Log formats accepted by --log-format.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Attribute keys shared by every log line about an artifact, so CI log
+// aggregation can filter on them.
+const (
+	LogKeyArtifact = "artifact"
+	LogKeyPlatform = "platform"
+	LogKeyTag      = "tag"
+)
+
+// ParseLogLevel maps --log-level (debug, info, warn, error) to a slog level.
+func ParseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q (expected debug, info, warn or error)", s)
+}
+
+// NewLogHandler returns a text or JSON slog handler writing to w.
+func NewLogHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "", LogFormatText:
+		return slog.NewTextHandler(w, opts), nil
+	case LogFormatJSON:
+		return slog.NewJSONHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q (expected %s or %s)", format, LogFormatText, LogFormatJSON)
+}
+
+// ConfigureLogging installs the default slog logger for --log-format and
+// --log-level, writing to w.
+func ConfigureLogging(w io.Writer, format, level string) error {
+	lvl, err := ParseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	h, err := NewLogHandler(w, format, lvl)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// ArtifactLogger returns the default logger with the artifact field set.
+func ArtifactLogger(artifact string) *slog.Logger {
+	return slog.Default().With(LogKeyArtifact, artifact)
+}
+
+// verbose and quiet are set from -v/--verbose and -q/--quiet.
+var verbose, quiet bool
+
+// SetVerbosity records -v/--verbose and -q/--quiet; they are mutually exclusive.
+func SetVerbosity(v, q bool) error {
+	if v && q {
+		return fmt.Errorf("--verbose and --quiet are mutually exclusive")
+	}
+	verbose, quiet = v, q
+	return nil
+}
+
+// Verbose reports whether -v/--verbose (or OP_DEBUG=true) was given.
+func Verbose() bool {
+	return verbose || os.Getenv("OP_DEBUG") == "true"
+}
+
+// Quiet reports whether -q/--quiet was given.
+func Quiet() bool {
+	return quiet
+}
+
+// DefaultLogLevel is the log level when none is configured: debug with
+// --verbose, warn with --quiet, info otherwise.
+func DefaultLogLevel() string {
+	switch {
+	case Verbose():
+		return "debug"
+	case Quiet():
+		return "warn"
+	}
+	return "info"
+}
+
+// ProgressWriter returns w, or io.Discard with --quiet. Use it for the
+// stdout of builds and other tools whose output is progress, not results;
+// their errors still go to stderr.
+func ProgressWriter(w io.Writer) io.Writer {
+	if quiet {
+		return io.Discard
+	}
+	return w
+}
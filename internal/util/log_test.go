@@ -0,0 +1,63 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	lvl, err := ParseLogLevel("DEBUG")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, lvl)
+	lvl, err = ParseLogLevel("")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelInfo, lvl)
+	_, err = ParseLogLevel("trace")
+	assert.ErrorContains(t, err, `invalid log level "trace"`)
+}
+
+func TestConfigureLogging(t *testing.T) {
+	old := slog.Default()
+	defer slog.SetDefault(old)
+
+	var buf bytes.Buffer
+	require.NoError(t, ConfigureLogging(&buf, LogFormatJSON, "warn"))
+	ArtifactLogger("op").Info("dropped")
+	ArtifactLogger("op").Warn("pushed", LogKeyPlatform, "linux/arm64")
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "pushed", line["msg"])
+	assert.Equal(t, "op", line[LogKeyArtifact])
+	assert.Equal(t, "linux/arm64", line[LogKeyPlatform])
+
+	assert.ErrorContains(t, ConfigureLogging(&buf, "yaml", "info"), `invalid log format "yaml"`)
+}
+
+func TestSetVerbosity(t *testing.T) {
+	defer func() { _ = SetVerbosity(false, false) }()
+	t.Setenv("OP_DEBUG", "")
+
+	assert.ErrorContains(t, SetVerbosity(true, true), "mutually exclusive")
+
+	require.NoError(t, SetVerbosity(true, false))
+	assert.True(t, Verbose())
+	assert.Equal(t, "debug", DefaultLogLevel())
+
+	require.NoError(t, SetVerbosity(false, true))
+	assert.True(t, Quiet())
+	assert.Equal(t, "warn", DefaultLogLevel())
+	var buf bytes.Buffer
+	_, _ = ProgressWriter(&buf).Write([]byte("Step 1/4"))
+	assert.Empty(t, buf.String())
+
+	require.NoError(t, SetVerbosity(false, false))
+	assert.Equal(t, "info", DefaultLogLevel())
+	t.Setenv("OP_DEBUG", "true")
+	assert.True(t, Verbose())
+}
@@ -0,0 +1,497 @@
+package util
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Metric types, as in the Prometheus exposition format.
+const (
+	MetricGauge   = "gauge"
+	MetricCounter = "counter"
+)
+
+// MetricSample is one value recorded during a command.
+type MetricSample struct {
+	Name   string
+	Help   string
+	Type   string // MetricGauge (default) or MetricCounter
+	Labels map[string]string
+	Value  float64
+}
+
+// MetricsConfig selects where metrics are exported. Metrics are opt-in: with
+// no Pushgateway, OTLP endpoint or webhook nothing is recorded.
+type MetricsConfig struct {
+	// Pushgateway is the base URL of a Prometheus Pushgateway.
+	Pushgateway string
+	// OTLPEndpoint is an OTLP/HTTP endpoint; /v1/metrics is appended unless present.
+	OTLPEndpoint string
+	// OTLPHeaders are sent with every OTLP request (e.g. an API key).
+	OTLPHeaders map[string]string
+	// Webhook is a URL the samples are posted to as JSON (see
+	// FormatWebhookMetrics).
+	Webhook string
+	// Labels are added to every sample, e.g. team or service.
+	Labels map[string]string
+}
+
+// Enabled reports whether an exporter is configured.
+func (c MetricsConfig) Enabled() bool {
+	return c.Pushgateway != "" || c.OTLPEndpoint != "" || c.Webhook != ""
+}
+
+// LoadMetricsConfig reads the metrics settings: $OP_METRICS_PUSHGATEWAY,
+// $OP_METRICS_OTLP_ENDPOINT, $OP_METRICS_OTLP_HEADERS (k=v,k=v) and
+// $OP_METRICS_WEBHOOK, else the metrics.* config keys.
+func LoadMetricsConfig() MetricsConfig {
+	cfg := MetricsConfig{
+		Pushgateway:  cmp.Or(os.Getenv("OP_METRICS_PUSHGATEWAY"), viper.GetString("metrics.pushgateway")),
+		OTLPEndpoint: cmp.Or(os.Getenv("OP_METRICS_OTLP_ENDPOINT"), viper.GetString("metrics.otlp_endpoint")),
+		OTLPHeaders:  map[string]string{},
+		Webhook:      cmp.Or(os.Getenv("OP_METRICS_WEBHOOK"), viper.GetString("metrics.webhook")),
+		Labels:       viper.GetStringMapString("metrics.labels"),
+	}
+	headers := viper.GetStringSlice("metrics.otlp_headers")
+	if val := os.Getenv("OP_METRICS_OTLP_HEADERS"); val != "" {
+		headers = strings.Split(val, ",")
+	}
+	for _, h := range headers {
+		if k, v, ok := strings.Cut(h, "="); ok {
+			cfg.OTLPHeaders[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return cfg
+}
+
+// metrics holds the samples of the running command; enabled only after
+// StartMetrics with a configured exporter.
+var metrics struct {
+	sync.Mutex
+	enabled bool
+	cfg     MetricsConfig
+	command string
+	started time.Time
+	samples []MetricSample
+}
+
+// metricsHTTPClient sends the metrics; a var so tests can replace it.
+var metricsHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// StartMetrics begins collecting the metrics of command when cfg has an
+// exporter; otherwise recording is a no-op.
+func StartMetrics(cfg MetricsConfig, command string) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.enabled = cfg.Enabled()
+	metrics.cfg = cfg
+	metrics.command = command
+	metrics.started = time.Now()
+	metrics.samples = nil
+}
+
+// MetricsEnabled reports whether the running command records metrics, so
+// callers can skip work (e.g. registry lookups) only needed for them.
+func MetricsEnabled() bool {
+	metrics.Lock()
+	defer metrics.Unlock()
+	return metrics.enabled
+}
+
+// RecordMetric adds s to the metrics of the running command.
+func RecordMetric(s MetricSample) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	if metrics.enabled {
+		metrics.samples = append(metrics.samples, s)
+	}
+}
+
+// AddMetric adds s.Value to the recorded sample with the same name and
+// labels, or records s; for counters incremented many times in a command.
+func AddMetric(s MetricSample) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	if !metrics.enabled {
+		return
+	}
+	for i, prev := range metrics.samples {
+		if prev.Name == s.Name && maps.Equal(prev.Labels, s.Labels) {
+			metrics.samples[i].Value += s.Value
+			return
+		}
+	}
+	metrics.samples = append(metrics.samples, s)
+}
+
+// RecordBuildCache records the layers a buildpack build reused from and
+// added to its cache; the hit rate is hit / (hit + miss).
+func RecordBuildCache(artifact, platform string, hits, misses int) {
+	for _, r := range []struct {
+		result string
+		n      int
+	}{{"hit", hits}, {"miss", misses}} {
+		RecordMetric(MetricSample{
+			Name:   "op_build_cache_layers_total",
+			Help:   "Layers of a buildpack build reused from (hit) or added to (miss) the cache.",
+			Type:   MetricCounter,
+			Labels: map[string]string{"artifact": artifact, "platform": platform, "result": r.result},
+			Value:  float64(r.n),
+		})
+	}
+}
+
+// RecordImageSize records the compressed size of a pushed image.
+func RecordImageSize(artifact, platform string, size int64) {
+	RecordMetric(MetricSample{
+		Name:   "op_image_size_bytes",
+		Help:   "Compressed size of a pushed image (config and layers).",
+		Labels: map[string]string{"artifact": artifact, "platform": platform},
+		Value:  float64(size),
+	})
+}
+
+// RecordArtifactDuration records how long an artifact took to build and push.
+func RecordArtifactDuration(artifact string, d time.Duration) {
+	RecordMetric(MetricSample{
+		Name:   "op_artifact_build_duration_seconds",
+		Help:   "Time to build and push an artifact.",
+		Labels: map[string]string{"artifact": artifact},
+		Value:  d.Seconds(),
+	})
+}
+
+// RecordDeployment records a rollout of component to environment completed by
+// op watch-deployment, and its lead time (commit to rollout complete) when
+// known (> 0): the DORA deployment frequency and lead time for changes.
+func RecordDeployment(component, environment string, leadTime time.Duration) {
+	labels := map[string]string{"component": component, "environment": environment}
+	RecordMetric(MetricSample{
+		Name:   "op_deployments_total",
+		Help:   "Completed rollouts of a new image.",
+		Type:   MetricCounter,
+		Labels: labels,
+		Value:  1,
+	})
+	if leadTime > 0 {
+		RecordMetric(MetricSample{
+			Name:   "op_deployment_lead_time_seconds",
+			Help:   "Time from the commit to the completed rollout of its image.",
+			Labels: labels,
+			Value:  leadTime.Seconds(),
+		})
+	}
+}
+
+// FailureCategory classifies a command error for metrics: the category of
+// its exit code (see ExitCode), else timeout, canceled, config, auth, network,
+// build or other ("" for nil).
+func FailureCategory(err error) string {
+	if err == nil {
+		return ""
+	}
+	if category, ok := exitCategories[ExitCode(err)]; ok {
+		return category
+	}
+	var interpErr *InterpolationError
+	msg := strings.ToLower(err.Error())
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || strings.Contains(msg, "timed out"):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &interpErr) || containsAny(msg, "config", ".registry", "skaffold.yaml", "unknown flag", "required flag"):
+		return "config"
+	case containsAny(msg, "unauthorized", "denied", "forbidden", "authentication required", "401", "403"):
+		return "auth"
+	case containsAny(msg, "connection refused", "no such host", "i/o timeout", "connection reset", "tls:", "eof"):
+		return "network"
+	case containsAny(msg, "build failed", "failed to build", "pack build", "docker build"):
+		return "build"
+	}
+	return "other"
+}
+
+func containsAny(s string, subs ...string) bool {
+	return slices.ContainsFunc(subs, func(sub string) bool { return strings.Contains(s, sub) })
+}
+
+// FinishMetrics records the duration and outcome of the command started with
+// StartMetrics and exports all samples. Export errors are returned for the
+// caller to log; they never change the command's result.
+func FinishMetrics(cmdErr error) error {
+	metrics.Lock()
+	if !metrics.enabled {
+		metrics.Unlock()
+		return nil
+	}
+	metrics.enabled = false
+	cfg, command, started := metrics.cfg, metrics.command, metrics.started
+	samples := metrics.samples
+	metrics.Unlock()
+
+	result := "success"
+	if cmdErr != nil {
+		result = "failure"
+	}
+	samples = append(samples, MetricSample{
+		Name:   "op_command_duration_seconds",
+		Help:   "Duration of an op command.",
+		Labels: map[string]string{"result": result},
+		Value:  time.Since(started).Seconds(),
+	})
+	if cmdErr != nil {
+		samples = append(samples, MetricSample{
+			Name:   "op_command_failures_total",
+			Help:   "Failed op commands by category.",
+			Type:   MetricCounter,
+			Labels: map[string]string{"category": FailureCategory(cmdErr)},
+			Value:  1,
+		})
+	}
+
+	common := metricsCommonLabels(cfg, command)
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	var errs []error
+	if cfg.Pushgateway != "" {
+		errs = append(errs, pushPrometheusMetrics(ctx, cfg.Pushgateway, common, samples))
+	}
+	if cfg.OTLPEndpoint != "" {
+		errs = append(errs, pushOTLPMetrics(ctx, cfg.OTLPEndpoint, cfg.OTLPHeaders, common, samples))
+	}
+	if cfg.Webhook != "" {
+		errs = append(errs, pushWebhookMetrics(ctx, cfg.Webhook, common, samples))
+	}
+	return errors.Join(errs...)
+}
+
+// metricsCommonLabels are the labels of every sample: the command, the
+// repository and CI provider when known, and the configured labels.
+func metricsCommonLabels(cfg MetricsConfig, command string) map[string]string {
+	labels := map[string]string{"command": command}
+	if repo := CIRepository(); repo != "" {
+		labels["repository"] = repo
+	}
+	if ci := CIProvider(); ci != "" {
+		labels["ci"] = ci
+	}
+	maps.Copy(labels, cfg.Labels)
+	return labels
+}
+
+// groupMetrics returns the sample names in first-recorded order and the
+// samples of each name.
+func groupMetrics(samples []MetricSample) ([]string, map[string][]MetricSample) {
+	var names []string
+	byName := map[string][]MetricSample{}
+	for _, s := range samples {
+		if _, ok := byName[s.Name]; !ok {
+			names = append(names, s.Name)
+		}
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+	return names, byName
+}
+
+// FormatPrometheusMetrics renders samples in the Prometheus text exposition
+// format, with common labels added to each.
+func FormatPrometheusMetrics(common map[string]string, samples []MetricSample) string {
+	var b strings.Builder
+	names, byName := groupMetrics(samples)
+	for _, name := range names {
+		group := byName[name]
+		typ := group[0].Type
+		if typ == "" {
+			typ = MetricGauge
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, group[0].Help, name, typ)
+		for _, s := range group {
+			labels := maps.Clone(common)
+			maps.Copy(labels, s.Labels)
+			var pairs []string
+			for _, k := range slices.Sorted(maps.Keys(labels)) {
+				pairs = append(pairs, fmt.Sprintf("%s=%s", k, strconv.Quote(labels[k])))
+			}
+			fmt.Fprintf(&b, "%s{%s} %s\n", name, strings.Join(pairs, ","), strconv.FormatFloat(s.Value, 'g', -1, 64))
+		}
+	}
+	return b.String()
+}
+
+// pushPrometheusMetrics pushes samples to a Pushgateway, grouped by job "op",
+// command and repository so repositories do not overwrite each other.
+func pushPrometheusMetrics(ctx context.Context, gateway string, common map[string]string, samples []MetricSample) error {
+	u := strings.TrimSuffix(gateway, "/") + "/metrics/job/op"
+	for _, k := range []string{"command", "repository"} {
+		if v := common[k]; v != "" {
+			// Values may contain slashes (org/repo), so they are base64-encoded.
+			u += "/" + k + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(v))
+		}
+	}
+	body := FormatPrometheusMetrics(common, samples)
+	return sendMetrics(ctx, u, "text/plain; version=0.0.4", nil, []byte(body))
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+// otlpTemporalityDelta is AGGREGATION_TEMPORALITY_DELTA: each export carries
+// the counts of one command.
+const otlpTemporalityDelta = 1
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+}
+
+func otlpAttributes(labels map[string]string) []otlpAttribute {
+	var attrs []otlpAttribute
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		a := otlpAttribute{Key: k}
+		a.Value.StringValue = labels[k]
+		attrs = append(attrs, a)
+	}
+	return attrs
+}
+
+// FormatOTLPMetrics renders samples as an OTLP/HTTP JSON export request:
+// common labels become resource attributes, gauges gauges and counters
+// monotonic delta sums.
+func FormatOTLPMetrics(common map[string]string, samples []MetricSample, now time.Time) ([]byte, error) {
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+	names, byName := groupMetrics(samples)
+	var out []otlpMetric
+	for _, name := range names {
+		group := byName[name]
+		var points []otlpDataPoint
+		for _, s := range group {
+			points = append(points, otlpDataPoint{Attributes: otlpAttributes(s.Labels), TimeUnixNano: ts, AsDouble: s.Value})
+		}
+		m := otlpMetric{Name: name, Description: group[0].Help}
+		if group[0].Type == MetricCounter {
+			m.Sum = &otlpSum{DataPoints: points, AggregationTemporality: otlpTemporalityDelta, IsMonotonic: true}
+		} else {
+			m.Gauge = &otlpGauge{DataPoints: points}
+		}
+		out = append(out, m)
+	}
+	resource := otlpAttributes(common)
+	svc := otlpAttribute{Key: "service.name"}
+	svc.Value.StringValue = "op"
+	resource = append([]otlpAttribute{svc}, resource...)
+	return json.Marshal(map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource": map[string]any{"attributes": resource},
+			"scopeMetrics": []any{map[string]any{
+				"scope":   map[string]any{"name": "github.com/octopilot/octopilot-pipeline-tools"},
+				"metrics": out,
+			}},
+		}},
+	})
+}
+
+func pushOTLPMetrics(ctx context.Context, endpoint string, headers, common map[string]string, samples []MetricSample) error {
+	body, err := FormatOTLPMetrics(common, samples, time.Now())
+	if err != nil {
+		return err
+	}
+	u := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(u, "/v1/metrics") {
+		u += "/v1/metrics"
+	}
+	return sendMetrics(ctx, u, "application/json", headers, body)
+}
+
+// webhookSample is a sample in the webhook payload.
+type webhookSample struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// FormatWebhookMetrics renders samples as the JSON body posted to a metrics
+// webhook: the time, the common labels and each sample with its own labels.
+func FormatWebhookMetrics(common map[string]string, samples []MetricSample, now time.Time) ([]byte, error) {
+	out := make([]webhookSample, 0, len(samples))
+	for _, s := range samples {
+		out = append(out, webhookSample{Name: s.Name, Type: cmp.Or(s.Type, MetricGauge), Labels: s.Labels, Value: s.Value})
+	}
+	return json.Marshal(map[string]any{
+		"time":    now.UTC().Format(time.RFC3339),
+		"labels":  common,
+		"metrics": out,
+	})
+}
+
+func pushWebhookMetrics(ctx context.Context, target string, common map[string]string, samples []MetricSample) error {
+	body, err := FormatWebhookMetrics(common, samples, time.Now())
+	if err != nil {
+		return err
+	}
+	return sendMetrics(ctx, target, "application/json", nil, body)
+}
+
+func sendMetrics(ctx context.Context, target, contentType string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := metricsHTTPClient.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			// Keep the URL (which may carry credentials) out of the message.
+			err = uerr.Err
+		}
+		return fmt.Errorf("exporting metrics to %s: %w", req.URL.Host, err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("exporting metrics to %s: status %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
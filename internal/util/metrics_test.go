@@ -0,0 +1,192 @@
+package util
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMetricsConfig_Env(t *testing.T) {
+	t.Setenv("OP_METRICS_PUSHGATEWAY", "http://pushgateway:9091")
+	t.Setenv("OP_METRICS_OTLP_ENDPOINT", "")
+	t.Setenv("OP_METRICS_OTLP_HEADERS", "x-api-key=secret, x-team = platform")
+
+	cfg := LoadMetricsConfig()
+	assert.True(t, cfg.Enabled())
+	assert.Equal(t, "http://pushgateway:9091", cfg.Pushgateway)
+	assert.Empty(t, cfg.OTLPEndpoint)
+	assert.Equal(t, map[string]string{"x-api-key": "secret", "x-team": "platform"}, cfg.OTLPHeaders)
+
+	assert.False(t, MetricsConfig{}.Enabled())
+}
+
+func TestRecordMetric_DisabledIsNoop(t *testing.T) {
+	StartMetrics(MetricsConfig{}, "build")
+	RecordImageSize("app", "", 100)
+	assert.False(t, MetricsEnabled())
+	assert.Empty(t, metrics.samples)
+	assert.NoError(t, FinishMetrics(errors.New("boom")))
+}
+
+func TestFailureCategory(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{fmt.Errorf("timed out after 10m0s: %w", context.DeadlineExceeded), "timeout"},
+		{context.Canceled, "canceled"},
+		{&InterpolationError{Name: "REPO", Message: "required but not set"}, "config"},
+		{errors.New("failed to parse skaffold.yaml"), "config"},
+		{errors.New("GET https://ghcr.io/v2/: UNAUTHORIZED: authentication required"), "auth"},
+		{errors.New("dial tcp: lookup ghcr.io: no such host"), "network"},
+		{errors.New("pack build failed for app"), "build"},
+		{errors.New("something else"), "other"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, FailureCategory(tt.err), fmt.Sprint(tt.err))
+	}
+}
+
+func TestFormatPrometheusMetrics(t *testing.T) {
+	out := FormatPrometheusMetrics(map[string]string{"command": "build"}, []MetricSample{
+		{Name: "op_image_size_bytes", Help: "Size.", Labels: map[string]string{"artifact": "app"}, Value: 1024},
+		{Name: "op_build_cache_layers_total", Help: "Cache.", Type: MetricCounter, Labels: map[string]string{"result": "hit"}, Value: 3},
+		{Name: "op_image_size_bytes", Help: "Size.", Labels: map[string]string{"artifact": "api"}, Value: 0.5},
+	})
+	assert.Equal(t, `# HELP op_image_size_bytes Size.
+# TYPE op_image_size_bytes gauge
+op_image_size_bytes{artifact="app",command="build"} 1024
+op_image_size_bytes{artifact="api",command="build"} 0.5
+# HELP op_build_cache_layers_total Cache.
+# TYPE op_build_cache_layers_total counter
+op_build_cache_layers_total{command="build",result="hit"} 3
+`, out)
+}
+
+func TestFormatOTLPMetrics(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	data, err := FormatOTLPMetrics(map[string]string{"command": "build"}, []MetricSample{
+		{Name: "op_command_duration_seconds", Labels: map[string]string{"result": "success"}, Value: 12.5},
+		{Name: "op_command_failures_total", Type: MetricCounter, Labels: map[string]string{"category": "auth"}, Value: 1},
+	}, now)
+	require.NoError(t, err)
+
+	var req struct {
+		ResourceMetrics []struct {
+			Resource struct {
+				Attributes []otlpAttribute `json:"attributes"`
+			} `json:"resource"`
+			ScopeMetrics []struct {
+				Metrics []otlpMetric `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	require.NoError(t, json.Unmarshal(data, &req))
+	require.Len(t, req.ResourceMetrics, 1)
+	rm := req.ResourceMetrics[0]
+	require.Len(t, rm.Resource.Attributes, 2)
+	assert.Equal(t, "service.name", rm.Resource.Attributes[0].Key)
+	assert.Equal(t, "op", rm.Resource.Attributes[0].Value.StringValue)
+	assert.Equal(t, "command", rm.Resource.Attributes[1].Key)
+
+	ms := rm.ScopeMetrics[0].Metrics
+	require.Len(t, ms, 2)
+	require.NotNil(t, ms[0].Gauge)
+	assert.Nil(t, ms[0].Sum)
+	assert.Equal(t, 12.5, ms[0].Gauge.DataPoints[0].AsDouble)
+	assert.Equal(t, "1700000000000000000", ms[0].Gauge.DataPoints[0].TimeUnixNano)
+	require.NotNil(t, ms[1].Sum)
+	assert.True(t, ms[1].Sum.IsMonotonic)
+	assert.Equal(t, otlpTemporalityDelta, ms[1].Sum.AggregationTemporality)
+	assert.Equal(t, "category", ms[1].Sum.DataPoints[0].Attributes[0].Key)
+}
+
+func TestFinishMetrics_Exports(t *testing.T) {
+	t.Setenv("GITHUB_REPOSITORY", "acme/app")
+	t.Setenv("GITHUB_ACTIONS", "")
+	t.Setenv("GITLAB_CI", "")
+	t.Setenv("CI", "")
+	type request struct {
+		path, contentType, apiKey, body string
+	}
+	var got []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = append(got, request{r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("x-api-key"), string(body)})
+	}))
+	defer srv.Close()
+
+	StartMetrics(MetricsConfig{
+		Pushgateway:  srv.URL,
+		OTLPEndpoint: srv.URL + "/otlp",
+		OTLPHeaders:  map[string]string{"x-api-key": "secret"},
+	}, "build")
+	assert.True(t, MetricsEnabled())
+	RecordBuildCache("app", "linux/amd64", 3, 1)
+	require.NoError(t, FinishMetrics(errors.New("pack build failed")))
+	assert.False(t, MetricsEnabled())
+
+	require.Len(t, got, 2)
+	b64 := base64.RawURLEncoding.EncodeToString
+	assert.Equal(t, "/metrics/job/op/command@base64/"+b64([]byte("build"))+"/repository@base64/"+b64([]byte("acme/app")), got[0].path)
+	assert.Contains(t, got[0].contentType, "text/plain")
+	assert.Contains(t, got[0].body, `op_build_cache_layers_total{artifact="app",command="build",platform="linux/amd64",repository="acme/app",result="miss"} 1`)
+	assert.Contains(t, got[0].body, `op_command_failures_total{category="build",command="build",repository="acme/app"} 1`)
+	assert.Contains(t, got[0].body, `op_command_duration_seconds{command="build",repository="acme/app",result="failure"}`)
+
+	assert.Equal(t, "/otlp/v1/metrics", got[1].path)
+	assert.Equal(t, "application/json", got[1].contentType)
+	assert.Equal(t, "secret", got[1].apiKey)
+	assert.Contains(t, got[1].body, `"op_command_failures_total"`)
+}
+
+func TestFinishMetrics_ExportError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	StartMetrics(MetricsConfig{Pushgateway: srv.URL}, "promote")
+	err := FinishMetrics(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "502")
+}
+
+func TestFinishMetrics_Webhook(t *testing.T) {
+	t.Setenv("GITHUB_REPOSITORY", "acme/app")
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	StartMetrics(MetricsConfig{Webhook: srv.URL + "/hooks/dora"}, "watch-deployment")
+	RecordDeployment("api", "prod", 90*time.Minute)
+	RecordDeployment("web", "prod", 0)
+	require.NoError(t, FinishMetrics(nil))
+
+	var got struct {
+		Labels  map[string]string `json:"labels"`
+		Metrics []webhookSample   `json:"metrics"`
+	}
+	require.NoError(t, json.Unmarshal(body, &got))
+	assert.Equal(t, "watch-deployment", got.Labels["command"])
+	assert.Equal(t, "acme/app", got.Labels["repository"])
+	require.Len(t, got.Metrics, 4, "two deployments, one lead time, the command duration")
+	assert.Equal(t, webhookSample{Name: "op_deployments_total", Type: MetricCounter, Labels: map[string]string{"component": "api", "environment": "prod"}, Value: 1}, got.Metrics[0])
+	assert.Equal(t, webhookSample{Name: "op_deployment_lead_time_seconds", Type: MetricGauge, Labels: map[string]string{"component": "api", "environment": "prod"}, Value: 5400}, got.Metrics[1])
+	assert.Equal(t, "op_deployments_total", got.Metrics[2].Name)
+	assert.Equal(t, "web", got.Metrics[2].Labels["component"])
+}
@@ -0,0 +1,517 @@
+package util
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// Federation providers of RegistryOIDC.
+const (
+	OIDCProviderGCP   = "gcp"
+	OIDCProviderAWS   = "aws"
+	OIDCProviderAzure = "azure"
+)
+
+// acrTokenUser is the username ACR pairs with a refresh token.
+const acrTokenUser = "00000000-0000-0000-0000-000000000000"
+
+// azureManagementResource is the resource of the Entra ID token ACR exchanges
+// for a refresh token.
+const azureManagementResource = "https://management.azure.com/"
+
+// RegistryOIDC configures workload identity federation for a .registry entry:
+// op exchanges the CI OIDC token for short-lived registry credentials, so no
+// registry secret is stored.
+type RegistryOIDC struct {
+	// Provider is gcp, aws or azure; inferred from the registry host when empty.
+	Provider string `yaml:"provider"`
+	// WorkloadIdentityProvider is the GCP provider resource name:
+	// projects/<number>/locations/global/workloadIdentityPools/<pool>/providers/<provider>.
+	WorkloadIdentityProvider string `yaml:"workload_identity_provider"`
+	// ServiceAccount is impersonated with the federated token (GCP); without
+	// it the federated identity itself needs access to the repository.
+	ServiceAccount string `yaml:"service_account"`
+	// RoleARN is the IAM role assumed with the token (AWS).
+	RoleARN string `yaml:"role_arn"`
+	// Region overrides the region read from the ECR host (AWS).
+	Region string `yaml:"region"`
+	// Audience overrides the audience the OIDC token is requested for.
+	Audience string `yaml:"audience"`
+	// TenantID and ClientID select the Entra ID tenant and the service
+	// principal or user-assigned managed identity (Azure; default:
+	// AZURE_TENANT_ID and AZURE_CLIENT_ID).
+	TenantID string `yaml:"tenant_id"`
+	ClientID string `yaml:"client_id"`
+}
+
+func (o *RegistryOIDC) interpolated() (*RegistryOIDC, error) {
+	if o == nil {
+		return nil, nil
+	}
+	out := *o
+	for _, f := range []*string{&out.Provider, &out.WorkloadIdentityProvider, &out.ServiceAccount, &out.RoleARN, &out.Region, &out.Audience, &out.TenantID, &out.ClientID} {
+		v, err := Interpolate(*f)
+		if err != nil {
+			return nil, err
+		}
+		*f = strings.TrimSpace(v)
+	}
+	return &out, nil
+}
+
+// provider returns the federation provider for registry.
+func (o *RegistryOIDC) provider(registry string) string {
+	if o.Provider != "" {
+		return o.Provider
+	}
+	host := strings.Split(registry, "/")[0]
+	switch {
+	case host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") || strings.HasSuffix(host, "-docker.pkg.dev"):
+		return OIDCProviderGCP
+	case strings.Contains(host, ".dkr.ecr."):
+		return OIDCProviderAWS
+	case isACRHost(host):
+		return OIDCProviderAzure
+	}
+	return ""
+}
+
+// isACRHost reports whether host is an Azure Container Registry.
+func isACRHost(host string) bool {
+	return strings.HasSuffix(host, ".azurecr.io")
+}
+
+// audience returns the audience of the OIDC token: the one GCP and AWS
+// expect by default unless set.
+func (o *RegistryOIDC) audience(provider string) string {
+	if o.Audience != "" {
+		return o.Audience
+	}
+	if provider == OIDCProviderGCP {
+		return "https://iam.googleapis.com/" + o.WorkloadIdentityProvider
+	}
+	return "sts.amazonaws.com"
+}
+
+// Endpoints of the token exchanges; vars so tests can point them at a fake.
+var (
+	oidcHTTPClient       = &http.Client{Timeout: 30 * time.Second}
+	gcpSTSURL            = "https://sts.googleapis.com/v1/token"
+	gcpIAMCredentialsURL = "https://iamcredentials.googleapis.com/v1"
+	awsSTSURL            = func(region string) string { return "https://sts." + region + ".amazonaws.com/" }
+	awsECRURL            = func(region string) string { return "https://api.ecr." + region + ".amazonaws.com/" }
+	azureLoginURL        = "https://login.microsoftonline.com"
+	azureIMDSURL         = "http://169.254.169.254/metadata/identity/oauth2/token"
+	acrExchangeURL       = func(host string) string { return "https://" + host + "/oauth2/exchange" }
+)
+
+// CIOIDCToken returns an OIDC ID token of the CI job for audience: $OP_OIDC_TOKEN
+// when set (e.g. a GitLab id_tokens entry, whose audience is set in the job),
+// else one requested from GitHub Actions (needs permissions: id-token: write).
+func CIOIDCToken(ctx context.Context, audience string) (string, error) {
+	if token := os.Getenv("OP_OIDC_TOKEN"); token != "" {
+		return token, nil
+	}
+	reqURL, reqToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"), os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	if reqURL == "" || reqToken == "" {
+		return "", fmt.Errorf("no CI OIDC token: set OP_OIDC_TOKEN (GitLab id_tokens) or grant the GitHub Actions job `permissions: id-token: write`")
+	}
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("audience", audience)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+reqToken)
+	var out struct {
+		Value string `json:"value"`
+	}
+	if err := doOIDCRequest(req, "requesting GitHub Actions OIDC token", &out); err != nil {
+		return "", err
+	}
+	return out.Value, nil
+}
+
+// oidcCredentials are registry credentials obtained by federation.
+type oidcCredentials struct {
+	Username, Password string
+	Expires            time.Time
+}
+
+// RegistryOIDCCredentials exchanges the CI OIDC token for credentials to
+// registry (a host or repository) as o configures.
+func RegistryOIDCCredentials(ctx context.Context, registry string, o *RegistryOIDC) (username, password string, err error) {
+	creds, err := exchangeOIDC(ctx, registry, o)
+	return creds.Username, creds.Password, err
+}
+
+func exchangeOIDC(ctx context.Context, registry string, o *RegistryOIDC) (oidcCredentials, error) {
+	provider := o.provider(registry)
+	switch provider {
+	case OIDCProviderGCP, OIDCProviderAWS:
+	case OIDCProviderAzure:
+		return azureACRCredentials(ctx, registry, o)
+	default:
+		return oidcCredentials{}, fmt.Errorf("oidc: cannot infer the provider of %s; set provider: gcp, aws or azure", registry)
+	}
+	token, err := CIOIDCToken(ctx, o.audience(provider))
+	if err != nil {
+		return oidcCredentials{}, err
+	}
+	if provider == OIDCProviderGCP {
+		return gcpFederatedCredentials(ctx, o, token)
+	}
+	return awsECRCredentials(ctx, registry, o, token)
+}
+
+// gcpFederatedCredentials exchanges token with Google STS and, with a service
+// account, impersonates it; Artifact Registry and GCR take the access token
+// as the password of oauth2accesstoken.
+func gcpFederatedCredentials(ctx context.Context, o *RegistryOIDC, token string) (oidcCredentials, error) {
+	if o.WorkloadIdentityProvider == "" {
+		return oidcCredentials{}, fmt.Errorf("oidc: workload_identity_provider is required for gcp")
+	}
+	body, _ := json.Marshal(map[string]string{
+		"audience":           "//iam.googleapis.com/" + o.WorkloadIdentityProvider,
+		"grantType":          "urn:ietf:params:oauth:grant-type:token-exchange",
+		"requestedTokenType": "urn:ietf:params:oauth:token-type:access_token",
+		"scope":              "https://www.googleapis.com/auth/cloud-platform",
+		"subjectTokenType":   "urn:ietf:params:oauth:token-type:jwt",
+		"subjectToken":       token,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, gcpSTSURL, bytes.NewReader(body))
+	if err != nil {
+		return oidcCredentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var sts struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := doOIDCRequest(req, "exchanging the OIDC token with Google STS", &sts); err != nil {
+		return oidcCredentials{}, err
+	}
+	creds := oidcCredentials{Username: "oauth2accesstoken", Password: sts.AccessToken, Expires: time.Now().Add(time.Duration(sts.ExpiresIn) * time.Second)}
+	if o.ServiceAccount == "" {
+		return creds, nil
+	}
+
+	body, _ = json.Marshal(map[string][]string{"scope": {"https://www.googleapis.com/auth/cloud-platform"}})
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/projects/-/serviceAccounts/%s:generateAccessToken", gcpIAMCredentialsURL, url.PathEscape(o.ServiceAccount)), bytes.NewReader(body))
+	if err != nil {
+		return oidcCredentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+sts.AccessToken)
+	var sa struct {
+		AccessToken string    `json:"accessToken"`
+		ExpireTime  time.Time `json:"expireTime"`
+	}
+	if err := doOIDCRequest(req, "impersonating "+o.ServiceAccount, &sa); err != nil {
+		return oidcCredentials{}, err
+	}
+	return oidcCredentials{Username: "oauth2accesstoken", Password: sa.AccessToken, Expires: sa.ExpireTime}, nil
+}
+
+// awsECRCredentials assumes o.RoleARN with token (AssumeRoleWithWebIdentity
+// needs no AWS credentials) and gets an ECR authorization token with the
+// temporary credentials.
+func awsECRCredentials(ctx context.Context, registry string, o *RegistryOIDC, token string) (oidcCredentials, error) {
+	if o.RoleARN == "" {
+		return oidcCredentials{}, fmt.Errorf("oidc: role_arn is required for aws")
+	}
+	region := o.Region
+	if region == "" {
+		// <account>.dkr.ecr.<region>.amazonaws.com
+		if parts := strings.Split(strings.Split(registry, "/")[0], "."); len(parts) > 3 && parts[1] == "dkr" {
+			region = parts[3]
+		}
+	}
+	if region == "" {
+		return oidcCredentials{}, fmt.Errorf("oidc: set region for %s", registry)
+	}
+
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {o.RoleARN},
+		"RoleSessionName":  {"op-" + strings.NewReplacer("/", "-", "_", "-").Replace(cmp.Or(os.Getenv("GITHUB_RUN_ID"), os.Getenv("CI_JOB_ID"), os.Getenv("BUILD_BUILDID"), "session"))},
+		"WebIdentityToken": {token},
+		"DurationSeconds":  {"3600"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, awsSTSURL(region), strings.NewReader(form.Encode()))
+	if err != nil {
+		return oidcCredentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var sts struct {
+		Credentials struct {
+			AccessKeyID     string `xml:"AccessKeyId"`
+			SecretAccessKey string `xml:"SecretAccessKey"`
+			SessionToken    string `xml:"SessionToken"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := doOIDCRequest(req, "assuming "+o.RoleARN, &sts); err != nil {
+		return oidcCredentials{}, err
+	}
+
+	body := []byte("{}")
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, awsECRURL(region), bytes.NewReader(body))
+	if err != nil {
+		return oidcCredentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+	req.Header.Set("X-Amz-Security-Token", sts.Credentials.SessionToken)
+	signAWSRequest(req, body, sts.Credentials.AccessKeyID, sts.Credentials.SecretAccessKey, region, "ecr", time.Now())
+	var ecr struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"`
+		} `json:"authorizationData"`
+	}
+	if err := doOIDCRequest(req, "getting an ECR authorization token", &ecr); err != nil {
+		return oidcCredentials{}, err
+	}
+	if len(ecr.AuthorizationData) == 0 {
+		return oidcCredentials{}, fmt.Errorf("getting an ECR authorization token: empty response")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(ecr.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return oidcCredentials{}, fmt.Errorf("decoding the ECR authorization token: %w", err)
+	}
+	user, pass, _ := strings.Cut(string(decoded), ":")
+	return oidcCredentials{Username: user, Password: pass, Expires: time.Unix(int64(ecr.AuthorizationData[0].ExpiresAt), 0)}, nil
+}
+
+// azureACRCredentials gets an Entra ID token for the service principal of
+// AZURE_CLIENT_SECRET or, without one, for the managed identity of the
+// machine, and exchanges it for an ACR refresh token, which ACR takes as the
+// password of the null GUID user.
+func azureACRCredentials(ctx context.Context, registry string, o *RegistryOIDC) (oidcCredentials, error) {
+	tenant, clientID := cmp.Or(o.TenantID, os.Getenv("AZURE_TENANT_ID")), cmp.Or(o.ClientID, os.Getenv("AZURE_CLIENT_ID"))
+	var req *http.Request
+	var err error
+	var what string
+	if secret := os.Getenv("AZURE_CLIENT_SECRET"); secret != "" {
+		if tenant == "" || clientID == "" {
+			return oidcCredentials{}, fmt.Errorf("oidc: AZURE_CLIENT_SECRET needs tenant_id and client_id (or AZURE_TENANT_ID and AZURE_CLIENT_ID)")
+		}
+		form := url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {clientID},
+			"client_secret": {secret},
+			"scope":         {azureManagementResource + ".default"},
+		}
+		if req, err = http.NewRequestWithContext(ctx, http.MethodPost, azureLoginURL+"/"+tenant+"/oauth2/v2.0/token", strings.NewReader(form.Encode())); err != nil {
+			return oidcCredentials{}, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		what = "getting an Entra ID token for " + clientID
+	} else {
+		q := url.Values{"api-version": {"2018-02-01"}, "resource": {azureManagementResource}}
+		if clientID != "" {
+			q.Set("client_id", clientID)
+		}
+		if req, err = http.NewRequestWithContext(ctx, http.MethodGet, azureIMDSURL+"?"+q.Encode(), nil); err != nil {
+			return oidcCredentials{}, err
+		}
+		req.Header.Set("Metadata", "true")
+		what = "getting a managed identity token (set AZURE_CLIENT_SECRET to use a service principal)"
+	}
+	var aad struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"` // a string from the managed identity endpoint
+	}
+	if err := doOIDCRequest(req, what, &aad); err != nil {
+		return oidcCredentials{}, err
+	}
+
+	host := strings.Split(registry, "/")[0]
+	form := url.Values{"grant_type": {"access_token"}, "service": {host}, "access_token": {aad.AccessToken}}
+	if tenant != "" {
+		form.Set("tenant", tenant)
+	}
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, acrExchangeURL(host), strings.NewReader(form.Encode())); err != nil {
+		return oidcCredentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var acr struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := doOIDCRequest(req, "exchanging the Entra ID token with "+host, &acr); err != nil {
+		return oidcCredentials{}, err
+	}
+	expiresIn, _ := aad.ExpiresIn.Int64()
+	return oidcCredentials{Username: acrTokenUser, Password: acr.RefreshToken, Expires: time.Now().Add(time.Duration(cmp.Or(expiresIn, 3600)) * time.Second)}, nil
+}
+
+// signAWSRequest adds an AWS Signature Version 4 Authorization header, signing
+// the host and the Content-Type and X-Amz-* headers.
+func signAWSRequest(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "content-type" || strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := slices.Sorted(maps.Keys(headers))
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonical := strings.Join([]string{req.Method, path, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, hex.EncodeToString(bodyHash[:])}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// doOIDCRequest sends req and decodes a JSON (or, for AWS STS, XML) response
+// into out; what describes the step in errors.
+func doOIDCRequest(req *http.Request, what string, out interface{}) error {
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s: %s", what, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if strings.Contains(resp.Header.Get("Content-Type"), "xml") || bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		err = xml.Unmarshal(data, out)
+	} else {
+		err = json.Unmarshal(data, out)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	return nil
+}
+
+// RegistryOIDCConfig returns the oidc settings of the .registry entry in
+// repoRoot that target (a registry host or repository) belongs to. An ACR
+// registry without settings uses the service principal of AZURE_CLIENT_ID,
+// AZURE_TENANT_ID and AZURE_CLIENT_SECRET when they are set.
+func RegistryOIDCConfig(repoRoot, target string) (*RegistryOIDC, bool) {
+	target = strings.TrimSuffix(target, "/")
+	if raw := readRegistryFile(repoRoot); raw != nil {
+		for _, e := range raw.entries() {
+			if e.OIDC == nil {
+				continue
+			}
+			host := strings.Split(e.Registry, "/")[0]
+			if target == e.Registry || strings.HasPrefix(target, e.Registry+"/") || target == host {
+				return e.OIDC, true
+			}
+		}
+	}
+	if isACRHost(strings.Split(target, "/")[0]) && os.Getenv("AZURE_CLIENT_SECRET") != "" {
+		return &RegistryOIDC{Provider: OIDCProviderAzure}, true
+	}
+	return nil, false
+}
+
+// oidcCacheKey identifies cached credentials: ACR refresh tokens are valid
+// for one registry only, so the host is part of the key.
+type oidcCacheKey struct {
+	cfg  RegistryOIDC
+	host string
+}
+
+// oidcKeychain resolves credentials for registries with oidc settings in
+// .registry, caching them until shortly before they expire.
+type oidcKeychain struct {
+	mu    sync.Mutex
+	cache map[oidcCacheKey]oidcCredentials
+}
+
+// Resolve implements authn.Keychain; registries without oidc settings are
+// anonymous, so the next keychain answers.
+func (k *oidcKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	return k.ResolveContext(context.Background(), target)
+}
+
+// ResolveContext implements authn.ContextKeychain: remote calls pass their
+// context, so the token exchange is cancelled with them.
+func (k *oidcKeychain) ResolveContext(ctx context.Context, target authn.Resource) (authn.Authenticator, error) {
+	cfg, ok := RegistryOIDCConfig("", target.String())
+	if !ok {
+		return authn.Anonymous, nil
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key := oidcCacheKey{cfg: *cfg, host: target.RegistryStr()}
+	creds, ok := k.cache[key]
+	if !ok || time.Until(creds.Expires) < time.Minute {
+		var err error
+		if creds, err = exchangeOIDC(ctx, target.String(), cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", target.RegistryStr(), err)
+		}
+		k.cache[key] = creds
+	}
+	return authn.FromConfig(authn.AuthConfig{Username: creds.Username, Password: creds.Password}), nil
+}
+
+var defaultKeychain = authn.NewMultiKeychain(&oidcKeychain{cache: map[oidcCacheKey]oidcCredentials{}}, harborKeychain{}, authn.DefaultKeychain, ciJobKeychain{})
+
+// Keychain returns the keychain of registry commands: OIDC federation for
+// registries configured with oidc in .registry, then the Harbor robot
+// account configured there, the Docker keychain, and the CI job token (see
+// CIJobCredentials).
+func Keychain() authn.Keychain {
+	return defaultKeychain
+}
@@ -0,0 +1,253 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOIDCServer serves the GitHub Actions token endpoint, Google STS and IAM
+// credentials, AWS STS and ECR, Entra ID, the Azure managed identity
+// endpoint and the ACR token exchange, recording the requests it receives.
+type fakeOIDCServer struct {
+	*httptest.Server
+	requests []*http.Request
+	bodies   []string
+}
+
+func newFakeOIDCServer(t *testing.T) *fakeOIDCServer {
+	f := &fakeOIDCServer{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		f.requests = append(f.requests, r)
+		f.bodies = append(f.bodies, string(body))
+		switch {
+		case r.URL.Path == "/gha":
+			_, _ = fmt.Fprintf(w, `{"value":"jwt-for-%s"}`, r.URL.Query().Get("audience"))
+		case r.URL.Path == "/sts/v1/token":
+			_, _ = w.Write([]byte(`{"access_token":"federated","expires_in":3600}`))
+		case strings.HasSuffix(r.URL.Path, ":generateAccessToken"):
+			_, _ = fmt.Fprintf(w, `{"accessToken":"impersonated","expireTime":%q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+		case r.URL.Path == "/aws-sts/":
+			w.Header().Set("Content-Type", "text/xml")
+			_, _ = w.Write([]byte(`<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+<AccessKeyId>ASIAEXAMPLE</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>session</SessionToken>
+</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`))
+		case r.URL.Path == "/ecr/":
+			token := base64.StdEncoding.EncodeToString([]byte("AWS:ecr-password"))
+			_, _ = fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q,"expiresAt":%d}]}`, token, time.Now().Add(12*time.Hour).Unix())
+		case r.URL.Path == "/aad/tenant/oauth2/v2.0/token":
+			_, _ = w.Write([]byte(`{"access_token":"aad-sp","expires_in":3599}`))
+		case r.URL.Path == "/imds":
+			_, _ = w.Write([]byte(`{"access_token":"aad-mi","expires_in":"86399"}`))
+		case r.URL.Path == "/acr/oauth2/exchange":
+			form, _ := url.ParseQuery(string(body))
+			_, _ = fmt.Fprintf(w, `{"refresh_token":"acr-for-%s"}`, form.Get("access_token"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(f.Close)
+
+	oldSTS, oldIAM, oldAWSSTS, oldECR := gcpSTSURL, gcpIAMCredentialsURL, awsSTSURL, awsECRURL
+	gcpSTSURL, gcpIAMCredentialsURL = f.URL+"/sts/v1/token", f.URL+"/iam/v1"
+	awsSTSURL = func(string) string { return f.URL + "/aws-sts/" }
+	awsECRURL = func(string) string { return f.URL + "/ecr/" }
+	t.Cleanup(func() { gcpSTSURL, gcpIAMCredentialsURL, awsSTSURL, awsECRURL = oldSTS, oldIAM, oldAWSSTS, oldECR })
+	oldLogin, oldIMDS, oldACR := azureLoginURL, azureIMDSURL, acrExchangeURL
+	azureLoginURL, azureIMDSURL = f.URL+"/aad", f.URL+"/imds"
+	acrExchangeURL = func(string) string { return f.URL + "/acr/oauth2/exchange" }
+	t.Cleanup(func() { azureLoginURL, azureIMDSURL, acrExchangeURL = oldLogin, oldIMDS, oldACR })
+
+	t.Setenv("OP_OIDC_TOKEN", "")
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", f.URL+"/gha?api-version=2.0")
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "request-token")
+	return f
+}
+
+func TestCIOIDCToken(t *testing.T) {
+	f := newFakeOIDCServer(t)
+
+	token, err := CIOIDCToken(t.Context(), "sts.amazonaws.com")
+	require.NoError(t, err)
+	assert.Equal(t, "jwt-for-sts.amazonaws.com", token)
+	assert.Equal(t, "Bearer request-token", f.requests[0].Header.Get("Authorization"))
+	assert.Equal(t, "2.0", f.requests[0].URL.Query().Get("api-version"))
+
+	t.Setenv("OP_OIDC_TOKEN", "gitlab-jwt")
+	token, err = CIOIDCToken(t.Context(), "ignored")
+	require.NoError(t, err)
+	assert.Equal(t, "gitlab-jwt", token)
+
+	t.Setenv("OP_OIDC_TOKEN", "")
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", "")
+	_, err = CIOIDCToken(t.Context(), "x")
+	assert.ErrorContains(t, err, "id-token: write")
+}
+
+func TestRegistryOIDCCredentials_GCP(t *testing.T) {
+	f := newFakeOIDCServer(t)
+	wip := "projects/123/locations/global/workloadIdentityPools/ci/providers/github"
+
+	user, pass, err := RegistryOIDCCredentials(t.Context(), "europe-docker.pkg.dev/proj/repo", &RegistryOIDC{WorkloadIdentityProvider: wip})
+	require.NoError(t, err)
+	assert.Equal(t, "oauth2accesstoken", user)
+	assert.Equal(t, "federated", pass)
+
+	var sts map[string]string
+	require.NoError(t, json.Unmarshal([]byte(f.bodies[1]), &sts))
+	assert.Equal(t, "//iam.googleapis.com/"+wip, sts["audience"])
+	assert.Equal(t, "jwt-for-https://iam.googleapis.com/"+wip, sts["subjectToken"])
+
+	_, pass, err = RegistryOIDCCredentials(t.Context(), "europe-docker.pkg.dev/proj/repo",
+		&RegistryOIDC{WorkloadIdentityProvider: wip, ServiceAccount: "ci@proj.iam.gserviceaccount.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "impersonated", pass)
+	last := f.requests[len(f.requests)-1]
+	assert.Equal(t, "/iam/v1/projects/-/serviceAccounts/ci@proj.iam.gserviceaccount.com:generateAccessToken", last.URL.Path)
+	assert.Equal(t, "Bearer federated", last.Header.Get("Authorization"))
+
+	_, _, err = RegistryOIDCCredentials(t.Context(), "gcr.io/proj", &RegistryOIDC{})
+	assert.ErrorContains(t, err, "workload_identity_provider is required")
+	_, _, err = RegistryOIDCCredentials(t.Context(), "registry.example.com", &RegistryOIDC{})
+	assert.ErrorContains(t, err, "set provider")
+}
+
+func TestRegistryOIDCCredentials_AWS(t *testing.T) {
+	f := newFakeOIDCServer(t)
+
+	user, pass, err := RegistryOIDCCredentials(t.Context(), "123456789012.dkr.ecr.eu-west-1.amazonaws.com/app",
+		&RegistryOIDC{RoleARN: "arn:aws:iam::123456789012:role/ci"})
+	require.NoError(t, err)
+	assert.Equal(t, "AWS", user)
+	assert.Equal(t, "ecr-password", pass)
+
+	require.Len(t, f.requests, 3)
+	assert.Contains(t, f.bodies[1], "Action=AssumeRoleWithWebIdentity")
+	assert.Contains(t, f.bodies[1], "WebIdentityToken=jwt-for-sts.amazonaws.com")
+	ecr := f.requests[2]
+	assert.Equal(t, "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken", ecr.Header.Get("X-Amz-Target"))
+	assert.Equal(t, "session", ecr.Header.Get("X-Amz-Security-Token"))
+	assert.Contains(t, ecr.Header.Get("Authorization"), "Credential=ASIAEXAMPLE/")
+	assert.Contains(t, ecr.Header.Get("Authorization"), "/eu-west-1/ecr/aws4_request")
+
+	_, _, err = RegistryOIDCCredentials(t.Context(), "123456789012.dkr.ecr.eu-west-1.amazonaws.com", &RegistryOIDC{})
+	assert.ErrorContains(t, err, "role_arn is required")
+}
+
+func TestRegistryOIDCCredentials_Azure(t *testing.T) {
+	f := newFakeOIDCServer(t)
+	t.Setenv("AZURE_TENANT_ID", "tenant")
+	t.Setenv("AZURE_CLIENT_ID", "app-id")
+
+	// Service principal.
+	t.Setenv("AZURE_CLIENT_SECRET", "sp-secret")
+	user, pass, err := RegistryOIDCCredentials(t.Context(), "acme.azurecr.io/app", &RegistryOIDC{})
+	require.NoError(t, err)
+	assert.Equal(t, acrTokenUser, user)
+	assert.Equal(t, "acr-for-aad-sp", pass)
+	require.Len(t, f.requests, 2)
+	assert.Contains(t, f.bodies[0], "grant_type=client_credentials")
+	assert.Contains(t, f.bodies[0], "client_secret=sp-secret")
+	assert.Contains(t, f.bodies[1], "service=acme.azurecr.io")
+	assert.Contains(t, f.bodies[1], "tenant=tenant")
+
+	// Managed identity: the user-assigned one of client_id.
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	_, pass, err = RegistryOIDCCredentials(t.Context(), "acme.azurecr.io", &RegistryOIDC{ClientID: "mi-id"})
+	require.NoError(t, err)
+	assert.Equal(t, "acr-for-aad-mi", pass)
+	imds := f.requests[2]
+	assert.Equal(t, "true", imds.Header.Get("Metadata"))
+	assert.Equal(t, "mi-id", imds.URL.Query().Get("client_id"))
+	assert.Equal(t, azureManagementResource, imds.URL.Query().Get("resource"))
+
+	t.Setenv("AZURE_CLIENT_SECRET", "sp-secret")
+	t.Setenv("AZURE_TENANT_ID", "")
+	_, _, err = RegistryOIDCCredentials(t.Context(), "acme.azurecr.io", &RegistryOIDC{})
+	assert.ErrorContains(t, err, "needs tenant_id")
+}
+
+func TestRegistryOIDCConfig_ACRServicePrincipal(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	_, ok := RegistryOIDCConfig("", "acme.azurecr.io/app")
+	assert.False(t, ok)
+
+	t.Setenv("AZURE_CLIENT_SECRET", "sp-secret")
+	cfg, ok := RegistryOIDCConfig("", "acme.azurecr.io/app")
+	require.True(t, ok)
+	assert.Equal(t, OIDCProviderAzure, cfg.Provider)
+	_, ok = RegistryOIDCConfig("", "ghcr.io/acme")
+	assert.False(t, ok)
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "https://api.ecr.us-east-1.amazonaws.com/", nil)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	signAWSRequest(req, []byte("{}"), "AKID", "secret", "us-east-1", "ecr", now)
+
+	assert.Equal(t, "20240102T030405Z", req.Header.Get("X-Amz-Date"))
+	auth := req.Header.Get("Authorization")
+	assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20240102/us-east-1/ecr/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-target, Signature="), auth)
+
+	// Deterministic: the same request signs the same.
+	again := httptest.NewRequest(http.MethodPost, "https://api.ecr.us-east-1.amazonaws.com/", nil)
+	again.Header = req.Header.Clone()
+	again.Header.Del("Authorization")
+	signAWSRequest(again, []byte("{}"), "AKID", "secret", "us-east-1", "ecr", now)
+	assert.Equal(t, auth, again.Header.Get("Authorization"))
+}
+
+func TestOIDCKeychain(t *testing.T) {
+	f := newFakeOIDCServer(t)
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile(filepath.Join(".", RegistryFilename), []byte(`
+ci:
+  - registry: europe-docker.pkg.dev/proj/repo
+    oidc:
+      workload_identity_provider: projects/123/locations/global/workloadIdentityPools/ci/providers/${OIDC_PROVIDER:-github}
+environments:
+  prod: ghcr.io/acme
+`), 0o644))
+
+	cfg, ok := RegistryOIDCConfig("", "europe-docker.pkg.dev")
+	require.True(t, ok)
+	assert.Equal(t, "projects/123/locations/global/workloadIdentityPools/ci/providers/github", cfg.WorkloadIdentityProvider)
+
+	k := &oidcKeychain{cache: map[oidcCacheKey]oidcCredentials{}}
+	repo, err := name.NewRepository("europe-docker.pkg.dev/proj/repo/app")
+	require.NoError(t, err)
+	for range 2 {
+		auth, err := k.Resolve(repo)
+		require.NoError(t, err)
+		ac, err := auth.Authorization()
+		require.NoError(t, err)
+		assert.Equal(t, "oauth2accesstoken", ac.Username)
+		assert.Equal(t, "federated", ac.Password)
+	}
+	// The second resolve is served from the cache.
+	assert.Len(t, f.requests, 2)
+
+	other, err := name.NewRepository("ghcr.io/acme/app")
+	require.NoError(t, err)
+	auth, err := k.Resolve(other)
+	require.NoError(t, err)
+	assert.Equal(t, authn.Anonymous, auth)
+}
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PreviewOpts configures `op preview-env`: the chart deployed for each pull
+// request and where.
+type PreviewOpts struct {
+	// Chart is the Helm chart path (relative to the repo root) or reference.
+	Chart string `yaml:"chart"`
+	// Release and Namespace are suffixed with -pr-<number>. Release defaults
+	// to the name of the first image, Namespace to "preview".
+	Release   string `yaml:"release"`
+	Namespace string `yaml:"namespace"`
+	// Repo is a registry path for PR images (pushed to <repo>/pr-<number>);
+	// when empty images go to ttl.sh and expire after TTL (default 24h).
+	Repo string `yaml:"repo"`
+	TTL  string `yaml:"ttl"`
+	// KubeContext selects the dev cluster from the kubeconfig.
+	KubeContext string `yaml:"kube_context"`
+	// ImageValues maps image names from build_result.json to the chart
+	// values prefix receiving <prefix>.repository and <prefix>.tag. With a
+	// single image it defaults to "image".
+	ImageValues map[string]string `yaml:"image_values"`
+	// Values are extra --set values; URL is the address posted to the pull
+	// request. Both expand {pr}, {release} and {namespace}.
+	Values map[string]string `yaml:"values"`
+	URL    string            `yaml:"url"`
+}
+
+// PreviewNames holds the names of one pull request's preview environment.
+type PreviewNames struct {
+	PR        int
+	Release   string
+	Namespace string
+}
+
+var reDNSLabelInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// previewName lowercases base, appends -pr-<pr> and truncates base so the
+// result fits in max characters.
+func previewName(base string, pr, max int) string {
+	suffix := fmt.Sprintf("-pr-%d", pr)
+	base = strings.Trim(reDNSLabelInvalid.ReplaceAllString(strings.ToLower(base), "-"), "-")
+	if len(base)+len(suffix) > max {
+		base = strings.TrimRight(base[:max-len(suffix)], "-")
+	}
+	return base + suffix
+}
+
+// Names returns the Helm release (at most 53 characters, Helm's limit) and
+// namespace (at most 63) for pull request pr. defaultRelease is used when
+// Release is not configured.
+func (o PreviewOpts) Names(pr int, defaultRelease string) PreviewNames {
+	return PreviewNames{
+		PR:        pr,
+		Release:   previewName(orDefault(o.Release, defaultRelease), pr, 53),
+		Namespace: previewName(orDefault(o.Namespace, "preview"), pr, 63),
+	}
+}
+
+// Expand replaces {pr}, {release} and {namespace} in s.
+func (n PreviewNames) Expand(s string) string {
+	return strings.NewReplacer(
+		"{pr}", fmt.Sprint(n.PR),
+		"{release}", n.Release,
+		"{namespace}", n.Namespace,
+	).Replace(s)
+}
@@ -0,0 +1,26 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviewOptsNames(t *testing.T) {
+	n := PreviewOpts{}.Names(42, "my-app")
+	assert.Equal(t, PreviewNames{PR: 42, Release: "my-app-pr-42", Namespace: "preview-pr-42"}, n)
+
+	n = PreviewOpts{Release: "Web_Frontend", Namespace: "team-a"}.Names(7, "ignored")
+	assert.Equal(t, "web-frontend-pr-7", n.Release)
+	assert.Equal(t, "team-a-pr-7", n.Namespace)
+
+	n = PreviewOpts{Release: strings.Repeat("a", 60) + "-x"}.Names(12345, "")
+	assert.Len(t, n.Release, 53)
+	assert.True(t, strings.HasSuffix(n.Release, "a-pr-12345"))
+}
+
+func TestPreviewNamesExpand(t *testing.T) {
+	n := PreviewNames{PR: 3, Release: "app-pr-3", Namespace: "preview-pr-3"}
+	assert.Equal(t, "https://app-pr-3.preview.example.com/?ns=preview-pr-3&pr=3", n.Expand("https://{release}.preview.example.com/?ns={namespace}&pr={pr}"))
+}
@@ -0,0 +1,259 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/logs"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"golang.org/x/term"
+)
+
+// transferLogInterval is how often a push or copy is logged when stderr is
+// not a terminal (CI).
+var transferLogInterval = 10 * time.Second
+
+// stderrIsTerminal reports whether progress can be drawn as a bar; a var so
+// tests can replace it.
+var stderrIsTerminal = func() bool {
+	return term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// TrackTransfer reports the progress of pushing or copying ref: pass the
+// returned channel to remote.WithProgress and call the returned function
+// once the push returned. On a terminal it draws a progress bar on stderr,
+// otherwise it logs the bytes transferred every transferLogInterval.
+// Nothing is reported with --quiet.
+func TrackTransfer(ref string) (chan v1.Update, func()) {
+	captureLayerLogs()
+	updates := make(chan v1.Update, 64)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	var w io.Writer = os.Stderr
+	if Quiet() {
+		w = io.Discard
+	}
+	tty := stderrIsTerminal()
+	go func() {
+		defer close(done)
+		reportTransfer(ref, updates, stop, w, tty, transferLogInterval)
+	}()
+	var once sync.Once
+	return updates, func() {
+		once.Do(func() { close(stop) })
+		<-done
+	}
+}
+
+// reportTransfer consumes updates until the channel is closed or stop is
+// closed (crane.Copy never closes it), drawing a bar on w when tty and
+// logging every interval otherwise.
+func reportTransfer(ref string, updates <-chan v1.Update, stop <-chan struct{}, w io.Writer, tty bool, interval time.Duration) {
+	start := time.Now()
+	layers := layerEvents.snapshot()
+	var last v1.Update
+	var drawn time.Time
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	draw := func(final bool) {
+		if !tty || last.Total == 0 || w == io.Discard {
+			return
+		}
+		if !final && time.Since(drawn) < 100*time.Millisecond {
+			return
+		}
+		drawn = time.Now()
+		_, _ = fmt.Fprintf(w, "\r%s %s", ref, transferBar(last))
+		if final {
+			_, _ = fmt.Fprintln(w, layerEvents.since(layers).String())
+		}
+	}
+	apply := func(u v1.Update) {
+		if u.Error == nil {
+			last = u
+		}
+		draw(false)
+	}
+
+loop:
+	for {
+		select {
+		case u, ok := <-updates:
+			if !ok {
+				break loop
+			}
+			apply(u)
+		case <-stop:
+			// The push returned: take what was sent before it did.
+			for {
+				select {
+				case u, ok := <-updates:
+					if !ok {
+						break loop
+					}
+					apply(u)
+				default:
+					break loop
+				}
+			}
+		case <-ticker.C:
+			if !tty && last.Total > 0 && w != io.Discard {
+				slog.Info("Pushing", LogKeyTag, ref, "bytes", last.Complete, "total", last.Total,
+					"percent", transferPercent(last))
+			}
+		}
+	}
+
+	draw(true)
+	if !tty && w != io.Discard && (last.Total > 0 || layerEvents.since(layers).any()) {
+		counts := layerEvents.since(layers)
+		slog.Info("Pushed", LogKeyTag, ref, "bytes", last.Complete, "duration", time.Since(start).Round(time.Millisecond),
+			"layers_pushed", counts.pushed, "layers_existing", counts.existing, "layers_mounted", counts.mounted)
+	}
+}
+
+// transferPercent is the share of u transferred, 0-100.
+func transferPercent(u v1.Update) int {
+	if u.Total <= 0 {
+		return 0
+	}
+	return int(min(u.Complete*100/u.Total, 100))
+}
+
+// transferBar renders u as "[=====>    ]  12.0 MB / 40.0 MB  30%".
+func transferBar(u v1.Update) string {
+	const width = 30
+	filled := transferPercent(u) * width / 100
+	bar := strings.Repeat("=", filled)
+	if filled < width {
+		bar += ">" + strings.Repeat(" ", width-filled-1)
+	}
+	return fmt.Sprintf("[%s] %s / %s %3d%%", bar, formatBytes(u.Complete), formatBytes(u.Total), transferPercent(u))
+}
+
+// formatBytes renders n in B, kB, MB or GB (powers of 1000).
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.1f GB", float64(n)/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1f MB", float64(n)/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1f kB", float64(n)/1e3)
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// layerCounts counts the blobs of pushes by outcome.
+type layerCounts struct {
+	pushed, existing, mounted int
+}
+
+func (c layerCounts) any() bool { return c.pushed+c.existing+c.mounted > 0 }
+
+// String renders the counts for the end of a progress bar ("" when none).
+func (c layerCounts) String() string {
+	if !c.any() {
+		return ""
+	}
+	return fmt.Sprintf("  (layers: %d pushed, %d already present, %d mounted)", c.pushed, c.existing, c.mounted)
+}
+
+// layerTally counts the blob outcomes go-containerregistry reports while
+// pushing; trackers report the difference between their start and end.
+type layerTally struct {
+	sync.Mutex
+	counts        layerCounts
+	refusedMounts int
+}
+
+var layerEvents layerTally
+
+func (t *layerTally) snapshot() layerCounts {
+	t.Lock()
+	defer t.Unlock()
+	return t.counts
+}
+
+func (t *layerTally) since(start layerCounts) layerCounts {
+	now := t.snapshot()
+	return layerCounts{pushed: now.pushed - start.pushed, existing: now.existing - start.existing, mounted: now.mounted - start.mounted}
+}
+
+// record counts one go-containerregistry progress line and logs the blob:
+// skipped and mounted blobs at info in CI (debug on a terminal, where the
+// bar shows the counts), pushed blobs at debug. A refused cross-repository
+// mount is logged as a warning the first time: the layer then goes through
+// the runner.
+func (t *layerTally) record(line string) {
+	line = strings.TrimSpace(line)
+	if reason, ok := strings.CutPrefix(line, "retrying without mount: "); ok {
+		t.Lock()
+		t.refusedMounts++
+		first := t.refusedMounts == 1
+		t.Unlock()
+		level := slog.LevelDebug
+		if first {
+			level = slog.LevelWarn
+		}
+		slog.Log(context.Background(), level, "Registry refused a cross-repository mount, uploading the layer instead",
+			"error", reason, "hint", "the destination credentials need pull access to the source repository")
+		return
+	}
+	kind, digest, ok := strings.Cut(line, " blob: ")
+	if !ok {
+		return
+	}
+	level, msg := slog.LevelInfo, ""
+	t.Lock()
+	switch kind {
+	case "pushed":
+		t.counts.pushed++
+		level, msg = slog.LevelDebug, "Pushed layer"
+	case "existing":
+		t.counts.existing++
+		msg = "Layer already in registry, skipped"
+	case "mounted":
+		t.counts.mounted++
+		msg = "Layer mounted from another repository"
+	}
+	t.Unlock()
+	if msg == "" {
+		return
+	}
+	if stderrIsTerminal() {
+		level = slog.LevelDebug
+	}
+	slog.Log(context.Background(), level, msg, "digest", digest)
+}
+
+// layerLogWriter feeds go-containerregistry's progress log to layerEvents.
+type layerLogWriter struct{}
+
+func (layerLogWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(string(p), "\n") {
+		layerEvents.record(line)
+	}
+	return len(p), nil
+}
+
+var captureLayerLogsOnce sync.Once
+
+// captureLayerLogs routes go-containerregistry's progress log (one line per
+// blob pushed, skipped or mounted) and its warnings (refused mounts) to
+// layerEvents.
+func captureLayerLogs() {
+	captureLayerLogsOnce.Do(func() {
+		logs.Progress.SetOutput(layerLogWriter{})
+		logs.Progress.SetFlags(0)
+		logs.Warn.SetOutput(layerLogWriter{})
+		logs.Warn.SetFlags(0)
+	})
+}
@@ -0,0 +1,111 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// captureSlog routes the default logger to a buffer for the test.
+func captureSlog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(old) })
+	return &buf
+}
+
+func TestReportTransfer_Terminal(t *testing.T) {
+	updates := make(chan v1.Update, 4)
+	updates <- v1.Update{Total: 4_000_000, Complete: 1_000_000}
+	updates <- v1.Update{Total: 4_000_000, Complete: 4_000_000}
+	close(updates)
+	var out bytes.Buffer
+	reportTransfer("ghcr.io/org/app:v1", updates, make(chan struct{}), &out, true, time.Hour)
+
+	assert.Contains(t, out.String(), "\rghcr.io/org/app:v1 ["+strings.Repeat("=", 30)+"] 4.0 MB / 4.0 MB 100%")
+	assert.True(t, strings.HasSuffix(out.String(), "\n"))
+}
+
+// notTerminal makes stderr look like CI output for the test.
+func notTerminal(t *testing.T) {
+	old := stderrIsTerminal
+	stderrIsTerminal = func() bool { return false }
+	t.Cleanup(func() { stderrIsTerminal = old })
+}
+
+func TestReportTransfer_CI(t *testing.T) {
+	notTerminal(t)
+	logs := captureSlog(t)
+	updates := make(chan v1.Update)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reportTransfer("ghcr.io/org/app:v1", updates, stop, io.Discard, false, time.Hour)
+	}()
+	updates <- v1.Update{Total: 2000, Complete: 500}
+	// crane.Copy never closes the channel: stop ends the report.
+	close(stop)
+	<-done
+	assert.Empty(t, logs.String(), "nothing is logged with --quiet (io.Discard)")
+
+	updates = make(chan v1.Update)
+	stop = make(chan struct{})
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		reportTransfer("ghcr.io/org/app:v1", updates, stop, &bytes.Buffer{}, false, 5*time.Millisecond)
+	}()
+	updates <- v1.Update{Total: 2000, Complete: 500}
+	time.Sleep(50 * time.Millisecond)
+	layerEvents.record("existing blob: sha256:aaa")
+	layerEvents.record("pushed blob: sha256:bbb")
+	updates <- v1.Update{Total: 2000, Complete: 2000}
+	close(updates)
+	<-done
+
+	out := logs.String()
+	assert.Contains(t, out, `msg=Pushing tag=ghcr.io/org/app:v1 bytes=500 total=2000 percent=25`)
+	assert.Contains(t, out, `msg="Layer already in registry, skipped" digest=sha256:aaa`)
+	assert.Contains(t, out, `msg="Pushed layer" digest=sha256:bbb`)
+	assert.Contains(t, out, `msg=Pushed tag=ghcr.io/org/app:v1 bytes=2000`)
+	assert.Contains(t, out, "layers_pushed=1 layers_existing=1 layers_mounted=0")
+}
+
+func TestLayerLogWriter(t *testing.T) {
+	notTerminal(t)
+	captureSlog(t)
+	start := layerEvents.snapshot()
+	_, _ = layerLogWriter{}.Write([]byte("mounted blob: sha256:ccc\nexisting manifest: sha256:ddd\n"))
+	assert.Equal(t, layerCounts{mounted: 1}, layerEvents.since(start))
+	assert.Equal(t, "  (layers: 0 pushed, 0 already present, 1 mounted)", layerEvents.since(start).String())
+}
+
+func TestTransferBar(t *testing.T) {
+	assert.Equal(t, "[=======>                      ] 512 B / 2.0 kB  25%", transferBar(v1.Update{Total: 2048, Complete: 512}))
+	assert.Equal(t, "1.5 GB", formatBytes(1_500_000_000))
+}
+
+func TestLayerLogWriter_RefusedMount(t *testing.T) {
+	notTerminal(t)
+	logs := captureSlog(t)
+	layerEvents.Lock()
+	layerEvents.refusedMounts = 0
+	layerEvents.Unlock()
+	start := layerEvents.snapshot()
+
+	line := "retrying without mount: POST https://ghcr.io/v2/b/app/blobs/uploads/: DENIED\n"
+	_, _ = layerLogWriter{}.Write([]byte(line + line))
+	out := logs.String()
+	assert.Equal(t, 1, strings.Count(out, "level=WARN"), out)
+	assert.Contains(t, out, `msg="Registry refused a cross-repository mount, uploading the layer instead" error="POST https://ghcr.io/v2/b/app/blobs/uploads/: DENIED"`)
+	assert.Equal(t, 2, strings.Count(out, "cross-repository mount"))
+	assert.Equal(t, layerCounts{}, layerEvents.since(start))
+}
@@ -1,9 +1,13 @@
 package util
 
 import (
+	"fmt"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
+	"reflect"
+	"slices"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -11,68 +15,252 @@ import (
 
 const RegistryFilename = ".registry"
 
+// RegistryEntry is a registry in .registry, written either as a plain
+// reference or as a mapping with options:
+//
+//	ci:
+//	  - registry: ghcr.io/my-org
+//	    branches: [main, release/*]
+//	    events: [push]
+//	  - registry: registry.internal:5000/my-org
+//	    insecure: true
+//	    platforms: [linux/amd64]
+type RegistryEntry struct {
+	// Registry is the repository prefix to push to; environment variables
+	// are interpolated.
+	Registry string `yaml:"registry"`
+	// Branches (globs such as release/*) and Events (GitHub event names such
+	// as push or pull_request, GitLab pipeline sources such as
+	// merge_request_event, Azure Pipelines build reasons such as
+	// PullRequest) select a ci entry; empty matches any run.
+	Branches []string `yaml:"branches"`
+	Events   []string `yaml:"events"`
+	// Insecure skips TLS verification and allows HTTP for this registry.
+	Insecure bool `yaml:"insecure"`
+	// Platforms restricts the platforms built for this registry (and is the
+	// default when no platform is requested).
+	Platforms []string `yaml:"platforms"`
+	// MaxConcurrency limits the requests in flight to this registry's host
+	// (see RegistryConcurrency).
+	MaxConcurrency int `yaml:"max_concurrency"`
+	// OIDC exchanges the CI OIDC token for credentials to this registry
+	// (workload identity federation) instead of reading stored ones.
+	OIDC *RegistryOIDC `yaml:"oidc"`
+	// Harbor enables Harbor-specific behaviour for this registry.
+	Harbor *RegistryHarbor `yaml:"harbor"`
+}
+
+// UnmarshalYAML accepts a plain reference as well as a mapping.
+func (e *RegistryEntry) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*e = RegistryEntry{Registry: n.Value}
+		return nil
+	}
+	type plain RegistryEntry
+	return n.Decode((*plain)(e))
+}
+
+// matches reports whether e applies to a CI run on branch for event.
+func (e RegistryEntry) matches(branch, event string) bool {
+	if len(e.Events) > 0 && !slices.Contains(e.Events, event) {
+		return false
+	}
+	if len(e.Branches) == 0 {
+		return true
+	}
+	for _, pattern := range e.Branches {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (e RegistryEntry) interpolated() (RegistryEntry, error) {
+	var err error
+	if e.Registry, err = interpolate(e.Registry); err != nil {
+		return RegistryEntry{}, fmt.Errorf("%s: %w", RegistryFilename, err)
+	}
+	if e.OIDC, err = e.OIDC.interpolated(); err != nil {
+		return RegistryEntry{}, fmt.Errorf("%s: oidc: %w", RegistryFilename, err)
+	}
+	return e, nil
+}
+
 type registryFile struct {
-	Local        string   `yaml:"local"`
-	CI           []string `yaml:"ci"`
-	Destinations []string `yaml:"destinations"` // Legacy alias for CI
+	Local        RegistryEntry            `yaml:"local"`
+	CI           []RegistryEntry          `yaml:"ci"`
+	Destinations []RegistryEntry          `yaml:"destinations"` // Legacy alias for CI
+	Environments map[string]RegistryEntry `yaml:"environments"`
 }
 
-// GetDefaultRepoFromRegistry reads the .registry file from repoRoot and returns
-// the most appropriate registry for the current environment.
-// In CI (GITHUB_ACTIONS=true) it returns the first CI entry; otherwise local.
-// Strings are interpolated with environment variables, including ${VAR:-default} syntax.
-func GetDefaultRepoFromRegistry(repoRoot string) string {
-	path := filepath.Join(repoRoot, RegistryFilename)
-	data, err := os.ReadFile(path)
+// RegistryFileType is the type the .registry file is loaded into, used by
+// `op validate` as its schema.
+var RegistryFileType = reflect.TypeOf(registryFile{})
+
+// readRegistryFile loads .registry from repoRoot; a missing or broken file
+// yields nil.
+func readRegistryFile(repoRoot string) *registryFile {
+	data, err := os.ReadFile(filepath.Join(repoRoot, RegistryFilename))
 	if err != nil {
-		return ""
+		return nil
 	}
-
 	var raw registryFile
 	if err := yaml.Unmarshal(data, &raw); err != nil {
-		return ""
+		return nil
+	}
+	return &raw
+}
+
+// entries returns every registry of the file with its variables expanded;
+// entries that fail to expand are left out.
+func (f *registryFile) entries() []RegistryEntry {
+	all := append([]RegistryEntry{f.Local}, f.CI...)
+	all = append(all, f.Destinations...)
+	for _, env := range slices.Sorted(maps.Keys(f.Environments)) {
+		all = append(all, f.Environments[env])
 	}
+	var out []RegistryEntry
+	for _, e := range all {
+		if e, err := e.interpolated(); err == nil && e.Registry != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
 
-	inCI := os.Getenv("GITHUB_ACTIONS") == "true"
+// ResolveRegistry returns the .registry entry for the current environment:
+// in GitHub Actions, GitLab CI or Azure Pipelines (see CIProvider) the first
+// ci entry whose branches and events match the run, otherwise local. Only the selected entry is interpolated
+// (see Interpolate), so a ${VAR:?} in another entry does not fail.
+func ResolveRegistry(repoRoot string) (RegistryEntry, bool, error) {
+	raw := readRegistryFile(repoRoot)
+	if raw == nil {
+		return RegistryEntry{}, false, nil
+	}
 
-	if inCI {
+	selected := raw.Local
+	if ciSelectsRegistry() {
 		ciList := raw.CI
 		if len(ciList) == 0 {
 			ciList = raw.Destinations
 		}
-		if len(ciList) > 0 {
-			return interpolate(ciList[0])
+		branch, event := ciBranch(), ciEvent()
+		i := slices.IndexFunc(ciList, func(e RegistryEntry) bool { return e.matches(branch, event) })
+		if i < 0 {
+			return RegistryEntry{}, false, nil
+		}
+		selected = ciList[i]
+	}
+	e, err := selected.interpolated()
+	if err != nil {
+		return RegistryEntry{}, false, err
+	}
+	return e, e.Registry != "", nil
+}
+
+// GetDefaultRepoFromRegistry reads the .registry file from repoRoot and returns
+// the most appropriate registry for the current environment (see ResolveRegistry).
+func GetDefaultRepoFromRegistry(repoRoot string) (string, error) {
+	e, _, err := ResolveRegistry(repoRoot)
+	return e.Registry, err
+}
+
+// GetRegistryEnvironment returns environments.<env> of the .registry file in
+// repoRoot, used by promote-image and watch-deployment.
+func GetRegistryEnvironment(repoRoot, env string) (RegistryEntry, bool, error) {
+	raw := readRegistryFile(repoRoot)
+	if raw == nil || env == "" {
+		return RegistryEntry{}, false, nil
+	}
+	e, ok := raw.Environments[env]
+	if !ok {
+		return RegistryEntry{}, false, nil
+	}
+	e, err := e.interpolated()
+	if err != nil {
+		return RegistryEntry{}, false, err
+	}
+	return e, e.Registry != "", nil
+}
+
+// RegistriesAsWritten returns the registries of the .registry file in
+// repoRoot without expanding their variables: those of the ci entries when
+// env is empty, else that of environments.<env>. `op ci generate` writes
+// them into workflow steps, where the runner's shell expands them.
+func RegistriesAsWritten(repoRoot, env string) []string {
+	raw := readRegistryFile(repoRoot)
+	if raw == nil {
+		return nil
+	}
+	if env != "" {
+		if e, ok := raw.Environments[env]; ok && e.Registry != "" {
+			return []string{e.Registry}
 		}
-	} else {
-		if raw.Local != "" {
-			return interpolate(raw.Local)
+		return nil
+	}
+	ciList := raw.CI
+	if len(ciList) == 0 {
+		ciList = raw.Destinations
+	}
+	var regs []string
+	for _, e := range ciList {
+		if e.Registry != "" {
+			regs = append(regs, e.Registry)
 		}
 	}
-	return ""
+	return regs
+}
+
+// RegistryEnvironments returns the environment names of the .registry file
+// in repoRoot, sorted.
+func RegistryEnvironments(repoRoot string) []string {
+	raw := readRegistryFile(repoRoot)
+	if raw == nil {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(raw.Environments))
 }
 
-// reVarDefault matches ${VAR:-default} or ${VAR:default} (without dash).
-var reVarDefault = regexp.MustCompile(`\$\{([^}:]+):-([^}]*)\}`)
-
-// interpolate expands environment variable references in s:
-//   - ${VAR}           → value of VAR, empty if unset
-//   - $VAR             → value of VAR, empty if unset
-//   - ${VAR:-default}  → value of VAR if set and non-empty, else "default"
-//   - $$               → literal $
-func interpolate(s string) string {
-	// Handle ${VAR:-default} first (os.ExpandEnv doesn't support this).
-	result := reVarDefault.ReplaceAllStringFunc(s, func(match string) string {
-		sub := reVarDefault.FindStringSubmatch(match)
-		if len(sub) != 3 {
-			return match
+// RegistryOptions returns the .registry entry that repo (a registry or a
+// repository below it) belongs to, so that its options apply however the
+// repo was chosen.
+func RegistryOptions(repoRoot, repo string) (RegistryEntry, bool) {
+	raw := readRegistryFile(repoRoot)
+	if raw == nil {
+		return RegistryEntry{}, false
+	}
+	repo = strings.TrimSuffix(repo, "/")
+	for _, e := range raw.entries() {
+		if repo == e.Registry || strings.HasPrefix(repo, e.Registry+"/") {
+			return e, true
 		}
-		key, defaultVal := sub[1], sub[2]
-		if v := os.Getenv(key); v != "" {
-			return v
+	}
+	return RegistryEntry{}, false
+}
+
+// RegistryInsecureRegistries returns the registries marked insecure in the
+// .registry file in repoRoot.
+func RegistryInsecureRegistries(repoRoot string) []string {
+	raw := readRegistryFile(repoRoot)
+	if raw == nil {
+		return nil
+	}
+	var regs []string
+	for _, e := range raw.entries() {
+		if e.Insecure {
+			regs = append(regs, e.Registry)
 		}
-		return defaultVal
-	})
-	// Then handle plain $VAR and ${VAR}.
-	result = os.ExpandEnv(result)
-	return strings.TrimSuffix(strings.TrimSpace(result), "/")
+	}
+	return regs
+}
+
+// interpolate expands a registry reference (see Interpolate) and drops
+// surrounding space and a trailing slash.
+func interpolate(s string) (string, error) {
+	result, err := Interpolate(s)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSpace(result), "/"), nil
 }
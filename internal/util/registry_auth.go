@@ -0,0 +1,162 @@
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	// registryPingTTL is how long the /v2/ answer of a registry (its auth
+	// challenge) is reused.
+	registryPingTTL = 5 * time.Minute
+	// registryTokenTTL is the lifetime of a token whose response has no
+	// expires_in (the default of the Docker token specification).
+	registryTokenTTL = time.Minute
+)
+
+// registryAuth caches the auth handshake go-containerregistry repeats for
+// every registry call: the /v2/ ping of each registry and the answers of
+// its token service. Entries are keyed by method, URL (which names the
+// repository and scope), credentials and body, so they hold nothing of the
+// caller's other options; tokens are reused for half their lifetime.
+var registryAuth struct {
+	sync.Mutex
+	realms  map[string]bool
+	entries map[string]registryAuthEntry
+}
+
+// registryAuthEntry is a cached handshake response.
+type registryAuthEntry struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+var bearerRealm = regexp.MustCompile(`(?i)bearer\s+realm="([^"]+)"`)
+
+// realmURL is u without its query: the token service a request goes to.
+func realmURL(u *url.URL) string {
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// registryAuthKey returns the cache key of req when it is a ping or a token
+// request; ok is false for every other request.
+func registryAuthKey(req *http.Request) (key string, ok bool) {
+	ping := req.Method == http.MethodGet && req.URL.Path == "/v2/" && req.Header.Get("Authorization") == ""
+	if !ping {
+		registryAuth.Lock()
+		token := registryAuth.realms[realmURL(req.URL)]
+		registryAuth.Unlock()
+		if !token {
+			return "", false
+		}
+	}
+	h := sha256.New()
+	_, _ = io.WriteString(h, req.Method+" "+req.URL.String()+"\n"+req.Header.Get("Authorization")+"\n")
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return "", false
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return "", false
+		}
+		_, err = io.Copy(h, body)
+		_ = body.Close()
+		if err != nil {
+			return "", false
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// cachedRegistryAuth returns the cached response of key for req, if fresh.
+func cachedRegistryAuth(key string, req *http.Request) (*http.Response, bool) {
+	registryAuth.Lock()
+	e, ok := registryAuth.entries[key]
+	registryAuth.Unlock()
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.status, http.StatusText(e.status)),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}, true
+}
+
+// noteRegistryRealm records the token service of a Bearer challenge in resp.
+func noteRegistryRealm(resp *http.Response) {
+	for _, c := range resp.Header.Values("WWW-Authenticate") {
+		m := bearerRealm.FindStringSubmatch(c)
+		if m == nil {
+			continue
+		}
+		u, err := url.Parse(m[1])
+		if err != nil {
+			continue
+		}
+		registryAuth.Lock()
+		if registryAuth.realms == nil {
+			registryAuth.realms = map[string]bool{}
+		}
+		registryAuth.realms[realmURL(u)] = true
+		registryAuth.Unlock()
+	}
+}
+
+// storeRegistryAuth caches resp to req under key when it is a ping answer
+// (200 or 401) or a token, and returns it with its body re-readable.
+func storeRegistryAuth(key string, req *http.Request, resp *http.Response) (*http.Response, error) {
+	ping := req.URL.Path == "/v2/"
+	if resp.StatusCode != http.StatusOK && !(ping && resp.StatusCode == http.StatusUnauthorized) {
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	ttl := registryPingTTL
+	if !ping {
+		var token struct {
+			ExpiresIn int `json:"expires_in"`
+		}
+		ttl = registryTokenTTL
+		if json.Unmarshal(body, &token) == nil && token.ExpiresIn > 0 {
+			ttl = time.Duration(token.ExpiresIn) * time.Second
+		}
+		ttl /= 2
+	}
+	now := time.Now()
+	registryAuth.Lock()
+	defer registryAuth.Unlock()
+	if registryAuth.entries == nil {
+		registryAuth.entries = map[string]registryAuthEntry{}
+	}
+	for k, e := range registryAuth.entries {
+		if now.After(e.expires) {
+			delete(registryAuth.entries, k)
+		}
+	}
+	registryAuth.entries[key] = registryAuthEntry{status: resp.StatusCode, header: resp.Header.Clone(), body: body, expires: now.Add(ttl)}
+	return resp, nil
+}
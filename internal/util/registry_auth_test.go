@@ -0,0 +1,68 @@
+package util
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryTransport_CachesAuthHandshake(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string]int{}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen[r.URL.Path+"?"+r.URL.RawQuery+" "+r.Header.Get("Authorization")]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/token":
+			_, _ = io.WriteString(w, `{"token":"t","expires_in":300}`)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: RegistryTransport(nil)}
+	get := func(path, auth string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		require.NoError(t, err)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	for range 2 {
+		status, _ := get("/v2/", "")
+		assert.Equal(t, http.StatusUnauthorized, status)
+		status, body := get("/token?scope=repository:app:pull", "Basic dTpw")
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"token":"t","expires_in":300}`, body)
+		status, _ = get("/v2/app/manifests/v1", "Bearer t")
+		assert.Equal(t, http.StatusOK, status)
+	}
+	get("/token?scope=repository:other:pull", "Basic dTpw")
+	get("/token?scope=repository:app:pull", "Basic b3RoZXI6cA==")
+
+	assert.Equal(t, map[string]int{
+		"/v2/? ": 1,
+		"/token?scope=repository:app:pull Basic dTpw":         1,
+		"/token?scope=repository:other:pull Basic dTpw":       1,
+		"/token?scope=repository:app:pull Basic b3RoZXI6cA==": 1,
+		"/v2/app/manifests/v1? Bearer t":                      2,
+	}, seen)
+}
@@ -0,0 +1,128 @@
+package util
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/octopilot/octopilot-pipeline-tools/pkg/pipeline"
+)
+
+// RegistryEndpointOpts are the settings of one registry, under "registries"
+// in octopilot.yaml keyed by its host (localhost:5001, registry.local:5000).
+type RegistryEndpointOpts struct {
+	// ContainerHost is the address containers op starts (the Pack
+	// lifecycle) use for the registry, e.g. host.lima.internal:5001 when
+	// host.docker.internal does not reach the host.
+	ContainerHost string `yaml:"container_host"`
+	// Insecure marks the registry as plain HTTP or self-signed TLS, as
+	// --insecure-registry does.
+	Insecure bool `yaml:"insecure"`
+}
+
+// EndpointHost describes the machine op runs on, which decides how
+// containers reach a registry listening on it.
+type EndpointHost struct {
+	// GOOS is the host OS: containers run in a VM on darwin and windows
+	// (Docker Desktop, Colima, Rancher Desktop), where loopback is the VM's.
+	GOOS string
+	// Gateway is the name containers reach the host by (HostGatewayName).
+	Gateway string
+	// HostNetwork is set when containers share the host network
+	// (OP_PACK_NETWORK=host), so loopback references work as they are.
+	HostNetwork bool
+}
+
+// RegistryEndpoints resolves how op and the containers it starts reach
+// registries: the address of a registry from inside a container, and
+// whether it is insecure.
+type RegistryEndpoints struct {
+	local      LocalRegistryOpts
+	localAlias string
+	registries map[string]RegistryEndpointOpts
+	insecure   []string
+}
+
+// NewRegistryEndpoints returns the endpoints of the local registry local on
+// host, with the per-registry settings of registries and the insecure
+// registry hosts insecure.
+func NewRegistryEndpoints(local LocalRegistryOpts, host EndpointHost, registries map[string]RegistryEndpointOpts, insecure []string) *RegistryEndpoints {
+	e := &RegistryEndpoints{local: local, registries: registries, insecure: slices.Clone(insecure)}
+	switch {
+	case host.HostNetwork:
+	case host.GOOS == "darwin" || host.GOOS == "windows":
+		e.localAlias = fmt.Sprintf("%s:%d", host.Gateway, local.Port)
+	default:
+		e.localAlias = fmt.Sprintf("127.0.0.1:%d", local.Port)
+	}
+	if alias := registries[local.Endpoint()].ContainerHost; alias != "" {
+		e.localAlias = alias
+	}
+	for _, reg := range slices.Sorted(maps.Keys(registries)) {
+		if registries[reg].Insecure && !slices.Contains(e.insecure, reg) {
+			e.insecure = append(e.insecure, reg)
+		}
+	}
+	return e
+}
+
+// ResolveRegistryEndpoints returns the registry endpoints of the project in
+// cwd: its local registry (see ResolveLocalRegistry) and the "registries" of
+// its octopilot.yaml, on this host, with insecure as the insecure registries.
+func ResolveRegistryEndpoints(cwd string, insecure []string) *RegistryEndpoints {
+	var registries map[string]RegistryEndpointOpts
+	if cfg, err := LoadRunConfig(cwd); err == nil {
+		registries = cfg.Registries
+	}
+	host := EndpointHost{
+		GOOS:        runtime.GOOS,
+		Gateway:     HostGatewayName(),
+		HostNetwork: os.Getenv("OP_PACK_NETWORK") == "host",
+	}
+	return NewRegistryEndpoints(ResolveLocalRegistry(cwd), host, registries, insecure)
+}
+
+// InsecureRegistries returns the insecure registry hosts: those given to
+// NewRegistryEndpoints and those marked insecure in octopilot.yaml.
+func (e *RegistryEndpoints) InsecureRegistries() []string {
+	return slices.Clip(e.insecure)
+}
+
+// Insecure reports whether ref (a registry, repository or image reference)
+// is hosted on an insecure registry.
+func (e *RegistryEndpoints) Insecure(ref string) bool {
+	return pipeline.IsInsecureRegistry(ref, e.insecure)
+}
+
+// ContainerRef returns ref as a container started by op reaches it: the
+// local registry on the host gateway (127.0.0.1 on Linux) unless containers
+// share the host network, and any registry with a container_host on that
+// address. It reports whether ref changed.
+func (e *RegistryEndpoints) ContainerRef(ref string) (string, bool) {
+	reg, _, _ := strings.Cut(ref, "/")
+	if alias := e.registries[reg].ContainerHost; alias != "" && !e.local.Matches(reg) {
+		return alias + strings.TrimPrefix(ref, reg), true
+	}
+	return e.local.RewriteLocalRegistry(ref, e.localAlias)
+}
+
+// ContainerInsecureRegistries returns the insecure registries for a
+// container using refs: InsecureRegistries plus the address each rewritten
+// ref now uses when it is the local registry (served with a self-signed
+// certificate) or an insecure one.
+func (e *RegistryEndpoints) ContainerInsecureRegistries(refs ...string) []string {
+	regs := e.InsecureRegistries()
+	for _, ref := range refs {
+		rewritten, ok := e.ContainerRef(ref)
+		if !ok || !(e.local.Matches(ref) || e.Insecure(ref)) {
+			continue
+		}
+		if reg, _, _ := strings.Cut(rewritten, "/"); !slices.Contains(regs, reg) {
+			regs = append(regs, reg)
+		}
+	}
+	return regs
+}
@@ -0,0 +1,119 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryEndpoints_ContainerRef(t *testing.T) {
+	local := LocalRegistryOpts{Host: "localhost", Port: 5001}
+	tests := []struct {
+		name       string
+		host       EndpointHost
+		registries map[string]RegistryEndpointOpts
+		ref        string
+		want       string
+		rewritten  bool
+	}{
+		{
+			name: "Docker Desktop",
+			host: EndpointHost{GOOS: "darwin", Gateway: "host.docker.internal"},
+			ref:  "localhost:5001/app:dev", want: "host.docker.internal:5001/app:dev", rewritten: true,
+		},
+		{
+			name: "Docker Desktop on Windows, 127.0.0.1",
+			host: EndpointHost{GOOS: "windows", Gateway: "host.docker.internal"},
+			ref:  "127.0.0.1:5001/app:dev", want: "host.docker.internal:5001/app:dev", rewritten: true,
+		},
+		{
+			name: "Podman machine",
+			host: EndpointHost{GOOS: "darwin", Gateway: "host.containers.internal"},
+			ref:  "localhost:5001/app:dev", want: "host.containers.internal:5001/app:dev", rewritten: true,
+		},
+		{
+			name:       "Colima with a container_host",
+			host:       EndpointHost{GOOS: "darwin", Gateway: "host.docker.internal"},
+			registries: map[string]RegistryEndpointOpts{"localhost:5001": {ContainerHost: "host.lima.internal:5001"}},
+			ref:        "localhost:5001/app:dev", want: "host.lima.internal:5001/app:dev", rewritten: true,
+		},
+		{
+			name: "Linux CI runner",
+			host: EndpointHost{GOOS: "linux", Gateway: "host.docker.internal"},
+			ref:  "localhost:5001/app:dev", want: "127.0.0.1:5001/app:dev", rewritten: true,
+		},
+		{
+			name: "host network",
+			host: EndpointHost{GOOS: "darwin", Gateway: "host.docker.internal", HostNetwork: true},
+			ref:  "localhost:5001/app:dev", want: "localhost:5001/app:dev",
+		},
+		{
+			name: "other port",
+			host: EndpointHost{GOOS: "darwin", Gateway: "host.docker.internal"},
+			ref:  "localhost:5000/app:dev", want: "localhost:5000/app:dev",
+		},
+		{
+			name: "remote registry",
+			host: EndpointHost{GOOS: "linux"},
+			ref:  "ghcr.io/acme/app:v1", want: "ghcr.io/acme/app:v1",
+		},
+		{
+			name:       "registry alias",
+			host:       EndpointHost{GOOS: "linux"},
+			registries: map[string]RegistryEndpointOpts{"registry.local:5000": {ContainerHost: "10.0.2.2:5000"}},
+			ref:        "registry.local:5000/team/app:v1", want: "10.0.2.2:5000/team/app:v1", rewritten: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewRegistryEndpoints(local, tt.host, tt.registries, nil)
+			got, ok := e.ContainerRef(tt.ref)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.rewritten, ok)
+		})
+	}
+}
+
+func TestRegistryEndpoints_Insecure(t *testing.T) {
+	e := NewRegistryEndpoints(LocalRegistryOpts{Host: "localhost", Port: 5001}, EndpointHost{GOOS: "darwin", Gateway: "host.docker.internal"},
+		map[string]RegistryEndpointOpts{
+			"registry.local:5000": {Insecure: true, ContainerHost: "10.0.2.2:5000"},
+			"ghcr.io":             {},
+		}, []string{"myreg:5000"})
+
+	assert.Equal(t, []string{"myreg:5000", "registry.local:5000"}, e.InsecureRegistries())
+	assert.True(t, e.Insecure("registry.local:5000/app"))
+	assert.True(t, e.Insecure("myreg:5000/app:v1"))
+	assert.False(t, e.Insecure("ghcr.io/acme/app"))
+
+	// The local registry is self-signed: its container address is insecure
+	// too, as is the alias of an insecure registry.
+	assert.Equal(t, []string{"myreg:5000", "registry.local:5000", "host.docker.internal:5001", "10.0.2.2:5000"},
+		e.ContainerInsecureRegistries("localhost:5001/app:dev", "127.0.0.1:5001/run:dev", "registry.local:5000/app", "ghcr.io/acme/run"))
+}
+
+func TestResolveRegistryEndpoints(t *testing.T) {
+	cwd := t.TempDir()
+	writeRunConfig(t, cwd, `
+local_registry:
+  port: 5002
+registries:
+  localhost:5002:
+    container_host: host.lima.internal:5002
+  registry.local:5000:
+    insecure: true
+`)
+	t.Setenv("OP_REGISTRY_HOST", "")
+	t.Setenv("OP_REGISTRY_PORT", "")
+	t.Setenv("OP_PACK_NETWORK", "")
+
+	e := ResolveRegistryEndpoints(cwd, []string{"myreg:5000"})
+	got, ok := e.ContainerRef("localhost:5002/app:dev")
+	assert.True(t, ok)
+	assert.Equal(t, "host.lima.internal:5002/app:dev", got)
+	assert.Equal(t, []string{"myreg:5000", "registry.local:5000"}, e.InsecureRegistries())
+
+	t.Setenv("OP_PACK_NETWORK", "host")
+	got, _ = ResolveRegistryEndpoints(cwd, nil).ContainerRef("ghcr.io/acme/app:v1")
+	assert.Equal(t, "ghcr.io/acme/app:v1", got)
+}
@@ -14,6 +14,13 @@ func writeRegistryFile(t *testing.T, dir, content string) {
 	require.NoError(t, os.WriteFile(filepath.Join(dir, RegistryFilename), []byte(content), 0o644))
 }
 
+func defaultRepoFromRegistry(t *testing.T, dir string) string {
+	t.Helper()
+	repo, err := GetDefaultRepoFromRegistry(dir)
+	require.NoError(t, err)
+	return repo
+}
+
 func TestInterpolate(t *testing.T) {
 	cases := []struct {
 		name  string
@@ -64,7 +71,9 @@ func TestInterpolate(t *testing.T) {
 			for k, v := range tc.env {
 				t.Setenv(k, v)
 			}
-			assert.Equal(t, tc.want, interpolate(tc.input))
+			got, err := interpolate(tc.input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
 		})
 	}
 }
@@ -73,7 +82,7 @@ func TestGetDefaultRepoFromRegistry_Local(t *testing.T) {
 	dir := t.TempDir()
 	t.Setenv("GITHUB_ACTIONS", "")
 	writeRegistryFile(t, dir, "local: localhost:5001\nci:\n  - ghcr.io/myorg\n")
-	assert.Equal(t, "localhost:5001", GetDefaultRepoFromRegistry(dir))
+	assert.Equal(t, "localhost:5001", defaultRepoFromRegistry(t, dir))
 }
 
 func TestGetDefaultRepoFromRegistry_CI(t *testing.T) {
@@ -81,7 +90,7 @@ func TestGetDefaultRepoFromRegistry_CI(t *testing.T) {
 	t.Setenv("GITHUB_ACTIONS", "true")
 	t.Setenv("MY_ORG", "acme")
 	writeRegistryFile(t, dir, "ci:\n  - ghcr.io/${MY_ORG:-fallback}\n")
-	assert.Equal(t, "ghcr.io/acme", GetDefaultRepoFromRegistry(dir))
+	assert.Equal(t, "ghcr.io/acme", defaultRepoFromRegistry(t, dir))
 }
 
 func TestGetDefaultRepoFromRegistry_CIDefaultFallback(t *testing.T) {
@@ -89,16 +98,143 @@ func TestGetDefaultRepoFromRegistry_CIDefaultFallback(t *testing.T) {
 	t.Setenv("GITHUB_ACTIONS", "true")
 	t.Setenv("MY_ORG", "")
 	writeRegistryFile(t, dir, "ci:\n  - ghcr.io/${MY_ORG:-fallback-org}\n")
-	assert.Equal(t, "ghcr.io/fallback-org", GetDefaultRepoFromRegistry(dir))
+	assert.Equal(t, "ghcr.io/fallback-org", defaultRepoFromRegistry(t, dir))
 }
 
 func TestGetDefaultRepoFromRegistry_Missing(t *testing.T) {
-	assert.Equal(t, "", GetDefaultRepoFromRegistry(t.TempDir()))
+	assert.Equal(t, "", defaultRepoFromRegistry(t, t.TempDir()))
 }
 
 func TestGetDefaultRepoFromRegistry_LegacyDestinations(t *testing.T) {
 	dir := t.TempDir()
 	t.Setenv("GITHUB_ACTIONS", "true")
 	writeRegistryFile(t, dir, "destinations:\n  - ghcr.io/legacy-org\n")
-	assert.Equal(t, "ghcr.io/legacy-org", GetDefaultRepoFromRegistry(dir))
+	assert.Equal(t, "ghcr.io/legacy-org", defaultRepoFromRegistry(t, dir))
+}
+
+const registryWithRules = `local: localhost:5001
+ci:
+  - registry: ghcr.io/acme/pr
+    events: [pull_request]
+  - registry: europe-docker.pkg.dev/acme/release
+    branches: [main, release/*]
+    platforms: [linux/amd64, linux/arm64]
+  - registry: registry.internal:5000/acme
+    insecure: true
+    platforms: [linux/amd64]
+environments:
+  dev: europe-docker.pkg.dev/acme/dev
+  prod:
+    registry: ${PROD_REGISTRY:-europe-docker.pkg.dev/acme/prod}
+`
+
+func TestResolveRegistry_SelectionRules(t *testing.T) {
+	dir := t.TempDir()
+	writeRegistryFile(t, dir, registryWithRules)
+	t.Setenv("GITHUB_ACTIONS", "true")
+
+	cases := []struct {
+		name, event, ref, headRef, want string
+	}{
+		{name: "pull request", event: "pull_request", ref: "42/merge", headRef: "feature/x", want: "ghcr.io/acme/pr"},
+		{name: "main", event: "push", ref: "main", want: "europe-docker.pkg.dev/acme/release"},
+		{name: "release glob", event: "push", ref: "release/1.2", want: "europe-docker.pkg.dev/acme/release"},
+		{name: "other branch", event: "push", ref: "feature/y", want: "registry.internal:5000/acme"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("GITHUB_EVENT_NAME", tc.event)
+			t.Setenv("GITHUB_REF_NAME", tc.ref)
+			t.Setenv("GITHUB_HEAD_REF", tc.headRef)
+			e, ok, err := ResolveRegistry(dir)
+			require.NoError(t, err)
+			require.True(t, ok)
+			assert.Equal(t, tc.want, e.Registry)
+		})
+	}
+}
+
+func TestResolveRegistry_GitLab(t *testing.T) {
+	dir := t.TempDir()
+	writeRegistryFile(t, dir, registryWithRules)
+	setGitLabCI(t)
+
+	t.Setenv("CI_PIPELINE_SOURCE", "merge_request_event")
+	t.Setenv("CI_COMMIT_REF_NAME", "feature/x")
+	t.Setenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME", "release/1.2")
+	assert.Equal(t, "europe-docker.pkg.dev/acme/release", defaultRepoFromRegistry(t, dir))
+
+	t.Setenv("CI_PIPELINE_SOURCE", "push")
+	t.Setenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME", "")
+	assert.Equal(t, "registry.internal:5000/acme", defaultRepoFromRegistry(t, dir))
+}
+
+func TestResolveRegistry_NoMatchingCIEntry(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("GITHUB_REF_NAME", "feature/x")
+	writeRegistryFile(t, dir, "local: localhost:5001\nci:\n  - registry: ghcr.io/acme\n    branches: [main]\n")
+	_, ok, err := ResolveRegistry(dir)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "", defaultRepoFromRegistry(t, dir))
+}
+
+func TestGetRegistryEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	writeRegistryFile(t, dir, registryWithRules)
+
+	e, ok, err := GetRegistryEnvironment(dir, "dev")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "europe-docker.pkg.dev/acme/dev", e.Registry)
+
+	t.Setenv("PROD_REGISTRY", "gcr.io/acme-prod")
+	e, ok, err = GetRegistryEnvironment(dir, "prod")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "gcr.io/acme-prod", e.Registry)
+
+	_, ok, err = GetRegistryEnvironment(dir, "pp")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, []string{"dev", "prod"}, RegistryEnvironments(dir))
+}
+
+func TestRegistriesAsWritten(t *testing.T) {
+	dir := t.TempDir()
+	writeRegistryFile(t, dir, "ci:\n  - ghcr.io/${GITHUB_REPOSITORY_OWNER}\nenvironments:\n  prod: ${PROD_REGISTRY:?set PROD_REGISTRY}\n")
+	assert.Equal(t, []string{"ghcr.io/${GITHUB_REPOSITORY_OWNER}"}, RegistriesAsWritten(dir, ""))
+	assert.Equal(t, []string{"${PROD_REGISTRY:?set PROD_REGISTRY}"}, RegistriesAsWritten(dir, "prod"))
+	assert.Nil(t, RegistriesAsWritten(dir, "pp"))
+	assert.Nil(t, RegistriesAsWritten(t.TempDir(), ""))
+}
+
+func TestRegistryOptions(t *testing.T) {
+	dir := t.TempDir()
+	writeRegistryFile(t, dir, registryWithRules)
+
+	e, ok := RegistryOptions(dir, "registry.internal:5000/acme/my-app")
+	require.True(t, ok)
+	assert.True(t, e.Insecure)
+	assert.Equal(t, []string{"linux/amd64"}, e.Platforms)
+
+	_, ok = RegistryOptions(dir, "registry.internal:5000/acme-other")
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"registry.internal:5000/acme"}, RegistryInsecureRegistries(dir))
+}
+
+func TestResolveRegistry_RequiredVariable(t *testing.T) {
+	dir := t.TempDir()
+	writeRegistryFile(t, dir, "local: localhost:5001\nci:\n  - ghcr.io/${GITHUB_REPOSITORY_OWNER:?set by GitHub Actions}\n")
+
+	// Only the selected entry is expanded.
+	t.Setenv("GITHUB_ACTIONS", "")
+	assert.Equal(t, "localhost:5001", defaultRepoFromRegistry(t, dir))
+
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("GITHUB_REPOSITORY_OWNER", "")
+	_, err := GetDefaultRepoFromRegistry(dir)
+	assert.EqualError(t, err, ".registry: GITHUB_REPOSITORY_OWNER: set by GitHub Actions")
 }
@@ -0,0 +1,302 @@
+package util
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// DefaultRegistryConcurrency is the number of requests in flight to one
+	// registry host unless configured otherwise.
+	DefaultRegistryConcurrency = 8
+	// registryMaxRetries is how often a throttled request is retried.
+	registryMaxRetries = 5
+	// registryMaxWait caps a single Retry-After wait.
+	registryMaxWait = time.Minute
+)
+
+// registryCA is the CA bundle trusted for registry calls on top of the
+// system roots (see SetRegistryCA), and the transports trusting it, one per
+// insecure setting, so connections are reused across calls.
+var registryCA struct {
+	sync.Mutex
+	path       string
+	pool       *x509.CertPool
+	transports map[bool]*http.Transport
+}
+
+// RegistryCertPool returns the system roots plus the PEM certificates at
+// caPath, if set.
+func RegistryCertPool(caPath string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if caPath == "" {
+		return pool, nil
+	}
+	data, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, err
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no PEM certificate found", caPath)
+	}
+	return pool, nil
+}
+
+// SetRegistryCA trusts the PEM bundle at path, in addition to the system
+// roots, for every registry call made through RegistryHTTPTransport; ""
+// trusts the system roots only.
+func SetRegistryCA(path string) error {
+	var pool *x509.CertPool
+	if path != "" {
+		var err error
+		if pool, err = RegistryCertPool(path); err != nil {
+			return fmt.Errorf("registry CA: %w", err)
+		}
+		// Absolute, so it can be mounted into builder containers.
+		if path, err = filepath.Abs(path); err != nil {
+			return fmt.Errorf("registry CA: %w", err)
+		}
+	}
+	registryCA.Lock()
+	defer registryCA.Unlock()
+	registryCA.path, registryCA.pool = path, pool
+	registryCA.transports = nil
+	return nil
+}
+
+// RegistryCAPath returns the CA bundle set with SetRegistryCA ("" for none),
+// so builders running in containers can be given the same bundle.
+func RegistryCAPath() string {
+	registryCA.Lock()
+	defer registryCA.Unlock()
+	return registryCA.path
+}
+
+// RegistryHTTPTransport returns the base transport for registry calls: the
+// proxy from $HTTPS_PROXY/$HTTP_PROXY/$NO_PROXY and the registry CA bundle,
+// or no TLS verification at all when insecure (self-signed registries).
+// The transport is shared until the CA bundle changes, so that connections
+// are reused; Clone it before changing it.
+func RegistryHTTPTransport(insecure bool) *http.Transport {
+	registryCA.Lock()
+	defer registryCA.Unlock()
+	if t, ok := registryCA.transports[insecure]; ok {
+		return t
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	switch {
+	case insecure:
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	case registryCA.pool != nil:
+		t.TLSClientConfig = &tls.Config{RootCAs: registryCA.pool}
+	}
+	if registryCA.transports == nil {
+		registryCA.transports = map[bool]*http.Transport{}
+	}
+	registryCA.transports[insecure] = t
+	return t
+}
+
+// registrySleep waits d or until ctx is done; a var so tests need not sleep.
+var registrySleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// registrySlots limits the requests in flight per registry host, shared by
+// every transport from RegistryTransport.
+var registrySlots struct {
+	sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+// RegistryConcurrency returns the request limit for host: max_concurrency of
+// its .registry entry, else $OP_REGISTRY_MAX_CONCURRENCY or the
+// registry_max_concurrency config key, else DefaultRegistryConcurrency.
+func RegistryConcurrency(host string) int {
+	if raw := readRegistryFile(""); raw != nil {
+		for _, e := range raw.entries() {
+			if e.MaxConcurrency > 0 && strings.Split(e.Registry, "/")[0] == host {
+				return e.MaxConcurrency
+			}
+		}
+	}
+	if n, err := strconv.Atoi(cmp.Or(os.Getenv("OP_REGISTRY_MAX_CONCURRENCY"), viper.GetString("registry_max_concurrency"))); err == nil && n > 0 {
+		return n
+	}
+	return DefaultRegistryConcurrency
+}
+
+// acquireRegistrySlot waits for a free request slot for host and returns the
+// function that frees it.
+func acquireRegistrySlot(ctx context.Context, host string) (func(), error) {
+	registrySlots.Lock()
+	if registrySlots.hosts == nil {
+		registrySlots.hosts = map[string]chan struct{}{}
+	}
+	slots, ok := registrySlots.hosts[host]
+	if !ok {
+		slots = make(chan struct{}, RegistryConcurrency(host))
+		registrySlots.hosts[host] = slots
+	}
+	registrySlots.Unlock()
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// RegistryTransport wraps base (RegistryHTTPTransport(false) when nil) for
+// registry calls: the auth handshake is cached (see registryAuth), requests
+// per host are limited (see RegistryConcurrency), a request holding its slot
+// until its response body is closed, and 429 responses, or 503 with
+// Retry-After, are retried after the delay the registry asks for
+// (exponential backoff without one). Throttling is
+// logged and recorded as op_registry_throttled_total and
+// op_registry_throttle_wait_seconds.
+func RegistryTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = RegistryHTTPTransport(false)
+	}
+	if _, ok := base.(*registryTransport); ok {
+		return base
+	}
+	return &registryTransport{base: base}
+}
+
+type registryTransport struct {
+	base http.RoundTripper
+}
+
+func (t *registryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, cacheable := registryAuthKey(req)
+	if cacheable {
+		if resp, ok := cachedRegistryAuth(key, req); ok {
+			return resp, nil
+		}
+	}
+	resp, err := t.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	noteRegistryRealm(resp)
+	if cacheable {
+		return storeRegistryAuth(key, req, resp)
+	}
+	return resp, nil
+}
+
+// roundTrip sends req within the host's request limit, retrying throttled
+// responses.
+func (t *registryTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	for attempt := 0; ; attempt++ {
+		release, err := acquireRegistrySlot(req.Context(), host)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		// A streamed body cannot be sent again.
+		streamed := req.Body != nil && req.Body != http.NoBody && req.GetBody == nil
+		if !isThrottled(resp) || attempt == registryMaxRetries || streamed {
+			resp.Body = &slotBody{ReadCloser: resp.Body, release: release}
+			return resp, nil
+		}
+		wait := retryAfter(resp, attempt)
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		_ = resp.Body.Close()
+		// Other requests to the host go ahead while this one waits.
+		release()
+
+		slog.Warn("Registry rate limit; retrying", "registry", host, "status", resp.StatusCode, "wait", wait, "attempt", attempt+1)
+		AddMetric(MetricSample{
+			Name:   "op_registry_throttled_total",
+			Help:   "Registry responses that asked op to slow down (429, or 503 with Retry-After).",
+			Type:   MetricCounter,
+			Labels: map[string]string{"registry": host},
+			Value:  1,
+		})
+		AddMetric(MetricSample{
+			Name:   "op_registry_throttle_wait_seconds",
+			Help:   "Time spent waiting for registry rate limits.",
+			Type:   MetricCounter,
+			Labels: map[string]string{"registry": host},
+			Value:  wait.Seconds(),
+		})
+		if err := registrySleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// slotBody is a response body that frees its request slot when closed, so
+// the slot covers reading the body (blob downloads) too.
+type slotBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *slotBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// isThrottled reports whether the registry asked to slow down.
+func isThrottled(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusServiceUnavailable && resp.Header.Get("Retry-After") != "")
+}
+
+// retryAfter returns the delay of resp's Retry-After header (seconds or an
+// HTTP date), capped at registryMaxWait; without one, 1s doubled per attempt.
+func retryAfter(resp *http.Response, attempt int) time.Duration {
+	wait := time.Second << attempt
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			wait = time.Duration(secs) * time.Second
+		} else if at, err := http.ParseTime(v); err == nil {
+			wait = time.Until(at)
+		}
+	}
+	return min(max(wait, 0), registryMaxWait)
+}
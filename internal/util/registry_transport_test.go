@@ -0,0 +1,271 @@
+package util
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noRegistrySleep records the waits of the registry transport instead of
+// sleeping.
+func noRegistrySleep(t *testing.T) *[]time.Duration {
+	var waits []time.Duration
+	old := registrySleep
+	registrySleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	t.Cleanup(func() { registrySleep = old })
+	return &waits
+}
+
+func TestRegistryTransport_RetriesThrottled(t *testing.T) {
+	waits := noRegistrySleep(t)
+	var calls atomic.Int32
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		switch calls.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+	StartMetrics(MetricsConfig{Pushgateway: "http://unused"}, "build")
+	defer StartMetrics(MetricsConfig{}, "")
+
+	client := &http.Client{Transport: RegistryTransport(nil)}
+	resp, err := client.Post(srv.URL+"/v2/app/blobs/uploads/", "application/octet-stream", strings.NewReader("layer"))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, []time.Duration{2 * time.Second, time.Second}, *waits)
+	assert.Equal(t, []string{"layer", "layer", "layer"}, bodies)
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	var throttled, waited float64
+	for _, s := range metrics.samples {
+		switch s.Name {
+		case "op_registry_throttled_total":
+			assert.Equal(t, host, s.Labels["registry"])
+			throttled = s.Value
+		case "op_registry_throttle_wait_seconds":
+			waited = s.Value
+		}
+	}
+	assert.Equal(t, 2.0, throttled)
+	assert.Equal(t, 3.0, waited)
+}
+
+func TestRegistryTransport_GivesUp(t *testing.T) {
+	waits := noRegistrySleep(t)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	resp, err := (&http.Client{Transport: RegistryTransport(nil)}).Get(srv.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.EqualValues(t, registryMaxRetries+1, calls.Load())
+	// Exponential backoff without Retry-After.
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second}, *waits)
+}
+
+func TestRegistryTransport_NotThrottled(t *testing.T) {
+	noRegistrySleep(t)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	resp, err := (&http.Client{Transport: RegistryTransport(nil)}).Get(srv.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.EqualValues(t, 1, calls.Load())
+
+	// Wrapping twice does not stack the transports.
+	tr := RegistryTransport(nil)
+	assert.Same(t, tr, RegistryTransport(tr))
+}
+
+func TestRegistryTransport_LimitsConcurrency(t *testing.T) {
+	t.Chdir(t.TempDir())
+	var inFlight, peak atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-release
+		inFlight.Add(-1)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	require.NoError(t, os.WriteFile(RegistryFilename, []byte("local:\n  registry: "+u.Host+"/dev\n  max_concurrency: 2\n"), 0o644))
+	assert.Equal(t, 2, RegistryConcurrency(u.Host))
+
+	client := &http.Client{Transport: RegistryTransport(nil)}
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp, err := client.Get(srv.URL); err == nil {
+				_ = resp.Body.Close()
+			}
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.EqualValues(t, 2, peak.Load())
+}
+
+// oneSlotRegistry starts a registry server allowed one request at a time.
+func oneSlotRegistry(t *testing.T, h http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	require.NoError(t, os.WriteFile(RegistryFilename, []byte("local:\n  registry: "+u.Host+"/dev\n  max_concurrency: 1\n"), 0o644))
+	return srv
+}
+
+func TestRegistryTransport_HoldsSlotUntilBodyClosed(t *testing.T) {
+	srv := oneSlotRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "blob")
+	})
+	client := &http.Client{Transport: RegistryTransport(nil)}
+	first, err := client.Get(srv.URL + "/v2/app/blobs/sha256:a")
+	require.NoError(t, err)
+
+	// The first body is still being read: the second request waits.
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v2/app/blobs/sha256:b", nil)
+	_, err = client.Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	body, _ := io.ReadAll(first.Body)
+	assert.Equal(t, "blob", string(body))
+	require.NoError(t, first.Body.Close())
+	require.NoError(t, first.Body.Close(), "closing twice frees the slot once")
+	second, err := client.Get(srv.URL + "/v2/app/blobs/sha256:b")
+	require.NoError(t, err)
+	_ = second.Body.Close()
+}
+
+func TestRegistryTransport_FreesSlotWhileWaiting(t *testing.T) {
+	var calls atomic.Int32
+	srv := oneSlotRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	})
+	client := &http.Client{Transport: RegistryTransport(nil)}
+	old := registrySleep
+	t.Cleanup(func() { registrySleep = old })
+	var during error
+	registrySleep = func(ctx context.Context, _ time.Duration) error {
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodHead, srv.URL+"/v2/", nil)
+		resp, err := client.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		during = err
+		return nil
+	}
+
+	resp, err := client.Get(srv.URL + "/v2/app/manifests/v1")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, during, "a request to the host ran during the Retry-After wait")
+	assert.EqualValues(t, 3, calls.Load())
+}
+
+func TestRegistryHTTPTransport_Shared(t *testing.T) {
+	t.Cleanup(func() { _ = SetRegistryCA("") })
+	secure := RegistryHTTPTransport(false)
+	assert.Same(t, secure, RegistryHTTPTransport(false))
+	assert.NotSame(t, secure, RegistryHTTPTransport(true))
+	assert.True(t, RegistryHTTPTransport(true).TLSClientConfig.InsecureSkipVerify)
+
+	// A new CA bundle gets new transports.
+	require.NoError(t, SetRegistryCA(""))
+	assert.NotSame(t, secure, RegistryHTTPTransport(false))
+}
+
+func TestRegistryConcurrency_Env(t *testing.T) {
+	t.Chdir(t.TempDir())
+	assert.Equal(t, DefaultRegistryConcurrency, RegistryConcurrency("ghcr.io"))
+	t.Setenv("OP_REGISTRY_MAX_CONCURRENCY", "3")
+	assert.Equal(t, 3, RegistryConcurrency("ghcr.io"))
+}
+
+func TestRetryAfter(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	assert.Equal(t, 4*time.Second, retryAfter(resp, 2))
+	resp.Header.Set("Retry-After", "3600")
+	assert.Equal(t, registryMaxWait, retryAfter(resp, 0))
+	resp.Header.Set("Retry-After", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+	assert.Equal(t, time.Duration(0), retryAfter(resp, 0))
+}
+
+func TestSetRegistryCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	t.Cleanup(func() { _ = SetRegistryCA("") })
+
+	_, err := (&http.Client{Transport: RegistryHTTPTransport(false)}).Get(srv.URL)
+	assert.ErrorContains(t, err, "certificate")
+
+	t.Chdir(t.TempDir())
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile("ca.crt", ca, 0o644))
+	require.NoError(t, SetRegistryCA("ca.crt"))
+	assert.True(t, filepath.IsAbs(RegistryCAPath()))
+
+	resp, err := (&http.Client{Transport: RegistryHTTPTransport(false)}).Get(srv.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	require.NoError(t, os.WriteFile("empty.crt", nil, 0o644))
+	assert.ErrorContains(t, SetRegistryCA("empty.crt"), "no PEM certificate")
+	assert.Error(t, SetRegistryCA("missing.crt"))
+}
@@ -10,20 +10,25 @@ import (
 // Order:
 // 1. Env var SKAFFOLD_DEFAULT_REPO
 // 2. Config "default_repo" (viper)
-// 3. .registry file (local or ci based on GITHUB_ACTIONS)
-// 4. Fallback: localhost:5001
-func ResolveDefaultRepo(cwd string) string {
+// 3. .registry file (local or ci, see ResolveRegistry)
+// 4. The registry of the CI system (see CIRegistry)
+// 5. Fallback: the local registry endpoint (see ResolveLocalRegistry)
+func ResolveDefaultRepo(cwd string) (string, error) {
 	if repo := os.Getenv("SKAFFOLD_DEFAULT_REPO"); repo != "" {
-		return repo
+		return repo, nil
 	}
 
 	if repo := viper.GetString("default_repo"); repo != "" {
-		return repo
+		return repo, nil
 	}
 
-	if repo := GetDefaultRepoFromRegistry(cwd); repo != "" {
-		return repo
+	if repo, err := GetDefaultRepoFromRegistry(cwd); repo != "" || err != nil {
+		return repo, err
 	}
 
-	return "localhost:5001"
+	if repo := CIRegistry(); repo != "" {
+		return repo, nil
+	}
+
+	return ResolveLocalRegistry(cwd).Endpoint(), nil
 }
@@ -11,7 +11,9 @@ import (
 
 func TestResolveDefaultRepo_FromEnv(t *testing.T) {
 	t.Setenv("SKAFFOLD_DEFAULT_REPO", "ghcr.io/env-org")
-	assert.Equal(t, "ghcr.io/env-org", ResolveDefaultRepo(t.TempDir()))
+	repo, err := ResolveDefaultRepo(t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/env-org", repo)
 }
 
 func TestResolveDefaultRepo_FromRegistryFile(t *testing.T) {
@@ -19,10 +21,23 @@ func TestResolveDefaultRepo_FromRegistryFile(t *testing.T) {
 	t.Setenv("SKAFFOLD_DEFAULT_REPO", "")
 	t.Setenv("GITHUB_ACTIONS", "")
 	require.NoError(t, os.WriteFile(filepath.Join(dir, ".registry"), []byte("local: localhost:5001\n"), 0o644))
-	assert.Equal(t, "localhost:5001", ResolveDefaultRepo(dir))
+	repo, err := ResolveDefaultRepo(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:5001", repo)
+}
+
+func TestResolveDefaultRepo_GitLabRegistry(t *testing.T) {
+	t.Setenv("SKAFFOLD_DEFAULT_REPO", "")
+	setGitLabCI(t)
+	repo, err := ResolveDefaultRepo(t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, "registry.gitlab.com/acme/app", repo)
 }
 
 func TestResolveDefaultRepo_Fallback(t *testing.T) {
 	t.Setenv("SKAFFOLD_DEFAULT_REPO", "")
-	assert.Equal(t, "localhost:5001", ResolveDefaultRepo(t.TempDir()))
+	t.Setenv("GITLAB_CI", "")
+	repo, err := ResolveDefaultRepo(t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:5001", repo)
 }
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -13,12 +14,152 @@ type RunConfig struct {
 	DefaultRepo string                 `yaml:"default_repo"`
 	Tag         string                 `yaml:"tag"`
 	Contexts    map[string]ContextOpts `yaml:"contexts"`
+	// LocalRegistry overrides the local registry host, port and container name.
+	LocalRegistry LocalRegistryOpts `yaml:"local_registry"`
+	// Tests are the `op test` assertions per artifact, keyed by image name
+	// as it appears in build_result.json.
+	Tests map[string]ImageTestOpts `yaml:"tests"`
+	// GitOps configures `op gitops-update`.
+	GitOps GitOpsOpts `yaml:"gitops"`
+	// Preview configures `op preview-env`.
+	Preview PreviewOpts `yaml:"preview"`
+	// CI configures the workflow generated by `op ci generate`.
+	CI CIOpts `yaml:"ci"`
+	// Build holds per-artifact settings `op build` merges over skaffold.yaml.
+	Build BuildConfig `yaml:"build"`
+	// Registries are per-registry endpoint settings, keyed by host:port
+	// (see RegistryEndpoints).
+	Registries map[string]RegistryEndpointOpts `yaml:"registries"`
+}
+
+// BuildConfig configures `op build`.
+type BuildConfig struct {
+	// Artifacts are keyed by image name as it appears in skaffold.yaml.
+	Artifacts map[string]ArtifactBuildOpts `yaml:"artifacts"`
+	// VersionEnv configures how the version is read from the environment.
+	VersionEnv VersionEnvOpts `yaml:"version_env"`
+}
+
+// ArtifactBuildOpts are the `op build` settings of one artifact. Set fields
+// override skaffold.yaml; flags override them.
+type ArtifactBuildOpts struct {
+	// Env is extra buildpack env, merged over buildpacks.env.
+	Env map[string]string `yaml:"env"`
+	// Platforms replaces the build platforms unless --platform is given.
+	Platforms []string `yaml:"platforms"`
+	// CacheImage is a registry image Pack keeps the build cache in; for
+	// Dockerfile artifacts, the BuildKit registry cache.
+	CacheImage string `yaml:"cache_image"`
+	// Annotations are set on the pushed image index, which is then an OCI
+	// index (also for a single platform).
+	Annotations map[string]string `yaml:"annotations"`
+	// SBOM turns the SBOM export off (false) or on (true; into sbom/ unless
+	// --sbom-output is set).
+	SBOM *bool `yaml:"sbom"`
+	// Buildpacks replace buildpacks.buildpacks of skaffold.yaml, the
+	// buildpacks Pack runs instead of the builder's order; list
+	// "from=builder" to add to the builder's order instead.
+	Buildpacks []string `yaml:"buildpacks"`
+	// ChartDependencies resolves the dependencies of a chart artifact
+	// before it is packaged: "update" (helm dependency update) or "locked"
+	// (helm dependency build of an up-to-date Chart.lock).
+	ChartDependencies string `yaml:"chart_dependencies"`
+}
+
+// CIOpts configures the GitHub Actions workflow of `op ci generate`.
+type CIOpts struct {
+	// Branch is the branch whose pushes are deployed (default main).
+	Branch string `yaml:"branch"`
+	// Environments is the promotion order: the first is deployed from the
+	// build, each next one promoted from the one before (default: the
+	// environments of .registry, dev, pp and prod first).
+	Environments []string `yaml:"environments"`
+	// Components are the Deployments watch-deployment waits for, keyed by
+	// image name (default: the image name).
+	Components map[string]string `yaml:"components"`
+	// Namespace is the namespace of the Deployments (default: the component).
+	Namespace string `yaml:"namespace"`
+	// Scan turns the vulnerability scan of the built images off (false).
+	Scan *bool `yaml:"scan"`
+	// ScanSeverity is the lowest severity that fails the scan (default high).
+	ScanSeverity string `yaml:"scan_severity"`
+}
+
+// ArtifactBuild returns the build settings of image (zero when unset).
+func (c *RunConfig) ArtifactBuild(image string) ArtifactBuildOpts {
+	if c == nil {
+		return ArtifactBuildOpts{}
+	}
+	return c.Build.Artifacts[image]
 }
 
 type ContextOpts struct {
 	Ports   []string          `yaml:"ports"`
 	Env     map[string]string `yaml:"env"`
 	Volumes []string          `yaml:"volumes"`
+	// Chart is a Helm chart path (relative to the repo root) used by
+	// `op run --cluster` instead of the generated Deployment/Service.
+	Chart string `yaml:"chart"`
+	// Dependencies are backing services (databases, caches, ...) started by
+	// `op run` on a shared network before the app, keyed by network alias.
+	Dependencies map[string]DependencyOpts `yaml:"dependencies"`
+	// Secrets maps env var names to secret references (op://..., env://...)
+	// resolved at run time; SecretFiles are SOPS-encrypted dotenv/YAML/JSON files.
+	Secrets     map[string]string `yaml:"secrets"`
+	SecretFiles []string          `yaml:"secret_files"`
+	// CPUs, Memory, AddHosts and Network map to the docker run flags of the
+	// same name; DockerArgs are passed to docker run verbatim.
+	CPUs       string   `yaml:"cpus"`
+	Memory     string   `yaml:"memory"`
+	AddHosts   []string `yaml:"add_hosts"`
+	Network    string   `yaml:"network"`
+	DockerArgs []string `yaml:"docker_args"`
+}
+
+// DependencyOpts describes a backing service container for a context.
+type DependencyOpts struct {
+	Image   string            `yaml:"image"`
+	Env     map[string]string `yaml:"env"`
+	Ports   []string          `yaml:"ports"`
+	Volumes []string          `yaml:"volumes"`
+}
+
+// ImageTestOpts are container-structure-test style assertions for one image.
+type ImageTestOpts struct {
+	CommandTests       []CommandTest       `yaml:"command_tests"`
+	FileExistenceTests []FileExistenceTest `yaml:"file_existence_tests"`
+	Metadata           *MetadataTest       `yaml:"metadata"`
+}
+
+// CommandTest runs Command (as the entrypoint) with Args in the image and
+// checks the exit code and output. ExpectedOutput and ExcludedOutput are
+// regular expressions matched against combined stdout and stderr.
+type CommandTest struct {
+	Name           string            `yaml:"name"`
+	Command        string            `yaml:"command"`
+	Args           []string          `yaml:"args"`
+	Env            map[string]string `yaml:"env"`
+	ExitCode       int               `yaml:"exit_code"`
+	ExpectedOutput []string          `yaml:"expected_output"`
+	ExcludedOutput []string          `yaml:"excluded_output"`
+}
+
+// FileExistenceTest checks that Path exists in the image filesystem (or,
+// with ShouldExist: false, that it does not).
+type FileExistenceTest struct {
+	Name        string `yaml:"name"`
+	Path        string `yaml:"path"`
+	ShouldExist *bool  `yaml:"should_exist"`
+}
+
+// MetadataTest checks the image config. Only the fields that are set are compared.
+type MetadataTest struct {
+	Env          map[string]string `yaml:"env"`
+	ExposedPorts []string          `yaml:"exposed_ports"`
+	Entrypoint   []string          `yaml:"entrypoint"`
+	Cmd          []string          `yaml:"cmd"`
+	User         string            `yaml:"user"`
+	Workdir      string            `yaml:"workdir"`
 }
 
 func LoadRunConfig(cwd string) (*RunConfig, error) {
@@ -31,6 +172,9 @@ func LoadRunConfig(cwd string) (*RunConfig, error) {
 		return nil, err
 	}
 
+	if data, err = InterpolateYAML(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", RunConfigFilename, err)
+	}
 	var cfg RunConfig
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, err
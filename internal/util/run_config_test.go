@@ -104,3 +104,136 @@ func TestGetRunOptionsForContext_NilConfig(t *testing.T) {
 	assert.Empty(t, ports)
 	assert.Equal(t, "8080", env["PORT"])
 }
+
+func TestLoadRunConfig_Dependencies(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".github"), 0o755))
+	content := `
+contexts:
+  api:
+    dependencies:
+      postgres:
+        image: postgres:16
+        env:
+          POSTGRES_PASSWORD: dev
+        ports: ["5432:5432"]
+      redis:
+        image: redis:7
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, RunConfigFilename), []byte(content), 0o644))
+
+	cfg, err := LoadRunConfig(dir)
+	require.NoError(t, err)
+	deps := cfg.Contexts["api"].Dependencies
+	require.Len(t, deps, 2)
+	assert.Equal(t, "postgres:16", deps["postgres"].Image)
+	assert.Equal(t, "dev", deps["postgres"].Env["POSTGRES_PASSWORD"])
+	assert.Equal(t, []string{"5432:5432"}, deps["postgres"].Ports)
+	assert.Equal(t, "redis:7", deps["redis"].Image)
+}
+
+func TestLoadRunConfig_DockerRunOptions(t *testing.T) {
+	cwd := t.TempDir()
+	writeRunConfig(t, cwd, `
+contexts:
+  api:
+    cpus: "1.5"
+    memory: 512m
+    network: backend
+    add_hosts: ["db.internal:10.0.0.5"]
+    docker_args: ["--read-only"]
+`)
+
+	cfg, err := LoadRunConfig(cwd)
+	require.NoError(t, err)
+	api := cfg.Contexts["api"]
+	assert.Equal(t, "1.5", api.CPUs)
+	assert.Equal(t, "512m", api.Memory)
+	assert.Equal(t, "backend", api.Network)
+	assert.Equal(t, []string{"db.internal:10.0.0.5"}, api.AddHosts)
+	assert.Equal(t, []string{"--read-only"}, api.DockerArgs)
+}
+
+func TestLoadRunConfig_Tests(t *testing.T) {
+	cwd := t.TempDir()
+	writeRunConfig(t, cwd, `
+tests:
+  ghcr.io/org/api:
+    metadata:
+      exposed_ports: ["8080"]
+    file_existence_tests:
+      - path: /workspace/bin/api
+      - path: /workspace/.env
+        should_exist: false
+    command_tests:
+      - name: version
+        command: api
+        args: ["--version"]
+        expected_output: ["v\\d+"]
+`)
+
+	cfg, err := LoadRunConfig(cwd)
+	require.NoError(t, err)
+	api := cfg.Tests["ghcr.io/org/api"]
+	require.NotNil(t, api.Metadata)
+	assert.Equal(t, []string{"8080"}, api.Metadata.ExposedPorts)
+	require.Len(t, api.FileExistenceTests, 2)
+	assert.Nil(t, api.FileExistenceTests[0].ShouldExist)
+	require.NotNil(t, api.FileExistenceTests[1].ShouldExist)
+	assert.False(t, *api.FileExistenceTests[1].ShouldExist)
+	require.Len(t, api.CommandTests, 1)
+	assert.Equal(t, []string{`v\d+`}, api.CommandTests[0].ExpectedOutput)
+}
+
+func TestLoadRunConfig_Build(t *testing.T) {
+	cwd := t.TempDir()
+	writeRunConfig(t, cwd, `
+build:
+  artifacts:
+    ghcr.io/org/api:
+      env:
+        BP_GO_BUILD_FLAGS: -trimpath
+      platforms: [linux/amd64]
+      cache_image: ghcr.io/org/api-cache
+      annotations:
+        org.opencontainers.image.source: https://github.com/org/api
+      sbom: false
+`)
+
+	cfg, err := LoadRunConfig(cwd)
+	require.NoError(t, err)
+	api := cfg.ArtifactBuild("ghcr.io/org/api")
+	assert.Equal(t, map[string]string{"BP_GO_BUILD_FLAGS": "-trimpath"}, api.Env)
+	assert.Equal(t, []string{"linux/amd64"}, api.Platforms)
+	assert.Equal(t, "ghcr.io/org/api-cache", api.CacheImage)
+	assert.Equal(t, "https://github.com/org/api", api.Annotations["org.opencontainers.image.source"])
+	require.NotNil(t, api.SBOM)
+	assert.False(t, *api.SBOM)
+
+	assert.Equal(t, ArtifactBuildOpts{}, cfg.ArtifactBuild("ghcr.io/org/web"))
+	var none *RunConfig
+	assert.Equal(t, ArtifactBuildOpts{}, none.ArtifactBuild("ghcr.io/org/api"))
+}
+
+func TestLoadRunConfig_Interpolates(t *testing.T) {
+	cwd := t.TempDir()
+	t.Setenv("API_PORT", "9090")
+	writeRunConfig(t, cwd, `
+default_repo: ${OP_TEST_REPO:-localhost:5001}
+contexts:
+  api:
+    ports: ["${API_PORT}:8080"]
+    env:
+      PORT: "8080"
+      PRICE: $$5
+`)
+	cfg, err := LoadRunConfig(cwd)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:5001", cfg.DefaultRepo)
+	assert.Equal(t, []string{"9090:8080"}, cfg.Contexts["api"].Ports)
+	assert.Equal(t, "$5", cfg.Contexts["api"].Env["PRICE"])
+
+	writeRunConfig(t, cwd, "default_repo: ${OP_TEST_UNSET:?}\n")
+	_, err = LoadRunConfig(cwd)
+	assert.EqualError(t, err, ".github/octopilot.yaml: line 1: OP_TEST_UNSET: required but not set")
+}
@@ -0,0 +1,116 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Container runtimes supported by op.
+const (
+	RuntimeDocker = "docker"
+	RuntimePodman = "podman"
+)
+
+// ContainerRuntimeEnv selects the container runtime when --runtime is not set.
+const ContainerRuntimeEnv = "OP_CONTAINER_RUNTIME"
+
+// containerRuntime is the resolved runtime; empty until first use or SetContainerRuntime.
+var containerRuntime string
+
+// lookPath is exec.LookPath; a var so tests can control which CLIs "exist".
+var lookPath = exec.LookPath
+
+// podmanSocketPath asks podman for its API socket. A var so tests can replace it.
+var podmanSocketPath = func() string {
+	out, err := exec.Command("podman", "info", "--format", "{{.Host.RemoteSocket.Path}}").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// SetContainerRuntime selects docker or podman; "" or "auto" detects it.
+func SetContainerRuntime(name string) error {
+	switch name {
+	case "", "auto":
+		containerRuntime = DetectContainerRuntime()
+	case RuntimeDocker, RuntimePodman:
+		containerRuntime = name
+	default:
+		return fmt.Errorf("invalid container runtime %q (expected %s, %s or auto)", name, RuntimeDocker, RuntimePodman)
+	}
+	return nil
+}
+
+// ContainerCLI returns the CLI used for container commands ("docker" or "podman").
+func ContainerCLI() string {
+	if containerRuntime == "" {
+		containerRuntime = DetectContainerRuntime()
+	}
+	return containerRuntime
+}
+
+// IsPodman reports whether the selected runtime is podman.
+func IsPodman() bool {
+	return ContainerCLI() == RuntimePodman
+}
+
+// DetectContainerRuntime picks the runtime from OP_CONTAINER_RUNTIME, a
+// podman DOCKER_HOST socket, or the CLIs on PATH (docker preferred).
+func DetectContainerRuntime() string {
+	switch env := os.Getenv(ContainerRuntimeEnv); env {
+	case RuntimeDocker, RuntimePodman:
+		return env
+	}
+	if strings.Contains(os.Getenv("DOCKER_HOST"), "podman") {
+		return RuntimePodman
+	}
+	if _, err := lookPath("docker"); err == nil {
+		return RuntimeDocker
+	}
+	if _, err := lookPath("podman"); err == nil {
+		return RuntimePodman
+	}
+	return RuntimeDocker
+}
+
+// ConfigureRuntimeEnv prepares the environment for podman: DOCKER_HOST is
+// pointed at the podman API socket (when unset) so libraries that speak the
+// Docker API (Pack's lifecycle, the daemon image loader) use podman too, and
+// kind is told to use its podman provider. It does nothing for docker.
+func ConfigureRuntimeEnv() {
+	if !IsPodman() {
+		return
+	}
+	if os.Getenv("KIND_EXPERIMENTAL_PROVIDER") == "" {
+		_ = os.Setenv("KIND_EXPERIMENTAL_PROVIDER", RuntimePodman)
+	}
+	if os.Getenv("DOCKER_HOST") != "" {
+		return
+	}
+	socket := podmanSocketPath()
+	if socket == "" {
+		if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+			socket = filepath.Join(dir, "podman", "podman.sock")
+		}
+	}
+	if socket == "" {
+		return
+	}
+	if !strings.Contains(socket, "://") {
+		socket = "unix://" + socket
+	}
+	_ = os.Setenv("DOCKER_HOST", socket)
+}
+
+// HostGatewayName is the hostname containers use to reach the host:
+// host.docker.internal for Docker, host.containers.internal for podman.
+func HostGatewayName() string {
+	if IsPodman() {
+		return "host.containers.internal"
+	}
+	return "host.docker.internal"
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withRuntime resets the selected runtime and stubs PATH lookups for a test.
+func withRuntime(t *testing.T, onPath ...string) {
+	t.Helper()
+	oldRuntime, oldLookPath := containerRuntime, lookPath
+	containerRuntime = ""
+	lookPath = func(file string) (string, error) {
+		for _, p := range onPath {
+			if p == file {
+				return "/usr/bin/" + file, nil
+			}
+		}
+		return "", errors.New("not found")
+	}
+	t.Cleanup(func() { containerRuntime, lookPath = oldRuntime, oldLookPath })
+}
+
+func TestDetectContainerRuntime(t *testing.T) {
+	t.Setenv(ContainerRuntimeEnv, "")
+	t.Setenv("DOCKER_HOST", "")
+
+	withRuntime(t, "docker", "podman")
+	assert.Equal(t, RuntimeDocker, DetectContainerRuntime())
+
+	withRuntime(t, "podman")
+	assert.Equal(t, RuntimePodman, DetectContainerRuntime())
+
+	withRuntime(t, "docker")
+	t.Setenv("DOCKER_HOST", "unix:///run/user/1000/podman/podman.sock")
+	assert.Equal(t, RuntimePodman, DetectContainerRuntime())
+
+	t.Setenv(ContainerRuntimeEnv, RuntimeDocker)
+	assert.Equal(t, RuntimeDocker, DetectContainerRuntime())
+}
+
+func TestSetContainerRuntime(t *testing.T) {
+	withRuntime(t)
+	require.NoError(t, SetContainerRuntime("podman"))
+	assert.Equal(t, "podman", ContainerCLI())
+	assert.True(t, IsPodman())
+	assert.Equal(t, "host.containers.internal", HostGatewayName())
+
+	require.Error(t, SetContainerRuntime("containerd"))
+}
+
+func TestConfigureRuntimeEnv_Podman(t *testing.T) {
+	withRuntime(t)
+	require.NoError(t, SetContainerRuntime(RuntimePodman))
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("KIND_EXPERIMENTAL_PROVIDER", "")
+	oldSocket := podmanSocketPath
+	podmanSocketPath = func() string { return "/run/user/1000/podman/podman.sock" }
+	defer func() { podmanSocketPath = oldSocket }()
+
+	ConfigureRuntimeEnv()
+	assert.Equal(t, "unix:///run/user/1000/podman/podman.sock", os.Getenv("DOCKER_HOST"))
+	assert.Equal(t, "podman", os.Getenv("KIND_EXPERIMENTAL_PROVIDER"))
+}
+
+func TestConfigureRuntimeEnv_DockerUnchanged(t *testing.T) {
+	withRuntime(t)
+	require.NoError(t, SetContainerRuntime(RuntimeDocker))
+	t.Setenv("DOCKER_HOST", "")
+
+	ConfigureRuntimeEnv()
+	assert.Empty(t, os.Getenv("DOCKER_HOST"))
+}
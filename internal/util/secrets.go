@@ -0,0 +1,213 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SecretOutputFn runs an external secret tool and returns its stdout.
+// It is a var so tests can replace it without sops or a password manager.
+var SecretOutputFn = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
+
+// onePasswordCLI returns the 1Password CLI binary used to resolve op:// references.
+// The 1Password CLI is also called "op"; set OP_1PASSWORD_CLI when it is
+// installed under a different name or path.
+func onePasswordCLI() string {
+	if v := os.Getenv("OP_1PASSWORD_CLI"); v != "" {
+		return v
+	}
+	return "op"
+}
+
+// secretRefPrefixes are the schemes of the secret references
+// ResolveSecretRef resolves.
+var secretRefPrefixes = []string{"op://", "env://", "secret://", "sops://"}
+
+// IsSecretRef reports whether v is a secret reference (see
+// ResolveSecretRef) rather than a literal value.
+func IsSecretRef(v string) bool {
+	for _, p := range secretRefPrefixes {
+		if strings.HasPrefix(v, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveSecretRef resolves a secret reference to its value:
+//   - op://vault/item/field  → 1Password CLI (op read)
+//   - env://NAME             → value of environment variable NAME
+//   - secret://gha/NAME      → a GitHub Actions secret the step exposes as
+//     environment variable NAME (secret://env/NAME is the same)
+//   - sops://path/file#KEY   → KEY of a SOPS-encrypted file (see DecryptSecretsFile)
+func ResolveSecretRef(ctx context.Context, ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "op://"):
+		out, err := SecretOutputFn(ctx, onePasswordCLI(), "read", "--no-newline", ref)
+		if err != nil {
+			return "", fmt.Errorf("resolving %s: %w", ref, err)
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	case strings.HasPrefix(ref, "env://"):
+		return secretFromEnv(ref, strings.TrimPrefix(ref, "env://"))
+	case strings.HasPrefix(ref, "secret://"):
+		store, key, _ := strings.Cut(strings.TrimPrefix(ref, "secret://"), "/")
+		if store != "gha" && store != "env" {
+			return "", fmt.Errorf("resolving %s: unknown secret store %q (expected gha or env)", ref, store)
+		}
+		return secretFromEnv(ref, key)
+	case strings.HasPrefix(ref, "sops://"):
+		path, key, ok := strings.Cut(strings.TrimPrefix(ref, "sops://"), "#")
+		if !ok || path == "" || key == "" {
+			return "", fmt.Errorf("resolving %s: expected sops://path/to/file#KEY", ref)
+		}
+		values, err := DecryptSecretsFile(ctx, path)
+		if err != nil {
+			return "", fmt.Errorf("resolving %s: %w", ref, err)
+		}
+		val, ok := values[key]
+		if !ok {
+			return "", fmt.Errorf("resolving %s: %s has no key %s", ref, path, key)
+		}
+		return val, nil
+	}
+	return "", fmt.Errorf("unsupported secret reference %q (expected op://..., env://..., secret://gha/... or sops://...)", ref)
+}
+
+// secretFromEnv returns environment variable key, which ref refers to.
+func secretFromEnv(ref, key string) (string, error) {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return "", fmt.Errorf("resolving %s: environment variable %s is not set", ref, key)
+	}
+	return val, nil
+}
+
+// ResolveSecretEnv replaces the secret references among the values of env
+// (see IsSecretRef) with their secrets, in place, and returns the names of
+// the variables it resolved, never their values.
+func ResolveSecretEnv(ctx context.Context, env map[string]string) ([]string, error) {
+	var names []string
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		if !IsSecretRef(env[k]) {
+			continue
+		}
+		val, err := ResolveSecretRef(ctx, env[k])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		env[k] = val
+		names = append(names, k)
+	}
+	return names, nil
+}
+
+// DecryptSecretsFile decrypts a SOPS-encrypted file and returns its flat
+// key/value content. Dotenv files (.env) and YAML/JSON maps are supported.
+func DecryptSecretsFile(ctx context.Context, path string) (map[string]string, error) {
+	out, err := SecretOutputFn(ctx, "sops", "--decrypt", path)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s with sops: %w", path, err)
+	}
+
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".yaml"), strings.HasSuffix(name, ".yml"):
+		return parseFlatMap(out, yaml.Unmarshal, path)
+	case strings.HasSuffix(name, ".json"):
+		return parseFlatMap(out, json.Unmarshal, path)
+	}
+	return ParseDotenv(out), nil
+}
+
+func parseFlatMap(data []byte, unmarshal func([]byte, any) error, path string) (map[string]string, error) {
+	var raw map[string]any
+	if err := unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing decrypted %s: %w", path, err)
+	}
+	out := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if k == "sops" {
+			continue
+		}
+		switch v.(type) {
+		case map[string]any, []any:
+			return nil, fmt.Errorf("parsing decrypted %s: key %q is not a scalar", path, k)
+		}
+		out[k] = fmt.Sprint(v)
+	}
+	return out, nil
+}
+
+// ParseDotenv parses KEY=VALUE lines, ignoring blank lines, comments and an
+// optional "export " prefix. Matching surrounding quotes are removed.
+func ParseDotenv(data []byte) map[string]string {
+	out := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, val := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+			val = val[1 : len(val)-1]
+		}
+		out[key] = val
+	}
+	return out
+}
+
+// ResolveContextSecrets decrypts the context's secret files (in order) and
+// resolves its secret references, which take precedence. Relative file paths
+// are resolved against cwd.
+func ResolveContextSecrets(ctx context.Context, cwd string, opts ContextOpts) (map[string]string, error) {
+	secrets := make(map[string]string)
+	for _, f := range opts.SecretFiles {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(cwd, f)
+		}
+		values, err := DecryptSecretsFile(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range values {
+			secrets[k] = v
+		}
+	}
+
+	names := make([]string, 0, len(opts.Secrets))
+	for k := range opts.Secrets {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		val, err := ResolveSecretRef(ctx, opts.Secrets[k])
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %w", k, err)
+		}
+		secrets[k] = val
+	}
+	return secrets, nil
+}
@@ -0,0 +1,135 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubSecretOutput(t *testing.T, fn func(name string, args ...string) ([]byte, error)) {
+	t.Helper()
+	old := SecretOutputFn
+	SecretOutputFn = func(_ context.Context, name string, args ...string) ([]byte, error) { return fn(name, args...) }
+	t.Cleanup(func() { SecretOutputFn = old })
+}
+
+func TestParseDotenv(t *testing.T) {
+	got := ParseDotenv([]byte("# comment\nA=1\nexport B=\"two words\"\n\nC='x=y'\ninvalid\n"))
+	assert.Equal(t, map[string]string{"A": "1", "B": "two words", "C": "x=y"}, got)
+}
+
+func TestResolveSecretRef_OnePassword(t *testing.T) {
+	t.Setenv("OP_1PASSWORD_CLI", "op-1p")
+	stubSecretOutput(t, func(name string, args ...string) ([]byte, error) {
+		assert.Equal(t, "op-1p", name)
+		assert.Equal(t, []string{"read", "--no-newline", "op://dev/db/password"}, args)
+		return []byte("s3cret\n"), nil
+	})
+	val, err := ResolveSecretRef(t.Context(), "op://dev/db/password")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", val)
+}
+
+func TestResolveSecretRef_Env(t *testing.T) {
+	t.Setenv("MY_TOKEN", "tok")
+	val, err := ResolveSecretRef(t.Context(), "env://MY_TOKEN")
+	require.NoError(t, err)
+	assert.Equal(t, "tok", val)
+
+	_, err = ResolveSecretRef(t.Context(), "env://DEFINITELY_NOT_SET_OP")
+	assert.Error(t, err)
+	_, err = ResolveSecretRef(t.Context(), "plaintext")
+	assert.Error(t, err)
+}
+
+func TestResolveSecretRef_Stores(t *testing.T) {
+	t.Setenv("NPM_TOKEN", "npm-tok")
+	stubSecretOutput(t, func(name string, args ...string) ([]byte, error) {
+		assert.Equal(t, []string{"--decrypt", "secrets/ci.enc.yaml"}, args)
+		return []byte("MAVEN_PASSWORD: mvn\n"), nil
+	})
+
+	for ref, want := range map[string]string{
+		"secret://gha/NPM_TOKEN":                    "npm-tok",
+		"secret://env/NPM_TOKEN":                    "npm-tok",
+		"sops://secrets/ci.enc.yaml#MAVEN_PASSWORD": "mvn",
+	} {
+		val, err := ResolveSecretRef(t.Context(), ref)
+		require.NoError(t, err, ref)
+		assert.Equal(t, want, val, ref)
+	}
+
+	_, err := ResolveSecretRef(t.Context(), "secret://vault/NPM_TOKEN")
+	assert.ErrorContains(t, err, `unknown secret store "vault"`)
+	_, err = ResolveSecretRef(t.Context(), "sops://secrets/ci.enc.yaml")
+	assert.ErrorContains(t, err, "expected sops://path/to/file#KEY")
+	_, err = ResolveSecretRef(t.Context(), "sops://secrets/ci.enc.yaml#NPM_TOKEN")
+	assert.ErrorContains(t, err, "secrets/ci.enc.yaml has no key NPM_TOKEN")
+}
+
+func TestResolveSecretEnv(t *testing.T) {
+	t.Setenv("NPM_TOKEN", "npm-tok")
+	env := map[string]string{"BP_NODE_VERSION": "22", "BP_NPM_TOKEN": "secret://gha/NPM_TOKEN", "NPM_AUTH": "env://NPM_TOKEN"}
+	names, err := ResolveSecretEnv(t.Context(), env)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BP_NPM_TOKEN", "NPM_AUTH"}, names)
+	assert.Equal(t, map[string]string{"BP_NODE_VERSION": "22", "BP_NPM_TOKEN": "npm-tok", "NPM_AUTH": "npm-tok"}, env)
+
+	_, err = ResolveSecretEnv(t.Context(), map[string]string{"BP_NPM_TOKEN": "secret://gha/OP_NOT_SET"})
+	assert.ErrorContains(t, err, "BP_NPM_TOKEN: resolving secret://gha/OP_NOT_SET: environment variable OP_NOT_SET is not set")
+}
+
+func TestDecryptSecretsFile_Formats(t *testing.T) {
+	stubSecretOutput(t, func(name string, args ...string) ([]byte, error) {
+		require.Equal(t, "sops", name)
+		switch filepath.Ext(args[1]) {
+		case ".yaml":
+			return []byte("API_KEY: abc\nRETRIES: 3\n"), nil
+		case ".json":
+			return []byte(`{"API_KEY": "json"}`), nil
+		}
+		return []byte("API_KEY=dotenv\n"), nil
+	})
+
+	y, err := DecryptSecretsFile(t.Context(), "secrets.enc.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"API_KEY": "abc", "RETRIES": "3"}, y)
+
+	j, err := DecryptSecretsFile(t.Context(), "secrets.enc.json")
+	require.NoError(t, err)
+	assert.Equal(t, "json", j["API_KEY"])
+
+	e, err := DecryptSecretsFile(t.Context(), "secrets.enc.env")
+	require.NoError(t, err)
+	assert.Equal(t, "dotenv", e["API_KEY"])
+}
+
+func TestResolveContextSecrets_RefsOverrideFiles(t *testing.T) {
+	dir := t.TempDir()
+	stubSecretOutput(t, func(name string, args ...string) ([]byte, error) {
+		if name == "sops" {
+			assert.Equal(t, filepath.Join(dir, "secrets.enc.env"), args[1])
+			return []byte("A=file\nB=file\n"), nil
+		}
+		return nil, errors.New("unexpected")
+	})
+	t.Setenv("B_VALUE", "ref")
+
+	got, err := ResolveContextSecrets(t.Context(), dir, ContextOpts{
+		SecretFiles: []string{"secrets.enc.env"},
+		Secrets:     map[string]string{"B": "env://B_VALUE"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"A": "file", "B": "ref"}, got)
+}
+
+func TestDecryptSecretsFile_SopsFailure(t *testing.T) {
+	stubSecretOutput(t, func(string, ...string) ([]byte, error) { return nil, os.ErrNotExist })
+	_, err := DecryptSecretsFile(t.Context(), "missing.env")
+	assert.Error(t, err)
+}
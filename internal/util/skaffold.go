@@ -1,33 +1,319 @@
 package util
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
 )
 
 type SkaffoldConfig struct {
-	Build struct {
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Requires []SkaffoldRequire `yaml:"requires"`
+	Build    struct {
 		Artifacts []Artifact `yaml:"artifacts"`
 	} `yaml:"build"`
+	Profiles []SkaffoldProfile `yaml:"profiles"`
+}
+
+// SkaffoldRequire is a config included with requires. Only local paths are
+// followed; git and Cloud Storage sources are skipped.
+type SkaffoldRequire struct {
+	Path    string   `yaml:"path"`
+	Configs []string `yaml:"configs"`
+	// ActiveProfiles activates profiles of the required configs, always or
+	// when one of ActivatedBy is active in the requiring config.
+	ActiveProfiles []struct {
+		Name        string   `yaml:"name"`
+		ActivatedBy []string `yaml:"activatedBy"`
+	} `yaml:"activeProfiles"`
+}
+
+// SkaffoldProfile is the subset of a Skaffold profile that changes the
+// artifacts: a build section overlaid on the config's and JSON patches.
+type SkaffoldProfile struct {
+	Name                   string                   `yaml:"name"`
+	Activation             []SkaffoldActivation     `yaml:"activation"`
+	RequiresAllActivations bool                     `yaml:"requiresAllActivations"`
+	Build                  map[string]interface{}   `yaml:"build"`
+	Patches                []map[string]interface{} `yaml:"patches"`
+}
+
+// SkaffoldActivation activates a profile automatically when all of its
+// conditions hold.
+type SkaffoldActivation struct {
+	Env         string `yaml:"env"`
+	KubeContext string `yaml:"kubeContext"`
+	Command     string `yaml:"command"`
 }
 
 type Artifact struct {
-	Image   string `yaml:"image"`
-	Context string `yaml:"context"`
+	Image      string              `yaml:"image"`
+	Context    string              `yaml:"context"`
+	Docker     *DockerArtifact     `yaml:"docker,omitempty"`
+	Buildpacks *BuildpacksArtifact `yaml:"buildpacks,omitempty"`
 }
 
-// ParseSkaffoldArtifacts reads skaffold.yaml and returns artifacts.
+// DockerArtifact is the subset of a Skaffold docker artifact used for local builds.
+type DockerArtifact struct {
+	Dockerfile string `yaml:"dockerfile"`
+}
+
+// BuildpacksArtifact is the subset of a Skaffold buildpacks artifact used for local builds.
+type BuildpacksArtifact struct {
+	Builder  string   `yaml:"builder"`
+	RunImage string   `yaml:"runImage"`
+	Env      []string `yaml:"env"`
+}
+
+// ParseSkaffoldArtifacts reads skaffold.yaml and returns the artifacts op build
+// builds, with the profiles of SKAFFOLD_PROFILE active (see
+// ParseSkaffoldArtifactsWithProfiles).
 func ParseSkaffoldArtifacts(path string) ([]Artifact, error) {
-	data, err := os.ReadFile(path)
+	var profiles []string
+	if val := viper.GetString("SKAFFOLD_PROFILE"); val != "" {
+		profiles = strings.Split(val, ",")
+	}
+	return ParseSkaffoldArtifactsWithProfiles(path, profiles)
+}
+
+// ParseSkaffoldArtifactsWithProfiles reads every config (YAML document) of
+// skaffold.yaml and the local configs it requires, applies the named profiles
+// and those activated for the build command, and returns the artifacts,
+// required configs first. A profile named -name is deactivated. Contexts are
+// relative to the directory of path; kubeContext activations never match.
+func ParseSkaffoldArtifactsWithProfiles(path string, profiles []string) ([]Artifact, error) {
+	p := skaffoldParser{root: filepath.Dir(path), seen: map[string]bool{}}
+	return p.parse(path, nil, profiles)
+}
+
+type skaffoldParser struct {
+	root string
+	// seen holds the configs already parsed, so a config required twice is
+	// listed once and cycles end.
+	seen map[string]bool
+}
+
+// parse returns the artifacts of the configs in path (those named in configs,
+// when set) with profiles active.
+func (p *skaffoldParser) parse(path string, configs, profiles []string) ([]Artifact, error) {
+	docs, err := readSkaffoldDocuments(path)
 	if err != nil {
 		return nil, err
 	}
+	dir := filepath.Dir(path)
+	var out []Artifact
+	for i, doc := range docs {
+		var cfg SkaffoldConfig
+		if err := doc.Decode(&cfg); err != nil {
+			return nil, err
+		}
+		if len(configs) > 0 && !slices.Contains(configs, cfg.Metadata.Name) {
+			continue
+		}
+		key := fmt.Sprintf("%s#%d", filepath.Clean(path), i)
+		if p.seen[key] {
+			continue
+		}
+		p.seen[key] = true
 
-	var config SkaffoldConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
+		active := activeSkaffoldProfiles(cfg.Profiles, profiles)
+		var activeNames []string
+		for _, prof := range active {
+			activeNames = append(activeNames, prof.Name)
+		}
+		for _, req := range cfg.Requires {
+			if req.Path == "" {
+				continue
+			}
+			reqPath := filepath.Join(dir, req.Path)
+			if info, err := os.Stat(reqPath); err == nil && info.IsDir() {
+				reqPath = filepath.Join(reqPath, "skaffold.yaml")
+			}
+			reqProfiles := slices.Clone(profiles)
+			for _, ap := range req.ActiveProfiles {
+				if len(ap.ActivatedBy) == 0 || slices.ContainsFunc(ap.ActivatedBy, func(n string) bool { return slices.Contains(activeNames, n) }) {
+					reqProfiles = append(reqProfiles, ap.Name)
+				}
+			}
+			arts, err := p.parse(reqPath, req.Configs, reqProfiles)
+			if err != nil {
+				return nil, fmt.Errorf("%s: requires %s: %w", path, req.Path, err)
+			}
+			out = append(out, arts...)
+		}
+
+		if err := applySkaffoldProfiles(&doc, &cfg, active); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		rel, err := filepath.Rel(p.root, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range cfg.Build.Artifacts {
+			if rel != "." {
+				a.Context = filepath.Join(rel, a.Context)
+			}
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+// readSkaffoldDocuments returns the YAML documents of path.
+func readSkaffoldDocuments(path string) ([]yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
 		return nil, err
 	}
+	var docs []yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				return docs, nil
+			}
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+}
+
+// activeSkaffoldProfiles returns the profiles named in names or activated
+// automatically, minus those named -name, in the order they are defined.
+func activeSkaffoldProfiles(defined []SkaffoldProfile, names []string) []SkaffoldProfile {
+	var active []SkaffoldProfile
+	for _, prof := range defined {
+		if slices.Contains(names, "-"+prof.Name) {
+			continue
+		}
+		if slices.Contains(names, prof.Name) || prof.activated() {
+			active = append(active, prof)
+		}
+	}
+	return active
+}
+
+// activated reports whether any activation (all of them with
+// requiresAllActivations) holds for op build.
+func (prof SkaffoldProfile) activated() bool {
+	matched := 0
+	for _, a := range prof.Activation {
+		if a.matches() {
+			matched++
+		}
+	}
+	if prof.RequiresAllActivations {
+		return matched > 0 && matched == len(prof.Activation)
+	}
+	return matched > 0
+}
+
+func (a SkaffoldActivation) matches() bool {
+	if a.KubeContext != "" {
+		// op build does not target a cluster.
+		return false
+	}
+	if a.Command != "" && !skaffoldRegexEqual(a.Command, "build") {
+		return false
+	}
+	if a.Env != "" {
+		key, value, ok := strings.Cut(a.Env, "=")
+		if !ok {
+			return false
+		}
+		actual := os.Getenv(key)
+		if value == "" {
+			return actual == ""
+		}
+		return skaffoldRegexEqual(value, actual)
+	}
+	return a.Command != ""
+}
+
+// skaffoldRegexEqual matches actual as Skaffold matches activation values:
+// equal or matching expected as a regexp, negated by a leading !.
+func skaffoldRegexEqual(expected, actual string) bool {
+	if rest, ok := strings.CutPrefix(expected, "!"); ok {
+		return !skaffoldRegexEqual(rest, actual)
+	}
+	if expected == actual {
+		return true
+	}
+	re, err := regexp.Compile(expected)
+	return err == nil && re.MatchString(actual)
+}
 
-	return config.Build.Artifacts, nil
+// applySkaffoldProfiles overlays the build section of each active profile on
+// doc and applies its patches, then reads cfg.Build from the result.
+func applySkaffoldProfiles(doc *yaml.Node, cfg *SkaffoldConfig, active []SkaffoldProfile) error {
+	if !slices.ContainsFunc(active, func(prof SkaffoldProfile) bool { return prof.Build != nil || len(prof.Patches) > 0 }) {
+		return nil
+	}
+	var raw map[string]interface{}
+	if err := doc.Decode(&raw); err != nil {
+		return err
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	for _, prof := range active {
+		if prof.Build != nil {
+			var merged map[string]interface{}
+			if err := json.Unmarshal(data, &merged); err != nil {
+				return err
+			}
+			build, _ := merged["build"].(map[string]interface{})
+			if build == nil {
+				build = map[string]interface{}{}
+			}
+			maps.Copy(build, prof.Build)
+			merged["build"] = build
+			if data, err = json.Marshal(merged); err != nil {
+				return err
+			}
+		}
+		if len(prof.Patches) == 0 {
+			continue
+		}
+		for _, op := range prof.Patches {
+			if op["op"] == nil {
+				// Skaffold's default operation.
+				op["op"] = "replace"
+			}
+		}
+		patchJSON, err := json.Marshal(prof.Patches)
+		if err != nil {
+			return err
+		}
+		patch, err := jsonpatch.DecodePatch(patchJSON)
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", prof.Name, err)
+		}
+		if data, err = patch.Apply(data); err != nil {
+			return fmt.Errorf("profile %s: %w", prof.Name, err)
+		}
+	}
+	var patched SkaffoldConfig
+	// JSON is YAML, so the yaml field names apply.
+	if err := yaml.Unmarshal(data, &patched); err != nil {
+		return err
+	}
+	cfg.Build = patched.Build
+	return nil
 }
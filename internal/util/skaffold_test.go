@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -78,3 +79,221 @@ func TestParseSkaffoldArtifacts_InvalidYAML(t *testing.T) {
 		t.Log("yaml.Unmarshal was lenient — no artifacts expected")
 	}
 }
+
+func TestParseSkaffoldArtifacts_BuilderFields(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "skaffold.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(skaffoldYAMLTwoArtifacts), 0o644))
+
+	artifacts, err := ParseSkaffoldArtifacts(path)
+	require.NoError(t, err)
+	require.Len(t, artifacts, 2)
+	require.NotNil(t, artifacts[0].Docker)
+	assert.Equal(t, "Dockerfile", artifacts[0].Docker.Dockerfile)
+	assert.Nil(t, artifacts[0].Buildpacks)
+	require.NotNil(t, artifacts[1].Buildpacks)
+	assert.Equal(t, "ghcr.io/octopilot/builder-jammy-base:latest", artifacts[1].Buildpacks.Builder)
+	assert.Equal(t, "my-app-base", artifacts[1].Buildpacks.RunImage)
+}
+
+func writeSkaffold(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func artifactImages(artifacts []Artifact) []string {
+	var images []string
+	for _, a := range artifacts {
+		images = append(images, a.Image+"@"+a.Context)
+	}
+	return images
+}
+
+func TestParseSkaffoldArtifacts_RequiresAndDocuments(t *testing.T) {
+	dir := t.TempDir()
+	writeSkaffold(t, filepath.Join(dir, "skaffold.yaml"), `
+apiVersion: skaffold/v4beta11
+kind: Config
+metadata:
+  name: root
+requires:
+  - path: services/api
+  - path: services/shared.yaml
+    configs: [worker]
+  - git:
+      repo: https://github.com/org/remote
+build:
+  artifacts:
+    - image: web
+      context: web
+---
+apiVersion: skaffold/v4beta11
+kind: Config
+metadata:
+  name: second
+requires:
+  - path: services/api   # already listed
+build:
+  artifacts:
+    - image: docs
+`)
+	writeSkaffold(t, filepath.Join(dir, "services", "api", "skaffold.yaml"), `
+apiVersion: skaffold/v4beta11
+kind: Config
+requires:
+  - path: ../../skaffold.yaml   # cycle
+    configs: [root]
+build:
+  artifacts:
+    - image: api
+      context: .
+    - image: api-migrations
+      context: migrations
+`)
+	writeSkaffold(t, filepath.Join(dir, "services", "shared.yaml"), `
+apiVersion: skaffold/v4beta11
+kind: Config
+metadata:
+  name: worker
+build:
+  artifacts:
+    - image: worker
+      context: worker
+---
+apiVersion: skaffold/v4beta11
+kind: Config
+metadata:
+  name: cron
+build:
+  artifacts:
+    - image: cron
+`)
+
+	artifacts, err := ParseSkaffoldArtifactsWithProfiles(filepath.Join(dir, "skaffold.yaml"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"api@services/api",
+		"api-migrations@services/api/migrations",
+		"worker@services/worker",
+		"web@web",
+		"docs@",
+	}, artifactImages(artifacts))
+
+	_, err = ParseSkaffoldArtifactsWithProfiles(filepath.Join(dir, "services", "missing.yaml"), nil)
+	assert.Error(t, err)
+}
+
+func TestParseSkaffoldArtifacts_Profiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "skaffold.yaml")
+	writeSkaffold(t, path, `
+apiVersion: skaffold/v4beta11
+kind: Config
+requires:
+  - path: lib
+    activeProfiles:
+      - name: with-tools
+        activatedBy: [ci]
+build:
+  artifacts:
+    - image: app
+      docker:
+        dockerfile: Dockerfile
+profiles:
+  - name: ci
+    activation:
+      - env: CI=true
+  - name: arm
+    build:
+      artifacts:
+        - image: app-arm
+  - name: debug
+    activation:
+      - command: build
+        env: OP_DEBUG_IMAGE=1
+    patches:
+      - path: /build/artifacts/0/docker/dockerfile
+        value: Dockerfile.debug
+  - name: dev-cluster
+    activation:
+      - kubeContext: kind-.*
+    patches:
+      - op: remove
+        path: /build/artifacts/0
+`)
+	writeSkaffold(t, filepath.Join(dir, "lib", "skaffold.yaml"), `
+apiVersion: skaffold/v4beta11
+kind: Config
+build:
+  artifacts:
+    - image: lib
+profiles:
+  - name: with-tools
+    patches:
+      - op: add
+        path: /build/artifacts/-
+        value: {image: lib-tools, context: tools}
+`)
+
+	t.Setenv("CI", "")
+	t.Setenv("OP_DEBUG_IMAGE", "")
+	artifacts, err := ParseSkaffoldArtifactsWithProfiles(path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lib@lib", "app@"}, artifactImages(artifacts))
+	assert.Equal(t, "Dockerfile", artifacts[1].Docker.Dockerfile)
+
+	t.Setenv("CI", "true")
+	t.Setenv("OP_DEBUG_IMAGE", "1")
+	artifacts, err = ParseSkaffoldArtifactsWithProfiles(path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lib@lib", "lib-tools@lib/tools", "app@"}, artifactImages(artifacts))
+	assert.Equal(t, "Dockerfile.debug", artifacts[2].Docker.Dockerfile)
+
+	artifacts, err = ParseSkaffoldArtifactsWithProfiles(path, []string{"arm", "-debug", "-ci"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lib@lib", "app-arm@"}, artifactImages(artifacts))
+}
+
+func TestParseSkaffoldArtifacts_ProfileFromEnv(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	path := filepath.Join(t.TempDir(), "skaffold.yaml")
+	writeSkaffold(t, path, `
+build:
+  artifacts:
+    - image: app
+profiles:
+  - name: release
+    build:
+      artifacts:
+        - image: app-release
+`)
+	viper.Set("SKAFFOLD_PROFILE", "release")
+	artifacts, err := ParseSkaffoldArtifacts(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app-release@"}, artifactImages(artifacts))
+}
+
+func TestSkaffoldActivation(t *testing.T) {
+	t.Setenv("TARGET", "staging")
+	tests := []struct {
+		activation SkaffoldActivation
+		want       bool
+	}{
+		{SkaffoldActivation{Env: "TARGET=staging"}, true},
+		{SkaffoldActivation{Env: "TARGET=stag.*"}, true},
+		{SkaffoldActivation{Env: "TARGET=!prod"}, true},
+		{SkaffoldActivation{Env: "TARGET=prod"}, false},
+		{SkaffoldActivation{Env: "UNSET_TARGET="}, true},
+		{SkaffoldActivation{Env: "TARGET"}, false},
+		{SkaffoldActivation{Command: "build"}, true},
+		{SkaffoldActivation{Command: "dev"}, false},
+		{SkaffoldActivation{Command: "!dev"}, true},
+		{SkaffoldActivation{Command: "build", KubeContext: "minikube"}, false},
+		{SkaffoldActivation{}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.activation.matches(), "%+v", tt.activation)
+	}
+}
@@ -0,0 +1,278 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Container VMs whose Docker daemon needs the registry CA installed inside the VM.
+const (
+	VMNone           = "none"
+	VMColima         = "colima"
+	VMRancherDesktop = "rancher-desktop"
+	VMLima           = "lima"
+	VMDockerDesktop  = "docker-desktop"
+)
+
+// RegistryTrustHostPorts returns the registry addresses the CA is installed
+// for on port, so pulls work via localhost, host.docker.internal and registry.local.
+func RegistryTrustHostPorts(port int) []string {
+	var hostPorts []string
+	for _, host := range []string{"localhost", "host.docker.internal", "registry.local"} {
+		hostPorts = append(hostPorts, fmt.Sprintf("%s:%d", host, port))
+	}
+	return hostPorts
+}
+
+// dockerEndpoint returns the Docker API endpoint of the current context.
+// It is a var so tests can replace it.
+var dockerEndpoint = func() string {
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		return host
+	}
+	out, err := exec.Command("docker", "context", "inspect", "--format", "{{.Endpoints.docker.Host}}").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// runWithStdin runs name with args, feeding stdin. A var so tests can replace it.
+var runWithStdin = func(ctx context.Context, stdin []byte, name string, args ...string) error {
+	c := exec.CommandContext(ctx, name, args...)
+	c.Stdin = bytes.NewReader(stdin)
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// DetectContainerVM infers which VM backs the Docker endpoint, returning the
+// VM kind and, for Lima, the instance name.
+//
+//	unix:///Users/me/.colima/default/docker.sock   → colima
+//	unix:///Users/me/.rd/docker.sock               → rancher-desktop
+//	unix:///Users/me/.lima/docker/sock/docker.sock → lima, "docker"
+//	unix:///Users/me/.docker/run/docker.sock       → docker-desktop
+//	npipe:////./pipe/dockerDesktopLinuxEngine      → docker-desktop
+func DetectContainerVM() (string, string) {
+	return containerVMForEndpoint(dockerEndpoint())
+}
+
+func containerVMForEndpoint(endpoint string) (string, string) {
+	switch {
+	case strings.Contains(endpoint, "/.colima/"):
+		return VMColima, ""
+	case strings.Contains(endpoint, "/.rd/"):
+		return VMRancherDesktop, ""
+	case strings.Contains(endpoint, "/.lima/"):
+		rest := endpoint[strings.Index(endpoint, "/.lima/")+len("/.lima/"):]
+		instance, _, _ := strings.Cut(rest, "/")
+		return VMLima, instance
+	case strings.Contains(endpoint, "/.docker/run/"), strings.Contains(endpoint, "/.docker/desktop/"),
+		strings.HasPrefix(endpoint, "npipe://"):
+		return VMDockerDesktop, ""
+	}
+	return VMNone, ""
+}
+
+// certsDScript returns a shell script that installs the CA read from stdin
+// into each /etc/docker/certs.d/<host:port>/ca.crt (and, with containerd,
+// /etc/containerd/certs.d/<host:port>/ca.crt).
+func certsDScript(hostPorts []string, containerd bool) string {
+	roots := []string{"/etc/docker/certs.d"}
+	if containerd {
+		roots = append(roots, "/etc/containerd/certs.d")
+	}
+	var steps []string
+	steps = append(steps, "cat > /tmp/registry-ca.crt")
+	for _, root := range roots {
+		for _, hp := range hostPorts {
+			dir := root + "/" + hp
+			steps = append(steps, fmt.Sprintf("mkdir -p %s && cp /tmp/registry-ca.crt %s/ca.crt", dir, dir))
+		}
+	}
+	return strings.Join(steps, " && ")
+}
+
+// InstallVMTrust installs the CA at certPath for the Docker daemon of the
+// given VM and returns a description of each trust store it updated.
+// Docker reads certs.d per connection, so no daemon restart is needed.
+func InstallVMTrust(ctx context.Context, vm, instance, certPath string, hostPorts []string) ([]string, error) {
+	cert, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	if vm == VMNone || vm == "" {
+		return nil, nil
+	}
+	if vmTrusts(ctx, vm, instance, cert, hostPorts) {
+		slog.Info("Registry CA already trusted in the container VM", "vm", vm)
+		return nil, nil
+	}
+	switch vm {
+	case VMColima:
+		if err := runWithStdin(ctx, cert, "colima", "ssh", "--", "sudo", "sh", "-c", certsDScript(hostPorts, false)); err != nil {
+			return nil, fmt.Errorf("installing CA in Colima VM: %w", err)
+		}
+		return []string{"Colima VM /etc/docker/certs.d"}, nil
+	case VMRancherDesktop:
+		// Rancher Desktop runs either dockerd or containerd (nerdctl); cover both.
+		if err := runWithStdin(ctx, cert, "rdctl", "shell", "sudo", "sh", "-c", certsDScript(hostPorts, true)); err != nil {
+			return nil, fmt.Errorf("installing CA in Rancher Desktop VM: %w", err)
+		}
+		return []string{"Rancher Desktop VM /etc/docker/certs.d", "Rancher Desktop VM /etc/containerd/certs.d"}, nil
+	case VMLima:
+		if instance == "" {
+			instance = "default"
+		}
+		if err := runWithStdin(ctx, cert, "limactl", "shell", instance, "sudo", "sh", "-c", certsDScript(hostPorts, true)); err != nil {
+			return nil, fmt.Errorf("installing CA in Lima instance %s: %w", instance, err)
+		}
+		return []string{
+			fmt.Sprintf("Lima %s /etc/docker/certs.d", instance),
+			fmt.Sprintf("Lima %s /etc/containerd/certs.d", instance),
+		}, nil
+	case VMDockerDesktop:
+		if runtime.GOOS == "windows" {
+			// Docker Desktop on Windows trusts the Windows Root store (certs.d
+			// paths cannot contain ':' there); it picks up new roots on restart.
+			if _, err := InstallHostTrust(ctx, certPath); err != nil {
+				return nil, fmt.Errorf("installing CA for Docker Desktop: %w", err)
+			}
+			return []string{"Docker Desktop (Windows Root store; restart Docker Desktop to apply)"}, nil
+		}
+		// Docker Desktop (including its containerd image store) reads
+		// ~/.docker/certs.d on the host and syncs it into its VM.
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		for _, hp := range hostPorts {
+			dir := filepath.Join(home, ".docker", "certs.d", hp)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(filepath.Join(dir, "ca.crt"), cert, 0o644); err != nil {
+				return nil, err
+			}
+		}
+		return []string{"Docker Desktop ~/.docker/certs.d"}, nil
+	}
+	return nil, fmt.Errorf("unsupported VM %q (expected %s, %s, %s, %s or %s)", vm, VMColima, VMRancherDesktop, VMLima, VMDockerDesktop, VMNone)
+}
+
+// commandOutput runs name with args and returns its stdout. A var so tests can replace it.
+var commandOutput = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+// ReadVMTrust returns the CA installed by InstallVMTrust for hostPort in the
+// Docker daemon of the given VM (its /etc/docker/certs.d, or Docker Desktop's
+// ~/.docker/certs.d), so callers can compare it with the current registry CA.
+func ReadVMTrust(ctx context.Context, vm, instance, hostPort string) ([]byte, error) {
+	path := "/etc/docker/certs.d/" + hostPort + "/ca.crt"
+	switch vm {
+	case VMColima:
+		return commandOutput(ctx, "colima", "ssh", "--", "cat", path)
+	case VMRancherDesktop:
+		return commandOutput(ctx, "rdctl", "shell", "cat", path)
+	case VMLima:
+		if instance == "" {
+			instance = "default"
+		}
+		return commandOutput(ctx, "limactl", "shell", instance, "cat", path)
+	case VMDockerDesktop:
+		if runtime.GOOS == "windows" {
+			return nil, fmt.Errorf("on Windows, Docker Desktop uses the Windows Root store")
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(filepath.Join(home, ".docker", "certs.d", hostPort, "ca.crt"))
+	}
+	return nil, fmt.Errorf("no container VM trust store for %q", vm)
+}
+
+// vmTrusts reports whether the Docker daemon of vm already has cert for
+// every host in hostPorts, so InstallVMTrust can skip the sudo in the VM.
+func vmTrusts(ctx context.Context, vm, instance string, cert []byte, hostPorts []string) bool {
+	for _, hp := range hostPorts {
+		got, err := ReadVMTrust(ctx, vm, instance, hp)
+		if err != nil || !bytes.Equal(bytes.TrimSpace(got), bytes.TrimSpace(cert)) {
+			return false
+		}
+	}
+	return len(hostPorts) > 0
+}
+
+// certFingerprint returns the hex SHA-1 of the first certificate in certPath.
+func certFingerprint(certPath string) (string, error) {
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", fmt.Errorf("%s: no PEM certificate found", certPath)
+	}
+	sum := sha1.Sum(block.Bytes)
+	return strings.ToUpper(hex.EncodeToString(sum[:])), nil
+}
+
+// trustSentinelPath records the fingerprint of the last cert installed for host trust.
+func trustSentinelPath(certPath string) string {
+	return filepath.Join(filepath.Dir(certPath), ".system-trust-installed")
+}
+
+// hostStoreHasCert reports whether the host trust store holds the
+// certificate with SHA-1 fingerprint fp (see hostTrustHas for the per-OS
+// store). It is a var so tests can replace it.
+var hostStoreHasCert = hostTrustHas
+
+// IsHostTrusted reports whether certPath is installed in the host trust
+// store, so repeated runs don't prompt for sudo: the sentinel written by
+// InstallHostTrust names its fingerprint, or the store itself holds it (the
+// sentinel is then written for the next run).
+func IsHostTrusted(ctx context.Context, certPath string) bool {
+	fp, err := certFingerprint(certPath)
+	if err != nil {
+		return false
+	}
+	if stored, err := os.ReadFile(trustSentinelPath(certPath)); err == nil && strings.TrimSpace(string(stored)) == fp {
+		return true
+	}
+	if !hostStoreHasCert(ctx, fp) {
+		return false
+	}
+	_ = os.WriteFile(trustSentinelPath(certPath), []byte(fp+"\n"), 0o644)
+	return true
+}
+
+// InstallHostTrust adds certPath to the host trust store (see installHostTrust
+// for the per-OS store) unless it was already installed, and returns a
+// description of the store. It may prompt for sudo.
+func InstallHostTrust(ctx context.Context, certPath string) (string, error) {
+	if IsHostTrusted(ctx, certPath) {
+		slog.Info("Registry CA already trusted on the host", "cert", certPath)
+		return "", nil
+	}
+	store, err := installHostTrust(ctx, certPath)
+	if err != nil {
+		return "", err
+	}
+	if fp, err := certFingerprint(certPath); err == nil {
+		_ = os.WriteFile(trustSentinelPath(certPath), []byte(fp+"\n"), 0o644)
+	}
+	return store, nil
+}
@@ -0,0 +1,24 @@
+package util
+
+import (
+	"context"
+	"strings"
+)
+
+// macOSSystemKeychain is where op installs the registry CA.
+const macOSSystemKeychain = "/Library/Keychains/System.keychain"
+
+// installHostTrust adds certPath as a trusted root to the System keychain.
+func installHostTrust(ctx context.Context, certPath string) (string, error) {
+	if err := RunCommand(ctx, "sudo", "security", "add-trusted-cert", "-d", "-r", "trustRoot", "-k", macOSSystemKeychain, certPath); err != nil {
+		return "", err
+	}
+	return "macOS System keychain", nil
+}
+
+// hostTrustHas reports whether the System keychain holds the certificate
+// with SHA-1 fingerprint fp (security prints "SHA-1 hash: <fp>" per cert).
+func hostTrustHas(ctx context.Context, fp string) bool {
+	out, err := commandOutput(ctx, "security", "find-certificate", "-a", "-Z", macOSSystemKeychain)
+	return err == nil && strings.Contains(string(out), "SHA-1 hash: "+fp)
+}
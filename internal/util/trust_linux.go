@@ -0,0 +1,25 @@
+package util
+
+import "context"
+
+// linuxCAPath is where the registry CA is installed for update-ca-certificates.
+const linuxCAPath = "/usr/local/share/ca-certificates/registry-tls-localhost.crt"
+
+// hostTrustHas reports whether the certificate installed at linuxCAPath has
+// SHA-1 fingerprint fp.
+func hostTrustHas(_ context.Context, fp string) bool {
+	installed, err := certFingerprint(linuxCAPath)
+	return err == nil && installed == fp
+}
+
+// installHostTrust copies certPath into the system CA directory and
+// regenerates the bundle (Debian/Ubuntu/Alpine layout).
+func installHostTrust(ctx context.Context, certPath string) (string, error) {
+	if err := RunCommand(ctx, "sudo", "cp", certPath, linuxCAPath); err != nil {
+		return "", err
+	}
+	if err := RunCommand(ctx, "sudo", "update-ca-certificates"); err != nil {
+		return "", err
+	}
+	return "system CA store (" + linuxCAPath + ")", nil
+}
@@ -0,0 +1,15 @@
+//go:build !darwin && !linux && !windows
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+func hostTrustHas(context.Context, string) bool { return false }
+
+func installHostTrust(_ context.Context, certPath string) (string, error) {
+	return "", fmt.Errorf("host certificate trust is not supported on %s; trust %s manually", runtime.GOOS, certPath)
+}
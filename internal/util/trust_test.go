@@ -0,0 +1,180 @@
+package util
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCA writes a throwaway self-signed certificate and returns its path.
+func writeTestCA(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "tls.crt")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644))
+	return path
+}
+
+func TestContainerVMForEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint, vm, instance string
+	}{
+		{"unix:///Users/me/.colima/default/docker.sock", VMColima, ""},
+		{"unix:///Users/me/.rd/docker.sock", VMRancherDesktop, ""},
+		{"unix:///Users/me/.lima/docker/sock/docker.sock", VMLima, "docker"},
+		{"unix:///Users/me/.docker/run/docker.sock", VMDockerDesktop, ""},
+		{"unix:///home/me/.docker/desktop/docker.sock", VMDockerDesktop, ""},
+		{"npipe:////./pipe/dockerDesktopLinuxEngine", VMDockerDesktop, ""},
+		{"unix:///var/run/docker.sock", VMNone, ""},
+	}
+	for _, tt := range tests {
+		vm, instance := containerVMForEndpoint(tt.endpoint)
+		assert.Equal(t, tt.vm, vm, tt.endpoint)
+		assert.Equal(t, tt.instance, instance, tt.endpoint)
+	}
+}
+
+func TestCertsDScript(t *testing.T) {
+	script := certsDScript([]string{"localhost:5001"}, true)
+	assert.True(t, strings.HasPrefix(script, "cat > /tmp/registry-ca.crt"))
+	assert.Contains(t, script, "/etc/docker/certs.d/localhost:5001/ca.crt")
+	assert.Contains(t, script, "/etc/containerd/certs.d/localhost:5001/ca.crt")
+	assert.NotContains(t, certsDScript([]string{"localhost:5001"}, false), "containerd")
+}
+
+// stubVMCerts makes ReadVMTrust return the certs in certs (by path) and fail
+// for others.
+func stubVMCerts(t *testing.T, certs map[string][]byte) {
+	t.Helper()
+	old := commandOutput
+	t.Cleanup(func() { commandOutput = old })
+	commandOutput = func(_ context.Context, name string, args ...string) ([]byte, error) {
+		if c, ok := certs[args[len(args)-1]]; ok {
+			return c, nil
+		}
+		return nil, errors.New("cat: no such file")
+	}
+}
+
+func TestInstallVMTrust_Lima(t *testing.T) {
+	crt := writeTestCA(t)
+	stubVMCerts(t, nil)
+	var gotArgs []string
+	var gotStdin string
+	old := runWithStdin
+	runWithStdin = func(_ context.Context, stdin []byte, name string, args ...string) error {
+		gotStdin = string(stdin)
+		gotArgs = append([]string{name}, args...)
+		return nil
+	}
+	defer func() { runWithStdin = old }()
+
+	stores, err := InstallVMTrust(t.Context(), VMLima, "docker", crt, []string{"localhost:5001"})
+	require.NoError(t, err)
+	assert.Len(t, stores, 2)
+	assert.Equal(t, []string{"limactl", "shell", "docker", "sudo", "sh", "-c"}, gotArgs[:6])
+	want, _ := os.ReadFile(crt)
+	assert.Equal(t, string(want), gotStdin)
+}
+
+func TestInstallVMTrust_DockerDesktop(t *testing.T) {
+	crt := writeTestCA(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	stores, err := InstallVMTrust(t.Context(), VMDockerDesktop, "", crt, []string{"localhost:5001"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Docker Desktop ~/.docker/certs.d"}, stores)
+	assert.FileExists(t, filepath.Join(home, ".docker", "certs.d", "localhost:5001", "ca.crt"))
+}
+
+func TestInstallVMTrust_AlreadyTrusted(t *testing.T) {
+	crt := writeTestCA(t)
+	cert, err := os.ReadFile(crt)
+	require.NoError(t, err)
+	old := runWithStdin
+	t.Cleanup(func() { runWithStdin = old })
+	var installs int
+	runWithStdin = func(context.Context, []byte, string, ...string) error {
+		installs++
+		return nil
+	}
+
+	stubVMCerts(t, map[string][]byte{
+		"/etc/docker/certs.d/localhost:5001/ca.crt":      append(cert, '\n'),
+		"/etc/docker/certs.d/registry.local:5001/ca.crt": cert,
+	})
+	stores, err := InstallVMTrust(t.Context(), VMColima, "", crt, []string{"localhost:5001", "registry.local:5001"})
+	require.NoError(t, err)
+	assert.Empty(t, stores)
+	assert.Zero(t, installs)
+
+	stubVMCerts(t, map[string][]byte{"/etc/docker/certs.d/localhost:5001/ca.crt": cert})
+	stores, err = InstallVMTrust(t.Context(), VMColima, "", crt, []string{"localhost:5001", "registry.local:5001"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Colima VM /etc/docker/certs.d"}, stores, "one host is missing")
+	assert.Equal(t, 1, installs)
+}
+
+func TestInstallVMTrust_Unsupported(t *testing.T) {
+	_, err := InstallVMTrust(t.Context(), "minikube", "", writeTestCA(t), RegistryTrustHostPorts(DefaultLocalRegistryPort))
+	require.Error(t, err)
+}
+
+func TestIsHostTrusted(t *testing.T) {
+	crt := writeTestCA(t)
+	old := hostStoreHasCert
+	t.Cleanup(func() { hostStoreHasCert = old })
+	hostStoreHasCert = func(context.Context, string) bool { return false }
+	assert.False(t, IsHostTrusted(t.Context(), crt))
+
+	fp, err := certFingerprint(crt)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(trustSentinelPath(crt), []byte(fp+"\n"), 0o644))
+	assert.True(t, IsHostTrusted(t.Context(), crt))
+}
+
+func TestIsHostTrusted_FromStore(t *testing.T) {
+	crt := writeTestCA(t)
+	fp, err := certFingerprint(crt)
+	require.NoError(t, err)
+	old := hostStoreHasCert
+	t.Cleanup(func() { hostStoreHasCert = old })
+	var asked []string
+	hostStoreHasCert = func(_ context.Context, got string) bool {
+		asked = append(asked, got)
+		return got == fp
+	}
+
+	assert.True(t, IsHostTrusted(t.Context(), crt))
+	assert.Equal(t, []string{fp}, asked)
+	stored, err := os.ReadFile(trustSentinelPath(crt))
+	require.NoError(t, err)
+	assert.Equal(t, fp+"\n", string(stored), "sentinel written")
+
+	assert.True(t, IsHostTrusted(t.Context(), crt))
+	assert.Len(t, asked, 1, "the sentinel answers the next run")
+}
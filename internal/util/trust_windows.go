@@ -0,0 +1,30 @@
+package util
+
+import (
+	"context"
+	"log/slog"
+)
+
+// hostTrustHas reports whether the machine's or the current user's Root
+// store holds the certificate with SHA-1 fingerprint fp.
+func hostTrustHas(ctx context.Context, fp string) bool {
+	if _, err := commandOutput(ctx, "certutil", "-store", "Root", fp); err == nil {
+		return true
+	}
+	_, err := commandOutput(ctx, "certutil", "-user", "-store", "Root", fp)
+	return err == nil
+}
+
+// installHostTrust adds certPath to the Windows Root store with certutil.
+// The machine store needs an elevated shell; otherwise the current user's
+// Root store is used (Windows shows a confirmation dialog).
+func installHostTrust(ctx context.Context, certPath string) (string, error) {
+	if err := RunCommand(ctx, "certutil", "-addstore", "-f", "Root", certPath); err == nil {
+		return "Windows Root store (local machine)", nil
+	}
+	slog.Warn("certutil -addstore Root failed (not elevated?); using the current user's Root store")
+	if err := RunCommand(ctx, "certutil", "-user", "-addstore", "-f", "Root", certPath); err != nil {
+		return "", err
+	}
+	return "Windows Root store (current user)", nil
+}
@@ -0,0 +1,208 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// UserConfigKey documents a setting of the user-level config file.
+type UserConfigKey struct {
+	Key         string
+	List        bool // comma-separated on the command line, a YAML list in the file
+	Description string
+}
+
+// UserConfigKeys are the settings commands read from the user config. Keys
+// ending in "." are prefixes (environments.<name>).
+var UserConfigKeys = []UserConfigKey{
+	{Key: "default_repo", Description: "Registry/repository to push to when neither --repo nor SKAFFOLD_DEFAULT_REPO is set"},
+	{Key: "platforms", List: true, Description: "Default op build --platform (e.g. linux/amd64,linux/arm64)"},
+	{Key: "insecure_registries", List: true, Description: "Registry hosts to treat as insecure, added to --insecure-registry"},
+	{Key: "notification_urls", List: true, Description: "Webhooks (Slack-compatible JSON {\"text\": ...}) notified by op preview-env"},
+	{Key: "auto_start_vm", Description: "Start a stopped Colima VM before commands that need the container daemon (true/false)"},
+	{Key: "log_format", Description: "Log format when --log-format is not set: text or json"},
+	{Key: "log_level", Description: "Log level when --log-level is not set: debug, info, warn or error"},
+	{Key: "build_result_file", Description: "Build result written by op build and read by promote-image and watch-deployment (default build_result.json)"},
+	{Key: "registry_max_concurrency", Description: "Requests in flight per registry host (default 8); throttled requests are retried after Retry-After"},
+	{Key: "quay_expires_after", Description: "How long pull-request images pushed to quay.io are kept, as a quay.expires-after label (default 1w)"},
+	{Key: "registry_ca", Description: "PEM CA bundle trusted for registry calls on top of the system roots, when --registry-ca is not set"},
+	{Key: "environments.", Description: "Image repository of an environment (environments.prod), used by promote-image and watch-deployment"},
+	{Key: "metrics.pushgateway", Description: "Prometheus Pushgateway URL to export command metrics to (opt-in)"},
+	{Key: "metrics.otlp_endpoint", Description: "OTLP/HTTP endpoint to export command metrics to (opt-in)"},
+	{Key: "metrics.otlp_headers", List: true, Description: "Headers (name=value) sent with OTLP metrics, e.g. an API key"},
+	{Key: "metrics.webhook", Description: "URL to post command metrics to as JSON (opt-in)"},
+	{Key: "metrics.labels.", Description: "Label added to every exported metric (metrics.labels.team)"},
+}
+
+// LookupUserConfigKey returns the definition of key, or false when op does
+// not read it.
+func LookupUserConfigKey(key string) (UserConfigKey, bool) {
+	for _, k := range UserConfigKeys {
+		if strings.HasSuffix(k.Key, ".") {
+			if strings.HasPrefix(key, k.Key) && len(key) > len(k.Key) {
+				return k, true
+			}
+		} else if k.Key == key {
+			return k, true
+		}
+	}
+	return UserConfigKey{}, false
+}
+
+// UserConfigPath returns the user-level config file:
+// $OP_USER_CONFIG, else $XDG_CONFIG_HOME/octopilot/config.yaml, else
+// ~/.config/octopilot/config.yaml.
+func UserConfigPath() (string, error) {
+	if p := os.Getenv("OP_USER_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "octopilot", "config.yaml"), nil
+}
+
+// ReadUserConfig reads the config file at path; a missing file is empty.
+func ReadUserConfig(path string) (map[string]interface{}, error) {
+	cfg := map[string]interface{}{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if cfg == nil {
+		cfg = map[string]interface{}{}
+	}
+	return cfg, nil
+}
+
+// FlattenUserConfig returns the leaves of cfg keyed by dotted path.
+func FlattenUserConfig(cfg map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if sub, ok := v.(map[string]interface{}); ok {
+				walk(prefix+k+".", sub)
+				continue
+			}
+			out[prefix+k] = v
+		}
+	}
+	walk("", cfg)
+	return out
+}
+
+// FormatUserConfigValue renders a config value for display: lists are
+// comma-separated.
+func FormatUserConfigValue(v interface{}) string {
+	if list, ok := v.([]interface{}); ok {
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+// SetUserConfigValue sets key (dotted for nested keys) to value in the
+// config file at path, creating it if needed. List keys take comma-separated
+// values. An empty value removes the key.
+func SetUserConfigValue(path, key, value string) error {
+	def, ok := LookupUserConfigKey(key)
+	if !ok {
+		return fmt.Errorf("unknown config key %q (see op config list --keys)", key)
+	}
+	cfg, err := ReadUserConfig(path)
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(key, ".")
+	m := cfg
+	for _, p := range parts[:len(parts)-1] {
+		sub, ok := m[p].(map[string]interface{})
+		if !ok {
+			sub = map[string]interface{}{}
+			m[p] = sub
+		}
+		m = sub
+	}
+	leaf := parts[len(parts)-1]
+	switch {
+	case value == "":
+		delete(m, leaf)
+	case def.List:
+		var list []interface{}
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				list = append(list, v)
+			}
+		}
+		m[leaf] = list
+	default:
+		m[leaf] = value
+	}
+
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// LoadUserConfig makes the user config visible to viper as defaults, so the
+// project config (.github/octopilot.yaml or --config), environment variables
+// and flags all take precedence over it. String values are interpolated (see
+// Interpolate). It returns the file it read, or "" when there is none.
+func LoadUserConfig() (string, error) {
+	path, err := UserConfigPath()
+	if err != nil {
+		return "", err
+	}
+	cfg, err := ReadUserConfig(path)
+	if err != nil {
+		return "", err
+	}
+	flat := FlattenUserConfig(cfg)
+	if len(flat) == 0 {
+		return "", nil
+	}
+	for k, v := range flat {
+		if str, ok := v.(string); ok {
+			if v, err = Interpolate(str); err != nil {
+				return "", fmt.Errorf("%s: %s: %w", path, k, err)
+			}
+		}
+		viper.SetDefault(k, v)
+	}
+	return path, nil
+}
+
+// GetEnvironmentRepository returns the repository mapped to env in the
+// config (environments.<env>).
+func GetEnvironmentRepository(env string) string {
+	if env == "" {
+		return ""
+	}
+	return viper.GetString("environments." + env)
+}
@@ -0,0 +1,97 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserConfigPath(t *testing.T) {
+	t.Setenv("OP_USER_CONFIG", "")
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	path, err := UserConfigPath()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/xdg", "octopilot", "config.yaml"), path)
+
+	t.Setenv("OP_USER_CONFIG", "/tmp/op.yaml")
+	path, err = UserConfigPath()
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/op.yaml", path)
+}
+
+func TestSetUserConfigValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "octopilot", "config.yaml")
+	require.NoError(t, SetUserConfigValue(path, "default_repo", "ghcr.io/me"))
+	require.NoError(t, SetUserConfigValue(path, "platforms", "linux/amd64, linux/arm64"))
+	require.NoError(t, SetUserConfigValue(path, "environments.prod", "gcr.io/prod"))
+
+	cfg, err := ReadUserConfig(path)
+	require.NoError(t, err)
+	flat := FlattenUserConfig(cfg)
+	assert.Equal(t, "ghcr.io/me", flat["default_repo"])
+	assert.Equal(t, "linux/amd64,linux/arm64", FormatUserConfigValue(flat["platforms"]))
+	assert.Equal(t, "gcr.io/prod", flat["environments.prod"])
+
+	require.NoError(t, SetUserConfigValue(path, "default_repo", ""))
+	cfg, err = ReadUserConfig(path)
+	require.NoError(t, err)
+	assert.NotContains(t, cfg, "default_repo")
+
+	assert.ErrorContains(t, SetUserConfigValue(path, "colour", "blue"), `unknown config key "colour"`)
+	assert.ErrorContains(t, SetUserConfigValue(path, "environments.", "x"), "unknown config key")
+}
+
+func TestReadUserConfig_Missing(t *testing.T) {
+	cfg, err := ReadUserConfig(filepath.Join(t.TempDir(), "none.yaml"))
+	require.NoError(t, err)
+	assert.Empty(t, cfg)
+}
+
+func TestLoadUserConfig_LowestPrecedence(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("OP_USER_CONFIG", path)
+	require.NoError(t, os.WriteFile(path, []byte("default_repo: ghcr.io/user\ninsecure_registries: [reg.local:5000]\nenvironments:\n  staging: gcr.io/staging\n"), 0o644))
+
+	viper.Set("default_repo", "ghcr.io/project")
+	loaded, err := LoadUserConfig()
+	require.NoError(t, err)
+	assert.Equal(t, path, loaded)
+	assert.Equal(t, "ghcr.io/project", viper.GetString("default_repo"))
+	assert.Equal(t, []string{"reg.local:5000"}, viper.GetStringSlice("insecure_registries"))
+	assert.Equal(t, "gcr.io/staging", GetEnvironmentRepository("staging"))
+
+	t.Setenv("GOOGLE_GKE_IMAGE_REPOSITORY", "")
+	t.Setenv("WATCH_DESTINATION_REPOSITORY", "")
+	repo, err := GetWatchDestinationRepository("staging")
+	require.NoError(t, err)
+	assert.Equal(t, "gcr.io/staging", repo)
+	src, _, err := GetPromoteRepositories("staging", "prod")
+	require.NoError(t, err)
+	assert.Equal(t, "gcr.io/staging", src)
+}
+
+func TestLoadUserConfig_Interpolates(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("OP_USER_CONFIG", path)
+	t.Setenv("GCP_PROJECT", "my-project")
+	require.NoError(t, os.WriteFile(path, []byte("environments:\n  prod: europe-docker.pkg.dev/${GCP_PROJECT}/prod\n"), 0o644))
+
+	_, err := LoadUserConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "europe-docker.pkg.dev/my-project/prod", GetEnvironmentRepository("prod"))
+
+	require.NoError(t, os.WriteFile(path, []byte("default_repo: ${OP_TEST_UNSET:?set a registry}\n"), 0o644))
+	_, err = LoadUserConfig()
+	var interpErr *InterpolationError
+	assert.True(t, errors.As(err, &interpErr))
+	assert.ErrorContains(t, err, "default_repo: OP_TEST_UNSET: set a registry")
+}
@@ -0,0 +1,194 @@
+package util
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationIssue is a problem found by `op validate` at a file location.
+// Line and Column are 1-based; 0 means the location is unknown.
+type ValidationIssue struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (i ValidationIssue) String() string {
+	switch {
+	case i.Line > 0 && i.Column > 0:
+		return fmt.Sprintf("%s:%d:%d: %s", i.File, i.Line, i.Column, i.Message)
+	case i.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", i.File, i.Line, i.Message)
+	}
+	return fmt.Sprintf("%s: %s", i.File, i.Message)
+}
+
+// IssueAt returns an issue located at node n of file.
+func IssueAt(file string, n *yaml.Node, format string, args ...any) ValidationIssue {
+	issue := ValidationIssue{File: file, Message: fmt.Sprintf(format, args...)}
+	if n != nil {
+		issue.Line, issue.Column = n.Line, n.Column
+	}
+	return issue
+}
+
+// ValidateSchema parses data (YAML or JSON) and checks it against the fields
+// of typ, the Go type the file is loaded into: unknown fields, mappings where
+// lists are expected and values that do not fit numbers or booleans are
+// reported with their location. tag names the struct tag holding field names
+// (yaml or json); allowed lists extra top-level keys read by other means. The
+// parsed document root is returned for further checks (nil for empty files).
+func ValidateSchema(file string, data []byte, typ reflect.Type, tag string, allowed ...string) (*yaml.Node, []ValidationIssue) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, []ValidationIssue{{File: file, Line: yamlErrorLine(err), Message: err.Error()}}
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	skip := map[string]bool{}
+	for _, k := range allowed {
+		skip[k] = true
+	}
+	return root, checkSchemaNode(file, root, typ, tag, "", skip)
+}
+
+// yamlErrorLine extracts N from "yaml: line N: ..." parse errors.
+func yamlErrorLine(err error) int {
+	var line int
+	if _, scanErr := fmt.Sscanf(strings.TrimPrefix(err.Error(), "yaml: "), "line %d:", &line); scanErr != nil {
+		return 0
+	}
+	return line
+}
+
+var (
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	yamlUnmarshalerType = reflect.TypeFor[yaml.Unmarshaler]()
+)
+
+func checkSchemaNode(file string, n *yaml.Node, t reflect.Type, tag, path string, skip map[string]bool) []ValidationIssue {
+	for n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if n.Tag == "!!null" {
+		return nil
+	}
+	where := orDefault(path, "document root")
+	// Types such as time.Time are written as strings.
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		if n.Kind != yaml.ScalarNode {
+			return []ValidationIssue{IssueAt(file, n, "%s must be a string", where)}
+		}
+		if err := reflect.New(t).Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(n.Value)); err != nil {
+			return []ValidationIssue{IssueAt(file, n, "%s: %q is not a valid %s", where, n.Value, t)}
+		}
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		// Structs with their own UnmarshalYAML (.registry entries) also
+		// accept a string shorthand.
+		if n.Kind == yaml.ScalarNode && reflect.PointerTo(t).Implements(yamlUnmarshalerType) {
+			return nil
+		}
+		if n.Kind != yaml.MappingNode {
+			return []ValidationIssue{IssueAt(file, n, "%s must be a mapping", where)}
+		}
+		fields := map[string]reflect.StructField{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+			if name == "-" || !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			fields[name] = f
+		}
+		var issues []ValidationIssue
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			f, ok := fields[key.Value]
+			if !ok {
+				if path == "" && skip[key.Value] {
+					continue
+				}
+				issues = append(issues, IssueAt(file, key, "unknown field %q in %s", key.Value, where))
+				continue
+			}
+			issues = append(issues, checkSchemaNode(file, value, f.Type, tag, joinSchemaPath(path, key.Value), skip)...)
+		}
+		return issues
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return []ValidationIssue{IssueAt(file, n, "%s must be a mapping", where)}
+		}
+		var issues []ValidationIssue
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			issues = append(issues, checkSchemaNode(file, n.Content[i+1], t.Elem(), tag, joinSchemaPath(path, n.Content[i].Value), skip)...)
+		}
+		return issues
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			return []ValidationIssue{IssueAt(file, n, "%s must be a list", where)}
+		}
+		var issues []ValidationIssue
+		for i, item := range n.Content {
+			issues = append(issues, checkSchemaNode(file, item, t.Elem(), tag, fmt.Sprintf("%s[%d]", path, i), skip)...)
+		}
+		return issues
+	case reflect.Interface:
+		return nil
+	}
+	if n.Kind != yaml.ScalarNode {
+		return []ValidationIssue{IssueAt(file, n, "%s must be a %s value", where, t.Kind())}
+	}
+	if t.Kind() != reflect.String {
+		if err := n.Decode(reflect.New(t).Interface()); err != nil {
+			return []ValidationIssue{IssueAt(file, n, "%s: %q is not a valid %s", where, n.Value, t.Kind())}
+		}
+	}
+	return nil
+}
+
+func joinSchemaPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// YAMLLookup returns the value node at the mapping keys path, or nil.
+func YAMLLookup(n *yaml.Node, path ...string) *yaml.Node {
+	for _, key := range path {
+		if n = mappingValue(n, key); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// YAMLKey returns the key node of key in mapping n, or nil; it locates
+// problems with a map entry as a whole.
+func YAMLKey(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i]
+		}
+	}
+	return nil
+}
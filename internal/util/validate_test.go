@@ -0,0 +1,64 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSchema_RunConfig(t *testing.T) {
+	data := []byte(`default_repo: localhost:5001
+SKAFFOLD_PROFILE: dev
+contexts:
+  api:
+    ports: "8080:8080"
+    envv: {}
+local_registry:
+  port: abc
+tests:
+  app:
+    file_existence_tests:
+      - path: /bin/app
+        should_exist: maybe
+`)
+	root, issues := ValidateSchema("octopilot.yaml", data, reflect.TypeOf(RunConfig{}), "yaml", "SKAFFOLD_PROFILE")
+	require.NotNil(t, root)
+	var got []string
+	for _, i := range issues {
+		got = append(got, i.String())
+	}
+	assert.Equal(t, []string{
+		"octopilot.yaml:5:12: contexts.api.ports must be a list",
+		`octopilot.yaml:6:5: unknown field "envv" in contexts.api`,
+		`octopilot.yaml:8:9: local_registry.port: "abc" is not a valid int`,
+		`octopilot.yaml:13:23: tests.app.file_existence_tests[0].should_exist: "maybe" is not a valid bool`,
+	}, got)
+}
+
+func TestValidateSchema_JSONAndErrors(t *testing.T) {
+	_, issues := ValidateSchema("build_result.json", []byte(`{"builds": [{"imageName": "app", "tag": "x", "digets": "y"}]}`), reflect.TypeOf(BuildResult{}), "json")
+	require.Len(t, issues, 1)
+	assert.Equal(t, `build_result.json:1:46: unknown field "digets" in builds[0]`, issues[0].String())
+
+	_, issues = ValidateSchema("build_result.json", []byte(`{"builds": [{"imageName": "app", "tag": "x", "startedAt": "2026-10-16T09:00:00Z", "finishedAt": "soon"}]}`), reflect.TypeOf(BuildResult{}), "json")
+	require.Len(t, issues, 1)
+	assert.Equal(t, `build_result.json:1:97: builds[0].finishedAt: "soon" is not a valid time.Time`, issues[0].String())
+
+	_, issues = ValidateSchema(".registry", []byte("local: [a\n"), RegistryFileType, "yaml")
+	require.Len(t, issues, 1)
+	assert.Equal(t, 1, issues[0].Line)
+
+	root, issues := ValidateSchema(".registry", nil, RegistryFileType, "yaml")
+	assert.Nil(t, root)
+	assert.Empty(t, issues)
+}
+
+func TestYAMLLookupAndKey(t *testing.T) {
+	root, _ := ValidateSchema("f", []byte("a:\n  b: 1\n"), reflect.TypeOf(map[string]any{}), "yaml")
+	assert.Equal(t, "1", YAMLLookup(root, "a", "b").Value)
+	assert.Nil(t, YAMLLookup(root, "a", "c"))
+	assert.Equal(t, 2, YAMLKey(YAMLLookup(root, "a"), "b").Line)
+	assert.Equal(t, "f: message", ValidationIssue{File: "f", Message: "message"}.String())
+}
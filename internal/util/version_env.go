@@ -0,0 +1,102 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// DefaultVersionEnvVars are the variables `op build` reads the version from,
+// in order, when build.version_env.vars is not set.
+var DefaultVersionEnvVars = []string{"DOCKER_METADATA_OUTPUT_VERSION", "CI_COMMIT_TAG", "SKAFFOLD_TAG", "VERSION", "TAG", "IMAGE_TAG"}
+
+// DefaultPlatformSuffixPatterns separate a version from the platform suffix
+// CI matrix jobs append (v1.2.3_linux_arm64, v1.2.3-linux-amd64,
+// v1.2.3/linux/arm64) when build.version_env.suffix_patterns is not set.
+var DefaultPlatformSuffixPatterns = []string{`_linux_`, `-linux-`, `/linux/`}
+
+// VersionEnvOpts configures the version variables `op build` reads and the
+// platform suffixes it strips from them:
+//
+//	build:
+//	  version_env:
+//	    vars: [VERSION, BUILD_TAG]
+//	    suffix_patterns: ['-windows-', '-ltsc\d{4}$']
+type VersionEnvOpts struct {
+	// Vars are the variables to read, in order; the first one set is the
+	// version (default DefaultVersionEnvVars).
+	Vars []string `yaml:"vars"`
+	// SuffixPatterns are regular expressions; a value is cut at the first
+	// match of any of them (default DefaultPlatformSuffixPatterns).
+	SuffixPatterns []string `yaml:"suffix_patterns"`
+}
+
+// VersionEnvChange records a variable whose platform suffix was stripped.
+type VersionEnvChange struct {
+	Var     string
+	From    string
+	To      string
+	Pattern string
+}
+
+// CompileSuffixPatterns compiles o.SuffixPatterns, or the defaults.
+func (o VersionEnvOpts) CompileSuffixPatterns() ([]*regexp.Regexp, error) {
+	patterns := o.SuffixPatterns
+	if len(patterns) == 0 {
+		patterns = DefaultPlatformSuffixPatterns
+	}
+	res := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid suffix pattern %q: %w", p, err)
+		}
+		res[i] = re
+	}
+	return res, nil
+}
+
+// StripPlatformSuffix cuts value at the earliest match of patterns and
+// returns what is left and the pattern that matched ("" when none did).
+// A match at the very start is ignored, so the version is never emptied.
+func StripPlatformSuffix(value string, patterns []*regexp.Regexp) (string, string) {
+	cut, matched := len(value), ""
+	for _, re := range patterns {
+		if loc := re.FindStringIndex(value); loc != nil && loc[0] > 0 && loc[0] < cut {
+			cut, matched = loc[0], re.String()
+		}
+	}
+	return value[:cut], matched
+}
+
+// CleanVersionEnv strips the platform suffix from the version variables of
+// o, rewriting them in the environment so later readers (see CIVersion) see
+// the clean value. It returns the version (the first variable set, cleaned)
+// and the variables it changed.
+func CleanVersionEnv(o VersionEnvOpts) (string, []VersionEnvChange, error) {
+	patterns, err := o.CompileSuffixPatterns()
+	if err != nil {
+		return "", nil, err
+	}
+	vars := o.Vars
+	if len(vars) == 0 {
+		vars = DefaultVersionEnvVars
+	}
+	var version string
+	var changes []VersionEnvChange
+	for _, key := range vars {
+		val := os.Getenv(key)
+		if val == "" {
+			continue
+		}
+		clean, pattern := StripPlatformSuffix(val, patterns)
+		if pattern != "" {
+			os.Setenv(key, clean)
+			changes = append(changes, VersionEnvChange{Var: key, From: val, To: clean, Pattern: pattern})
+		}
+		if version == "" {
+			version = clean
+		}
+	}
+	return version, changes, nil
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripPlatformSuffix(t *testing.T) {
+	patterns, err := VersionEnvOpts{}.CompileSuffixPatterns()
+	require.NoError(t, err)
+	for value, want := range map[string]string{
+		"v0.0.34_linux_arm64": "v0.0.34",
+		"v0.0.34-linux-amd64": "v0.0.34",
+		"v0.0.34/linux/arm64": "v0.0.34",
+		"v0.0.34":             "v0.0.34",
+		"_linux_arm64":        "_linux_arm64",
+	} {
+		got, _ := StripPlatformSuffix(value, patterns)
+		assert.Equal(t, want, got, value)
+	}
+
+	// The earliest match wins, whichever pattern it is.
+	got, pattern := StripPlatformSuffix("1.2-ltsc2022-windows-amd64", []*regexp.Regexp{
+		regexp.MustCompile(`-windows-`), regexp.MustCompile(`-ltsc\d{4}`),
+	})
+	assert.Equal(t, "1.2", got)
+	assert.Equal(t, `-ltsc\d{4}`, pattern)
+}
+
+func TestCleanVersionEnv(t *testing.T) {
+	for _, key := range DefaultVersionEnvVars {
+		t.Setenv(key, "")
+	}
+	t.Setenv("VERSION", "v1.4.0_linux_arm64")
+	t.Setenv("TAG", "v1.4.0-rc")
+	version, changes, err := CleanVersionEnv(VersionEnvOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, "v1.4.0", version)
+	assert.Equal(t, []VersionEnvChange{{Var: "VERSION", From: "v1.4.0_linux_arm64", To: "v1.4.0", Pattern: "_linux_"}}, changes)
+	assert.Equal(t, "v1.4.0", os.Getenv("VERSION"))
+
+	// Configured variables and patterns replace the defaults.
+	t.Setenv("BUILD_TAG", "2.0.1-windows-ltsc2022")
+	version, changes, err = CleanVersionEnv(VersionEnvOpts{Vars: []string{"BUILD_TAG", "TAG"}, SuffixPatterns: []string{`-windows-`}})
+	require.NoError(t, err)
+	assert.Equal(t, "2.0.1", version)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "2.0.1", os.Getenv("BUILD_TAG"))
+
+	_, _, err = CleanVersionEnv(VersionEnvOpts{SuffixPatterns: []string{`(`}})
+	assert.ErrorContains(t, err, `invalid suffix pattern "("`)
+}
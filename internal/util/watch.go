@@ -0,0 +1,68 @@
+package util
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// watchIgnoreDirs are directory names skipped when snapshotting a context.
+var watchIgnoreDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+}
+
+type fileStamp struct {
+	ModTime time.Time
+	Size    int64
+}
+
+// FileSnapshot records the modification time and size of every file under a directory.
+type FileSnapshot map[string]fileStamp
+
+// SnapshotDir walks dir and returns a snapshot of its files.
+// VCS metadata and dependency directories (.git, node_modules) are skipped.
+func SnapshotDir(dir string) (FileSnapshot, error) {
+	snap := make(FileSnapshot)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && watchIgnoreDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		snap[rel] = fileStamp{ModTime: info.ModTime(), Size: info.Size()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// Diff returns the sorted list of files added, removed or modified in next
+// relative to s.
+func (s FileSnapshot) Diff(next FileSnapshot) []string {
+	var changed []string
+	for path, stamp := range next {
+		if prev, ok := s[path]; !ok || prev != stamp {
+			changed = append(changed, path)
+		}
+	}
+	for path := range s {
+		if _, ok := next[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotDir_DetectsChanges(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "old.txt"), []byte("x"), 0o644))
+
+	before, err := SnapshotDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, before, 2)
+
+	// Modify, add and remove files.
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "main.go"), later, later))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new.go"), []byte("package main\n"), 0o644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "old.txt")))
+
+	after, err := SnapshotDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main.go", "new.go", "old.txt"}, before.Diff(after))
+	assert.Empty(t, after.Diff(after))
+}
+
+func TestSnapshotDir_SkipsIgnoredDirs(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "node_modules", "pkg"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "node_modules", "pkg", "index.js"), []byte("x"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "server.js"), []byte("x"), 0o644))
+
+	snap, err := SnapshotDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, snap, 1)
+	assert.Contains(t, snap, "server.js")
+}
@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/config"
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/graph"
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/parser"
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/runner"
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/runner/runcontext"
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/latest"
+)
+
+// Builder builds artifacts (the subset of runner.Runner the pipeline needs),
+// so tests and embedders can substitute their own.
+type Builder interface {
+	Build(ctx context.Context, out io.Writer, artifacts []*latest.Artifact) ([]graph.Artifact, error)
+}
+
+// NewSkaffoldBuilder returns the Skaffold runner for rc.
+func NewSkaffoldBuilder(ctx context.Context, rc *runcontext.RunContext) (Builder, error) {
+	return runner.NewForConfig(ctx, rc)
+}
+
+// BuildOptions configures Build.
+type BuildOptions struct {
+	// Skaffold are the options of the Skaffold run (configuration file,
+	// default repo, platforms, push, profiles...).
+	Skaffold config.SkaffoldOptions
+	// Artifact builds only the artifact with this image name when set.
+	Artifact string
+	// NewBuilder replaces NewSkaffoldBuilder, e.g. for tests.
+	NewBuilder func(context.Context, *runcontext.RunContext) (Builder, error)
+	// ResultPath is where build_result.json is written; nothing is written when empty.
+	ResultPath string
+	// Out receives build output (default os.Stdout).
+	Out io.Writer
+}
+
+// LoadRunContext parses the Skaffold configuration of opts and returns its run context.
+func LoadRunContext(ctx context.Context, opts config.SkaffoldOptions) (*runcontext.RunContext, error) {
+	configs, err := parser.GetAllConfigs(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing skaffold config: %w", err)
+	}
+	runCtx, err := runcontext.GetRunContext(ctx, opts, configs)
+	if err != nil {
+		return nil, fmt.Errorf("error creating run context: %w", err)
+	}
+	return runCtx, nil
+}
+
+// SelectArtifacts returns the artifact named imageName, or all artifacts
+// when imageName is empty.
+func SelectArtifacts(artifacts []*latest.Artifact, imageName string) ([]*latest.Artifact, error) {
+	if imageName == "" {
+		return artifacts, nil
+	}
+	for _, a := range artifacts {
+		if a.ImageName == imageName {
+			return []*latest.Artifact{a}, nil
+		}
+	}
+	return nil, fmt.Errorf("artifact %q not found in skaffold config (available: %v)",
+		imageName, ArtifactImageNames(artifacts))
+}
+
+// ArtifactImageNames returns the image names of artifacts.
+func ArtifactImageNames(artifacts []*latest.Artifact) []string {
+	names := make([]string, 0, len(artifacts))
+	for _, a := range artifacts {
+		names = append(names, a.ImageName)
+	}
+	return names
+}
+
+// BuildArtifacts builds artifacts with b and returns them as a build result.
+func BuildArtifacts(ctx context.Context, b Builder, artifacts []*latest.Artifact, out io.Writer) (*BuildResult, error) {
+	started := time.Now().UTC()
+	built, err := b.Build(ctx, out, artifacts)
+	if err != nil {
+		return nil, fmt.Errorf("build failed: %w", err)
+	}
+	finished := time.Now().UTC()
+	res := &BuildResult{SchemaVersion: BuildResultSchemaVersion, Builds: make([]BuildEntry, 0, len(built))}
+	for _, ba := range built {
+		e := BuildEntry{ImageName: ba.ImageName, Tag: ba.Tag, Kind: ArtifactKindImage, StartedAt: started, FinishedAt: finished}
+		e.Digest = e.ImageDigest()
+		res.Builds = append(res.Builds, e)
+	}
+	return res, nil
+}
+
+// Build runs a Skaffold build of the configuration in o.Skaffold and returns
+// the built artifacts, writing them to o.ResultPath when set. This is the
+// library build behind `op build` without --push; the direct Pack and
+// per-platform Docker paths of `op build --push` remain in the CLI.
+func Build(ctx context.Context, o BuildOptions) (*BuildResult, error) {
+	newBuilder := o.NewBuilder
+	if newBuilder == nil {
+		newBuilder = NewSkaffoldBuilder
+	}
+	out := o.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	runCtx, err := LoadRunContext(ctx, o.Skaffold)
+	if err != nil {
+		return nil, err
+	}
+	artifacts, err := SelectArtifacts(runCtx.Artifacts(), o.Artifact)
+	if err != nil {
+		return nil, err
+	}
+	b, err := newBuilder(ctx, runCtx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating runner: %w", err)
+	}
+	res, err := BuildArtifacts(ctx, b, artifacts, out)
+	if err != nil {
+		return nil, err
+	}
+	if o.ResultPath != "" && len(res.Builds) > 0 {
+		if err := WriteBuildResult(o.ResultPath, *res); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
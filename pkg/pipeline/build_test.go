@@ -0,0 +1,54 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/graph"
+	"github.com/GoogleContainerTools/skaffold/v2/pkg/skaffold/schema/latest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBuilder struct {
+	built []*latest.Artifact
+}
+
+func (f *fakeBuilder) Build(_ context.Context, _ io.Writer, artifacts []*latest.Artifact) ([]graph.Artifact, error) {
+	f.built = artifacts
+	var out []graph.Artifact
+	for _, a := range artifacts {
+		out = append(out, graph.Artifact{ImageName: a.ImageName, Tag: "ghcr.io/acme/" + a.ImageName + ":v1@sha256:abc"})
+	}
+	return out, nil
+}
+
+func TestSelectArtifacts(t *testing.T) {
+	arts := []*latest.Artifact{{ImageName: "op-base"}, {ImageName: "op"}}
+
+	got, err := SelectArtifacts(arts, "")
+	require.NoError(t, err)
+	assert.Len(t, got, 2)
+
+	got, err = SelectArtifacts(arts, "op")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"op"}, ArtifactImageNames(got))
+
+	_, err = SelectArtifacts(arts, "missing")
+	assert.ErrorContains(t, err, `artifact "missing" not found in skaffold config (available: [op-base op])`)
+}
+
+func TestBuildArtifacts(t *testing.T) {
+	b := &fakeBuilder{}
+	res, err := BuildArtifacts(context.Background(), b, []*latest.Artifact{{ImageName: "op"}}, io.Discard)
+	require.NoError(t, err)
+	require.Len(t, res.Builds, 1)
+	e := res.Builds[0]
+	assert.Equal(t, "op", e.ImageName)
+	assert.Equal(t, "ghcr.io/acme/op:v1@sha256:abc", e.Tag)
+	assert.Equal(t, "sha256:abc", e.Digest)
+	assert.Equal(t, ArtifactKindImage, e.Kind)
+	assert.False(t, e.FinishedAt.Before(e.StartedAt))
+	assert.Len(t, b.built, 1)
+}
@@ -0,0 +1,231 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const BuildResultFilename = "build_result.json"
+
+// BuildResultSchemaVersion is the schema version written to build_result.json.
+// Version 1 files (no schemaVersion) only carry imageName and tag per build;
+// every field added since is optional, so both versions read the same way.
+const BuildResultSchemaVersion = 2
+
+// Artifact kinds recorded in BuildEntry.Kind.
+const (
+	ArtifactKindImage = "image"
+	ArtifactKindChart = "chart"
+)
+
+// PlatformDigest is the digest of one platform's image in a manifest list.
+type PlatformDigest struct {
+	Platform string `json:"platform"` // os/arch[/variant]
+	Digest   string `json:"digest"`
+}
+
+// BuildEntry is a single artifact record in build_result.json.
+type BuildEntry struct {
+	ImageName string `json:"imageName"`
+	Tag       string `json:"tag"` // fully-qualified ref: registry/image:tag@sha256:digest
+
+	// Schema v2. All optional: empty when unknown or written by an older op.
+	Kind       string           `json:"kind,omitempty"`      // ArtifactKindImage (default) or ArtifactKindChart
+	Digest     string           `json:"digest,omitempty"`    // manifest (list) digest, as in Tag
+	ImageID    string           `json:"imageID,omitempty"`   // local image ID of an image built without --push (Tag has no digest)
+	MediaType  string           `json:"mediaType,omitempty"` // manifest (list) media type
+	Platforms  []PlatformDigest `json:"platforms,omitempty"` // per-platform child digests of a manifest list
+	Builder    string           `json:"builder,omitempty"`   // buildpack builder image, pinned by digest
+	RunImage   string           `json:"runImage,omitempty"`  // buildpack run image, pinned by digest
+	SBOM       []string         `json:"sbom,omitempty"`      // SBOM files or refs written for the image
+	Signature  string           `json:"signature,omitempty"` // cosign signature ref
+	StartedAt  time.Time        `json:"startedAt,omitzero"`
+	FinishedAt time.Time        `json:"finishedAt,omitzero"`
+}
+
+// ArtifactKind returns e.Kind, defaulting to ArtifactKindImage for entries
+// written before the kind was recorded.
+func (e BuildEntry) ArtifactKind() string {
+	if e.Kind == "" {
+		return ArtifactKindImage
+	}
+	return e.Kind
+}
+
+// ImageDigest returns e.Digest, or the digest of Tag (ref@sha256:...) for
+// entries written before the digest was recorded separately.
+func (e BuildEntry) ImageDigest() string {
+	if e.Digest != "" {
+		return e.Digest
+	}
+	if _, d, ok := strings.Cut(e.Tag, "@"); ok {
+		return d
+	}
+	return ""
+}
+
+// IsLocal reports whether e is an image op build left in the local daemon
+// (docker or podman) instead of pushing it.
+func (e BuildEntry) IsLocal() bool {
+	return e.ImageID != "" && e.ImageDigest() == ""
+}
+
+// BuildResult is the contract written by `op build --push` and consumed by
+// promote-image, watch-deployment, and attestation steps.
+type BuildResult struct {
+	SchemaVersion int          `json:"schemaVersion,omitempty"`
+	Builds        []BuildEntry `json:"builds"`
+}
+
+// ReadBuildResult reads build_result.json from the given directory (or cwd if empty).
+func ReadBuildResult(dir string) (*BuildResult, error) {
+	if dir == "" {
+		var err error
+		dir, err = os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ReadBuildResultFile(filepath.Join(dir, BuildResultFilename))
+}
+
+// ReadBuildResultFile reads a build result from path, whatever its name.
+func ReadBuildResultFile(path string) (*BuildResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	var res BuildResult
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(res.Builds) == 0 {
+		return nil, fmt.Errorf("%s: no builds found", path)
+	}
+	if res.SchemaVersion == 0 {
+		res.SchemaVersion = 1
+	}
+	return &res, nil
+}
+
+// WriteBuildResult writes res to path in the build_result.json format, at
+// the current BuildResultSchemaVersion. The file is replaced atomically
+// (written next to it, then renamed), so a crash never leaves a partial
+// file, while holding the advisory lock MergeBuildResult takes.
+func WriteBuildResult(path string, res BuildResult) error {
+	unlock, err := lockBuildResultDir(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return replaceBuildResult(path, res)
+}
+
+// MergeBuildResult adds builds to the build result at path, replacing the
+// entries of the same images and keeping the others, so jobs building one
+// artifact each (op build --artifact) can share a workspace. A missing file
+// is created. It returns the merged result.
+func MergeBuildResult(path string, builds []BuildEntry) (*BuildResult, error) {
+	unlock, err := lockBuildResultDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	res := BuildResult{}
+	if existing, err := ReadBuildResultFile(path); err == nil {
+		res = *existing
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, b := range builds {
+		if i := slices.IndexFunc(res.Builds, func(e BuildEntry) bool { return e.ImageName == b.ImageName }); i >= 0 {
+			res.Builds[i] = b
+		} else {
+			res.Builds = append(res.Builds, b)
+		}
+	}
+	res.SchemaVersion = BuildResultSchemaVersion
+	if err := replaceBuildResult(path, res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// replaceBuildResult writes res to a temporary file in the directory of
+// path and renames it over path.
+func replaceBuildResult(path string, res BuildResult) error {
+	res.SchemaVersion = BuildResultSchemaVersion
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(append(data, '\n'))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// GetFirstTag returns the tag of the first artifact in build_result.json.
+// For multi-artifact builds prefer GetTagForImage to select by name.
+func GetFirstTag(res *BuildResult) (string, error) {
+	if len(res.Builds) == 0 {
+		return "", fmt.Errorf("no builds found")
+	}
+	return res.Builds[0].Tag, nil
+}
+
+// GetTagForImage returns the fully-qualified tag for the named artifact.
+// Returns an error if the image name is not present in the result.
+func GetTagForImage(res *BuildResult, imageName string) (string, error) {
+	for _, b := range res.Builds {
+		if b.ImageName == imageName {
+			return b.Tag, nil
+		}
+	}
+	names := make([]string, len(res.Builds))
+	for i, b := range res.Builds {
+		names[i] = b.ImageName
+	}
+	return "", fmt.Errorf("image %q not found in build_result.json (available: %v)", imageName, names)
+}
+
+// SelectTag returns the tag for imageName when set, otherwise falls back to
+// the last entry in builds (the application image, not the base image).
+// This is the recommended selector for commands that need to pick one artifact.
+func SelectTag(res *BuildResult, imageName string) (string, error) {
+	if imageName != "" {
+		return GetTagForImage(res, imageName)
+	}
+	// Default: last entry (application image — base images come first by convention).
+	if len(res.Builds) == 0 {
+		return "", fmt.Errorf("no builds found")
+	}
+	return res.Builds[len(res.Builds)-1].Tag, nil
+}
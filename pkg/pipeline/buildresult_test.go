@@ -0,0 +1,223 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeBuildResultFixture(t *testing.T, dir string, builds []BuildEntry) {
+	t.Helper()
+	br := BuildResult{Builds: builds}
+	data, err := json.Marshal(br)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, BuildResultFilename), data, 0o644))
+}
+
+func TestReadBuildResult(t *testing.T) {
+	dir := t.TempDir()
+	builds := []BuildEntry{
+		{ImageName: "op-base", Tag: "ghcr.io/org/op-base:v1@sha256:aaa"},
+		{ImageName: "op", Tag: "ghcr.io/org/op:v1@sha256:bbb"},
+	}
+	writeBuildResultFixture(t, dir, builds)
+
+	res, err := ReadBuildResult(dir)
+	require.NoError(t, err)
+	assert.Len(t, res.Builds, 2)
+	assert.Equal(t, "op-base", res.Builds[0].ImageName)
+	assert.Equal(t, "op", res.Builds[1].ImageName)
+}
+
+func TestReadBuildResult_Empty(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, BuildResultFilename),
+		[]byte(`{"builds":[]}`), 0o644))
+	_, err := ReadBuildResult(dir)
+	assert.ErrorContains(t, err, "no builds found")
+}
+
+func TestReadBuildResult_Missing(t *testing.T) {
+	_, err := ReadBuildResult(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestGetFirstTag(t *testing.T) {
+	res := &BuildResult{Builds: []BuildEntry{
+		{ImageName: "op-base", Tag: "ghcr.io/org/op-base:v1@sha256:aaa"},
+		{ImageName: "op", Tag: "ghcr.io/org/op:v1@sha256:bbb"},
+	}}
+	tag, err := GetFirstTag(res)
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/org/op-base:v1@sha256:aaa", tag)
+}
+
+func TestGetFirstTag_Empty(t *testing.T) {
+	_, err := GetFirstTag(&BuildResult{})
+	assert.Error(t, err)
+}
+
+func TestGetTagForImage(t *testing.T) {
+	res := &BuildResult{Builds: []BuildEntry{
+		{ImageName: "op-base", Tag: "ghcr.io/org/op-base:v1@sha256:aaa"},
+		{ImageName: "op", Tag: "ghcr.io/org/op:v1@sha256:bbb"},
+	}}
+
+	tag, err := GetTagForImage(res, "op")
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/org/op:v1@sha256:bbb", tag)
+
+	tag, err = GetTagForImage(res, "op-base")
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/org/op-base:v1@sha256:aaa", tag)
+}
+
+func TestGetTagForImage_NotFound(t *testing.T) {
+	res := &BuildResult{Builds: []BuildEntry{{ImageName: "op", Tag: "ghcr.io/org/op:v1@sha256:bbb"}}}
+	_, err := GetTagForImage(res, "missing")
+	assert.ErrorContains(t, err, "missing")
+	assert.ErrorContains(t, err, "op")
+}
+
+func TestSelectTag_ByName(t *testing.T) {
+	res := &BuildResult{Builds: []BuildEntry{
+		{ImageName: "op-base", Tag: "ghcr.io/org/op-base:v1@sha256:aaa"},
+		{ImageName: "op", Tag: "ghcr.io/org/op:v1@sha256:bbb"},
+	}}
+	tag, err := SelectTag(res, "op")
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/org/op:v1@sha256:bbb", tag)
+}
+
+func TestSelectTag_DefaultsToLast(t *testing.T) {
+	res := &BuildResult{Builds: []BuildEntry{
+		{ImageName: "op-base", Tag: "ghcr.io/org/op-base:v1@sha256:aaa"},
+		{ImageName: "op", Tag: "ghcr.io/org/op:v1@sha256:bbb"},
+	}}
+	// Empty imageName → last entry
+	tag, err := SelectTag(res, "")
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/org/op:v1@sha256:bbb", tag)
+}
+
+func TestSelectTag_SingleArtifact(t *testing.T) {
+	res := &BuildResult{Builds: []BuildEntry{
+		{ImageName: "my-app", Tag: "ghcr.io/org/my-app:v2@sha256:ccc"},
+	}}
+	tag, err := SelectTag(res, "")
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/org/my-app:v2@sha256:ccc", tag)
+}
+
+func TestWriteBuildResult(t *testing.T) {
+	dir := t.TempDir()
+	res := BuildResult{Builds: []BuildEntry{{ImageName: "op", Tag: "ghcr.io/org/op:v1@sha256:bbb"}}}
+	require.NoError(t, WriteBuildResult(filepath.Join(dir, BuildResultFilename), res))
+
+	got, err := ReadBuildResult(dir)
+	require.NoError(t, err)
+	res.SchemaVersion = BuildResultSchemaVersion
+	assert.Equal(t, res, *got)
+
+	// The file is replaced through a rename; no temporary file is left.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, BuildResultFilename, entries[0].Name())
+}
+
+func TestMergeBuildResult(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, BuildResultFilename)
+	writeBuildResultFixture(t, dir, []BuildEntry{{ImageName: "api", Tag: "r/api:1@sha256:old"}, {ImageName: "web", Tag: "r/web:1@sha256:w"}})
+
+	res, err := MergeBuildResult(path, []BuildEntry{{ImageName: "api", Tag: "r/api:1@sha256:new"}, {ImageName: "worker", Tag: "r/worker:1@sha256:k"}})
+	require.NoError(t, err)
+	assert.Equal(t, []BuildEntry{
+		{ImageName: "api", Tag: "r/api:1@sha256:new"},
+		{ImageName: "web", Tag: "r/web:1@sha256:w"},
+		{ImageName: "worker", Tag: "r/worker:1@sha256:k"},
+	}, res.Builds)
+	got, err := ReadBuildResult(dir)
+	require.NoError(t, err)
+	assert.Equal(t, res, got)
+
+	// Concurrent fan-out jobs each add their artifact.
+	path = filepath.Join(t.TempDir(), BuildResultFilename)
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := MergeBuildResult(path, []BuildEntry{{ImageName: fmt.Sprintf("app-%d", i), Tag: "r/app:1@sha256:a"}})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	got, err = ReadBuildResultFile(path)
+	require.NoError(t, err)
+	assert.Len(t, got.Builds, 20)
+
+	// A corrupt file is not silently replaced.
+	require.NoError(t, os.WriteFile(path, []byte(`{"builds": [`), 0o644))
+	_, err = MergeBuildResult(path, []BuildEntry{{ImageName: "api", Tag: "r/api:1@sha256:new"}})
+	assert.ErrorContains(t, err, "parsing")
+}
+
+func TestBuildResultSchemaV2(t *testing.T) {
+	dir := t.TempDir()
+	started := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	res := BuildResult{Builds: []BuildEntry{{
+		ImageName: "op",
+		Tag:       "ghcr.io/org/op:v1@sha256:bbb",
+		Kind:      ArtifactKindImage,
+		Digest:    "sha256:bbb",
+		MediaType: "application/vnd.docker.distribution.manifest.list.v2+json",
+		Platforms: []PlatformDigest{{Platform: "linux/amd64", Digest: "sha256:c1"}, {Platform: "linux/arm64", Digest: "sha256:c2"}},
+		Builder:   "paketobuildpacks/builder-jammy-base@sha256:d",
+		RunImage:  "ghcr.io/org/op-base@sha256:aaa",
+		SBOM:      []string{"sbom"},
+		Signature: "ghcr.io/org/op:sha256-bbb.sig",
+		StartedAt: started, FinishedAt: started.Add(time.Minute),
+	}}}
+	require.NoError(t, WriteBuildResult(filepath.Join(dir, BuildResultFilename), res))
+	data, err := os.ReadFile(filepath.Join(dir, BuildResultFilename))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"schemaVersion":2`)
+	assert.Contains(t, string(data), `"startedAt":"2026-10-16T09:00:00Z"`)
+
+	got, err := ReadBuildResult(dir)
+	require.NoError(t, err)
+	res.SchemaVersion = BuildResultSchemaVersion
+	assert.Equal(t, res, *got)
+}
+
+func TestReadBuildResult_V1(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, BuildResultFilename),
+		[]byte(`{"builds":[{"imageName":"op","tag":"ghcr.io/org/op:v1@sha256:bbb"}]}`), 0o644))
+	res, err := ReadBuildResult(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.SchemaVersion)
+	b := res.Builds[0]
+	assert.Equal(t, ArtifactKindImage, b.ArtifactKind())
+	assert.Equal(t, "sha256:bbb", b.ImageDigest())
+	assert.True(t, b.StartedAt.IsZero())
+
+	data, err := json.Marshal(b)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"imageName":"op","tag":"ghcr.io/org/op:v1@sha256:bbb"}`, string(data))
+}
+
+func TestBuildEntry_IsLocal(t *testing.T) {
+	assert.True(t, BuildEntry{Tag: "ghcr.io/org/op:latest", ImageID: "sha256:ccc"}.IsLocal())
+	assert.False(t, BuildEntry{Tag: "ghcr.io/org/op:latest@sha256:bbb", ImageID: "sha256:ccc"}.IsLocal())
+	assert.False(t, BuildEntry{Tag: "ghcr.io/org/op:latest"}.IsLocal())
+}
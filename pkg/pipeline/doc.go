@@ -0,0 +1,9 @@
+// Package pipeline is the Go API behind the op CLI: Skaffold builds,
+// manifest-list assembly, the build_result.json contract, promotion and
+// waiting for pushed images. Internal tools and test harnesses can embed it
+// instead of shelling out to the op binary.
+//
+// Every operation takes an options struct; function-typed fields (Copy, Head,
+// NewBuilder) replace the registry or Skaffold calls so callers can run the
+// pipeline against fakes.
+package pipeline
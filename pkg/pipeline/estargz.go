@@ -0,0 +1,324 @@
+package pipeline
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"maps"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+const (
+	// EstargzAnnotation is set to "true" on the manifests (and index) that
+	// EstargzImage and EstargzIndex converted.
+	EstargzAnnotation = "org.octopilot.estargz"
+	// EstargzTOCAnnotation is the layer annotation lazy-pulling snapshotters
+	// (stargz-snapshotter) read the table of contents digest from.
+	EstargzTOCAnnotation = "containerd.io/snapshot/stargz/toc.digest"
+)
+
+// EstargzOptions configures PushEstargz.
+type EstargzOptions struct {
+	// InsecureRegistries are registry hosts reached over HTTP or self-signed TLS.
+	InsecureRegistries []string
+	// Remote are the options for every registry call (auth, transport).
+	Remote []remote.Option
+	// Name, when set, parses src and dst instead of InsecureRegistries
+	// (e.g. name.Insecure from crane.GetOptions).
+	Name []name.Option
+}
+
+// EstargzImage returns img with its layers recompressed as eStargz, so
+// lazy-pulling snapshotters can start containers before the image is
+// downloaded. Each converted layer carries EstargzTOCAnnotation and the
+// manifest EstargzAnnotation; the result uses OCI media types, as Docker
+// manifests cannot carry annotations. Layers that already are eStargz, and
+// non-distributable layers, are kept as they are.
+func EstargzImage(img v1.Image) (v1.Image, error) {
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	// The diff IDs change with the layers: start from the config without them.
+	base := cfg.DeepCopy()
+	base.RootFS.DiffIDs = nil
+	base.History = nil
+	var out v1.Image = mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	out = mutate.ConfigMediaType(out, types.OCIConfigJSON)
+	if out, err = mutate.ConfigFile(out, base); err != nil {
+		return nil, err
+	}
+
+	adds := make([]mutate.Addendum, len(layers))
+	for i, l := range layers {
+		d := m.Layers[i]
+		if d.Annotations[EstargzTOCAnnotation] != "" || !d.MediaType.IsDistributable() {
+			adds[i] = mutate.Addendum{Layer: l, MediaType: d.MediaType, Annotations: d.Annotations}
+			continue
+		}
+		converted, toc, err := estargzLayer(l)
+		if err != nil {
+			return nil, fmt.Errorf("converting layer %s: %w", d.Digest, err)
+		}
+		adds[i] = mutate.Addendum{Layer: converted, Annotations: map[string]string{EstargzTOCAnnotation: toc}}
+	}
+	if out, err = mutate.Append(out, adds...); err != nil {
+		return nil, err
+	}
+
+	// Keep the original history, which also lists the empty layers.
+	newCfg, err := out.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	newCfg = newCfg.DeepCopy()
+	newCfg.History = cfg.History
+	if out, err = mutate.ConfigFile(out, newCfg); err != nil {
+		return nil, err
+	}
+	return mutate.Annotations(out, estargzAnnotations(m.Annotations)).(v1.Image), nil
+}
+
+// estargzLayer recompresses l as eStargz and returns it with the digest of
+// its table of contents. The blob is built in memory, as
+// go-containerregistry's own (deprecated) eStargz writer does. A panic of
+// the estargz package is returned as an error.
+func estargzLayer(l v1.Layer) (_ v1.Layer, toc string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("estargz: %v", r)
+		}
+	}()
+	rc, err := l.Uncompressed()
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	blob, err := estargz.Build(io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))),
+		estargz.WithCompression(newEstargzCompression(gzip.BestSpeed)))
+	if err != nil {
+		return nil, "", err
+	}
+	defer blob.Close()
+	compressed, err := io.ReadAll(blob)
+	if err != nil {
+		return nil, "", err
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(compressed)), nil
+	}, tarball.WithMediaType(types.OCILayer))
+	if err != nil {
+		return nil, "", err
+	}
+	return layer, blob.TOCDigest().String(), nil
+}
+
+// estargzCompression is the estargz gzip compression with a footer written
+// byte by byte. The estargz package writes it with compress/gzip and panics
+// when that does not give exactly estargz.FooterSize bytes, which Go 1.27
+// does not (it encodes the empty stream in fewer).
+type estargzCompression struct {
+	*estargz.GzipCompressor
+	*estargz.GzipDecompressor
+	level int
+}
+
+func newEstargzCompression(level int) *estargzCompression {
+	return &estargzCompression{estargz.NewGzipCompressorWithLevel(level), &estargz.GzipDecompressor{}, level}
+}
+
+// WriteTOCAndFooter writes the table of contents as the last tar entry of
+// its own gzip stream, then the footer pointing at it (at offset off).
+func (c *estargzCompression) WriteTOCAndFooter(w io.Writer, off int64, toc *estargz.JTOC, diffHash hash.Hash) (digest.Digest, error) {
+	tocJSON, err := json.MarshalIndent(toc, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	gz, err := gzip.NewWriterLevel(w, c.level)
+	if err != nil {
+		return "", err
+	}
+	gw := io.Writer(gz)
+	if diffHash != nil {
+		gw = io.MultiWriter(gz, diffHash)
+	}
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: estargz.TOCTarName, Size: int64(len(tocJSON))}); err != nil {
+		return "", err
+	}
+	if _, err := tw.Write(tocJSON); err != nil {
+		return "", err
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	if _, err := w.Write(estargzFooter(off)); err != nil {
+		return "", err
+	}
+	return digest.FromBytes(tocJSON), nil
+}
+
+// estargzFooter is the estargz.FooterSize bytes gzip stream ending an
+// eStargz blob: no data, and the offset of the table of contents in the
+// extra field (subfield SG, RFC 1952 section 2.3.1.1).
+func estargzFooter(tocOff int64) []byte {
+	subfield := fmt.Sprintf("%016xSTARGZ", tocOff)
+	// ID1, ID2, deflate, FEXTRA, no mtime, no XFL, unknown OS.
+	b := []byte{0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff}
+	b = binary.LittleEndian.AppendUint16(b, uint16(4+len(subfield)))
+	b = append(b, 'S', 'G')
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(subfield)))
+	b = append(b, subfield...)
+	// An empty final stored block, then the CRC-32 and size of no data.
+	return append(b, 1, 0, 0, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0)
+}
+
+// EstargzIndex returns idx with every platform image converted by
+// EstargzImage. Attestation manifests (platform unknown/unknown) are
+// dropped: they describe the unconverted images.
+func EstargzIndex(idx v1.ImageIndex) (v1.ImageIndex, error) {
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	var out v1.ImageIndex = mutate.IndexMediaType(empty.Index, types.OCIImageIndex)
+	for _, d := range im.Manifests {
+		if d.Platform != nil && d.Platform.OS == "unknown" {
+			continue
+		}
+		var add mutate.Appendable
+		if d.MediaType.IsIndex() {
+			child, err := idx.ImageIndex(d.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if add, err = EstargzIndex(child); err != nil {
+				return nil, err
+			}
+		} else {
+			img, err := idx.Image(d.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if add, err = EstargzImage(img); err != nil {
+				return nil, fmt.Errorf("converting %s: %w", d.Platform, err)
+			}
+		}
+		out = mutate.AppendManifests(out, mutate.IndexAddendum{
+			Add:        add,
+			Descriptor: v1.Descriptor{Platform: d.Platform, Annotations: d.Annotations},
+		})
+	}
+	return mutate.Annotations(out, estargzAnnotations(im.Annotations)).(v1.ImageIndex), nil
+}
+
+// estargzAnnotations returns anns plus EstargzAnnotation.
+func estargzAnnotations(anns map[string]string) map[string]string {
+	out := maps.Clone(anns)
+	if out == nil {
+		out = map[string]string{}
+	}
+	out[EstargzAnnotation] = "true"
+	return out
+}
+
+// PushEstargz converts the image or index at src to eStargz (see
+// EstargzImage) and pushes it as dst. The result has a new digest.
+func PushEstargz(src, dst string, o EstargzOptions) (*ManifestList, error) {
+	parse := func(ref string) (name.Reference, error) {
+		if len(o.Name) > 0 {
+			return name.ParseReference(ref, o.Name...)
+		}
+		return ParseReference(ref, o.InsecureRegistries)
+	}
+	srcRef, err := parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", src, err)
+	}
+	dstRef, err := parse(dst)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", dst, err)
+	}
+	desc, err := remote.Get(srcRef, o.Remote...)
+	if err != nil {
+		return nil, fmt.Errorf("getting %s: %w", src, err)
+	}
+
+	var digest v1.Hash
+	var platforms []PlatformDigest
+	mediaType := types.OCIManifestSchema1
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return nil, err
+		}
+		converted, err := EstargzIndex(idx)
+		if err != nil {
+			return nil, err
+		}
+		if err := remote.WriteIndex(dstRef, converted, o.Remote...); err != nil {
+			return nil, fmt.Errorf("pushing %s: %w", dst, err)
+		}
+		im, err := converted.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range im.Manifests {
+			if m.Platform != nil {
+				platforms = append(platforms, PlatformDigest{Platform: m.Platform.String(), Digest: m.Digest.String()})
+			}
+		}
+		mediaType = types.OCIImageIndex
+		digest, err = converted.Digest()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, err
+		}
+		converted, err := EstargzImage(img)
+		if err != nil {
+			return nil, err
+		}
+		if err := remote.Write(dstRef, converted, o.Remote...); err != nil {
+			return nil, fmt.Errorf("pushing %s: %w", dst, err)
+		}
+		if digest, err = converted.Digest(); err != nil {
+			return nil, err
+		}
+	}
+	return &ManifestList{Digest: digest.String(), MediaType: mediaType, Platforms: platforms}, nil
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assertEstargz checks that every layer of img carries a TOC digest.
+func assertEstargz(t *testing.T, img v1.Image) {
+	t.Helper()
+	m, err := img.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, types.OCIManifestSchema1, m.MediaType)
+	assert.Equal(t, "true", m.Annotations[EstargzAnnotation])
+	for _, l := range m.Layers {
+		assert.Equal(t, types.OCILayer, l.MediaType)
+		assert.NotEmpty(t, l.Annotations[EstargzTOCAnnotation], "layer %s", l.Digest)
+	}
+}
+
+func TestEstargzImage(t *testing.T) {
+	img, err := random.Image(512, 2)
+	require.NoError(t, err)
+	converted, err := EstargzImage(img)
+	require.NoError(t, err)
+	assertEstargz(t, converted)
+
+	cfg, err := converted.ConfigFile()
+	require.NoError(t, err)
+	assert.Len(t, cfg.RootFS.DiffIDs, 2)
+
+	// The layers open as eStargz, with the annotated table of contents.
+	m, err := converted.Manifest()
+	require.NoError(t, err)
+	layers, err := converted.Layers()
+	require.NoError(t, err)
+	rc, err := layers[0].Compressed()
+	require.NoError(t, err)
+	blob, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	r, err := estargz.Open(io.NewSectionReader(bytes.NewReader(blob), 0, int64(len(blob))))
+	require.NoError(t, err)
+	assert.Equal(t, m.Layers[0].Annotations[EstargzTOCAnnotation], r.TOCDigest().String())
+
+	// Converting again keeps the layers as they are.
+	again, err := EstargzImage(converted)
+	require.NoError(t, err)
+	want, _ := converted.Layers()
+	got, _ := again.Layers()
+	for i := range want {
+		wd, _ := want[i].Digest()
+		gd, _ := got[i].Digest()
+		assert.Equal(t, wd, gd)
+	}
+}
+
+func TestEstargzFooter(t *testing.T) {
+	footer := estargzFooter(0x1234)
+	require.Len(t, footer, estargz.FooterSize)
+	_, tocOff, _, err := (&estargz.GzipDecompressor{}).ParseFooter(footer)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x1234), tocOff)
+}
+
+func TestPushEstargz(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	insecure := []string{host}
+
+	idx, err := random.Index(256, 1, 2)
+	require.NoError(t, err)
+	src := host + "/acme/app:v1"
+	ref, err := ParseReference(src, insecure)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(ref, idx, RemoteOptions(src, insecure)...))
+
+	list, err := PushEstargz(src, host+"/acme/app:estargz", EstargzOptions{InsecureRegistries: insecure})
+	require.NoError(t, err)
+	srcDigest, _ := idx.Digest()
+	assert.NotEqual(t, srcDigest.String(), list.Digest)
+	assert.Equal(t, types.OCIImageIndex, list.MediaType)
+
+	dstRef, err := ParseReference(host+"/acme/app:estargz", insecure)
+	require.NoError(t, err)
+	pushed, err := remote.Index(dstRef)
+	require.NoError(t, err)
+	im, err := pushed.IndexManifest()
+	require.NoError(t, err)
+	assert.Equal(t, "true", im.Annotations[EstargzAnnotation])
+	require.Len(t, im.Manifests, 2)
+	for _, d := range im.Manifests {
+		child, err := pushed.Image(d.Digest)
+		require.NoError(t, err)
+		assertEstargz(t, child)
+	}
+
+	// Promotion with Estargz pushes the converted image by tag.
+	img, err := random.Image(256, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img, RemoteOptions(src, insecure)...))
+	digest, _ := img.Digest()
+	dir := t.TempDir()
+	writeBuildResultFixture(t, dir, []BuildEntry{{ImageName: "app", Tag: src + "@" + digest.String()}})
+	p, err := Promote(context.Background(), PromoteOptions{
+		BuildResultDir:  dir,
+		SourceRepo:      host + "/acme",
+		DestinationRepo: host + "/prod",
+		CraneOptions:    []crane.Option{crane.Insecure},
+		Estargz:         true,
+		Logger:          slog.New(slog.DiscardHandler),
+	})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(p.Destination, host+"/prod/app:v1@sha256:"))
+	assert.NotContains(t, p.Destination, digest.String())
+	promotedRef, err := name.ParseReference(p.Destination, name.Insecure)
+	require.NoError(t, err)
+	promoted, err := remote.Image(promotedRef)
+	require.NoError(t, err)
+	assertEstargz(t, promoted)
+}
@@ -0,0 +1,174 @@
+package pipeline
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// QuayExpiresAfterLabel makes Quay delete a tag once the duration it holds
+// (e.g. 2w) has passed since the push.
+const QuayExpiresAfterLabel = "quay.expires-after"
+
+var quayDurationPattern = regexp.MustCompile(`^[1-9][0-9]*[smhdw]$`)
+
+// ValidateQuayDuration checks that d is a duration Quay accepts for
+// QuayExpiresAfterLabel: a number followed by s, m, h, d or w.
+func ValidateQuayDuration(d string) error {
+	if !quayDurationPattern.MatchString(d) {
+		return fmt.Errorf("invalid expiration %q: want a number followed by s, m, h, d or w (e.g. 12h, 2w)", d)
+	}
+	return nil
+}
+
+// LabelOptions configures PushLabels.
+type LabelOptions struct {
+	// InsecureRegistries are registry hosts reached over HTTP or self-signed TLS.
+	InsecureRegistries []string
+	// Remote are the options for every registry call (auth, transport).
+	Remote []remote.Option
+	// Name, when set, parses src and dst instead of InsecureRegistries.
+	Name []name.Option
+}
+
+// LabelImage returns img with labels added to its config. Only the config
+// changes; the layers are reused.
+func LabelImage(img v1.Image, labels map[string]string) (v1.Image, error) {
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	c := cfg.Config
+	c.Labels = maps.Clone(c.Labels)
+	if c.Labels == nil {
+		c.Labels = map[string]string{}
+	}
+	maps.Copy(c.Labels, labels)
+	return mutate.Config(img, c)
+}
+
+// LabelIndex returns idx with every platform image labeled by LabelImage.
+// Attestation manifests (platform unknown/unknown) are dropped: they
+// describe the unlabeled images.
+func LabelIndex(idx v1.ImageIndex, labels map[string]string) (v1.ImageIndex, error) {
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	mt := im.MediaType
+	if mt == "" {
+		mt = types.OCIImageIndex
+	}
+	var out v1.ImageIndex = mutate.IndexMediaType(empty.Index, mt)
+	for _, d := range im.Manifests {
+		if d.Platform != nil && d.Platform.OS == "unknown" {
+			continue
+		}
+		var add mutate.Appendable
+		if d.MediaType.IsIndex() {
+			child, err := idx.ImageIndex(d.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if add, err = LabelIndex(child, labels); err != nil {
+				return nil, err
+			}
+		} else {
+			img, err := idx.Image(d.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if add, err = LabelImage(img, labels); err != nil {
+				return nil, fmt.Errorf("labeling %s: %w", d.Platform, err)
+			}
+		}
+		out = mutate.AppendManifests(out, mutate.IndexAddendum{
+			Add:        add,
+			Descriptor: v1.Descriptor{Platform: d.Platform, Annotations: d.Annotations},
+		})
+	}
+	if len(im.Annotations) > 0 {
+		out = mutate.Annotations(out, im.Annotations).(v1.ImageIndex)
+	}
+	return out, nil
+}
+
+// PushLabels adds labels to the image or index at src (see LabelImage) and
+// pushes it as dst. The result has a new digest.
+func PushLabels(src, dst string, labels map[string]string, o LabelOptions) (*ManifestList, error) {
+	parse := func(ref string) (name.Reference, error) {
+		if len(o.Name) > 0 {
+			return name.ParseReference(ref, o.Name...)
+		}
+		return ParseReference(ref, o.InsecureRegistries)
+	}
+	srcRef, err := parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", src, err)
+	}
+	dstRef, err := parse(dst)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", dst, err)
+	}
+	desc, err := remote.Get(srcRef, o.Remote...)
+	if err != nil {
+		return nil, fmt.Errorf("getting %s: %w", src, err)
+	}
+
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return nil, err
+		}
+		labeled, err := LabelIndex(idx, labels)
+		if err != nil {
+			return nil, err
+		}
+		if err := remote.WriteIndex(dstRef, labeled, o.Remote...); err != nil {
+			return nil, fmt.Errorf("pushing %s: %w", dst, err)
+		}
+		im, err := labeled.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		var platforms []PlatformDigest
+		for _, m := range im.Manifests {
+			if m.Platform != nil {
+				platforms = append(platforms, PlatformDigest{Platform: m.Platform.String(), Digest: m.Digest.String()})
+			}
+		}
+		digest, err := labeled.Digest()
+		if err != nil {
+			return nil, err
+		}
+		return &ManifestList{Digest: digest.String(), MediaType: im.MediaType, Platforms: platforms}, nil
+	}
+
+	img, err := desc.Image()
+	if err != nil {
+		return nil, err
+	}
+	labeled, err := LabelImage(img, labels)
+	if err != nil {
+		return nil, err
+	}
+	if err := remote.Write(dstRef, labeled, o.Remote...); err != nil {
+		return nil, fmt.Errorf("pushing %s: %w", dst, err)
+	}
+	digest, err := labeled.Digest()
+	if err != nil {
+		return nil, err
+	}
+	mediaType, err := labeled.MediaType()
+	if err != nil {
+		return nil, err
+	}
+	return &ManifestList{Digest: digest.String(), MediaType: mediaType}, nil
+}
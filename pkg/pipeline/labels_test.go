@@ -0,0 +1,78 @@
+package pipeline
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateQuayDuration(t *testing.T) {
+	for _, d := range []string{"30s", "12h", "2d", "1w"} {
+		assert.NoError(t, ValidateQuayDuration(d), d)
+	}
+	for _, d := range []string{"", "2", "0h", "1y", "1h30m", "-1d"} {
+		assert.Error(t, ValidateQuayDuration(d), d)
+	}
+}
+
+func TestLabelImage(t *testing.T) {
+	img, err := random.Image(256, 2)
+	require.NoError(t, err)
+	labeled, err := LabelImage(img, map[string]string{QuayExpiresAfterLabel: "2w"})
+	require.NoError(t, err)
+	cfg, err := labeled.ConfigFile()
+	require.NoError(t, err)
+	assert.Equal(t, "2w", cfg.Config.Labels[QuayExpiresAfterLabel])
+
+	// The layers are reused.
+	want, _ := img.Layers()
+	got, _ := labeled.Layers()
+	require.Len(t, got, len(want))
+	for i := range want {
+		wd, _ := want[i].Digest()
+		gd, _ := got[i].Digest()
+		assert.Equal(t, wd, gd)
+	}
+}
+
+func TestPushLabels(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	insecure := []string{host}
+
+	idx, err := random.Index(256, 1, 2)
+	require.NoError(t, err)
+	src := host + "/acme/app:pr-7"
+	ref, err := ParseReference(src, insecure)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(ref, idx, RemoteOptions(src, insecure)...))
+
+	list, err := PushLabels(src, src, map[string]string{QuayExpiresAfterLabel: "1w"}, LabelOptions{InsecureRegistries: insecure})
+	require.NoError(t, err)
+	srcDigest, _ := idx.Digest()
+	assert.NotEqual(t, srcDigest.String(), list.Digest)
+
+	pushed, err := remote.Index(ref)
+	require.NoError(t, err)
+	digest, _ := pushed.Digest()
+	assert.Equal(t, list.Digest, digest.String())
+	im, err := pushed.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, im.Manifests, 2)
+	for _, m := range im.Manifests {
+		img, err := pushed.Image(m.Digest)
+		require.NoError(t, err)
+		cfg, err := img.ConfigFile()
+		require.NoError(t, err)
+		assert.Equal(t, "1w", cfg.Config.Labels[QuayExpiresAfterLabel])
+	}
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockBuildResultDir takes an exclusive advisory lock (flock) on the
+// directory of path, waiting for other op processes writing a build result
+// there, and returns the function that releases it. Locking the directory
+// leaves no lock file behind.
+func lockBuildResultDir(path string) (func(), error) {
+	dir := filepath.Dir(path)
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("locking %s: %w", dir, err)
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("locking %s: %w", dir, err)
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
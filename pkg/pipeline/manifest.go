@@ -0,0 +1,267 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ManifestListOptions configures PushManifestList.
+type ManifestListOptions struct {
+	// MediaType of the pushed index: types.DockerManifestList or types.OCIImageIndex.
+	MediaType types.MediaType
+	// InsecureRegistries are registry hosts reached over HTTP or self-signed TLS.
+	InsecureRegistries []string
+	// Remote are the options for every registry call (auth, transport).
+	Remote []remote.Option
+	// ChildRetries retries the index push this many times, 1s, 2s, 4s, ...
+	// apart, while the registry does not know its children yet
+	// (MANIFEST_UNKNOWN, MANIFEST_BLOB_UNKNOWN): Harbor records manifests
+	// pushed moments before asynchronously.
+	ChildRetries int
+	// Created, when set, replaces the org.opencontainers.image.created
+	// annotations of the entries, so that the index of a reproducible build
+	// (SOURCE_DATE_EPOCH) does not depend on when its images were built.
+	Created time.Time
+}
+
+// indexRetryDelay is the first pause of ManifestListOptions.ChildRetries; a
+// var so tests need not sleep.
+var indexRetryDelay = time.Second
+
+// CreatedAnnotation is the OCI annotation, and label, holding when an image
+// was built.
+const CreatedAnnotation = "org.opencontainers.image.created"
+
+// WithCreated returns annotations (or labels) with their CreatedAnnotation,
+// when present, set to t; the map is copied, not changed. A zero t returns
+// annotations as they are.
+func WithCreated(annotations map[string]string, t time.Time) map[string]string {
+	if _, ok := annotations[CreatedAnnotation]; !ok || t.IsZero() {
+		return annotations
+	}
+	out := maps.Clone(annotations)
+	out[CreatedAnnotation] = t.UTC().Format(time.RFC3339)
+	return out
+}
+
+// BuildKit annotations of an attestation manifest in an index: its type and
+// the digest of the platform image it describes.
+const (
+	attestationTypeAnnotation   = "vnd.docker.reference.type"
+	attestationDigestAnnotation = "vnd.docker.reference.digest"
+)
+
+// IsAttestation reports whether d, an index child, is an attestation
+// manifest (BuildKit provenance or SBOM) rather than a platform image.
+func IsAttestation(d v1.Descriptor) bool {
+	return d.Annotations[attestationTypeAnnotation] == "attestation-manifest" ||
+		(d.Platform != nil && d.Platform.OS == "unknown")
+}
+
+// ManifestListEntries returns the index entries for ref: the image itself
+// with its platform, or, when ref is an index, each of its platform children
+// (so per-arch indexes can be merged) followed by the attestation manifests
+// that describe them, as BuildKit pushes them. Other children with an
+// unknown platform are skipped.
+func ManifestListEntries(ref string, insecure []string, opts []remote.Option) ([]mutate.IndexAddendum, error) {
+	parsed, err := ParseReference(ref, insecure)
+	if err != nil {
+		return nil, fmt.Errorf("parsing platform tag %s: %w", ref, err)
+	}
+	desc, err := remote.Get(parsed, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("getting platform image %s: %w", ref, err)
+	}
+	if !desc.MediaType.IsIndex() {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, fmt.Errorf("getting image content for %s: %w", ref, err)
+		}
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			return nil, fmt.Errorf("reading config of %s: %w", ref, err)
+		}
+		d := desc.Descriptor
+		d.Platform = cfg.Platform()
+		return []mutate.IndexAddendum{{Add: img, Descriptor: d}}, nil
+	}
+
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("getting index content for %s: %w", ref, err)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	var entries, attestations []mutate.IndexAddendum
+	images := map[string]bool{}
+	for _, m := range im.Manifests {
+		if m.Platform == nil && !IsAttestation(m) {
+			continue
+		}
+		img, err := idx.Image(m.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("getting %s from %s: %w", m.Digest, ref, err)
+		}
+		if IsAttestation(m) {
+			attestations = append(attestations, mutate.IndexAddendum{Add: img, Descriptor: m})
+			continue
+		}
+		images[m.Digest.String()] = true
+		entries = append(entries, mutate.IndexAddendum{Add: img, Descriptor: m})
+	}
+	for _, a := range attestations {
+		if images[a.Annotations[attestationDigestAnnotation]] {
+			entries = append(entries, a)
+		}
+	}
+	return entries, nil
+}
+
+// PlatformImageRef returns the image of ref for platform as
+// repository@digest: the platform child when ref is an index, attestation
+// manifests aside, or ref itself when it is an image.
+func PlatformImageRef(ref, platform string, insecure []string, opts []remote.Option) (string, error) {
+	want, err := v1.ParsePlatform(platform)
+	if err != nil {
+		return "", err
+	}
+	parsed, err := ParseReference(ref, insecure)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s: %w", ref, err)
+	}
+	desc, err := remote.Get(parsed, opts...)
+	if err != nil {
+		return "", fmt.Errorf("getting %s: %w", ref, err)
+	}
+	if !desc.MediaType.IsIndex() {
+		return ref, nil
+	}
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return "", err
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return "", err
+	}
+	for _, m := range im.Manifests {
+		if !IsAttestation(m) && m.Platform != nil && m.Platform.Satisfies(*want) {
+			return parsed.Context().Digest(m.Digest.String()).String(), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no image for platform %s", ref, platform)
+}
+
+// ManifestList is a manifest list pushed by PushManifestList, or the image
+// or index pushed by PushEstargz.
+type ManifestList struct {
+	Digest    string
+	MediaType types.MediaType
+	// Platforms are the digests of the list's platform images, in order.
+	Platforms []PlatformDigest
+}
+
+// PushManifestList assembles a manifest list from the images (or indexes) in
+// refs and pushes it as indexTag. The entries of refs are fetched
+// concurrently through one shared puller, so auth and connections are set up
+// once. Two entries for the same platform are rejected: the result would be
+// ambiguous to pull. Attestation manifests of the entries are kept, in an
+// OCI index whatever o.MediaType.
+func PushManifestList(indexTag string, refs []string, o ManifestListOptions) (*ManifestList, error) {
+	puller, err := remote.NewPuller(o.Remote...)
+	if err != nil {
+		return nil, err
+	}
+	opts := append(slices.Clip(o.Remote), remote.Reuse(puller))
+
+	entries := make([][]mutate.IndexAddendum, len(refs))
+	errs := make([]error, len(refs))
+	var wg sync.WaitGroup
+	for i, ref := range refs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entries[i], errs[i] = ManifestListEntries(ref, o.InsecureRegistries, opts)
+		}()
+	}
+	wg.Wait()
+
+	var index v1.ImageIndex = empty.Index
+	seen := map[string]string{}
+	attested := false
+	var platforms []PlatformDigest
+	for i, ref := range refs {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		for _, e := range entries[i] {
+			if IsAttestation(e.Descriptor) {
+				attested = true
+			} else if p := e.Platform; p != nil {
+				if prev, ok := seen[p.String()]; ok {
+					return nil, fmt.Errorf("platform %s is in both %s and %s", p, prev, ref)
+				}
+				seen[p.String()] = ref
+				platforms = append(platforms, PlatformDigest{Platform: p.String(), Digest: e.Descriptor.Digest.String()})
+			}
+			e.Annotations = WithCreated(e.Annotations, o.Created)
+			index = mutate.AppendManifests(index, e)
+		}
+	}
+
+	mediaType := o.MediaType
+	if attested {
+		// Attestation manifests are OCI manifests: only an OCI index holds them.
+		mediaType = types.OCIImageIndex
+	}
+	index = mutate.IndexMediaType(index, mediaType)
+
+	ref, err := ParseReference(indexTag, o.InsecureRegistries)
+	if err != nil {
+		return nil, fmt.Errorf("parsing full tag %s: %w", indexTag, err)
+	}
+	for attempt := 0; ; attempt++ {
+		err := remote.WriteIndex(ref, index, o.Remote...)
+		if err == nil {
+			break
+		}
+		if attempt >= o.ChildRetries || !isUnknownChild(err) {
+			return nil, fmt.Errorf("writing manifest list %s: %w", indexTag, err)
+		}
+		time.Sleep(indexRetryDelay << attempt)
+	}
+	d, err := index.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("computing index digest: %w", err)
+	}
+	return &ManifestList{Digest: d.String(), MediaType: mediaType, Platforms: platforms}, nil
+}
+
+// isUnknownChild reports whether err is a registry rejecting an index
+// because it does not know a manifest or blob the index refers to.
+func isUnknownChild(err error) bool {
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return false
+	}
+	for _, e := range terr.Errors {
+		switch e.Code {
+		case transport.ManifestUnknownErrorCode, transport.ManifestBlobUnknownErrorCode, transport.BlobUnknownErrorCode:
+			return true
+		}
+	}
+	return false
+}
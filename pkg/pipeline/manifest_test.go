@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// laggingRegistry rejects the first index pushes with MANIFEST_UNKNOWN, as
+// Harbor does while it has not recorded the children yet.
+type laggingRegistry struct {
+	next    http.Handler
+	rejects int
+}
+
+func (l *laggingRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/") &&
+		types.MediaType(r.Header.Get("Content-Type")).IsIndex() && l.rejects > 0 {
+		l.rejects--
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`))
+		return
+	}
+	l.next.ServeHTTP(w, r)
+}
+
+func TestPushManifestList_ChildRetries(t *testing.T) {
+	reg := &laggingRegistry{next: registry.New(registry.Logger(log.New(io.Discard, "", 0)))}
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	insecure := []string{host}
+	orig := indexRetryDelay
+	t.Cleanup(func() { indexRetryDelay = orig })
+	indexRetryDelay = 0
+
+	img, err := random.Image(256, 1)
+	require.NoError(t, err)
+	src := host + "/team/app:amd64"
+	ref, err := ParseReference(src, insecure)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img, RemoteOptions(src, insecure)...))
+	o := ManifestListOptions{MediaType: types.OCIImageIndex, InsecureRegistries: insecure, Remote: RemoteOptions(src, insecure)}
+
+	reg.rejects = 1
+	_, err = PushManifestList(host+"/team/app:latest", []string{src}, o)
+	assert.ErrorContains(t, err, "MANIFEST_UNKNOWN")
+
+	reg.rejects = 2
+	o.ChildRetries = 2
+	list, err := PushManifestList(host+"/team/app:latest", []string{src}, o)
+	require.NoError(t, err)
+	assert.Contains(t, list.Digest, "sha256:")
+	assert.Equal(t, 0, reg.rejects)
+}
+
+// pushAttestedImage pushes to ref an index as BuildKit does for platform: a
+// random image and the attestation manifest describing it. It returns the
+// image digest.
+func pushAttestedImage(t *testing.T, ref, platform string, insecure []string) v1.Hash {
+	t.Helper()
+	p, err := v1.ParsePlatform(platform)
+	require.NoError(t, err)
+	img, err := random.Image(256, 1)
+	require.NoError(t, err)
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	att, err := random.Image(64, 1)
+	require.NoError(t, err)
+	idx := mutate.AppendManifests(mutate.IndexMediaType(empty.Index, types.OCIImageIndex),
+		mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: p}},
+		mutate.IndexAddendum{Add: att, Descriptor: v1.Descriptor{
+			Platform: &v1.Platform{OS: "unknown", Architecture: "unknown"},
+			Annotations: map[string]string{
+				attestationTypeAnnotation:   "attestation-manifest",
+				attestationDigestAnnotation: digest.String(),
+			},
+		}})
+	parsed, err := ParseReference(ref, insecure)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(parsed, idx))
+	return digest
+}
+
+func TestPushManifestList_Attestations(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	insecure := []string{host}
+	amd64 := pushAttestedImage(t, host+"/team/app:latest-linux-amd64", "linux/amd64", insecure)
+	arm64 := pushAttestedImage(t, host+"/team/app:latest-linux-arm64", "linux/arm64", insecure)
+
+	list, err := PushManifestList(host+"/team/app:latest",
+		[]string{host + "/team/app:latest-linux-amd64", host + "/team/app:latest-linux-arm64"},
+		ManifestListOptions{MediaType: types.DockerManifestList, InsecureRegistries: insecure})
+	require.NoError(t, err)
+	assert.Equal(t, types.OCIImageIndex, list.MediaType, "attestations need an OCI index")
+	assert.Equal(t, []PlatformDigest{
+		{Platform: "linux/amd64", Digest: amd64.String()},
+		{Platform: "linux/arm64", Digest: arm64.String()},
+	}, list.Platforms)
+
+	ref, err := ParseReference(host+"/team/app:latest", insecure)
+	require.NoError(t, err)
+	idx, err := remote.Index(ref)
+	require.NoError(t, err)
+	im, err := idx.IndexManifest()
+	require.NoError(t, err)
+	var described []string
+	for _, m := range im.Manifests {
+		if IsAttestation(m) {
+			described = append(described, m.Annotations[attestationDigestAnnotation])
+		}
+	}
+	assert.Len(t, im.Manifests, 4)
+	assert.Equal(t, []string{amd64.String(), arm64.String()}, described)
+
+	got, err := PlatformImageRef(host+"/team/app:latest", "linux/arm64", insecure, nil)
+	require.NoError(t, err)
+	assert.Equal(t, host+"/team/app@"+arm64.String(), got)
+	_, err = PlatformImageRef(host+"/team/app:latest", "linux/s390x", insecure, nil)
+	assert.ErrorContains(t, err, "no image for platform linux/s390x")
+}
+
+func TestPushManifestList_Created(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	insecure := []string{host}
+	img, err := random.Image(256, 1)
+	require.NoError(t, err)
+	// The same image, built at two times that end up in its annotations.
+	for _, built := range []string{"2026-03-01T10:00:00Z", "2026-03-02T11:00:00Z"} {
+		idx := mutate.AppendManifests(mutate.IndexMediaType(empty.Index, types.OCIImageIndex), mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				Platform:    &v1.Platform{OS: "linux", Architecture: "amd64"},
+				Annotations: map[string]string{CreatedAnnotation: built, "team": "platform"},
+			},
+		})
+		ref, err := ParseReference(host+"/team/app:"+built[:10], insecure)
+		require.NoError(t, err)
+		require.NoError(t, remote.WriteIndex(ref, idx))
+	}
+	epoch := time.Unix(1767225600, 0)
+	o := ManifestListOptions{MediaType: types.OCIImageIndex, InsecureRegistries: insecure, Created: epoch}
+
+	first, err := PushManifestList(host+"/team/app:first", []string{host + "/team/app:2026-03-01"}, o)
+	require.NoError(t, err)
+	second, err := PushManifestList(host+"/team/app:second", []string{host + "/team/app:2026-03-02"}, o)
+	require.NoError(t, err)
+	assert.Equal(t, first.Digest, second.Digest)
+
+	ref, err := ParseReference(host+"/team/app:first", insecure)
+	require.NoError(t, err)
+	idx, err := remote.Index(ref)
+	require.NoError(t, err)
+	im, err := idx.IndexManifest()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{CreatedAnnotation: "2026-01-01T00:00:00Z", "team": "platform"}, im.Manifests[0].Annotations)
+
+	o.Created = time.Time{}
+	third, err := PushManifestList(host+"/team/app:third", []string{host + "/team/app:2026-03-02"}, o)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Digest, third.Digest)
+}
+
+func TestWithCreated(t *testing.T) {
+	epoch := time.Unix(1767225600, 0)
+	labels := map[string]string{CreatedAnnotation: "2026-03-01T10:00:00Z", "team": "platform"}
+	assert.Equal(t, map[string]string{CreatedAnnotation: "2026-01-01T00:00:00Z", "team": "platform"}, WithCreated(labels, epoch))
+	assert.Equal(t, "2026-03-01T10:00:00Z", labels[CreatedAnnotation], "the map is copied")
+	assert.Equal(t, map[string]string{"team": "platform"}, WithCreated(map[string]string{"team": "platform"}, epoch))
+	assert.Equal(t, labels, WithCreated(labels, time.Time{}))
+}
@@ -0,0 +1,207 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// CopyFunc copies an image between references; crane.Copy by default.
+type CopyFunc func(src, dst string, opts ...crane.Option) error
+
+// PromoteOptions configures Promote.
+type PromoteOptions struct {
+	// BuildResultDir holds build_result.json (default: cwd).
+	BuildResultDir string
+	// BuildResultFile is the build result to read instead of BuildResultDir.
+	BuildResultFile string
+	// ImageName selects the artifact (default: last entry in build_result.json).
+	ImageName string
+	// SourceRepo and DestinationRepo are the registry prefixes of the two environments.
+	SourceRepo      string
+	DestinationRepo string
+	// Copy replaces crane.Copy, e.g. for tests.
+	Copy CopyFunc
+	// CraneOptions are passed to every copy.
+	CraneOptions []crane.Option
+	// Verify checks the destination after the copy (VerifyCopy by default).
+	Verify CopyFunc
+	// Estargz converts the image to eStargz (see PushEstargz) instead of
+	// copying it as is; the destination then has a new digest, pushed to
+	// the tag of the source.
+	Estargz bool
+	// Logger receives progress (default slog.Default()).
+	Logger *slog.Logger
+}
+
+// Promotion is the source and destination of a promoted image.
+type Promotion struct {
+	Source      string
+	Destination string
+}
+
+// PromotionRefs returns the source and destination of promoting fullRef, a
+// fully-qualified stored ref such as ghcr.io/octopilot/op:v1.0.0@sha256:abc123.
+// The source is fullRef itself; the destination replaces the srcRepo prefix
+// with destRepo.
+func PromotionRefs(fullRef, srcRepo, destRepo string) Promotion {
+	imageRelPath := fullRef
+	if strings.HasPrefix(fullRef, srcRepo+"/") {
+		imageRelPath = strings.TrimPrefix(fullRef, srcRepo+"/")
+	}
+	return Promotion{
+		Source:      fullRef,
+		Destination: fmt.Sprintf("%s/%s", strings.TrimSuffix(destRepo, "/"), imageRelPath),
+	}
+}
+
+// SameRegistry reports whether the references a and b are hosted on the same
+// registry. Copies between repositories of one registry (GHCR org to org, an
+// Artifact Registry host across projects) mount the layers from the source
+// repository instead of downloading and uploading them.
+func SameRegistry(a, b string) bool {
+	ra := registryOf(a)
+	return ra != "" && ra == registryOf(b)
+}
+
+// Promote copies the selected artifact of build_result.json from the source
+// to the destination registry without rebuilding.
+func Promote(ctx context.Context, o PromoteOptions) (*Promotion, error) {
+	if o.SourceRepo == "" || o.DestinationRepo == "" {
+		return nil, fmt.Errorf("source and destination repositories are required")
+	}
+	copyFn := o.Copy
+	if copyFn == nil {
+		copyFn = crane.Copy
+	}
+	verifyFn := o.Verify
+	if verifyFn == nil {
+		verifyFn = VerifyCopy
+	}
+	log := o.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+
+	var res *BuildResult
+	var err error
+	if o.BuildResultFile != "" {
+		res, err = ReadBuildResultFile(o.BuildResultFile)
+	} else {
+		res, err = ReadBuildResult(o.BuildResultDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading build_result.json: %w", err)
+	}
+	fullRef, err := SelectTag(res, o.ImageName)
+	if err != nil {
+		return nil, fmt.Errorf("selecting image: %w", err)
+	}
+
+	p := PromotionRefs(fullRef, o.SourceRepo, o.DestinationRepo)
+	log.Info("Promoting image", "source", p.Source, "destination", p.Destination)
+	if o.Estargz {
+		// The converted image has a new digest: push it by tag.
+		dst, _, _ := strings.Cut(p.Destination, "@")
+		if i := strings.LastIndex(dst, ":"); i < strings.LastIndex(dst, "/") || i < 0 {
+			return nil, fmt.Errorf("eStargz promotion needs a tagged image, got %s", fullRef)
+		}
+		co := crane.GetOptions(append(slices.Clip(o.CraneOptions), crane.WithContext(ctx))...)
+		list, err := PushEstargz(p.Source, dst, EstargzOptions{Remote: co.Remote, Name: co.Name})
+		if err != nil {
+			return nil, fmt.Errorf("promotion failed: %w", err)
+		}
+		p.Destination = dst + "@" + list.Digest
+		log.Info("Converted image to eStargz", "destination", p.Destination)
+		return &p, nil
+	}
+	if SameRegistry(p.Source, p.Destination) {
+		// crane.Copy asks the registry to mount each blob from the source
+		// repository, so the layers never leave it.
+		log.Info("Mounting layers from the source repository", "registry", registryOf(p.Destination))
+	}
+	if err := copyFn(p.Source, p.Destination, append(slices.Clip(o.CraneOptions), crane.WithContext(ctx))...); err != nil {
+		return nil, fmt.Errorf("promotion failed: %w", err)
+	}
+	if err := verifyFn(p.Source, p.Destination, append(slices.Clip(o.CraneOptions), crane.WithContext(ctx))...); err != nil {
+		return nil, fmt.Errorf("promotion failed verification: %w", err)
+	}
+	log.Info("Verified promoted image", "destination", p.Destination)
+	return &p, nil
+}
+
+// VerifyCopy checks that dst holds exactly the image or index at src: dst
+// must resolve to the digest of src and, for an index, every child manifest
+// must be present in the destination repository. It catches registries and
+// mirrors that rewrite manifests (and so digests) on push, or drop platform
+// images.
+func VerifyCopy(src, dst string, opts ...crane.Option) error {
+	o := crane.GetOptions(opts...)
+	srcRef, err := name.ParseReference(src, o.Name...)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", src, err)
+	}
+	dstRef, err := name.ParseReference(dst, o.Name...)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", dst, err)
+	}
+
+	want, err := remote.Get(srcRef, o.Remote...)
+	if err != nil {
+		return fmt.Errorf("getting %s: %w", src, err)
+	}
+	got, err := remote.Head(dstRef, o.Remote...)
+	if err != nil {
+		return fmt.Errorf("checking %s: %w", dst, err)
+	}
+	if got.Digest != want.Digest {
+		return fmt.Errorf("%s resolves to %s, not the source digest %s: the destination registry rewrote the manifest", dst, got.Digest, want.Digest)
+	}
+	if !want.MediaType.IsIndex() {
+		return nil
+	}
+
+	idx, err := want.ImageIndex()
+	if err != nil {
+		return err
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, m := range im.Manifests {
+		child := dstRef.Context().Digest(m.Digest.String())
+		if _, err := remote.Head(child, o.Remote...); err != nil {
+			missing = append(missing, fmt.Sprintf("%s (%s)", m.Digest, platformOf(m.Platform)))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s is missing %d of %d index children: %s", dstRef.Context(), len(missing), len(im.Manifests), strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// platformOf formats p for messages ("unknown" when the descriptor has none).
+func platformOf(p *v1.Platform) string {
+	if p == nil {
+		return "unknown"
+	}
+	return p.String()
+}
+
+// registryOf returns the registry host of ref ("" when ref does not parse).
+func registryOf(ref string) string {
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return ""
+	}
+	return r.Context().RegistryStr()
+}
@@ -0,0 +1,177 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromotionRefs(t *testing.T) {
+	p := PromotionRefs("ghcr.io/acme/op:v1@sha256:bbb", "ghcr.io/acme", "europe-west1-docker.pkg.dev/proj/reg/")
+	assert.Equal(t, "ghcr.io/acme/op:v1@sha256:bbb", p.Source)
+	assert.Equal(t, "europe-west1-docker.pkg.dev/proj/reg/op:v1@sha256:bbb", p.Destination)
+
+	// A ref outside the source repo keeps its full path under the destination.
+	p = PromotionRefs("docker.io/library/nginx:1", "ghcr.io/acme", "registry.internal")
+	assert.Equal(t, "registry.internal/docker.io/library/nginx:1", p.Destination)
+}
+
+func TestPromote(t *testing.T) {
+	dir := t.TempDir()
+	writeBuildResultFixture(t, dir, []BuildEntry{
+		{ImageName: "op-base", Tag: "ghcr.io/acme/op-base:v1@sha256:aaa"},
+		{ImageName: "op", Tag: "ghcr.io/acme/op:v1@sha256:bbb"},
+	})
+
+	var copied []string
+	o := PromoteOptions{
+		BuildResultDir:  dir,
+		ImageName:       "op-base",
+		SourceRepo:      "ghcr.io/acme",
+		DestinationRepo: "registry.internal/prod",
+		Copy: func(src, dst string, _ ...crane.Option) error {
+			copied = append(copied, src, dst)
+			return nil
+		},
+		Verify: func(string, string, ...crane.Option) error { return nil },
+		Logger: slog.New(slog.DiscardHandler),
+	}
+	p, err := Promote(context.Background(), o)
+	require.NoError(t, err)
+	assert.Equal(t, "registry.internal/prod/op-base:v1@sha256:aaa", p.Destination)
+	assert.Equal(t, []string{"ghcr.io/acme/op-base:v1@sha256:aaa", "registry.internal/prod/op-base:v1@sha256:aaa"}, copied)
+
+	o.Verify = func(string, string, ...crane.Option) error { return errors.New("digest differs") }
+	_, err = Promote(context.Background(), o)
+	assert.ErrorContains(t, err, "promotion failed verification: digest differs")
+
+	o.Copy = func(string, string, ...crane.Option) error { return errors.New("denied") }
+	_, err = Promote(context.Background(), o)
+	assert.ErrorContains(t, err, "promotion failed: denied")
+
+	o.DestinationRepo = ""
+	_, err = Promote(context.Background(), o)
+	assert.ErrorContains(t, err, "repositories are required")
+}
+
+func TestSameRegistry(t *testing.T) {
+	assert.True(t, SameRegistry("ghcr.io/a/app:v1@sha256:"+strings.Repeat("a", 64), "ghcr.io/b/app:v1"))
+	assert.True(t, SameRegistry("europe-docker.pkg.dev/dev/reg/app:v1", "europe-docker.pkg.dev/prod/reg/app:v1"))
+	assert.False(t, SameRegistry("ghcr.io/a/app:v1", "europe-docker.pkg.dev/prod/reg/app:v1"))
+	assert.False(t, SameRegistry("not a ref", "not a ref"))
+}
+
+// mountingRegistry is a test registry whose prod/ repositories only hold
+// the blobs mounted into them, and which counts mounts and uploads.
+type mountingRegistry struct {
+	next    http.Handler
+	mu      sync.Mutex
+	mounted map[string]bool
+	mounts  int
+	uploads int
+}
+
+func (m *mountingRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	repo, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v2/"), "/blobs/")
+	switch {
+	case r.Method == http.MethodHead && strings.HasPrefix(repo, "prod/") && strings.HasPrefix(rest, "sha256:"):
+		if !m.mounted[repo+"@"+rest] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	case r.Method == http.MethodPost && r.URL.Query().Get("mount") != "":
+		m.mounts++
+		m.mounted[repo+"@"+r.URL.Query().Get("mount")] = true
+		w.WriteHeader(http.StatusCreated)
+		return
+	case strings.HasPrefix(rest, "uploads/") && (r.Method == http.MethodPatch || r.Method == http.MethodPut):
+		m.uploads++
+	}
+	m.next.ServeHTTP(w, r)
+}
+
+func TestPromote_MountsWithinRegistry(t *testing.T) {
+	reg := &mountingRegistry{next: registry.New(registry.Logger(log.New(io.Discard, "", 0))), mounted: map[string]bool{}}
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	img, err := random.Image(1024, 3)
+	require.NoError(t, err)
+	src := host + "/acme/app:v1"
+	ref, err := ParseReference(src, []string{host})
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	writeBuildResultFixture(t, dir, []BuildEntry{{ImageName: "app", Tag: src + "@" + digest.String()}})
+	reg.uploads = 0
+
+	_, err = Promote(context.Background(), PromoteOptions{
+		BuildResultDir:  dir,
+		SourceRepo:      host + "/acme",
+		DestinationRepo: host + "/prod",
+		CraneOptions:    []crane.Option{crane.Insecure},
+		Logger:          slog.New(slog.DiscardHandler),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4, reg.mounts, "3 layers and the config are mounted")
+	assert.Zero(t, reg.uploads, "no blob goes through the runner")
+}
+
+func TestVerifyCopy(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	opts := []crane.Option{crane.Insecure}
+
+	idx, err := random.Index(256, 1, 2)
+	require.NoError(t, err)
+	digest, err := idx.Digest()
+	require.NoError(t, err)
+	srcRef, err := ParseReference(host+"/acme/app:v1", []string{host})
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(srcRef, idx))
+	src := host + "/acme/app:v1@" + digest.String()
+	dst := host + "/prod/app:v1@" + digest.String()
+
+	require.NoError(t, crane.Copy(src, dst, opts...))
+	require.NoError(t, VerifyCopy(src, dst, opts...))
+
+	// A child manifest the destination lost.
+	im, err := idx.IndexManifest()
+	require.NoError(t, err)
+	child, err := ParseReference(host+"/prod/app@"+im.Manifests[1].Digest.String(), []string{host})
+	require.NoError(t, err)
+	require.NoError(t, remote.Delete(child))
+	err = VerifyCopy(src, dst, opts...)
+	assert.ErrorContains(t, err, "is missing 1 of 2 index children: "+im.Manifests[1].Digest.String())
+
+	// A destination holding another manifest.
+	other, err := random.Image(256, 1)
+	require.NoError(t, err)
+	otherDigest, err := other.Digest()
+	require.NoError(t, err)
+	otherRef, err := ParseReference(host+"/prod/other:v1", []string{host})
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(otherRef, other))
+	err = VerifyCopy(src, host+"/prod/other@"+otherDigest.String(), opts...)
+	assert.ErrorContains(t, err, "not the source digest "+digest.String())
+}
@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// IsInsecureRegistry reports whether ref is hosted on one of insecureRegistries.
+func IsInsecureRegistry(ref string, insecureRegistries []string) bool {
+	for _, reg := range insecureRegistries {
+		if strings.HasPrefix(ref, reg) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteOptions returns the remote options for tag: credentials from the
+// Docker keychain and, for an insecure registry, a transport that skips TLS
+// verification.
+func RemoteOptions(tag string, insecureRegistries []string) []remote.Option {
+	opts := []remote.Option{remote.WithAuthFromKeychain(authn.DefaultKeychain)}
+	if IsInsecureRegistry(tag, insecureRegistries) {
+		t := &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+		opts = append(opts, remote.WithTransport(t))
+	}
+	return opts
+}
+
+// ParseReference parses an image reference for use with remote get/write.
+// When the tag's registry is in insecureRegistries, uses name.Insecure so that HTTP
+// (no TLS) is allowed; InsecureSkipVerify in remote options handles self-signed TLS.
+func ParseReference(tag string, insecureRegistries []string) (name.Reference, error) {
+	if IsInsecureRegistry(tag, insecureRegistries) {
+		return name.ParseReference(tag, name.Insecure)
+	}
+	return name.ParseReference(tag)
+}
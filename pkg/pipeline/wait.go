@@ -0,0 +1,173 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// HeadFunc resolves the descriptor of a remote image; remote.Head by default.
+type HeadFunc func(ref name.Reference, options ...remote.Option) (*v1.Descriptor, error)
+
+// GetFunc fetches a remote image or index; remote.Get by default.
+type GetFunc func(ref name.Reference, options ...remote.Option) (*remote.Descriptor, error)
+
+// WaitOptions configures WaitForImage.
+type WaitOptions struct {
+	// Timeout bounds the wait.
+	Timeout time.Duration
+	// Interval is the first pause between polls (default 1s); each pause
+	// doubles, up to MaxInterval (default 15s), with ±20% jitter.
+	Interval    time.Duration
+	MaxInterval time.Duration
+	// InsecureRegistries are registry hosts reached over HTTP or self-signed TLS.
+	InsecureRegistries []string
+	// Remote are the options for every registry call (auth, transport).
+	Remote []remote.Option
+	// Head replaces remote.Head, e.g. for tests.
+	Head HeadFunc
+	// Get replaces remote.Get, which fetches an index and its children.
+	Get GetFunc
+	// Logger receives progress (default slog.Default()).
+	Logger *slog.Logger
+}
+
+// WaitForImage polls the registry until tag is available, the timeout
+// expires or ctx is done. Some registries (GHCR, etc.) do not serve a pushed
+// image immediately, which breaks a subsequent build step that pulls it.
+// When tag is an index, every child manifest and its config must be
+// served too: registries may serve the index before its platform images
+// have replicated. Polls back off exponentially; a response other than 404
+// Not Found, 429 or a 5xx (e.g. 401 or 403) ends the wait at once with that
+// error.
+func WaitForImage(ctx context.Context, tag string, o WaitOptions) error {
+	head := o.Head
+	if head == nil {
+		head = remote.Head
+	}
+	get := o.Get
+	if get == nil {
+		get = remote.Get
+	}
+	log := o.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	log = log.With("tag", tag)
+	interval := o.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	maxInterval := o.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = 15 * time.Second
+	}
+	log.Info("Waiting for image propagation", "timeout", o.Timeout)
+
+	ref, err := ParseReference(tag, o.InsecureRegistries)
+	if err != nil {
+		return err
+	}
+
+	opts := append(slices.Clip(o.Remote), remote.WithContext(ctx))
+	start := time.Now()
+	deadline := start.Add(o.Timeout)
+	for attempt := 1; ; attempt++ {
+		desc, err := head(ref, opts...)
+		if err == nil && desc.MediaType.IsIndex() {
+			err = indexChildrenAvailable(ref, get, opts)
+		}
+		if err == nil {
+			if attempt == 1 {
+				log.Info("Image found")
+			} else {
+				log.Info("Image found", "waited", time.Since(start).Round(time.Second), "attempts", attempt)
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("waiting for image %s: %w", tag, ctx.Err())
+		}
+		if !retryableHeadError(err) {
+			return fmt.Errorf("checking image %s: %w", tag, err)
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("timeout waiting for image %s after %s: %w", tag, o.Timeout, err)
+		}
+		pause := min(jitter(interval), remaining)
+		log.Debug("Image not available yet", "error", err, "retry_in", pause.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for image %s: %w", tag, ctx.Err())
+		case <-time.After(pause):
+		}
+		interval = min(interval*2, maxInterval)
+	}
+}
+
+// indexChildrenAvailable fetches the index at ref and checks that each child
+// manifest, and the config of each child image, can be pulled from its
+// repository.
+func indexChildrenAvailable(ref name.Reference, get GetFunc, opts []remote.Option) error {
+	desc, err := get(ref, opts...)
+	if err != nil {
+		return err
+	}
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return err
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return err
+	}
+	for _, m := range im.Manifests {
+		child := ref.Context().Digest(m.Digest.String())
+		if m.MediaType.IsIndex() {
+			if err := indexChildrenAvailable(child, get, opts); err != nil {
+				return err
+			}
+			continue
+		}
+		cd, err := get(child, opts...)
+		if err != nil {
+			return fmt.Errorf("child %s (%s): %w", m.Digest, platformOf(m.Platform), err)
+		}
+		img, err := cd.Image()
+		if err != nil {
+			return err
+		}
+		if _, err := img.RawConfigFile(); err != nil {
+			return fmt.Errorf("config of child %s (%s): %w", m.Digest, platformOf(m.Platform), err)
+		}
+	}
+	return nil
+}
+
+// retryableHeadError reports whether a failed manifest HEAD may succeed
+// later: the image is not there yet (404), the registry is busy (429, 5xx)
+// or the request did not get an answer at all.
+func retryableHeadError(err error) bool {
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return true
+	}
+	return terr.StatusCode == http.StatusNotFound || terr.StatusCode == http.StatusTooManyRequests ||
+		terr.StatusCode >= http.StatusInternalServerError
+}
+
+// jitter returns d ±20%, so that builds waiting together do not poll in step.
+func jitter(d time.Duration) time.Duration {
+	return d*4/5 + rand.N(d*2/5+1)
+}
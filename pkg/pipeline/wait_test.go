@@ -0,0 +1,167 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForImage(t *testing.T) {
+	calls := 0
+	o := WaitOptions{
+		Timeout:  time.Second,
+		Interval: time.Millisecond,
+		Head: func(name.Reference, ...remote.Option) (*v1.Descriptor, error) {
+			calls++
+			if calls < 3 {
+				return nil, errors.New("MANIFEST_UNKNOWN")
+			}
+			return &v1.Descriptor{}, nil
+		},
+		Logger: slog.New(slog.DiscardHandler),
+	}
+	assert.NoError(t, WaitForImage(context.Background(), "ghcr.io/acme/op:v1", o))
+	assert.Equal(t, 3, calls)
+
+	o.Timeout = 5 * time.Millisecond
+	o.Head = func(name.Reference, ...remote.Option) (*v1.Descriptor, error) {
+		return nil, errors.New("MANIFEST_UNKNOWN")
+	}
+	assert.ErrorContains(t, WaitForImage(context.Background(), "ghcr.io/acme/op:v1", o), "timeout waiting for image")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	o.Timeout = time.Minute
+	assert.ErrorIs(t, WaitForImage(ctx, "ghcr.io/acme/op:v1", o), context.Canceled)
+
+	// The caller's options are not written to, even with spare capacity.
+	shared := make([]remote.Option, 1, 4)
+	o.Remote, o.Timeout = shared, time.Second
+	o.Head = func(name.Reference, ...remote.Option) (*v1.Descriptor, error) { return &v1.Descriptor{}, nil }
+	require.NoError(t, WaitForImage(context.Background(), "ghcr.io/acme/op:v1", o))
+	assert.Nil(t, shared[:2][1])
+}
+
+func TestWaitForImage_Backoff(t *testing.T) {
+	var polls []time.Time
+	o := WaitOptions{
+		Timeout:     time.Second,
+		Interval:    10 * time.Millisecond,
+		MaxInterval: 40 * time.Millisecond,
+		Head: func(name.Reference, ...remote.Option) (*v1.Descriptor, error) {
+			polls = append(polls, time.Now())
+			if len(polls) < 5 {
+				return nil, &transport.Error{StatusCode: http.StatusNotFound}
+			}
+			return &v1.Descriptor{}, nil
+		},
+		Logger: slog.New(slog.DiscardHandler),
+	}
+	require.NoError(t, WaitForImage(context.Background(), "ghcr.io/acme/op:v1", o))
+	require.Len(t, polls, 5)
+	// Pauses of about 10, 20, 40 and 40ms (±20%).
+	for i, want := range []time.Duration{10, 20, 40, 40} {
+		assert.GreaterOrEqual(t, polls[i+1].Sub(polls[i]), want*time.Millisecond*4/5, "pause %d", i)
+	}
+}
+
+func TestWaitForImage_FailsFast(t *testing.T) {
+	calls := 0
+	o := WaitOptions{
+		Timeout:  time.Minute,
+		Interval: time.Millisecond,
+		Head: func(name.Reference, ...remote.Option) (*v1.Descriptor, error) {
+			calls++
+			if calls == 1 {
+				return nil, &transport.Error{StatusCode: http.StatusServiceUnavailable}
+			}
+			return nil, &transport.Error{StatusCode: http.StatusUnauthorized}
+		},
+		Logger: slog.New(slog.DiscardHandler),
+	}
+	err := WaitForImage(context.Background(), "ghcr.io/acme/op:v1", o)
+	assert.ErrorContains(t, err, "checking image ghcr.io/acme/op:v1")
+	assert.Equal(t, 2, calls, "a 503 is retried, a 401 is not")
+}
+
+// replicatingRegistry answers 404 Not Found for the paths in missing, as a
+// registry whose replicas have not received them yet.
+type replicatingRegistry struct {
+	next    http.Handler
+	mu      sync.Mutex
+	missing map[string]int
+}
+
+func (r *replicatingRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	for path, n := range r.missing {
+		if n > 0 && strings.HasSuffix(req.URL.Path, path) {
+			r.missing[path]--
+			r.mu.Unlock()
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+	r.mu.Unlock()
+	r.next.ServeHTTP(w, req)
+}
+
+func TestWaitForImage_IndexChildren(t *testing.T) {
+	reg := &replicatingRegistry{next: registry.New(registry.Logger(log.New(io.Discard, "", 0)))}
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	insecure := []string{host}
+
+	idx, err := random.Index(256, 1, 2)
+	require.NoError(t, err)
+	tag := host + "/team/app:v1"
+	ref, err := ParseReference(tag, insecure)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(ref, idx))
+	im, err := idx.IndexManifest()
+	require.NoError(t, err)
+	child, err := idx.Image(im.Manifests[1].Digest)
+	require.NoError(t, err)
+	config, err := child.ConfigName()
+	require.NoError(t, err)
+
+	o := WaitOptions{Timeout: time.Second, Interval: time.Millisecond, InsecureRegistries: insecure, Logger: slog.New(slog.DiscardHandler)}
+	reg.missing = map[string]int{
+		"/manifests/" + im.Manifests[1].Digest.String(): 2,
+		"/blobs/" + config.String():                     2,
+	}
+	require.NoError(t, WaitForImage(context.Background(), tag, o))
+	assert.Equal(t, map[string]int{"/manifests/" + im.Manifests[1].Digest.String(): 0, "/blobs/" + config.String(): 0}, reg.missing)
+
+	reg.missing = map[string]int{"/manifests/" + im.Manifests[0].Digest.String(): 1 << 20}
+	o.Timeout = 20 * time.Millisecond
+	err = WaitForImage(context.Background(), tag, o)
+	assert.ErrorContains(t, err, "timeout waiting for image")
+	assert.ErrorContains(t, err, "child "+im.Manifests[0].Digest.String())
+}
+
+func TestJitter(t *testing.T) {
+	for range 100 {
+		d := jitter(time.Second)
+		assert.GreaterOrEqual(t, d, 800*time.Millisecond)
+		assert.LessOrEqual(t, d, 1200*time.Millisecond)
+	}
+}
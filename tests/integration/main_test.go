@@ -118,15 +118,6 @@ func setupBuildEnv(t *testing.T, cmd *exec.Cmd, repoHost string) {
 	// Enable pack debug logging for troubleshooting
 	cmd.Env = append(cmd.Env, "OP_DEBUG=true")
 
-	// CRITICAL: Disable default BuildKit attestations (provenance).
-	// Without this, BuildKit creates an OCI Image Index containing both the image manifest
-	// and an attestation manifest (platform: unknown/unknown).
-	// The `pack` lifecycle (via go-containerregistry) fails to handle this Index correctly when
-	// trying to use it as a run-image, resulting in the error:
-	// "failed to export: get run image top layer SHA: image has no layers".
-	// Setting this env var forces a standard single-manifest image.
-	cmd.Env = append(cmd.Env, "BUILDX_NO_DEFAULT_ATTESTATIONS=1")
-
 	// In CI (GitHub Actions) and now on Mac with the TLS registry, we might need host networking
 	// or just standard access.
 	if os.Getenv("CI") == "true" || runtime.GOOS == "darwin" {